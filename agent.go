@@ -0,0 +1,578 @@
+package mailos
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+// defaultAgentSteps caps the tool calls made for one question
+const defaultAgentSteps = 12
+
+// AgentTool is a function the chat agent can call. Tools that send, move or
+// delete mail set Confirm, so they only run once the user agrees.
+type AgentTool struct {
+	Name        string
+	Description string
+	Parameters  map[string]interface{} // JSON schema of the arguments
+	Confirm     bool
+	Run         func(ctx context.Context, args json.RawMessage) (string, error)
+	Describe    func(args json.RawMessage) string // What a call affects, shown when asking to confirm; optional
+}
+
+// NewAgentTool makes a tool whose arguments are decoded into T. The schema
+// comes from T's fields: the json tag names the argument, a desc tag
+// describes it, and arguments without omitempty are required.
+func NewAgentTool[T any](name, description string, confirm bool, run func(ctx context.Context, args T) (string, error)) *AgentTool {
+	var zero T
+	return &AgentTool{
+		Name:        name,
+		Description: description,
+		Parameters:  toolSchema(reflect.TypeOf(zero)),
+		Confirm:     confirm,
+		Run: func(ctx context.Context, raw json.RawMessage) (string, error) {
+			var args T
+			if err := decodeToolArgs(raw, &args); err != nil {
+				return "", err
+			}
+			return run(ctx, args)
+		},
+	}
+}
+
+// toolSchema describes a struct's fields as a JSON schema object
+func toolSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		property := jsonSchemaType(field.Type)
+		if desc := field.Tag.Get("desc"); desc != "" {
+			property["description"] = desc
+		}
+		properties[name] = property
+		if !strings.Contains(options, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	return map[string]interface{}{"type": "object", "properties": properties, "required": required}
+}
+
+func jsonSchemaType(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": jsonSchemaType(t.Elem())}
+	}
+	return map[string]interface{}{}
+}
+
+// decodeToolArgs decodes the model's arguments strictly, so a misspelt or
+// missing argument is reported back to the model rather than ignored
+func decodeToolArgs(raw json.RawMessage, args interface{}) error {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		raw = json.RawMessage("{}")
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(args); err != nil {
+		return fmt.Errorf("invalid arguments: %v", err)
+	}
+
+	var given map[string]json.RawMessage
+	json.Unmarshal(raw, &given)
+	for _, name := range toolSchema(reflect.TypeOf(args).Elem())["required"].([]string) {
+		if _, ok := given[name]; !ok {
+			return fmt.Errorf("missing required argument %q", name)
+		}
+	}
+	return nil
+}
+
+// AgentEvent is one line of the chat transcript
+type AgentEvent struct {
+	Time      time.Time       `json:"time"`
+	Type      string          `json:"type"` // user, assistant, tool_call, tool_result or error
+	Content   string          `json:"content,omitempty"`
+	Tool      string          `json:"tool,omitempty"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+	Confirmed *bool           `json:"confirmed,omitempty"` // Set for tools that needed confirmation
+}
+
+// Agent answers questions by letting the model call mail tools in a loop
+// until it has an answer
+type Agent struct {
+	Backend    AIToolBackend
+	System     string
+	Tools      []*AgentTool
+	Confirm    func(tool *AgentTool, args json.RawMessage) bool // Asked before tools that send, move or delete
+	Transcript io.Writer                                        // JSON lines of every step; nil to skip
+	Out        io.Writer                                        // Progress notes; nil for none
+	MaxSteps   int
+
+	messages []AIMessage // The conversation so far, kept between questions
+}
+
+// Ask sends the question and runs the tools the model calls, returning its answer
+func (a *Agent) Ask(ctx context.Context, question string) (string, error) {
+	a.messages = append(a.messages, AIMessage{Role: "user", Content: question})
+	a.record(AgentEvent{Type: "user", Content: question})
+
+	tools := make([]AITool, len(a.Tools))
+	for i, tool := range a.Tools {
+		tools[i] = AITool{Name: tool.Name, Description: tool.Description, Parameters: tool.Parameters}
+	}
+	maxSteps := a.MaxSteps
+	if maxSteps <= 0 {
+		maxSteps = defaultAgentSteps
+	}
+
+	for step := 0; step < maxSteps; step++ {
+		reply, err := a.Backend.CompleteWithTools(ctx, &AIRequest{System: a.System, Messages: a.messages}, tools)
+		if err != nil {
+			a.record(AgentEvent{Type: "error", Content: err.Error()})
+			return "", err
+		}
+		a.messages = append(a.messages, *reply)
+		if len(reply.ToolCalls) == 0 {
+			a.record(AgentEvent{Type: "assistant", Content: reply.Content})
+			return reply.Content, nil
+		}
+		if strings.TrimSpace(reply.Content) != "" {
+			a.record(AgentEvent{Type: "assistant", Content: reply.Content})
+		}
+
+		// Every call gets an answer, or the model can't continue the conversation
+		for _, call := range reply.ToolCalls {
+			result := a.call(ctx, call)
+			a.messages = append(a.messages, AIMessage{Role: "tool", ToolCallID: call.ID, Content: result})
+		}
+	}
+	err := fmt.Errorf("stopped after %d steps without an answer", maxSteps)
+	a.record(AgentEvent{Type: "error", Content: err.Error()})
+	return "", err
+}
+
+// call runs one tool call, behind the confirmation gate when the tool needs
+// it, and returns what the model is told
+func (a *Agent) call(ctx context.Context, call AIToolCall) string {
+	args := json.RawMessage(call.Function.Arguments)
+	if strings.TrimSpace(call.Function.Arguments) == "" {
+		args = json.RawMessage("{}")
+	} else if !json.Valid(args) {
+		args = nil
+	}
+	event := AgentEvent{Type: "tool_call", Tool: call.Function.Name, Arguments: args}
+
+	var tool *AgentTool
+	for _, t := range a.Tools {
+		if t.Name == call.Function.Name {
+			tool = t
+		}
+	}
+	if tool == nil {
+		a.record(event)
+		return a.result(call.Function.Name, fmt.Sprintf("Error: there is no tool called %q", call.Function.Name))
+	}
+	if args == nil {
+		a.record(event)
+		return a.result(tool.Name, fmt.Sprintf("Error: arguments are not valid JSON: %s", call.Function.Arguments))
+	}
+
+	if tool.Confirm {
+		// Without a way to ask, actions that need confirmation never run
+		confirmed := a.Confirm != nil && a.Confirm(tool, args)
+		event.Confirmed = &confirmed
+		a.record(event)
+		if !confirmed {
+			return a.result(tool.Name, "The user declined this action. Don't retry it unless they ask again.")
+		}
+	} else {
+		a.record(event)
+	}
+
+	if a.Out != nil {
+		fmt.Fprintf(a.Out, "🔧 %s %s\n", tool.Name, compactJSON(args))
+	}
+	output, err := tool.Run(ctx, args)
+	if err != nil {
+		return a.result(tool.Name, "Error: "+err.Error())
+	}
+	return a.result(tool.Name, output)
+}
+
+func (a *Agent) result(tool, content string) string {
+	a.record(AgentEvent{Type: "tool_result", Tool: tool, Content: content})
+	return content
+}
+
+func (a *Agent) record(event AgentEvent) {
+	if a.Transcript == nil {
+		return
+	}
+	event.Time = time.Now()
+	if data, err := json.Marshal(event); err == nil {
+		a.Transcript.Write(append(data, '\n'))
+	}
+}
+
+func compactJSON(raw json.RawMessage) string {
+	var out bytes.Buffer
+	if err := json.Compact(&out, raw); err != nil {
+		return string(raw)
+	}
+	return out.String()
+}
+
+// ConfirmAgentAction asks on the terminal before the agent sends, moves or
+// deletes, listing the messages affected
+func ConfirmAgentAction(in *bufio.Reader, out io.Writer) func(tool *AgentTool, args json.RawMessage) bool {
+	return func(tool *AgentTool, args json.RawMessage) bool {
+		var pretty bytes.Buffer
+		if json.Indent(&pretty, args, "   ", "  ") != nil {
+			pretty.Write(args)
+		}
+		fmt.Fprintf(out, "\n⚠️  The assistant wants to run %s:\n   %s\n", tool.Name, pretty.String())
+		if tool.Describe != nil {
+			fmt.Fprint(out, tool.Describe(args))
+		}
+		fmt.Fprint(out, "Allow it? (y/N): ")
+		answer, _ := in.ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "y" || answer == "yes"
+	}
+}
+
+// OpenChatTranscript creates a transcript file for a chat session under the
+// account's directory
+func OpenChatTranscript(accountEmail string) (*os.File, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %v", err)
+	}
+	dir := filepath.Join(homeDir, ".email", accountEmail, "transcripts")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create transcript directory: %v", err)
+	}
+	name := fmt.Sprintf("chat-%s.jsonl", time.Now().Format("20060102-150405"))
+	return os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+}
+
+// Arguments of the mail tools
+
+type searchToolArgs struct {
+	From       string `json:"from,omitempty" desc:"Sender address or name contains this"`
+	To         string `json:"to,omitempty" desc:"Recipient contains this"`
+	Subject    string `json:"subject,omitempty" desc:"Subject contains this"`
+	Text       string `json:"text,omitempty" desc:"Subject or body contains this"`
+	UnreadOnly bool   `json:"unread_only,omitempty"`
+	Days       int    `json:"days,omitempty" desc:"Only messages from the last N days"`
+	Limit      int    `json:"limit,omitempty" desc:"Most messages to return, 20 by default"`
+}
+
+type readToolArgs struct {
+	ID uint32 `json:"id" desc:"Message UID from search_emails"`
+}
+
+type draftToolArgs struct {
+	To        []string `json:"to" desc:"Recipient addresses"`
+	CC        []string `json:"cc,omitempty"`
+	Subject   string   `json:"subject"`
+	Body      string   `json:"body" desc:"Markdown body, without a signature"`
+	ReplyToID uint32   `json:"reply_to_id,omitempty" desc:"Message UID this replies to, for threading"`
+}
+
+type sendToolArgs struct {
+	To      []string `json:"to" desc:"Recipient addresses"`
+	CC      []string `json:"cc,omitempty"`
+	Subject string   `json:"subject"`
+	Body    string   `json:"body" desc:"Markdown body, without a signature"`
+}
+
+type labelToolArgs struct {
+	IDs   []uint32 `json:"ids" desc:"Message UIDs from search_emails"`
+	Label string   `json:"label"`
+}
+
+type moveToolArgs struct {
+	IDs    []uint32 `json:"ids" desc:"Message UIDs from search_emails"`
+	Folder string   `json:"folder" desc:"Destination folder, created if needed"`
+}
+
+type deleteToolArgs struct {
+	IDs []uint32 `json:"ids" desc:"Message UIDs from search_emails"`
+}
+
+// MailAgentTools are the tools the chat agent works with, backed by the
+// same functions as the mailos commands. Messages are named by their INBOX
+// UIDs, as shown by search_emails, which unlike sequence numbers don't
+// change when other messages are moved or deleted.
+func MailAgentTools(config *Config) []*AgentTool {
+	maxContextTokens := config.GetAISettings().MaxContextTokens
+	return []*AgentTool{
+		NewAgentTool("search_emails", "Search INBOX. Returns one line per message: UID, date, sender, subject.", false,
+			func(ctx context.Context, args searchToolArgs) (string, error) {
+				limit := args.Limit
+				if limit <= 0 {
+					limit = 20
+				}
+				opts := ReadOptions{FromAddress: args.From, ToAddress: args.To, Subject: args.Subject, UnreadOnly: args.UnreadOnly, Limit: limit}
+				if args.Text != "" {
+					// Read more so the text filter still has enough to choose from
+					opts.Limit = limit * 10
+				}
+				if args.Days > 0 {
+					opts.Since = time.Now().AddDate(0, 0, -args.Days)
+				}
+				emails, err := Read(opts)
+				if err != nil {
+					return "", err
+				}
+				return formatAgentSearch(emails, args.Text, limit), nil
+			}),
+		NewAgentTool("read_email", "Read one message in full.", false,
+			func(ctx context.Context, args readToolArgs) (string, error) {
+				emails, err := agentEmails(config, []uint32{args.ID}, true)
+				if err != nil {
+					return "", err
+				}
+				return limitAIContext(formatAgentEmail(emails[0]), maxContextTokens), nil
+			}),
+		NewAgentTool("draft_email", "Save a message to Drafts for the user to review. Nothing is sent.", false,
+			func(ctx context.Context, args draftToolArgs) (string, error) {
+				draft := DraftEmail{To: args.To, CC: args.CC, Subject: args.Subject, Body: args.Body, BodyHTML: MarkdownToHTMLContent(args.Body)}
+				if args.ReplyToID != 0 {
+					emails, err := agentEmails(config, []uint32{args.ReplyToID}, true)
+					if err != nil {
+						return "", err
+					}
+					original := emails[0]
+					if original.MessageID != "" {
+						draft.InReplyTo = original.MessageID
+						draft.References = append(referencedMessageIDs(original), strings.Trim(original.MessageID, "<>"))
+						for i, id := range draft.References {
+							draft.References[i] = "<" + id + ">"
+						}
+					}
+				}
+				if _, err := saveDraftToIMAP(draft); err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("Draft %q saved.", args.Subject), nil
+			}),
+		NewAgentTool("send_email", "Send a message. The user is asked to confirm first.", true,
+			func(ctx context.Context, args sendToolArgs) (string, error) {
+				msg := &EmailMessage{To: args.To, CC: args.CC, Subject: args.Subject, Body: args.Body,
+					BodyHTML: MarkdownToHTMLContent(args.Body), IncludeSignature: true}
+				if err := Send(msg); err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("Sent %q to %s.", args.Subject, strings.Join(args.To, ", ")), nil
+			}),
+		NewAgentTool("label_emails", "Add a label to INBOX messages.", false,
+			func(ctx context.Context, args labelToolArgs) (string, error) {
+				if err := labelEmails(args.IDs, true, "INBOX", args.Label); err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("Labelled %d message(s) %q.", len(args.IDs), args.Label), nil
+			}),
+		// Moving to Trash or Junk is as good as deleting, so moves are confirmed too
+		NewAgentTool("move_emails", "Move INBOX messages to another folder. The user is asked to confirm first.", true,
+			func(ctx context.Context, args moveToolArgs) (string, error) {
+				if err := moveEmails(args.IDs, true, "INBOX", args.Folder); err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("Moved %d message(s) to %s.", len(args.IDs), args.Folder), nil
+			}).describedBy(describeAgentMessages(config)),
+		NewAgentTool("delete_emails", "Delete INBOX messages. The user is asked to confirm first.", true,
+			func(ctx context.Context, args deleteToolArgs) (string, error) {
+				if err := deleteEmailsByUID(args.IDs, "INBOX"); err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("Deleted %d message(s).", len(args.IDs)), nil
+			}).describedBy(describeAgentMessages(config)),
+	}
+}
+
+func (t *AgentTool) describedBy(describe func(args json.RawMessage) string) *AgentTool {
+	t.Describe = describe
+	return t
+}
+
+// describeAgentMessages lists the sender and subject of the messages a call
+// names by UID, so the user can see what they're agreeing to
+func describeAgentMessages(config *Config) func(args json.RawMessage) string {
+	return func(args json.RawMessage) string {
+		var named struct {
+			IDs []uint32 `json:"ids"`
+		}
+		json.Unmarshal(args, &named)
+		emails, err := agentEmails(config, named.IDs, false)
+		if err != nil {
+			return fmt.Sprintf("   ⚠️  Could not look up the messages: %v\n", err)
+		}
+		var b strings.Builder
+		for _, email := range emails {
+			fmt.Fprintf(&b, "   • [%d] %s | %s | %s\n", email.UID, email.Date.Format("2006-01-02 15:04"), email.From, email.Subject)
+		}
+		return b.String()
+	}
+}
+
+// agentEmails returns the INBOX messages with these UIDs, in the same order,
+// with their bodies when full is set. It reads the local archive when the
+// server can't be reached. UIDs that aren't in INBOX are an error, so the
+// model searches again.
+func agentEmails(config *Config, uids []uint32, full bool) ([]*Email, error) {
+	if len(uids) == 0 {
+		return nil, fmt.Errorf("no messages given")
+	}
+	found := make(map[uint32]*Email)
+
+	c, err := connectOnline(config)
+	if isOfflineError(err) {
+		dm, err := NewDatabaseManager(config.Email)
+		if err != nil {
+			return nil, err
+		}
+		defer dm.Close()
+		for _, uid := range uids {
+			email, err := dm.findArchivedEmail(uid, true)
+			if err != nil {
+				return nil, err
+			}
+			if email != nil {
+				found[uid] = email
+			}
+		}
+	} else if err != nil {
+		return nil, err
+	} else {
+		defer c.Logout()
+		if _, err := c.Select("INBOX", true); err != nil {
+			return nil, fmt.Errorf("failed to select INBOX: %v", err)
+		}
+
+		seqSet := new(imap.SeqSet)
+		seqSet.AddNum(uids...)
+		items := []imap.FetchItem{imap.FetchEnvelope, imap.FetchFlags, imap.FetchUid}
+		section := &imap.BodySectionName{Peek: true}
+		if full {
+			items = append(items, section.FetchItem())
+		}
+		messages := make(chan *imap.Message, len(uids))
+		done := make(chan error, 1)
+		go func() {
+			done <- c.UidFetch(seqSet, items, messages)
+		}()
+		for msg := range messages {
+			if email, err := parseMessageWithOptions(msg, section, false); err == nil {
+				found[msg.Uid] = email
+			}
+		}
+		if err := <-done; err != nil {
+			return nil, fmt.Errorf("failed to fetch messages: %v", err)
+		}
+	}
+
+	emails := make([]*Email, 0, len(uids))
+	var missing []string
+	for _, uid := range uids {
+		if email, ok := found[uid]; ok {
+			emails = append(emails, email)
+		} else {
+			missing = append(missing, fmt.Sprint(uid))
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("no message with UID %s in INBOX; search again", strings.Join(missing, ", "))
+	}
+	return emails, nil
+}
+
+// formatAgentSearch lists messages for the model, filtering on text if given
+func formatAgentSearch(emails []*Email, text string, limit int) string {
+	var lines []string
+	for _, email := range emails {
+		if text != "" && !containsIgnoreCase(email.Subject, text) && !containsIgnoreCase(email.Body, text) {
+			continue
+		}
+		line := fmt.Sprintf("[%d] %s | %s | %s", email.UID, email.Date.Format("2006-01-02 15:04"), email.From, email.Subject)
+		if len(email.Flags) > 0 && !hasFlag(email.Flags, imap.SeenFlag) {
+			line += " | unread"
+		}
+		lines = append(lines, line)
+		if len(lines) == limit {
+			break
+		}
+	}
+	if len(lines) == 0 {
+		return "No messages found."
+	}
+	return strings.Join(lines, "\n")
+}
+
+func formatAgentEmail(email *Email) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "UID: %d\nFrom: %s\nTo: %s\nDate: %s\nSubject: %s\n", email.UID, email.From,
+		strings.Join(email.To, ", "), email.Date.Format("Mon Jan 2, 2006 15:04"), email.Subject)
+	if email.MessageID != "" {
+		fmt.Fprintf(&b, "Message-ID: %s\n", email.MessageID)
+	}
+	if len(email.Attachments) > 0 {
+		names := append([]string(nil), email.Attachments...)
+		sort.Strings(names)
+		fmt.Fprintf(&b, "Attachments: %s\n", strings.Join(names, ", "))
+	}
+	b.WriteString("\n" + strings.TrimSpace(email.Body) + "\n")
+	return b.String()
+}
+
+// agentSystemPrompt tells the model who it works for and how IDs behave
+func agentSystemPrompt(config *Config) string {
+	self, _ := senderAddress(config)
+	return fmt.Sprintf(`You manage the mailbox of %s using the tools given. Today is %s.
+
+Find messages with search_emails before reading or changing them, and only use UIDs it returned. Prefer draft_email over send_email unless the user clearly asks to send. Sending, moving and deleting need the user's confirmation; if they decline, say so and stop. Answer briefly, naming messages by sender and subject.`,
+		self, time.Now().Format("Monday, January 2, 2006"))
+}
+
+// NewChatAgent returns an agent for the account when its AI backend can call
+// tools. It returns nil for backends that can't, such as the AI CLIs.
+func NewChatAgent(config *Config) (*Agent, error) {
+	backend, err := NewAIBackend(config)
+	if err != nil {
+		return nil, err
+	}
+	toolBackend, ok := backend.(AIToolBackend)
+	if !ok {
+		return nil, nil
+	}
+	return &Agent{
+		Backend: toolBackend,
+		System:  agentSystemPrompt(config),
+		Tools:   MailAgentTools(config),
+		Out:     os.Stdout,
+	}, nil
+}
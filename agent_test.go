@@ -0,0 +1,312 @@
+package mailos
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// scriptedModel answers with a fixed list of messages and records what it was sent
+type scriptedModel struct {
+	replies  []*AIMessage
+	requests [][]AIMessage
+	tools    []AITool
+}
+
+func (m *scriptedModel) Name() string { return "scripted" }
+
+func (m *scriptedModel) Complete(ctx context.Context, req *AIRequest, stream io.Writer) (string, error) {
+	return "", fmt.Errorf("not used")
+}
+
+func (m *scriptedModel) CompleteWithTools(ctx context.Context, req *AIRequest, tools []AITool) (*AIMessage, error) {
+	m.requests = append(m.requests, append([]AIMessage(nil), req.Messages...))
+	m.tools = tools
+	if len(m.requests) > len(m.replies) {
+		return nil, fmt.Errorf("unexpected request %d", len(m.requests))
+	}
+	return m.replies[len(m.requests)-1], nil
+}
+
+func toolCall(id, name, args string) AIToolCall {
+	call := AIToolCall{ID: id, Type: "function"}
+	call.Function.Name = name
+	call.Function.Arguments = args
+	return call
+}
+
+func calling(calls ...AIToolCall) *AIMessage {
+	return &AIMessage{Role: "assistant", ToolCalls: calls}
+}
+
+// testMailbox stands in for the mail tools
+type testMailbox struct {
+	deleted []uint32
+}
+
+func (mb *testMailbox) tools() []*AgentTool {
+	return []*AgentTool{
+		NewAgentTool("search_emails", "Search", false, func(ctx context.Context, args searchToolArgs) (string, error) {
+			if args.From != "ana" {
+				return "No messages found.", nil
+			}
+			return "[3] 2024-03-06 09:00 | Ana <ana@example.org> | Lunch?\n[4] 2024-03-06 10:00 | Ana <ana@example.org> | Re: Lunch?", nil
+		}),
+		NewAgentTool("delete_emails", "Delete", true, func(ctx context.Context, args deleteToolArgs) (string, error) {
+			mb.deleted = append(mb.deleted, args.IDs...)
+			return fmt.Sprintf("Deleted %d message(s).", len(args.IDs)), nil
+		}),
+	}
+}
+
+func TestAgentLoop(t *testing.T) {
+	script := func() *scriptedModel {
+		return &scriptedModel{replies: []*AIMessage{
+			calling(toolCall("c1", "search_emails", `{"from": "ana"}`)),
+			{Role: "assistant", Content: "Deleting both.", ToolCalls: []AIToolCall{toolCall("c2", "delete_emails", `{"ids": [3, 4]}`)}},
+			{Role: "assistant", Content: "Done."},
+		}}
+	}
+
+	t.Run("Declined", func(t *testing.T) {
+		model, mailbox := script(), &testMailbox{}
+		var asked []string
+		var transcript, out bytes.Buffer
+		agent := &Agent{Backend: model, System: "Be brief.", Tools: mailbox.tools(), Transcript: &transcript, Out: &out,
+			Confirm: func(tool *AgentTool, args json.RawMessage) bool {
+				asked = append(asked, tool.Name+" "+compactJSON(args))
+				return false
+			}}
+
+		answer, err := agent.Ask(context.Background(), "Delete Ana's lunch emails")
+		if err != nil || answer != "Done." {
+			t.Fatalf("Unexpected answer: %q, %v", answer, err)
+		}
+		if len(mailbox.deleted) != 0 {
+			t.Errorf("Expected nothing deleted without confirmation, got %v", mailbox.deleted)
+		}
+		if len(asked) != 1 || asked[0] != `delete_emails {"ids":[3,4]}` {
+			t.Errorf("Unexpected confirmations: %v", asked)
+		}
+		if len(model.tools) != 2 || model.tools[1].Parameters["required"].([]string)[0] != "ids" {
+			t.Errorf("Unexpected tools offered: %+v", model.tools)
+		}
+
+		// The model sees every tool result, answering its call
+		last := model.requests[2]
+		if len(last) != 5 || last[2].Role != "tool" || last[2].ToolCallID != "c1" || !strings.Contains(last[2].Content, "[4]") {
+			t.Fatalf("Unexpected conversation: %+v", last)
+		}
+		if last[4].ToolCallID != "c2" || !strings.Contains(last[4].Content, "declined") {
+			t.Errorf("Expected the model told the user declined, got %+v", last[4])
+		}
+		if out.String() != "🔧 search_emails {\"from\":\"ana\"}\n" {
+			t.Errorf("Unexpected progress: %q", out.String())
+		}
+
+		var types []string
+		for _, line := range strings.Split(strings.TrimSpace(transcript.String()), "\n") {
+			var event AgentEvent
+			if err := json.Unmarshal([]byte(line), &event); err != nil {
+				t.Fatalf("Invalid transcript line %q: %v", line, err)
+			}
+			if event.Type == "tool_call" && event.Tool == "delete_emails" && (event.Confirmed == nil || *event.Confirmed) {
+				t.Errorf("Expected the refusal recorded, got %s", line)
+			}
+			types = append(types, event.Type)
+		}
+		want := "user tool_call tool_result assistant tool_call tool_result assistant"
+		if strings.Join(types, " ") != want {
+			t.Errorf("Unexpected transcript: %s", strings.Join(types, " "))
+		}
+	})
+
+	t.Run("Confirmed", func(t *testing.T) {
+		model, mailbox := script(), &testMailbox{}
+		agent := &Agent{Backend: model, Tools: mailbox.tools(), Confirm: func(*AgentTool, json.RawMessage) bool { return true }}
+		if _, err := agent.Ask(context.Background(), "Delete Ana's lunch emails"); err != nil {
+			t.Fatal(err)
+		}
+		if len(mailbox.deleted) != 2 {
+			t.Errorf("Expected both deleted, got %v", mailbox.deleted)
+		}
+	})
+
+	t.Run("NoGate", func(t *testing.T) {
+		// Without a way to ask, actions that need it are refused
+		model, mailbox := script(), &testMailbox{}
+		agent := &Agent{Backend: model, Tools: mailbox.tools()}
+		if _, err := agent.Ask(context.Background(), "Delete Ana's lunch emails"); err != nil || len(mailbox.deleted) != 0 {
+			t.Errorf("Expected nothing deleted, got %v, %v", mailbox.deleted, err)
+		}
+	})
+
+	t.Run("BadCalls", func(t *testing.T) {
+		model := &scriptedModel{replies: []*AIMessage{
+			calling(
+				toolCall("c1", "search_emails", `{"sender": "ana"}`),
+				toolCall("c2", "delete_emails", `{}`),
+				toolCall("c3", "archive_everything", `{}`),
+				toolCall("c4", "search_emails", `{"from": `),
+			),
+			{Role: "assistant", Content: "Sorry."},
+		}}
+		agent := &Agent{Backend: model, Tools: (&testMailbox{}).tools(), Confirm: func(*AgentTool, json.RawMessage) bool { return true }}
+		if _, err := agent.Ask(context.Background(), "Tidy up"); err != nil {
+			t.Fatal(err)
+		}
+		results := model.requests[1][2:]
+		for i, want := range []string{`unknown field "sender"`, `missing required argument "ids"`, `no tool called "archive_everything"`, "not valid JSON"} {
+			if !strings.HasPrefix(results[i].Content, "Error: ") || !strings.Contains(results[i].Content, want) {
+				t.Errorf("Expected %q reported to the model, got %q", want, results[i].Content)
+			}
+		}
+	})
+
+	t.Run("MaxSteps", func(t *testing.T) {
+		model := &scriptedModel{replies: []*AIMessage{
+			calling(toolCall("c1", "search_emails", `{}`)),
+			calling(toolCall("c2", "search_emails", `{}`)),
+		}}
+		agent := &Agent{Backend: model, Tools: (&testMailbox{}).tools(), MaxSteps: 2}
+		if _, err := agent.Ask(context.Background(), "Loop"); err == nil || !strings.Contains(err.Error(), "stopped after 2 steps") {
+			t.Errorf("Expected the loop stopped, got %v", err)
+		}
+	})
+}
+
+func TestAgentOverHTTP(t *testing.T) {
+	var requests []chatCompletionRequest
+	server := newChatServer(t, func(w http.ResponseWriter, req chatCompletionRequest) {
+		requests = append(requests, req)
+		if len(requests) == 1 {
+			fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"search_emails","arguments":"{\"from\":\"ana\"}"}}]}}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"Ana wrote twice about lunch."}}]}`)
+	})
+
+	agent := &Agent{Backend: &HTTPBackend{Endpoint: server.URL + "/v1", Model: "llama3"}, System: "Be brief.", Tools: (&testMailbox{}).tools()}
+	answer, err := agent.Ask(context.Background(), "What did Ana send?")
+	if err != nil || answer != "Ana wrote twice about lunch." {
+		t.Fatalf("Unexpected answer: %q, %v", answer, err)
+	}
+
+	first := requests[0]
+	if len(first.Tools) != 2 || first.Tools[0].Type != "function" || first.Tools[0].Function.Name != "search_emails" ||
+		first.Tools[0].Function.Parameters["type"] != "object" {
+		t.Errorf("Unexpected tools sent: %+v", first.Tools)
+	}
+	second := requests[1].Messages
+	if len(second) != 4 || second[2].ToolCalls[0].ID != "call_1" || second[3].Role != "tool" || second[3].ToolCallID != "call_1" {
+		t.Errorf("Expected the tool call and its result sent back, got %+v", second)
+	}
+}
+
+func TestMailAgentTools(t *testing.T) {
+	tools := MailAgentTools(&Config{})
+	var names, gated []string
+	for _, tool := range tools {
+		names = append(names, tool.Name)
+		if tool.Confirm {
+			gated = append(gated, tool.Name)
+		}
+	}
+	if strings.Join(names, " ") != "search_emails read_email draft_email send_email label_emails move_emails delete_emails" {
+		t.Errorf("Unexpected tools: %v", names)
+	}
+	if strings.Join(gated, " ") != "send_email move_emails delete_emails" {
+		t.Errorf("Expected sending, moving and deleting gated, got %v", gated)
+	}
+
+	draft := tools[2].Parameters
+	if required := draft["required"].([]string); strings.Join(required, " ") != "to subject body" {
+		t.Errorf("Unexpected required arguments: %v", required)
+	}
+	properties := draft["properties"].(map[string]interface{})
+	to := properties["to"].(map[string]interface{})
+	if to["type"] != "array" || to["items"].(map[string]interface{})["type"] != "string" || to["description"] != "Recipient addresses" {
+		t.Errorf("Unexpected schema for to: %+v", to)
+	}
+	if properties["reply_to_id"].(map[string]interface{})["type"] != "integer" {
+		t.Errorf("Unexpected schema: %+v", properties)
+	}
+}
+
+func TestMailAgentToolsByUID(t *testing.T) {
+	startTestIMAP(t)
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tools := make(map[string]*AgentTool)
+	for _, tool := range MailAgentTools(config) {
+		tools[tool.Name] = tool
+	}
+	ctx := context.Background()
+
+	inbox, err := ReadFromFolder(ReadOptions{}, "INBOX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	uids := make(map[string]uint32)
+	for _, email := range inbox {
+		uids[email.Subject] = email.UID
+	}
+	found, err := tools["search_emails"].Run(ctx, json.RawMessage(`{"from": "ana"}`))
+	if err != nil || !strings.Contains(found, fmt.Sprintf("[%d]", uids["Photos"])) {
+		t.Fatalf("Expected messages listed by UID, got %q (%v)", found, err)
+	}
+
+	// The prompt names the messages, not just their numbers
+	args := json.RawMessage(fmt.Sprintf(`{"ids": [%d, %d]}`, uids["Lunch"], uids["Invoice 7"]))
+	var prompt bytes.Buffer
+	confirm := ConfirmAgentAction(bufio.NewReader(strings.NewReader("y\n")), &prompt)
+	if !confirm(tools["delete_emails"], args) {
+		t.Fatal("Expected the action allowed")
+	}
+	if !strings.Contains(prompt.String(), "bob@example.org | Lunch") || !strings.Contains(prompt.String(), "Ana <ana@example.org> | Invoice 7") {
+		t.Errorf("Expected the sender and subject of each message in the prompt, got:\n%s", prompt.String())
+	}
+	if _, err := tools["delete_emails"].Run(ctx, args); err != nil {
+		t.Fatal(err)
+	}
+
+	// Photos keeps its UID after the messages before it are deleted
+	if _, err := tools["move_emails"].Run(ctx, json.RawMessage(fmt.Sprintf(`{"ids": [%d], "folder": "Archive"}`, uids["Photos"]))); err != nil {
+		t.Fatal(err)
+	}
+	left, _ := ReadFromFolder(ReadOptions{}, "INBOX")
+	moved, _ := ReadFromFolder(ReadOptions{}, "Archive")
+	if subjects(left) != "Receipt|A little message, just for you" || subjects(moved) != "Photos" {
+		t.Errorf("Expected Photos moved and Lunch and Invoice 7 deleted, got INBOX %q and Archive %q", subjects(left), subjects(moved))
+	}
+
+	if _, err := tools["read_email"].Run(ctx, json.RawMessage(fmt.Sprintf(`{"id": %d}`, uids["Photos"]))); err == nil || !strings.Contains(err.Error(), "search again") {
+		t.Errorf("Expected a moved message reported missing, got %v", err)
+	}
+	if out, err := tools["read_email"].Run(ctx, json.RawMessage(fmt.Sprintf(`{"id": %d}`, uids["Receipt"]))); err != nil || !strings.Contains(out, "Thanks") {
+		t.Errorf("Expected the message read by UID, got %q (%v)", out, err)
+	}
+}
+
+func TestImapKeyword(t *testing.T) {
+	if keyword, err := imapKeyword(" Waiting on (client) "); err != nil || keyword != "Waiting_on__client_" {
+		t.Errorf("Unexpected keyword: %q, %v", keyword, err)
+	}
+	for _, label := range []string{"", `\Seen`} {
+		if _, err := imapKeyword(label); err == nil {
+			t.Errorf("Expected %q refused", label)
+		}
+	}
+	op := &QueuedOp{Kind: OpLabel, Folder: "INBOX", Target: "Receipts", Subjects: []string{"Invoice"}}
+	if got := op.Describe(); got != `Label "Invoice" "Receipts" in INBOX` {
+		t.Errorf("Unexpected description: %s", got)
+	}
+}
@@ -0,0 +1,443 @@
+package mailos
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// AI backends
+const (
+	AIBackendCLI  = "cli"  // Run the AI CLI chosen with default_ai_cli
+	AIBackendHTTP = "http" // Call an OpenAI-compatible chat completions endpoint
+)
+
+// AISettings choose how mailos talks to a language model
+type AISettings struct {
+	Backend          string `json:"backend,omitempty"`            // "cli" (the default) or "http"
+	Endpoint         string `json:"endpoint,omitempty"`           // Base URL such as http://localhost:11434/v1
+	Model            string `json:"model,omitempty"`              // Model name passed to the endpoint
+	APIKey           string `json:"api_key,omitempty"`            // Bearer token; MAILOS_AI_API_KEY is used when empty
+	MaxContextTokens int    `json:"max_context_tokens,omitempty"` // Email content sent with one request
+	MaxTokens        int    `json:"max_tokens,omitempty"`         // Longest response to ask for
+	TimeoutSeconds   int    `json:"timeout_seconds,omitempty"`    // Wait for the response to start
+}
+
+var defaultAISettings = AISettings{Backend: AIBackendCLI, MaxContextTokens: 8000, MaxTokens: 1024, TimeoutSeconds: 120}
+
+// GetAISettings returns the AI settings with defaults applied
+func (c *Config) GetAISettings() AISettings {
+	settings := defaultAISettings
+	if c.AI != nil {
+		if c.AI.Backend != "" {
+			settings.Backend = strings.ToLower(c.AI.Backend)
+		}
+		settings.Endpoint = c.AI.Endpoint
+		settings.Model = c.AI.Model
+		settings.APIKey = c.AI.APIKey
+		if c.AI.MaxContextTokens != 0 {
+			settings.MaxContextTokens = c.AI.MaxContextTokens
+		}
+		if c.AI.MaxTokens != 0 {
+			settings.MaxTokens = c.AI.MaxTokens
+		}
+		if c.AI.TimeoutSeconds != 0 {
+			settings.TimeoutSeconds = c.AI.TimeoutSeconds
+		}
+	}
+	if settings.APIKey == "" {
+		settings.APIKey = os.Getenv("MAILOS_AI_API_KEY")
+	}
+	return settings
+}
+
+// HasAIBackend reports whether an HTTP backend or an AI CLI is configured
+func (c *Config) HasAIBackend() bool {
+	if c.GetAISettings().Backend == AIBackendHTTP {
+		return true
+	}
+	return c.DefaultAICLI != "" && c.DefaultAICLI != "none"
+}
+
+// AIMessage is one turn of a conversation with the model
+type AIMessage struct {
+	Role       string       `json:"role"` // "user", "assistant" or "tool"
+	Content    string       `json:"content"`
+	ToolCalls  []AIToolCall `json:"tool_calls,omitempty"`   // Functions the assistant asks to call
+	ToolCallID string       `json:"tool_call_id,omitempty"` // The call a "tool" message answers
+}
+
+// AITool describes a function the model may call, with its arguments as a
+// JSON schema
+type AITool struct {
+	Name        string
+	Description string
+	Parameters  map[string]interface{}
+}
+
+// AIToolCall is the model asking for a function to be called
+type AIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"` // Always "function"
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"` // JSON object
+	} `json:"function"`
+}
+
+// AIRequest is a request to a language model
+type AIRequest struct {
+	System   string      // Instructions
+	Context  string      // Email content the request is about, trimmed to the context limit
+	Messages []AIMessage // The conversation, ending with the user's message
+}
+
+// AIBackend sends requests to a language model. When stream is set, the
+// response is written to it as it arrives; the full text is returned either way.
+type AIBackend interface {
+	Name() string
+	Complete(ctx context.Context, req *AIRequest, stream io.Writer) (string, error)
+}
+
+// AIToolBackend is a backend the model can call functions through
+type AIToolBackend interface {
+	AIBackend
+	// CompleteWithTools returns the model's next message, which either
+	// answers or asks for some of the tools to be called
+	CompleteWithTools(ctx context.Context, req *AIRequest, tools []AITool) (*AIMessage, error)
+}
+
+// NewAIBackend returns the backend chosen in the config
+func NewAIBackend(config *Config) (AIBackend, error) {
+	settings := config.GetAISettings()
+	switch settings.Backend {
+	case AIBackendHTTP:
+		if settings.Endpoint == "" || settings.Model == "" {
+			return nil, fmt.Errorf("the http AI backend needs ai.endpoint and ai.model in the config")
+		}
+		return &HTTPBackend{
+			Endpoint:         settings.Endpoint,
+			Model:            settings.Model,
+			APIKey:           settings.APIKey,
+			MaxTokens:        settings.MaxTokens,
+			MaxContextTokens: settings.MaxContextTokens,
+			Timeout:          time.Duration(settings.TimeoutSeconds) * time.Second,
+		}, nil
+	case AIBackendCLI:
+		if config.DefaultAICLI == "" || config.DefaultAICLI == "none" {
+			return nil, fmt.Errorf("no AI CLI provider configured. Run 'mailos setup' or 'mailos configure' to select an AI provider, or set up an http backend")
+		}
+		if _, exists := GetAIProviderCommand(config.DefaultAICLI); !exists {
+			return nil, fmt.Errorf("unknown AI provider: %s", config.DefaultAICLI)
+		}
+		return &CLIBackend{Provider: config.DefaultAICLI, MaxContextTokens: settings.MaxContextTokens}, nil
+	}
+	return nil, fmt.Errorf("unknown AI backend %q (use %q or %q)", settings.Backend, AIBackendCLI, AIBackendHTTP)
+}
+
+// EstimateTokens approximates how many tokens a text uses, at about four
+// characters per token
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// limitAIContext trims email content to about maxTokens, at a line break
+// where possible, and says how much was left out
+func limitAIContext(text string, maxTokens int) string {
+	maxChars := maxTokens * 4
+	if maxTokens <= 0 || utf8.RuneCountInString(text) <= maxChars {
+		return text
+	}
+	runes := []rune(text)
+	cut := string(runes[:maxChars])
+	if i := strings.LastIndex(cut, "\n"); i > len(cut)/2 {
+		cut = cut[:i]
+	}
+	omitted := len(runes) - utf8.RuneCountInString(cut)
+	return fmt.Sprintf("%s\n[... %d more characters left out to fit the context limit]", cut, omitted)
+}
+
+// systemPrompt combines the instructions with the trimmed email content
+func (req *AIRequest) systemPrompt(maxContextTokens int) string {
+	if req.Context == "" {
+		return req.System
+	}
+	return strings.TrimSpace(req.System + "\n\nEmail context:\n" + limitAIContext(req.Context, maxContextTokens))
+}
+
+// HTTPBackend calls an OpenAI-compatible /chat/completions endpoint, such as
+// OpenAI, Ollama or a llama.cpp server
+type HTTPBackend struct {
+	Endpoint         string
+	Model            string
+	APIKey           string
+	MaxTokens        int
+	MaxContextTokens int
+	Timeout          time.Duration // Wait for the response to start; a stream may then take longer
+	Client           *http.Client  // Defaults to a client using Timeout
+}
+
+func (b *HTTPBackend) Name() string {
+	return fmt.Sprintf("%s at %s", b.Model, b.Endpoint)
+}
+
+type chatCompletionRequest struct {
+	Model     string      `json:"model"`
+	Messages  []AIMessage `json:"messages"`
+	MaxTokens int         `json:"max_tokens,omitempty"`
+	Stream    bool        `json:"stream"`
+	Tools     []chatTool  `json:"tools,omitempty"`
+}
+
+type chatTool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string                 `json:"name"`
+		Description string                 `json:"description,omitempty"`
+		Parameters  map[string]interface{} `json:"parameters"`
+	} `json:"function"`
+}
+
+type chatCompletionResponse struct {
+	Choices []struct {
+		Message AIMessage `json:"message"`
+		Delta   AIMessage `json:"delta"`
+	} `json:"choices"`
+	Error *apiError `json:"error,omitempty"`
+}
+
+type apiError struct {
+	Message string `json:"message"`
+}
+
+func (b *HTTPBackend) client() *http.Client {
+	if b.Client != nil {
+		return b.Client
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = b.Timeout
+	return &http.Client{Transport: transport}
+}
+
+func (b *HTTPBackend) Complete(ctx context.Context, req *AIRequest, stream io.Writer) (string, error) {
+	resp, err := b.post(ctx, req, nil, stream != nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// Servers that don't stream answer with a single JSON object
+	if stream == nil || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		message, err := decodeChatCompletion(resp.Body)
+		if err != nil {
+			return "", err
+		}
+		if stream != nil {
+			io.WriteString(stream, message.Content)
+		}
+		return message.Content, nil
+	}
+	return readChatStream(resp.Body, stream)
+}
+
+// CompleteWithTools offers the tools to the model with OpenAI-style function
+// calling. Tool calls aren't streamed.
+func (b *HTTPBackend) CompleteWithTools(ctx context.Context, req *AIRequest, tools []AITool) (*AIMessage, error) {
+	resp, err := b.post(ctx, req, tools, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return decodeChatCompletion(resp.Body)
+}
+
+// post sends the request and returns the response once it has succeeded
+func (b *HTTPBackend) post(ctx context.Context, req *AIRequest, tools []AITool, stream bool) (*http.Response, error) {
+	var messages []AIMessage
+	if system := req.systemPrompt(b.MaxContextTokens); system != "" {
+		messages = append(messages, AIMessage{Role: "system", Content: system})
+	}
+	messages = append(messages, req.Messages...)
+
+	completion := chatCompletionRequest{
+		Model:     b.Model,
+		Messages:  messages,
+		MaxTokens: b.MaxTokens,
+		Stream:    stream,
+	}
+	for _, tool := range tools {
+		spec := chatTool{Type: "function"}
+		spec.Function.Name = tool.Name
+		spec.Function.Description = tool.Description
+		spec.Function.Parameters = tool.Parameters
+		completion.Tools = append(completion.Tools, spec)
+	}
+	body, err := json.Marshal(completion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %v", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(b.Endpoint, "/")+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid AI endpoint: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if b.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+b.APIKey)
+	}
+	if stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
+
+	resp, err := b.client().Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach AI backend: %v", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		var failed chatCompletionResponse
+		if json.Unmarshal(data, &failed) == nil && failed.Error != nil && failed.Error.Message != "" {
+			return nil, fmt.Errorf("AI backend returned %s: %s", resp.Status, failed.Error.Message)
+		}
+		return nil, fmt.Errorf("AI backend returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return resp, nil
+}
+
+// decodeChatCompletion reads the first choice of a non-streamed response
+func decodeChatCompletion(body io.Reader) (*AIMessage, error) {
+	var completion chatCompletionResponse
+	if err := json.NewDecoder(body).Decode(&completion); err != nil {
+		return nil, fmt.Errorf("failed to decode AI response: %v", err)
+	}
+	if len(completion.Choices) == 0 {
+		return nil, fmt.Errorf("AI backend returned no choices")
+	}
+	message := completion.Choices[0].Message
+	if message.Role == "" {
+		message.Role = "assistant"
+	}
+	return &message, nil
+}
+
+// readChatStream collects the content of a server-sent event stream of
+// completion chunks, writing each piece as it arrives
+func readChatStream(body io.Reader, stream io.Writer) (string, error) {
+	var content strings.Builder
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			return content.String(), nil
+		}
+		var chunk chatCompletionResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return content.String(), fmt.Errorf("failed to decode AI stream: %v", err)
+		}
+		if chunk.Error != nil {
+			return content.String(), fmt.Errorf("AI backend failed mid-response: %s", chunk.Error.Message)
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content != "" {
+				content.WriteString(choice.Delta.Content)
+				io.WriteString(stream, choice.Delta.Content)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return content.String(), fmt.Errorf("AI stream interrupted: %v", err)
+	}
+	return content.String(), nil
+}
+
+// maxCLIPromptBytes keeps the prompt under Linux's 128 KiB limit on a single
+// command-line argument
+const maxCLIPromptBytes = 120 * 1024
+
+// CLIBackend runs an AI CLI such as claude or gemini with the prompt as an argument
+type CLIBackend struct {
+	Provider         string // A default_ai_cli key
+	MaxContextTokens int
+}
+
+func (b *CLIBackend) Name() string {
+	return GetAICLIName(b.Provider)
+}
+
+func (b *CLIBackend) Complete(ctx context.Context, req *AIRequest, stream io.Writer) (string, error) {
+	command, exists := GetAIProviderCommand(b.Provider)
+	if !exists {
+		return "", fmt.Errorf("unknown AI provider: %s", b.Provider)
+	}
+	if _, err := exec.LookPath(command); err != nil {
+		return "", fmt.Errorf("AI CLI '%s' not found. Please install %s CLI first", command, GetAICLIName(b.Provider))
+	}
+
+	prompt := b.prompt(req)
+	if len(prompt) > maxCLIPromptBytes {
+		return "", fmt.Errorf("prompt is %d KB, more than an AI CLI can be passed (%d KB); lower ai.max_context_tokens or use the http backend", len(prompt)/1024, maxCLIPromptBytes/1024)
+	}
+
+	cmd := exec.CommandContext(ctx, command, cliPrintArgs(b.Provider, prompt)...)
+	var output, stderr bytes.Buffer
+	cmd.Stdout = &output
+	if stream != nil {
+		cmd.Stdout = io.MultiWriter(&output, stream)
+	}
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("failed to execute AI provider: %v: %s", err, msg)
+		}
+		return "", fmt.Errorf("failed to execute AI provider: %v", err)
+	}
+	return output.String(), nil
+}
+
+// prompt flattens the request into one text, as the CLIs take a single prompt
+func (b *CLIBackend) prompt(req *AIRequest) string {
+	parts := []string{}
+	if system := req.systemPrompt(b.MaxContextTokens); system != "" {
+		parts = append(parts, system)
+	}
+	if len(req.Messages) == 1 {
+		parts = append(parts, req.Messages[0].Content)
+	} else {
+		for _, message := range req.Messages {
+			role := "User"
+			if message.Role == "assistant" {
+				role = "Assistant"
+			}
+			parts = append(parts, fmt.Sprintf("%s: %s", role, message.Content))
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// cliPrintArgs returns the arguments that make an AI CLI print one answer and exit
+func cliPrintArgs(provider, prompt string) []string {
+	switch provider {
+	case "openai-codex":
+		return []string{"exec", "--skip-git-repo-check", prompt}
+	case "gemini-cli":
+		return []string{"-p", prompt}
+	default:
+		// claude and opencode
+		return []string{"--print", prompt}
+	}
+}
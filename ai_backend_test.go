@@ -0,0 +1,197 @@
+package mailos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// chatServer stands in for an OpenAI-compatible endpoint, recording the last request
+type chatServer struct {
+	*httptest.Server
+	request chatCompletionRequest
+	auth    string
+}
+
+func newChatServer(t *testing.T, handler func(w http.ResponseWriter, req chatCompletionRequest)) *chatServer {
+	s := &chatServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		s.auth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&s.request); err != nil {
+			t.Errorf("Invalid request body: %v", err)
+		}
+		handler(w, s.request)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestHTTPBackend(t *testing.T) {
+	req := &AIRequest{
+		System:   "You summarise email.",
+		Context:  "From: ana@example.com\nSubject: Lunch\n\nAre you free on Friday?",
+		Messages: []AIMessage{{Role: "user", Content: "Summarise this"}},
+	}
+
+	t.Run("Complete", func(t *testing.T) {
+		server := newChatServer(t, func(w http.ResponseWriter, req chatCompletionRequest) {
+			fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"Ana asks about lunch on Friday."}}]}`)
+		})
+		backend := &HTTPBackend{Endpoint: server.URL + "/v1/", Model: "llama3", APIKey: "secret", MaxTokens: 256}
+		reply, err := backend.Complete(context.Background(), req, nil)
+		if err != nil || reply != "Ana asks about lunch on Friday." {
+			t.Fatalf("Unexpected reply: %q, %v", reply, err)
+		}
+
+		sent := server.request
+		if server.auth != "Bearer secret" || sent.Model != "llama3" || sent.MaxTokens != 256 || sent.Stream {
+			t.Errorf("Unexpected request: %+v (auth %q)", sent, server.auth)
+		}
+		if len(sent.Messages) != 2 || sent.Messages[0].Role != "system" || sent.Messages[1].Content != "Summarise this" {
+			t.Fatalf("Unexpected messages: %+v", sent.Messages)
+		}
+		if !strings.Contains(sent.Messages[0].Content, "Email context:\nFrom: ana@example.com") {
+			t.Errorf("Expected the email in the system message, got %q", sent.Messages[0].Content)
+		}
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		server := newChatServer(t, func(w http.ResponseWriter, req chatCompletionRequest) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, piece := range []string{"Ana ", "asks about ", "lunch."} {
+				fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", piece)
+				w.(http.Flusher).Flush()
+			}
+			fmt.Fprint(w, ": keep-alive\n\ndata: {\"choices\":[{\"delta\":{},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n")
+		})
+		backend := &HTTPBackend{Endpoint: server.URL + "/v1", Model: "llama3"}
+		var streamed strings.Builder
+		reply, err := backend.Complete(context.Background(), req, &streamed)
+		if err != nil || reply != "Ana asks about lunch." || streamed.String() != reply {
+			t.Fatalf("Unexpected stream: %q / %q, %v", reply, streamed.String(), err)
+		}
+		if !server.request.Stream || server.auth != "" {
+			t.Errorf("Expected a streaming request without a key, got %+v (auth %q)", server.request, server.auth)
+		}
+	})
+
+	t.Run("StreamIgnored", func(t *testing.T) {
+		server := newChatServer(t, func(w http.ResponseWriter, req chatCompletionRequest) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"choices":[{"message":{"content":"All at once."}}]}`)
+		})
+		var streamed strings.Builder
+		reply, err := (&HTTPBackend{Endpoint: server.URL + "/v1", Model: "m"}).Complete(context.Background(), req, &streamed)
+		if err != nil || reply != "All at once." || streamed.String() != reply {
+			t.Errorf("Unexpected reply: %q / %q, %v", reply, streamed.String(), err)
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		server := newChatServer(t, func(w http.ResponseWriter, req chatCompletionRequest) {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"message":"model \"llama9\" not found, try pulling it first"}}`)
+		})
+		_, err := (&HTTPBackend{Endpoint: server.URL + "/v1", Model: "llama9"}).Complete(context.Background(), req, nil)
+		if err == nil || err.Error() != `AI backend returned 404 Not Found: model "llama9" not found, try pulling it first` {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	})
+
+	t.Run("ContextLimit", func(t *testing.T) {
+		server := newChatServer(t, func(w http.ResponseWriter, req chatCompletionRequest) {
+			fmt.Fprint(w, `{"choices":[{"message":{"content":"ok"}}]}`)
+		})
+		long := &AIRequest{Context: strings.Repeat("Quarterly numbers attached.\n", 1000), Messages: req.Messages}
+		backend := &HTTPBackend{Endpoint: server.URL + "/v1", Model: "m", MaxContextTokens: 100}
+		if _, err := backend.Complete(context.Background(), long, nil); err != nil {
+			t.Fatal(err)
+		}
+		system := server.request.Messages[0].Content
+		if EstimateTokens(system) > 120 || !strings.HasSuffix(system, "more characters left out to fit the context limit]") {
+			t.Errorf("Expected the context trimmed to about 100 tokens, got %d:\n%s", EstimateTokens(system), system)
+		}
+	})
+}
+
+func TestLimitAIContext(t *testing.T) {
+	if got := limitAIContext("short", 10); got != "short" {
+		t.Errorf("Expected short text unchanged, got %q", got)
+	}
+	text := "first line\nsecond line\nthird line that is long"
+	if got := limitAIContext(text, 6); got != "first line\nsecond line\n[... 24 more characters left out to fit the context limit]" {
+		t.Errorf("Expected a cut at the line break, got %q", got)
+	}
+	// Multi-byte characters aren't split
+	if got := limitAIContext(strings.Repeat("é", 20), 2); !strings.HasPrefix(got, "éééééééé\n") {
+		t.Errorf("Unexpected cut: %q", got)
+	}
+}
+
+func TestNewAIBackend(t *testing.T) {
+	t.Setenv("MAILOS_AI_API_KEY", "from-env")
+
+	config := &Config{DefaultAICLI: "claude-code", AI: &AISettings{Backend: "HTTP", Endpoint: "http://localhost:11434/v1", Model: "llama3"}}
+	backend, err := NewAIBackend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hb, ok := backend.(*HTTPBackend)
+	if !ok || hb.APIKey != "from-env" || hb.MaxContextTokens != 8000 || backend.Name() != "llama3 at http://localhost:11434/v1" {
+		t.Errorf("Unexpected backend: %+v", backend)
+	}
+
+	if _, err := NewAIBackend(&Config{AI: &AISettings{Backend: AIBackendHTTP}}); err == nil {
+		t.Errorf("Expected an http backend without an endpoint refused")
+	}
+	if backend, err := NewAIBackend(&Config{DefaultAICLI: "gemini-cli"}); err != nil || backend.Name() != "Gemini CLI" {
+		t.Errorf("Expected the CLI backend by default, got %v, %v", backend, err)
+	}
+	if _, err := NewAIBackend(&Config{DefaultAICLI: "none"}); err == nil {
+		t.Errorf("Expected no backend without an AI CLI")
+	}
+	if (&Config{DefaultAICLI: "none"}).HasAIBackend() || !config.HasAIBackend() {
+		t.Errorf("Unexpected HasAIBackend")
+	}
+}
+
+func TestCLIBackend(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as the AI CLI")
+	}
+	// A stand-in claude that echoes its arguments
+	bin := t.TempDir()
+	script := "#!/bin/sh\nprintf '%s|' \"$@\"\necho 'warning: ignored' >&2\n"
+	if err := os.WriteFile(filepath.Join(bin, "claude"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+
+	backend := &CLIBackend{Provider: "claude-code"}
+	req := &AIRequest{System: "Be brief.", Messages: []AIMessage{{Role: "user", Content: "Hi"}}}
+	var streamed strings.Builder
+	reply, err := backend.Complete(context.Background(), req, &streamed)
+	if err != nil || reply != "--print|Be brief.\n\nHi|" || streamed.String() != reply {
+		t.Fatalf("Unexpected reply: %q / %q, %v", reply, streamed.String(), err)
+	}
+
+	req.Context = strings.Repeat("x", maxCLIPromptBytes)
+	if _, err := backend.Complete(context.Background(), req, nil); err == nil || !strings.Contains(err.Error(), "max_context_tokens") {
+		t.Errorf("Expected an oversized prompt refused, got %v", err)
+	}
+
+	if _, err := (&CLIBackend{Provider: "gemini-cli"}).Complete(context.Background(), req, nil); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected a missing CLI reported, got %v", err)
+	}
+}
@@ -65,7 +65,7 @@ func HandleQueryWithProviderSelection(query string) error {
 	}
 
 	// Check if AI provider is configured
-	if config.DefaultAICLI == "" || config.DefaultAICLI == "none" {
+	if !config.HasAIBackend() {
 		fmt.Println("No AI CLI provider configured.")
 		fmt.Println()
 		
@@ -1,6 +1,7 @@
 package mailos
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -33,7 +34,7 @@ func InvokeAIProviderNonInteractive(query string) (string, error) {
 	return InvokeAIProviderNonInteractiveWithSystemPrompt(query, "")
 }
 
-// InvokeAIProviderNonInteractiveWithSystemPrompt invokes the AI provider with a custom system prompt
+// InvokeAIProviderNonInteractiveWithSystemPrompt invokes the AI backend with a custom system prompt
 func InvokeAIProviderNonInteractiveWithSystemPrompt(query string, customSystemPrompt string) (string, error) {
 	// Load configuration
 	config, err := LoadConfig()
@@ -41,59 +42,21 @@ func InvokeAIProviderNonInteractiveWithSystemPrompt(query string, customSystemPr
 		return "", fmt.Errorf("failed to load configuration: %v", err)
 	}
 
-	// Check if AI provider is configured
-	if config.DefaultAICLI == "" || config.DefaultAICLI == "none" {
-		return "", fmt.Errorf("no AI CLI provider configured. Run 'mailos setup' or 'mailos configure' to select an AI provider")
-	}
-
-	// Get the command for the AI provider
-	aiCommand, exists := GetAIProviderCommand(config.DefaultAICLI)
-	if !exists {
-		return "", fmt.Errorf("unknown AI provider: %s", config.DefaultAICLI)
-	}
-
-	// Check if the AI command exists in PATH
-	_, err = exec.LookPath(aiCommand)
+	backend, err := NewAIBackend(config)
 	if err != nil {
-		return "", fmt.Errorf("AI CLI '%s' not found. Please install %s CLI first", aiCommand, GetAICLIName(config.DefaultAICLI))
+		return "", err
 	}
 
 	// Use custom system prompt if provided, otherwise build default
-	var fullQuery string
-	if customSystemPrompt != "" {
-		fullQuery = fmt.Sprintf("%s\n\n%s", customSystemPrompt, query)
-	} else {
-		systemMessage := BuildEmailManagerSystemMessage()
-		fullQuery = fmt.Sprintf("%s\n\nUser Query: %s", systemMessage, query)
-	}
-
-	// Build command for non-interactive mode
-	var cmd *exec.Cmd
-	switch config.DefaultAICLI {
-	case "claude-code", "claude-code-accept", "claude-code-yolo":
-		// Claude uses --print flag for non-interactive output
-		cmd = exec.Command(aiCommand, "--print", fullQuery)
-	case "openai-codex":
-		// OpenAI Codex command
-		cmd = exec.Command(aiCommand, "exec", "--skip-git-repo-check", fullQuery)
-	case "gemini-cli":
-		// Gemini CLI command
-		cmd = exec.Command(aiCommand, "-p", fullQuery)
-	case "opencode":
-		// OpenCode command (assuming it supports similar syntax)
-		cmd = exec.Command(aiCommand, "--print", fullQuery)
-	default:
-		// Fallback
-		cmd = exec.Command(aiCommand, "--print", fullQuery)
+	system := customSystemPrompt
+	if system == "" {
+		system = BuildEmailManagerSystemMessage()
 	}
 
-	// Capture output
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return "", fmt.Errorf("failed to execute AI provider: %v", err)
-	}
-
-	return string(output), nil
+	return backend.Complete(context.Background(), &AIRequest{
+		System:   system,
+		Messages: []AIMessage{{Role: "user", Content: query}},
+	}, nil)
 }
 
 // InvokeAIProviderWithMode invokes the AI provider with a specific mode override
@@ -104,6 +67,21 @@ func InvokeAIProviderWithMode(query string, modeOverride string) error {
 		return fmt.Errorf("failed to load configuration: %v", err)
 	}
 
+	// An HTTP backend answers in the terminal; it can't run commands itself
+	if config.GetAISettings().Backend == AIBackendHTTP {
+		backend, err := NewAIBackend(config)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Asking %s...\n\n", backend.Name())
+		_, err = backend.Complete(context.Background(), &AIRequest{
+			System:   BuildEmailManagerSystemMessage(),
+			Messages: []AIMessage{{Role: "user", Content: query}},
+		}, os.Stdout)
+		fmt.Println()
+		return err
+	}
+
 	// Check if AI provider is configured
 	if config.DefaultAICLI == "" || config.DefaultAICLI == "none" {
 		return fmt.Errorf("no AI CLI provider configured. Run 'mailos setup' or 'mailos configure' to select an AI provider")
@@ -183,6 +161,11 @@ func CheckAIProviderAvailable() (bool, string) {
 		return false, ""
 	}
 
+	if config.GetAISettings().Backend == AIBackendHTTP {
+		_, err := NewAIBackend(config)
+		return err == nil, AIBackendHTTP
+	}
+
 	if config.DefaultAICLI == "" || config.DefaultAICLI == "none" {
 		return false, ""
 	}
@@ -0,0 +1,463 @@
+package mailos
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// StyleGuideFile is the per-account file describing how replies should read
+const StyleGuideFile = "style.md"
+
+// replyHistoryLimit is how many other messages with the sender the model sees
+const replyHistoryLimit = 5
+
+const aiReplySystemPrompt = `You draft email replies for the reader, who will review and edit the draft before sending it.
+
+Write only the body of the reply: no subject line, no quoted original, and no signature, which are added afterwards. Follow the reader's instruction, answer what the latest message asks, and stay consistent with what the reader already wrote earlier in the thread. Don't make up facts, dates or commitments that aren't in the thread or the instruction; leave a placeholder in square brackets instead.`
+
+// ReplyContext is everything the model sees when drafting a reply
+type ReplyContext struct {
+	Original   *Email   // The message being replied to
+	Thread     []*Email // The rest of the thread, oldest first, including our replies
+	History    []*Email // Other recent messages with the sender, newest first
+	Received   int      // Messages received from the sender
+	Sent       int      // Messages we sent to the sender
+	Self       string   // Our address
+	StyleGuide string
+}
+
+// StyleGuidePath returns where the account's reply style guide lives
+func StyleGuidePath(accountEmail string) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %v", err)
+	}
+	return filepath.Join(homeDir, ".email", accountEmail, StyleGuideFile), nil
+}
+
+// loadStyleGuide reads the account's style guide, which is optional
+func loadStyleGuide(accountEmail string) (string, error) {
+	path, err := StyleGuidePath(accountEmail)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read style guide %s: %v", path, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// loadSentEmails reads the messages saved to the local sent folder from the
+// given address
+func loadSentEmails(fromAddress string) ([]*Email, error) {
+	sentDir, err := GetSentDir()
+	if err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(sentDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sent directory: %v", err)
+	}
+
+	var emails []*Email
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".md") {
+			continue
+		}
+		data, err := ParseMarkdownEmail(filepath.Join(sentDir, file.Name()))
+		if err != nil || !strings.EqualFold(extractEmailAddress(data.From), fromAddress) {
+			continue
+		}
+		email := &Email{
+			From:      data.From,
+			To:        append(data.To, data.CC...),
+			Subject:   data.Subject,
+			Date:      data.Date,
+			Body:      strings.TrimSpace(data.Body),
+			MessageID: data.MessageID,
+			InReplyTo: data.InReplyTo,
+		}
+		if data.References != "" {
+			email.Headers = map[string][]string{"References": {data.References}}
+		}
+		emails = append(emails, email)
+	}
+	return emails, nil
+}
+
+// threadSubject strips reply and forward prefixes so a thread's subjects compare equal
+func threadSubject(subject string) string {
+	subject = strings.TrimSpace(subject)
+	for {
+		lower := strings.ToLower(subject)
+		trimmed := false
+		for _, prefix := range []string{"re:", "fwd:", "fw:", "aw:"} {
+			if strings.HasPrefix(lower, prefix) {
+				subject = strings.TrimSpace(subject[len(prefix):])
+				trimmed = true
+				break
+			}
+		}
+		if !trimmed {
+			return strings.ToLower(subject)
+		}
+	}
+}
+
+// messageKey identifies a message by its Message-ID without brackets
+func messageKey(email *Email) string {
+	return strings.Trim(strings.TrimSpace(email.MessageID), "<>")
+}
+
+// sameMessage reports whether a and b are the same message, such as the
+// archived copy of the one being replied to
+func sameMessage(a, b *Email) bool {
+	return a == b || (messageKey(a) != "" && messageKey(a) == messageKey(b))
+}
+
+// collectReplyThread picks the messages in the same thread as original out
+// of the archived and sent ones, oldest first. Messages are linked through
+// Message-ID, In-Reply-To and References; a message without any of those
+// counts when its subject matches and it is between the same people.
+func collectReplyThread(original *Email, candidates []*Email) []*Email {
+	ids := map[string]bool{}
+	if key := messageKey(original); key != "" {
+		ids[key] = true
+	}
+	for _, id := range referencedMessageIDs(original) {
+		ids[id] = true
+	}
+	subject := threadSubject(original.Subject)
+	sender := extractEmailAddress(original.From)
+
+	included := map[*Email]bool{}
+	// Each pass can link messages that only reference ones found in the last
+	for changed := true; changed; {
+		changed = false
+		for _, email := range candidates {
+			if included[email] || sameMessage(email, original) {
+				continue
+			}
+			refs := referencedMessageIDs(email)
+			linked := ids[messageKey(email)]
+			for _, id := range refs {
+				linked = linked || ids[id]
+			}
+			if !linked && messageKey(email) == "" && len(refs) == 0 {
+				linked = threadSubject(email.Subject) == subject && involvesAddress(email, sender)
+			}
+			if !linked {
+				continue
+			}
+			included[email] = true
+			changed = true
+			if key := messageKey(email); key != "" {
+				ids[key] = true
+			}
+			for _, id := range refs {
+				ids[id] = true
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	var thread []*Email
+	for _, email := range candidates {
+		if !included[email] {
+			continue
+		}
+		// The same message can be both archived and in the sent folder
+		if key := messageKey(email); key != "" {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		thread = append(thread, email)
+	}
+	sort.SliceStable(thread, func(i, j int) bool { return thread[i].Date.Before(thread[j].Date) })
+	return thread
+}
+
+// involvesAddress reports whether the message is from or to the address
+func involvesAddress(email *Email, address string) bool {
+	if strings.EqualFold(extractEmailAddress(email.From), address) {
+		return true
+	}
+	for _, to := range email.To {
+		if strings.EqualFold(extractEmailAddress(to), address) {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildReplyContext gathers the thread, the history with the sender and the
+// style guide for a reply to original
+func BuildReplyContext(original *Email, self string, archived, sent []*Email, styleGuide string) *ReplyContext {
+	rc := &ReplyContext{Original: original, Self: self, StyleGuide: styleGuide}
+	candidates := append(append([]*Email(nil), archived...), sent...)
+	rc.Thread = collectReplyThread(original, candidates)
+
+	// Contact history counts the same way 'mailos stats' does
+	sender := extractEmailAddress(original.From)
+	senders := make(map[string]*ContactFrequency)
+	recipients := make(map[string]*ContactFrequency)
+	domains := make(map[string]int)
+	for _, email := range archived {
+		processSender(email, senders, domains)
+	}
+	for _, email := range sent {
+		processRecipients(email, recipients, self)
+	}
+	// The counts are keyed by the address as written, which may differ in case
+	for address, contact := range senders {
+		if strings.EqualFold(address, sender) {
+			rc.Received += contact.Count
+		}
+	}
+	for address, contact := range recipients {
+		if strings.EqualFold(address, sender) {
+			rc.Sent += contact.Count
+		}
+	}
+
+	inThread := map[*Email]bool{original: true}
+	for _, email := range rc.Thread {
+		inThread[email] = true
+	}
+	var history []*Email
+	for _, email := range candidates {
+		if !inThread[email] && !sameMessage(email, original) && involvesAddress(email, sender) {
+			history = append(history, email)
+		}
+	}
+	sort.SliceStable(history, func(i, j int) bool { return history[i].Date.After(history[j].Date) })
+	if len(history) > replyHistoryLimit {
+		history = history[:replyHistoryLimit]
+	}
+	rc.History = history
+	return rc
+}
+
+// replyMessageBlock describes one message for the model, marking our own
+func replyMessageBlock(email *Email, self string, excerpt int) string {
+	var b strings.Builder
+	from := email.From
+	if strings.EqualFold(extractEmailAddress(email.From), self) {
+		from += " (the reader)"
+	}
+	fmt.Fprintf(&b, "From: %s\n", from)
+	if len(email.To) > 0 {
+		fmt.Fprintf(&b, "To: %s\n", strings.Join(email.To, ", "))
+	}
+	fmt.Fprintf(&b, "Date: %s\nSubject: %s\n\n", email.Date.Format("Mon Jan 2, 2006 15:04"), email.Subject)
+
+	body := strings.TrimSpace(email.Body)
+	if excerpt > 0 {
+		body = strings.Join(strings.Fields(body), " ")
+		if runes := []rune(body); len(runes) > excerpt {
+			body = string(runes[:excerpt]) + "..."
+		}
+	}
+	b.WriteString(body + "\n")
+	return b.String()
+}
+
+// Request builds the AI request for the instruction. The message being
+// replied to comes first and the thread runs newest first, so when the
+// context is trimmed to fit it's the oldest messages that are left out.
+func (rc *ReplyContext) Request(instruction string) *AIRequest {
+	system := aiReplySystemPrompt
+	if rc.StyleGuide != "" {
+		system += "\n\nThe reader's style guide for replies:\n" + rc.StyleGuide
+	}
+
+	var described strings.Builder
+	described.WriteString("Message to reply to:\n\n")
+	described.WriteString(replyMessageBlock(rc.Original, rc.Self, 0))
+
+	if len(rc.Thread) > 0 {
+		described.WriteString("\nEarlier in the thread, newest first:\n")
+		for i := len(rc.Thread) - 1; i >= 0; i-- {
+			described.WriteString("\n---\n" + replyMessageBlock(rc.Thread[i], rc.Self, 0))
+		}
+	}
+
+	sender := extractEmailAddress(rc.Original.From)
+	fmt.Fprintf(&described, "\nHistory with %s: %d message(s) received from them and %d sent to them.\n", sender, rc.Received, rc.Sent)
+	if len(rc.History) > 0 {
+		described.WriteString("Other recent messages with them:\n")
+		for _, email := range rc.History {
+			described.WriteString("\n---\n" + replyMessageBlock(email, rc.Self, digestExcerptChars/4))
+		}
+	}
+
+	return &AIRequest{
+		System:   system,
+		Context:  described.String(),
+		Messages: []AIMessage{{Role: "user", Content: "Draft my reply. Instruction: " + instruction}},
+	}
+}
+
+// leadingFrontmatter is a front matter block at the start of a body, which
+// Send would read as headers
+var leadingFrontmatter = regexp.MustCompile(`(?s)^---[ \t]*\n.*?\n---[ \t]*(\n|$)`)
+
+// cleanAIReply drops a code fence or subject line the model added anyway,
+// and any front matter, so the draft can't add recipients or change headers
+func cleanAIReply(text string) string {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "```") && strings.HasSuffix(text, "```") {
+		text = strings.TrimSuffix(text, "```")
+		if newline := strings.Index(text, "\n"); newline >= 0 {
+			text = text[newline+1:]
+		} else {
+			text = ""
+		}
+		text = strings.TrimSpace(text)
+	}
+	if lower := strings.ToLower(text); strings.HasPrefix(lower, "subject:") {
+		if newline := strings.Index(text, "\n"); newline >= 0 {
+			text = strings.TrimSpace(text[newline+1:])
+		}
+	}
+	for leadingFrontmatter.MatchString(text) {
+		text = strings.TrimSpace(leadingFrontmatter.ReplaceAllString(text, ""))
+	}
+	return text
+}
+
+// DraftAIReply asks the backend for a reply body following the instruction.
+// The answer is streamed to stream when set.
+func DraftAIReply(ctx context.Context, backend AIBackend, rc *ReplyContext, instruction string, stream io.Writer) (string, error) {
+	answer, err := backend.Complete(ctx, rc.Request(instruction), stream)
+	if err != nil {
+		return "", err
+	}
+	body := cleanAIReply(answer)
+	if body == "" {
+		return "", fmt.Errorf("AI backend returned an empty reply")
+	}
+	return body, nil
+}
+
+// archivedReplyCandidates loads the archived INBOX messages a reply to
+// original needs: its thread, followed through Message-ID, In-Reply-To and
+// References, and the sender's most recent messages. received is how many
+// messages the sender has in the archive.
+func archivedReplyCandidates(accountEmail string, original *Email) (archived []*Email, received int, err error) {
+	dm, err := NewDatabaseManager(accountEmail)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer dm.Close()
+
+	seen := map[string]bool{}
+	ids := map[string]bool{}
+	pending := referencedMessageIDs(original)
+	if key := messageKey(original); key != "" {
+		pending = append(pending, key)
+	}
+	// Each round finds the messages linked to the ids the last one turned up
+	for len(pending) > 0 {
+		var forms []interface{}
+		for _, id := range pending {
+			ids[id] = true
+			forms = append(forms, id, "<"+id+">")
+		}
+		in := strings.TrimSuffix(strings.Repeat("?, ", len(forms)), ", ")
+		emails, err := dm.selectEmails("folder = 'INBOX' AND (message_id IN ("+in+") OR in_reply_to IN ("+in+"))",
+			append(append([]interface{}(nil), forms...), forms...), "")
+		if err != nil {
+			return nil, 0, err
+		}
+		pending = nil
+		for _, email := range emails {
+			if seen[archiveKey(email)] {
+				continue
+			}
+			seen[archiveKey(email)] = true
+			archived = append(archived, email)
+			for _, id := range append(referencedMessageIDs(email), messageKey(email)) {
+				if id != "" && !ids[id] {
+					ids[id] = true
+					pending = append(pending, id)
+				}
+			}
+		}
+	}
+
+	sender := extractEmailAddress(original.From)
+	if sender == "" {
+		return archived, 0, nil
+	}
+	fromSender := `folder = 'INBOX' AND (from_address LIKE ? ESCAPE '\' OR from_address LIKE ? ESCAPE '\')`
+	escaped := strings.TrimSuffix(strings.TrimPrefix(likePattern(sender), "%"), "%")
+	senderArgs := []interface{}{escaped, "%<" + escaped + ">"}
+	if err := dm.db.QueryRow("SELECT COUNT(*) FROM emails WHERE "+fromSender, senderArgs...).Scan(&received); err != nil {
+		return nil, 0, fmt.Errorf("failed to count emails: %v", err)
+	}
+	// Enough that the history is full once the thread is left out
+	recent, err := dm.selectEmails(fromSender, append(senderArgs, replyHistoryLimit+len(archived)+1), " ORDER BY date_sent DESC, id LIMIT ?")
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, email := range recent {
+		if !seen[archiveKey(email)] {
+			seen[archiveKey(email)] = true
+			archived = append(archived, email)
+		}
+	}
+	return archived, received, nil
+}
+
+// generateAIReply drafts a reply to original with the account's AI backend,
+// grounded in the thread from the local archive and sent folder
+func generateAIReply(config *Config, original *Email, instruction string) (string, error) {
+	self, _ := senderAddress(config)
+
+	archived, received, archiveErr := archivedReplyCandidates(config.Email, original)
+	if archiveErr != nil {
+		// Without an archive the model still gets the message itself
+		fmt.Printf("⚠️  Could not read the local archive, run 'mailos sync' for thread context: %v\n", archiveErr)
+	}
+	sent, err := loadSentEmails(self)
+	if err != nil {
+		fmt.Printf("⚠️  Could not read sent messages: %v\n", err)
+	}
+	styleGuide, err := loadStyleGuide(config.Email)
+	if err != nil {
+		return "", err
+	}
+
+	backend, err := NewAIBackend(config)
+	if err != nil {
+		return "", err
+	}
+	rc := BuildReplyContext(original, self, archived, sent, styleGuide)
+	if archiveErr == nil {
+		// Only the sender's recent messages were loaded, not all of them
+		rc.Received = received
+	}
+	fmt.Printf("🤖 Drafting reply with %s (%d earlier message(s) in the thread)...\n\n", backend.Name(), len(rc.Thread))
+	body, err := DraftAIReply(context.Background(), backend, rc, instruction, os.Stdout)
+	if err != nil {
+		return "", fmt.Errorf("failed to draft reply: %v", err)
+	}
+	fmt.Println()
+	return body, nil
+}
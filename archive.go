@@ -0,0 +1,673 @@
+package mailos
+
+import (
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+// archiveMigration upgrades archive.db to Version from the version before it
+type archiveMigration struct {
+	Version     int
+	Description string
+	Apply       func(db sqlExecer) error
+}
+
+// sqlExecer runs a migration's statements, in a transaction or on the
+// connection holding the archive's write lock
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// lockedConn is a connection that has begun an IMMEDIATE transaction
+type lockedConn struct {
+	*sql.Conn
+}
+
+func (c lockedConn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.ExecContext(context.Background(), query, args...)
+}
+
+var archiveMigrations = []archiveMigration{
+	{Version: 1, Description: "Create the archive tables", Apply: createArchiveTables},
+	{Version: 2, Description: "Add folder, UID and flag columns, list indexes and the messages view", Apply: addMessageColumns},
+	{Version: 3, Description: "Key emails on folder and Message-ID, so a message can be in more than one folder", Apply: keyEmailsOnFolder},
+	{Version: 4, Description: "Record the folder and UID attachments can be downloaded from", Apply: locateAttachments},
+}
+
+// messagesView is the stable, documented view 'mailos sql' queries run against
+const messagesView = `
+	CREATE VIEW IF NOT EXISTS messages AS
+	SELECT
+		id,
+		folder,
+		uid,
+		CASE WHEN message_id LIKE 'mailos:%' THEN NULL ELSE message_id END AS message_id,
+		in_reply_to,
+		from_address AS sender,
+		to_addresses AS recipients,
+		subject,
+		date_sent AS date,
+		is_read,
+		flags,
+		json_array_length(attachments) AS attachment_count,
+		attachments,
+		body_text AS body
+	FROM emails;
+`
+
+func addMessageColumns(db sqlExecer) error {
+	_, err := db.Exec(`
+	ALTER TABLE emails ADD COLUMN folder TEXT NOT NULL DEFAULT 'INBOX';
+	ALTER TABLE emails ADD COLUMN uid INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE emails ADD COLUMN seq_num INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE emails ADD COLUMN flags TEXT NOT NULL DEFAULT '[]';
+	ALTER TABLE emails ADD COLUMN is_read INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE emails ADD COLUMN details TEXT;
+
+	-- Dates are stored in UTC so they compare as text
+	UPDATE emails SET date_sent = datetime(date_sent) WHERE datetime(date_sent) IS NOT NULL;
+	UPDATE emails SET attachments = '[]' WHERE attachments IS NULL OR attachments = 'null';
+
+	CREATE INDEX IF NOT EXISTS idx_emails_folder_date ON emails(folder, date_sent);
+	CREATE INDEX IF NOT EXISTS idx_emails_folder_unread ON emails(folder, is_read, date_sent);
+	CREATE INDEX IF NOT EXISTS idx_emails_folder_uid ON emails(folder, uid);
+	CREATE INDEX IF NOT EXISTS idx_emails_in_reply_to ON emails(in_reply_to);
+	` + messagesView)
+	return err
+}
+
+// keyEmailsOnFolder rebuilds the emails table, since SQLite can't drop the
+// UNIQUE constraint version 1 put on message_id
+func keyEmailsOnFolder(db sqlExecer) error {
+	_, err := db.Exec(`
+	CREATE TABLE emails_v3 (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		message_id TEXT NOT NULL,
+		from_address TEXT NOT NULL,
+		to_addresses TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		date_sent DATETIME NOT NULL,
+		body_text TEXT,
+		body_html TEXT,
+		attachments TEXT,
+		attachment_data BLOB,
+		in_reply_to TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		folder TEXT NOT NULL DEFAULT 'INBOX',
+		uid INTEGER NOT NULL DEFAULT 0,
+		seq_num INTEGER NOT NULL DEFAULT 0,
+		flags TEXT NOT NULL DEFAULT '[]',
+		is_read INTEGER NOT NULL DEFAULT 0,
+		details TEXT,
+		UNIQUE(folder, message_id)
+	);
+
+	INSERT INTO emails_v3 (
+		id, message_id, from_address, to_addresses, subject, date_sent, body_text, body_html,
+		attachments, attachment_data, in_reply_to, created_at, updated_at,
+		folder, uid, seq_num, flags, is_read, details
+	)
+	SELECT
+		id, message_id, from_address, to_addresses, subject, date_sent, body_text, body_html,
+		attachments, attachment_data, in_reply_to, created_at, updated_at,
+		folder, uid, seq_num, flags, is_read, details
+	FROM emails;
+
+	DROP VIEW IF EXISTS messages;
+	DROP TABLE emails;
+	ALTER TABLE emails_v3 RENAME TO emails;
+
+	CREATE INDEX idx_emails_message_id ON emails(message_id);
+	CREATE INDEX idx_emails_from ON emails(from_address);
+	CREATE INDEX idx_emails_date ON emails(date_sent);
+	CREATE INDEX idx_emails_subject ON emails(subject);
+	CREATE INDEX idx_emails_folder_date ON emails(folder, date_sent);
+	CREATE INDEX idx_emails_folder_unread ON emails(folder, is_read, date_sent);
+	CREATE INDEX idx_emails_folder_uid ON emails(folder, uid);
+	CREATE INDEX idx_emails_in_reply_to ON emails(in_reply_to);
+	` + messagesView)
+	return err
+}
+
+// locateAttachments adds where each attachment's message is on the server,
+// filled in from the archived emails
+func locateAttachments(db sqlExecer) error {
+	_, err := db.Exec(`
+	ALTER TABLE attachments ADD COLUMN folder TEXT NOT NULL DEFAULT '';
+	ALTER TABLE attachments ADD COLUMN uid INTEGER NOT NULL DEFAULT 0;
+
+	UPDATE attachments SET
+		folder = COALESCE((SELECT folder FROM emails WHERE message_id = attachments.message_id ORDER BY uid = 0, id LIMIT 1), ''),
+		uid = COALESCE((SELECT uid FROM emails WHERE message_id = attachments.message_id ORDER BY uid = 0, id LIMIT 1), 0);
+	`)
+	return err
+}
+
+// migrate brings archive.db up to ArchiveSchemaVersion. An archive that
+// already holds tables is backed up before each step, as archive.db.v1.bak.
+// Each step holds the write lock, so two mailos processes opening the same
+// archive don't both run it.
+func (dm *DatabaseManager) migrate() error {
+	from, migrated := -1, 0
+	for _, m := range archiveMigrations {
+		version, backedUp, err := dm.migrateStep(m)
+		if err != nil {
+			return err
+		}
+		if from < 0 {
+			from = version
+		}
+		if backedUp {
+			migrated = m.Version
+		}
+	}
+
+	if migrated > 0 {
+		fmt.Fprintf(os.Stderr, "✓ Upgraded %s from schema version %d to %d (backup: %s.v%d.bak)\n", displayPath(dm.dbPath), from, migrated, displayPath(dm.dbPath), from)
+	}
+	return nil
+}
+
+// migrateStep applies m unless the archive already has it, returning the
+// version the archive was at and whether it had to be backed up first
+func (dm *DatabaseManager) migrateStep(m archiveMigration) (int, bool, error) {
+	// Take the write lock before reading the version, so a second process
+	// waits here and then finds the step already done
+	ctx := context.Background()
+	conn, err := dm.db.Conn(ctx)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to open migration connection: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "PRAGMA busy_timeout = 10000"); err != nil {
+		return 0, false, fmt.Errorf("failed to set busy timeout: %v", err)
+	}
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return 0, false, fmt.Errorf("failed to lock the archive for migration: %v", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			conn.ExecContext(ctx, "ROLLBACK")
+		}
+	}()
+
+	var version, tables int
+	if err := conn.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return 0, false, fmt.Errorf("failed to read the archive schema version: %v", err)
+	}
+	if version > ArchiveSchemaVersion {
+		return 0, false, fmt.Errorf("archive %s has schema version %d, but this version of mailos only reads up to %d. Update mailos", dm.dbPath, version, ArchiveSchemaVersion)
+	}
+	if version >= m.Version {
+		return version, false, nil
+	}
+	if err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table'").Scan(&tables); err != nil {
+		return 0, false, fmt.Errorf("failed to inspect the archive: %v", err)
+	}
+
+	// Nothing else can write while we hold the lock, so the file is consistent
+	if tables > 0 {
+		data, err := os.ReadFile(dm.dbPath)
+		if err == nil {
+			err = os.WriteFile(fmt.Sprintf("%s.v%d.bak", dm.dbPath, version), data, 0600)
+		}
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to back up %s before migrating: %v", dm.dbPath, err)
+		}
+	}
+
+	if err := m.Apply(lockedConn{conn}); err != nil {
+		return 0, false, fmt.Errorf("failed to migrate the archive to schema version %d: %v", m.Version, err)
+	}
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", m.Version)); err != nil {
+		return 0, false, fmt.Errorf("failed to record the archive schema version: %v", err)
+	}
+	if _, err := conn.ExecContext(ctx, "COMMIT"); err != nil {
+		return 0, false, fmt.Errorf("failed to commit migration: %v", err)
+	}
+	committed = true
+	return version, tables > 0, nil
+}
+
+// archivedDetails holds the parts of an Email without a column of their own
+type archivedDetails struct {
+	Headers        map[string][]string       `json:"headers,omitempty"`
+	AttachmentMeta map[string]AttachmentMeta `json:"attachment_meta,omitempty"`
+	DeliveryReport *DeliveryReport           `json:"delivery_report,omitempty"`
+	BodyFromHTML   bool                      `json:"body_from_html,omitempty"`
+	Auth           *AuthVerdict              `json:"auth,omitempty"`
+}
+
+// archiveKey identifies an email within a folder of the archive: its
+// Message-ID, or a stand-in for the few messages sent without one
+func archiveKey(email *Email) string {
+	if email.MessageID != "" {
+		return email.MessageID
+	}
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s_%d_%s", email.Subject, email.Date.Unix(), email.From)))
+	return "mailos:" + hex.EncodeToString(sum[:])
+}
+
+// archiveTime formats a time the way the archive stores it, in UTC
+func archiveTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+func jsonList(values []string) string {
+	if values == nil {
+		values = []string{}
+	}
+	data, _ := json.Marshal(values)
+	return string(data)
+}
+
+// likePattern matches text anywhere in a column, with LIKE's wildcards escaped
+func likePattern(text string) string {
+	text = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(text)
+	return "%" + text + "%"
+}
+
+// storeEmails saves emails to folder, updating those already archived
+func storeEmails(tx *sql.Tx, folder string, emails []*Email) error {
+	stmt, err := tx.Prepare(`
+		INSERT INTO emails (
+			message_id, folder, uid, seq_num, from_address, to_addresses, subject, date_sent,
+			body_text, body_html, attachments, in_reply_to, flags, is_read, details
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(folder, message_id) DO UPDATE SET
+			uid = CASE WHEN excluded.uid > 0 THEN excluded.uid ELSE emails.uid END,
+			seq_num = excluded.seq_num,
+			from_address = excluded.from_address,
+			to_addresses = excluded.to_addresses,
+			subject = excluded.subject,
+			date_sent = excluded.date_sent,
+			body_text = excluded.body_text,
+			body_html = excluded.body_html,
+			attachments = excluded.attachments,
+			in_reply_to = excluded.in_reply_to,
+			flags = excluded.flags,
+			is_read = excluded.is_read,
+			details = excluded.details,
+			updated_at = CURRENT_TIMESTAMP
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %v", err)
+	}
+	defer stmt.Close()
+
+	// Stored HTML never loads trackers or, by default, other remote content
+	privacy := LoadPrivacySettings()
+	for _, email := range emails {
+		sanitizeStoredEmail(email, privacy)
+		key := archiveKey(email)
+		details, _ := json.Marshal(archivedDetails{
+			Headers:        email.Headers,
+			AttachmentMeta: email.AttachmentMeta,
+			DeliveryReport: email.DeliveryReport,
+			BodyFromHTML:   email.BodyFromHTML,
+			Auth:           email.Auth,
+		})
+
+		_, err := stmt.Exec(
+			key, folder, email.UID, email.ID, email.From, jsonList(email.To), email.Subject, archiveTime(email.Date),
+			email.Body, email.BodyHTML, jsonList(email.Attachments), email.InReplyTo,
+			jsonList(email.Flags), hasFlag(email.Flags, imap.SeenFlag), string(details),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to store email %s: %v", key, err)
+		}
+
+		indexed := *email
+		indexed.MessageID = key
+		indexed.Folder = folder
+		if err := indexAttachments(tx, &indexed); err != nil {
+			return fmt.Errorf("failed to index attachments for %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// removeArchived deletes emails from folder by key, and the attachment
+// index entries of those no longer in any folder
+func removeArchived(tx *sql.Tx, folder string, keys []string) error {
+	for _, key := range keys {
+		if _, err := tx.Exec("DELETE FROM emails WHERE folder = ? AND message_id = ?", folder, key); err != nil {
+			return fmt.Errorf("failed to remove %s: %v", key, err)
+		}
+		if _, err := tx.Exec("DELETE FROM attachments WHERE message_id = ? AND NOT EXISTS (SELECT 1 FROM emails WHERE message_id = ?)", key, key); err != nil {
+			return fmt.Errorf("failed to remove attachments of %s: %v", key, err)
+		}
+		// What's left is downloaded from a folder the message is still in
+		_, err := tx.Exec(`
+			UPDATE attachments SET
+				folder = (SELECT folder FROM emails WHERE message_id = attachments.message_id ORDER BY uid = 0, id LIMIT 1),
+				uid = (SELECT uid FROM emails WHERE message_id = attachments.message_id ORDER BY uid = 0, id LIMIT 1)
+			WHERE message_id = ? AND folder = ?
+		`, key, folder)
+		if err != nil {
+			return fmt.Errorf("failed to relocate attachments of %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// StoreEmails saves emails fetched from folder to the archive, updating
+// flags and content of those already there, and records the sync
+func (dm *DatabaseManager) StoreEmails(folder string, emails []*Email) error {
+	tx, err := dm.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := storeEmails(tx, folder, emails); err != nil {
+		return err
+	}
+	if err := dm.updateSyncMetadata(tx); err != nil {
+		return fmt.Errorf("failed to update sync metadata: %v", err)
+	}
+	return tx.Commit()
+}
+
+// replaceFolder makes emails the archived contents of folder
+func (dm *DatabaseManager) replaceFolder(folder string, emails []*Email) error {
+	tx, err := dm.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := storeEmails(tx, folder, emails); err != nil {
+		return err
+	}
+
+	keep := make(map[string]bool, len(emails))
+	for _, email := range emails {
+		keep[archiveKey(email)] = true
+	}
+	rows, err := tx.Query("SELECT message_id FROM emails WHERE folder = ?", folder)
+	if err != nil {
+		return fmt.Errorf("failed to list archived emails: %v", err)
+	}
+	var stale []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err == nil && !keep[key] {
+			stale = append(stale, key)
+		}
+	}
+	rows.Close()
+	if err := removeArchived(tx, folder, stale); err != nil {
+		return err
+	}
+
+	if err := dm.updateSyncMetadata(tx); err != nil {
+		return fmt.Errorf("failed to update sync metadata: %v", err)
+	}
+	return tx.Commit()
+}
+
+// selectEmails returns archived emails matching where, followed by tail
+// (ordering and paging). Attachments are listed with their metadata; their
+// content is only loaded by LoadArchivedAttachments.
+func (dm *DatabaseManager) selectEmails(where string, args []interface{}, tail string) ([]*Email, error) {
+	rows, err := dm.db.Query(`
+		SELECT message_id, seq_num, uid, folder, from_address, to_addresses, subject, date_sent,
+			   COALESCE(body_text, ''), COALESCE(body_html, ''), COALESCE(attachments, ''),
+			   COALESCE(in_reply_to, ''), flags, COALESCE(details, '')
+		FROM emails
+		WHERE `+where+tail, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query emails: %v", err)
+	}
+	defer rows.Close()
+
+	var emails []*Email
+	for rows.Next() {
+		var email Email
+		var key, toJSON, attachmentsJSON, flagsJSON, detailsJSON string
+		err := rows.Scan(&key, &email.ID, &email.UID, &email.Folder, &email.From, &toJSON, &email.Subject, &email.Date,
+			&email.Body, &email.BodyHTML, &attachmentsJSON, &email.InReplyTo, &flagsJSON, &detailsJSON)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read email: %v", err)
+		}
+
+		email.Date = email.Date.Local()
+		json.Unmarshal([]byte(toJSON), &email.To)
+		json.Unmarshal([]byte(attachmentsJSON), &email.Attachments)
+		json.Unmarshal([]byte(flagsJSON), &email.Flags)
+		var details archivedDetails
+		if detailsJSON != "" && json.Unmarshal([]byte(detailsJSON), &details) == nil {
+			email.Headers = details.Headers
+			email.AttachmentMeta = details.AttachmentMeta
+			email.DeliveryReport = details.DeliveryReport
+			email.BodyFromHTML = details.BodyFromHTML
+			email.Auth = details.Auth
+		}
+		if !strings.HasPrefix(key, "mailos:") {
+			email.MessageID = key
+		}
+
+		emails = append(emails, &email)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query emails: %v", err)
+	}
+	return emails, nil
+}
+
+// queryEmails lists archived emails newest first, filtered and paged by
+// opts. An empty folder lists every folder.
+func (dm *DatabaseManager) queryEmails(folder string, opts ReadOptions) ([]*Email, error) {
+	return dm.searchEmails(folder, &Query{}, opts)
+}
+
+// searchEmails lists the archived emails matching q as well as opts,
+// including opts.Query. The query runs as SQL, with Match run over the rows
+// for any terms SQL can't express, and paging after that.
+func (dm *DatabaseManager) searchEmails(folder string, q *Query, opts ReadOptions) ([]*Email, error) {
+	if opts.Query != nil {
+		q = &Query{Text: q.Text, Root: andQueryNodes(q.Root, opts.Query.Root)}
+	}
+	where, args := readOptionsWhere(folder, opts)
+	queryWhere, queryArgs, exact := q.SQL()
+	where = append(where, queryWhere)
+	args = append(args, queryArgs...)
+
+	tail := " ORDER BY date_sent DESC, id"
+	if exact {
+		if opts.Limit > 0 {
+			tail += " LIMIT ? OFFSET ?"
+			args = append(args, opts.Limit, opts.Offset)
+		} else if opts.Offset > 0 {
+			tail += " LIMIT -1 OFFSET ?"
+			args = append(args, opts.Offset)
+		}
+		return dm.selectEmails(strings.Join(where, " AND "), args, tail)
+	}
+
+	emails, err := dm.selectEmails(strings.Join(where, " AND "), args, tail)
+	if err != nil {
+		return nil, err
+	}
+	emails = q.Filter(emails)
+	if opts.Offset >= len(emails) {
+		return []*Email{}, nil
+	}
+	emails = emails[opts.Offset:]
+	if opts.Limit > 0 && len(emails) > opts.Limit {
+		emails = emails[:opts.Limit]
+	}
+	return emails, nil
+}
+
+// countEmails counts the archived emails matching q, in SQL when q runs
+// there exactly, otherwise by checking the rows SQL narrowed it down to
+func (dm *DatabaseManager) countEmails(folder string, q *Query) (int, error) {
+	where, args := readOptionsWhere(folder, ReadOptions{})
+	queryWhere, queryArgs, exact := q.SQL()
+	where = append(where, queryWhere)
+	args = append(args, queryArgs...)
+
+	if !exact {
+		emails, err := dm.selectEmails(strings.Join(where, " AND "), args, "")
+		if err != nil {
+			return 0, err
+		}
+		return len(q.Filter(emails)), nil
+	}
+
+	var count int
+	if err := dm.db.QueryRow("SELECT COUNT(*) FROM emails WHERE "+strings.Join(where, " AND "), args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count emails: %v", err)
+	}
+	return count, nil
+}
+
+// readOptionsWhere is the WHERE conditions for opts' filters
+func readOptionsWhere(folder string, opts ReadOptions) ([]string, []interface{}) {
+	where := []string{"1=1"}
+	var args []interface{}
+
+	if folder != "" {
+		where = append(where, "folder = ?")
+		args = append(args, folder)
+	}
+	if opts.FromAddress != "" {
+		where = append(where, `from_address LIKE ? ESCAPE '\'`)
+		args = append(args, likePattern(opts.FromAddress))
+	}
+	if opts.ToAddress != "" {
+		where = append(where, `to_addresses LIKE ? ESCAPE '\'`)
+		args = append(args, likePattern(opts.ToAddress))
+	}
+	if opts.Subject != "" {
+		where = append(where, `subject LIKE ? ESCAPE '\'`)
+		args = append(args, likePattern(opts.Subject))
+	}
+	if !opts.Since.IsZero() {
+		where = append(where, "date_sent >= ?")
+		args = append(args, archiveTime(opts.Since))
+	}
+	if !opts.Until.IsZero() {
+		where = append(where, "date_sent <= ?")
+		args = append(args, archiveTime(opts.Until))
+	}
+	if opts.UnreadOnly {
+		where = append(where, "is_read = 0")
+	}
+	return where, args
+}
+
+// findArchivedEmail returns the archived INBOX email listed under id, or
+// with that UID when byUID is set, or nil
+func (dm *DatabaseManager) findArchivedEmail(id uint32, byUID bool) (*Email, error) {
+	column := "seq_num"
+	if byUID {
+		column = "uid"
+	}
+	emails, err := dm.selectEmails("folder = 'INBOX' AND "+column+" = ?", []interface{}{id}, " ORDER BY date_sent DESC LIMIT 1")
+	if err != nil || len(emails) == 0 {
+		return nil, err
+	}
+	return emails[0], nil
+}
+
+// setArchivedFlags replaces the flags of an archived email in folder
+func (dm *DatabaseManager) setArchivedFlags(folder, messageID string, flags []string) error {
+	_, err := dm.db.Exec("UPDATE emails SET flags = ?, is_read = ?, updated_at = CURRENT_TIMESTAMP WHERE folder = ? AND message_id = ?",
+		jsonList(flags), hasFlag(flags, imap.SeenFlag), folder, messageID)
+	if err != nil {
+		return fmt.Errorf("failed to update flags of %s: %v", messageID, err)
+	}
+	return nil
+}
+
+// deleteArchived removes emails from a folder of the archive by Message-ID
+func (dm *DatabaseManager) deleteArchived(folder string, messageIDs []string) error {
+	tx, err := dm.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := removeArchived(tx, folder, messageIDs); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// importLegacyInbox moves emails from inbox.json, where mailos kept them
+// before the archive, into the database. The file is renamed to
+// inbox.json.imported once they're in, so it's only read once.
+func (dm *DatabaseManager) importLegacyInbox() (int, error) {
+	path := filepath.Join(filepath.Dir(dm.dbPath), "inbox.json")
+	data, err := loadVersionedFile(path, inboxSchemaFile)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read inbox file: %v", err)
+	}
+	var inbox InboxData
+	if err := json.Unmarshal(data, &inbox); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal inbox data: %v", err)
+	}
+
+	tx, err := dm.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := storeEmails(tx, "INBOX", inbox.Emails); err != nil {
+		return 0, err
+	}
+	for _, email := range inbox.Emails {
+		if email.DeliveryReport != nil {
+			if _, err := recordDeliveryReport(tx, email.DeliveryReport, email.MessageID, email.Date); err != nil {
+				fmt.Printf("Warning: failed to record delivery report %s: %v\n", email.MessageID, err)
+			}
+		}
+	}
+	if err := dm.updateSyncMetadata(tx); err != nil {
+		return 0, fmt.Errorf("failed to update sync metadata: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	if err := os.Rename(path, path+".imported"); err != nil {
+		if os.IsNotExist(err) {
+			// Another mailos imported it at the same time
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to retire %s: %v", path, err)
+	}
+	fmt.Fprintf(os.Stderr, "✓ Imported %d emails from %s into %s\n", len(inbox.Emails), displayPath(path), displayPath(dm.dbPath))
+	return len(inbox.Emails), nil
+}
+
+// archiveEmails saves emails fetched from folder to an account's archive
+func archiveEmails(accountEmail, folder string, emails []*Email) error {
+	dm, err := NewDatabaseManager(accountEmail)
+	if err != nil {
+		return err
+	}
+	defer dm.Close()
+
+	return dm.StoreEmails(folder, emails)
+}
@@ -0,0 +1,300 @@
+package mailos
+
+import (
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+func TestArchiveMigration(t *testing.T) {
+	tmpDir := setupTestGroups(t)
+	defer cleanupTestGroups(tmpDir)
+
+	account := "me@example.com"
+	accountDir := filepath.Join(tmpDir, ".email", account)
+	os.MkdirAll(accountDir, 0700)
+	dbPath := filepath.Join(accountDir, "archive.db")
+
+	// An archive from before versioning, plus an inbox.json it was synced from
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, _ := db.Begin()
+	if err := createArchiveTables(tx); err != nil {
+		t.Fatal(err)
+	}
+	tx.Exec(`INSERT INTO emails (message_id, from_address, to_addresses, subject, date_sent, attachments)
+		VALUES ('<old@example.com>', 'Ana <ana@example.org>', '[]', 'Old', '2024-03-01 12:00:00+02:00', 'null')`)
+	tx.Commit()
+	db.Close()
+
+	inbox := InboxData{AccountEmail: account, Emails: []*Email{
+		{ID: 7, MessageID: "<new@example.com>", From: "bob@example.org", Subject: "New", Date: time.Date(2024, 3, 2, 9, 0, 0, 0, time.UTC), Flags: []string{imap.SeenFlag}},
+	}}
+	data, _ := json.Marshal(inbox)
+	inboxPath := filepath.Join(accountDir, "inbox.json")
+	os.WriteFile(inboxPath, data, 0600)
+
+	dm, err := NewDatabaseManager(account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dm.Close()
+
+	var version int
+	dm.db.QueryRow("PRAGMA user_version").Scan(&version)
+	if version != ArchiveSchemaVersion {
+		t.Errorf("Expected schema version %d, got %d", ArchiveSchemaVersion, version)
+	}
+	if _, err := os.Stat(dbPath + ".v0.bak"); err != nil {
+		t.Errorf("Expected the archive backed up: %v", err)
+	}
+	if _, err := os.Stat(inboxPath); !os.IsNotExist(err) {
+		t.Errorf("Expected inbox.json retired")
+	}
+	if _, err := os.Stat(inboxPath + ".imported"); err != nil {
+		t.Errorf("Expected inbox.json kept as inbox.json.imported: %v", err)
+	}
+
+	emails, err := dm.queryEmails("INBOX", ReadOptions{})
+	if err != nil || len(emails) != 2 {
+		t.Fatalf("Expected the old row and the imported email, got %d, %v", len(emails), err)
+	}
+	if emails[0].Subject != "New" || emails[0].ID != 7 || !hasFlag(emails[0].Flags, imap.SeenFlag) {
+		t.Errorf("Unexpected imported email: %+v", emails[0])
+	}
+	// Dates are moved to UTC so they sort and compare correctly
+	if old := emails[1]; !old.Date.Equal(time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)) || old.Attachments == nil {
+		t.Errorf("Unexpected migrated row: %+v", old)
+	}
+	if unread, _ := dm.queryEmails("INBOX", ReadOptions{UnreadOnly: true}); len(unread) != 1 || unread[0].Subject != "Old" {
+		t.Errorf("Expected only the old row unread, got %+v", unread)
+	}
+
+	// Archives from a newer mailos aren't misread
+	dm.db.Exec("PRAGMA user_version = 99")
+	if _, err := NewDatabaseManager(account); err == nil || !strings.Contains(err.Error(), "schema version 99") {
+		t.Errorf("Expected a newer archive refused, got %v", err)
+	}
+}
+
+func TestArchiveMigrationConcurrent(t *testing.T) {
+	tmpDir := setupTestGroups(t)
+	defer cleanupTestGroups(tmpDir)
+
+	account := "me@example.com"
+	accountDir := filepath.Join(tmpDir, ".email", account)
+	os.MkdirAll(accountDir, 0700)
+	db, err := sql.Open("sqlite3", filepath.Join(accountDir, "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := createArchiveTables(db); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// Each waits for the others' steps rather than failing mid-upgrade
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			dm, err := NewDatabaseManager(account)
+			if err == nil {
+				dm.Close()
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Expected every process to open the archive, got %v", err)
+		}
+	}
+}
+
+func TestArchiveKeyedOnFolder(t *testing.T) {
+	tmpDir := setupTestGroups(t)
+	defer cleanupTestGroups(tmpDir)
+
+	account := "me@example.com"
+	email := func(folder string, uid uint32) *Email {
+		return &Email{UID: uid, MessageID: "<copy@example.com>", From: "ana@example.org", Subject: "Contract",
+			Date: time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC), Attachments: []string{"contract.pdf"}, Folder: folder}
+	}
+	if err := archiveEmails(account, "INBOX", []*Email{email("INBOX", 4)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := archiveEmails(account, "Archive", []*Email{email("Archive", 90)}); err != nil {
+		t.Fatal(err)
+	}
+
+	dm, err := NewDatabaseManager(account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dm.Close()
+
+	// A copy in another folder is a second row, not a move of the first
+	inbox, _ := dm.queryEmails("INBOX", ReadOptions{})
+	archived, _ := dm.queryEmails("Archive", ReadOptions{})
+	if len(inbox) != 1 || inbox[0].UID != 4 || len(archived) != 1 || archived[0].UID != 90 {
+		t.Fatalf("Expected the message in both folders, got INBOX %+v and Archive %+v", inbox, archived)
+	}
+	if records, _ := dm.ListAttachments(AttachmentQuery{}); len(records) != 1 {
+		t.Errorf("Expected one attachment listed, got %d", len(records))
+	}
+
+	if err := dm.deleteArchived("INBOX", []string{"<copy@example.com>"}); err != nil {
+		t.Fatal(err)
+	}
+	if archived, _ := dm.queryEmails("Archive", ReadOptions{}); len(archived) != 1 {
+		t.Errorf("Expected the Archive copy kept, got %+v", archived)
+	}
+	if records, _ := dm.ListAttachments(AttachmentQuery{}); len(records) != 1 || records[0].Subject != "Contract" {
+		t.Errorf("Expected the attachment kept with the Archive copy, got %+v", records)
+	}
+
+	if err := dm.deleteArchived("Archive", []string{"<copy@example.com>"}); err != nil {
+		t.Fatal(err)
+	}
+	if records, _ := dm.ListAttachments(AttachmentQuery{}); len(records) != 0 {
+		t.Errorf("Expected the attachment removed with the last copy, got %+v", records)
+	}
+}
+
+func TestArchiveQueries(t *testing.T) {
+	tmpDir := setupTestGroups(t)
+	defer cleanupTestGroups(tmpDir)
+
+	account := "me@example.com"
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 9, 0, 0, 0, time.UTC) }
+	var emails []*Email
+	for d := 1; d <= 5; d++ {
+		emails = append(emails, &Email{ID: uint32(d), UID: uint32(100 + d), MessageID: "<" + string(rune('a'+d)) + "@example.com>",
+			From: "Ana <ana@example.org>", To: []string{account}, Subject: "Daily report", Date: day(d), Flags: []string{imap.SeenFlag}})
+	}
+	emails[4].Flags = nil
+	emails[3].Subject = "100% done"
+	emails[2].From = "bob@example.org"
+	emails[1].Headers = map[string][]string{"List-Id": {"<news.example.org>"}}
+	emails[1].AttachmentMeta = map[string]AttachmentMeta{"a.pdf": {MIMEType: "application/pdf", Size: 10}}
+	emails[1].Attachments = []string{"a.pdf"}
+	noID := &Email{ID: 6, From: "printer@example.org", Subject: "Scan", Date: day(6)}
+	if err := archiveEmails(account, "INBOX", append(emails, noID)); err != nil {
+		t.Fatal(err)
+	}
+
+	subjects := func(list []*Email) string {
+		var names []string
+		for _, email := range list {
+			names = append(names, email.Subject)
+		}
+		return strings.Join(names, ", ")
+	}
+	for name, test := range map[string]struct {
+		opts ReadOptions
+		want string
+	}{
+		"NewestFirst": {ReadOptions{Limit: 2}, "Scan, Daily report"},
+		"Paged":       {ReadOptions{Limit: 2, Offset: 2}, "100% done, Daily report"},
+		"LastPage":    {ReadOptions{Offset: 5}, "Daily report"},
+		"From":        {ReadOptions{FromAddress: "BOB@"}, "Daily report"},
+		"Percent":     {ReadOptions{Subject: "100%"}, "100% done"},
+		"Wildcard":    {ReadOptions{Subject: "_"}, ""},
+		"Range":       {ReadOptions{Since: day(2), Until: day(3)}, "Daily report, Daily report"},
+		"Unread":      {ReadOptions{UnreadOnly: true}, "Scan, Daily report"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := GetEmailsFromInbox(account, test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if subjects(got) != test.want {
+				t.Errorf("Expected %q, got %q", test.want, subjects(got))
+			}
+		})
+	}
+
+	all, _ := GetEmailsFromInbox(account, ReadOptions{})
+	if all[0].MessageID != "" || all[0].ID != 6 {
+		t.Errorf("Expected the message without a Message-ID listed without one, got %+v", all[0])
+	}
+	second := all[4]
+	if second.UID != 102 || second.Headers["List-Id"][0] != "<news.example.org>" || second.AttachmentMeta["a.pdf"].Size != 10 {
+		t.Errorf("Expected details kept, got %+v", second)
+	}
+
+	// Syncing again updates flags without losing what only the first sync knew
+	emails[1].UID = 0
+	emails[1].Flags = nil
+	if err := archiveEmails(account, "INBOX", emails[1:2]); err != nil {
+		t.Fatal(err)
+	}
+	updated, _ := GetEmailsFromInbox(account, ReadOptions{UnreadOnly: true})
+	if len(updated) != 3 || updated[2].UID != 102 {
+		t.Errorf("Expected the message unread with its UID kept, got %+v", updated)
+	}
+}
+
+func TestQueryArchive(t *testing.T) {
+	tmpDir := setupTestGroups(t)
+	defer cleanupTestGroups(tmpDir)
+
+	account := "me@example.com"
+	err := archiveEmails(account, "INBOX", []*Email{
+		{MessageID: "<1@example.com>", From: "ana@example.org", Subject: "Hi; there", Date: time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC), Attachments: []string{"a.pdf", "b.png"}},
+		{MessageID: "<2@example.com>", From: "ana@example.org", Subject: "Again", Date: time.Date(2024, 5, 2, 9, 0, 0, 0, time.UTC), Flags: []string{imap.SeenFlag}},
+		{From: "bob@example.org", Subject: "No ID", Date: time.Date(2024, 5, 3, 9, 0, 0, 0, time.UTC)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := QueryArchive(account, `
+		-- senders by volume; a ; in a comment is fine
+		SELECT sender, COUNT(*) AS n, SUM(attachment_count) AS files, MIN(is_read) AS all_read
+		FROM messages WHERE subject != 'x;y' GROUP BY sender ORDER BY n DESC;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(result.Columns, " ") != "sender n files all_read" || len(result.Rows) != 2 {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+	if result.Rows[0][0] != "ana@example.org" || result.Rows[0][1] != int64(2) || result.Rows[0][2] != int64(2) {
+		t.Errorf("Unexpected row: %v", result.Rows[0])
+	}
+	data, _ := json.Marshal(result)
+	if !strings.HasPrefix(string(data), `[{"sender":"ana@example.org","n":2,"files":2,"all_read":0}`) {
+		t.Errorf("Expected JSON keys in column order, got %s", data)
+	}
+	if table := FormatSQLResult(result); !strings.Contains(table, "sender           n  files  all_read\n") || !strings.HasSuffix(table, "(2 row(s))\n") {
+		t.Errorf("Unexpected table:\n%s", table)
+	}
+
+	result, err = QueryArchive(account, "SELECT message_id, date FROM messages WHERE sender LIKE 'bob%'")
+	if err != nil || result.Rows[0][0] != nil || !strings.HasPrefix(result.Rows[0][1].(string), "2024-05-0") {
+		t.Errorf("Expected a NULL message_id and a formatted date, got %+v, %v", result, err)
+	}
+
+	for query, want := range map[string]string{
+		"DELETE FROM emails":          "only SELECT",
+		"SELECT 1; DROP TABLE emails": "one statement",
+		"  ":                          "no query",
+		"WITH x AS (SELECT 1) DELETE FROM emails": "readonly",
+		"SELECT * FROM messages WHERE nope = 1":   "no such column",
+	} {
+		if _, err := QueryArchive(account, query); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q refused with %q, got %v", query, want, err)
+		}
+	}
+	if all, _ := GetEmailsFromInbox(account, ReadOptions{}); len(all) != 3 {
+		t.Errorf("Expected the archive untouched, got %d emails", len(all))
+	}
+}
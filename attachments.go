@@ -0,0 +1,479 @@
+package mailos
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+// AttachmentRecord is one row of the attachment index joined with its message
+type AttachmentRecord struct {
+	ID        int64     `json:"id"`
+	MessageID string    `json:"message_id"`
+	Folder    string    `json:"folder,omitempty"` // Where the message is on the server
+	UID       uint32    `json:"uid,omitempty"`
+	Filename  string    `json:"filename"`
+	MIMEType  string    `json:"mime_type"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256,omitempty"`
+	From      string    `json:"from"`
+	Subject   string    `json:"subject"`
+	Date      time.Time `json:"date"`
+	Stored    bool      `json:"stored"` // content is in the archive, not just the name
+}
+
+// AttachmentQuery filters the attachment index
+type AttachmentQuery struct {
+	From  string    // Sender substring
+	Type  string    // Extension ("pdf"), MIME type ("application/pdf") or major type ("image")
+	Since time.Time // Only attachments on messages sent at or after this time
+	Text  string    // Words matched against filename, MIME type, sender and subject
+	Limit int
+}
+
+// attachmentMIMEType works out the MIME type from what the parser saw, the
+// filename extension or, failing both, the content itself
+func attachmentMIMEType(filename string, meta AttachmentMeta, data []byte) string {
+	if meta.MIMEType != "" && meta.MIMEType != "application/octet-stream" {
+		return meta.MIMEType
+	}
+	if byExt := mime.TypeByExtension(strings.ToLower(filepath.Ext(filename))); byExt != "" {
+		mediaType, _, _ := mime.ParseMediaType(byExt)
+		return mediaType
+	}
+	if len(data) > 0 {
+		mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+		return mediaType
+	}
+	if meta.MIMEType != "" {
+		return meta.MIMEType
+	}
+	return "application/octet-stream"
+}
+
+// hashAttachment returns the hex SHA-256 used to deduplicate attachment content
+func hashAttachment(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// indexAttachments records every attachment of an email, storing content once per hash
+func indexAttachments(tx *sql.Tx, email *Email) error {
+	for _, filename := range email.Attachments {
+		meta := email.AttachmentMeta[filename]
+		data := email.AttachmentData[filename]
+
+		var hash interface{}
+		size := meta.Size
+		if len(data) > 0 {
+			sum := hashAttachment(data)
+			hash = sum
+			size = int64(len(data))
+			if _, err := tx.Exec(`INSERT OR IGNORE INTO attachment_blobs (sha256, size, data) VALUES (?, ?, ?)`,
+				sum, size, data); err != nil {
+				return fmt.Errorf("failed to store attachment %s: %v", filename, err)
+			}
+		}
+
+		// Don't let a later sync without content wipe out what we already know
+		_, err := tx.Exec(`
+			INSERT INTO attachments (message_id, filename, mime_type, size, sha256, folder, uid)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(message_id, filename) DO UPDATE SET
+				mime_type = excluded.mime_type,
+				size = CASE WHEN excluded.size > 0 THEN excluded.size ELSE attachments.size END,
+				sha256 = COALESCE(excluded.sha256, attachments.sha256),
+				folder = CASE WHEN excluded.uid > 0 OR attachments.uid = 0 THEN excluded.folder ELSE attachments.folder END,
+				uid = CASE WHEN excluded.uid > 0 OR attachments.uid = 0 THEN excluded.uid ELSE attachments.uid END
+		`, email.MessageID, filename, attachmentMIMEType(filename, meta, data), size, hash, email.Folder, email.UID)
+		if err != nil {
+			return fmt.Errorf("failed to index attachment %s: %v", filename, err)
+		}
+	}
+	return nil
+}
+
+// loadAttachmentData fills in AttachmentData from the deduplicated blob
+// store, or for older archives, the content kept inline with the email
+func (dm *DatabaseManager) loadAttachmentData(email *Email) error {
+	key := archiveKey(email)
+	rows, err := dm.db.Query(`
+		SELECT a.filename, b.data
+		FROM attachments a JOIN attachment_blobs b ON a.sha256 = b.sha256
+		WHERE a.message_id = ?
+	`, key)
+	if err != nil {
+		return fmt.Errorf("failed to load attachments: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var filename string
+		var data []byte
+		if err := rows.Scan(&filename, &data); err != nil {
+			continue
+		}
+		if email.AttachmentData == nil {
+			email.AttachmentData = make(map[string][]byte)
+		}
+		email.AttachmentData[filename] = data
+	}
+	if err := rows.Err(); err != nil || len(email.AttachmentData) > 0 {
+		return err
+	}
+
+	var inline []byte
+	err = dm.db.QueryRow("SELECT attachment_data FROM emails WHERE message_id = ? AND attachment_data IS NOT NULL LIMIT 1", key).Scan(&inline)
+	if err == nil && len(inline) > 0 {
+		json.Unmarshal(inline, &email.AttachmentData)
+	}
+	return nil
+}
+
+// LoadArchivedAttachments fills in the attachment content of an email
+// listed from the archive, which listings leave out
+func LoadArchivedAttachments(accountEmail string, email *Email) error {
+	dm, err := NewDatabaseManager(accountEmail)
+	if err != nil {
+		return err
+	}
+	defer dm.Close()
+	return dm.loadAttachmentData(email)
+}
+
+// ListAttachments returns indexed attachments matching the query, newest first
+func (dm *DatabaseManager) ListAttachments(q AttachmentQuery) ([]*AttachmentRecord, error) {
+	query := `
+		SELECT a.id, a.message_id, a.folder, a.uid, a.filename, a.mime_type, a.size, COALESCE(a.sha256, ''),
+			   COALESCE(e.from_address, ''), COALESCE(e.subject, ''), e.date_sent,
+			   b.sha256 IS NOT NULL
+		FROM attachments a
+		LEFT JOIN emails e ON e.id = (SELECT MIN(id) FROM emails WHERE message_id = a.message_id)
+		LEFT JOIN attachment_blobs b ON b.sha256 = a.sha256
+		WHERE 1=1
+	`
+	args := []interface{}{}
+
+	if q.From != "" {
+		query += " AND e.from_address LIKE ?"
+		args = append(args, "%"+q.From+"%")
+	}
+
+	if q.Type != "" {
+		t := strings.ToLower(strings.TrimPrefix(q.Type, "."))
+		switch {
+		case strings.Contains(t, "/"):
+			query += " AND lower(a.mime_type) = ?"
+			args = append(args, t)
+		default:
+			// Extension, MIME subtype or major type: "pdf", "image"
+			query += " AND (lower(a.filename) LIKE ? OR lower(a.mime_type) LIKE ? OR lower(a.mime_type) LIKE ?)"
+			args = append(args, "%."+t, "%/"+t, t+"/%")
+		}
+	}
+
+	if !q.Since.IsZero() {
+		query += " AND e.date_sent >= ?"
+		args = append(args, q.Since)
+	}
+
+	for _, word := range strings.Fields(q.Text) {
+		query += " AND (a.filename LIKE ? OR a.mime_type LIKE ? OR e.from_address LIKE ? OR e.subject LIKE ?)"
+		like := "%" + word + "%"
+		args = append(args, like, like, like, like)
+	}
+
+	query += " ORDER BY e.date_sent DESC, a.id DESC"
+
+	if q.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, q.Limit)
+	}
+
+	rows, err := dm.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query attachments: %v", err)
+	}
+	defer rows.Close()
+
+	var records []*AttachmentRecord
+	for rows.Next() {
+		var r AttachmentRecord
+		var date sql.NullTime
+		if err := rows.Scan(&r.ID, &r.MessageID, &r.Folder, &r.UID, &r.Filename, &r.MIMEType, &r.Size, &r.SHA256,
+			&r.From, &r.Subject, &date, &r.Stored); err != nil {
+			continue
+		}
+		if date.Valid {
+			r.Date = date.Time
+		}
+		records = append(records, &r)
+	}
+
+	return records, rows.Err()
+}
+
+// GetAttachment returns an indexed attachment and its stored content, if any
+func (dm *DatabaseManager) GetAttachment(id int64) (*AttachmentRecord, []byte, error) {
+	var r AttachmentRecord
+	var data []byte
+	var date sql.NullTime
+	err := dm.db.QueryRow(`
+		SELECT a.id, a.message_id, a.folder, a.uid, a.filename, a.mime_type, a.size, COALESCE(a.sha256, ''),
+			   COALESCE(e.from_address, ''), COALESCE(e.subject, ''), e.date_sent, b.data
+		FROM attachments a
+		LEFT JOIN emails e ON e.id = (SELECT MIN(id) FROM emails WHERE message_id = a.message_id)
+		LEFT JOIN attachment_blobs b ON b.sha256 = a.sha256
+		WHERE a.id = ?
+	`, id).Scan(&r.ID, &r.MessageID, &r.Folder, &r.UID, &r.Filename, &r.MIMEType, &r.Size, &r.SHA256,
+		&r.From, &r.Subject, &date, &data)
+	if err == sql.ErrNoRows {
+		return nil, nil, fmt.Errorf("attachment %d not found", id)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load attachment %d: %v", id, err)
+	}
+	if date.Valid {
+		r.Date = date.Time
+	}
+	r.Stored = data != nil
+	return &r, data, nil
+}
+
+// storeAttachmentData adds downloaded content for an indexed attachment
+func (dm *DatabaseManager) storeAttachmentData(r *AttachmentRecord, data []byte) error {
+	tx, err := dm.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	sum := hashAttachment(data)
+	if _, err := tx.Exec(`INSERT OR IGNORE INTO attachment_blobs (sha256, size, data) VALUES (?, ?, ?)`,
+		sum, len(data), data); err != nil {
+		return fmt.Errorf("failed to store attachment: %v", err)
+	}
+	if _, err := tx.Exec(`UPDATE attachments SET sha256 = ?, size = ? WHERE id = ?`, sum, len(data), r.ID); err != nil {
+		return fmt.Errorf("failed to update attachment index: %v", err)
+	}
+
+	r.SHA256 = sum
+	r.Size = int64(len(data))
+	r.Stored = true
+	return tx.Commit()
+}
+
+// GetAttachmentStats returns counts for the index and how much deduplication saved
+func (dm *DatabaseManager) GetAttachmentStats() (total, stored int, uniqueBytes, totalBytes int64, err error) {
+	err = dm.db.QueryRow(`
+		SELECT COUNT(*), COUNT(sha256), COALESCE(SUM(CASE WHEN sha256 IS NOT NULL THEN size ELSE 0 END), 0)
+		FROM attachments
+	`).Scan(&total, &stored, &totalBytes)
+	if err != nil {
+		return
+	}
+	err = dm.db.QueryRow(`SELECT COALESCE(SUM(size), 0) FROM attachment_blobs`).Scan(&uniqueBytes)
+	return
+}
+
+// ListAttachments lists attachments in an account's archive
+func ListAttachments(accountEmail string, q AttachmentQuery) ([]*AttachmentRecord, error) {
+	dm, err := NewDatabaseManager(accountEmail)
+	if err != nil {
+		return nil, err
+	}
+	defer dm.Close()
+
+	return dm.ListAttachments(q)
+}
+
+// SaveAttachment writes an indexed attachment to dir, downloading it from IMAP if
+// the archive only has its name. It returns the path written.
+func SaveAttachment(accountEmail string, id int64, name, dir string) (string, error) {
+	dm, err := NewDatabaseManager(accountEmail)
+	if err != nil {
+		return "", err
+	}
+	defer dm.Close()
+
+	record, data, err := dm.GetAttachment(id)
+	if err != nil {
+		return "", err
+	}
+
+	if data == nil {
+		fmt.Printf("Downloading %s from the server...\n", record.Filename)
+		data, err = fetchAttachmentByMessageID(record.Folder, record.UID, record.MessageID, record.Filename)
+		if err != nil {
+			return "", err
+		}
+		if err := dm.storeAttachmentData(record, data); err != nil {
+			fmt.Printf("Warning: could not store attachment in archive: %v\n", err)
+		}
+	}
+
+	if name == "" {
+		name = record.Filename
+	}
+	// Never let a stored filename escape the target directory
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" || name == ".." {
+		name = fmt.Sprintf("attachment-%d", id)
+	}
+
+	if dir == "" {
+		dir = "."
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %v", err)
+	}
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to save attachment: %v", err)
+	}
+
+	return path, nil
+}
+
+// fetchAttachmentByMessageID downloads one attachment of a message from
+// folder, by UID when it's known. Attachments indexed before folders were
+// recorded are looked for in INBOX.
+func fetchAttachmentByMessageID(folder string, uid uint32, messageID, filename string) ([]byte, error) {
+	if folder == "" {
+		folder, uid = "INBOX", 0
+	}
+	raw, err := fetchRawMessageFrom(folder, uid, messageID)
+	if err != nil {
+		return nil, err
+	}
+	email, err := parseRawMessage(raw)
+	if err != nil {
+		return nil, fmt.Errorf("message %s could not be parsed", messageID)
+	}
+	data, ok := email.AttachmentData[filename]
+	if !ok {
+		return nil, fmt.Errorf("attachment %s not found in message %s", filename, messageID)
+	}
+	return data, nil
+}
+
+// fetchEmailSource downloads the complete source of an email read earlier,
+// by its UID in the folder it was read from when those are known
+func fetchEmailSource(email *Email) ([]byte, error) {
+	folder := email.Folder
+	if folder == "" {
+		folder = "INBOX"
+	}
+	return fetchRawMessageFrom(folder, email.UID, email.MessageID)
+}
+
+// fetchRawMessageFrom downloads a message from folder by UID, or by
+// Message-ID when uid is 0
+func fetchRawMessageFrom(folder string, uid uint32, messageID string) ([]byte, error) {
+	config, err := LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %v", err)
+	}
+
+	c, err := connectToIMAPServer(config)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Logout()
+
+	if _, err := c.Select(folder, true); err != nil {
+		return nil, fmt.Errorf("failed to select %s: %v", folder, err)
+	}
+
+	criteria := imap.NewSearchCriteria()
+	label := messageID
+	if uid > 0 {
+		criteria.Uid = new(imap.SeqSet)
+		criteria.Uid.AddNum(uid)
+		label = fmt.Sprintf("with UID %d", uid)
+	} else if messageID != "" {
+		criteria.Header.Add("Message-ID", messageID)
+	} else {
+		return nil, fmt.Errorf("message has neither a UID nor a Message-ID")
+	}
+	ids, err := c.Search(criteria)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search for message: %v", err)
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("message %s is no longer in %s", label, folder)
+	}
+
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(ids[0])
+	section := &imap.BodySectionName{Peek: true}
+	messages := make(chan *imap.Message, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Fetch(seqSet, []imap.FetchItem{section.FetchItem()}, messages)
+	}()
+
+	var raw []byte
+	for msg := range messages {
+		if r := msg.GetBody(section); r != nil {
+			raw, _ = io.ReadAll(r)
+		}
+	}
+	if err := <-done; err != nil {
+		return nil, fmt.Errorf("failed to fetch message: %v", err)
+	}
+	if raw == nil {
+		return nil, fmt.Errorf("message %s has no content", label)
+	}
+	return raw, nil
+}
+
+// parseRawMessage parses a full message source, including attachment content
+func parseRawMessage(raw []byte) (*Email, error) {
+	section := &imap.BodySectionName{}
+	msg := &imap.Message{Body: map[*imap.BodySectionName]imap.Literal{section: bytes.NewReader(raw)}}
+	return parseMessageWithOptions(msg, section, true)
+}
+
+// FormatAttachmentList renders attachment records for the terminal
+func FormatAttachmentList(records []*AttachmentRecord) string {
+	if len(records) == 0 {
+		return "No attachments found.\n"
+	}
+
+	var b strings.Builder
+	for _, r := range records {
+		stored := ""
+		if !r.Stored {
+			stored = " (not downloaded)"
+		}
+		b.WriteString(fmt.Sprintf("\n[%d] %s%s\n", r.ID, r.Filename, stored))
+		size := "unknown"
+		if r.Size > 0 {
+			size = formatBytes(r.Size)
+		}
+		b.WriteString(fmt.Sprintf("    Type: %s, Size: %s\n", r.MIMEType, size))
+		b.WriteString(fmt.Sprintf("    From: %s\n", r.From))
+		b.WriteString(fmt.Sprintf("    Subject: %s\n", r.Subject))
+		if !r.Date.IsZero() {
+			b.WriteString(fmt.Sprintf("    Date: %s\n", r.Date.Format("Jan 2, 2006 3:04 PM")))
+		}
+		if r.SHA256 != "" {
+			b.WriteString(fmt.Sprintf("    SHA-256: %s\n", r.SHA256))
+		}
+	}
+	return b.String()
+}
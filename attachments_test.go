@@ -0,0 +1,243 @@
+package mailos
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+func TestAttachmentIndex(t *testing.T) {
+	tmpDir := setupTestGroups(t)
+	defer cleanupTestGroups(tmpDir)
+
+	account := "me@example.com"
+	report := []byte("%PDF-1.4 quarterly numbers")
+	photo := []byte("\x89PNG\r\n\x1a\n fake image")
+
+	inbox := &InboxData{
+		AccountEmail:    account,
+		LastSyncVersion: 1,
+		Emails: []*Email{
+			{
+				MessageID:      "<a@example.com>",
+				From:           "Alice <alice@example.com>",
+				Subject:        "Q3 report",
+				Date:           time.Date(2024, 9, 1, 10, 0, 0, 0, time.UTC),
+				Attachments:    []string{"report.pdf", "photo.png"},
+				AttachmentData: map[string][]byte{"report.pdf": report, "photo.png": photo},
+			},
+			{
+				MessageID:      "<b@example.com>",
+				From:           "Bob <bob@example.com>",
+				Subject:        "Fwd: Q3 report",
+				Date:           time.Date(2024, 9, 3, 10, 0, 0, 0, time.UTC),
+				Attachments:    []string{"report-copy.pdf"},
+				AttachmentData: map[string][]byte{"report-copy.pdf": report},
+			},
+			{
+				MessageID:      "<c@example.com>",
+				From:           "Carol <carol@example.com>",
+				Subject:        "Slides",
+				Date:           time.Date(2024, 9, 5, 10, 0, 0, 0, time.UTC),
+				Attachments:    []string{"deck.pptx"},
+				AttachmentMeta: map[string]AttachmentMeta{"deck.pptx": {MIMEType: "application/vnd.ms-powerpoint", Size: 2048}},
+			},
+		},
+	}
+	if err := SaveGlobalInbox(account, inbox); err != nil {
+		t.Fatalf("Failed to save inbox: %v", err)
+	}
+
+	dm, err := NewDatabaseManager(account)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer dm.Close()
+
+	if err := dm.SyncEmailsFromInbox(); err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	// Syncing again must not duplicate rows or lose content
+	if err := dm.SyncEmailsFromInbox(); err != nil {
+		t.Fatalf("Failed to re-sync: %v", err)
+	}
+
+	t.Run("IdenticalContentStoredOnce", func(t *testing.T) {
+		total, stored, uniqueBytes, totalBytes, err := dm.GetAttachmentStats()
+		if err != nil {
+			t.Fatalf("Failed to get stats: %v", err)
+		}
+		if total != 4 || stored != 3 {
+			t.Errorf("Expected 4 indexed and 3 stored attachments, got %d and %d", total, stored)
+		}
+		if uniqueBytes != int64(len(report)+len(photo)) {
+			t.Errorf("Expected blobs to hold one copy of each file, got %d bytes", uniqueBytes)
+		}
+		if totalBytes != int64(2*len(report)+len(photo)) {
+			t.Errorf("Expected %d referenced bytes, got %d", 2*len(report)+len(photo), totalBytes)
+		}
+	})
+
+	t.Run("ListAll", func(t *testing.T) {
+		records, err := dm.ListAttachments(AttachmentQuery{})
+		if err != nil {
+			t.Fatalf("Failed to list: %v", err)
+		}
+		if len(records) != 4 {
+			t.Fatalf("Expected 4 attachments, got %d", len(records))
+		}
+		if records[0].Filename != "deck.pptx" || records[0].Stored || records[0].Size != 2048 {
+			t.Errorf("Expected newest first with metadata only, got %+v", records[0])
+		}
+		if records[1].SHA256 != records[2].SHA256 && records[1].SHA256 != records[3].SHA256 {
+			t.Errorf("Expected the forwarded report to share a hash with the original")
+		}
+	})
+
+	t.Run("FilterByTypeFromSince", func(t *testing.T) {
+		records, _ := dm.ListAttachments(AttachmentQuery{Type: "pdf"})
+		if len(records) != 2 {
+			t.Errorf("Expected 2 PDFs, got %d", len(records))
+		}
+		records, _ = dm.ListAttachments(AttachmentQuery{Type: "image"})
+		if len(records) != 1 || records[0].MIMEType != "image/png" {
+			t.Errorf("Expected the PNG for type image, got %d", len(records))
+		}
+		records, _ = dm.ListAttachments(AttachmentQuery{From: "bob"})
+		if len(records) != 1 || records[0].Filename != "report-copy.pdf" {
+			t.Errorf("Expected Bob's attachment, got %d", len(records))
+		}
+		records, _ = dm.ListAttachments(AttachmentQuery{Since: time.Date(2024, 9, 2, 0, 0, 0, 0, time.UTC)})
+		if len(records) != 2 {
+			t.Errorf("Expected 2 attachments since Sep 2, got %d", len(records))
+		}
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		records, _ := dm.ListAttachments(AttachmentQuery{Text: "q3 report"})
+		if len(records) != 3 {
+			t.Errorf("Expected 3 attachments on Q3 report messages, got %d", len(records))
+		}
+		records, _ = dm.ListAttachments(AttachmentQuery{Text: "deck"})
+		if len(records) != 1 {
+			t.Errorf("Expected filename match, got %d", len(records))
+		}
+	})
+
+	t.Run("EmailsRehydrateContent", func(t *testing.T) {
+		emails, err := dm.GetEmailsFromDB(ReadOptions{Subject: "Fwd"})
+		if err != nil || len(emails) != 1 {
+			t.Fatalf("Expected forwarded email, got %d (%v)", len(emails), err)
+		}
+		// Listings carry what's known about attachments, not their content
+		if emails[0].AttachmentData != nil || len(emails[0].Attachments) != 1 {
+			t.Errorf("Expected the attachment listed without content, got %+v", emails[0])
+		}
+		if err := LoadArchivedAttachments(account, emails[0]); err != nil {
+			t.Fatal(err)
+		}
+		if string(emails[0].AttachmentData["report-copy.pdf"]) != string(report) {
+			t.Errorf("Expected attachment content loaded from blob store")
+		}
+	})
+
+	t.Run("Save", func(t *testing.T) {
+		records, _ := dm.ListAttachments(AttachmentQuery{Type: "png"})
+		outDir := filepath.Join(tmpDir, "out")
+		path, err := SaveAttachment(account, records[0].ID, "../../escape.png", outDir)
+		if err != nil {
+			t.Fatalf("Failed to save: %v", err)
+		}
+		if path != filepath.Join(outDir, "escape.png") {
+			t.Errorf("Expected name to stay inside the target dir, got %s", path)
+		}
+		data, _ := os.ReadFile(path)
+		if string(data) != string(photo) {
+			t.Errorf("Saved content doesn't match")
+		}
+	})
+}
+
+func TestFetchEmailSource(t *testing.T) {
+	startTestIMAP(t)
+
+	emails, err := ReadFromFolder(ReadOptions{}, "INBOX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lunch *Email
+	for _, email := range emails {
+		if email.Subject == "Lunch" {
+			lunch = email
+		}
+	}
+	if lunch == nil || lunch.UID == 0 {
+		t.Fatalf("Expected the Lunch email with its UID, got %+v", lunch)
+	}
+
+	// Found by UID in its folder, without a Message-ID
+	lunch.MessageID = ""
+	raw, err := fetchEmailSource(lunch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw), "Subject: Lunch") {
+		t.Errorf("Expected the Lunch message, got %q", raw)
+	}
+
+	lunch.UID = 999
+	if _, err := fetchEmailSource(lunch); err == nil || !strings.Contains(err.Error(), "no longer in INBOX") {
+		t.Errorf("Expected a missing message error, got %v", err)
+	}
+}
+
+func TestSaveAttachmentFromItsFolder(t *testing.T) {
+	startTestIMAP(t)
+
+	config, _ := LoadConfig()
+	c, err := connectToIMAPServer(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Create("Receipts")
+	c.Select("INBOX", false)
+	moved := new(imap.SeqSet)
+	moved.AddNum(4)
+	if err := c.Move(moved, "Receipts"); err != nil {
+		t.Fatal(err)
+	}
+	c.Logout()
+
+	// Receipt has no Message-ID, so only its folder and UID find it again
+	emails, err := ReadFromFolder(ReadOptions{}, "Receipts")
+	if err != nil || len(emails) != 1 || emails[0].Subject != "Receipt" {
+		t.Fatalf("Expected Receipt moved, got %+v (%v)", emails, err)
+	}
+	dm, err := NewDatabaseManager("username")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dm.Close()
+	if err := dm.StoreEmails("Receipts", emails); err != nil {
+		t.Fatal(err)
+	}
+	records, err := dm.ListAttachments(AttachmentQuery{})
+	if err != nil || len(records) != 1 || records[0].Stored {
+		t.Fatalf("Expected receipt.pdf indexed without its content, got %+v (%v)", records, err)
+	}
+	if records[0].Folder != "Receipts" || records[0].UID != emails[0].UID {
+		t.Errorf("Expected the attachment located in Receipts, got %+v", records[0])
+	}
+
+	path, err := SaveAttachment("username", records[0].ID, "", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "%PDF" {
+		t.Errorf("Unexpected attachment content %q", data)
+	}
+}
@@ -0,0 +1,186 @@
+package mailos
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// recipientBatches splits recipients into groups of at most size
+func recipientBatches(recipients []string, size int) [][]string {
+	var batches [][]string
+	for size > 0 && len(recipients) > size {
+		batches = append(batches, recipients[:size])
+		recipients = recipients[size:]
+	}
+	if len(recipients) > 0 {
+		batches = append(batches, recipients)
+	}
+	return batches
+}
+
+// batchJobID identifies a bulk send by its content and recipients, so running
+// the same send again resumes it
+func batchJobID(msg *EmailMessage, recipients []string) string {
+	sorted := append([]string{}, recipients...)
+	sort.Strings(sorted)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s", msg.Subject, msg.Body, strings.Join(msg.Attachments, "\x00"), strings.Join(sorted, ","))
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// uniqueRecipients returns the bare, lower-cased envelope addresses of msg
+func uniqueRecipients(msg *EmailMessage) []string {
+	all := append(append(append([]string{}, msg.To...), msg.CC...), msg.BCC...)
+	seen := make(map[string]bool)
+	var unique []string
+	for _, address := range envelopeRecipients(all) {
+		address = strings.ToLower(address)
+		if !seen[address] {
+			seen[address] = true
+			unique = append(unique, address)
+		}
+	}
+	return unique
+}
+
+// completedBatchRecipients returns the recipients a bulk send already reached
+func (dm *DatabaseManager) completedBatchRecipients(jobID string) (map[string]bool, error) {
+	rows, err := dm.db.Query(`SELECT recipient FROM batch_sends WHERE job_id = ?`, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load batch progress: %v", err)
+	}
+	defer rows.Close()
+
+	done := make(map[string]bool)
+	for rows.Next() {
+		var recipient string
+		if err := rows.Scan(&recipient); err != nil {
+			return nil, err
+		}
+		done[recipient] = true
+	}
+	return done, rows.Err()
+}
+
+// recordBatchRecipients marks recipients of a bulk send as reached
+func (dm *DatabaseManager) recordBatchRecipients(jobID string, recipients []string) error {
+	tx, err := dm.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, recipient := range recipients {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO batch_sends (job_id, recipient, sent_at) VALUES (?, ?, ?)`, jobID, recipient, now); err != nil {
+			return fmt.Errorf("failed to record batch progress: %v", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// clearBatchJob forgets a finished bulk send
+func (dm *DatabaseManager) clearBatchJob(jobID string) error {
+	_, err := dm.db.Exec(`DELETE FROM batch_sends WHERE job_id = ?`, jobID)
+	return err
+}
+
+// sendInBatches sends msg, splitting recipient lists over the account's
+// per-message limit into BCC batches. Each batch is its own SMTP transaction,
+// all under one Message-ID so replies to any of them belong to the same send
+// and its follow-up reminder. Progress is recorded after every batch, so running
+// the same send again after an error or the daily limit resumes where it stopped.
+func sendInBatches(msg *EmailMessage, accountEmail string, verbose bool) error {
+	// Front matter can add recipients, so apply it before counting them
+	msg, err := ProcessEmailWithFrontmatter(msg)
+	if err != nil {
+		return fmt.Errorf("failed to process frontmatter: %v", err)
+	}
+
+	setup, err := InitializeMailSetup(accountEmail)
+	if err != nil {
+		return fmt.Errorf("failed to initialize mail setup: %v", err)
+	}
+	config := setup.Config
+	limits := config.GetSendLimits()
+
+	recipients := uniqueRecipients(msg)
+	if limits.RecipientsPerMessage <= 0 || len(recipients) <= limits.RecipientsPerMessage {
+		return sendWithAccount(msg, accountEmail, verbose)
+	}
+
+	// Visible recipients stay in the headers when they fit in one message;
+	// otherwise everyone is moved to BCC so the list isn't disclosed
+	base := *msg
+	fromEmail, _ := senderAddress(config)
+	if base.MessageID == "" {
+		base.MessageID = generateMessageID(fromEmail)
+	}
+	// The follow-up covers every recipient, so it's set once all are sent
+	base.RemindIfNoReply = 0
+	if len(envelopeRecipients(append(append([]string{}, msg.To...), msg.CC...))) > limits.RecipientsPerMessage {
+		base.To = []string{fromEmail}
+		base.CC = nil
+		base.BCC = recipients
+	}
+
+	dm, err := NewDatabaseManager(config.Email)
+	if err != nil {
+		return err
+	}
+	defer dm.Close()
+
+	jobID := batchJobID(msg, recipients)
+	done, err := dm.completedBatchRecipients(jobID)
+	if err != nil {
+		return err
+	}
+
+	var remaining []string
+	for _, recipient := range recipients {
+		if !done[recipient] {
+			remaining = append(remaining, recipient)
+		}
+	}
+	batches := recipientBatches(remaining, limits.RecipientsPerMessage)
+
+	if len(done) > 0 {
+		fmt.Printf("↻ Resuming: %d of %d recipients already sent\n", len(done), len(recipients))
+	}
+	fmt.Printf("📦 Sending to %d recipients in %d batches of up to %d\n", len(remaining), len(batches), limits.RecipientsPerMessage)
+
+	sent := len(done)
+	for i, batch := range batches {
+		batchMsg := base
+		batchMsg.EnvelopeTo = batch
+		// Only the first batch of a send keeps a copy in the Sent folder
+		batchMsg.SkipSentCopy = sent > 0
+
+		if err := sendWithAccount(&batchMsg, accountEmail, verbose); err != nil {
+			return fmt.Errorf("batch %d/%d stopped after %d of %d recipients (run the same command again to resume): %w",
+				i+1, len(batches), sent, len(recipients), err)
+		}
+		if err := dm.recordBatchRecipients(jobID, batch); err != nil {
+			return err
+		}
+		sent += len(batch)
+		fmt.Printf("  ✓ Batch %d/%d sent (%d/%d recipients)\n", i+1, len(batches), sent, len(recipients))
+	}
+
+	if msg.RemindIfNoReply > 0 {
+		now := time.Now()
+		trackSentFollowup(config.Email, &Followup{
+			MessageID:  base.MessageID,
+			Subject:    msg.Subject,
+			Recipients: recipients,
+			SentAt:     now,
+			RemindAt:   now.Add(msg.RemindIfNoReply),
+		})
+	}
+	return dm.clearBatchJob(jobID)
+}
@@ -216,6 +216,9 @@ func FormatEmailListWithDrafts(emails []*Email, emailCount int) string {
 		result.WriteString(fmt.Sprintf("\n%d. From: %s\n", email.ID, email.From))
 		result.WriteString(fmt.Sprintf("   Subject: %s\n", email.Subject))
 		result.WriteString(fmt.Sprintf("   Date: %s%s\n", email.Date.Format("Jan 2, 2006 3:04 PM"), draftIndicator))
+		if email.Auth != nil && email.Auth.Suspicious {
+			result.WriteString(fmt.Sprintf("   ⚠️  Suspicious: %s\n", email.Auth.Warnings[0]))
+		}
 
 		// Show preview of body
 		preview := email.Body
@@ -312,9 +312,9 @@ func parseQueryFromArgs(args []string) string {
 	
 	// First check if it's a known command
 	knownCommands := []string{
-		"setup", "local", "configure", "config", "template", "drafts", "draft", "send", "sent", "read", "reply",
+		"setup", "local", "configure", "config", "template", "signature", "privacy", "status", "snooze", "followups", "drafts", "draft", "send", "sent", "read", "reply",
 		"mark-read", "delete", "unsubscribe", "info", "test", "interactive", "chat",
-		"report", "open", "provider", "stats", "search",
+		"report", "digest", "open", "provider", "stats", "search", "searches", "tui", "sql",
 		"--help", "-h", "--version", "-v",
 	}
 	
@@ -458,10 +458,10 @@ func formatEmailAsMarkdown(email *mailos.Email) string {
 	
 	// Body
 	body := email.Body
-	if body == "" && email.BodyHTML != "" {
-		// If only HTML is available, note it
+	if email.BodyHTML != "" && (body == "" || email.BodyFromHTML) {
+		// If only HTML is available, note it and convert it to markdown
 		content.WriteString("*[HTML email - plain text version not available]*\n\n")
-		body = mailos.StripHTMLTags(email.BodyHTML)
+		body = mailos.HTMLToText(mailos.SanitizeRemoteContent(email.BodyHTML, mailos.LoadPrivacySettings()), mailos.HTMLTextOptions{Markdown: true})
 	}
 	
 	content.WriteString(body)
@@ -473,11 +473,11 @@ func formatEmailAsMarkdown(email *mailos.Email) string {
 // getAllCommands returns all available command names including aliases
 func getAllCommands() []string {
 	commands := []string{
-		"setup", "local", "provider", "configure", "config", "template",
+		"setup", "local", "provider", "configure", "config", "template", "signature", "privacy", "status", "snooze", "followups",
 		"draft", "drafts", "compose", "send", "sync", "sync-db", "sent", "download", "read", "reply", "forward",
-		"mark-read", "accounts", "info", "test", "delete", "report",
-		"open", "stats", "docs", "commands", "tools", "interactive", "chat", "search",
-		"unsubscribe", "uninstall", "cleanup",
+		"mark-read", "accounts", "info", "test", "delete", "report", "digest",
+		"open", "stats", "docs", "commands", "tools", "interactive", "chat", "search", "searches",
+		"unsubscribe", "uninstall", "cleanup", "tui", "attachments", "sql",
 	}
 	sort.Strings(commands)
 	return commands
@@ -559,8 +559,8 @@ func showUnknownCommandHelp(unknownCmd string) {
 	// Group commands by category for better display
 	core := []string{"setup", "configure", "info"}
 	email := []string{"read", "reply", "send", "compose", "draft", "search", "delete", "mark-read"}
-	management := []string{"sync", "sync-db", "accounts", "stats", "report", "template"}
-	interaction := []string{"interactive", "chat", "open", "unsubscribe"}
+	management := []string{"sync", "sync-db", "sql", "searches", "accounts", "stats", "report", "digest", "template", "signature", "privacy", "status", "snooze", "followups"}
+	interaction := []string{"interactive", "chat", "tui", "open", "unsubscribe"}
 	
 	printCommandGroup("Core", core)
 	printCommandGroup("Email", email)
@@ -597,6 +597,7 @@ func showAllCommands(verbose bool) error {
 	// Email Management Commands  
 	fmt.Printf("\n📧 EMAIL MANAGEMENT:\n")
 	fmt.Printf("  search     - Search and list emails with advanced filters\n")
+	fmt.Printf("  searches   - List saved searches with their counts\n")
 	fmt.Printf("  read       - Display full content of a specific email by ID\n")
 	fmt.Printf("  send       - Send an email\n")
 	fmt.Printf("  reply      - Reply to a specific email\n")
@@ -605,6 +606,7 @@ func showAllCommands(verbose bool) error {
 	fmt.Printf("  delete     - Delete emails\n")
 	fmt.Printf("  sent       - Read sent emails\n")
 	fmt.Printf("  download   - Download email attachments\n")
+	fmt.Printf("  attachments- List, search and save archived attachments\n")
 	
 	// Draft Management
 	fmt.Printf("\n📝 DRAFT MANAGEMENT:\n")
@@ -616,8 +618,9 @@ func showAllCommands(verbose bool) error {
 	fmt.Printf("\n📊 DATA & ANALYTICS:\n")
 	fmt.Printf("  stats      - Show email statistics and analytics\n")
 	fmt.Printf("  report     - Generate email reports for time ranges\n")
-	fmt.Printf("  sync       - Sync emails from IMAP to local filesystem\n")
-	fmt.Printf("  sync-db    - Sync emails to local SQLite database\n")
+	fmt.Printf("  sync       - Sync emails from IMAP to the local archive\n")
+	fmt.Printf("  sync-db    - Check the local archive, importing any old inbox.json\n")
+	fmt.Printf("  sql        - Run read-only SQL against the local archive\n")
 	
 	// Automation & Tools
 	fmt.Printf("\n🔧 AUTOMATION & TOOLS:\n")
@@ -631,6 +634,7 @@ func showAllCommands(verbose bool) error {
 	fmt.Printf("\n🤖 INTERACTIVE & AI:\n")
 	fmt.Printf("  interactive- Launch interactive mode\n")
 	fmt.Printf("  chat       - Launch AI chat interface\n")
+	fmt.Printf("  tui        - Full-screen mail client (folders, list, preview)\n")
 	
 	// System Management
 	fmt.Printf("\n⚙️  SYSTEM MANAGEMENT:\n")
@@ -686,6 +690,7 @@ func showAllCommands(verbose bool) error {
 	fmt.Printf("\n━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n")
 	fmt.Printf("📚 USAGE EXAMPLES:\n")
 	fmt.Printf("  mailos search --unread --days 7          # Unread emails last 7 days\n")
+	fmt.Printf("  mailos search --save invoices 'from:billing has:attachment since:30d'\n")
 	fmt.Printf("  mailos read 1234                         # Read email ID 1234\n")
 	fmt.Printf("  mailos send --to user@example.com --subject \"Hi\" --body \"Hello\"\n")
 	fmt.Printf("  mailos stats --from gmail.com --days 30  # Gmail stats last 30 days\n")
@@ -704,6 +709,10 @@ var rootCmd = &cobra.Command{
 	Short:   "EmailOS - A standardized email client",
 	Long: `EmailOS is a command-line email client that supports multiple providers
 and provides a consistent interface for sending and reading emails.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		overrides, _ := cmd.Flags().GetStringArray("set")
+		return mailos.SetConfigOverrides(overrides)
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		
 		// Check if this is an unknown command (single argument that's not a query)
@@ -825,6 +834,40 @@ Use --local flag to create/modify project-specific configuration (.email/)`,
 	},
 }
 
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the effective configuration",
+	Long: `Show the configuration mailos is using, merged from the built-in defaults,
+~/.email/config.json, .email/config.json, MAILOS_* environment variables and
+--set flags. Use --explain to see which of them each value came from.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		explain, _ := cmd.Flags().GetBool("explain")
+		asJSON, _ := cmd.Flags().GetBool("json")
+		return mailos.ShowConfig(explain, asJSON)
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the configuration files against their schema",
+	Long: `Check ~/.email/config.json, .email/config.json, groups.json and searches.json
+against their JSON Schema: unknown fields, unknown providers, malformed email
+addresses, duplicate accounts, groups or searches, and queries that don't parse. Files from older versions of mailos are checked
+as they'll be after upgrading.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if schema, _ := cmd.Flags().GetBool("schema"); schema {
+			data, err := json.MarshalIndent(mailos.ConfigJSONSchema(), "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+		asJSON, _ := cmd.Flags().GetBool("json")
+		return mailos.ValidateConfig(asJSON)
+	},
+}
+
 var templateCmd = &cobra.Command{
 	Use:   "template",
 	Short: "Customize HTML email template",
@@ -849,6 +892,399 @@ The template will be saved and used for all future emails.`,
 	},
 }
 
+var signatureCmd = &cobra.Command{
+	Use:   "signature",
+	Short: "Manage named signatures",
+	Long: `Manage named signatures for an account. Signatures are markdown files in
+~/.email/[account]/signatures/ and are sent as both HTML and plain text.
+Replies and forwards put the signature above the quoted message.
+
+Pick a signature for a single message in its front matter:
+  signature: work-short   # or "none" to send without one
+
+Examples:
+  mailos signature add work --file work.md   # Save a signature from a file
+  mailos signature edit work-short           # Edit (or create) in $EDITOR
+  mailos signature use work                  # Use it by default
+  mailos signature list                      # Show signatures and the default`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return mailos.EnsureInitialized()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runSignatureList(cmd)
+	},
+}
+
+var signatureListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the account's signatures",
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return mailos.EnsureInitialized()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runSignatureList(cmd)
+	},
+}
+
+var signatureAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "Add or replace a signature from markdown",
+	Args:  cobra.ExactArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return mailos.EnsureInitialized()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := signatureConfig(cmd)
+		if err != nil {
+			return err
+		}
+		body, _ := cmd.Flags().GetString("body")
+		file, _ := cmd.Flags().GetString("file")
+		makeDefault, _ := cmd.Flags().GetBool("default")
+
+		if file != "" {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("failed to read file: %v", err)
+			}
+			body = string(content)
+		} else if body == "" {
+			fmt.Println("Enter signature (Markdown supported). Press Ctrl+D when done:")
+			scanner := bufio.NewScanner(os.Stdin)
+			var lines []string
+			for scanner.Scan() {
+				lines = append(lines, scanner.Text())
+			}
+			body = strings.Join(lines, "\n")
+		}
+		if strings.TrimSpace(body) == "" {
+			return fmt.Errorf("signature is empty")
+		}
+
+		account := mailos.SignatureAccount(cfg)
+		signature, err := mailos.SaveSignature(account, args[0], body)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ Signature '%s' saved to %s\n", signature.Name, signature.Path)
+
+		if makeDefault {
+			if err := mailos.SetDefaultSignature(account, signature.Name); err != nil {
+				return err
+			}
+			fmt.Printf("✓ Using '%s' by default for %s\n", signature.Name, account)
+		}
+		return nil
+	},
+}
+
+var signatureEditCmd = &cobra.Command{
+	Use:   "edit <name>",
+	Short: "Edit a signature in $EDITOR, creating it if needed",
+	Args:  cobra.ExactArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return mailos.EnsureInitialized()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := signatureConfig(cmd)
+		if err != nil {
+			return err
+		}
+		signature, err := mailos.EditSignature(cfg, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ Signature '%s' saved\n", signature.Name)
+		fmt.Printf("%s\n", signature.Text())
+		return nil
+	},
+}
+
+var signatureUseCmd = &cobra.Command{
+	Use:   "use <name>",
+	Short: "Use a signature by default (\"none\" turns signatures off)",
+	Args:  cobra.ExactArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return mailos.EnsureInitialized()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := signatureConfig(cmd)
+		if err != nil {
+			return err
+		}
+		account := mailos.SignatureAccount(cfg)
+		name := args[0]
+		if name != mailos.NoSignatureName {
+			if _, err := mailos.LoadSignature(account, name); err != nil {
+				return err
+			}
+		}
+		if err := mailos.SetDefaultSignature(account, name); err != nil {
+			return err
+		}
+		if name == mailos.NoSignatureName {
+			fmt.Printf("✓ Signatures turned off by default for %s\n", account)
+		} else {
+			fmt.Printf("✓ Using '%s' by default for %s\n", name, account)
+		}
+		return nil
+	},
+}
+
+// signatureConfig returns the config of the --account flag or the current account
+func signatureConfig(cmd *cobra.Command) (*mailos.Config, error) {
+	accountEmail, _ := cmd.Flags().GetString("account")
+	setup, err := mailos.InitializeMailSetup(accountEmail)
+	if err != nil {
+		return nil, err
+	}
+	return setup.Config, nil
+}
+
+// runSignatureList prints the account's signatures
+func runSignatureList(cmd *cobra.Command) error {
+	cfg, err := signatureConfig(cmd)
+	if err != nil {
+		return err
+	}
+	account := mailos.SignatureAccount(cfg)
+	signatures, err := mailos.ListSignatures(account)
+	if err != nil {
+		return err
+	}
+	fmt.Print(mailos.FormatSignatureList(account, signatures, cfg.DefaultSignature))
+	return nil
+}
+
+var privacyCmd = &cobra.Command{
+	Use:   "privacy",
+	Short: "Tracking and remote content in received email",
+	Long: `Received HTML is stored without tracking pixels or known tracker resources.
+Other remote images and stylesheets are blocked too, unless the "privacy"
+setting allows them or loads them through an image proxy.
+
+Examples:
+  mailos privacy report          # Senders that track opens and link redirect domains
+  mailos privacy report --json   # The same as JSON`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return mailos.EnsureInitialized()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+var privacyReportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "List senders that track opens and the link redirect domains they use",
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return mailos.EnsureInitialized()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		accountEmail, _ := cmd.Flags().GetString("account")
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		setup, err := mailos.InitializeMailSetup(accountEmail)
+		if err != nil {
+			return err
+		}
+		inbox, err := mailos.LoadGlobalInbox(setup.Config.Email)
+		if err != nil {
+			return err
+		}
+
+		report := mailos.BuildPrivacyReport(inbox.Emails, setup.Config.GetPrivacySettings())
+		if asJSON {
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode report: %v", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+		fmt.Print(mailos.FormatPrivacyReport(report))
+		return nil
+	},
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show connectivity and operations queued while offline",
+	Long: `Show whether the IMAP server is reachable and list operations made while
+offline. Mark-read, delete, move and draft saves are applied to the local
+archive right away and replayed on the server once it can be reached again.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return mailos.EnsureInitialized()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		accountEmail, _ := cmd.Flags().GetString("account")
+		replay, _ := cmd.Flags().GetBool("replay")
+		discard, _ := cmd.Flags().GetInt64("discard")
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		setup, err := mailos.InitializeMailSetup(accountEmail)
+		if err != nil {
+			return err
+		}
+		config := setup.Config
+
+		if discard > 0 {
+			if err := mailos.DiscardQueuedOp(config.Email, discard); err != nil {
+				return err
+			}
+			fmt.Printf("✓ Discarded queued operation #%d\n", discard)
+		}
+
+		var offline bool
+		if replay {
+			result, err := mailos.ReplayQueuedOps(config)
+			if err != nil {
+				fmt.Printf("⚠️  %v\n", err)
+			}
+			switch {
+			case result == nil:
+			case result.Offline:
+				offline = true
+				fmt.Println("📴 Still offline; the queue will be replayed once the server is reachable")
+			default:
+				fmt.Printf("✓ Replayed %d operation(s), %d conflict(s), %d still pending\n", result.Applied, len(result.Conflicts), result.Remaining)
+			}
+		}
+		if !offline {
+			offline = !mailos.ServerReachable(config)
+		}
+
+		ops, err := mailos.ListQueuedOps(config.Email)
+		if err != nil {
+			return err
+		}
+		if asJSON {
+			data, err := json.MarshalIndent(map[string]interface{}{
+				"account": config.Email,
+				"offline": offline,
+				"queue":   ops,
+			}, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode status: %v", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+
+		if offline {
+			fmt.Printf("📴 %s: offline\n", config.Email)
+		} else {
+			fmt.Printf("🌐 %s: online\n", config.Email)
+		}
+		fmt.Print(mailos.FormatQueuedOps(ops))
+		return nil
+	},
+}
+
+var snoozeCmd = &cobra.Command{
+	Use:   "snooze [id...]",
+	Short: "Hide INBOX messages until later",
+	Long: `Move INBOX messages to the Snoozed folder until the given time. The first
+sync after that moves them back to INBOX; run 'mailos sync --watch 5m' to have
+them return on time.
+
+Times can be a duration (3d, 12h), a day with an optional time (tomorrow,
+"monday 9am", "next week"), a time alone (5pm) or a date ("2024-03-01 14:00").`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return mailos.EnsureInitialized()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		accountEmail, _ := cmd.Flags().GetString("account")
+		untilFlag, _ := cmd.Flags().GetString("until")
+		list, _ := cmd.Flags().GetBool("list")
+
+		setup, err := mailos.InitializeMailSetup(accountEmail)
+		if err != nil {
+			return err
+		}
+		config := setup.Config
+
+		if list || len(args) == 0 {
+			snoozed, err := mailos.ListSnoozed(config.Email)
+			if err != nil {
+				return err
+			}
+			fmt.Print(mailos.FormatSnoozed(snoozed))
+			return nil
+		}
+
+		if untilFlag == "" {
+			return fmt.Errorf("--until is required, e.g. --until \"monday 9am\"")
+		}
+		until, err := mailos.ParseReminderTime(untilFlag, time.Now())
+		if err != nil {
+			return err
+		}
+
+		var ids []uint32
+		for _, arg := range args {
+			id, err := strconv.ParseUint(arg, 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid email ID %q", arg)
+			}
+			ids = append(ids, uint32(id))
+		}
+
+		snoozed, err := mailos.SnoozeEmails(config, ids, until)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("💤 Snoozed %d message(s) until %s\n", len(snoozed), until.Format("Mon Jan 2 3:04 PM"))
+		return nil
+	},
+}
+
+var followupsCmd = &cobra.Command{
+	Use:   "followups",
+	Short: "List sent messages that haven't had a reply",
+	Long: `List messages sent with 'mailos send --remind-if-no-reply <duration>' that
+nobody has replied to. Replies are matched by their In-Reply-To and References
+headers when 'mailos sync' fetches new mail.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return mailos.EnsureInitialized()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		accountEmail, _ := cmd.Flags().GetString("account")
+		all, _ := cmd.Flags().GetBool("all")
+		dismiss, _ := cmd.Flags().GetInt64("dismiss")
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		setup, err := mailos.InitializeMailSetup(accountEmail)
+		if err != nil {
+			return err
+		}
+		config := setup.Config
+
+		if dismiss > 0 {
+			if err := mailos.DismissFollowup(config.Email, dismiss); err != nil {
+				return err
+			}
+			fmt.Printf("✓ Dismissed follow-up #%d\n", dismiss)
+			return nil
+		}
+
+		followups, err := mailos.ListFollowups(config.Email)
+		if err != nil {
+			return err
+		}
+		if asJSON {
+			data, err := json.MarshalIndent(followups, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode follow-ups: %v", err)
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+		fmt.Print(mailos.FormatFollowups(followups, time.Now(), all))
+		return nil
+	},
+}
+
 var draftCmd = &cobra.Command{
 	Use:   "draft",
 	Short: "Simplified draft management",
@@ -1143,16 +1579,18 @@ var sendCmd = &cobra.Command{
 		from, _ := cmd.Flags().GetString("from")
 		preview, _ := cmd.Flags().GetBool("preview")
 		useTemplate, _ := cmd.Flags().GetBool("template")
+		embedRemote, _ := cmd.Flags().GetBool("embed-remote-images")
 		verbose, _ := cmd.Flags().GetBool("verbose")
 		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		remindAfter, _ := cmd.Flags().GetString("remind-if-no-reply")
 
 		// Handle group parameter
 		if group != "" {
-			groupEmails, err := mailos.GetGroupEmails(group)
+			groupEmails, err := mailos.ProcessGroupsForSending([]string{group}, to)
 			if err != nil {
 				return fmt.Errorf("failed to get group emails: %v", err)
 			}
-			to = append(to, groupEmails...)
+			to = groupEmails
 		}
 
 		if len(to) == 0 {
@@ -1188,7 +1626,7 @@ var sendCmd = &cobra.Command{
 		// return fmt.Errorf("client functionality temporarily disabled")
 
 		// Prepare signature
-		var sig string
+		var sig, sigHTML string
 		if !noSignature {
 			if signature != "" {
 				// Process newline characters in custom signature
@@ -1205,38 +1643,11 @@ var sendCmd = &cobra.Command{
 				if err == nil {
 					cfg := setup.Config
 					if verbose {
-						fmt.Printf("Debug: SignatureOverride = '%s'\n", cfg.SignatureOverride)
-					}
-					// Check for signature override first (works for all accounts)
-					if cfg.SignatureOverride != "" {
-						if verbose {
-							fmt.Printf("Debug: Using account signature override\n")
-						}
-						sig = cfg.SignatureOverride
-					} else {
-						// For wildcard aliases, don't include automatic signature unless explicitly set
-						if verbose {
-							fmt.Printf("Debug: cfg.FromEmail = '%s', cfg.Email = '%s'\n", cfg.FromEmail, cfg.Email)
-						}
-						if cfg.FromEmail != cfg.Email {
-							// This is a wildcard alias - no automatic signature
-							if verbose {
-								fmt.Printf("Debug: Wildcard alias detected - no automatic signature\n")
-							}
-							sig = ""
-						} else {
-							// Use FromEmail if specified, otherwise use Email
-							emailToShow := cfg.Email
-							if cfg.FromEmail != "" {
-								emailToShow = cfg.FromEmail
-							}
-							name := cfg.FromName
-							if name == "" {
-								name = strings.Split(emailToShow, "@")[0]
-							}
-							sig = fmt.Sprintf("\n--\n%s\n%s", name, emailToShow)
-						}
+						fmt.Printf("Debug: DefaultSignature = '%s', SignatureOverride = '%s'\n", cfg.DefaultSignature, cfg.SignatureOverride)
 					}
+					// Default named signature, then signature override, then
+					// name and address (none for wildcard aliases)
+					sig, sigHTML = mailos.AccountSignature(cfg)
 				}
 			}
 		}
@@ -1250,12 +1661,23 @@ var sendCmd = &cobra.Command{
 			Body:        body,
 			Attachments: attachments,
 			UseTemplate: useTemplate,
+			EmbedRemoteImages: embedRemote,
+		}
+		if remindAfter != "" {
+			if msg.RemindIfNoReply, err = mailos.ParseReminderDuration(remindAfter); err != nil {
+				return err
+			}
+		}
+		if file != "" {
+			// Relative image paths in the body resolve against the file's directory
+			msg.ImageDir = filepath.Dir(file)
 		}
 
-		// Add signature if needed
-		if sig != "" {
-			msg.IncludeSignature = true
+		// Add signature if needed; front matter can still pick a named one
+		if !noSignature {
+			msg.IncludeSignature = sig != ""
 			msg.SignatureText = sig
+			msg.SignatureHTML = sigHTML
 		}
 
 		// Convert markdown to HTML unless plain text requested
@@ -1410,15 +1832,20 @@ Each email is saved as a markdown file with metadata.`,
 			opts.Since = time.Now().AddDate(0, 0, -days)
 		}
 		
+		if watch, _ := cmd.Flags().GetDuration("watch"); watch > 0 {
+			return mailos.WatchSync(opts, watch)
+		}
 		return mailos.SyncEmails(opts)
 	},
 }
 
 var syncDbCmd = &cobra.Command{
 	Use:   "sync-db",
-	Short: "Sync emails from inbox to local SQLite database",
-	Long:  `Sync emails from your local inbox to SQLite database.
-Creates a SQLite database at ~/.email/[account]/archive.db for fast querying and analysis.`,
+	Short: "Check the local SQLite archive, importing any old inbox.json",
+	Long:  `Report on the SQLite archive at ~/.email/[account]/archive.db.
+'mailos sync' writes to the archive directly. Emails that older versions kept in
+inbox.json are imported the first time the archive is opened; this command does
+the same on demand.`,
 	PreRunE: func(cmd *cobra.Command, args []string) error {
 		return mailos.EnsureInitialized()
 	},
@@ -1447,6 +1874,160 @@ Creates a SQLite database at ~/.email/[account]/archive.db for fast querying and
 	},
 }
 
+var sqlCmd = &cobra.Command{
+	Use:   "sql <query>",
+	Short: "Run a read-only SQL query against the local archive",
+	Long: `Run a SELECT query against the local SQLite archive and print the rows.
+
+The archive is opened read-only. Query the messages view, whose columns are
+id, folder, uid, message_id, in_reply_to, sender, recipients (JSON), subject,
+date, is_read, flags (JSON), attachment_count, attachments (JSON) and body.
+
+  mailos sql "SELECT sender, COUNT(*) AS n FROM messages GROUP BY sender ORDER BY n DESC LIMIT 10"`,
+	Args: cobra.ExactArgs(1),
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return mailos.EnsureInitialized()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		accountEmail, _ := cmd.Flags().GetString("account")
+		asJSON, _ := cmd.Flags().GetBool("json")
+		return mailos.RunSQL(accountEmail, args[0], asJSON)
+	},
+}
+
+var searchesCmd = &cobra.Command{
+	Use:   "searches",
+	Short: "List saved searches and how many emails each matches",
+	Long: `List the searches saved with 'mailos search --save <name> "<query>"'.
+
+A saved search works as a virtual folder: pass its name to --folder in search,
+stats and report, or pick it in the tui's folder list. It's evaluated against
+the local archive each time, so the counts follow 'mailos sync'. Saved searches
+are stored in ~/.email/searches.json.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return mailos.EnsureInitialized()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		accountEmail, _ := cmd.Flags().GetString("account")
+		if name, _ := cmd.Flags().GetString("delete"); name != "" {
+			return mailos.DeleteSavedSearch(name)
+		}
+		return mailos.ListSavedSearches(accountEmail)
+	},
+}
+
+var attachmentsCmd = &cobra.Command{
+	Use:   "attachments",
+	Short: "List, search and save attachments from the local archive",
+	Long: `Work with attachments indexed in the sync-db archive (~/.email/[account]/archive.db).
+Run 'mailos sync' and 'mailos sync-db' first to build the index.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return mailos.EnsureInitialized()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runAttachmentsList(cmd, "")
+	},
+}
+
+var attachmentsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List indexed attachments",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runAttachmentsList(cmd, "")
+	},
+}
+
+var attachmentsSearchCmd = &cobra.Command{
+	Use:   "search [text]",
+	Short: "Search attachments by filename, type, sender or subject",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runAttachmentsList(cmd, strings.Join(args, " "))
+	},
+}
+
+var attachmentsSaveCmd = &cobra.Command{
+	Use:   "save <id> [name]",
+	Short: "Save an attachment to disk by its index ID",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid attachment ID: %s", args[0])
+		}
+		name := ""
+		if len(args) > 1 {
+			name = args[1]
+		}
+		dir, _ := cmd.Flags().GetString("to")
+		
+		accountEmail, err := archiveAccount(cmd)
+		if err != nil {
+			return err
+		}
+		
+		path, err := mailos.SaveAttachment(accountEmail, id, name, dir)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ Saved attachment to %s\n", path)
+		return nil
+	},
+}
+
+// archiveAccount returns the --account flag or the configured account
+func archiveAccount(cmd *cobra.Command) (string, error) {
+	accountEmail, _ := cmd.Flags().GetString("account")
+	if accountEmail != "" {
+		return accountEmail, nil
+	}
+	
+	cfg, err := mailos.LoadConfig()
+	if err != nil {
+		return "", fmt.Errorf("failed to load config: %v", err)
+	}
+	if cfg.Email == "" {
+		return "", fmt.Errorf("no email account configured. Use --account flag or configure a default account")
+	}
+	return cfg.Email, nil
+}
+
+// runAttachmentsList lists or searches the attachment index using the shared flags
+func runAttachmentsList(cmd *cobra.Command, text string) error {
+	accountEmail, err := archiveAccount(cmd)
+	if err != nil {
+		return err
+	}
+	
+	query := mailos.AttachmentQuery{Text: text}
+	query.From, _ = cmd.Flags().GetString("from")
+	query.Type, _ = cmd.Flags().GetString("type")
+	query.Limit, _ = cmd.Flags().GetInt("number")
+	if since, _ := cmd.Flags().GetString("since"); since != "" {
+		query.Since, _, err = mailos.ParseDateRange(since)
+		if err != nil {
+			return fmt.Errorf("invalid --since value: %v", err)
+		}
+	}
+	
+	records, err := mailos.ListAttachments(accountEmail, query)
+	if err != nil {
+		return err
+	}
+	
+	if outputJSON, _ := cmd.Flags().GetBool("json"); outputJSON {
+		data, err := json.MarshalIndent(records, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	
+	fmt.Print(mailos.FormatAttachmentList(records))
+	return nil
+}
+
 var sentCmd = &cobra.Command{
 	Use:   "sent",
 	Short: "Read sent emails",
@@ -1462,6 +2043,42 @@ var sentCmd = &cobra.Command{
 		outputJSON, _ := cmd.Flags().GetBool("json")
 		saveMarkdown, _ := cmd.Flags().GetBool("save-markdown")
 		outputDir, _ := cmd.Flags().GetString("output-dir")
+		showStatus, _ := cmd.Flags().GetBool("status")
+		verify, _ := cmd.Flags().GetBool("verify")
+
+		if verify {
+			entries, err := mailos.VerifySentMessages("", limit)
+			if err != nil {
+				return fmt.Errorf("failed to verify sent emails: %v", err)
+			}
+			if outputJSON {
+				data, err := json.MarshalIndent(entries, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(data))
+				return nil
+			}
+			fmt.Print(mailos.FormatSendJournal(entries))
+			return nil
+		}
+
+		if showStatus {
+			statuses, err := mailos.GetDeliveryStatus("", limit)
+			if err != nil {
+				return fmt.Errorf("failed to load delivery status: %v", err)
+			}
+			if outputJSON {
+				data, err := json.MarshalIndent(statuses, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(data))
+				return nil
+			}
+			fmt.Print(mailos.FormatDeliveryStatus(statuses))
+			return nil
+		}
 
 		opts := mailos.SentOptions{
 			Limit:     limit,
@@ -1697,8 +2314,18 @@ Attachments are saved to the specified directory with timestamps to avoid confli
 }
 
 var searchCmd = &cobra.Command{
-	Use:   "search",
+	Use:   "search [query]",
 	Short: "Search and list emails",
+	Long: `Search and list emails, optionally with a query such as
+'from:billing has:attachment since:30d'.
+
+Terms are ANDed; OR, a leading - (or NOT) and parentheses combine them, and
+"quoted phrases" match exactly. Fields are from:, to:, cc:, subject:, body:,
+filename:, has:attachment, larger:/smaller: (10M), before:/after: (a date),
+older_than:/newer_than: (an age like 30d), is:unread|read|flagged and
+in:<folder or saved search>. See docs/search.md for the full grammar. --save keeps the
+query under a name; the name then works with --folder here and in stats and
+report, and saved searches are listed by 'mailos searches'.`,
 	PreRunE: func(cmd *cobra.Command, args []string) error {
 		return mailos.EnsureInitialized()
 	},
@@ -1725,6 +2352,28 @@ var searchCmd = &cobra.Command{
 		outputDir, _ := cmd.Flags().GetString("output-dir")
 		downloadAttach, _ := cmd.Flags().GetBool("download-attachments")
 		attachmentDir, _ := cmd.Flags().GetString("attachment-dir")
+		localOnly, _ := cmd.Flags().GetBool("local")
+		page, _ := cmd.Flags().GetInt("page")
+		if page < 1 {
+			return fmt.Errorf("--page must be 1 or more")
+		}
+		folder, _ := cmd.Flags().GetString("folder")
+		saveAs, _ := cmd.Flags().GetString("save")
+		query := strings.Join(args, " ")
+		q, err := mailos.ResolveQuery(query)
+		if err != nil {
+			if qerr, ok := err.(*mailos.QueryError); ok {
+				fmt.Println(qerr.Caret())
+			}
+			return fmt.Errorf("invalid search query: %v", err)
+		}
+		if saveAs != "" {
+			if err := mailos.SaveSearch(saveAs, query); err != nil {
+				return err
+			}
+			// Show what the new virtual folder holds
+			folder, query, q = saveAs, "", &mailos.Query{}
+		}
 
 
 		// client, err := NewClient()
@@ -1741,6 +2390,8 @@ var searchCmd = &cobra.Command{
 			Subject:        subject,
 			DownloadAttach: downloadAttach,
 			AttachmentDir:  attachmentDir,
+			LocalOnly:      localOnly,
+			Offset:         (page - 1) * limit,
 		}
 
 		// Handle time range parameter
@@ -1750,13 +2401,18 @@ var searchCmd = &cobra.Command{
 				return fmt.Errorf("invalid time range: %v", err)
 			}
 			opts.Since = selectedRange.Since
+			opts.Until = selectedRange.Until
 			// Also filter by Until time after fetching
 		} else if days > 0 {
 			opts.Since = time.Now().AddDate(0, 0, -days)
 		}
 
 		fmt.Println("Searching emails...")
-		emails, err := mailos.Read(opts)
+		if query != "" {
+			// The server, or the archive, runs as much of the query as it can
+			opts.Query = q
+		}
+		emails, err := mailos.ReadFolder(opts, folder)
 		if err != nil {
 			return fmt.Errorf("failed to search emails: %v", err)
 		}
@@ -1868,6 +2524,12 @@ var readCmd = &cobra.Command{
 		// Get id flag
 		idFlag, _ := cmd.Flags().GetUint32("id")
 		
+		// Get authentication flags
+		showAuth, _ := cmd.Flags().GetBool("auth")
+		if keyDir, _ := cmd.Flags().GetString("dkim-keys"); keyDir != "" {
+			mailos.SetDKIMKeyDir(keyDir)
+		}
+		
 		// Ensure authenticated before proceeding
 		cfg, err := mailos.EnsureAuthenticated(accountEmail)
 		if err != nil {
@@ -1921,10 +2583,22 @@ var readCmd = &cobra.Command{
 			fmt.Printf("Attachments: %s\n", strings.Join(targetEmail.Attachments, ", "))
 		}
 		
+		if showAuth {
+			fmt.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n")
+			fmt.Print(mailos.FormatAuthVerdict(targetEmail.Auth))
+		} else if targetEmail.Auth != nil && targetEmail.Auth.Suspicious {
+			fmt.Printf("⚠️  Suspicious: %s (see --auth)\n", targetEmail.Auth.Warnings[0])
+		}
+		
 		fmt.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n")
 		fmt.Printf("📄 CONTENT:\n")
 		fmt.Printf("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n\n")
-		fmt.Println(targetEmail.Body)
+		body := targetEmail.Body
+		if targetEmail.BodyHTML != "" && (body == "" || targetEmail.BodyFromHTML) {
+			// Render HTML-only messages to fit the terminal
+			body = mailos.HTMLToText(targetEmail.BodyHTML, mailos.HTMLTextOptions{Width: mailos.TerminalWidth()})
+		}
+		fmt.Println(body)
 		
 		// Parse and display attachment documents if flag is enabled
 		if includeDocuments && len(targetEmail.AttachmentData) > 0 {
@@ -1963,7 +2637,9 @@ Examples:
   mailos reply 2                    # Reply to email #2 interactively  
   mailos reply 2 --all              # Reply to all recipients of email #2
   mailos reply 2 --body "Thanks!"   # Reply with quick message
-  mailos reply 2 --draft            # Save reply as draft instead of sending`,
+  mailos reply 2 --draft            # Save reply as draft instead of sending
+  mailos reply 2 --posting bottom   # Write the reply below the quoted message
+  mailos reply 2 --ai "decline politely"  # Draft the reply with AI for review`,
 	Args:  cobra.ExactArgs(1),
 	PreRunE: func(cmd *cobra.Command, args []string) error {
 		return mailos.EnsureInitialized()
@@ -1985,6 +2661,9 @@ Examples:
 		to, _ := cmd.Flags().GetStringSlice("to")
 		cc, _ := cmd.Flags().GetStringSlice("cc")
 		bcc, _ := cmd.Flags().GetStringSlice("bcc")
+		noSignature, _ := cmd.Flags().GetBool("no-signature")
+		posting, _ := cmd.Flags().GetString("posting")
+		aiInstruction, _ := cmd.Flags().GetString("ai")
 
 		// Build reply options
 		opts := mailos.ReplyOptions{
@@ -1994,10 +2673,13 @@ Examples:
 			Subject:     subject,
 			FileBody:    fileBody,
 			Draft:       draft,
-			Interactive: interactive || (body == "" && fileBody == ""),
+			Interactive: interactive || (body == "" && fileBody == "" && aiInstruction == ""),
 			To:          to,
 			CC:          cc,
 			BCC:         bcc,
+			NoSignature: noSignature,
+			Posting:     posting,
+			AIInstruction: aiInstruction,
 		}
 
 		return mailos.ReplyCommand(opts)
@@ -2014,7 +2696,10 @@ Examples:
   mailos forward 2 --to user@example.com         # Forward email #2 to specific recipient
   mailos forward 2 --to user1@example.com,user2@example.com  # Forward to multiple recipients
   mailos forward 2 --body "FYI"                  # Forward with additional message
-  mailos forward 2 --draft                       # Save forward as draft instead of sending`,
+  mailos forward 2 --draft                       # Save forward as draft instead of sending
+  mailos forward 2 --to user@example.com --as-attachment   # Attach the original message (.eml)
+  mailos forward 2 --to user@example.com --no-attachments  # Leave the original's attachments out
+  mailos forward 2 --to user@example.com --html            # Include the original HTML body`,
 	Args:  cobra.ExactArgs(1),
 	PreRunE: func(cmd *cobra.Command, args []string) error {
 		return mailos.EnsureInitialized()
@@ -2035,18 +2720,26 @@ Examples:
 		to, _ := cmd.Flags().GetStringSlice("to")
 		cc, _ := cmd.Flags().GetStringSlice("cc")
 		bcc, _ := cmd.Flags().GetStringSlice("bcc")
+		asAttachment, _ := cmd.Flags().GetBool("as-attachment")
+		noAttachments, _ := cmd.Flags().GetBool("no-attachments")
+		includeHTML, _ := cmd.Flags().GetBool("html")
+		noSignature, _ := cmd.Flags().GetBool("no-signature")
 
 		// Build forward options
 		opts := mailos.ForwardOptions{
-			EmailNumber: emailNumber,
-			Body:        body,
-			Subject:     subject,
-			FileBody:    fileBody,
-			Draft:       draft,
-			Interactive: interactive || (body == "" && fileBody == ""),
-			To:          to,
-			CC:          cc,
-			BCC:         bcc,
+			EmailNumber:   emailNumber,
+			Body:          body,
+			Subject:       subject,
+			FileBody:      fileBody,
+			Draft:         draft,
+			Interactive:   interactive || (body == "" && fileBody == ""),
+			To:            to,
+			CC:            cc,
+			BCC:           bcc,
+			AsAttachment:  asAttachment,
+			NoAttachments: noAttachments,
+			IncludeHTML:   includeHTML,
+			NoSignature:   noSignature,
 		}
 
 		return mailos.ForwardCommand(opts)
@@ -2645,12 +3338,6 @@ var reportCmd = &cobra.Command{
 		timeRange, _ := cmd.Flags().GetString("range")
 		outputFile, _ := cmd.Flags().GetString("output")
 		
-		// client, err := NewClient()
-		// if err != nil {
-		//	return err
-		// }
-		return fmt.Errorf("client functionality temporarily disabled")
-		
 		var selectedRange *mailos.TimeRange
 		var err error
 		
@@ -2669,31 +3356,27 @@ var reportCmd = &cobra.Command{
 		}
 		
 		fmt.Printf("Generating report for: %s\n", selectedRange.Name)
-		fmt.Printf("Fetching emails from %s to %s...\n", 
+		fmt.Printf("Reading archived emails from %s to %s...\n", 
 			selectedRange.Since.Format("Jan 2, 3:04 PM"),
 			selectedRange.Until.Format("Jan 2, 3:04 PM"))
 		
-		// Fetch emails for the selected time range
-		opts := mailos.ReadOptions{
-			Since: selectedRange.Since,
-			Limit: 1000, // Get up to 1000 emails for the report
+		cfg, err := mailos.LoadConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %v", err)
 		}
 		
-		emails, err := mailos.Read(opts)
+		// The range is selected in the local archive, which 'mailos sync' keeps up to date
+		folder, _ := cmd.Flags().GetString("folder")
+		emails, err := mailos.GetFolderEmails(cfg.Email, folder, mailos.ReadOptions{
+			Since: selectedRange.Since,
+			Until: selectedRange.Until,
+		})
 		if err != nil {
 			return fmt.Errorf("failed to read emails: %v", err)
 		}
 		
-		// Filter emails that are within the Until time if specified
-		var filteredEmails []*mailos.Email
-		for _, email := range emails {
-			if email.Date.After(selectedRange.Since) && email.Date.Before(selectedRange.Until.Add(time.Second)) {
-				filteredEmails = append(filteredEmails, email)
-			}
-		}
-		
 		// Generate the report
-		report := mailos.GenerateEmailReport(filteredEmails, *selectedRange)
+		report := mailos.GenerateEmailReport(emails, *selectedRange)
 		
 		// Output to file if specified, otherwise to stdout
 		if outputFile != "" {
@@ -2709,6 +3392,73 @@ var reportCmd = &cobra.Command{
 	},
 }
 
+var digestCmd = &cobra.Command{
+	Use:   "digest",
+	Short: "Summarise a period's email with AI: what needs action, replies, FYIs and newsletters",
+	Long: `Send the period's messages from the local archive to the configured AI backend
+and print a digest of action-required items, threads awaiting your reply, FYIs
+and newsletters. Each item lists the Message-IDs it covers.
+
+Messages are sent in chunks that fit ai.max_context_tokens. Run 'mailos sync'
+first for the latest mail, e.g. from cron:
+
+  0 7 * * * mailos sync && mailos digest --range yesterday --send`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return mailos.EnsureInitialized()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		accountEmail, _ := cmd.Flags().GetString("account")
+		timeRange, _ := cmd.Flags().GetString("range")
+		format, _ := cmd.Flags().GetString("format")
+		outputFile, _ := cmd.Flags().GetString("output")
+		send, _ := cmd.Flags().GetBool("send")
+
+		if format != "markdown" && format != "json" {
+			return fmt.Errorf("unknown format %q (use markdown or json)", format)
+		}
+
+		digest, err := mailos.CreateDigest(mailos.DigestOptions{
+			AccountEmail: accountEmail,
+			Range:        timeRange,
+			Progress:     os.Stderr,
+		})
+		if err != nil {
+			return err
+		}
+
+		if send {
+			if err := mailos.SendDigest(accountEmail, digest); err != nil {
+				return fmt.Errorf("failed to send digest: %v", err)
+			}
+			fmt.Fprintln(os.Stderr, "✓ Digest sent to your inbox")
+			if outputFile == "" {
+				return nil
+			}
+		}
+
+		var output string
+		if format == "json" {
+			data, err := json.MarshalIndent(digest, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode digest: %v", err)
+			}
+			output = string(data) + "\n"
+		} else {
+			output = mailos.FormatDigestMarkdown(digest)
+		}
+
+		if outputFile != "" {
+			if err := os.WriteFile(outputFile, []byte(output), 0644); err != nil {
+				return fmt.Errorf("failed to write digest to file: %v", err)
+			}
+			fmt.Fprintf(os.Stderr, "✓ Digest saved to %s\n", outputFile)
+			return nil
+		}
+		fmt.Print(output)
+		return nil
+	},
+}
+
 var openCmd = &cobra.Command{
 	Use:   "open",
 	Short: "Open an email in your default mail application",
@@ -2776,8 +3526,12 @@ var openCmd = &cobra.Command{
 }
 
 var statsCmd = &cobra.Command{
-	Use:   "stats",
+	Use:   "stats [query]",
 	Short: "Show email statistics and analytics",
+	Long: `Show statistics for the emails in the local archive.
+
+Arguments like days=30 or top=5 set options; anything else is a search query,
+with the same grammar as 'mailos search', that the counted emails have to match.`,
 	PreRunE: func(cmd *cobra.Command, args []string) error {
 		return mailos.EnsureInitialized()
 	},
@@ -2794,9 +3548,14 @@ var statsCmd = &cobra.Command{
 		query.Subject, _ = cmd.Flags().GetString("subject")
 		query.Days, _ = cmd.Flags().GetInt("days")
 		query.TimeRange, _ = cmd.Flags().GetString("range")
+		folder, _ := cmd.Flags().GetString("folder")
 		
 		// Parse additional arguments as query parameters
 		if err := query.ParseArgs(args); err != nil {
+			if qerr, ok := err.(*mailos.QueryError); ok {
+				fmt.Println(qerr.Caret())
+				return fmt.Errorf("invalid search query: %v", err)
+			}
 			return fmt.Errorf("STATS_QUERY_PARSE_ERROR: Failed to parse stats query arguments '%v'. Common issues: (1) Invalid date format, (2) Malformed time range, (3) Invalid account specification. Use format like 'today', 'last week', or '2024-01-01 to 2024-01-31'. Original error: %v", args, err)
 		}
 		
@@ -2810,42 +3569,27 @@ var statsCmd = &cobra.Command{
 			query.Since = time.Now().AddDate(0, 0, -query.Days)
 		}
 		
-		// client, err := NewClient()
-		// if err != nil {
-		//	return err
-		// }
-		// return fmt.Errorf("client functionality temporarily disabled")
-		
-		fmt.Println("Fetching emails for analysis...")
-		
-		// Read emails using query options
-		emails, err := mailos.Read(query.ToReadOptions())
-		if err != nil {
-			return fmt.Errorf("STATS_EMAIL_FETCH_ERROR: Failed to retrieve emails for statistical analysis. This could be due to: (1) IMAP server connection issues, (2) Authentication problems, (3) Missing email configuration, (4) Local storage access errors. Applied filters: from='%s', to='%s', subject='%s', days=%d, range='%s'. Original error: %v", 
-				query.FromAddress, query.ToAddress, query.Subject, query.Days, query.TimeRange, err)
-		}
-		
-		// Filter by Until time if needed
-		emails = query.FilterEmails(emails)
-		
 		// Get account email for stats
 		cfg, err := mailos.LoadConfig()
 		if err != nil {
 			return fmt.Errorf("STATS_CONFIG_ERROR: Failed to load email configuration needed for statistics generation. Ensure you have run 'mailos setup' to configure your email account. Original error: %v", err)
 		}
 		
-		// Generate statistics
+		// Count in the local archive, which 'mailos sync' keeps up to date
 		statsOpts := mailos.StatsOptions{
 			AccountEmail: cfg.Email,
 			Since:        query.Since,
 			Until:        query.Until,
 			TopN:         10,
+			Filter:       query.ToReadOptions(),
+			Folder:       folder,
+			Query:        query.Query,
 		}
 		
 		stats, err := mailos.GenerateEmailStats(statsOpts)
 		if err != nil {
-			return fmt.Errorf("STATS_GENERATION_ERROR: Failed to generate email statistics from %d emails for account '%s' (date range: %v to %v). This could be due to: (1) Email data processing errors, (2) Invalid date ranges, (3) Database access issues, (4) Email parsing problems. Original error: %v", 
-				len(emails), cfg.Email, 
+			return fmt.Errorf("STATS_GENERATION_ERROR: Failed to generate email statistics from the local archive for account '%s' (date range: %v to %v). This could be due to: (1) Email data processing errors, (2) Invalid date ranges, (3) Database access issues, (4) Email parsing problems. Original error: %v", 
+				cfg.Email, 
 				func() interface{} { if query.Since.IsZero() { return "beginning" } else { return query.Since.Format("2006-01-02") } }(),
 				func() interface{} { if query.Until.IsZero() { return "now" } else { return query.Until.Format("2006-01-02") } }(), 
 				err)
@@ -2867,6 +3611,42 @@ var statsCmd = &cobra.Command{
 	},
 }
 
+var tuiCmd = &cobra.Command{
+	Use:   "tui",
+	Short: "Full-screen mail client with folders, message list and preview",
+	Long: `Open a three-pane terminal mail client.
+
+Keys: ↑/↓ or j/k move, Tab switches pane, Enter opens, / filters as you type,
+r replies, f forwards, d deletes, a archives, m marks read, A switches account,
+g refreshes and q quits.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return mailos.EnsureInitialized()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		accountEmail, _ := cmd.Flags().GetString("account")
+		limit, _ := cmd.Flags().GetInt("number")
+		return mailos.RunTUI(accountEmail, limit)
+	},
+}
+
+var chatCmd = &cobra.Command{
+	Use:   "chat",
+	Short: "Chat with your mailbox; the AI can search, read, draft, label and move mail",
+	Long: `Start interactive mode, where slash commands run mailos commands and
+anything else goes to the AI.
+
+With an http AI backend (see 'mailos configure'), the AI works the mailbox
+itself through built-in tools: search, read, draft, label, move, send and
+delete. Sending and deleting always ask you first. Each session is logged to
+~/.email/<account>/transcripts/. Other backends answer through the AI CLI.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		return mailos.EnsureInitialized()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return mailos.InteractiveMode()
+	},
+}
+
 var docsCmd = &cobra.Command{
 	Use:   "docs",
 	Short: "Generate or update EMAILOS.md documentation for AI CLI",
@@ -3097,8 +3877,13 @@ func init() {
 	statsCmd.Flags().String("subject", "", "Filter by subject")
 	statsCmd.Flags().Int("days", 0, "Analyze emails from last N days")
 	statsCmd.Flags().String("range", "", "Time range (e.g., 'Last hour', 'Today', 'Yesterday', 'This week')")
+	statsCmd.Flags().String("folder", "", "Archived folder or saved search to analyze (default INBOX)")
 	statsCmd.Args = cobra.ArbitraryArgs // Allow additional query parameters
 	
+	// TUI command flags
+	tuiCmd.Flags().String("account", "", "Account to open")
+	tuiCmd.Flags().IntP("number", "n", 50, "Number of messages to load per folder")
+	
 	// Drafts command flags
 	// Draft reading/listing flags
 	draftsCmd.Flags().BoolP("list", "l", false, "List drafts from IMAP Drafts folder")
@@ -3162,7 +3947,9 @@ func init() {
 	sendCmd.Flags().String("from", "", "Send from specific email account (account nickname or email)")
 	sendCmd.Flags().Bool("preview", false, "Preview the complete email without sending")
 	sendCmd.Flags().Bool("template", false, "Apply HTML template to email")
+	sendCmd.Flags().Bool("embed-remote-images", false, "Download remote images and send them inline (cid:) instead of linking")
 	sendCmd.Flags().BoolP("verbose", "v", false, "Show detailed SMTP debugging information")
+	sendCmd.Flags().String("remind-if-no-reply", "", "List in 'mailos followups' if nobody replies within this long (e.g. 3d, 1w)")
 	
 	// Send --drafts specific flags
 	sendCmd.Flags().Bool("drafts", false, "Send all draft emails from .email/drafts folder")
@@ -3189,11 +3976,18 @@ func init() {
 	syncCmd.Flags().Int("days", 0, "Sync emails from last N days (0 for all)")
 	syncCmd.Flags().Bool("include-read", false, "Include already read emails")
 	syncCmd.Flags().BoolP("verbose", "v", false, "Show detailed progress")
+	syncCmd.Flags().Duration("watch", 0, "Keep syncing at this interval (e.g. 5m), returning snoozed messages and checking follow-ups")
 
 	// Sync-db command flags
 	syncDbCmd.Flags().String("account", "", "Specific account email to sync (defaults to configured account)")
 	syncDbCmd.Flags().Bool("all", false, "Sync all configured accounts to database")
 
+	// SQL command flags
+	sqlCmd.Flags().String("account", "", "Account to query (defaults to configured account)")
+	sqlCmd.Flags().Bool("json", false, "Output rows as JSON")
+	searchesCmd.Flags().String("account", "", "Account to count matches in (defaults to configured account)")
+	searchesCmd.Flags().String("delete", "", "Delete the saved search with this name")
+
 	// Sent command flags
 	sentCmd.Flags().IntP("number", "n", 10, "Number of sent emails to read")
 	sentCmd.Flags().String("to", "", "Filter by recipient")
@@ -3203,6 +3997,8 @@ func init() {
 	sentCmd.Flags().Bool("json", false, "Output as JSON")
 	sentCmd.Flags().Bool("save-markdown", true, "Save emails as markdown files")
 	sentCmd.Flags().String("output-dir", ".email/sent", "Directory to save markdown files")
+	sentCmd.Flags().Bool("status", false, "Show per-recipient delivery status from delivery reports")
+	sentCmd.Flags().Bool("verify", false, "Look up recently sent emails in the Sent folder by Message-ID")
 
 
 	// Search command flags (enhanced with advanced search capabilities)
@@ -3215,9 +4011,13 @@ func init() {
 	searchCmd.Flags().String("range", "", "Time range (e.g., 'Last hour', 'Today', 'Yesterday', 'This week')")
 	searchCmd.Flags().Bool("json", false, "Output as JSON")
 	searchCmd.Flags().Bool("save-markdown", false, "Save emails as markdown files")
+	searchCmd.Flags().String("save", "", "Save the query as a search with this name")
+	searchCmd.Flags().String("folder", "", "Folder or saved search to list (default INBOX)")
 	searchCmd.Flags().String("output-dir", "emails", "Directory to save markdown files")
 	searchCmd.Flags().Bool("download-attachments", false, "Download email attachments")
 	searchCmd.Flags().String("attachment-dir", "attachments", "Directory to save attachments")
+	searchCmd.Flags().Bool("local", false, "Search the local archive instead of the server")
+	searchCmd.Flags().Int("page", 1, "Page of results to show, --number per page")
 	
 	// Advanced search flags
 	searchCmd.Flags().StringP("query", "q", "", "Complex search query with boolean operators (AND, OR, NOT)")
@@ -3233,6 +4033,21 @@ func init() {
 	// Read command flags (for displaying full email content)
 	readCmd.Flags().Bool("include-documents", true, "Parse and display attachment document content inline")
 	readCmd.Flags().Uint32("id", 0, "Email ID to read (alternative to positional argument)")
+	// Status command flags
+	statusCmd.Flags().String("account", "", "Account to show (defaults to configured account)")
+	statusCmd.Flags().Bool("replay", false, "Replay queued operations now")
+	statusCmd.Flags().Int64("discard", 0, "Remove a queued operation or reviewed conflict by number")
+	statusCmd.Flags().Bool("json", false, "Output as JSON")
+	snoozeCmd.Flags().String("account", "", "Account to use (defaults to configured account)")
+	snoozeCmd.Flags().String("until", "", "When the messages return to INBOX (e.g. \"monday 9am\", tomorrow, 3d)")
+	snoozeCmd.Flags().Bool("list", false, "List snoozed messages")
+	followupsCmd.Flags().String("account", "", "Account to use (defaults to configured account)")
+	followupsCmd.Flags().Bool("all", false, "Also list follow-ups that got a reply")
+	followupsCmd.Flags().Int64("dismiss", 0, "Stop tracking a follow-up by number")
+	followupsCmd.Flags().Bool("json", false, "Output as JSON")
+
+	readCmd.Flags().Bool("auth", false, "Show SPF, DKIM and DMARC results and phishing warnings")
+	readCmd.Flags().String("dkim-keys", "", "Directory of DKIM key records for offline verification (default ~/.email/dkim-keys)")
 
 	// Reply command flags
 	replyCmd.Flags().Bool("all", false, "Reply to all recipients")
@@ -3244,6 +4059,9 @@ func init() {
 	replyCmd.Flags().StringSlice("to", nil, "Override recipients")
 	replyCmd.Flags().StringSlice("cc", nil, "CC recipients")
 	replyCmd.Flags().StringSlice("bcc", nil, "BCC recipients")
+	replyCmd.Flags().BoolP("no-signature", "S", false, "Don't add signature")
+	replyCmd.Flags().String("posting", "", "Reply above (top) or below (bottom) the quote; defaults to the account setting")
+	replyCmd.Flags().String("ai", "", "Draft the reply with AI following this instruction; saved as a draft, never sent")
 
 	// Forward command flags
 	forwardCmd.Flags().String("body", "", "Forward body text")
@@ -3254,6 +4072,10 @@ func init() {
 	forwardCmd.Flags().StringSlice("to", nil, "Recipients")
 	forwardCmd.Flags().StringSlice("cc", nil, "CC recipients")
 	forwardCmd.Flags().StringSlice("bcc", nil, "BCC recipients")
+	forwardCmd.Flags().Bool("as-attachment", false, "Attach the original message as message/rfc822 instead of quoting it")
+	forwardCmd.Flags().Bool("no-attachments", false, "Don't include the original's attachments")
+	forwardCmd.Flags().Bool("html", false, "Include the original HTML body, not just the text")
+	forwardCmd.Flags().BoolP("no-signature", "S", false, "Don't add signature")
 
 	// Mark read command flags
 	markReadCmd.Flags().UintSlice("ids", nil, "Email IDs to mark as read")
@@ -3300,10 +4122,23 @@ func init() {
 	configureCmd.Flags().String("name", "", "Display name for emails")
 	configureCmd.Flags().String("from", "", "From email address (appears as sender)")
 	configureCmd.Flags().String("ai", "", "AI CLI provider (claude-code, claude-code-yolo, openai, gemini, opencode, none)")
+	configureCmd.AddCommand(configShowCmd)
+	configShowCmd.Flags().Bool("explain", false, "Show where each value comes from")
+	configShowCmd.Flags().Bool("json", false, "Output as JSON")
+	configureCmd.AddCommand(configValidateCmd)
+	configValidateCmd.Flags().Bool("json", false, "Output as JSON")
+	configValidateCmd.Flags().Bool("schema", false, "Print the JSON Schema for config.json")
+	rootCmd.PersistentFlags().StringArray("set", nil, "Override a config value for this run (key=value, repeatable)")
 	
 	// Report command flags
 	reportCmd.Flags().String("range", "", "Time range (e.g., 'Last hour', 'Today', 'Yesterday', 'This week')")
 	reportCmd.Flags().String("output", "", "Output file path (optional)")
+	reportCmd.Flags().String("folder", "", "Archived folder or saved search to report on (default INBOX)")
+	digestCmd.Flags().String("account", "", "Account to summarise (defaults to configured account)")
+	digestCmd.Flags().String("range", "today", "Time range (e.g., 'Today', 'Yesterday', 'This week')")
+	digestCmd.Flags().String("format", "markdown", "Output format: markdown or json")
+	digestCmd.Flags().String("output", "", "Write the digest to a file")
+	digestCmd.Flags().Bool("send", false, "Email the digest to yourself instead of printing it")
 	
 	// Interactive command flags
 	
@@ -3332,6 +4167,35 @@ func init() {
 	downloadCmd.Flags().String("output-dir", "attachments", "Directory to save attachments")
 	downloadCmd.Flags().Bool("show-content", false, "Show email content preview")
 
+	// Attachments command and subcommands
+	attachmentsCmd.AddCommand(attachmentsListCmd)
+	attachmentsCmd.AddCommand(attachmentsSearchCmd)
+	attachmentsCmd.AddCommand(attachmentsSaveCmd)
+	attachmentsCmd.PersistentFlags().String("account", "", "Account archive to use (defaults to configured account)")
+	for _, c := range []*cobra.Command{attachmentsCmd, attachmentsListCmd, attachmentsSearchCmd} {
+		c.Flags().String("from", "", "Filter by sender")
+		c.Flags().String("type", "", "Filter by type: extension (pdf), MIME type or major type (image)")
+		c.Flags().String("since", "", "Only messages since a date or range (e.g. 2024-01-01, 'last 30 days')")
+		c.Flags().IntP("number", "n", 50, "Maximum number of attachments to show")
+		c.Flags().Bool("json", false, "Output as JSON")
+	}
+	attachmentsSaveCmd.Flags().String("to", ".", "Directory to save the attachment in")
+
+	// Signature command and subcommands
+	signatureCmd.AddCommand(signatureListCmd)
+	signatureCmd.AddCommand(signatureAddCmd)
+	signatureCmd.AddCommand(signatureEditCmd)
+	signatureCmd.AddCommand(signatureUseCmd)
+	signatureCmd.PersistentFlags().String("account", "", "Account whose signatures to manage (defaults to current account)")
+	signatureAddCmd.Flags().StringP("file", "f", "", "Read the signature's markdown from a file")
+	signatureAddCmd.Flags().String("body", "", "Signature markdown")
+	signatureAddCmd.Flags().Bool("default", false, "Also use it by default")
+
+	// Privacy command and subcommands
+	privacyCmd.AddCommand(privacyReportCmd)
+	privacyReportCmd.Flags().String("account", "", "Account to report on (defaults to current account)")
+	privacyReportCmd.Flags().Bool("json", false, "Output as JSON")
+
 	// Add draft subcommands
 	draftCmd.AddCommand(draftListCmd)
 	draftCmd.AddCommand(draftEditCmd)
@@ -3434,6 +4298,11 @@ func init() {
 	rootCmd.AddCommand(configureCmd)
 	rootCmd.AddCommand(accountsCmd)
 	rootCmd.AddCommand(templateCmd)
+	rootCmd.AddCommand(signatureCmd)
+	rootCmd.AddCommand(privacyCmd)
+	rootCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(snoozeCmd)
+	rootCmd.AddCommand(followupsCmd)
 	rootCmd.AddCommand(draftCmd)
 	rootCmd.AddCommand(draftsCmd)
 	rootCmd.AddCommand(composeCmd)
@@ -3441,6 +4310,8 @@ func init() {
 	rootCmd.AddCommand(groupsCmd)
 	rootCmd.AddCommand(syncCmd)
 	rootCmd.AddCommand(syncDbCmd)
+	rootCmd.AddCommand(sqlCmd)
+	rootCmd.AddCommand(searchesCmd)
 	rootCmd.AddCommand(sentCmd)
 	rootCmd.AddCommand(searchCmd)
 	rootCmd.AddCommand(readCmd)
@@ -3448,7 +4319,11 @@ func init() {
 	rootCmd.AddCommand(forwardCmd)
 	rootCmd.AddCommand(downloadCmd)
 	rootCmd.AddCommand(statsCmd)
+	rootCmd.AddCommand(attachmentsCmd)
+	rootCmd.AddCommand(tuiCmd)
+	rootCmd.AddCommand(chatCmd)
 	rootCmd.AddCommand(reportCmd)
+	rootCmd.AddCommand(digestCmd)
 	rootCmd.AddCommand(markReadCmd)
 	rootCmd.AddCommand(deleteCmd)
 	rootCmd.AddCommand(openCmd)
@@ -16,40 +16,43 @@ import (
 var APP_SITE = AppSite // Using constant from constants.go
 
 type Config struct {
-	Provider          string          `json:"provider"`
-	Email             string          `json:"email"`
-	Password          string          `json:"password"`
-	FromName          string          `json:"from_name,omitempty"`
-	FromEmail         string          `json:"from_email,omitempty"`
-	ProfileImage      string          `json:"profile_image,omitempty"`
-	LicenseKey        string          `json:"license_key,omitempty"`
-	DefaultAICLI      string          `json:"default_ai_cli,omitempty"`
-	LastSyncTime      string          `json:"last_sync_time,omitempty"`
-	AutoSync          bool            `json:"auto_sync,omitempty"`
-	SyncDir           string          `json:"sync_dir,omitempty"`
-	LocalStorageDir   string          `json:"local_storage_dir,omitempty"`
-	SignatureOverride string          `json:"signature_override,omitempty"`
-	Accounts          []AccountConfig `json:"accounts,omitempty"`
-	ActiveAccount     string          `json:"active_account,omitempty"`
-	Debug             bool            `json:"debug,omitempty"`
+	SchemaVersion     int              `json:"schema_version,omitempty"`
+	Provider          string           `json:"provider"`
+	Email             string           `json:"email"`
+	Password          string           `json:"password"`
+	FromName          string           `json:"from_name,omitempty"`
+	FromEmail         string           `json:"from_email,omitempty"`
+	ProfileImage      string           `json:"profile_image,omitempty"`
+	LicenseKey        string           `json:"license_key,omitempty"`
+	DefaultAICLI      string           `json:"default_ai_cli,omitempty"`
+	LastSyncTime      string           `json:"last_sync_time,omitempty"`
+	AutoSync          bool             `json:"auto_sync,omitempty"`
+	SyncDir           string           `json:"sync_dir,omitempty"`
+	LocalStorageDir   string           `json:"local_storage_dir,omitempty"`
+	SignatureOverride string           `json:"signature_override,omitempty"`
+	Accounts          []AccountConfig  `json:"accounts,omitempty"`
+	ActiveAccount     string           `json:"active_account,omitempty"`
+	Debug             bool             `json:"debug,omitempty"`
+	SendLimits        *SendLimits      `json:"send_limits,omitempty"`
+	DefaultSignature  string           `json:"default_signature,omitempty"`
+	Reply             *ReplySettings   `json:"reply,omitempty"`
+	Privacy           *PrivacySettings `json:"privacy,omitempty"`
+	AI                *AISettings      `json:"ai,omitempty"`
 }
 
-type AccountConfig struct {
-	Email        string `json:"email"`
-	Provider     string `json:"provider"`
-	Password     string `json:"password"`
-	FromName     string `json:"from_name,omitempty"`
-	FromEmail    string `json:"from_email,omitempty"`
-	ProfileImage string `json:"profile_image,omitempty"`
-	Label        string `json:"label,omitempty"`
-	Signature    string `json:"signature,omitempty"`
-}
 
-// LegacyConfig represents the old config format
-type LegacyConfig struct {
-	EmailProvider string `json:"emailProvider"`
-	AppPassword   string `json:"appPassword"`
-	FromEmail     string `json:"fromEmail"`
+type AccountConfig struct {
+	Email            string         `json:"email"`
+	Provider         string         `json:"provider"`
+	Password         string         `json:"password"`
+	FromName         string         `json:"from_name,omitempty"`
+	FromEmail        string         `json:"from_email,omitempty"`
+	ProfileImage     string         `json:"profile_image,omitempty"`
+	Label            string         `json:"label,omitempty"`
+	Signature        string         `json:"signature,omitempty"`
+	SendLimits       *SendLimits    `json:"send_limits,omitempty"`
+	DefaultSignature string         `json:"default_signature,omitempty"`
+	Reply            *ReplySettings `json:"reply,omitempty"`
 }
 
 // IsDebugMode returns true if debug mode is enabled via environment variable or config
@@ -92,6 +95,14 @@ func GetConfigPath() (string, error) {
 	return filepath.Join(homeDir, ".email", "config.json"), nil
 }
 
+// sessionAccount overrides the configured account for the rest of the process
+var sessionAccount string
+
+// SetSessionAccount makes LoadConfig return the given account until cleared with ""
+func SetSessionAccount(accountEmail string) {
+	sessionAccount = accountEmail
+}
+
 func LoadConfig() (*Config, error) {
 	// Ensure email directories exist when loading config
 	if err := EnsureEmailDirectories(); err != nil {
@@ -99,86 +110,33 @@ func LoadConfig() (*Config, error) {
 		fmt.Printf("Note: Could not create email directories: %v\n", err)
 	}
 
-	// First check for local config
-	localConfig := filepath.Join(".email", "config.json")
-	if _, err := os.Stat(localConfig); err == nil {
-		// Local config exists, load it with inheritance from global
-		return LoadConfigWithInheritance()
+	// An account chosen for this session (e.g. in the TUI) wins over the files
+	if sessionAccount != "" {
+		return LoadAccountConfig(sessionAccount)
 	}
 
-	// No local config, load global config only
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return nil, err
-	}
-	globalConfigPath := filepath.Join(homeDir, ".email", "config.json")
-	return loadConfigFromPath(globalConfigPath)
+	return LoadConfigWithInheritance()
 }
 
-// LoadConfigWithInheritance loads local config and inherits missing fields from global
+// LoadConfigWithInheritance loads the config from every layer, so the local
+// config, MAILOS_* variables and --set flags override the global config field
+// by field. See ResolveConfig.
 func LoadConfigWithInheritance() (*Config, error) {
-	// Load local config
-	localConfigPath := filepath.Join(".email", "config.json")
-	localConfig, _ := loadConfigFromPath(localConfigPath) // Ignore error, might just be partial config
-
-	// If local config is nil or invalid, try to load global
-	if localConfig == nil || localConfig.Provider == "" {
-		// Create a new config to populate
-		if localConfig == nil {
-			localConfig = &Config{}
-		}
-
-		// Load global config
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			return nil, fmt.Errorf("failed to get home directory: %v", err)
-		}
-		globalConfigPath := filepath.Join(homeDir, ".email", "config.json")
-		globalConfig, _ := loadConfigFromPath(globalConfigPath) // Ignore error, might not exist
-
-		if globalConfig == nil {
-			return nil, fmt.Errorf("no valid configuration found")
-		}
-
-		// Copy all fields from global
-		*localConfig = *globalConfig
-
-		// Now reload the local config to get any local overrides
-		localData, err := os.ReadFile(localConfigPath)
-		if err == nil {
-			var localOverrides Config
-			if json.Unmarshal(localData, &localOverrides) == nil {
-				// Apply local overrides
-				if localOverrides.FromEmail != "" {
-					localConfig.FromEmail = localOverrides.FromEmail
-				}
-				if localOverrides.FromName != "" {
-					localConfig.FromName = localOverrides.FromName
-				}
-				if localOverrides.ProfileImage != "" {
-					localConfig.ProfileImage = localOverrides.ProfileImage
-				}
-				if localOverrides.DefaultAICLI != "" {
-					localConfig.DefaultAICLI = localOverrides.DefaultAICLI
-				}
-				if localOverrides.SignatureOverride != "" {
-					localConfig.SignatureOverride = localOverrides.SignatureOverride
-				}
-			}
-		}
+	resolved, err := ResolveConfig()
+	if err != nil {
+		return nil, err
 	}
-
-	return localConfig, nil
+	return resolved.Config, nil
 }
 
 // loadConfigFromPath loads config from a specific path
 func loadConfigFromPath(configPath string) (*Config, error) {
-	data, err := os.ReadFile(configPath)
+	// Older formats are upgraded by the config migrations
+	data, err := loadVersionedFile(configPath, configSchemaFile)
 	if err != nil {
 		return nil, err
 	}
 
-	// Try to unmarshal as new format first
 	var config Config
 	if err := json.Unmarshal(data, &config); err == nil {
 		// Config is valid if it has at least one field set
@@ -187,24 +145,6 @@ func loadConfigFromPath(configPath string) (*Config, error) {
 		}
 	}
 
-	// Try legacy format
-	var legacy LegacyConfig
-	if err := json.Unmarshal(data, &legacy); err == nil && legacy.EmailProvider != "" {
-		// Convert legacy format to new format
-		provider := "gmail" // Default to gmail
-		if legacy.EmailProvider == "fastgmail" {
-			provider = "gmail"
-		}
-
-		config = Config{
-			Provider: provider,
-			Email:    legacy.FromEmail,
-			Password: legacy.AppPassword,
-			FromName: "", // Can be derived from email
-		}
-		return &config, nil
-	}
-
 	// If we get here, the file doesn't match any known format
 	return nil, fmt.Errorf("invalid config format")
 }
@@ -221,6 +161,20 @@ func SaveConfig(config *Config) error {
 		return err
 	}
 
+	// Keep values from other layers, such as an API key from the
+	// environment, out of the file
+	if lastResolved != nil && lastResolved.Config == config {
+		layer := LayerGlobal
+		absPath, _ := filepath.Abs(configPath)
+		if globalPath, err := globalConfigPath(); err == nil && absPath != globalPath {
+			layer = LayerLocal
+		}
+		if config, err = lastResolved.forFile(config, layer); err != nil {
+			return err
+		}
+	}
+	config.SchemaVersion = ConfigSchemaVersion
+
 	// Marshal config with indentation
 	data, err := json.MarshalIndent(config, "", "  ")
 	if err != nil {
@@ -310,6 +264,8 @@ func SaveConfigToPath(config *Config, configPath string) error {
 		return err
 	}
 
+	config.SchemaVersion = ConfigSchemaVersion
+
 	// If creating a local .email folder, add it to .gitignore
 	if strings.HasPrefix(configPath, ".email/") || strings.HasPrefix(configPath, "./.email/") {
 		if err := EnsureGitIgnore(); err != nil {
@@ -388,13 +344,15 @@ func GetAllAccounts(config *Config) []AccountConfig {
 	// Add main account as provider main account
 	if globalConfig.Email != "" {
 		mainAcc := AccountConfig{
-			Email:        globalConfig.Email,
-			Provider:     globalConfig.Provider,
-			Password:     globalConfig.Password,
-			FromName:     globalConfig.FromName,
-			FromEmail:    globalConfig.FromEmail,
-			ProfileImage: globalConfig.ProfileImage,
-			Label:        "Primary",
+			Email:            globalConfig.Email,
+			Provider:         globalConfig.Provider,
+			Password:         globalConfig.Password,
+			FromName:         globalConfig.FromName,
+			FromEmail:        globalConfig.FromEmail,
+			ProfileImage:     globalConfig.ProfileImage,
+			Label:            "Primary",
+			Signature:        globalConfig.SignatureOverride,
+			DefaultSignature: globalConfig.DefaultSignature,
 		}
 		providerGroups[globalConfig.Provider] = append(providerGroups[globalConfig.Provider], mainAcc)
 		accountMap[globalConfig.Email] = mainAcc
@@ -512,17 +470,12 @@ func LoadAccountConfig(accountEmail string) (*Config, error) {
 		return config, nil
 	}
 
-	// Load home directory config
-	homeDir, err := os.UserHomeDir()
+	// Load the config from every layer, so overrides apply to each account
+	resolved, err := ResolveConfig()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get home directory: %v", err)
-	}
-
-	globalConfigPath := filepath.Join(homeDir, ".email", "config.json")
-	globalConfig, err := loadConfigFromPath(globalConfigPath)
-	if err != nil || globalConfig == nil {
 		return nil, fmt.Errorf("failed to load configuration from home directory: %v", err)
 	}
+	globalConfig := resolved.Config
 
 	// Get all accounts
 	accounts := GetAllAccounts(globalConfig)
@@ -543,6 +496,11 @@ func LoadAccountConfig(accountEmail string) (*Config, error) {
 				DefaultAICLI:      globalConfig.DefaultAICLI,
 				ActiveAccount:     acc.Email,
 				Accounts:          globalConfig.Accounts,
+				SendLimits:        acc.SendLimits,
+				DefaultSignature:  acc.DefaultSignature,
+				Reply:             acc.Reply,
+				Privacy:           globalConfig.Privacy,
+				AI:                globalConfig.AI,
 			}
 
 			// If account doesn't have all fields, inherit from global config
@@ -552,6 +510,12 @@ func LoadAccountConfig(accountEmail string) (*Config, error) {
 			if config.Password == "" {
 				config.Password = globalConfig.Password
 			}
+			if config.SendLimits == nil {
+				config.SendLimits = globalConfig.SendLimits
+			}
+			if config.Reply == nil {
+				config.Reply = globalConfig.Reply
+			}
 			if config.FromEmail == "" {
 				config.FromEmail = acc.Email
 			}
@@ -590,6 +554,11 @@ func LoadAccountConfig(accountEmail string) (*Config, error) {
 					DefaultAICLI:      globalConfig.DefaultAICLI,
 					ActiveAccount:     accountEmail,
 					Accounts:          globalConfig.Accounts,
+					SendLimits:        acc.SendLimits,
+					DefaultSignature:  acc.DefaultSignature,
+					Reply:             acc.Reply,
+					Privacy:           globalConfig.Privacy,
+					AI:                globalConfig.AI,
 				}
 
 				// If account doesn't have all fields, inherit from global config
@@ -599,6 +568,12 @@ func LoadAccountConfig(accountEmail string) (*Config, error) {
 				if config.Password == "" {
 					config.Password = globalConfig.Password
 				}
+				if config.SendLimits == nil {
+					config.SendLimits = globalConfig.SendLimits
+				}
+				if config.Reply == nil {
+					config.Reply = globalConfig.Reply
+				}
 
 				return config, nil
 			}
@@ -619,6 +594,11 @@ func LoadAccountConfig(accountEmail string) (*Config, error) {
 				DefaultAICLI:      globalConfig.DefaultAICLI,
 				ActiveAccount:     accountEmail,
 				Accounts:          globalConfig.Accounts,
+				SendLimits:        globalConfig.SendLimits,
+				DefaultSignature:  globalConfig.DefaultSignature,
+				Reply:             globalConfig.Reply,
+				Privacy:           globalConfig.Privacy,
+				AI:                globalConfig.AI,
 			}
 			
 			return config, nil
@@ -694,6 +674,30 @@ func SetAccountSignature(email, signature string) error {
 	return fmt.Errorf("account %s not found", email)
 }
 
+// SetDefaultSignature sets the named signature an account uses by default
+func SetDefaultSignature(email, name string) error {
+	config, err := LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %v", err)
+	}
+
+	// Check if this is the primary account
+	if config.Email == email {
+		config.DefaultSignature = name
+		return SaveConfig(config)
+	}
+
+	// Check if this is a secondary account
+	for i, acc := range config.Accounts {
+		if acc.Email == email {
+			config.Accounts[i].DefaultSignature = name
+			return SaveConfig(config)
+		}
+	}
+
+	return fmt.Errorf("account %s not found", email)
+}
+
 // AddNewAccount prompts user for account details and adds it to the global config
 func AddNewAccount(email string) error {
 	// Load current global config
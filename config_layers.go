@@ -0,0 +1,578 @@
+package mailos
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Config layers, from lowest to highest precedence
+const (
+	LayerDefault = "default" // Built into mailos
+	LayerGlobal  = "global"  // ~/.email/config.json
+	LayerLocal   = "local"   // .email/config.json in the current directory
+	LayerEnv     = "env"     // MAILOS_* environment variables
+	LayerFlag    = "flag"    // --set key=value
+)
+
+// ConfigSource says where an effective config value came from
+type ConfigSource struct {
+	Layer  string `json:"layer"`
+	Origin string `json:"origin"` // The file, environment variable or flag
+}
+
+// ConfigValue is one effective setting and where it came from
+type ConfigValue struct {
+	Key    string       `json:"key"`
+	Value  interface{}  `json:"value"`
+	Source ConfigSource `json:"source"`
+}
+
+// ResolvedConfig is the config merged from every layer, field by field
+type ResolvedConfig struct {
+	Config  *Config
+	values  map[string]interface{}            // The merged config as JSON values
+	sources map[string]ConfigSource           // Source of each leaf, keyed like reply.posting
+	files   map[string]map[string]interface{} // Each config file's own values, by layer
+	loaded  map[string]interface{}            // Config as loaded, to see what changed before saving
+}
+
+// configOverrides are the --set values for this run
+var configOverrides []string
+
+// lastResolved is the most recent resolution, so saving can leave out
+// values that didn't come from a file
+var lastResolved *ResolvedConfig
+
+// SetConfigOverrides sets config values for the rest of the process from
+// key=value pairs, such as reply.posting=bottom
+func SetConfigOverrides(pairs []string) error {
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("invalid --set %q (use key=value)", pair)
+		}
+		if _, err := parseConfigValue(strings.TrimSpace(key), value); err != nil {
+			return fmt.Errorf("invalid --set %q: %v", pair, err)
+		}
+	}
+	configOverrides = pairs
+	return nil
+}
+
+// configKeys maps each settable key, like reply.posting, to its Go type.
+// Accounts are lists of objects and can only be set in the files.
+func configKeys() map[string]reflect.Type {
+	keys := make(map[string]reflect.Type)
+	var walk func(t reflect.Type, prefix string)
+	walk = func(t reflect.Type, prefix string) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "" || name == "-" || name == "schema_version" {
+				continue
+			}
+			key := prefix + name
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			switch {
+			case fieldType.Kind() == reflect.Struct:
+				walk(fieldType, key+".")
+			case fieldType.Kind() == reflect.Slice && fieldType.Elem().Kind() == reflect.Struct:
+				// Lists of objects such as accounts
+			default:
+				keys[key] = fieldType
+			}
+		}
+	}
+	walk(reflect.TypeOf(Config{}), "")
+	return keys
+}
+
+// configEnvName returns the environment variable for a key: ai.api_key is
+// MAILOS_AI_API_KEY
+func configEnvName(key string) string {
+	return "MAILOS_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// parseConfigValue converts text from the environment or a flag to the key's type
+func parseConfigValue(key, text string) (interface{}, error) {
+	t, ok := configKeys()[key]
+	if !ok {
+		return nil, fmt.Errorf("unknown config key %q", key)
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		value, err := strconv.ParseBool(strings.TrimSpace(text))
+		if err != nil {
+			return nil, fmt.Errorf("%s must be true or false, not %q", key, text)
+		}
+		return value, nil
+	case reflect.Int:
+		value, err := strconv.Atoi(strings.TrimSpace(text))
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a whole number, not %q", key, text)
+		}
+		return float64(value), nil
+	case reflect.Slice:
+		var items []interface{}
+		for _, item := range strings.Split(text, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items, nil
+	}
+	return text, nil
+}
+
+// configDefaults are the built-in values the config accessors fall back to,
+// as a layer so they show up when explaining the config
+func configDefaults() map[string]interface{} {
+	return jsonObject(map[string]interface{}{
+		"reply":   defaultReplySettings,
+		"ai":      defaultAISettings,
+		"privacy": PrivacySettings{RemoteContent: RemoteContentBlock},
+	})
+}
+
+// jsonObject converts a value to generic JSON values, as a file would decode to
+func jsonObject(v interface{}) map[string]interface{} {
+	data, _ := json.Marshal(v)
+	var object map[string]interface{}
+	json.Unmarshal(data, &object)
+	return object
+}
+
+// readConfigFile reads a config file as JSON values, upgraded to the
+// current schema
+func readConfigFile(path string) (map[string]interface{}, error) {
+	data, err := loadVersionedFile(path, configSchemaFile)
+	if err != nil {
+		return nil, err
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %v", path, err)
+	}
+	return object, nil
+}
+
+// configLayer is one source of settings
+type configLayer struct {
+	source  ConfigSource
+	values  map[string]interface{}
+	origins map[string]string // Per-key origin, for the env and flag layers
+}
+
+// globalConfigPath returns ~/.email/config.json
+func globalConfigPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %v", err)
+	}
+	return filepath.Join(homeDir, ".email", "config.json"), nil
+}
+
+// ResolveConfig merges the built-in defaults, the global config, the local
+// config, MAILOS_* environment variables and --set flags, in that order.
+// Each field comes from the highest layer that sets it; objects such as ai
+// are merged key by key and accounts are matched by email.
+func ResolveConfig() (*ResolvedConfig, error) {
+	resolved, err := resolveConfig(readConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	lastResolved = resolved
+	return resolved, nil
+}
+
+// resolveConfig merges the layers, reading the config files with read
+func resolveConfig(read func(path string) (map[string]interface{}, error)) (*ResolvedConfig, error) {
+	layers := []configLayer{{source: ConfigSource{Layer: LayerDefault, Origin: "built-in"}, values: configDefaults()}}
+
+	globalPath, err := globalConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	localPath, _ := filepath.Abs(filepath.Join(".email", "config.json"))
+	var notFound error
+	for _, file := range []struct{ layer, path string }{{LayerGlobal, globalPath}, {LayerLocal, localPath}} {
+		// The home directory's own .email is the global config, not a local one
+		if file.layer == LayerLocal && file.path == globalPath {
+			continue
+		}
+		values, err := read(file.path)
+		if os.IsNotExist(err) {
+			if notFound == nil {
+				notFound = err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, configLayer{source: ConfigSource{Layer: file.layer, Origin: file.path}, values: values})
+	}
+	if len(layers) == 1 {
+		return nil, notFound
+	}
+
+	env := configLayer{source: ConfigSource{Layer: LayerEnv}, values: map[string]interface{}{}, origins: map[string]string{}}
+	for key := range configKeys() {
+		name := configEnvName(key)
+		text, ok := os.LookupEnv(name)
+		if !ok || text == "" {
+			continue
+		}
+		value, err := parseConfigValue(key, text)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		setConfigPath(env.values, key, value)
+		env.origins[key] = name
+	}
+	layers = append(layers, env)
+
+	flags := configLayer{source: ConfigSource{Layer: LayerFlag}, values: map[string]interface{}{}, origins: map[string]string{}}
+	for _, pair := range configOverrides {
+		key, text, _ := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		value, err := parseConfigValue(key, text)
+		if err != nil {
+			return nil, err
+		}
+		setConfigPath(flags.values, key, value)
+		flags.origins[key] = "--set " + key
+	}
+	layers = append(layers, flags)
+
+	resolved := &ResolvedConfig{values: map[string]interface{}{}, sources: map[string]ConfigSource{}, files: map[string]map[string]interface{}{}}
+	for _, layer := range layers {
+		mergeConfigValues(resolved.values, layer.values, "", layer, resolved.sources)
+		if layer.source.Layer == LayerGlobal || layer.source.Layer == LayerLocal {
+			resolved.files[layer.source.Layer] = layer.values
+		}
+	}
+
+	data, err := json.Marshal(resolved.values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge config: %v", err)
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid config: %v", err)
+	}
+	if config.Provider == "" && config.Email == "" && config.FromEmail == "" && config.FromName == "" {
+		return nil, fmt.Errorf("invalid config format")
+	}
+	resolved.Config = &config
+	resolved.loaded = jsonObject(&config)
+	return resolved, nil
+}
+
+// mergeConfigValues copies src over dst. Objects merge key by key, accounts
+// merge by email, and anything else is replaced whole.
+func mergeConfigValues(dst, src map[string]interface{}, prefix string, layer configLayer, sources map[string]ConfigSource) {
+	for name, value := range src {
+		key := prefix + name
+		// Empty values are unset, as when the config is decoded
+		if value == nil || value == "" {
+			continue
+		}
+		if srcObject, ok := value.(map[string]interface{}); ok {
+			if dstObject, ok := dst[name].(map[string]interface{}); ok {
+				mergeConfigValues(dstObject, srcObject, key+".", layer, sources)
+				continue
+			}
+		}
+		if srcList, ok := value.([]interface{}); ok && key == "accounts" {
+			if dstList, ok := dst[name].([]interface{}); ok {
+				dst[name] = mergeAccounts(dstList, srcList, layer, sources)
+				continue
+			}
+		}
+		clearConfigSources(sources, key)
+		dst[name] = copyConfigValue(value)
+		markConfigSources(dst[name], key, layer, sources)
+	}
+}
+
+// mergeAccounts merges accounts with the same email and appends new ones
+func mergeAccounts(dst, src []interface{}, layer configLayer, sources map[string]ConfigSource) []interface{} {
+	for _, item := range src {
+		account, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		email, _ := account["email"].(string)
+		key := fmt.Sprintf("accounts[%s]", email)
+		merged := false
+		for _, existing := range dst {
+			if existingAccount, ok := existing.(map[string]interface{}); ok {
+				if existingEmail, _ := existingAccount["email"].(string); strings.EqualFold(existingEmail, email) {
+					mergeConfigValues(existingAccount, account, key+".", layer, sources)
+					merged = true
+					break
+				}
+			}
+		}
+		if !merged {
+			copied := copyConfigValue(account)
+			dst = append(dst, copied)
+			markConfigSources(copied, key, layer, sources)
+		}
+	}
+	return dst
+}
+
+func copyConfigValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for name, item := range v {
+			copied[name] = copyConfigValue(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = copyConfigValue(item)
+		}
+		return copied
+	}
+	return value
+}
+
+// markConfigSources records the layer as the source of every leaf under key
+func markConfigSources(value interface{}, key string, layer configLayer, sources map[string]ConfigSource) {
+	leaves := map[string]interface{}{}
+	if object, ok := value.(map[string]interface{}); ok {
+		flattenConfig(object, key+".", leaves)
+	} else if key == "accounts" {
+		flattenConfig(map[string]interface{}{"accounts": value}, "", leaves)
+	} else {
+		leaves[key] = value
+	}
+	for leaf := range leaves {
+		source := layer.source
+		if origin, ok := layer.origins[leaf]; ok {
+			source.Origin = origin
+		}
+		sources[leaf] = source
+	}
+}
+
+func clearConfigSources(sources map[string]ConfigSource, key string) {
+	for existing := range sources {
+		if existing == key || strings.HasPrefix(existing, key+".") || strings.HasPrefix(existing, key+"[") {
+			delete(sources, existing)
+		}
+	}
+}
+
+// flattenConfig lists the leaves of a config object by key. Accounts are
+// keyed by email, as in accounts[me@example.com].provider.
+func flattenConfig(object map[string]interface{}, prefix string, leaves map[string]interface{}) {
+	for name, value := range object {
+		key := prefix + name
+		switch v := value.(type) {
+		case map[string]interface{}:
+			flattenConfig(v, key+".", leaves)
+		case []interface{}:
+			if key != "accounts" {
+				leaves[key] = v
+				continue
+			}
+			for _, item := range v {
+				if account, ok := item.(map[string]interface{}); ok {
+					email, _ := account["email"].(string)
+					flattenConfig(account, fmt.Sprintf("accounts[%s].", email), leaves)
+				}
+			}
+		default:
+			leaves[key] = v
+		}
+	}
+}
+
+// setConfigPath sets a dotted key in a JSON object, creating objects on the way
+func setConfigPath(object map[string]interface{}, key string, value interface{}) {
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := object[part].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			object[part] = next
+		}
+		object = next
+	}
+	object[parts[len(parts)-1]] = value
+}
+
+// deleteConfigPath removes a dotted key, and objects it leaves empty
+func deleteConfigPath(object map[string]interface{}, key string) {
+	name, rest, nested := strings.Cut(key, ".")
+	if !nested {
+		delete(object, name)
+		return
+	}
+	if child, ok := object[name].(map[string]interface{}); ok {
+		deleteConfigPath(child, rest)
+		if len(child) == 0 {
+			delete(object, name)
+		}
+	}
+}
+
+// Explain lists every effective value with its source, sorted by key.
+// Secrets are masked.
+func (r *ResolvedConfig) Explain() []ConfigValue {
+	leaves := map[string]interface{}{}
+	flattenConfig(r.values, "", leaves)
+	known := configKeys()
+
+	var values []ConfigValue
+	for key, value := range leaves {
+		// Keys mailos doesn't use are left out
+		if _, ok := known[key]; !ok && !strings.HasPrefix(key, "accounts[") {
+			continue
+		}
+		if value == nil || value == "" {
+			continue
+		}
+		if isSecretConfigKey(key) {
+			value = "********"
+		}
+		values = append(values, ConfigValue{Key: key, Value: value, Source: r.sources[key]})
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Key < values[j].Key })
+	return values
+}
+
+func isSecretConfigKey(key string) bool {
+	for _, secret := range []string{"password", "api_key", "license_key"} {
+		if key == secret || strings.HasSuffix(key, "."+secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatConfigExplain renders the values one per line, with their source
+// when explain is set
+func FormatConfigExplain(values []ConfigValue, explain bool) string {
+	keyWidth, valueWidth := 0, 0
+	rendered := make([]string, len(values))
+	for i, v := range values {
+		data, _ := json.Marshal(v.Value)
+		rendered[i] = string(data)
+		if s, ok := v.Value.(string); ok {
+			rendered[i] = s
+		}
+		if len(v.Key) > keyWidth {
+			keyWidth = len(v.Key)
+		}
+		if len(rendered[i]) > valueWidth {
+			valueWidth = len(rendered[i])
+		}
+	}
+
+	var b strings.Builder
+	for i, v := range values {
+		if !explain {
+			fmt.Fprintf(&b, "%-*s  %s\n", keyWidth, v.Key, rendered[i])
+			continue
+		}
+		origin := v.Source.Origin
+		if v.Source.Layer == LayerGlobal || v.Source.Layer == LayerLocal {
+			origin = displayPath(origin)
+		}
+		fmt.Fprintf(&b, "%-*s  %-*s  %s (%s)\n", keyWidth, v.Key, valueWidth, rendered[i], origin, v.Source.Layer)
+	}
+	return b.String()
+}
+
+// displayPath shortens paths under the home directory to ~
+func displayPath(path string) string {
+	if homeDir, err := os.UserHomeDir(); err == nil && strings.HasPrefix(path, homeDir+string(filepath.Separator)) {
+		return "~" + strings.TrimPrefix(path, homeDir)
+	}
+	return path
+}
+
+// forFile returns the config as it should be written to the given layer's
+// file: values that came from another layer are left out unless they were
+// changed since the config was loaded
+func (r *ResolvedConfig) forFile(config *Config, layer string) (*Config, error) {
+	current := jsonObject(config)
+	fileLeaves := map[string]interface{}{}
+	flattenConfig(r.files[layer], "", fileLeaves)
+	leaves, loaded := map[string]interface{}{}, map[string]interface{}{}
+	flattenConfig(current, "", leaves)
+	flattenConfig(r.loaded, "", loaded)
+
+	accountsOwned := false
+	for key, source := range r.sources {
+		if strings.HasPrefix(key, "accounts[") {
+			accountsOwned = accountsOwned || source.Layer == layer
+			continue
+		}
+		if source.Layer == layer || !reflect.DeepEqual(leaves[key], loaded[key]) {
+			continue
+		}
+		if fileValue, ok := fileLeaves[key]; ok {
+			setConfigPath(current, key, fileValue)
+		} else {
+			deleteConfigPath(current, key)
+		}
+	}
+	// Accounts are kept whole, unless they all came from elsewhere unchanged
+	if !accountsOwned && reflect.DeepEqual(current["accounts"], r.loaded["accounts"]) {
+		if accounts, ok := r.files[layer]["accounts"]; ok {
+			current["accounts"] = accounts
+		} else {
+			delete(current, "accounts")
+		}
+	}
+
+	data, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+	var saved Config
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// ShowConfig prints the effective config, with each value's source when
+// explain is set
+func ShowConfig(explain, asJSON bool) error {
+	resolved, err := ResolveConfig()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no configuration found. Run 'mailos setup' first")
+		}
+		return err
+	}
+	values := resolved.Explain()
+	if asJSON {
+		data, err := json.MarshalIndent(values, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode config: %v", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	fmt.Print(FormatConfigExplain(values, explain))
+	return nil
+}
@@ -0,0 +1,185 @@
+package mailos
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupConfigLayers writes a global and a local config and moves into the project
+func setupConfigLayers(t *testing.T, global, local string) string {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	project := filepath.Join(home, "project")
+	for path, data := range map[string]string{
+		filepath.Join(home, ".email", "config.json"):    global,
+		filepath.Join(project, ".email", "config.json"): local,
+	} {
+		if data == "" {
+			continue
+		}
+		os.MkdirAll(filepath.Dir(path), 0700)
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.MkdirAll(project, 0700)
+	t.Chdir(project)
+	t.Cleanup(func() { configOverrides = nil; lastResolved = nil })
+	return home
+}
+
+func TestResolveConfig(t *testing.T) {
+	setupConfigLayers(t,
+		`{"provider": "gmail", "email": "me@example.com", "password": "secret", "from_name": "Me", "sync_dir": "/home/me/mail",
+		  "reply": {"posting": "bottom"}, "accounts": [{"email": "work@example.com", "provider": "fastmail", "password": "p"}]}`,
+		`{"provider": "gmail", "from_name": "Project", "sync_dir": "/project/mail", "ai": {"model": "llama3"},
+		  "accounts": [{"email": "work@example.com", "label": "Work"}, {"email": "side@example.com", "provider": "gmail"}]}`)
+	t.Setenv("MAILOS_AI_MAX_TOKENS", "99")
+	t.Setenv("MAILOS_PRIVACY_TRACKER_DOMAINS", "ads.example, px.example")
+	if err := SetConfigOverrides([]string{"reply.quote_levels=1", "from_name=Flag"}); err != nil {
+		t.Fatal(err)
+	}
+
+	resolved, err := ResolveConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := resolved.Config
+	// A local provider no longer hides the global config
+	if config.Email != "me@example.com" || config.Password != "secret" || config.SyncDir != "/project/mail" || config.FromName != "Flag" {
+		t.Errorf("Unexpected config: %+v", config)
+	}
+	if reply := config.GetReplySettings(); reply.Posting != PostingBottom || reply.QuoteLevels != 1 {
+		t.Errorf("Expected reply settings merged field by field, got %+v", reply)
+	}
+	if ai := config.GetAISettings(); ai.Model != "llama3" || ai.MaxTokens != 99 || ai.TimeoutSeconds != 120 {
+		t.Errorf("Unexpected AI settings: %+v", ai)
+	}
+	if domains := config.GetPrivacySettings().TrackerDomains; strings.Join(domains, " ") != "ads.example px.example" {
+		t.Errorf("Unexpected tracker domains: %v", domains)
+	}
+	if len(config.Accounts) != 2 || config.Accounts[0].Provider != "fastmail" || config.Accounts[0].Label != "Work" || config.Accounts[1].Email != "side@example.com" {
+		t.Errorf("Expected accounts merged by email, got %+v", config.Accounts)
+	}
+
+	sources := map[string]string{}
+	for _, v := range resolved.Explain() {
+		sources[v.Key] = v.Source.Layer + " " + v.Source.Origin
+		if v.Key == "password" && v.Value != "********" {
+			t.Errorf("Expected the password masked, got %v", v.Value)
+		}
+	}
+	for key, want := range map[string]string{
+		"email":                               "global",
+		"sync_dir":                            "local",
+		"reply.posting":                       "global",
+		"reply.quote_levels":                  "flag --set reply.quote_levels",
+		"ai.max_tokens":                       "env MAILOS_AI_MAX_TOKENS",
+		"ai.backend":                          "default",
+		"accounts[work@example.com].provider": "global",
+		"accounts[work@example.com].label":    "local",
+		"accounts[side@example.com].provider": "local",
+	} {
+		if !strings.HasPrefix(sources[key], want) {
+			t.Errorf("Expected %s from %q, got %q", key, want, sources[key])
+		}
+	}
+
+	text := FormatConfigExplain(resolved.Explain(), true)
+	if !strings.Contains(text, "sync_dir ") || !strings.Contains(text, "/project/mail") || !strings.Contains(text, "(local)") {
+		t.Errorf("Unexpected explanation:\n%s", text)
+	}
+}
+
+func TestResolveConfigErrors(t *testing.T) {
+	t.Run("NoConfig", func(t *testing.T) {
+		setupConfigLayers(t, "", "")
+		if _, err := ResolveConfig(); !os.IsNotExist(err) {
+			t.Errorf("Expected a missing config reported, got %v", err)
+		}
+	})
+
+	t.Run("LocalOnly", func(t *testing.T) {
+		setupConfigLayers(t, "", `{"provider": "gmail", "email": "me@example.com"}`)
+		if config, err := LoadConfigWithInheritance(); err != nil || config.Email != "me@example.com" {
+			t.Errorf("Unexpected config: %+v, %v", config, err)
+		}
+	})
+
+	t.Run("BadValues", func(t *testing.T) {
+		setupConfigLayers(t, `{"provider": "gmail", "email": "me@example.com"}`, "")
+		t.Setenv("MAILOS_AUTO_SYNC", "sometimes")
+		if _, err := ResolveConfig(); err == nil || !strings.Contains(err.Error(), "MAILOS_AUTO_SYNC") {
+			t.Errorf("Expected the variable named, got %v", err)
+		}
+		for _, pair := range []string{"reply.posting", "accounts=x", "ai.max_tokens=lots"} {
+			if err := SetConfigOverrides([]string{pair}); err == nil {
+				t.Errorf("Expected %q refused", pair)
+			}
+		}
+	})
+}
+
+func TestSaveConfigKeepsLayersApart(t *testing.T) {
+	home := setupConfigLayers(t, `{"provider": "gmail", "email": "me@example.com", "password": "secret"}`, "")
+	t.Chdir(home)
+	t.Setenv("MAILOS_AI_API_KEY", "sk-env")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.GetAISettings().APIKey != "sk-env" {
+		t.Fatalf("Expected the key from the environment")
+	}
+	config.FromName = "Me"
+	if err := SaveConfig(config); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(home, ".email", "config.json"))
+	var saved map[string]interface{}
+	json.Unmarshal(data, &saved)
+	if saved["from_name"] != "Me" || saved["password"] != "secret" {
+		t.Errorf("Expected the change saved, got %s", data)
+	}
+	// Neither the environment's key nor the built-in defaults are written
+	if _, ok := saved["ai"]; ok {
+		t.Errorf("Expected no ai settings saved, got %s", data)
+	}
+	if _, ok := saved["reply"]; ok {
+		t.Errorf("Expected no reply settings saved, got %s", data)
+	}
+}
+
+func TestSaveLocalConfig(t *testing.T) {
+	setupConfigLayers(t,
+		`{"provider": "gmail", "email": "me@example.com", "password": "secret", "accounts": [{"email": "work@example.com", "provider": "gmail"}]}`,
+		`{"from_name": "Project"}`)
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.SyncDir = "/project/mail"
+	if err := SaveConfig(config); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(".email", "config.json"))
+	var saved map[string]interface{}
+	json.Unmarshal(data, &saved)
+	if saved["from_name"] != "Project" || saved["sync_dir"] != "/project/mail" {
+		t.Errorf("Expected the local values saved, got %s", data)
+	}
+	// The global account isn't copied into the project
+	if saved["password"] != "" || saved["accounts"] != nil {
+		t.Errorf("Expected no global values in the local config, got %s", data)
+	}
+	if config, err := LoadConfig(); err != nil || config.Password != "secret" || config.SyncDir != "/project/mail" {
+		t.Errorf("Unexpected config after saving: %+v, %v", config, err)
+	}
+}
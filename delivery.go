@@ -0,0 +1,442 @@
+package mailos
+
+import (
+	"bufio"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Delivery states shown by `mailos sent --status`
+const (
+	DeliverySent      = "sent"      // Accepted by our SMTP server, no report yet
+	DeliveryDelivered = "delivered" // A DSN reported successful delivery or relay
+	DeliveryDelayed   = "delayed"   // A DSN reported the message is still queued
+	DeliveryFailed    = "failed"    // A DSN reported a permanent failure
+)
+
+// DeliveryReport is a parsed RFC 3464 delivery status notification
+type DeliveryReport struct {
+	OriginalMessageID string            `json:"original_message_id,omitempty"`
+	OriginalSubject   string            `json:"original_subject,omitempty"`
+	EnvelopeID        string            `json:"envelope_id,omitempty"`
+	ReportingMTA      string            `json:"reporting_mta,omitempty"`
+	Recipients        []RecipientStatus `json:"recipients"`
+}
+
+// RecipientStatus is one per-recipient block of a delivery status notification
+type RecipientStatus struct {
+	Recipient  string `json:"recipient"`
+	Action     string `json:"action"`           // failed, delayed, delivered, relayed or expanded
+	Status     string `json:"status,omitempty"` // RFC 3463 code such as 5.1.1
+	Diagnostic string `json:"diagnostic,omitempty"`
+	RemoteMTA  string `json:"remote_mta,omitempty"`
+}
+
+// State maps the DSN action to a delivery state
+func (r RecipientStatus) State() string {
+	switch r.Action {
+	case "failed":
+		return DeliveryFailed
+	case "delayed":
+		return DeliveryDelayed
+	case "delivered", "relayed", "expanded":
+		return DeliveryDelivered
+	}
+	// Fall back to the status class when the action is missing
+	switch {
+	case strings.HasPrefix(r.Status, "5."):
+		return DeliveryFailed
+	case strings.HasPrefix(r.Status, "4."):
+		return DeliveryDelayed
+	case strings.HasPrefix(r.Status, "2."):
+		return DeliveryDelivered
+	}
+	return ""
+}
+
+// MessageID returns the Message-ID of the message the report is about
+func (r *DeliveryReport) MessageID() string {
+	if r.OriginalMessageID != "" {
+		return r.OriginalMessageID
+	}
+	// We send the Message-ID as the envelope ID, so it still links reports
+	// from servers that don't return the original headers
+	return strings.Trim(r.EnvelopeID, "<>")
+}
+
+// SentDeliveryStatus is a tracked sent message and the state of each recipient
+type SentDeliveryStatus struct {
+	MessageID  string              `json:"message_id"`
+	Subject    string              `json:"subject"`
+	SentAt     time.Time           `json:"sent_at"`
+	Recipients []RecipientDelivery `json:"recipients"`
+}
+
+// RecipientDelivery is the latest known state for one recipient
+type RecipientDelivery struct {
+	Recipient  string    `json:"recipient"`
+	State      string    `json:"state"`
+	StatusCode string    `json:"status_code,omitempty"`
+	Diagnostic string    `json:"diagnostic,omitempty"`
+	RemoteMTA  string    `json:"remote_mta,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// isDeliveryStatusPart reports whether a MIME type carries RFC 3464 fields
+func isDeliveryStatusPart(contentType string) bool {
+	return contentType == "message/delivery-status" || contentType == "message/global-delivery-status"
+}
+
+// isReturnedMessagePart reports whether a MIME type holds the returned original
+// message or its headers
+func isReturnedMessagePart(contentType string) bool {
+	switch contentType {
+	case "message/rfc822", "text/rfc822-headers", "message/global", "message/global-headers":
+		return true
+	}
+	return false
+}
+
+// parseDeliveryStatus parses the per-message and per-recipient field groups
+// of a message/delivery-status body into report
+func parseDeliveryStatus(body []byte, report *DeliveryReport) {
+	groups := splitFieldGroups(body)
+	if len(groups) == 0 {
+		return
+	}
+
+	perMessage := groups[0]
+	report.ReportingMTA = fieldValue(perMessage.Get("Reporting-MTA"))
+	report.EnvelopeID = decodeXText(perMessage.Get("Original-Envelope-Id"))
+
+	for _, fields := range groups[1:] {
+		recipient := fieldValue(fields.Get("Original-Recipient"))
+		if recipient == "" {
+			recipient = fieldValue(fields.Get("Final-Recipient"))
+		}
+		if recipient == "" {
+			continue
+		}
+		report.Recipients = append(report.Recipients, RecipientStatus{
+			Recipient:  strings.ToLower(strings.Trim(recipient, "<>")),
+			Action:     strings.ToLower(strings.TrimSpace(fields.Get("Action"))),
+			Status:     strings.Fields(fields.Get("Status") + " ")[0],
+			Diagnostic: fieldValue(fields.Get("Diagnostic-Code")),
+			RemoteMTA:  fieldValue(fields.Get("Remote-MTA")),
+		})
+	}
+}
+
+// splitFieldGroups reads blank-line separated groups of header-style fields
+func splitFieldGroups(body []byte) []textproto.MIMEHeader {
+	normalized := strings.ReplaceAll(string(body), "\r\n", "\n")
+
+	var groups []textproto.MIMEHeader
+	for _, block := range strings.Split(normalized, "\n\n") {
+		if strings.TrimSpace(block) == "" {
+			continue
+		}
+		reader := textproto.NewReader(bufio.NewReader(strings.NewReader(strings.TrimLeft(block, "\n") + "\n\n")))
+		fields, _ := reader.ReadMIMEHeader()
+		if len(fields) > 0 {
+			groups = append(groups, fields)
+		}
+	}
+	return groups
+}
+
+// fieldValue strips the type prefix from DSN fields such as "rfc822; bob@example.com"
+func fieldValue(v string) string {
+	v = strings.TrimSpace(v)
+	if i := strings.Index(v, ";"); i >= 0 {
+		v = strings.TrimSpace(v[i+1:])
+	}
+	return strings.Join(strings.Fields(v), " ")
+}
+
+// noteReturnedHeaders records the Message-ID and subject of the returned message
+func noteReturnedHeaders(r io.Reader, report *DeliveryReport) {
+	header, _ := textproto.NewReader(bufio.NewReader(r)).ReadMIMEHeader()
+	if id := strings.Trim(strings.TrimSpace(header.Get("Message-Id")), "<>"); id != "" {
+		report.OriginalMessageID = id
+	}
+	if subject := header.Get("Subject"); subject != "" {
+		if decoded, err := new(mime.WordDecoder).DecodeHeader(subject); err == nil {
+			subject = decoded
+		}
+		report.OriginalSubject = subject
+	}
+}
+
+// generateMessageID returns a new globally unique Message-ID (without angle
+// brackets) in the sender's domain
+func generateMessageID(fromEmail string) string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+
+	domain := "emailos.local"
+	if at := strings.LastIndex(fromEmail, "@"); at >= 0 && at < len(fromEmail)-1 {
+		domain = strings.ToLower(fromEmail[at+1:])
+	}
+	return fmt.Sprintf("%s.%s@%s", strconv.FormatInt(time.Now().UnixNano(), 36), hex.EncodeToString(buf), domain)
+}
+
+// encodeXText encodes a value for the ENVID and ORCPT SMTP parameters (RFC 3461)
+func encodeXText(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < '!' || c > '~' || c == '+' || c == '=' {
+			fmt.Fprintf(&b, "+%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// decodeXText reverses encodeXText, leaving malformed escapes as they are
+func decodeXText(s string) string {
+	s = strings.TrimSpace(s)
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '+' && i+2 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// TrackSentMessage records each recipient of a sent message as awaiting a report
+func (dm *DatabaseManager) TrackSentMessage(messageID, subject string, recipients []string, sentAt time.Time) error {
+	messageID = strings.Trim(messageID, "<>")
+	tx, err := dm.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, recipient := range recipients {
+		address := strings.ToLower(parseOutgoingAddress(recipient).Address)
+		if address == "" {
+			continue
+		}
+		_, err := tx.Exec(`
+			INSERT INTO delivery_status (message_id, recipient, state, subject, sent_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT(message_id, recipient) DO UPDATE SET
+				subject = excluded.subject,
+				sent_at = excluded.sent_at
+		`, messageID, address, DeliverySent, subject, sentAt, sentAt)
+		if err != nil {
+			return fmt.Errorf("failed to track %s: %v", address, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// RecordDeliveryReports applies the delivery status notifications among emails
+// to the tracked messages and returns how many recipient states changed
+func (dm *DatabaseManager) RecordDeliveryReports(emails []*Email) (int, error) {
+	tx, err := dm.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	updated := 0
+	for _, email := range emails {
+		if email.DeliveryReport == nil {
+			continue
+		}
+		n, err := recordDeliveryReport(tx, email.DeliveryReport, email.MessageID, email.Date)
+		if err != nil {
+			return updated, err
+		}
+		updated += n
+	}
+
+	if err := tx.Commit(); err != nil {
+		return updated, fmt.Errorf("failed to commit delivery reports: %v", err)
+	}
+	return updated, nil
+}
+
+// recordDeliveryReport upserts one report. A late "delayed" report never
+// overrides a final delivered or failed state.
+func recordDeliveryReport(tx *sql.Tx, report *DeliveryReport, reportMessageID string, received time.Time) (int, error) {
+	messageID := report.MessageID()
+	if messageID == "" {
+		return 0, nil
+	}
+	if received.IsZero() {
+		received = time.Now()
+	}
+
+	updated := 0
+	for _, recipient := range report.Recipients {
+		state := recipient.State()
+		if state == "" {
+			continue
+		}
+		result, err := tx.Exec(`
+			INSERT INTO delivery_status (
+				message_id, recipient, state, status_code, diagnostic, remote_mta,
+				subject, updated_at, report_message_id
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(message_id, recipient) DO UPDATE SET
+				state = excluded.state,
+				status_code = excluded.status_code,
+				diagnostic = excluded.diagnostic,
+				remote_mta = excluded.remote_mta,
+				updated_at = excluded.updated_at,
+				report_message_id = excluded.report_message_id
+			WHERE (delivery_status.report_message_id IS NULL OR delivery_status.report_message_id != excluded.report_message_id)
+				AND (delivery_status.state IN ('sent', 'delayed') OR excluded.state != 'delayed')
+		`, messageID, recipient.Recipient, state, recipient.Status, recipient.Diagnostic, recipient.RemoteMTA,
+			report.OriginalSubject, received, strings.Trim(reportMessageID, "<>"))
+		if err != nil {
+			return updated, fmt.Errorf("failed to record delivery status for %s: %v", recipient.Recipient, err)
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			updated++
+		}
+	}
+	return updated, nil
+}
+
+// ListDeliveryStatus returns the most recently tracked messages, newest first
+func (dm *DatabaseManager) ListDeliveryStatus(limit int) ([]*SentDeliveryStatus, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+	rows, err := dm.db.Query(`
+		SELECT message_id, recipient, state, COALESCE(status_code, ''), COALESCE(diagnostic, ''),
+			COALESCE(remote_mta, ''), COALESCE(subject, ''), sent_at, updated_at
+		FROM delivery_status
+		WHERE message_id IN (
+			SELECT message_id FROM delivery_status
+			GROUP BY message_id
+			ORDER BY MAX(COALESCE(sent_at, updated_at)) DESC
+			LIMIT ?
+		)
+		ORDER BY message_id, recipient
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query delivery status: %v", err)
+	}
+	defer rows.Close()
+
+	byID := make(map[string]*SentDeliveryStatus)
+	var list []*SentDeliveryStatus
+	for rows.Next() {
+		var messageID, subject string
+		var sentAt sql.NullTime
+		var r RecipientDelivery
+		if err := rows.Scan(&messageID, &r.Recipient, &r.State, &r.StatusCode, &r.Diagnostic,
+			&r.RemoteMTA, &subject, &sentAt, &r.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan delivery status: %v", err)
+		}
+
+		status, ok := byID[messageID]
+		if !ok {
+			status = &SentDeliveryStatus{MessageID: messageID}
+			byID[messageID] = status
+			list = append(list, status)
+		}
+		if subject != "" {
+			status.Subject = subject
+		}
+		if sentAt.Valid {
+			status.SentAt = sentAt.Time
+		} else if status.SentAt.IsZero() || r.UpdatedAt.Before(status.SentAt) {
+			status.SentAt = r.UpdatedAt
+		}
+		status.Recipients = append(status.Recipients, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].SentAt.After(list[j].SentAt) })
+	return list, nil
+}
+
+// RecordDeliveryReports stores the delivery reports found among synced emails
+func RecordDeliveryReports(accountEmail string, emails []*Email) (int, error) {
+	dm, err := NewDatabaseManager(accountEmail)
+	if err != nil {
+		return 0, err
+	}
+	defer dm.Close()
+
+	return dm.RecordDeliveryReports(emails)
+}
+
+// GetDeliveryStatus returns the delivery state of recently sent messages
+func GetDeliveryStatus(accountEmail string, limit int) ([]*SentDeliveryStatus, error) {
+	setup, err := InitializeMailSetup(accountEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	dm, err := NewDatabaseManager(setup.Config.Email)
+	if err != nil {
+		return nil, err
+	}
+	defer dm.Close()
+
+	return dm.ListDeliveryStatus(limit)
+}
+
+// FormatDeliveryStatus renders delivery states for the terminal
+func FormatDeliveryStatus(list []*SentDeliveryStatus) string {
+	if len(list) == 0 {
+		return "No tracked sent emails yet. Delivery reports are collected when you run 'mailos sync'.\n"
+	}
+
+	var b strings.Builder
+	for _, status := range list {
+		subject := status.Subject
+		if subject == "" {
+			subject = "(no subject)"
+		}
+		b.WriteString(fmt.Sprintf("\n%s\n", subject))
+		b.WriteString(fmt.Sprintf("    Sent: %s\n", status.SentAt.Local().Format("Jan 2, 2006 3:04 PM")))
+		b.WriteString(fmt.Sprintf("    Message-ID: <%s>\n", status.MessageID))
+		for _, r := range status.Recipients {
+			icon := "•"
+			switch r.State {
+			case DeliveryDelivered:
+				icon = "✓"
+			case DeliveryDelayed:
+				icon = "⏳"
+			case DeliveryFailed:
+				icon = "✗"
+			}
+			line := fmt.Sprintf("    %s %s: %s", icon, r.Recipient, r.State)
+			if r.StatusCode != "" {
+				line += fmt.Sprintf(" (%s)", r.StatusCode)
+			}
+			b.WriteString(line + "\n")
+			if r.Diagnostic != "" && r.State != DeliveryDelivered {
+				b.WriteString(fmt.Sprintf("        %s\n", r.Diagnostic))
+			}
+		}
+	}
+	return b.String()
+}
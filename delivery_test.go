@@ -0,0 +1,250 @@
+package mailos
+
+import (
+	"bufio"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// loadDSN parses a delivery status notification from testdata/dsn
+func loadDSN(t *testing.T, name string) *Email {
+	t.Helper()
+	raw, err := os.ReadFile(filepath.Join("testdata", "dsn", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	email, err := parseRawMessage(raw)
+	if err != nil {
+		t.Fatalf("Failed to parse %s: %v", name, err)
+	}
+	return email
+}
+
+func TestParseDeliveryReport(t *testing.T) {
+	t.Run("Failed", func(t *testing.T) {
+		report := loadDSN(t, "failed.eml").DeliveryReport
+		if report == nil {
+			t.Fatal("Expected a delivery report")
+		}
+		if report.MessageID() != "lz1.abc@example.com" || report.OriginalSubject != "Café plans" {
+			t.Errorf("Expected the returned headers linked, got %q %q", report.MessageID(), report.OriginalSubject)
+		}
+		if report.EnvelopeID != "lz1.abc+def@example.com" || report.ReportingMTA != "mx.example.net" {
+			t.Errorf("Unexpected per-message fields %+v", report)
+		}
+		if len(report.Recipients) != 2 {
+			t.Fatalf("Expected 2 recipients, got %+v", report.Recipients)
+		}
+		failed := report.Recipients[0]
+		if failed.Recipient != "nobody@example.org" || failed.State() != DeliveryFailed || failed.Status != "5.1.1" {
+			t.Errorf("Unexpected failed recipient %+v", failed)
+		}
+		if failed.Diagnostic != "550 5.1.1 <nobody@example.org>: Recipient address rejected: User unknown" {
+			t.Errorf("Expected the folded diagnostic joined, got %q", failed.Diagnostic)
+		}
+		if report.Recipients[1].State() != DeliveryDelivered {
+			t.Errorf("Expected second recipient delivered, got %+v", report.Recipients[1])
+		}
+	})
+
+	t.Run("EnvelopeIDOnly", func(t *testing.T) {
+		report := loadDSN(t, "delayed.eml").DeliveryReport
+		if report == nil || report.MessageID() != "lz2.xyz@example.com" {
+			t.Fatalf("Expected the envelope ID used as the link, got %+v", report)
+		}
+		if len(report.Recipients) != 1 || report.Recipients[0].State() != DeliveryDelayed {
+			t.Errorf("Expected one delayed recipient, got %+v", report.Recipients)
+		}
+	})
+
+	t.Run("NotAReport", func(t *testing.T) {
+		raw, _ := BuildMessage(&OutgoingMessage{
+			From:     "mailer-daemon@example.net",
+			Subject:  "Undelivered Mail Returned to Sender",
+			TextBody: "Action: failed\r\n",
+		})
+		email, _ := parseRawMessage(raw)
+		if email.DeliveryReport != nil {
+			t.Errorf("Expected ordinary messages to carry no report")
+		}
+	})
+
+	t.Run("XText", func(t *testing.T) {
+		id := "a+b=c@example.com"
+		if got := encodeXText(id); got != "a+2Bb+3Dc@example.com" {
+			t.Errorf("encodeXText(%q) = %q", id, got)
+		}
+		if got := decodeXText(encodeXText(id)); got != id {
+			t.Errorf("Expected round trip, got %q", got)
+		}
+	})
+}
+
+func TestDeliveryStatusTracking(t *testing.T) {
+	tmpDir := setupTestGroups(t)
+	defer cleanupTestGroups(tmpDir)
+
+	dm, err := NewDatabaseManager("me@example.com")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer dm.Close()
+
+	sent := time.Date(2024, 9, 2, 10, 0, 0, 0, time.UTC)
+	if err := dm.TrackSentMessage("<lz1.abc@example.com>", "Café plans", []string{"Nobody <Nobody@example.org>", "carol@example.org", "dave@example.org"}, sent); err != nil {
+		t.Fatalf("Failed to track: %v", err)
+	}
+	if err := dm.TrackSentMessage("lz2.xyz@example.com", "Later", []string{"slow@example.org"}, sent.Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to track: %v", err)
+	}
+
+	failed, delayed := loadDSN(t, "failed.eml"), loadDSN(t, "delayed.eml")
+	updated, err := dm.RecordDeliveryReports([]*Email{failed, delayed})
+	if err != nil {
+		t.Fatalf("Failed to record reports: %v", err)
+	}
+	if updated != 3 {
+		t.Errorf("Expected 3 recipient updates, got %d", updated)
+	}
+
+	// A late delay notice must not undo a final state, and re-syncing the
+	// same report changes nothing
+	late := &DeliveryReport{
+		OriginalMessageID: "lz1.abc@example.com",
+		Recipients:        []RecipientStatus{{Recipient: "nobody@example.org", Action: "delayed", Status: "4.4.1"}},
+	}
+	if _, err := dm.RecordDeliveryReports([]*Email{{MessageID: "late@example.net", DeliveryReport: late}, failed}); err != nil {
+		t.Fatalf("Failed to record reports: %v", err)
+	}
+
+	statuses, err := dm.ListDeliveryStatus(10)
+	if err != nil {
+		t.Fatalf("Failed to list status: %v", err)
+	}
+	if len(statuses) != 2 || statuses[0].MessageID != "lz2.xyz@example.com" {
+		t.Fatalf("Expected both messages newest first, got %+v", statuses)
+	}
+
+	states := make(map[string]string)
+	for _, r := range statuses[1].Recipients {
+		states[r.Recipient] = r.State
+	}
+	want := map[string]string{
+		"nobody@example.org": DeliveryFailed,
+		"carol@example.org":  DeliveryDelivered,
+		"dave@example.org":   DeliverySent,
+	}
+	for recipient, state := range want {
+		if states[recipient] != state {
+			t.Errorf("Expected %s to be %s, got %q", recipient, state, states[recipient])
+		}
+	}
+	if statuses[0].Recipients[0].State != DeliveryDelayed {
+		t.Errorf("Expected slow@example.org delayed, got %+v", statuses[0].Recipients[0])
+	}
+
+	out := FormatDeliveryStatus(statuses)
+	if !strings.Contains(out, "✗ nobody@example.org: failed (5.1.1)") || !strings.Contains(out, "User unknown") {
+		t.Errorf("Expected the failure and diagnostic shown, got:\n%s", out)
+	}
+}
+
+// fakeSMTPServer accepts one session and records the commands it receives
+func fakeSMTPServer(t *testing.T, extensions []string) (string, <-chan []string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commands := make(chan []string, 1)
+	go func() {
+		defer ln.Close()
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var seen []string
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		reply("220 fake ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				break
+			}
+			line = strings.TrimRight(line, "\r\n")
+			seen = append(seen, line)
+			switch {
+			case strings.HasPrefix(line, "EHLO"):
+				reply("250-fake")
+				for _, ext := range extensions {
+					reply("250-" + ext)
+				}
+				reply("250 HELP")
+			case line == "DATA":
+				reply("354 go ahead")
+				for {
+					data, err := r.ReadString('\n')
+					if err != nil || data == ".\r\n" {
+						break
+					}
+				}
+				reply("250 2.0.0 Ok: queued as ABC123")
+			case line == "QUIT":
+				reply("221 bye")
+				commands <- seen
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+		commands <- seen
+	}()
+	return ln.Addr().String(), commands
+}
+
+func TestDeliverMessageRequestsDSN(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		extensions []string
+		wantMail   string
+		wantRcpt   string
+	}{
+		{"Supported", []string{"DSN", "8BITMIME"},
+			"MAIL FROM:<me@example.com> RET=HDRS ENVID=lz1.abc+2Bx@example.com BODY=8BITMIME",
+			"RCPT TO:<bob@example.org> NOTIFY=FAILURE,DELAY ORCPT=rfc822;bob@example.org"},
+		{"Unsupported", nil, "MAIL FROM:<me@example.com>", "RCPT TO:<bob@example.org>"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			addr, commands := fakeSMTPServer(t, tc.extensions)
+			c, err := smtp.Dial(addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			response, err := deliverMessage(c, "me@example.com", []string{"bob@example.org"}, "Subject: hi\r\n\r\nhi\r\n", "lz1.abc+x@example.com")
+			if err != nil {
+				t.Fatalf("Failed to deliver: %v", err)
+			}
+			if parseQueueID(response) != "ABC123" {
+				t.Errorf("Expected the queue ID from the DATA reply, got %q", response)
+			}
+			if err := c.Quit(); err != nil {
+				t.Fatalf("Failed to quit: %v", err)
+			}
+
+			seen := strings.Join(<-commands, "\n")
+			if !strings.Contains(seen, tc.wantMail+"\n") || !strings.Contains(seen, tc.wantRcpt+"\n") {
+				t.Errorf("Expected %q and %q, got:\n%s", tc.wantMail, tc.wantRcpt, seen)
+			}
+		})
+	}
+}
@@ -0,0 +1,327 @@
+package mailos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// digestExcerptChars is how much of each message body the model sees
+const digestExcerptChars = 1200
+
+// DigestRef points at a message in a digest
+type DigestRef struct {
+	MessageID string    `json:"message_id"`
+	From      string    `json:"from"`
+	Subject   string    `json:"subject"`
+	Date      time.Time `json:"date"`
+}
+
+// DigestItem is one summarised message or thread
+type DigestItem struct {
+	Summary  string      `json:"summary"`
+	Messages []DigestRef `json:"messages"`
+}
+
+// Digest sorts a period's messages into what needs doing and what doesn't
+type Digest struct {
+	Range          string       `json:"range"`
+	Since          time.Time    `json:"since"`
+	Until          time.Time    `json:"until"`
+	Total          int          `json:"total"`
+	ActionRequired []DigestItem `json:"action_required"`
+	AwaitingReply  []DigestItem `json:"awaiting_reply"`
+	FYI            []DigestItem `json:"fyi"`
+	Newsletters    []DigestItem `json:"newsletters"`
+	Unclassified   []DigestRef  `json:"unclassified,omitempty"` // Messages the model left out
+	GeneratedAt    time.Time    `json:"generated_at"`
+}
+
+const digestSystemPrompt = `You triage an email inbox. Sort the messages below into these categories:
+- action_required: the reader has to do something other than reply, such as approve, pay, sign, attend or meet a deadline
+- awaiting_reply: a person wrote to the reader and is waiting for an answer
+- fyi: worth knowing, but nothing to do
+- newsletters: newsletters, marketing, and notifications sent in bulk
+
+Put each message in exactly one category. Group messages from the same thread into one item. Each summary is one short sentence saying what the reader needs to know or do.
+
+Answer with JSON only, in this form, using the message refs given in brackets:
+{"action_required": [{"ids": ["m1"], "summary": "..."}], "awaiting_reply": [], "fyi": [], "newsletters": []}`
+
+// digestResponse is the model's answer for one chunk of messages
+type digestResponse struct {
+	ActionRequired []digestResponseItem `json:"action_required"`
+	AwaitingReply  []digestResponseItem `json:"awaiting_reply"`
+	FYI            []digestResponseItem `json:"fyi"`
+	Newsletters    []digestResponseItem `json:"newsletters"`
+}
+
+type digestResponseItem struct {
+	IDs     []string `json:"ids"`
+	Summary string   `json:"summary"`
+}
+
+// digestBlock describes one message for the model under a short ref, which
+// costs fewer tokens than its Message-ID and can't be mistyped into another
+func digestBlock(ref string, email *Email) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s]\nFrom: %s\n", ref, email.From)
+	if len(email.To) > 0 {
+		fmt.Fprintf(&b, "To: %s\n", strings.Join(email.To, ", "))
+	}
+	fmt.Fprintf(&b, "Date: %s\nSubject: %s\n", email.Date.Format("Mon Jan 2 15:04"), email.Subject)
+	if len(email.Headers["List-Unsubscribe"]) > 0 || len(email.Headers["List-Id"]) > 0 {
+		b.WriteString("Mailing list: yes\n")
+	}
+	if email.InReplyTo != "" {
+		b.WriteString("Part of a thread: yes\n")
+	}
+
+	body := strings.Join(strings.Fields(email.Body), " ")
+	if runes := []rune(body); len(runes) > digestExcerptChars {
+		body = string(runes[:digestExcerptChars]) + "..."
+	}
+	fmt.Fprintf(&b, "\n%s\n", body)
+	return b.String()
+}
+
+// digestChunks splits the messages into groups whose descriptions fit in
+// maxTokens. A message too long on its own still gets a chunk.
+func digestChunks(blocks []string, maxTokens int) [][]int {
+	var chunks [][]int
+	var current []int
+	used := 0
+	for i, block := range blocks {
+		tokens := EstimateTokens(block)
+		if len(current) > 0 && maxTokens > 0 && used+tokens > maxTokens {
+			chunks = append(chunks, current)
+			current, used = nil, 0
+		}
+		current = append(current, i)
+		used += tokens
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, current)
+	}
+	return chunks
+}
+
+// parseDigestResponse reads the JSON object in the model's answer, which may
+// be wrapped in a code fence or a sentence
+func parseDigestResponse(text string) (*digestResponse, error) {
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("AI response has no JSON object: %q", truncateForError(text))
+	}
+	var response digestResponse
+	if err := json.Unmarshal([]byte(text[start:end+1]), &response); err != nil {
+		return nil, fmt.Errorf("failed to parse AI response: %v", err)
+	}
+	return &response, nil
+}
+
+func truncateForError(text string) string {
+	if len(text) > 200 {
+		return text[:200] + "..."
+	}
+	return text
+}
+
+// GenerateDigest summarises the messages with the AI backend, sending them in
+// chunks that fit maxContextTokens. Progress goes to progress when set.
+func GenerateDigest(ctx context.Context, backend AIBackend, emails []*Email, timeRange TimeRange, maxContextTokens int, progress io.Writer) (*Digest, error) {
+	digest := &Digest{
+		Range:       timeRange.Name,
+		Since:       timeRange.Since,
+		Until:       timeRange.Until,
+		Total:       len(emails),
+		GeneratedAt: time.Now(),
+	}
+
+	// Oldest first, so threads read in order
+	emails = append([]*Email(nil), emails...)
+	sort.SliceStable(emails, func(i, j int) bool { return emails[i].Date.Before(emails[j].Date) })
+
+	blocks := make([]string, len(emails))
+	for i, email := range emails {
+		blocks[i] = digestBlock(fmt.Sprintf("m%d", i+1), email)
+	}
+	chunks := digestChunks(blocks, maxContextTokens)
+
+	classified := make(map[int]bool)
+	for n, chunk := range chunks {
+		if progress != nil {
+			fmt.Fprintf(progress, "🤖 Summarising %d message(s) with %s (%d/%d)...\n", len(chunk), backend.Name(), n+1, len(chunks))
+		}
+		refs := make(map[string]int)
+		var described strings.Builder
+		for _, i := range chunk {
+			refs[fmt.Sprintf("m%d", i+1)] = i
+			described.WriteString(blocks[i] + "\n")
+		}
+
+		answer, err := backend.Complete(ctx, &AIRequest{
+			System:   digestSystemPrompt,
+			Context:  described.String(),
+			Messages: []AIMessage{{Role: "user", Content: fmt.Sprintf("Sort these %d messages.", len(chunk))}},
+		}, nil)
+		if err != nil {
+			return nil, err
+		}
+		response, err := parseDigestResponse(answer)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, category := range []struct {
+			items []digestResponseItem
+			into  *[]DigestItem
+		}{
+			{response.ActionRequired, &digest.ActionRequired},
+			{response.AwaitingReply, &digest.AwaitingReply},
+			{response.FYI, &digest.FYI},
+			{response.Newsletters, &digest.Newsletters},
+		} {
+			for _, item := range category.items {
+				var messages []DigestRef
+				for _, ref := range item.IDs {
+					// Refs from another chunk or made up by the model are ignored
+					i, ok := refs[strings.Trim(ref, "[] ")]
+					if !ok || classified[i] {
+						continue
+					}
+					classified[i] = true
+					messages = append(messages, digestRef(emails[i]))
+				}
+				if len(messages) > 0 {
+					*category.into = append(*category.into, DigestItem{Summary: strings.TrimSpace(item.Summary), Messages: messages})
+				}
+			}
+		}
+	}
+
+	for i, email := range emails {
+		if !classified[i] {
+			digest.Unclassified = append(digest.Unclassified, digestRef(email))
+		}
+	}
+	return digest, nil
+}
+
+func digestRef(email *Email) DigestRef {
+	return DigestRef{MessageID: email.MessageID, From: email.From, Subject: email.Subject, Date: email.Date}
+}
+
+// FormatDigestMarkdown renders the digest as markdown, each item followed by
+// the messages it covers
+func FormatDigestMarkdown(digest *Digest) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "# Email digest: %s\n\n", digest.Range)
+	fmt.Fprintf(&out, "%d message(s) from %s to %s.\n", digest.Total,
+		digest.Since.Format("Jan 2, 3:04 PM"), digest.Until.Format("Jan 2, 3:04 PM"))
+
+	for _, section := range []struct {
+		title string
+		items []DigestItem
+	}{
+		{"Action required", digest.ActionRequired},
+		{"Awaiting your reply", digest.AwaitingReply},
+		{"FYI", digest.FYI},
+		{"Newsletters", digest.Newsletters},
+	} {
+		if len(section.items) == 0 {
+			continue
+		}
+		fmt.Fprintf(&out, "\n## %s\n\n", section.title)
+		for _, item := range section.items {
+			fmt.Fprintf(&out, "- %s\n", item.Summary)
+			for _, ref := range item.Messages {
+				fmt.Fprintf(&out, "  - %s\n", formatDigestRef(ref))
+			}
+		}
+	}
+
+	if len(digest.Unclassified) > 0 {
+		out.WriteString("\n## Not summarised\n\n")
+		for _, ref := range digest.Unclassified {
+			fmt.Fprintf(&out, "- %s\n", formatDigestRef(ref))
+		}
+	}
+	return out.String()
+}
+
+func formatDigestRef(ref DigestRef) string {
+	line := fmt.Sprintf("%s: %q", ref.From, ref.Subject)
+	if ref.MessageID != "" {
+		line += fmt.Sprintf(" `%s`", ref.MessageID)
+	}
+	return line
+}
+
+// DigestOptions select the messages for a digest
+type DigestOptions struct {
+	AccountEmail string
+	Range        string    // A report time range such as "today" or "yesterday"
+	Progress     io.Writer // Where progress notes go
+}
+
+// CreateDigest summarises the account's archived messages for a time range
+// with the configured AI backend. Run 'mailos sync' first for the latest mail.
+func CreateDigest(opts DigestOptions) (*Digest, error) {
+	setup, err := InitializeMailSetup(opts.AccountEmail)
+	if err != nil {
+		return nil, err
+	}
+	config := setup.Config
+
+	rangeName := opts.Range
+	if rangeName == "" {
+		rangeName = "today"
+	}
+	timeRange, err := ParseTimeRangeString(rangeName)
+	if err != nil {
+		return nil, err
+	}
+
+	archived, err := GetEmailsFromInbox(config.Email, ReadOptions{Since: timeRange.Since})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the local archive: %v", err)
+	}
+	var emails []*Email
+	for _, email := range archived {
+		if !email.Date.After(timeRange.Until) {
+			emails = append(emails, email)
+		}
+	}
+	if len(emails) == 0 {
+		return &Digest{Range: timeRange.Name, Since: timeRange.Since, Until: timeRange.Until, GeneratedAt: time.Now()}, nil
+	}
+
+	backend, err := NewAIBackend(config)
+	if err != nil {
+		return nil, err
+	}
+	return GenerateDigest(context.Background(), backend, emails, *timeRange, config.GetAISettings().MaxContextTokens, opts.Progress)
+}
+
+// SendDigest emails the digest to the account's own address
+func SendDigest(accountEmail string, digest *Digest) error {
+	setup, err := InitializeMailSetup(accountEmail)
+	if err != nil {
+		return err
+	}
+	self, _ := senderAddress(setup.Config)
+
+	body := FormatDigestMarkdown(digest)
+	msg := &EmailMessage{
+		To:       []string{self},
+		Subject:  fmt.Sprintf("Email digest: %s (%d messages)", digest.Range, digest.Total),
+		Body:     body,
+		BodyHTML: MarkdownToHTMLContent(body),
+	}
+	return SendWithAccount(msg, accountEmail)
+}
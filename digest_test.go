@@ -0,0 +1,102 @@
+package mailos
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeAIBackend answers requests in order and records them
+type fakeAIBackend struct {
+	answers  []string
+	requests []*AIRequest
+}
+
+func (b *fakeAIBackend) Name() string { return "fake" }
+
+func (b *fakeAIBackend) Complete(ctx context.Context, req *AIRequest, stream io.Writer) (string, error) {
+	b.requests = append(b.requests, req)
+	if len(b.requests) > len(b.answers) {
+		return "", fmt.Errorf("unexpected request %d", len(b.requests))
+	}
+	return b.answers[len(b.requests)-1], nil
+}
+
+func TestGenerateDigest(t *testing.T) {
+	day := time.Date(2024, 3, 6, 0, 0, 0, 0, time.UTC)
+	emails := []*Email{
+		{MessageID: "<invoice@vendor.example>", From: "Billing <billing@vendor.example>", Subject: "Invoice due Friday", Date: day.Add(9 * time.Hour), Body: "Please pay invoice 42 by Friday."},
+		{MessageID: "<news@letters.example>", From: "Weekly <news@letters.example>", Subject: "This week in Go", Date: day.Add(8 * time.Hour), Body: "Top stories.",
+			Headers: map[string][]string{"List-Unsubscribe": {"<mailto:unsub@letters.example>"}}},
+		{MessageID: "<lunch@example.org>", From: "Ana <ana@example.org>", Subject: "Lunch?", Date: day.Add(10 * time.Hour), Body: strings.Repeat("Are you free on Thursday? ", 40)},
+		{MessageID: "<lunch-2@example.org>", From: "Ana <ana@example.org>", Subject: "Re: Lunch?", Date: day.Add(11 * time.Hour), InReplyTo: "<lunch@example.org>", Body: "Or Friday works too."},
+		{MessageID: "<deploy@ci.example>", From: "CI <ci@ci.example>", Subject: "Deploy finished", Date: day.Add(12 * time.Hour), Body: "Build 118 deployed."},
+	}
+
+	backend := &fakeAIBackend{answers: []string{
+		// Messages are sent oldest first: m1 newsletter, m2 invoice, m3 and m4 lunch
+		"Here you go:\n```json\n{\"action_required\": [{\"ids\": [\"m2\"], \"summary\": \"Pay invoice 42 by Friday.\"}], \"newsletters\": [{\"ids\": [\"m1\", \"m9\"], \"summary\": \"Go weekly news.\"}]}\n```",
+		`{"awaiting_reply": [{"ids": ["[m3]", "m4", "m1"], "summary": "Ana asks about lunch Thursday or Friday."}], "fyi": [{"ids": ["m2"], "summary": "Duplicate"}]}`,
+		`{"fyi": []}`,
+	}}
+	timeRange := TimeRange{Name: "Today", Since: day, Until: day.Add(24 * time.Hour)}
+
+	// Small enough that the messages need three requests; the long one goes alone
+	digest, err := GenerateDigest(context.Background(), backend, emails, timeRange, 250, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backend.requests) != 3 {
+		t.Fatalf("Expected 3 chunks, got %d", len(backend.requests))
+	}
+	first := backend.requests[0].Context
+	if !strings.HasPrefix(first, "[m1]\nFrom: Weekly <news@letters.example>") || !strings.Contains(first, "Mailing list: yes") || !strings.Contains(first, "[m2]") {
+		t.Errorf("Unexpected first chunk:\n%s", first)
+	}
+	for i, req := range backend.requests {
+		if EstimateTokens(req.Context) > 250 && i != 1 {
+			t.Errorf("Chunk %d is over the limit: %d tokens", i+1, EstimateTokens(req.Context))
+		}
+	}
+
+	if digest.Total != 5 || len(digest.ActionRequired) != 1 || len(digest.Newsletters) != 1 || len(digest.AwaitingReply) != 1 || len(digest.FYI) != 0 {
+		t.Fatalf("Unexpected digest: %+v", digest)
+	}
+	// Refs the model made up, or gave for another chunk, are ignored
+	if refs := digest.Newsletters[0].Messages; len(refs) != 1 || refs[0].MessageID != "<news@letters.example>" {
+		t.Errorf("Unexpected newsletter refs: %+v", refs)
+	}
+	if refs := digest.AwaitingReply[0].Messages; len(refs) != 1 || refs[0].MessageID != "<lunch@example.org>" {
+		t.Errorf("Expected only m3 from the second chunk, got %+v", refs)
+	}
+	if len(digest.Unclassified) != 2 || digest.Unclassified[0].MessageID != "<lunch-2@example.org>" {
+		t.Errorf("Expected the messages the model skipped listed, got %+v", digest.Unclassified)
+	}
+
+	out := FormatDigestMarkdown(digest)
+	for _, want := range []string{
+		"# Email digest: Today",
+		"## Action required\n\n- Pay invoice 42 by Friday.\n  - Billing <billing@vendor.example>: \"Invoice due Friday\" `<invoice@vendor.example>`",
+		"## Awaiting your reply",
+		"## Not summarised\n\n- Ana <ana@example.org>: \"Re: Lunch?\"",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "## FYI") {
+		t.Errorf("Expected empty sections left out:\n%s", out)
+	}
+}
+
+func TestParseDigestResponse(t *testing.T) {
+	if _, err := parseDigestResponse("I can't help with that."); err == nil {
+		t.Errorf("Expected an answer without JSON refused")
+	}
+	if _, err := parseDigestResponse(`{"fyi": [{"ids": "m1"}]}`); err == nil {
+		t.Errorf("Expected malformed JSON refused")
+	}
+}
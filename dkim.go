@@ -0,0 +1,366 @@
+package mailos
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DKIM verification results
+const (
+	DKIMPass       = "pass"
+	DKIMFail       = "fail"
+	DKIMUnverified = "unverified" // No cached or supplied key for the selector
+)
+
+// DKIMResult is the offline verification result of one DKIM-Signature header
+type DKIMResult struct {
+	Domain   string `json:"domain"`
+	Selector string `json:"selector"`
+	Result   string `json:"result"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// ErrDKIMKeyNotFound is returned by DKIMKeys when no record is available
+var ErrDKIMKeyNotFound = errors.New("no DKIM key record")
+
+// DKIMKeys supplies DKIM key records ("v=DKIM1; k=rsa; p=...") without DNS
+type DKIMKeys interface {
+	LookupDKIMKey(domain, selector string) (string, error)
+}
+
+// DKIMKeyDir reads key records from <selector>._domainkey.<domain>.txt files,
+// such as the output of dig +short TXT saved to the directory
+type DKIMKeyDir string
+
+// LookupDKIMKey reads the key record for the selector from the directory
+func (d DKIMKeyDir) LookupDKIMKey(domain, selector string) (string, error) {
+	name := strings.ToLower(selector + "._domainkey." + strings.TrimSuffix(domain, ".") + ".txt")
+	if strings.ContainsAny(name, `/\`) {
+		return "", ErrDKIMKeyNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(string(d), name))
+	if os.IsNotExist(err) {
+		return "", ErrDKIMKeyNotFound
+	} else if err != nil {
+		return "", fmt.Errorf("failed to read DKIM key: %v", err)
+	}
+	return joinTXTRecord(string(data)), nil
+}
+
+var txtStringPattern = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"`)
+
+// joinTXTRecord joins the quoted strings of a TXT record as printed by dig
+func joinTXTRecord(record string) string {
+	if !strings.Contains(record, `"`) {
+		return strings.TrimSpace(record)
+	}
+	var joined strings.Builder
+	for _, match := range txtStringPattern.FindAllStringSubmatch(record, -1) {
+		joined.WriteString(strings.ReplaceAll(match[1], `\"`, `"`))
+	}
+	return joined.String()
+}
+
+var dkimKeyDir string
+
+// SetDKIMKeyDir sets the directory of DKIM key records used when parsing
+// messages. An empty dir restores the default, ~/.email/dkim-keys.
+func SetDKIMKeyDir(dir string) {
+	dkimKeyDir = dir
+}
+
+// defaultDKIMKeys returns the key records used when parsing messages
+func defaultDKIMKeys() DKIMKeys {
+	if dkimKeyDir != "" {
+		return DKIMKeyDir(dkimKeyDir)
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return DKIMKeyDir("")
+	}
+	return DKIMKeyDir(filepath.Join(homeDir, ".email", "dkim-keys"))
+}
+
+// rawHeaderField is a header field exactly as it appears in the message
+type rawHeaderField struct {
+	name string
+	raw  string // Including folding and the trailing CRLF
+}
+
+// splitRawMessage normalizes line endings to CRLF and splits the header
+// fields from the body
+func splitRawMessage(raw []byte) ([]rawHeaderField, []byte) {
+	normalized := bytes.ReplaceAll(raw, []byte("\r\n"), []byte("\n"))
+	normalized = bytes.ReplaceAll(normalized, []byte("\n"), []byte("\r\n"))
+
+	var body []byte
+	header := normalized
+	if idx := bytes.Index(normalized, []byte("\r\n\r\n")); idx >= 0 {
+		header = normalized[:idx+2]
+		body = normalized[idx+4:]
+	}
+
+	var fields []rawHeaderField
+	for _, line := range strings.SplitAfter(string(header), "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1].raw += line
+			continue
+		}
+		name := line
+		if idx := strings.Index(line, ":"); idx >= 0 {
+			name = line[:idx]
+		}
+		fields = append(fields, rawHeaderField{name: strings.TrimSpace(name), raw: line})
+	}
+	return fields, body
+}
+
+// parseTagList parses a "tag=value; tag=value" list as used by DKIM
+func parseTagList(s string) map[string]string {
+	tags := make(map[string]string)
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		tags[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return tags
+}
+
+var whitespacePattern = regexp.MustCompile(`[ \t\r\n]+`)
+
+// stripWhitespace removes the folding whitespace allowed inside base64 and lists
+func stripWhitespace(s string) string {
+	return whitespacePattern.ReplaceAllString(s, "")
+}
+
+// canonicalHeader applies the simple or relaxed header canonicalization
+func canonicalHeader(field rawHeaderField, relaxed bool) string {
+	if !relaxed {
+		return field.raw
+	}
+	name, value, _ := strings.Cut(field.raw, ":")
+	value = whitespacePattern.ReplaceAllString(value, " ")
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.TrimSpace(value) + "\r\n"
+}
+
+var trailingSpacePattern = regexp.MustCompile(`[ \t]+\r\n`)
+var spaceRunPattern = regexp.MustCompile(`[ \t]+`)
+
+// canonicalBody applies the simple or relaxed body canonicalization
+func canonicalBody(body []byte, relaxed bool) []byte {
+	s := string(body)
+	if relaxed {
+		s = spaceRunPattern.ReplaceAllString(s, " ")
+		s = trailingSpacePattern.ReplaceAllString(s, "\r\n")
+		if strings.HasSuffix(s, " ") {
+			s = strings.TrimRight(s, " ")
+		}
+	}
+	s = strings.TrimRight(s, "\r\n")
+	if s == "" {
+		if relaxed {
+			return nil
+		}
+		return []byte("\r\n")
+	}
+	return []byte(s + "\r\n")
+}
+
+// withoutSignature empties the b= tag of a DKIM-Signature header, keeping the rest as is
+func withoutSignature(raw string) string {
+	parts := strings.Split(raw, ";")
+	for i, part := range parts {
+		name, _, ok := strings.Cut(part, "=")
+		if ok && strings.TrimSpace(name) == "b" {
+			parts[i] = part[:strings.Index(part, "=")+1]
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+// VerifyDKIM verifies every DKIM-Signature header of a raw message using
+// key records from keys, without DNS lookups
+func VerifyDKIM(raw []byte, keys DKIMKeys) []DKIMResult {
+	fields, body := splitRawMessage(raw)
+	var results []DKIMResult
+	for _, field := range fields {
+		if strings.EqualFold(field.name, "DKIM-Signature") {
+			results = append(results, verifyDKIMSignature(field, fields, body, keys, time.Now()))
+		}
+	}
+	return results
+}
+
+func verifyDKIMSignature(sig rawHeaderField, fields []rawHeaderField, body []byte, keys DKIMKeys, now time.Time) DKIMResult {
+	_, value, _ := strings.Cut(sig.raw, ":")
+	tags := parseTagList(value)
+	result := DKIMResult{Domain: strings.ToLower(tags["d"]), Selector: tags["s"], Result: DKIMFail}
+	fail := func(format string, args ...interface{}) DKIMResult {
+		result.Reason = fmt.Sprintf(format, args...)
+		return result
+	}
+
+	if tags["v"] != "1" {
+		return fail("unsupported version %q", tags["v"])
+	}
+	for _, required := range []string{"a", "b", "bh", "d", "h", "s"} {
+		if tags[required] == "" {
+			return fail("missing %s= tag", required)
+		}
+	}
+	signedHeaders := strings.Split(stripWhitespace(tags["h"]), ":")
+	signsFrom := false
+	for _, name := range signedHeaders {
+		signsFrom = signsFrom || strings.EqualFold(name, "From")
+	}
+	if !signsFrom {
+		return fail("From header is not signed")
+	}
+	if identity := tags["i"]; identity != "" {
+		_, identityDomain, _ := strings.Cut(identity, "@")
+		identityDomain = strings.ToLower(identityDomain)
+		if identityDomain != result.Domain && !strings.HasSuffix(identityDomain, "."+result.Domain) {
+			return fail("identity %s is outside %s", identity, result.Domain)
+		}
+	}
+	if expires := tags["x"]; expires != "" {
+		if seconds, err := strconv.ParseInt(expires, 10, 64); err == nil && now.Unix() > seconds {
+			return fail("signature expired %s", time.Unix(seconds, 0).Format("Jan 2, 2006"))
+		}
+	}
+
+	algorithm, hashName, _ := strings.Cut(strings.ToLower(tags["a"]), "-")
+	var hashType crypto.Hash
+	var newHash func() hash.Hash
+	switch hashName {
+	case "sha256":
+		hashType, newHash = crypto.SHA256, sha256.New
+	case "sha1":
+		// RFC 8301: verifiers must not accept SHA-1 signatures
+		return fail("%s is no longer accepted", tags["a"])
+	default:
+		return fail("unsupported algorithm %s", tags["a"])
+	}
+
+	headerCanon, bodyCanon, _ := strings.Cut(strings.ToLower(tags["c"]), "/")
+	if bodyCanon == "" {
+		bodyCanon = "simple"
+	}
+
+	// Body hash
+	canonical := canonicalBody(body, bodyCanon == "relaxed")
+	if length := tags["l"]; length != "" {
+		n, err := strconv.Atoi(length)
+		if err != nil || n < 0 || n > len(canonical) {
+			return fail("invalid body length %s", length)
+		}
+		canonical = canonical[:n]
+	}
+	bodyHash := newHash()
+	bodyHash.Write(canonical)
+	if base64.StdEncoding.EncodeToString(bodyHash.Sum(nil)) != stripWhitespace(tags["bh"]) {
+		return fail("body hash does not match")
+	}
+
+	// Signed headers, each taken from the bottom up
+	relaxed := headerCanon == "relaxed"
+	used := make(map[int]bool)
+	headerHash := newHash()
+	for _, name := range signedHeaders {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(fields[i].name, name) {
+				used[i] = true
+				headerHash.Write([]byte(canonicalHeader(fields[i], relaxed)))
+				break
+			}
+		}
+	}
+	unsigned := canonicalHeader(rawHeaderField{name: sig.name, raw: withoutSignature(sig.raw)}, relaxed)
+	headerHash.Write([]byte(strings.TrimSuffix(unsigned, "\r\n")))
+	digest := headerHash.Sum(nil)
+
+	signature, err := base64.StdEncoding.DecodeString(stripWhitespace(tags["b"]))
+	if err != nil {
+		return fail("invalid signature encoding")
+	}
+
+	record, err := keys.LookupDKIMKey(result.Domain, result.Selector)
+	if err != nil {
+		result.Result = DKIMUnverified
+		if errors.Is(err, ErrDKIMKeyNotFound) {
+			result.Reason = fmt.Sprintf("no key record for %s._domainkey.%s", result.Selector, result.Domain)
+		} else {
+			result.Reason = err.Error()
+		}
+		return result
+	}
+	keyTags := parseTagList(record)
+	keyData := stripWhitespace(keyTags["p"])
+	if keyData == "" {
+		return fail("key revoked")
+	}
+	der, err := base64.StdEncoding.DecodeString(keyData)
+	if err != nil {
+		return fail("invalid key record")
+	}
+	keyType := strings.ToLower(keyTags["k"])
+	if keyType == "" {
+		keyType = "rsa"
+	}
+	if keyType != algorithm {
+		return fail("key type %s does not match algorithm %s", keyType, tags["a"])
+	}
+
+	switch algorithm {
+	case "rsa":
+		publicKey, err := parseRSAPublicKey(der)
+		if err != nil {
+			return fail("invalid key record")
+		}
+		if err := rsa.VerifyPKCS1v15(publicKey, hashType, digest, signature); err != nil {
+			return fail("signature does not verify")
+		}
+	case "ed25519":
+		if len(der) != ed25519.PublicKeySize || hashType != crypto.SHA256 {
+			return fail("invalid key record")
+		}
+		if !ed25519.Verify(ed25519.PublicKey(der), digest, signature) {
+			return fail("signature does not verify")
+		}
+	default:
+		return fail("unsupported algorithm %s", tags["a"])
+	}
+
+	result.Result = DKIMPass
+	return result
+}
+
+// parseRSAPublicKey accepts SubjectPublicKeyInfo keys and the bare RSA keys some domains publish
+func parseRSAPublicKey(der []byte) (*rsa.PublicKey, error) {
+	if key, err := x509.ParsePKIXPublicKey(der); err == nil {
+		if rsaKey, ok := key.(*rsa.PublicKey); ok {
+			return rsaKey, nil
+		}
+		return nil, fmt.Errorf("not an RSA key")
+	}
+	return x509.ParsePKCS1PublicKey(der)
+}
@@ -0,0 +1,109 @@
+package mailos
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyDKIM(t *testing.T) {
+	raw, err := os.ReadFile(filepath.Join("testdata", "auth", "dkim-signed.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := DKIMKeyDir(filepath.Join("testdata", "auth", "keys"))
+
+	t.Run("Pass", func(t *testing.T) {
+		results := VerifyDKIM(raw, keys)
+		if len(results) != 2 {
+			t.Fatalf("Expected 2 signatures, got %+v", results)
+		}
+		// relaxed/relaxed with rsa-sha256, then simple/simple with ed25519-sha256
+		for _, result := range results {
+			if result.Result != DKIMPass || result.Domain != "example.com" {
+				t.Errorf("Expected the %s signature to pass, got %+v", result.Selector, result)
+			}
+		}
+	})
+
+	t.Run("BareLineEndings", func(t *testing.T) {
+		results := VerifyDKIM(bytes.ReplaceAll(raw, []byte("\r\n"), []byte("\n")), keys)
+		if len(results) != 2 || results[0].Result != DKIMPass || results[1].Result != DKIMPass {
+			t.Errorf("Expected LF line endings to verify, got %+v", results)
+		}
+	})
+
+	t.Run("Relaxed", func(t *testing.T) {
+		// Whitespace changes only break the simple signature
+		reflowed := bytes.Replace(raw, []byte("invoice   for"), []byte("invoice for"), 1)
+		results := VerifyDKIM(reflowed, keys)
+		if results[0].Result != DKIMPass || results[1].Result != DKIMFail {
+			t.Errorf("Expected relaxed to pass and simple to fail, got %+v", results)
+		}
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		tampered := bytes.Replace(raw, []byte("Subject:   Your  invoice"), []byte("Subject:   Your  receipt"), 1)
+		for _, result := range VerifyDKIM(tampered, keys) {
+			if result.Result != DKIMFail || result.Reason != "signature does not verify" {
+				t.Errorf("Expected a changed subject to fail, got %+v", result)
+			}
+		}
+		tampered = bytes.Replace(raw, []byte("September is"), []byte("October is"), 1)
+		for _, result := range VerifyDKIM(tampered, keys) {
+			if result.Result != DKIMFail || result.Reason != "body hash does not match" {
+				t.Errorf("Expected a changed body to fail, got %+v", result)
+			}
+		}
+	})
+
+	t.Run("NoKey", func(t *testing.T) {
+		for _, result := range VerifyDKIM(raw, DKIMKeyDir(t.TempDir())) {
+			if result.Result != DKIMUnverified {
+				t.Errorf("Expected unverified without a key, got %+v", result)
+			}
+		}
+	})
+
+	t.Run("SHA1", func(t *testing.T) {
+		fields, body := splitRawMessage(raw)
+		sig := fields[2]
+		sig.raw = strings.Replace(sig.raw, "a=rsa-sha256", "a=rsa-sha1", 1)
+		result := verifyDKIMSignature(sig, fields, body, keys, time.Now())
+		if result.Result != DKIMFail || result.Reason != "rsa-sha1 is no longer accepted" {
+			t.Errorf("Expected rsa-sha1 refused, got %+v", result)
+		}
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		fields, body := splitRawMessage(raw)
+		sig := fields[2]
+		sig.raw = "DKIM-Signature: x=1725271300; " + sig.raw[len("DKIM-Signature: "):]
+		result := verifyDKIMSignature(sig, fields, body, keys, time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC))
+		if result.Result != DKIMFail || result.Reason != "signature expired Sep 2, 2024" {
+			t.Errorf("Expected an expired signature to fail, got %+v", result)
+		}
+	})
+}
+
+func TestCanonicalBody(t *testing.T) {
+	tests := []struct {
+		body    string
+		relaxed bool
+		want    string
+	}{
+		{"", false, "\r\n"},
+		{"", true, ""},
+		{"a  b \t\r\n\r\n\r\n", true, "a b\r\n"},
+		{"a  b \r\n\r\n", false, "a  b \r\n"},
+		{"no newline", false, "no newline\r\n"},
+	}
+	for _, tt := range tests {
+		if got := string(canonicalBody([]byte(tt.body), tt.relaxed)); got != tt.want {
+			t.Errorf("canonicalBody(%q, %v) = %q, want %q", tt.body, tt.relaxed, got, tt.want)
+		}
+	}
+}
@@ -42,16 +42,20 @@ type DraftsOptions struct {
 
 // DraftEmail represents an email draft with metadata
 type DraftEmail struct {
-	To          []string
-	CC          []string
-	BCC         []string
-	Subject     string
-	Body        string
-	Attachments []string
-	SendAfter   *time.Time
-	Priority    string
-	InReplyTo   string   // For threading: the Message-ID of the email being replied to
-	References  []string // For threading: chain of Message-IDs in the conversation
+	To              []string
+	CC              []string
+	BCC             []string
+	Subject         string
+	Body            string
+	BodyHTML        string // Optional HTML alternative to Body
+	Attachments     []string
+	AttachmentParts []OutgoingAttachment // In-memory attachments, e.g. from a forwarded message
+	InlineImages    []InlineImage        // Images referenced by cid: in BodyHTML
+	SendAfter       *time.Time
+	Priority        string
+	InReplyTo       string   // For threading: the Message-ID of the email being replied to
+	References      []string // For threading: chain of Message-IDs in the conversation
+	Signature       string   // Named signature to send with, or "none"
 }
 
 // SimpleDraftReference represents a simplified way to reference drafts
@@ -380,7 +384,7 @@ func DraftsCommand(opts DraftsOptions) error {
 		if err != nil {
 			// Don't fail the whole operation if IMAP save fails
 			fmt.Printf("⚠️  Could not save draft to email account: %v\n", err)
-		} else {
+		} else if uid != 0 {
 			fmt.Printf("✓ Saved draft to email account's Drafts folder (UID: %d)\n", uid)
 		}
 	}
@@ -524,65 +528,44 @@ func saveDraftToIMAP(draft DraftEmail) (uint32, error) {
 		return 0, fmt.Errorf("failed to load config: %v", err)
 	}
 
-	// Build the email message in RFC 822 format
-	var message bytes.Buffer
-	
-	// Use FromEmail if specified, otherwise use the account email
-	fromEmail := config.Email
-	if config.FromEmail != "" {
-		fromEmail = config.FromEmail
-	}
-	
-	from := fromEmail
-	if config.FromName != "" {
-		from = fmt.Sprintf("%s <%s>", config.FromName, fromEmail)
+	attachments, err := loadAttachmentFiles(draft.Attachments)
+	if err != nil {
+		return 0, err
 	}
+	attachments = append(attachments, draft.AttachmentParts...)
 
-	// Write headers
-	message.WriteString(fmt.Sprintf("From: %s\r\n", from))
-	message.WriteString(fmt.Sprintf("To: %s\r\n", strings.Join(draft.To, ", ")))
-	if len(draft.CC) > 0 {
-		message.WriteString(fmt.Sprintf("Cc: %s\r\n", strings.Join(draft.CC, ", ")))
-	}
-	if len(draft.BCC) > 0 {
-		message.WriteString(fmt.Sprintf("Bcc: %s\r\n", strings.Join(draft.BCC, ", ")))
-	}
-	message.WriteString(fmt.Sprintf("Subject: %s\r\n", draft.Subject))
-	message.WriteString(fmt.Sprintf("Date: %s\r\n", time.Now().Format(time.RFC1123Z)))
-	
-	// Add threading headers if this is a reply
-	if draft.InReplyTo != "" {
-		// Ensure Message-ID is wrapped in angle brackets
-		inReplyTo := draft.InReplyTo
-		if !strings.HasPrefix(inReplyTo, "<") {
-			inReplyTo = "<" + inReplyTo + ">"
-		}
-		message.WriteString(fmt.Sprintf("In-Reply-To: %s\r\n", inReplyTo))
-	}
-	
-	if len(draft.References) > 0 {
-		// Ensure all Message-IDs in References are wrapped in angle brackets
-		var refs []string
-		for _, ref := range draft.References {
-			if !strings.HasPrefix(ref, "<") {
-				refs = append(refs, "<"+ref+">")
-			} else {
-				refs = append(refs, ref)
-			}
-		}
-		message.WriteString(fmt.Sprintf("References: %s\r\n", strings.Join(refs, " ")))
-	}
-	
-	// Add a draft header to indicate this is a draft
-	message.WriteString("X-Draft: true\r\n")
+	_, from := senderAddress(config)
+	headers := map[string]string{"X-Draft": "true"}
 	if draft.Priority != "" && draft.Priority != "normal" {
-		message.WriteString(fmt.Sprintf("X-Priority: %s\r\n", draft.Priority))
+		headers["X-Priority"] = draft.Priority
+	}
+
+	// Drafts keep Bcc so it is still there when the draft is sent
+	messageID := generateMessageID(config.Email)
+	raw, err := BuildMessage(&OutgoingMessage{
+		From:         from,
+		To:           draft.To,
+		CC:           draft.CC,
+		BCC:          draft.BCC,
+		Subject:      draft.Subject,
+		Date:         time.Now(),
+		MessageID:    messageID,
+		InReplyTo:    draft.InReplyTo,
+		References:   draft.References,
+		Headers:      headers,
+		TextBody:     draft.Body,
+		HTMLBody:     draft.BodyHTML,
+		InlineImages: draft.InlineImages,
+		Attachments:  attachments,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to build draft: %v", err)
+	}
+
+	// Offline, the draft is appended once the server is reachable again
+	if queued, err := queueDraftIfOffline(config, nil, raw, messageID, draft.Subject); queued {
+		return 0, err
 	}
-	
-	message.WriteString("MIME-Version: 1.0\r\n")
-	message.WriteString("Content-Type: text/plain; charset=\"UTF-8\"\r\n")
-	message.WriteString("\r\n")
-	message.WriteString(draft.Body)
 
 	// Connect to IMAP server
 	imapHost, imapPort, err := config.GetIMAPSettings()
@@ -598,6 +581,9 @@ func saveDraftToIMAP(draft DraftEmail) (uint32, error) {
 	if err != nil {
 		// Try without TLS
 		c, err = client.Dial(addr)
+		if queued, err := queueDraftIfOffline(config, err, raw, messageID, draft.Subject); queued {
+			return 0, err
+		}
 		if err != nil {
 			return 0, fmt.Errorf("failed to connect to IMAP server: %v", err)
 		}
@@ -671,12 +657,7 @@ func saveDraftToIMAP(draft DraftEmail) (uint32, error) {
 	flags := []string{imap.DraftFlag} // Mark as draft
 	date := time.Now()
 	
-	messageStr := message.String()
-	// Ensure CRLF line endings
-	messageWithCRLF := strings.ReplaceAll(messageStr, "\n", "\r\n")
-	messageWithCRLF = strings.ReplaceAll(messageWithCRLF, "\r\r\n", "\r\n")
-	
-	err = c.Append(selectedFolder, flags, date, strings.NewReader(messageWithCRLF))
+	err = c.Append(selectedFolder, flags, date, bytes.NewReader(raw))
 	if err != nil {
 		return 0, fmt.Errorf("failed to save draft to %s folder: %v", selectedFolder, err)
 	}
@@ -897,16 +878,16 @@ func findDraftsFolder(c *client.Client) (string, error) {
 	
 	var selectedFolder string
 	for m := range mailboxes {
-		// Check if this is a drafts folder
+		// Check if this is a drafts folder; keep reading so List can finish
+		if selectedFolder != "" {
+			continue
+		}
 		for _, draftName := range draftFolderNames {
 			if strings.EqualFold(m.Name, draftName) || strings.Contains(strings.ToLower(m.Name), "draft") {
 				selectedFolder = m.Name
 				break
 			}
 		}
-		if selectedFolder != "" {
-			break
-		}
 	}
 	
 	if err := <-done; err != nil {
@@ -1118,7 +1099,7 @@ func CreateDraftFromMarkdownFile(filePath string) error {
 	uid, err := saveDraftToIMAP(draft)
 	if err != nil {
 		fmt.Printf("⚠️  Could not save draft to email account: %v\n", err)
-	} else {
+	} else if uid != 0 {
 		fmt.Printf("✓ Saved draft to email account's Drafts folder (UID: %d)\n", uid)
 	}
 	
@@ -177,6 +177,12 @@ func ParseMarkdownEmail(filepath string) (*EmailData, error) {
 					}
 				case "priority":
 					emailData.Priority = value
+				case "message_id":
+					emailData.MessageID = value
+				case "in_reply_to":
+					emailData.InReplyTo = value
+				case "references":
+					emailData.References = value
 				}
 			}
 		} else if frontMatterStarted {
@@ -0,0 +1,58 @@
+package mailos
+
+import "strings"
+
+// decodeFlowed joins the soft line breaks of a format=flowed text/plain body
+// (RFC 3676) back into paragraphs. Quote markers are normalized to ">" per
+// level followed by a space.
+func decodeFlowed(text string, delSp bool) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	var out []string
+	var paragraph strings.Builder
+	paragraphDepth := -1
+	flush := func() {
+		if paragraphDepth < 0 {
+			return
+		}
+		out = append(out, quotePrefix(paragraphDepth)+paragraph.String())
+		paragraph.Reset()
+		paragraphDepth = -1
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		depth := 0
+		for strings.HasPrefix(line, ">") {
+			depth++
+			line = line[1:]
+		}
+		// Space-stuffing protects lines starting with a space, ">" or "From "
+		line = strings.TrimPrefix(line, " ")
+
+		// A paragraph only continues at the same quote depth
+		if paragraphDepth >= 0 && paragraphDepth != depth {
+			flush()
+		}
+
+		flowed := strings.HasSuffix(line, " ") && line != "-- "
+		if flowed && delSp {
+			line = strings.TrimSuffix(line, " ")
+		}
+		paragraph.WriteString(line)
+		paragraphDepth = depth
+		if !flowed {
+			flush()
+		}
+	}
+	flush()
+
+	return strings.Join(out, "\n")
+}
+
+// quotePrefix returns the marker for a quote depth, e.g. ">> " for 2
+func quotePrefix(depth int) string {
+	if depth == 0 {
+		return ""
+	}
+	return strings.Repeat(">", depth) + " "
+}
@@ -2,23 +2,33 @@ package mailos
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
+	"html"
+	"io"
 	"os"
 	"strings"
+
+	"github.com/emersion/go-message/mail"
 )
 
 type ForwardOptions struct {
-	EmailNumber int      // User-friendly email number from list
-	EmailUID    uint32   // IMAP UID if known
-	MessageID   string   // Message-ID to forward
-	To          []string
-	CC          []string
-	BCC         []string
-	Subject     string
-	Body        string
-	FileBody    string   // Read body from file
-	Interactive bool     // Interactive mode
-	Draft       bool     // Save as draft instead of sending
+	EmailNumber   int    // User-friendly email number from list
+	EmailUID      uint32 // IMAP UID if known
+	MessageID     string // Message-ID to forward
+	Email         *Email // The email itself, when the caller already has it
+	To            []string
+	CC            []string
+	BCC           []string
+	Subject       string
+	Body          string
+	FileBody      string // Read body from file
+	Interactive   bool   // Interactive mode
+	Draft         bool   // Save as draft instead of sending
+	AsAttachment  bool   // Attach the original as message/rfc822 instead of quoting it
+	NoAttachments bool   // Don't carry over the original's attachments on an inline forward
+	IncludeHTML   bool   // Quote the original HTML body as well as the text
+	NoSignature   bool   // Don't add the account's signature
 }
 
 func ForwardCommand(opts ForwardOptions) error {
@@ -26,7 +36,9 @@ func ForwardCommand(opts ForwardOptions) error {
 	var err error
 
 	// Find the original email to forward
-	if opts.EmailNumber > 0 {
+	if opts.Email != nil {
+		originalEmail = opts.Email
+	} else if opts.EmailNumber > 0 {
 		originalEmail, err = findEmailByNumber(opts.EmailNumber)
 		if err != nil {
 			return fmt.Errorf("failed to find email #%d: %v", opts.EmailNumber, err)
@@ -78,25 +90,37 @@ func ForwardCommand(opts ForwardOptions) error {
 	}
 	forward.Subject = subject
 
-	// Set body
+	// Set the note that goes above the forwarded message
+	var note string
 	if opts.FileBody != "" {
 		fileContent, err := os.ReadFile(opts.FileBody)
 		if err != nil {
 			return fmt.Errorf("failed to read body from file %s: %v", opts.FileBody, err)
 		}
-		forward.Body = string(fileContent)
+		note = string(fileContent)
 	} else if opts.Body != "" {
-		forward.Body = opts.Body
+		note = opts.Body
 	} else if opts.Interactive {
 		// Interactive composition
-		body, err := composeForwardInteractively(originalEmail)
+		note, err = composeForwardInteractively(originalEmail)
 		if err != nil {
 			return fmt.Errorf("failed to compose forward: %v", err)
 		}
-		forward.Body = body
+	}
+
+	if opts.AsAttachment {
+		raw, err := fetchEmailSource(originalEmail)
+		if err != nil {
+			return fmt.Errorf("failed to fetch original message: %v", err)
+		}
+		forward.Body = note
+		forward.AttachmentParts = []OutgoingAttachment{forwardedMessageAttachment(originalEmail, raw)}
+		fmt.Printf("📎 Attaching original message (%s)\n", formatBytes(int64(len(raw))))
 	} else {
-		// Default: create a basic forward template
-		forward.Body = createForwardTemplate(originalEmail)
+		forward.Body = createForwardBody(note, originalEmail)
+		if err := addForwardedContent(&forward, note, originalEmail, opts); err != nil {
+			return err
+		}
 	}
 
 	// Save or send the forward
@@ -106,7 +130,9 @@ func ForwardCommand(opts ForwardOptions) error {
 		if err != nil {
 			return fmt.Errorf("failed to save forward as draft: %v", err)
 		}
-		fmt.Printf("✓ Forward saved as draft (UID: %d)\n", uid)
+		if uid != 0 {
+			fmt.Printf("✓ Forward saved as draft (UID: %d)\n", uid)
+		}
 		
 		// Also save to local drafts
 		if err := saveLocalDraft(forward); err != nil {
@@ -117,11 +143,16 @@ func ForwardCommand(opts ForwardOptions) error {
 	} else {
 		// Send the forward
 		msg := &EmailMessage{
-			To:      forward.To,
-			CC:      forward.CC,
-			BCC:     forward.BCC,
-			Subject: forward.Subject,
-			Body:    forward.Body,
+			To:              forward.To,
+			CC:              forward.CC,
+			BCC:             forward.BCC,
+			Subject:         forward.Subject,
+			Body:            forward.Body,
+			BodyHTML:        forward.BodyHTML,
+			AttachmentParts: forward.AttachmentParts,
+			InlineImages:    forward.InlineImages,
+			// The signature goes above the forwarded message
+			IncludeSignature: !opts.NoSignature,
 		}
 		
 		fmt.Printf("📤 Sending forward...\n")
@@ -157,23 +188,13 @@ func composeForwardInteractively(originalEmail *Email) (string, error) {
 		bodyLines = append(bodyLines, line)
 	}
 	
-	body := strings.Join(bodyLines, "")
-	
-	// Add original message
-	forwardContent := createForwardedMessageContent(originalEmail)
-	if body != "" {
-		body = body + "\n\n" + forwardContent
-	} else {
-		body = forwardContent
-	}
-	
-	return body, nil
+	return strings.Join(bodyLines, ""), nil
 }
 
-func createForwardTemplate(originalEmail *Email) string {
-	// Create a basic forward with original message
-	template := fmt.Sprintf("\n\n%s", createForwardedMessageContent(originalEmail))
-	return template
+// createForwardBody puts the note above the quoted original message
+func createForwardBody(note string, originalEmail *Email) string {
+	note = strings.TrimRight(note, "\n")
+	return fmt.Sprintf("%s\n\n%s", note, createForwardedMessageContent(originalEmail))
 }
 
 func createForwardedMessageContent(originalEmail *Email) string {
@@ -193,6 +214,155 @@ func createForwardedMessageContent(originalEmail *Email) string {
 	return content.String()
 }
 
+// forwardedMessageAttachment wraps the original source as a message/rfc822 part
+func forwardedMessageAttachment(originalEmail *Email, raw []byte) OutgoingAttachment {
+	name := strings.TrimSpace(sanitizeFilename(originalEmail.Subject))
+	if name == "" {
+		name = "forwarded message"
+	}
+	return OutgoingAttachment{
+		Filename: name + ".eml",
+		MIMEType: "message/rfc822",
+		Data:     raw,
+	}
+}
+
+// addForwardedContent carries the original's attachments, and optionally its
+// HTML body and inline images, over to an inline forward
+func addForwardedContent(forward *DraftEmail, note string, originalEmail *Email, opts ForwardOptions) error {
+	wantAttachments := !opts.NoAttachments && len(originalEmail.Attachments) > 0
+	if !wantAttachments && !opts.IncludeHTML {
+		return nil
+	}
+
+	// The listing doesn't download attachment content or inline images, so
+	// fetch the full original
+	source := originalEmail
+	var inlineImages []InlineImage
+	raw, err := fetchEmailSource(originalEmail)
+	if err == nil {
+		if parsed, parseErr := parseRawMessage(raw); parseErr == nil {
+			source = parsed
+			inlineImages = extractInlineImages(raw)
+		}
+	} else {
+		fmt.Printf("⚠️  Could not fetch the original message: %v\n", err)
+		// The archive may still hold the attachments
+		if config, err := LoadConfig(); wantAttachments && err == nil {
+			LoadArchivedAttachments(config.Email, originalEmail)
+		}
+	}
+
+	if wantAttachments {
+		for _, filename := range originalEmail.Attachments {
+			data, ok := source.AttachmentData[filename]
+			if !ok {
+				data, ok = originalEmail.AttachmentData[filename]
+			}
+			if !ok {
+				return fmt.Errorf("could not include attachment %s from the original (use --no-attachments to forward without it)", filename)
+			}
+			forward.AttachmentParts = append(forward.AttachmentParts, OutgoingAttachment{
+				Filename: filename,
+				MIMEType: attachmentMIMEType(filename, source.AttachmentMeta[filename], data),
+				Data:     data,
+			})
+		}
+		fmt.Printf("📎 Including %d attachment(s) from the original\n", len(forward.AttachmentParts))
+	}
+
+	if opts.IncludeHTML {
+		originalHTML := source.BodyHTML
+		if originalHTML == "" {
+			originalHTML = originalEmail.BodyHTML
+		}
+		if originalHTML != "" {
+			forward.BodyHTML = createForwardedHTML(note, originalEmail, originalHTML)
+			forward.InlineImages = inlineImages
+		}
+	}
+
+	return nil
+}
+
+// createForwardedHTML builds the HTML alternative of an inline forward around
+// the original HTML body, sanitized the way a quoted reply is
+func createForwardedHTML(note string, originalEmail *Email, originalHTML string) string {
+	var b strings.Builder
+	if note = strings.TrimSpace(note); note != "" {
+		b.WriteString("<div>")
+		b.WriteString(strings.ReplaceAll(html.EscapeString(note), "\n", "<br>"))
+		b.WriteString("</div><br>\n")
+	}
+
+	b.WriteString("<div>---------- Forwarded message ----------<br>\n")
+	b.WriteString(fmt.Sprintf("From: %s<br>\n", html.EscapeString(originalEmail.From)))
+	b.WriteString(fmt.Sprintf("Date: %s<br>\n", originalEmail.Date.Format("Jan 2, 2006 at 3:04 PM")))
+	b.WriteString(fmt.Sprintf("Subject: %s<br>\n", html.EscapeString(originalEmail.Subject)))
+	if len(originalEmail.To) > 0 {
+		b.WriteString(fmt.Sprintf("To: %s<br>\n", html.EscapeString(strings.Join(originalEmail.To, ", "))))
+	}
+	b.WriteString("<br>\n</div>\n")
+	b.WriteString(sanitizeQuotedHTML(htmlBodyContent(originalHTML), -1))
+
+	return b.String()
+}
+
+// htmlBodyContent returns what's inside <body> so a full HTML document can be
+// nested in another message
+func htmlBodyContent(doc string) string {
+	lower := strings.ToLower(doc)
+	start := strings.Index(lower, "<body")
+	if start < 0 {
+		return doc
+	}
+	open := strings.Index(lower[start:], ">")
+	if open < 0 {
+		return doc
+	}
+	content := doc[start+open+1:]
+	if end := strings.LastIndex(strings.ToLower(content), "</body>"); end >= 0 {
+		content = content[:end]
+	}
+	return content
+}
+
+// extractInlineImages returns the cid: images of a message so a forwarded
+// HTML body keeps displaying them
+func extractInlineImages(raw []byte) []InlineImage {
+	mr, err := mail.CreateReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil
+	}
+
+	var images []InlineImage
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		h, ok := p.Header.(*mail.InlineHeader)
+		if !ok {
+			continue
+		}
+		contentType, params, _ := h.ContentType()
+		contentID := strings.Trim(h.Get("Content-Id"), "<> ")
+		if !strings.HasPrefix(contentType, "image/") || contentID == "" {
+			continue
+		}
+		data, err := io.ReadAll(p.Body)
+		if err != nil {
+			continue
+		}
+		filename := params["name"]
+		if filename == "" {
+			filename = "image" + extensionForMIME(contentType)
+		}
+		images = append(images, InlineImage{ContentID: contentID, Filename: filename, MIMEType: contentType, Data: data})
+	}
+	return images
+}
+
 // ForwardEmail is a helper function that can be called with just an email number
 func ForwardEmail(emailNumber int, interactive bool) error {
 	opts := ForwardOptions{
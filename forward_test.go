@@ -0,0 +1,143 @@
+package mailos
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-message/mail"
+)
+
+func TestForwardContent(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\nlogo")
+	raw, err := BuildMessage(&OutgoingMessage{
+		From:         "Alice <alice@example.com>",
+		To:           []string{"me@example.com"},
+		Subject:      "Q3 report: final",
+		MessageID:    "q3@example.com",
+		TextBody:     "Numbers attached.",
+		HTMLBody:     `<html><head><title>x</title></head><body class="m"><p>Numbers <b>attached</b>.</p><img src="cid:logo.1@example.com"></body></html>`,
+		InlineImages: []InlineImage{{ContentID: "logo.1@example.com", Filename: "logo.png", MIMEType: "image/png", Data: png}},
+		Attachments:  []OutgoingAttachment{{Filename: "report.pdf", MIMEType: "application/pdf", Data: []byte("%PDF-1.4")}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to build original: %v", err)
+	}
+	original := &Email{
+		From:        "Alice <alice@example.com>",
+		To:          []string{"me@example.com"},
+		Subject:     "Q3 report: final",
+		Date:        time.Date(2024, 9, 1, 10, 0, 0, 0, time.UTC),
+		Body:        "Numbers attached.",
+		Attachments: []string{"report.pdf"},
+	}
+
+	t.Run("AsAttachment", func(t *testing.T) {
+		part := forwardedMessageAttachment(original, raw)
+		if part.MIMEType != "message/rfc822" || part.Filename != "Q3 report- final.eml" {
+			t.Fatalf("Unexpected attachment %+v", part)
+		}
+
+		forward, err := BuildMessage(&OutgoingMessage{
+			From:        "me@example.com",
+			To:          []string{"bob@example.com"},
+			Subject:     "Fwd: Q3 report: final",
+			TextBody:    "FYI",
+			Attachments: []OutgoingAttachment{part},
+		})
+		if err != nil {
+			t.Fatalf("Failed to build forward: %v", err)
+		}
+
+		mr, err := mail.CreateReader(bytes.NewReader(forward))
+		if err != nil {
+			t.Fatalf("Failed to parse forward: %v", err)
+		}
+		var attached []byte
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Failed to read part: %v", err)
+			}
+			if h, ok := p.Header.(*mail.AttachmentHeader); ok {
+				if ct, _, _ := h.ContentType(); ct == "message/rfc822" {
+					if enc := h.Get("Content-Transfer-Encoding"); enc != "7bit" {
+						t.Errorf("Expected message/rfc822 to be sent unencoded, got %s", enc)
+					}
+					attached, _ = io.ReadAll(p.Body)
+				}
+			}
+		}
+		if !bytes.Equal(attached, raw) {
+			t.Errorf("Expected the original message attached unchanged")
+		}
+	})
+
+	t.Run("ParseRawMessage", func(t *testing.T) {
+		parsed, err := parseRawMessage(raw)
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		if string(parsed.AttachmentData["report.pdf"]) != "%PDF-1.4" {
+			t.Errorf("Expected attachment content, got %q", parsed.AttachmentData["report.pdf"])
+		}
+		if !strings.Contains(parsed.BodyHTML, "<b>attached</b>") {
+			t.Errorf("Expected HTML body, got %q", parsed.BodyHTML)
+		}
+	})
+
+	t.Run("InlineImages", func(t *testing.T) {
+		images := extractInlineImages(raw)
+		if len(images) != 1 || images[0].ContentID != "logo.1@example.com" || !bytes.Equal(images[0].Data, png) {
+			t.Fatalf("Expected the cid image, got %+v", images)
+		}
+	})
+
+	t.Run("InlineBody", func(t *testing.T) {
+		body := createForwardBody("FYI\n", original)
+		if !strings.HasPrefix(body, "FYI\n\n---------- Forwarded message ----------\n") {
+			t.Errorf("Expected note above the forwarded header, got %q", body)
+		}
+		if !strings.HasSuffix(body, "Numbers attached.") {
+			t.Errorf("Expected the original text quoted, got %q", body)
+		}
+	})
+
+	t.Run("HTMLBody", func(t *testing.T) {
+		parsed, _ := parseRawMessage(raw)
+		out := createForwardedHTML("See <below>", original, parsed.BodyHTML)
+		if !strings.Contains(out, "See &lt;below&gt;") {
+			t.Errorf("Expected the note escaped, got %q", out)
+		}
+		if strings.Contains(out, "<html") || strings.Contains(out, "<title>") {
+			t.Errorf("Expected only the original's body content, got %q", out)
+		}
+		if !strings.Contains(out, `<p>Numbers <b>attached</b>.</p><img `+quotedImageAttr+`="" src="cid:logo.1@example.com"/>`) {
+			t.Errorf("Expected original HTML kept, got %q", out)
+		}
+
+		secret := filepath.Join(t.TempDir(), "secret.png")
+		if err := os.WriteFile(secret, png, 0644); err != nil {
+			t.Fatal(err)
+		}
+		out = createForwardedHTML("", original, `<body><p onmouseover="x()">Hi</p><script>steal()</script><img src="`+secret+`"></body>`)
+		for _, unwanted := range []string{"onmouseover", "<script", "steal"} {
+			if strings.Contains(out, unwanted) {
+				t.Errorf("Expected %q removed from the forwarded HTML, got %q", unwanted, out)
+			}
+		}
+		if _, images := EmbedInlineImages(out, "/", false); len(images) != 0 {
+			t.Errorf("Expected no local file embedded from the forwarded HTML, got %d", len(images))
+		}
+		if htmlBodyContent("<p>fragment</p>") != "<p>fragment</p>" {
+			t.Errorf("Expected fragments left alone")
+		}
+	})
+}
@@ -20,10 +20,12 @@ type EmailFrontmatter struct {
 	UseTemplate bool
 	PlainText   bool
 	NoSignature bool
+	Signature   string // Named signature, or "none"
+	EmbedRemoteImages bool
 }
 
 func ParseFrontmatter(content string) (*EmailFrontmatter, string, error) {
-	frontmatterRegex := regexp.MustCompile(`^---\s*\n(.*?)\n---\s*\n(.*)$`)
+	frontmatterRegex := regexp.MustCompile(`(?s)^---\s*\n(.*?)\n---\s*\n(.*)$`)
 	matches := frontmatterRegex.FindStringSubmatch(strings.TrimSpace(content))
 	
 	if len(matches) != 3 {
@@ -77,6 +79,10 @@ func ParseFrontmatter(content string) (*EmailFrontmatter, string, error) {
 			fm.PlainText = parseBool(value)
 		case "no_signature", "nosignature":
 			fm.NoSignature = parseBool(value)
+		case "signature":
+			fm.Signature = unquote(value)
+		case "embed_remote_images", "embedremoteimages":
+			fm.EmbedRemoteImages = parseBool(value)
 		}
 	}
 	
@@ -173,6 +179,8 @@ func (fm *EmailFrontmatter) ToEmailMessage(bodyContent string) *EmailMessage {
 		UseTemplate:      fm.UseTemplate,
 		InReplyTo:        fm.InReplyTo,
 		References:       fm.References,
+		EmbedRemoteImages: fm.EmbedRemoteImages,
+		SignatureName:    fm.Signature,
 	}
 	
 	if !fm.UseTemplate && !fm.PlainText {
@@ -196,6 +204,7 @@ func (fm *EmailFrontmatter) ToDraftEmail(bodyContent string) DraftEmail {
 		InReplyTo:   fm.InReplyTo,
 		References:  fm.References,
 		SendAfter:   fm.SendAfter,
+		Signature:   fm.Signature,
 	}
 	
 	return draft
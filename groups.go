@@ -16,7 +16,8 @@ type EmailGroup struct {
 }
 
 type GroupConfig struct {
-	Groups []EmailGroup `json:"groups"`
+	SchemaVersion int          `json:"schema_version,omitempty"`
+	Groups        []EmailGroup `json:"groups"`
 }
 
 func GetGroupsConfigPath() (string, error) {
@@ -39,7 +40,7 @@ func LoadGroupsConfig() (*GroupConfig, error) {
 		return config, nil
 	}
 
-	data, err := os.ReadFile(configPath)
+	data, err := loadVersionedFile(configPath, groupsSchemaFile)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read groups config: %v", err)
 	}
@@ -61,6 +62,7 @@ func SaveGroupsConfig(config *GroupConfig) error {
 		return err
 	}
 
+	config.SchemaVersion = GroupsSchemaVersion
 	data, err := json.MarshalIndent(config, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal groups config: %v", err)
@@ -0,0 +1,695 @@
+package mailos
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/term"
+)
+
+// HTMLTextOptions control how HTMLToText renders a message
+type HTMLTextOptions struct {
+	Width    int  // Wrap paragraphs to this many columns; 0 leaves them unwrapped
+	Markdown bool // Render emphasis, headings, links and tables as markdown
+}
+
+const (
+	maxTableCellLength = 40 // Tables with longer cells are laid out as blocks
+	defaultTermWidth   = 80
+)
+
+// skippedTextElements never contain readable content
+var skippedTextElements = map[atom.Atom]bool{
+	atom.Head: true, atom.Script: true, atom.Style: true, atom.Title: true, atom.Meta: true,
+	atom.Link: true, atom.Noscript: true, atom.Template: true, atom.Svg: true, atom.Object: true,
+	atom.Iframe: true, atom.Form: true, atom.Button: true, atom.Input: true, atom.Select: true,
+}
+
+// hiddenStylePattern matches inline styles that hide an element, as used for
+// preheader text and tracking markup
+var hiddenStylePattern = regexp.MustCompile(`(?i)display:\s*none|visibility:\s*hidden|mso-hide:\s*all|max-height:\s*0(?:px)?\s*(?:;|$|!)|opacity:\s*0(?:\.0+)?\s*(?:;|$|!)|font-size:\s*0(?:px)?\s*(?:;|$|!)`)
+
+// invisibleChars pad preheaders and never render
+var invisibleChars = strings.NewReplacer("\u200b", "", "\u200c", "", "\u200d", "", "\ufeff", "", "\u034f", "", "\u00ad", "")
+
+// linkRefs numbers the link targets of a message for its footnotes
+type linkRefs struct {
+	urls  []string
+	index map[string]int
+}
+
+func (l *linkRefs) ref(url string) int {
+	if n, ok := l.index[url]; ok {
+		return n
+	}
+	l.urls = append(l.urls, url)
+	l.index[url] = len(l.urls)
+	return len(l.urls)
+}
+
+// listState tracks the numbering of an open list
+type listState struct {
+	ordered bool
+	next    int
+}
+
+// htmlTextRenderer walks an HTML document and writes it as wrapped text
+type htmlTextRenderer struct {
+	opts    HTMLTextOptions
+	out     strings.Builder
+	inline  string // Text of the paragraph being built
+	prefix  string // Indentation and quote markers of the current block
+	bullet  string // List marker for the first line of the current item
+	pre     int    // Depth of <pre> elements
+	pending int    // Blank lines owed before the next block
+	gap     string // Prefix of the blank lines owed, shared by both blocks
+	lists   []listState
+	links   *linkRefs
+}
+
+// HTMLToText renders an HTML message as readable text: paragraphs are
+// wrapped, lists and simple tables keep their layout, links become numbered
+// footnotes, and hidden elements and tracking pixels are dropped.
+func HTMLToText(doc string, opts HTMLTextOptions) string {
+	root, err := xhtml.Parse(strings.NewReader(doc))
+	if err != nil {
+		return strings.TrimSpace(doc)
+	}
+
+	r := &htmlTextRenderer{opts: opts, links: &linkRefs{index: map[string]int{}}}
+	r.walk(root)
+	r.flush()
+
+	text := strings.TrimRight(r.out.String(), "\n")
+	if len(r.links.urls) > 0 {
+		var refs strings.Builder
+		for i, url := range r.links.urls {
+			if opts.Markdown {
+				refs.WriteString(fmt.Sprintf("[%d]: %s\n", i+1, url))
+			} else {
+				refs.WriteString(fmt.Sprintf("[%d] %s\n", i+1, url))
+			}
+		}
+		text += "\n\n" + strings.TrimRight(refs.String(), "\n")
+	}
+	return strings.TrimLeft(text, "\n")
+}
+
+// TerminalWidth returns the width of stdout, or 80 when it isn't a terminal
+func TerminalWidth() int {
+	if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && width > 0 {
+		return width
+	}
+	return defaultTermWidth
+}
+
+func (r *htmlTextRenderer) walk(n *xhtml.Node) {
+	switch n.Type {
+	case xhtml.TextNode:
+		r.text(n.Data)
+		return
+	case xhtml.ElementNode:
+		if skippedTextElements[n.DataAtom] || isHiddenElement(n) {
+			return
+		}
+		r.element(n)
+		return
+	}
+	r.children(n)
+}
+
+func (r *htmlTextRenderer) children(n *xhtml.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		r.walk(c)
+	}
+}
+
+func (r *htmlTextRenderer) text(data string) {
+	data = invisibleChars.Replace(data)
+	if r.pre > 0 {
+		r.inline += data
+		return
+	}
+	// Collapse runs of whitespace, keeping one space at word boundaries
+	fields := strings.Fields(data)
+	if len(fields) == 0 {
+		if data != "" && r.inline != "" && !strings.HasSuffix(r.inline, " ") {
+			r.inline += " "
+		}
+		return
+	}
+	if startsWithSpace(data) && r.inline != "" && !strings.HasSuffix(r.inline, " ") {
+		r.inline += " "
+	}
+	r.inline += strings.Join(fields, " ")
+	if endsWithSpace(data) {
+		r.inline += " "
+	}
+}
+
+func (r *htmlTextRenderer) element(n *xhtml.Node) {
+	switch n.DataAtom {
+	case atom.Br:
+		if r.pre > 0 {
+			r.inline += "\n"
+		} else {
+			r.flushLine()
+		}
+
+	case atom.P, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		r.block(1)
+		if level := headingLevel(n.DataAtom); level > 0 && r.opts.Markdown {
+			r.inline = strings.Repeat("#", level) + " "
+		}
+		r.children(n)
+		r.block(1)
+
+	case atom.Div, atom.Section, atom.Article, atom.Header, atom.Footer, atom.Center,
+		atom.Main, atom.Nav, atom.Aside, atom.Figure, atom.Figcaption, atom.Dt, atom.Dd, atom.Address:
+		r.block(0)
+		r.children(n)
+		r.block(0)
+
+	case atom.Hr:
+		r.block(1)
+		r.writeLine("---")
+		r.block(1)
+
+	case atom.Ul, atom.Ol:
+		r.list(n)
+
+	case atom.Li:
+		r.listItem(n)
+
+	case atom.Blockquote:
+		r.block(1)
+		prefix, bullet := r.prefix, r.bullet
+		r.prefix += indent(r.bullet) + "> "
+		r.bullet = ""
+		r.children(n)
+		r.block(1)
+		r.prefix, r.bullet = prefix, bullet
+
+	case atom.Pre:
+		r.block(1)
+		r.pre++
+		r.children(n)
+		r.pre--
+		r.writePre()
+		r.block(1)
+
+	case atom.Table:
+		r.table(n)
+
+	case atom.Tr:
+		// Rows of layout tables are blocks of their own
+		r.block(0)
+		r.children(n)
+		r.block(0)
+
+	case atom.Td, atom.Th:
+		r.block(0)
+		r.children(n)
+		r.block(0)
+
+	case atom.A:
+		r.link(n)
+
+	case atom.Img:
+		r.image(n)
+
+	case atom.B, atom.Strong:
+		r.emphasis(n, "**")
+
+	case atom.I, atom.Em:
+		r.emphasis(n, "_")
+
+	case atom.Code:
+		if r.pre > 0 {
+			r.children(n)
+		} else {
+			r.emphasis(n, "`")
+		}
+
+	default:
+		r.children(n)
+	}
+}
+
+// block ends the paragraph being built and asks for blank lines before the
+// next one
+func (r *htmlTextRenderer) block(blank int) {
+	r.flush()
+	if r.pending == 0 {
+		r.gap = r.prefix
+	} else {
+		r.gap = commonPrefix(r.gap, r.prefix)
+	}
+	if blank > r.pending {
+		r.pending = blank
+	}
+}
+
+// flush writes the paragraph being built, wrapped to the width
+func (r *htmlTextRenderer) flush() {
+	text := strings.TrimSpace(r.inline)
+	r.inline = ""
+	if text == "" {
+		return
+	}
+	width := 0
+	if r.opts.Width > 0 {
+		width = r.opts.Width - utf8.RuneCountInString(r.prefix+r.bullet)
+		if width < 20 {
+			width = 20
+		}
+	}
+	lines := []string{text}
+	if width > 0 {
+		lines = wrapWords(text, width)
+	}
+	for _, line := range lines {
+		r.writeLine(line)
+	}
+}
+
+// flushLine ends the current line for a <br> without starting a new block
+func (r *htmlTextRenderer) flushLine() {
+	if strings.TrimSpace(r.inline) == "" {
+		// A second <br> in a row leaves a blank line
+		r.inline = ""
+		if r.pending == 0 {
+			r.gap, r.pending = r.prefix, 1
+		}
+		return
+	}
+	r.flush()
+}
+
+// writeLine writes one line with the block's prefix. Only the first line of
+// a list item carries its marker.
+func (r *htmlTextRenderer) writeLine(line string) {
+	if r.out.Len() > 0 {
+		gap := strings.TrimRight(commonPrefix(r.gap, r.prefix), " ")
+		for ; r.pending > 0; r.pending-- {
+			r.out.WriteString(gap + "\n")
+		}
+	}
+	r.pending = 0
+	r.out.WriteString(strings.TrimRight(r.prefix+r.bullet+line, " ") + "\n")
+	r.bullet = indent(r.bullet)
+}
+
+func (r *htmlTextRenderer) writePre() {
+	text := strings.Trim(r.inline, "\n")
+	r.inline = ""
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		r.writeLine("    " + line)
+	}
+}
+
+func (r *htmlTextRenderer) list(n *xhtml.Node) {
+	r.block(blankAroundList(r))
+	state := listState{ordered: n.DataAtom == atom.Ol, next: 1}
+	if start, err := strconv.Atoi(attr(n, "start")); err == nil && state.ordered {
+		state.next = start
+	}
+	r.lists = append(r.lists, state)
+	r.children(n)
+	r.lists = r.lists[:len(r.lists)-1]
+	r.block(blankAroundList(r))
+}
+
+// blankAroundList separates top-level lists from paragraphs, but keeps
+// nested lists tight
+func blankAroundList(r *htmlTextRenderer) int {
+	if len(r.lists) > 0 {
+		return 0
+	}
+	return 1
+}
+
+func (r *htmlTextRenderer) listItem(n *xhtml.Node) {
+	r.block(0)
+	marker := "- "
+	if !r.opts.Markdown {
+		marker = "• "
+	}
+	if len(r.lists) > 0 {
+		state := &r.lists[len(r.lists)-1]
+		if state.ordered {
+			marker = fmt.Sprintf("%d. ", state.next)
+			state.next++
+		}
+	}
+
+	prefix, bullet := r.prefix, r.bullet
+	r.prefix += indent(r.bullet)
+	r.bullet = marker
+	r.children(n)
+	r.block(0)
+	r.prefix, r.bullet = prefix, bullet
+}
+
+// link renders a link's text with a footnote reference to its target
+func (r *htmlTextRenderer) link(n *xhtml.Node) {
+	start := len(r.inline)
+	r.children(n)
+	href := strings.TrimSpace(attr(n, "href"))
+	if !isReadableLink(href) {
+		return
+	}
+
+	before, text := r.inline[:start], r.inline[start:]
+	label := strings.TrimSpace(text)
+	if label == "" {
+		return
+	}
+	target := strings.TrimPrefix(href, "mailto:")
+	if label == href || label == target || strings.TrimSuffix(label, "/") == strings.TrimSuffix(href, "/") {
+		if r.opts.Markdown && label == href {
+			r.inline = before + leadingSpace(text) + "<" + href + ">" + trailingSpace(text)
+		}
+		return
+	}
+
+	ref := r.links.ref(href)
+	if r.opts.Markdown {
+		r.inline = before + leadingSpace(text) + fmt.Sprintf("[%s][%d]", label, ref) + trailingSpace(text)
+	} else {
+		r.inline = before + leadingSpace(text) + fmt.Sprintf("%s[%d]", label, ref) + trailingSpace(text)
+	}
+}
+
+// image renders an image's alt text, dropping tracking pixels
+func (r *htmlTextRenderer) image(n *xhtml.Node) {
+	if isTrackingPixel(n) {
+		return
+	}
+	alt := strings.Join(strings.Fields(invisibleChars.Replace(attr(n, "alt"))), " ")
+	if alt == "" {
+		return
+	}
+	src := attr(n, "src")
+	if r.opts.Markdown && (strings.HasPrefix(src, "https://") || strings.HasPrefix(src, "http://")) && !insideLink(n) {
+		r.text(fmt.Sprintf("![%s](%s)", alt, src))
+		return
+	}
+	r.text("[" + alt + "]")
+}
+
+// emphasis wraps an element's text in a markdown marker
+func (r *htmlTextRenderer) emphasis(n *xhtml.Node, marker string) {
+	start := len(r.inline)
+	r.children(n)
+	if !r.opts.Markdown {
+		return
+	}
+	before, text := r.inline[:start], r.inline[start:]
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	r.inline = before + leadingSpace(text) + marker + strings.TrimSpace(text) + marker + trailingSpace(text)
+}
+
+// table renders small data tables as columns and anything else, such as the
+// nested layout tables of newsletters, as a sequence of blocks
+func (r *htmlTextRenderer) table(n *xhtml.Node) {
+	r.block(1)
+	rows, ok := r.tableCells(n)
+	if !ok {
+		r.children(n)
+		r.block(1)
+		return
+	}
+
+	columns := 0
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+	widths := make([]int, columns)
+	for _, row := range rows {
+		for i, cell := range row {
+			if w := utf8.RuneCountInString(cell); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+
+	separator := "  "
+	if r.opts.Markdown {
+		separator = " | "
+	}
+	total := utf8.RuneCountInString(r.prefix) + (columns-1)*len(separator)
+	for _, w := range widths {
+		total += w
+	}
+	if r.opts.Width > 0 && total > r.opts.Width {
+		r.children(n)
+		r.block(1)
+		return
+	}
+
+	for i, row := range rows {
+		cells := make([]string, columns)
+		for j := range cells {
+			if j < len(row) {
+				cells[j] = row[j]
+			}
+			cells[j] += strings.Repeat(" ", widths[j]-utf8.RuneCountInString(cells[j]))
+		}
+		line := strings.Join(cells, separator)
+		if r.opts.Markdown {
+			line = "| " + line + " |"
+		}
+		r.writeLine(line)
+
+		if i == 0 {
+			rules := make([]string, columns)
+			for j, w := range widths {
+				rules[j] = strings.Repeat("-", max(w, 3))
+			}
+			if r.opts.Markdown {
+				r.writeLine("| " + strings.Join(rules, " | ") + " |")
+			} else {
+				r.writeLine(strings.Join(rules, separator))
+			}
+		}
+	}
+	r.block(1)
+}
+
+// tableCells collects the text of a table's cells, or reports false when the
+// table looks like layout rather than data: a single row or column, nested
+// tables or block content, or long cells
+func (r *htmlTextRenderer) tableCells(table *xhtml.Node) ([][]string, bool) {
+	var rows [][]string
+	wide := false
+	var visit func(n *xhtml.Node) bool
+	visit = func(n *xhtml.Node) bool {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != xhtml.ElementNode || isHiddenElement(c) {
+				continue
+			}
+			switch c.DataAtom {
+			case atom.Thead, atom.Tbody, atom.Tfoot:
+				if !visit(c) {
+					return false
+				}
+			case atom.Tr:
+				var row []string
+				for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.Type != xhtml.ElementNode || (cell.DataAtom != atom.Td && cell.DataAtom != atom.Th) || isHiddenElement(cell) {
+						continue
+					}
+					if hasBlockContent(cell) {
+						return false
+					}
+					text, ok := r.cellText(cell)
+					if !ok {
+						return false
+					}
+					row = append(row, text)
+				}
+				if len(row) > 1 {
+					wide = true
+				}
+				if len(row) > 0 {
+					rows = append(rows, row)
+				}
+			}
+		}
+		return true
+	}
+	if !visit(table) || len(rows) < 2 || !wide {
+		return nil, false
+	}
+	return rows, true
+}
+
+// cellText renders a table cell on one line, sharing the message's link
+// footnotes
+func (r *htmlTextRenderer) cellText(cell *xhtml.Node) (string, bool) {
+	refs := &linkRefs{urls: append([]string(nil), r.links.urls...), index: map[string]int{}}
+	for k, v := range r.links.index {
+		refs.index[k] = v
+	}
+	sub := &htmlTextRenderer{opts: HTMLTextOptions{Markdown: r.opts.Markdown}, links: refs}
+	sub.children(cell)
+	text := strings.TrimSpace(sub.inline)
+	if utf8.RuneCountInString(text) > maxTableCellLength {
+		return "", false
+	}
+	if r.opts.Markdown {
+		text = strings.ReplaceAll(text, "|", `\|`)
+	}
+	*r.links = *refs
+	return text, true
+}
+
+// hasBlockContent reports whether a cell holds tables, lists or paragraphs
+func hasBlockContent(n *xhtml.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != xhtml.ElementNode {
+			continue
+		}
+		switch c.DataAtom {
+		case atom.Table, atom.Ul, atom.Ol, atom.P, atom.Div, atom.Blockquote, atom.Pre,
+			atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Br:
+			return true
+		}
+		if hasBlockContent(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// isHiddenElement reports whether an element is hidden from view
+func isHiddenElement(n *xhtml.Node) bool {
+	for _, a := range n.Attr {
+		switch strings.ToLower(a.Key) {
+		case "hidden":
+			return true
+		case "aria-hidden":
+			if strings.EqualFold(a.Val, "true") && n.DataAtom != atom.Img {
+				return true
+			}
+		case "style":
+			if hiddenStylePattern.MatchString(a.Val) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isTrackingPixel reports whether an image is a 1x1 (or smaller) beacon
+func isTrackingPixel(n *xhtml.Node) bool {
+	tiny := func(value string) bool {
+		value = strings.TrimSuffix(strings.TrimSpace(value), "px")
+		size, err := strconv.Atoi(value)
+		return err == nil && size <= 1
+	}
+	if tiny(attr(n, "width")) || tiny(attr(n, "height")) {
+		return true
+	}
+	style := strings.ReplaceAll(strings.ToLower(attr(n, "style")), " ", "")
+	for _, decl := range strings.Split(style, ";") {
+		if name, value, ok := strings.Cut(decl, ":"); ok && (name == "width" || name == "height") && tiny(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// isReadableLink reports whether a link target is worth a footnote
+func isReadableLink(href string) bool {
+	lower := strings.ToLower(href)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "mailto:")
+}
+
+func insideLink(n *xhtml.Node) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.Type == xhtml.ElementNode && p.DataAtom == atom.A {
+			return true
+		}
+	}
+	return false
+}
+
+func headingLevel(a atom.Atom) int {
+	switch a {
+	case atom.H1:
+		return 1
+	case atom.H2:
+		return 2
+	case atom.H3:
+		return 3
+	case atom.H4:
+		return 4
+	case atom.H5:
+		return 5
+	case atom.H6:
+		return 6
+	}
+	return 0
+}
+
+func attr(n *xhtml.Node, key string) string {
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// commonPrefix returns the longest prefix shared by a and b
+func commonPrefix(a, b string) string {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return a[:i]
+}
+
+// indent returns spaces as wide as a list marker
+func indent(marker string) string {
+	return strings.Repeat(" ", utf8.RuneCountInString(marker))
+}
+
+func startsWithSpace(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\u00a0'
+}
+
+func endsWithSpace(s string) bool {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\u00a0'
+}
+
+func leadingSpace(s string) string {
+	if strings.HasPrefix(s, " ") {
+		return " "
+	}
+	return ""
+}
+
+func trailingSpace(s string) string {
+	if strings.HasSuffix(s, " ") && strings.TrimSpace(s) != "" {
+		return " "
+	}
+	return ""
+}
@@ -0,0 +1,97 @@
+package mailos
+
+import (
+	"strings"
+	"testing"
+)
+
+const newsletterHTML = `<html><head><title>News</title><style>p { color: red }</style></head><body>
+<div style="display:none;max-height:0;overflow:hidden">Preview text &zwnj;&nbsp;&zwnj;</div>
+<table width="600"><tr><td>
+<h1>Weekly &amp; News</h1>
+<p>Hello <b>there</b>, read <a href="https://example.com/post">our latest post</a> about a long subject that needs wrapping.</p>
+<ul><li>First</li><li>Second<ul><li>Nested</li></ul></li></ul>
+<ol start="3"><li>Three</li><li>Four</li></ol>
+<table><tr><th>Plan</th><th>Price</th></tr><tr><td>Basic</td><td>$5</td></tr><tr><td>Pro</td><td>$10</td></tr></table>
+<blockquote>Quoted<br>words</blockquote>
+<p>Mail <a href="mailto:hi@example.com">hi@example.com</a> or <a href="https://example.com/post">read it</a> again.</p>
+<img src="https://t.example.com/open.gif" width="1" height="1">
+<img src="https://example.com/logo.png" alt="Logo">
+<script>track()</script>
+</td></tr></table></body></html>`
+
+func TestHTMLToText(t *testing.T) {
+	t.Run("Text", func(t *testing.T) {
+		got := HTMLToText(newsletterHTML, HTMLTextOptions{Width: 40})
+		want := `Weekly & News
+
+Hello there, read our latest post[1]
+about a long subject that needs
+wrapping.
+
+• First
+• Second
+  • Nested
+
+3. Three
+4. Four
+
+Plan   Price
+-----  -----
+Basic  $5
+Pro    $10
+
+> Quoted
+> words
+
+Mail hi@example.com or read it[1] again.
+
+[Logo]
+
+[1] https://example.com/post`
+		if got != want {
+			t.Errorf("HTMLToText() =\n%s\nwant\n%s", got, want)
+		}
+	})
+
+	t.Run("Markdown", func(t *testing.T) {
+		got := HTMLToText(newsletterHTML, HTMLTextOptions{Markdown: true})
+		for _, want := range []string{
+			"# Weekly & News\n",
+			"Hello **there**, read [our latest post][1] about",
+			"- First\n- Second\n  - Nested\n",
+			"| Plan  | Price |\n| ----- | ----- |\n| Basic | $5    |",
+			"![Logo](https://example.com/logo.png)",
+			"\n[1]: https://example.com/post",
+		} {
+			if !strings.Contains(got, want) {
+				t.Errorf("Expected %q in:\n%s", want, got)
+			}
+		}
+	})
+
+	t.Run("Hidden", func(t *testing.T) {
+		got := HTMLToText(newsletterHTML, HTMLTextOptions{})
+		for _, unwanted := range []string{"Preview text", "track()", "color: red", "News\n\nWeekly", "open.gif"} {
+			if strings.Contains(got, unwanted) {
+				t.Errorf("Expected %q dropped, got:\n%s", unwanted, got)
+			}
+		}
+	})
+
+	t.Run("LayoutTable", func(t *testing.T) {
+		// Tables with long cells are layout, not data
+		doc := `<table><tr><td>` + strings.Repeat("word ", 20) + `</td><td>Side</td></tr><tr><td>A</td><td>B</td></tr></table>`
+		got := HTMLToText(doc, HTMLTextOptions{})
+		if strings.Contains(got, "---") || !strings.HasPrefix(got, "word word") || !strings.HasSuffix(got, "Side\nA\nB") {
+			t.Errorf("Expected the cells as blocks, got:\n%s", got)
+		}
+	})
+
+	t.Run("LineBreaks", func(t *testing.T) {
+		got := HTMLToText("Line one<br>Line two<br><br>After a gap", HTMLTextOptions{})
+		if got != "Line one\nLine two\n\nAfter a gap" {
+			t.Errorf("Unexpected line breaks: %q", got)
+		}
+	})
+}
@@ -0,0 +1,354 @@
+package mailos
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/responses"
+)
+
+// gmailExtension is the capability of servers that accept Gmail's own
+// search syntax through X-GM-RAW
+const gmailExtension = "X-GM-EXT-1"
+
+// gmailSearchCommand is a SEARCH with Gmail's X-GM-RAW key after the
+// standard criteria
+type gmailSearchCommand struct {
+	criteria *imap.SearchCriteria
+	raw      string
+}
+
+func (cmd *gmailSearchCommand) Command() *imap.Command {
+	args := []interface{}{imap.RawString("CHARSET"), imap.RawString("UTF-8")}
+	args = append(args, cmd.criteria.Format()...)
+	args = append(args, imap.RawString("X-GM-RAW"), cmd.raw)
+	return &imap.Command{Name: "SEARCH", Arguments: args}
+}
+
+// searchMessages searches the selected folder with criteria and q. q runs on
+// the server as far as it can as SEARCH criteria; on Gmail, terms SEARCH
+// can't express, such as has:attachment, are added as X-GM-RAW. exact is
+// false when the ids are a superset that still needs q.Match.
+func searchMessages(c *client.Client, criteria *imap.SearchCriteria, q *Query) (ids []uint32, exact bool, err error) {
+	if q == nil || q.Root == nil {
+		ids, err = c.Search(criteria)
+		return ids, true, err
+	}
+
+	queryCriteria, exact := q.IMAPCriteria()
+	mergeSearchCriteria(criteria, queryCriteria)
+
+	if gmail, _ := c.Support(gmailExtension); gmail {
+		if raw := q.GmailRaw(); raw != "" {
+			res := new(responses.Search)
+			status, err := c.Execute(&gmailSearchCommand{criteria: criteria, raw: raw}, res)
+			if err == nil {
+				err = status.Err()
+			}
+			if err == nil {
+				// Gmail matches dates by day
+				return res.Ids, false, nil
+			}
+			// Fall back to standard SEARCH below
+		}
+	}
+
+	ids, err = c.Search(criteria)
+	return ids, exact, err
+}
+
+// fetchEmails fetches the messages with these sequence numbers in full,
+// newest first
+func fetchEmails(c *client.Client, ids []uint32, opts ReadOptions, folder string) ([]*Email, error) {
+	if len(ids) == 0 {
+		return []*Email{}, nil
+	}
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(ids...)
+
+	messages := make(chan *imap.Message, len(ids))
+	section := &imap.BodySectionName{}
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Fetch(seqSet, []imap.FetchItem{imap.FetchEnvelope, imap.FetchFlags, imap.FetchRFC822Size, imap.FetchUid, section.FetchItem()}, messages)
+	}()
+
+	emails := make([]*Email, 0, len(ids))
+	for msg := range messages {
+		email, err := parseMessageWithOptions(msg, section, opts.DownloadAttach)
+		if err != nil {
+			continue
+		}
+		email.Folder = folder
+		emails = append(emails, email)
+	}
+
+	if err := <-done; err != nil {
+		return nil, fmt.Errorf("failed to fetch messages: %v", err)
+	}
+
+	sort.Slice(emails, func(i, j int) bool { return emails[i].ID > emails[j].ID })
+	return emails, nil
+}
+
+// fetchMatchingEmails pages through the messages matching q when the
+// server's search could only narrow them down. Envelopes, flags and sizes
+// are fetched for the candidates first, so bodies are only downloaded for
+// messages that can still match, newest first and a batch at a time until
+// the page is full.
+func fetchMatchingEmails(c *client.Client, ids []uint32, q *Query, opts ReadOptions, folder string) ([]*Email, error) {
+	candidates := append([]uint32(nil), ids...)
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i] > candidates[j] })
+	if q.Root.envelopeCanExclude() {
+		var err error
+		if candidates, err = filterEnvelopes(c, ids, q, folder); err != nil {
+			return nil, err
+		}
+	}
+
+	want := len(candidates)
+	if opts.Limit > 0 {
+		want = opts.Offset + opts.Limit
+	}
+	batchSize := max(want, 20)
+
+	var matched []*Email
+	for start := 0; start < len(candidates) && len(matched) < want; start += batchSize {
+		batch := candidates[start:min(start+batchSize, len(candidates))]
+		emails, err := fetchEmails(c, batch, opts, folder)
+		if err != nil {
+			return nil, err
+		}
+		matched = append(matched, q.Filter(emails)...)
+	}
+
+	if opts.Offset >= len(matched) {
+		return []*Email{}, nil
+	}
+	matched = matched[opts.Offset:]
+	if opts.Limit > 0 && len(matched) > opts.Limit {
+		matched = matched[:opts.Limit]
+	}
+	return matched, nil
+}
+
+// filterEnvelopes fetches the envelopes of ids and returns the ones that may
+// match q, newest first
+func filterEnvelopes(c *client.Client, ids []uint32, q *Query, folder string) ([]uint32, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(ids...)
+
+	messages := make(chan *imap.Message, len(ids))
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Fetch(seqSet, []imap.FetchItem{imap.FetchEnvelope, imap.FetchFlags, imap.FetchRFC822Size, imap.FetchUid}, messages)
+	}()
+
+	var candidates []uint32
+	for msg := range messages {
+		if q.Root.matchEnvelope(envelopeEmail(msg, folder)) != matchNo {
+			candidates = append(candidates, msg.SeqNum)
+		}
+	}
+	if err := <-done; err != nil {
+		return nil, fmt.Errorf("failed to fetch envelopes: %v", err)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i] > candidates[j] })
+	return candidates, nil
+}
+
+// envelopeEmail is what's known about a message from its envelope, flags
+// and size, without its body
+func envelopeEmail(msg *imap.Message, folder string) *Email {
+	email := &Email{ID: msg.SeqNum, UID: msg.Uid, Flags: msg.Flags, Size: int64(msg.Size), Folder: folder}
+	if msg.Envelope != nil {
+		applyEnvelope(email, msg.Envelope)
+		var cc []string
+		for _, addr := range msg.Envelope.Cc {
+			cc = append(cc, formatEnvelopeAddress(addr))
+		}
+		email.Headers = map[string][]string{"Cc": cc}
+	}
+	return email
+}
+
+// matchResult is whether a message matches a query, when only part of the
+// message is known
+type matchResult int
+
+const (
+	matchNo matchResult = iota
+	matchYes
+	matchMaybe
+)
+
+// matchEnvelope evaluates the node against an envelopeEmail. Terms that
+// depend on the body are matchMaybe unless the headers already match.
+func (n *QueryNode) matchEnvelope(email *Email) matchResult {
+	if n == nil {
+		return matchYes
+	}
+	switch n.Kind {
+	case queryAnd:
+		result := matchYes
+		for _, child := range n.Children {
+			switch child.matchEnvelope(email) {
+			case matchNo:
+				return matchNo
+			case matchMaybe:
+				result = matchMaybe
+			}
+		}
+		return result
+	case queryOr:
+		result := matchNo
+		for _, child := range n.Children {
+			switch child.matchEnvelope(email) {
+			case matchYes:
+				return matchYes
+			case matchMaybe:
+				result = matchMaybe
+			}
+		}
+		return result
+	case queryNot:
+		switch n.Children[0].matchEnvelope(email) {
+		case matchYes:
+			return matchNo
+		case matchNo:
+			return matchYes
+		}
+		return matchMaybe
+	}
+
+	switch n.Field {
+	case "body", "has", "filename":
+		return matchMaybe
+	case "text":
+		if n.match(email, containsQueryTerm) {
+			return matchYes
+		}
+		return matchMaybe
+	}
+	if n.match(email, containsQueryTerm) {
+		return matchYes
+	}
+	return matchNo
+}
+
+// envelopeCanExclude reports whether matchEnvelope can rule any message
+// out, which it can't when every term depends on the body
+func (n *QueryNode) envelopeCanExclude() bool {
+	if n == nil {
+		return false
+	}
+	if n.Kind != queryTerm {
+		for _, child := range n.Children {
+			if child.envelopeCanExclude() {
+				return true
+			}
+		}
+		return false
+	}
+	return n.Field != "body" && n.Field != "has" && n.Field != "filename"
+}
+
+// GmailRaw writes the terms of the query whose meaning is the same in
+// Gmail's search syntax, for X-GM-RAW. Text terms are left out, since Gmail
+// matches whole words where Match matches substrings, so its results are a
+// superset.
+func (q *Query) GmailRaw() string {
+	return q.Root.gmailRaw(false)
+}
+
+// gmailRaw returns "" for a node that matches everything. nested wraps
+// groups in parentheses.
+func (n *QueryNode) gmailRaw(nested bool) string {
+	if n == nil {
+		return ""
+	}
+	switch n.Kind {
+	case queryAnd, queryOr:
+		var parts []string
+		for _, child := range n.Children {
+			part := child.gmailRaw(true)
+			if part == "" {
+				if n.Kind == queryOr {
+					return ""
+				}
+				continue
+			}
+			parts = append(parts, part)
+		}
+		join := " "
+		if n.Kind == queryOr {
+			join = " OR "
+		}
+		switch {
+		case len(parts) == 0:
+			return ""
+		case len(parts) == 1:
+			return parts[0]
+		case nested:
+			return "(" + strings.Join(parts, join) + ")"
+		}
+		return strings.Join(parts, join)
+	case queryNot:
+		// Excluding a superset would drop matches
+		if !n.Children[0].gmailExact() {
+			return ""
+		}
+		if part := n.Children[0].gmailRaw(true); part != "" {
+			return "-" + part
+		}
+		return ""
+	}
+
+	switch n.Field {
+	case "has":
+		return "has:attachment"
+	case "larger", "smaller":
+		return fmt.Sprintf("%s:%d", n.Field, n.size)
+	case "after":
+		return "after:" + n.time.Format("2006/01/02")
+	case "before":
+		// Gmail compares whole days, so include the last one
+		return "before:" + n.time.AddDate(0, 0, 1).Format("2006/01/02")
+	case "is":
+		if n.Value == "flagged" {
+			return "is:starred"
+		}
+		return "is:" + n.Value
+	}
+	// Text terms go as SEARCH criteria, and in: is checked against the
+	// folder being read
+	return ""
+}
+
+// gmailExact reports whether Gmail matches a node the way Match does, so
+// that it can be negated
+func (n *QueryNode) gmailExact() bool {
+	switch n.Kind {
+	case queryAnd, queryOr:
+		for _, child := range n.Children {
+			if !child.gmailExact() {
+				return false
+			}
+		}
+		return true
+	case queryNot:
+		return n.Children[0].gmailExact()
+	}
+	switch n.Field {
+	case "has", "larger", "smaller", "is":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,318 @@
+package mailos
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/responses"
+	"github.com/emersion/go-imap/server"
+)
+
+// imapLog collects the traffic of a test server
+type imapLog struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (l *imapLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.Write(p)
+}
+
+// take returns the traffic so far and starts over
+func (l *imapLog) take() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := l.buf.String()
+	l.buf.Reset()
+	return s
+}
+
+// gmailSearch stands in for Gmail's SEARCH, recording the X-GM-RAW query
+// and answering with fixed ids
+type gmailSearch struct {
+	ids []uint32
+	raw []string
+}
+
+func (g *gmailSearch) Capabilities(server.Conn) []string { return []string{gmailExtension} }
+
+func (g *gmailSearch) Command(name string) server.HandlerFactory {
+	if name != "SEARCH" {
+		return nil
+	}
+	return func() server.Handler { return &gmailSearchHandler{gmail: g} }
+}
+
+type gmailSearchHandler struct {
+	gmail  *gmailSearch
+	fields []interface{}
+}
+
+func (h *gmailSearchHandler) Parse(fields []interface{}) error {
+	h.fields = fields
+	return nil
+}
+
+func (h *gmailSearchHandler) Handle(conn server.Conn) error {
+	for i, field := range h.fields {
+		if s, _ := field.(string); strings.EqualFold(s, "X-GM-RAW") && i+1 < len(h.fields) {
+			raw, _ := h.fields[i+1].(string)
+			h.gmail.raw = append(h.gmail.raw, raw)
+		}
+	}
+	return conn.WriteResp(&responses.Search{Ids: h.gmail.ids})
+}
+
+// movingBackend gives the memory backend the MOVE support its server advertises
+type movingBackend struct{ *memory.Backend }
+
+type movingUser struct{ backend.User }
+
+type movingMailbox struct{ *memory.Mailbox }
+
+func (be movingBackend) Login(info *imap.ConnInfo, username, password string) (backend.User, error) {
+	user, err := be.Backend.Login(info, username, password)
+	return movingUser{user}, err
+}
+
+func (u movingUser) GetMailbox(name string) (backend.Mailbox, error) {
+	mbox, err := u.User.GetMailbox(name)
+	if err != nil {
+		return nil, err
+	}
+	return movingMailbox{mbox.(*memory.Mailbox)}, nil
+}
+
+func (mbox movingMailbox) MoveMessages(uid bool, seqSet *imap.SeqSet, dest string) error {
+	if err := mbox.CopyMessages(uid, seqSet, dest); err != nil {
+		return err
+	}
+	if err := mbox.UpdateMessagesFlags(uid, seqSet, imap.AddFlags, []string{imap.DeletedFlag}); err != nil {
+		return err
+	}
+	return mbox.Expunge()
+}
+
+// startTestIMAP serves a mailbox over plain IMAP and points the config at
+// it. The backend's own greeting message is sequence number 1.
+func startTestIMAP(t *testing.T, extensions ...server.Extension) *imapLog {
+	be := movingBackend{memory.New()}
+	user, _ := be.Login(nil, "username", "password")
+	inbox, _ := user.GetMailbox("INBOX")
+	for _, m := range []struct {
+		flags []string
+		raw   string
+	}{
+		{nil, "From: Ana <ana@example.org>\r\nTo: me@example.com\r\nCc: bob@example.org\r\nSubject: Invoice 7\r\nDate: Wed, 01 May 2024 10:00:00 +0000\r\n\r\nPlease pay"},
+		{[]string{imap.SeenFlag}, "From: bob@example.org\r\nTo: me@example.com\r\nSubject: Lunch\r\nDate: Thu, 02 May 2024 10:00:00 +0000\r\n\r\nAbout the invoice"},
+		{nil, "From: billing@shop.example\r\nTo: me@example.com\r\nSubject: Receipt\r\nDate: Fri, 03 May 2024 10:00:00 +0000\r\n" +
+			"Content-Type: multipart/mixed; boundary=b\r\n\r\n--b\r\nContent-Type: text/plain\r\n\r\nThanks\r\n" +
+			"--b\r\nContent-Type: application/pdf\r\nContent-Disposition: attachment; filename=receipt.pdf\r\n\r\n%PDF\r\n--b--\r\n"},
+		{[]string{imap.FlaggedFlag}, "From: ana@example.org\r\nTo: me@example.com\r\nSubject: Photos\r\nDate: Sat, 04 May 2024 10:00:00 +0000\r\n\r\nSee attached"},
+	} {
+		if err := inbox.CreateMessage(m.flags, time.Now(), bytes.NewBufferString(m.raw)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := server.New(be)
+	s.AllowInsecureAuth = true
+	s.Enable(extensions...)
+	log := &imapLog{}
+	s.Debug = log
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(ln)
+	t.Cleanup(func() { s.Close() })
+
+	Providers["imaptest"] = Provider{Name: "Test IMAP", IMAPHost: "127.0.0.1", IMAPPort: ln.Addr().(*net.TCPAddr).Port}
+	t.Cleanup(func() { delete(Providers, "imaptest") })
+	setupConfigLayers(t, `{"provider": "imaptest", "email": "username", "password": "password"}`, "")
+	return log
+}
+
+func subjects(emails []*Email) string {
+	var s []string
+	for _, email := range emails {
+		s = append(s, email.Subject)
+	}
+	return strings.Join(s, "|")
+}
+
+func TestIMAPSearchPushdown(t *testing.T) {
+	log := startTestIMAP(t)
+	log.take()
+
+	tests := []struct {
+		query  string
+		opts   ReadOptions
+		want   string
+		bodies int // messages whose bodies were downloaded
+		sent   string
+	}{
+		// Exact on the server, so only the page is fetched
+		{"from:ana -is:flagged", ReadOptions{}, "Invoice 7", 1, `NOT (FLAGGED)`},
+		{"from:ana", ReadOptions{Limit: 1, Offset: 1}, "Invoice 7", 1, "From"},
+		{"cc:bob OR subject:lunch", ReadOptions{}, "Lunch|Invoice 7", 2, "OR"},
+		// BODY also searches attachments, so matches are checked here
+		{"body:invoice", ReadOptions{}, "Lunch", 1, `BODY "invoice"`},
+		// Envelopes rule messages out before any body is downloaded
+		{"in:Archive", ReadOptions{}, "", 0, "SEARCH CHARSET UTF-8 ALL"},
+		{"-invoice has:attachment", ReadOptions{}, "Receipt", 4, "ALL"},
+		{"has:attachment", ReadOptions{Limit: 1}, "Receipt", 5, "ALL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.opts.Query = q
+			emails, err := ReadFromFolder(tt.opts, "INBOX")
+			if err != nil {
+				t.Fatal(err)
+			}
+			traffic := log.take()
+			if got := subjects(emails); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+			if got := strings.Count(traffic, "BODY[] {"); got != tt.bodies {
+				t.Errorf("Expected %d bodies downloaded, got %d", tt.bodies, got)
+			}
+			if !strings.Contains(traffic, tt.sent) {
+				t.Errorf("Expected %q sent, got:\n%s", tt.sent, traffic)
+			}
+		})
+	}
+
+	emails, _ := ReadFromFolder(ReadOptions{Query: &Query{}}, "INBOX")
+	if len(emails) != 5 || emails[0].Size == 0 || emails[0].Folder != "INBOX" {
+		t.Errorf("Expected every email with its size and folder, got %+v", emails)
+	}
+}
+
+func TestSearchSavesOnlyMatchedAttachments(t *testing.T) {
+	log := startTestIMAP(t)
+	log.take()
+
+	for query, want := range map[string]int{
+		// Receipt's body is downloaded to check has:attachment, then ruled out
+		"from:billing -has:attachment": 0,
+		"from:billing has:attachment":  1,
+	} {
+		t.Run(query, func(t *testing.T) {
+			dir := t.TempDir()
+			q, _ := ParseQuery(query)
+			if _, err := ReadFromFolder(ReadOptions{Query: q, DownloadAttach: true, AttachmentDir: dir}, "INBOX"); err != nil {
+				t.Fatal(err)
+			}
+			if strings.Count(log.take(), "BODY[] {") != 1 {
+				t.Fatal("Expected Receipt's body downloaded")
+			}
+			if saved, _ := os.ReadDir(dir); len(saved) != want {
+				t.Errorf("Expected %d attachments saved, got %d", want, len(saved))
+			}
+		})
+	}
+}
+
+func TestGmailRawSearch(t *testing.T) {
+	gmail := &gmailSearch{ids: []uint32{2, 3}}
+	log := startTestIMAP(t, gmail)
+
+	q, _ := ParseQuery("invoic -is:read in:INBOX")
+	emails, err := ReadFromFolder(ReadOptions{Query: q, UnreadOnly: true}, "INBOX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gmail.raw) != 1 || gmail.raw[0] != "-is:read" {
+		t.Errorf("Unexpected X-GM-RAW queries: %q", gmail.raw)
+	}
+	traffic := log.take()
+	// Gmail would only find "invoic" as a whole word, so text goes as TEXT
+	if !strings.Contains(traffic, `TEXT "invoic"`) || !strings.Contains(traffic, `X-GM-RAW "-is:read"`) {
+		t.Errorf("Expected the text as TEXT and the rest as X-GM-RAW, got:\n%s", traffic)
+	}
+	// Gmail's answer is checked here; the read message is ruled out by its
+	// envelope before its body is downloaded
+	if subjects(emails) != "Invoice 7" || strings.Count(traffic, "BODY[] {") != 1 {
+		t.Errorf("Expected only Invoice 7 downloaded, got %q", subjects(emails))
+	}
+}
+
+func TestGmailRaw(t *testing.T) {
+	for query, want := range map[string]string{
+		"from:ana has:attachment":                             "has:attachment",
+		"has:attachment OR larger:1M is:read":                 "(has:attachment OR larger:1048576) is:read",
+		"-is:read larger:1M is:flagged":                       "-is:read larger:1048576 is:starred",
+		"after:2024-05-01 before:2024-05-03":                  "after:2024/05/01 before:2024/05/04",
+		"body:(refund OR credit) has:attachment filename:pdf": "has:attachment",
+		`subject:invoic from:ana cc:"a (b)"`:                  "",
+		"-invoice":                                            "",
+		"in:Archive is:unread":                                "is:unread",
+		"in:Archive OR is:unread":                             "",
+		"has:attachment OR from:x":                            "",
+		"-(has:attachment OR is:unread)":                      "-(has:attachment OR is:unread)",
+		"-(has:attachment after:2024-05-01)":                  "",
+	} {
+		q, err := ParseQuery(query)
+		if err != nil {
+			t.Fatalf("%q: %v", query, err)
+		}
+		if got := q.GmailRaw(); got != want {
+			t.Errorf("%q: expected %q, got %q", query, want, got)
+		}
+	}
+}
+
+func TestMatchEnvelope(t *testing.T) {
+	email := &Email{From: "ana@example.org", Subject: "Invoice 7", Flags: []string{imap.SeenFlag}, Size: 2048, Folder: "INBOX"}
+	for query, want := range map[string]matchResult{
+		"from:ana":                matchYes,
+		"from:bob":                matchNo,
+		"invoice":                 matchYes,
+		"refund":                  matchMaybe,
+		"-refund":                 matchMaybe,
+		"-invoice":                matchNo,
+		"body:x OR from:ana":      matchYes,
+		"body:x from:bob":         matchNo,
+		"has:attachment is:read":  matchMaybe,
+		"larger:4K OR in:Archive": matchNo,
+	} {
+		q, _ := ParseQuery(query)
+		if got := q.Root.matchEnvelope(email); got != want {
+			t.Errorf("%q: expected %v, got %v", query, want, got)
+		}
+	}
+}
+
+func TestAdvancedSearchServerQuery(t *testing.T) {
+	opts := AdvancedSearchOptions{Query: "from:ana", EnableFuzzy: true, MinSize: 100, HasAttachments: true}
+	q, err := opts.ServerQuery()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := queryString(q.Root); got != "(larger: AND has:attachment)" || q.Root.Children[0].size != 99 {
+		t.Errorf("Expected only the size and attachment sent with fuzzy matching, got %s", got)
+	}
+
+	opts.EnableFuzzy, opts.MinSize, opts.HasAttachments = false, 0, false
+	if q, _ := opts.ServerQuery(); queryString(q.Root) != "from:ana" {
+		t.Errorf("Expected the query sent without fuzzy matching, got %s", queryString(q.Root))
+	}
+	if q, _ := (AdvancedSearchOptions{EnableFuzzy: true}).ServerQuery(); q != nil {
+		t.Errorf("Expected nothing to send, got %+v", q)
+	}
+}
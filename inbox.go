@@ -1,11 +1,10 @@
 package mailos
 
 import (
-	"encoding/json"
+	"database/sql"
 	"fmt"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
 	"time"
 
@@ -14,6 +13,7 @@ import (
 )
 
 type InboxData struct {
+	SchemaVersion    int       `json:"schema_version,omitempty"`
 	AccountEmail     string    `json:"account_email"`
 	LastFetchTime    time.Time `json:"last_fetch_time"`
 	LastEmailDate    time.Time `json:"last_email_date"`
@@ -28,7 +28,8 @@ type GlobalInbox struct {
 	LastUpdate time.Time              `json:"last_update"`
 }
 
-// GetGlobalInboxPath returns the path to the global inbox.json for an account
+// GetGlobalInboxPath returns the path of an account's inbox.json, where
+// versions before the archive database kept fetched emails
 func GetGlobalInboxPath(accountEmail string) (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
@@ -43,46 +44,51 @@ func GetGlobalInboxPath(accountEmail string) (string, error) {
 	return filepath.Join(accountDir, "inbox.json"), nil
 }
 
-// LoadGlobalInbox loads the global inbox for an account
+// LoadGlobalInbox loads an account's archived INBOX
 func LoadGlobalInbox(accountEmail string) (*InboxData, error) {
-	inboxPath, err := GetGlobalInboxPath(accountEmail)
+	dm, err := NewDatabaseManager(accountEmail)
 	if err != nil {
 		return nil, err
 	}
-	
-	// Check if file exists
-	if _, err := os.Stat(inboxPath); os.IsNotExist(err) {
-		// Create new inbox data
-		return &InboxData{
-			AccountEmail:    accountEmail,
-			LastFetchTime:   time.Time{},
-			LastEmailDate:   time.Time{},
-			TotalEmails:     0,
-			Emails:          []*Email{},
-			LastSyncVersion: 1,
-		}, nil
-	}
-	
-	data, err := os.ReadFile(inboxPath)
+	defer dm.Close()
+
+	emails, err := dm.queryEmails("INBOX", ReadOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to read inbox file: %v", err)
+		return nil, err
 	}
-	
-	var inboxData InboxData
-	if err := json.Unmarshal(data, &inboxData); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal inbox data: %v", err)
+	inboxData := &InboxData{
+		SchemaVersion:   InboxSchemaVersion,
+		AccountEmail:    accountEmail,
+		TotalEmails:     len(emails),
+		Emails:          emails,
+		LastSyncVersion: 1,
+	}
+	if emails == nil {
+		inboxData.Emails = []*Email{}
+	}
+
+	var lastSync, lastEmail sql.NullTime
+	err = dm.db.QueryRow(`
+		SELECT last_sync_time, last_email_date FROM sync_metadata
+		WHERE account_email = ? ORDER BY id DESC LIMIT 1
+	`, accountEmail).Scan(&lastSync, &lastEmail)
+	if err == nil {
+		inboxData.LastFetchTime = lastSync.Time.Local()
+		inboxData.LastEmailDate = lastEmail.Time.Local()
 	}
 	
-	return &inboxData, nil
+	return inboxData, nil
 }
 
-// SaveGlobalInbox saves the global inbox for an account
+// SaveGlobalInbox makes inboxData's emails the archived INBOX of an account
 func SaveGlobalInbox(accountEmail string, inboxData *InboxData) error {
-	inboxPath, err := GetGlobalInboxPath(accountEmail)
+	dm, err := NewDatabaseManager(accountEmail)
 	if err != nil {
 		return err
 	}
-	
+	defer dm.Close()
+
+	inboxData.SchemaVersion = InboxSchemaVersion
 	inboxData.LastFetchTime = time.Now()
 	inboxData.TotalEmails = len(inboxData.Emails)
 	
@@ -97,25 +103,18 @@ func SaveGlobalInbox(accountEmail string, inboxData *InboxData) error {
 		inboxData.LastEmailDate = latestDate
 	}
 	
-	data, err := json.MarshalIndent(inboxData, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal inbox data: %v", err)
-	}
-	
-	return os.WriteFile(inboxPath, data, 0600)
+	return dm.replaceFolder("INBOX", inboxData.Emails)
 }
 
-// FetchEmailsIncremental fetches emails incrementally based on last fetch time
+// FetchEmailsIncremental fetches INBOX into the local archive, adding new
+// emails and updating the flags of those already there
 func FetchEmailsIncremental(config *Config, limit int) error {
 	if config.Email == "" {
 		return fmt.Errorf("no email account configured")
 	}
 	
-	// Load existing inbox data
-	inboxData, err := LoadGlobalInbox(config.Email)
-	if err != nil {
-		return fmt.Errorf("failed to load inbox data: %v", err)
-	}
+	// Send changes made offline first, so they aren't undone by the fetch
+	replayBeforeFetch(config)
 	
 	// Connect to IMAP server
 	c, err := connectToIMAPServer(config)
@@ -124,6 +123,9 @@ func FetchEmailsIncremental(config *Config, limit int) error {
 	}
 	defer c.Logout()
 	
+	// Bring back snoozed messages that are due, so they're listed below
+	processDueSnoozes(config, c)
+	
 	// Select INBOX
 	_, err = c.Select("INBOX", false)
 	if err != nil {
@@ -145,8 +147,8 @@ func FetchEmailsIncremental(config *Config, limit int) error {
 	
 	if len(ids) == 0 {
 		fmt.Printf("No new emails found for %s\n", config.Email)
-		// Still update last fetch time
-		return SaveGlobalInbox(config.Email, inboxData)
+		// Still record the sync
+		return archiveEmails(config.Email, "INBOX", nil)
 	}
 	
 	fmt.Printf("Found %d new emails for %s\n", len(ids), config.Email)
@@ -168,7 +170,7 @@ func FetchEmailsIncremental(config *Config, limit int) error {
 	section := &imap.BodySectionName{}
 	done := make(chan error, 1)
 	go func() {
-		done <- c.Fetch(seqSet, []imap.FetchItem{imap.FetchEnvelope, imap.FetchFlags, section.FetchItem()}, messages)
+		done <- c.Fetch(seqSet, []imap.FetchItem{imap.FetchEnvelope, imap.FetchFlags, imap.FetchUid, section.FetchItem()}, messages)
 	}()
 	
 	var newEmails []*Email
@@ -184,59 +186,44 @@ func FetchEmailsIncremental(config *Config, limit int) error {
 		return fmt.Errorf("failed to fetch messages: %v", err)
 	}
 	
-	// Add new emails to existing inbox data
-	inboxData.Emails = append(inboxData.Emails, newEmails...)
-	
-	// Sort emails by date (newest first)
-	sort.Slice(inboxData.Emails, func(i, j int) bool {
-		return inboxData.Emails[i].Date.After(inboxData.Emails[j].Date)
-	})
-	
-	// Remove duplicates based on MessageID
-	inboxData.Emails = removeDuplicateEmails(inboxData.Emails)
-	
-	// Save updated inbox data
-	if err := SaveGlobalInbox(config.Email, inboxData); err != nil {
-		return fmt.Errorf("failed to save inbox data: %v", err)
+	// Save to the archive, where already archived emails are updated
+	dm, err := NewDatabaseManager(config.Email)
+	if err != nil {
+		return err
+	}
+	defer dm.Close()
+	if err := dm.StoreEmails("INBOX", newEmails); err != nil {
+		return fmt.Errorf("failed to save emails to the archive: %v", err)
 	}
+	var total int
+	dm.db.QueryRow("SELECT COUNT(*) FROM emails WHERE folder = 'INBOX'").Scan(&total)
 	
 	fmt.Printf("✓ Fetched and saved %d new emails for %s\n", len(newEmails), config.Email)
-	fmt.Printf("✓ Total emails in inbox: %d\n", len(inboxData.Emails))
+	fmt.Printf("✓ Total emails in inbox: %d\n", total)
+
+	// Link delivery status notifications back to the messages we sent
+	if updated, err := RecordDeliveryReports(config.Email, newEmails); err != nil {
+		fmt.Printf("Warning: failed to record delivery reports: %v\n", err)
+	} else if updated > 0 {
+		fmt.Printf("✓ Updated delivery status for %d recipient(s); see 'mailos sent --status'\n", updated)
+	}
+
+	// Replies clear reminders set with 'mailos send --remind-if-no-reply'
+	recordFollowupReplies(config.Email, newEmails)
 	
 	return nil
 }
 
-// GetEmailsFromInbox returns emails from the global inbox with filtering options
+// GetEmailsFromInbox returns archived INBOX emails, newest first, filtered
+// and paged in the database
 func GetEmailsFromInbox(accountEmail string, opts ReadOptions) ([]*Email, error) {
-	inboxData, err := LoadGlobalInbox(accountEmail)
+	dm, err := NewDatabaseManager(accountEmail)
 	if err != nil {
 		return nil, err
 	}
-	
-	var filteredEmails []*Email
-	
-	// Apply filters
-	for _, email := range inboxData.Emails {
-		// Apply filters similar to readFromLocalStorage
-		if opts.FromAddress != "" && !containsIgnoreCase(email.From, opts.FromAddress) {
-			continue
-		}
-		if opts.Subject != "" && !containsIgnoreCase(email.Subject, opts.Subject) {
-			continue
-		}
-		if !opts.Since.IsZero() && email.Date.Before(opts.Since) {
-			continue
-		}
-		
-		filteredEmails = append(filteredEmails, email)
-	}
-	
-	// Apply limit
-	if opts.Limit > 0 && len(filteredEmails) > opts.Limit {
-		filteredEmails = filteredEmails[:opts.Limit]
-	}
-	
-	return filteredEmails, nil
+	defer dm.Close()
+
+	return dm.queryEmails("INBOX", opts)
 }
 
 // SyncAllAccounts fetches emails for all configured accounts
@@ -287,7 +274,7 @@ func connectToIMAPServer(config *Config) (*client.Client, error) {
 		c, err = client.Dial(fmt.Sprintf("%s:%d", imapHost, imapPort))
 	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to IMAP server: %v", err)
+		return nil, fmt.Errorf("failed to connect to IMAP server: %w", err)
 	}
 	
 	if err := c.Login(config.Email, config.Password); err != nil {
@@ -298,27 +285,6 @@ func connectToIMAPServer(config *Config) (*client.Client, error) {
 	return c, nil
 }
 
-// removeDuplicateEmails removes duplicate emails based on MessageID
-func removeDuplicateEmails(emails []*Email) []*Email {
-	seen := make(map[string]bool)
-	var unique []*Email
-	
-	for _, email := range emails {
-		key := email.MessageID
-		if key == "" {
-			// Fallback: use subject + date + from as key
-			key = fmt.Sprintf("%s_%d_%s", email.Subject, email.Date.Unix(), email.From)
-		}
-		
-		if !seen[key] {
-			seen[key] = true
-			unique = append(unique, email)
-		}
-	}
-	
-	return unique
-}
-
 // containsIgnoreCase checks if haystack contains needle (case insensitive)
 func containsIgnoreCase(haystack, needle string) bool {
 	return len(needle) == 0 || 
@@ -387,10 +353,12 @@ func ListAccountInboxes() ([]string, error) {
 	var accounts []string
 	for _, entry := range entries {
 		if entry.IsDir() {
-			// Check if this directory has an inbox.json
-			inboxPath := filepath.Join(emailDir, entry.Name(), "inbox.json")
-			if _, err := os.Stat(inboxPath); err == nil {
-				accounts = append(accounts, entry.Name())
+			// Check if this directory has an archive, or an inbox.json still to import
+			for _, name := range []string{"archive.db", "inbox.json"} {
+				if _, err := os.Stat(filepath.Join(emailDir, entry.Name(), name)); err == nil {
+					accounts = append(accounts, entry.Name())
+					break
+				}
 			}
 		}
 	}
@@ -400,30 +368,29 @@ func ListAccountInboxes() ([]string, error) {
 
 // CleanupOldEmails removes emails older than the specified duration
 func CleanupOldEmails(accountEmail string, olderThan time.Duration) error {
-	inboxData, err := LoadGlobalInbox(accountEmail)
+	dm, err := NewDatabaseManager(accountEmail)
 	if err != nil {
 		return err
 	}
+	defer dm.Close()
 	
 	cutoffDate := time.Now().Add(-olderThan)
-	var keptEmails []*Email
-	removedCount := 0
-	
-	for _, email := range inboxData.Emails {
-		if email.Date.After(cutoffDate) {
-			keptEmails = append(keptEmails, email)
-		} else {
-			removedCount++
-		}
+	old, err := dm.selectEmails("folder = 'INBOX' AND date_sent <= ?", []interface{}{archiveTime(cutoffDate)}, "")
+	if err != nil {
+		return err
+	}
+	if len(old) == 0 {
+		return nil
 	}
 	
-	if removedCount > 0 {
-		inboxData.Emails = keptEmails
-		if err := SaveGlobalInbox(accountEmail, inboxData); err != nil {
-			return err
-		}
-		fmt.Printf("Removed %d emails older than %v for %s\n", removedCount, olderThan, accountEmail)
+	var keys []string
+	for _, email := range old {
+		keys = append(keys, archiveKey(email))
+	}
+	if err := dm.deleteArchived("INBOX", keys); err != nil {
+		return err
 	}
+	fmt.Printf("Removed %d emails older than %v for %s\n", len(old), olderThan, accountEmail)
 	
 	return nil
 }
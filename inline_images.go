@@ -0,0 +1,241 @@
+package mailos
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxRemoteImageSize caps how much we download when embedding a remote image
+const maxRemoteImageSize = 5 * 1024 * 1024
+
+// InlineImage is an image sent as a multipart/related part and referenced by cid:
+type InlineImage struct {
+	ContentID string // Without angle brackets
+	Filename  string
+	MIMEType  string
+	Data      []byte
+}
+
+// imgSrcPattern matches the src attribute of <img> tags, capturing the quote and value
+var imgSrcPattern = regexp.MustCompile(`(?is)(<img\b[^>]*?\bsrc\s*=\s*)(["'])(.*?)(["'])`)
+
+// quotedImageAttr marks <img> tags copied from someone else's mail into a
+// reply or forward. It comes before src, and such images are never read from
+// disk or fetched.
+const quotedImageAttr = "data-mailos-quoted"
+
+// contentIDUnsafe matches characters we drop from filenames when building a Content-ID
+var contentIDUnsafe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// remoteImageClient is used to fetch remote images when embedding them
+var remoteImageClient = &http.Client{Timeout: 15 * time.Second}
+
+// EmbedInlineImages rewrites <img> sources in an HTML body to cid: references and
+// returns the images to attach. Local paths (relative to baseDir), file:// URLs and
+// data: URIs are always embedded; http(s) images only when fetchRemote is set.
+// Quoted images only have their data: URIs embedded. Images that can't be
+// read are left untouched.
+func EmbedInlineImages(bodyHTML, baseDir string, fetchRemote bool) (string, []InlineImage) {
+	var images []InlineImage
+	bySource := make(map[string]string) // src -> content ID, so repeated images are sent once
+
+	result := imgSrcPattern.ReplaceAllStringFunc(bodyHTML, func(tag string) string {
+		m := imgSrcPattern.FindStringSubmatch(tag)
+		prefix, quote, rawSrc := m[1], m[2], m[3]
+		src := html.UnescapeString(strings.TrimSpace(rawSrc))
+
+		// Only what the user wrote may point at their files
+		if strings.Contains(strings.ToLower(prefix), quotedImageAttr) && !strings.HasPrefix(strings.ToLower(src), "data:") {
+			return tag
+		}
+
+		if cid, ok := bySource[src]; ok {
+			return prefix + quote + "cid:" + cid + quote
+		}
+
+		image, err := loadInlineImage(src, baseDir, fetchRemote)
+		if err != nil || image == nil {
+			if err != nil && IsDebugMode() {
+				fmt.Printf("Debug: not embedding image %s: %v\n", src, err)
+			}
+			return tag
+		}
+
+		bySource[src] = image.ContentID
+		images = append(images, *image)
+		return prefix + quote + "cid:" + image.ContentID + quote
+	})
+
+	return result, images
+}
+
+// loadInlineImage reads the image behind an <img> src. It returns nil without an
+// error for sources that should stay as they are (cid:, remote when not fetching).
+func loadInlineImage(src, baseDir string, fetchRemote bool) (*InlineImage, error) {
+	lower := strings.ToLower(src)
+
+	switch {
+	case src == "" || strings.HasPrefix(lower, "cid:"):
+		return nil, nil
+
+	case strings.HasPrefix(lower, "data:"):
+		mimeType, data, err := decodeDataURI(src)
+		if err != nil {
+			return nil, err
+		}
+		return newInlineImage("image"+extensionForMIME(mimeType), mimeType, data), nil
+
+	case strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://"):
+		if !fetchRemote {
+			return nil, nil
+		}
+		return fetchRemoteImage(src)
+
+	default:
+		path := src
+		if strings.HasPrefix(lower, "file://") {
+			u, err := url.Parse(src)
+			if err != nil {
+				return nil, err
+			}
+			path = u.Path
+		} else if strings.HasPrefix(path, "~/") {
+			if home, err := os.UserHomeDir(); err == nil {
+				path = filepath.Join(home, path[2:])
+			}
+		} else if !filepath.IsAbs(path) {
+			// Don't guess at other URL schemes such as mailto: or ftp:
+			if u, err := url.Parse(path); err == nil && u.Scheme != "" && len(u.Scheme) > 1 {
+				return nil, nil
+			}
+			path = filepath.Join(baseDir, path)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		mimeType := mime.TypeByExtension(strings.ToLower(filepath.Ext(path)))
+		if mimeType == "" {
+			mimeType = http.DetectContentType(data)
+		}
+		if !strings.HasPrefix(mimeType, "image/") {
+			return nil, fmt.Errorf("%s is not an image (%s)", path, mimeType)
+		}
+		return newInlineImage(filepath.Base(path), mimeType, data), nil
+	}
+}
+
+// fetchRemoteImage downloads an image so it can be sent inline
+func fetchRemoteImage(src string) (*InlineImage, error) {
+	resp, err := remoteImageClient.Get(src)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxRemoteImageSize {
+		return nil, fmt.Errorf("image larger than %d bytes", maxRemoteImageSize)
+	}
+
+	mimeType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !strings.HasPrefix(mimeType, "image/") {
+		mimeType, _, _ = mime.ParseMediaType(http.DetectContentType(data))
+	}
+	if !strings.HasPrefix(mimeType, "image/") {
+		return nil, fmt.Errorf("not an image (%s)", mimeType)
+	}
+
+	filename := "image" + extensionForMIME(mimeType)
+	if u, err := url.Parse(src); err == nil {
+		if base := filepath.Base(u.Path); base != "." && base != "/" {
+			filename = base
+		}
+	}
+
+	return newInlineImage(filename, mimeType, data), nil
+}
+
+// decodeDataURI extracts the MIME type and bytes from a base64 data: URI
+func decodeDataURI(uri string) (string, []byte, error) {
+	comma := strings.Index(uri, ",")
+	if comma < 0 {
+		return "", nil, fmt.Errorf("malformed data URI")
+	}
+	meta := uri[len("data:"):comma]
+	payload := uri[comma+1:]
+
+	if !strings.HasSuffix(strings.ToLower(meta), ";base64") {
+		return "", nil, fmt.Errorf("only base64 data URIs are supported")
+	}
+	mimeType := strings.TrimSpace(meta[:len(meta)-len(";base64")])
+	if !strings.HasPrefix(strings.ToLower(mimeType), "image/") {
+		return "", nil, fmt.Errorf("data URI is not an image (%s)", mimeType)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(payload), ""))
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid base64 in data URI: %v", err)
+	}
+	return mimeType, data, nil
+}
+
+// extensionForMIME returns a file extension for an image MIME type
+func extensionForMIME(mimeType string) string {
+	switch mimeType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	case "image/svg+xml":
+		return ".svg"
+	}
+	return ""
+}
+
+// newInlineImage assigns a unique Content-ID to image data
+func newInlineImage(filename, mimeType string, data []byte) *InlineImage {
+	return &InlineImage{
+		ContentID: generateContentID(filename),
+		Filename:  filename,
+		MIMEType:  mimeType,
+		Data:      data,
+	}
+}
+
+// generateContentID returns a globally unique Content-ID for an inline part
+func generateContentID(filename string) string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+
+	name := strings.TrimSuffix(filename, filepath.Ext(filename))
+	name = contentIDUnsafe.ReplaceAllString(name, "")
+	if name == "" {
+		name = "image"
+	}
+	return fmt.Sprintf("%s.%s@emailos", name, hex.EncodeToString(buf))
+}
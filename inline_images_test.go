@@ -0,0 +1,160 @@
+package mailos
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-message/mail"
+)
+
+func TestEmbedInlineImages(t *testing.T) {
+	dir := t.TempDir()
+	png := []byte("\x89PNG\r\n\x1a\nlogo")
+	if err := os.WriteFile(filepath.Join(dir, "logo.png"), png, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("LocalImagesBecomeCID", func(t *testing.T) {
+		html := `<p>Hi</p><img src="logo.png" alt="a"><img alt="b" src='logo.png'>`
+		out, images := EmbedInlineImages(html, dir, false)
+		if len(images) != 1 {
+			t.Fatalf("Expected the repeated image to be embedded once, got %d", len(images))
+		}
+		if images[0].MIMEType != "image/png" || string(images[0].Data) != string(png) {
+			t.Errorf("Unexpected image %+v", images[0])
+		}
+		cid := "cid:" + images[0].ContentID
+		if strings.Count(out, cid) != 2 || strings.Contains(out, "logo.png\"") {
+			t.Errorf("Expected both tags rewritten to %s, got %s", cid, out)
+		}
+	})
+
+	t.Run("ProfileImageTag", func(t *testing.T) {
+		tag := getProfileImageTag(filepath.Join(dir, "logo.png"))
+		if strings.Contains(tag, "data:") {
+			t.Errorf("Profile image should no longer be a data: URI")
+		}
+		_, images := EmbedInlineImages(tag, "/nonexistent", false)
+		if len(images) != 1 {
+			t.Errorf("Expected the profile image to embed from its absolute path")
+		}
+	})
+
+	t.Run("DataURIConverted", func(t *testing.T) {
+		src := "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+		out, images := EmbedInlineImages(`<img src="`+src+`">`, dir, false)
+		if len(images) != 1 || string(images[0].Data) != string(png) {
+			t.Fatalf("Expected the data URI to become an inline part")
+		}
+		if strings.Contains(out, "data:") {
+			t.Errorf("Expected data URI removed from HTML")
+		}
+	})
+
+	t.Run("LeftAlone", func(t *testing.T) {
+		html := `<img src="missing.png"><img src="notes.txt"><img src="cid:existing@x"><img src="https://example.com/a.png">`
+		out, images := EmbedInlineImages(html, dir, false)
+		if len(images) != 0 || out != html {
+			t.Errorf("Expected unreadable, non-image, cid and remote sources untouched, got %s", out)
+		}
+	})
+
+	t.Run("QuotedImagesNotRead", func(t *testing.T) {
+		data := "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+		quoted := sanitizeQuotedHTML(`<img src="logo.png"><img src="`+filepath.Join(dir, "logo.png")+`"><img src="`+data+`">`, -1)
+		out, images := EmbedInlineImages(`<img src="logo.png">`+quoted, dir, true)
+		if len(images) != 2 {
+			t.Fatalf("Expected the user's image and the quoted data: URI embedded, got %d", len(images))
+		}
+		if strings.Count(out, "cid:") != 2 || strings.Count(out, quotedImageAttr) != 3 {
+			t.Errorf("Expected quoted local images left untouched, got %s", out)
+		}
+	})
+
+	t.Run("RemoteImages", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/banner.png":
+				w.Header().Set("Content-Type", "image/png")
+				w.Write(png)
+			case "/page":
+				w.Header().Set("Content-Type", "text/html")
+				w.Write([]byte("<html></html>"))
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		defer server.Close()
+
+		html := `<img src="` + server.URL + `/banner.png"><img src="` + server.URL + `/page"><img src="` + server.URL + `/gone.png">`
+		out, images := EmbedInlineImages(html, dir, false)
+		if len(images) != 0 || out != html {
+			t.Errorf("Expected remote images untouched unless requested")
+		}
+
+		out, images = EmbedInlineImages(html, dir, true)
+		if len(images) != 1 || images[0].Filename != "banner.png" {
+			t.Fatalf("Expected only the real image fetched, got %d", len(images))
+		}
+		if !strings.Contains(out, "cid:"+images[0].ContentID) || !strings.Contains(out, server.URL+"/page") {
+			t.Errorf("Unexpected rewrite: %s", out)
+		}
+	})
+}
+
+func TestInlineImagesSentAsRelated(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\nlogo")
+	images := []InlineImage{{ContentID: "logo.1@emailos", Filename: "logo.png", MIMEType: "image/png", Data: png}}
+
+	raw, err := BuildMessage(&OutgoingMessage{
+		From:         "a@example.com",
+		TextBody:     "logo",
+		HTMLBody:     `<img src="cid:logo.1@emailos">`,
+		InlineImages: images,
+	})
+	if err != nil {
+		t.Fatalf("Failed to build message: %v", err)
+	}
+
+	mr, err := mail.CreateReader(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Failed to parse message: %v", err)
+	}
+	if ct, _, _ := mr.Header.ContentType(); ct != "multipart/alternative" {
+		t.Fatalf("Expected multipart/alternative, got %s", ct)
+	}
+
+	var sawHTML, sawImage bool
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read part: %v", err)
+		}
+		ct, _, _ := p.Header.(interface {
+			ContentType() (string, map[string]string, error)
+		}).ContentType()
+		body, _ := io.ReadAll(p.Body)
+		switch ct {
+		case "text/html":
+			sawHTML = strings.Contains(string(body), "cid:logo.1@emailos")
+		case "image/png":
+			sawImage = string(body) == string(png) && p.Header.Get("Content-Id") == "<logo.1@emailos>"
+		}
+	}
+	if !sawHTML || !sawImage {
+		t.Errorf("Expected HTML and inline image parts (html=%v image=%v)", sawHTML, sawImage)
+	}
+}
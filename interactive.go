@@ -2,6 +2,7 @@ package mailos
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -34,6 +35,8 @@ func InteractiveMode() error {
 	fmt.Println()
 
 	reader := bufio.NewReader(os.Stdin)
+	agent, closeTranscript := startChatAgent(reader)
+	defer closeTranscript()
 
 	for {
 		fmt.Print("mailos> ")
@@ -61,7 +64,7 @@ func InteractiveMode() error {
 			}
 		} else {
 			// Handle as AI query
-			if err := handleAIQuery(input); err != nil {
+			if err := handleAIQuery(input, agent); err != nil {
 				fmt.Printf("Error: %v\n", err)
 			}
 		}
@@ -122,8 +125,48 @@ func handleSlashCommand(command string) error {
 	}
 }
 
-// handleAIQuery sends the query to the configured AI provider
-func handleAIQuery(query string) error {
+// startChatAgent sets up the built-in agent when the AI backend can call
+// tools, logging the session to a transcript. Otherwise questions go to the
+// AI CLI as before and the returned agent is nil.
+func startChatAgent(reader *bufio.Reader) (*Agent, func()) {
+	config, err := LoadConfig()
+	if err != nil || !config.HasAIBackend() {
+		return nil, func() {}
+	}
+	agent, err := NewChatAgent(config)
+	if err != nil {
+		fmt.Printf("⚠️  AI agent unavailable: %v\n\n", err)
+		return nil, func() {}
+	}
+	if agent == nil {
+		return nil, func() {}
+	}
+	agent.Confirm = ConfirmAgentAction(reader, os.Stdout)
+
+	fmt.Printf("🤖 Questions go to %s, which can search, read, draft, label and move mail.\n", agent.Backend.Name())
+	fmt.Println("   Sending or deleting asks you first.")
+	transcript, err := OpenChatTranscript(config.Email)
+	if err != nil {
+		fmt.Printf("⚠️  Could not start a transcript: %v\n\n", err)
+		return agent, func() {}
+	}
+	agent.Transcript = transcript
+	fmt.Printf("   Transcript: %s\n\n", transcript.Name())
+	return agent, func() { transcript.Close() }
+}
+
+// handleAIQuery sends the query to the chat agent, or to the configured AI
+// provider when there is none
+func handleAIQuery(query string, agent *Agent) error {
+	if agent != nil {
+		answer, err := agent.Ask(context.Background(), query)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("\n%s\n", strings.TrimSpace(answer))
+		return nil
+	}
+
 	// Check if AI provider is configured
 	config, err := LoadConfig()
 	if err != nil {
@@ -131,7 +174,7 @@ func handleAIQuery(query string) error {
 		return nil
 	}
 
-	if config.DefaultAICLI == "" || config.DefaultAICLI == "none" {
+	if !config.HasAIBackend() {
 		fmt.Println("No AI provider configured.")
 		fmt.Println("Would you like to configure one now? (y/n)")
 
@@ -647,6 +690,15 @@ func ShowEnhancedInfo() error {
 		fmt.Printf("  Display Name: %s\n", config.FromName)
 	}
 
+	// Saved searches, counted in the local archive
+	if searches, err := CountSavedSearches(config.Email); err == nil && len(searches) > 0 {
+		fmt.Println("\nSaved Searches")
+		fmt.Println("━━━━━━━━━━━━━━")
+		for _, search := range searches {
+			fmt.Printf("  %-24s %d emails\n", search.Name, search.Count)
+		}
+	}
+
 	fmt.Println("\nTip: Use 'mailos configure --local' to create a local config for this project")
 
 	// Common Commands Section
@@ -35,7 +35,7 @@ func DeleteEmailsFromFolder(ids []uint32, folder string, config ConfigInterface)
 		c, err = client.Dial(fmt.Sprintf("%s:%d", imapHost, imapPort))
 	}
 	if err != nil {
-		return fmt.Errorf("failed to connect to IMAP server: %v", err)
+		return fmt.Errorf("failed to connect to IMAP server: %w", err)
 	}
 	defer c.Logout()
 
@@ -0,0 +1,471 @@
+package mailos
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/mail"
+	"github.com/emersion/go-message/textproto"
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+	"golang.org/x/text/unicode/norm"
+)
+
+// AuthVerdict is the stored sender authentication and phishing analysis of a message
+type AuthVerdict struct {
+	AuthServ   string       `json:"authserv,omitempty"`   // Server that added Authentication-Results
+	SPF        string       `json:"spf,omitempty"`        // pass, fail, softfail, neutral, none, ...
+	DKIM       string       `json:"dkim,omitempty"`       // From Authentication-Results, or the offline check
+	DMARC      string       `json:"dmarc,omitempty"`      // From Authentication-Results
+	Signatures []DKIMResult `json:"signatures,omitempty"` // Offline DKIM verification
+	Warnings   []string     `json:"warnings,omitempty"`
+	Suspicious bool         `json:"suspicious,omitempty"`
+}
+
+// AuthResult is one method result of an Authentication-Results header (RFC 8601)
+type AuthResult struct {
+	Method string
+	Result string
+	Props  map[string]string // Such as header.from or smtp.mailfrom
+}
+
+// ParseAuthenticationResults parses an Authentication-Results header value
+// into the authserv-id and its method results
+func ParseAuthenticationResults(value string) (string, []AuthResult) {
+	parts := strings.Split(stripHeaderComments(value), ";")
+	authServ := ""
+	if fields := strings.Fields(parts[0]); len(fields) > 0 {
+		authServ = strings.ToLower(fields[0])
+	}
+
+	var results []AuthResult
+	for _, part := range parts[1:] {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+		method, result, ok := strings.Cut(fields[0], "=")
+		if !ok {
+			continue
+		}
+		method, _, _ = strings.Cut(method, "/")
+		ar := AuthResult{Method: strings.ToLower(method), Result: strings.ToLower(result), Props: make(map[string]string)}
+		for _, field := range fields[1:] {
+			if name, value, ok := strings.Cut(field, "="); ok {
+				ar.Props[strings.ToLower(name)] = value
+			}
+		}
+		results = append(results, ar)
+	}
+	return authServ, results
+}
+
+// stripHeaderComments removes (comments) and the quotes around quoted strings
+func stripHeaderComments(value string) string {
+	var out strings.Builder
+	depth, quoted, escaped := 0, false, false
+	for _, r := range value {
+		switch {
+		case escaped:
+			escaped = false
+			if depth == 0 {
+				out.WriteRune(r)
+			}
+		case r == '\\' && (quoted || depth > 0):
+			escaped = true
+		case r == '"' && depth == 0:
+			quoted = !quoted
+		case r == '(' && !quoted:
+			depth++
+		case r == ')' && !quoted && depth > 0:
+			depth--
+		case r == ';' && quoted:
+			// Keep quoted separators from splitting the results
+			out.WriteRune(',')
+		case depth == 0:
+			out.WriteRune(r)
+		}
+	}
+	return out.String()
+}
+
+// parseReceivedSPF returns the result keyword of a Received-SPF header
+func parseReceivedSPF(value string) string {
+	if fields := strings.Fields(value); len(fields) > 0 {
+		return strings.ToLower(fields[0])
+	}
+	return ""
+}
+
+// AnalyzeMessageAuth reads the authentication headers of a raw message,
+// verifies its DKIM signatures offline and checks for phishing signals
+func AnalyzeMessageAuth(raw []byte, keys DKIMKeys) *AuthVerdict {
+	verdict := &AuthVerdict{}
+	th, err := textproto.ReadHeader(bufio.NewReader(bytes.NewReader(raw)))
+	if err != nil {
+		return verdict
+	}
+	header := mail.Header{Header: message.Header{Header: th}}
+
+	// Domains with a passing DKIM signature, by our provider or checked here
+	var signedBy []string
+
+	// Only the topmost authserv-id was added by our own provider
+	for _, value := range header.Values("Authentication-Results") {
+		authServ, results := ParseAuthenticationResults(value)
+		if verdict.AuthServ == "" {
+			verdict.AuthServ = authServ
+		} else if authServ != verdict.AuthServ {
+			continue
+		}
+		for _, result := range results {
+			switch result.Method {
+			case "spf":
+				verdict.SPF = preferPass(verdict.SPF, result.Result)
+			case "dkim":
+				verdict.DKIM = preferPass(verdict.DKIM, result.Result)
+				if result.Result == "pass" {
+					signedBy = append(signedBy, strings.ToLower(result.Props["header.d"]))
+				}
+			case "dmarc":
+				verdict.DMARC = preferPass(verdict.DMARC, result.Result)
+			}
+		}
+	}
+	if verdict.SPF == "" {
+		verdict.SPF = parseReceivedSPF(header.Get("Received-SPF"))
+	}
+
+	verdict.Signatures = VerifyDKIM(raw, keys)
+	localDKIM := ""
+	for _, signature := range verdict.Signatures {
+		if signature.Result != DKIMUnverified {
+			localDKIM = preferPass(localDKIM, signature.Result)
+		}
+		if signature.Result == DKIMPass {
+			signedBy = append(signedBy, signature.Domain)
+		}
+	}
+	if verdict.DKIM == "" {
+		verdict.DKIM = localDKIM
+	}
+
+	var from *mail.Address
+	var fromDomain, fromOrg string
+	if addresses, err := header.AddressList("From"); err == nil && len(addresses) > 0 {
+		from = addresses[0]
+		fromDomain = addressDomain(from.Address)
+		fromOrg = organizationalDomain(fromDomain)
+	}
+
+	// A signature only vouches for the sender when it's by the sender's own
+	// domain; anyone can sign with a domain of their own
+	dmarcPass := verdict.DMARC == "pass"
+	dkimPass := false
+	for _, domain := range signedBy {
+		dkimPass = dkimPass || (domain != "" && fromOrg != "" && organizationalDomain(domain) == fromOrg)
+	}
+	if verdict.DMARC == "fail" {
+		verdict.flag(true, "DMARC failed: the sender's domain did not authorize this message")
+	}
+	if verdict.SPF == "fail" || verdict.SPF == "softfail" {
+		verdict.flag(!dkimPass && !dmarcPass, "SPF %s: the sending server is not authorized for the sender's domain", verdict.SPF)
+	}
+	if verdict.DKIM == "fail" || localDKIM == "fail" {
+		verdict.flag(!dkimPass && !dmarcPass, "DKIM signature failed: the message may have been altered")
+	}
+
+	if from == nil {
+		return verdict
+	}
+
+	if claim := displayNameClaim(from.Name, fromOrg); claim != "" {
+		verdict.flag(true, "Display name claims %s but the sender is %s", claim, from.Address)
+	}
+
+	var recipients []string
+	for _, key := range []string{"To", "Cc"} {
+		addresses, _ := header.AddressList(key)
+		for _, address := range addresses {
+			recipients = append(recipients, addressDomain(address.Address))
+		}
+	}
+	if original := lookalikeOf(fromDomain, recipients); original != "" {
+		verdict.flag(true, "Sender domain %s looks like %s", fromDomain, original)
+	}
+
+	replyTo, _ := header.AddressList("Reply-To")
+	for _, address := range replyTo {
+		replyDomain := addressDomain(address.Address)
+		if replyDomain == "" || organizationalDomain(replyDomain) == fromOrg {
+			continue
+		}
+		freemail := freemailDomains[organizationalDomain(replyDomain)] && !freemailDomains[fromOrg]
+		verdict.flag(freemail || lookalikeOf(replyDomain, recipients) != "", "Reply-To %s is outside the sender's domain %s", address.Address, fromDomain)
+	}
+
+	return verdict
+}
+
+// headerValues collects the decoded header fields of a message, top to bottom
+func headerValues(header mail.Header) map[string][]string {
+	values := make(map[string][]string)
+	fields := header.Fields()
+	for fields.Next() {
+		value, err := fields.Text()
+		if err != nil {
+			value = fields.Value()
+		}
+		values[fields.Key()] = append(values[fields.Key()], value)
+	}
+	return values
+}
+
+// flag records a warning, marking the message suspicious when serious
+func (v *AuthVerdict) flag(serious bool, format string, args ...interface{}) {
+	v.Warnings = append(v.Warnings, fmt.Sprintf(format, args...))
+	v.Suspicious = v.Suspicious || serious
+}
+
+// preferPass combines results for several signatures: any pass wins
+func preferPass(current, result string) string {
+	if current == "" || result == "pass" {
+		return result
+	}
+	return current
+}
+
+func addressDomain(address string) string {
+	if idx := strings.LastIndex(address, "@"); idx >= 0 {
+		return strings.ToLower(strings.TrimSuffix(address[idx+1:], "."))
+	}
+	return ""
+}
+
+// organizationalDomain returns the registrable part of a domain, like mail.example.co.uk -> example.co.uk
+func organizationalDomain(domain string) string {
+	if org, err := publicsuffix.EffectiveTLDPlusOne(domain); err == nil {
+		return org
+	}
+	return domain
+}
+
+// brandDomains are frequently impersonated senders and their own domains
+var brandDomains = map[string][]string{
+	"paypal":    {"paypal.com"},
+	"apple":     {"apple.com", "icloud.com"},
+	"microsoft": {"microsoft.com", "outlook.com", "office.com", "live.com"},
+	"google":    {"google.com", "gmail.com", "youtube.com"},
+	"amazon":    {"amazon.com", "amazonaws.com"},
+	"netflix":   {"netflix.com"},
+	"docusign":  {"docusign.com", "docusign.net"},
+	"dropbox":   {"dropbox.com"},
+	"facebook":  {"facebook.com", "facebookmail.com"},
+	"instagram": {"instagram.com"},
+	"linkedin":  {"linkedin.com"},
+	"github":    {"github.com"},
+	"dhl":       {"dhl.com"},
+	"fedex":     {"fedex.com"},
+}
+
+// freemailDomains give anyone an address, so replies there are easy to hijack
+var freemailDomains = map[string]bool{
+	"gmail.com": true, "googlemail.com": true, "yahoo.com": true, "outlook.com": true,
+	"hotmail.com": true, "live.com": true, "aol.com": true, "icloud.com": true,
+	"proton.me": true, "protonmail.com": true, "gmx.com": true, "mail.com": true,
+	"yandex.com": true, "zoho.com": true,
+}
+
+var nameAddressPattern = regexp.MustCompile(`[^\s<>"'()@]+@([a-z0-9-]+(?:\.[a-z0-9-]+)+)`)
+var nameDomainPattern = regexp.MustCompile(`\b[a-z0-9-]+(?:\.[a-z0-9-]+)*\.[a-z]{2,}\b`)
+var wordPattern = regexp.MustCompile(`[a-z0-9]+`)
+
+// displayNameClaim returns an address, domain or brand in the display name
+// that the sender's domain doesn't belong to
+func displayNameClaim(name, fromOrg string) string {
+	name = strings.ToLower(name)
+	if strings.Contains(name, " via ") {
+		// Mailing lists rewrite the sender as "someone via list"
+		return ""
+	}
+	if match := nameAddressPattern.FindStringSubmatch(name); match != nil {
+		if organizationalDomain(match[1]) != fromOrg {
+			return match[0]
+		}
+		return ""
+	}
+	for _, domain := range nameDomainPattern.FindAllString(name, -1) {
+		if suffix, icann := publicsuffix.PublicSuffix(domain); icann && suffix != domain && organizationalDomain(domain) != fromOrg {
+			return domain
+		}
+	}
+	for _, word := range wordPattern.FindAllString(name, -1) {
+		domains, ok := brandDomains[word]
+		if !ok {
+			continue
+		}
+		owned := false
+		for _, domain := range domains {
+			owned = owned || domain == fromOrg
+		}
+		if !owned {
+			return strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return ""
+}
+
+// lookalikeOf returns the brand or recipient domain that domain imitates
+func lookalikeOf(domain string, recipients []string) string {
+	org := organizationalDomain(domain)
+	if org == "" {
+		return ""
+	}
+	type candidate struct {
+		domain string
+		brand  bool
+	}
+	var candidates []candidate
+	brands := make([]string, 0, len(brandDomains))
+	for brand := range brandDomains {
+		brands = append(brands, brand)
+	}
+	sort.Strings(brands)
+	for _, brand := range brands {
+		for _, d := range brandDomains[brand] {
+			candidates = append(candidates, candidate{d, true})
+		}
+	}
+	for _, recipient := range recipients {
+		if recipient != "" && !freemailDomains[organizationalDomain(recipient)] {
+			candidates = append(candidates, candidate{organizationalDomain(recipient), false})
+		}
+	}
+	for _, c := range candidates {
+		if c.domain == org {
+			return ""
+		}
+	}
+
+	label := registrableLabel(org)
+	skeleton := confusableSkeleton(org)
+	for _, c := range candidates {
+		cLabel := registrableLabel(c.domain)
+		switch {
+		case skeleton == confusableSkeleton(c.domain):
+			return c.domain
+		case len(cLabel) >= 5 && editDistance(label, cLabel) == 1:
+			return c.domain
+		case c.brand && strings.Contains("-"+label+"-", "-"+cLabel+"-"):
+			return c.domain
+		}
+	}
+	return ""
+}
+
+// registrableLabel returns the label before the public suffix, like example for example.co.uk
+func registrableLabel(org string) string {
+	suffix, _ := publicsuffix.PublicSuffix(org)
+	return strings.TrimSuffix(strings.TrimSuffix(org, suffix), ".")
+}
+
+// confusableReplacer maps characters and sequences that render alike to one form
+var confusableReplacer = strings.NewReplacer(
+	// Cyrillic
+	"а", "a", "е", "e", "о", "o", "р", "p", "с", "c", "у", "y", "х", "x", "і", "i",
+	"ј", "j", "ѕ", "s", "ԁ", "d", "һ", "h", "ӏ", "l", "ԛ", "q", "ԝ", "w", "ь", "b",
+	// Greek
+	"α", "a", "ο", "o", "ν", "v", "τ", "t", "ι", "i", "κ", "k", "ρ", "p", "υ", "u",
+	// Latin lookalikes
+	"0", "o", "1", "l", "i", "l", "rn", "m", "vv", "w", "cl", "d",
+)
+
+// confusableSkeleton decodes punycode and folds confusable characters, so
+// domains that look the same on screen compare equal
+func confusableSkeleton(domain string) string {
+	if decoded, err := idna.ToUnicode(domain); err == nil {
+		domain = decoded
+	}
+	var folded strings.Builder
+	for _, r := range norm.NFD.String(strings.ToLower(domain)) {
+		if !unicode.Is(unicode.Mn, r) {
+			folded.WriteRune(r)
+		}
+	}
+	return confusableReplacer.Replace(folded.String())
+}
+
+// editDistance is the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current := make([]int, len(rb)+1)
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(min(previous[j]+1, current[j-1]+1), previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(rb)]
+}
+
+// FormatAuthVerdict formats the authentication results for display
+func FormatAuthVerdict(v *AuthVerdict) string {
+	if v == nil {
+		return "🔐 No authentication results stored for this message\n"
+	}
+	var out strings.Builder
+	if v.AuthServ != "" {
+		out.WriteString(fmt.Sprintf("🔐 Authentication (checked by %s):\n", v.AuthServ))
+	} else {
+		out.WriteString("🔐 Authentication:\n")
+	}
+	for _, row := range [][2]string{{"SPF", v.SPF}, {"DKIM", v.DKIM}, {"DMARC", v.DMARC}} {
+		out.WriteString(fmt.Sprintf("   %-6s %s\n", row[0]+":", authResultLabel(row[1])))
+	}
+	for _, signature := range v.Signatures {
+		line := fmt.Sprintf("   Signature %s (%s): %s", signature.Domain, signature.Selector, authResultLabel(signature.Result))
+		if signature.Reason != "" {
+			line += " - " + signature.Reason
+		}
+		out.WriteString(line + "\n")
+	}
+	if len(v.Warnings) > 0 {
+		if v.Suspicious {
+			out.WriteString("⚠️  Suspicious message:\n")
+		} else {
+			out.WriteString("ℹ️  Notes:\n")
+		}
+		for _, warning := range v.Warnings {
+			out.WriteString("   - " + warning + "\n")
+		}
+	}
+	return out.String()
+}
+
+func authResultLabel(result string) string {
+	switch result {
+	case "":
+		return "- not checked"
+	case "pass":
+		return "✓ pass"
+	case "fail", "softfail", "permerror":
+		return "✗ " + result
+	default:
+		return "? " + result
+	}
+}
@@ -0,0 +1,132 @@
+package mailos
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readAuthFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	raw, err := os.ReadFile(filepath.Join("testdata", "auth", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestAnalyzeMessageAuth(t *testing.T) {
+	keys := DKIMKeyDir(filepath.Join("testdata", "auth", "keys"))
+	tests := []struct {
+		fixture    string
+		suspicious bool
+		spf, dmarc string
+		warning    string
+	}{
+		{"dkim-signed.eml", false, "pass", "pass", ""},
+		{"spoofed-display-name.eml", true, "pass", "none", "Display name claims service@paypal.com but the sender is alerts@secure-mailer.net"},
+		{"lookalike.eml", true, "pass", "pass", "Sender domain exarnple.org looks like example.org"},
+		{"reply-to-mismatch.eml", true, "pass", "pass", "Reply-To example.payroll@gmail.com is outside the sender's domain example.com"},
+		{"dmarc-fail.eml", true, "softfail", "fail", "DMARC failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			verdict := AnalyzeMessageAuth(readAuthFixture(t, tt.fixture), keys)
+			if verdict.Suspicious != tt.suspicious || verdict.SPF != tt.spf || verdict.DMARC != tt.dmarc {
+				t.Errorf("Unexpected verdict: %+v", verdict)
+			}
+			if tt.warning == "" && len(verdict.Warnings) > 0 {
+				t.Errorf("Expected no warnings, got %v", verdict.Warnings)
+			}
+			if tt.warning != "" && !strings.HasPrefix(strings.Join(verdict.Warnings, "\n"), tt.warning) {
+				t.Errorf("Expected %q first, got %v", tt.warning, verdict.Warnings)
+			}
+		})
+	}
+
+	t.Run("OnlyTopmostAuthServ", func(t *testing.T) {
+		verdict := AnalyzeMessageAuth(readAuthFixture(t, "dmarc-fail.eml"), keys)
+		if verdict.AuthServ != "mx.example.org" || verdict.DKIM != "none" {
+			t.Errorf("Expected the relay's results ignored, got %+v", verdict)
+		}
+	})
+
+	t.Run("DKIMMustBeBySender", func(t *testing.T) {
+		message := func(signer string) []byte {
+			return []byte("Authentication-Results: mx.example.org; spf=fail smtp.mailfrom=ceo@example.com; dkim=pass header.d=" + signer + "; dmarc=none\r\n" +
+				"From: CEO <ceo@example.com>\r\nTo: jane@example.org\r\nSubject: Wire\r\n\r\nPlease wire it today.\r\n")
+		}
+		if verdict := AnalyzeMessageAuth(message("attacker.example"), keys); !verdict.Suspicious {
+			t.Errorf("Expected a signature by another domain not to excuse the SPF failure, got %+v", verdict)
+		}
+		if verdict := AnalyzeMessageAuth(message("mail.example.com"), keys); verdict.Suspicious {
+			t.Errorf("Expected a signature by the sender's domain to excuse the SPF failure, got %+v", verdict)
+		}
+	})
+
+	t.Run("ParsedMessage", func(t *testing.T) {
+		email, err := parseRawMessage(readAuthFixture(t, "spoofed-display-name.eml"))
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		if email.Auth == nil || !email.Auth.Suspicious {
+			t.Fatalf("Expected a stored suspicious verdict, got %+v", email.Auth)
+		}
+		if got := email.Headers["Message-Id"]; len(got) != 1 || got[0] != "<limited-1@secure-mailer.net>" {
+			t.Errorf("Expected the headers populated, got %v", email.Headers)
+		}
+		email.ID, email.From = 7, "service@paypal.com <alerts@secure-mailer.net>"
+		if out := FormatEmailList([]*Email{email}); !strings.Contains(out, "⚠️  Suspicious: Display name claims") {
+			t.Errorf("Expected a warning in the list, got:\n%s", out)
+		}
+	})
+}
+
+func TestParseAuthenticationResults(t *testing.T) {
+	authServ, results := ParseAuthenticationResults(`mx.google.com;
+       dkim=pass header.i=@example.com header.s=s1 header.b="ab;cd";
+       spf=pass (google.com: domain of a@example.com designates 192.0.2.1 as permitted sender) smtp.mailfrom=a@example.com;
+       dmarc=pass (p=NONE sp=NONE dis=NONE) header.from=example.com`)
+	if authServ != "mx.google.com" || len(results) != 3 {
+		t.Fatalf("Unexpected results: %s %+v", authServ, results)
+	}
+	if results[0].Method != "dkim" || results[0].Props["header.s"] != "s1" || results[0].Props["header.b"] != "ab,cd" {
+		t.Errorf("Unexpected dkim result: %+v", results[0])
+	}
+	if results[1].Method != "spf" || results[1].Result != "pass" || results[1].Props["smtp.mailfrom"] != "a@example.com" {
+		t.Errorf("Unexpected spf result: %+v", results[1])
+	}
+	if _, none := ParseAuthenticationResults("mx.example.net 1; none"); len(none) != 0 {
+		t.Errorf("Expected no results, got %+v", none)
+	}
+}
+
+func TestLookalikeDomains(t *testing.T) {
+	recipients := []string{"example.org"}
+	tests := map[string]string{
+		"paypa1.com":             "paypal.com",
+		"xn--pypal-4ve.com":      "paypal.com", // Cyrillic а
+		"paypal-secure.com":      "paypal.com",
+		"mail.exarnple.org":      "example.org",
+		"examp1e.org":            "example.org",
+		"paypal.com":             "",
+		"example.org":            "",
+		"news.unrelated.example": "",
+		"gmail.com":              "",
+	}
+	for domain, want := range tests {
+		if got := lookalikeOf(domain, recipients); got != want {
+			t.Errorf("lookalikeOf(%q) = %q, want %q", domain, got, want)
+		}
+	}
+
+	if claim := displayNameClaim("Apple Support", "apple-id-help.net"); claim != "Apple" {
+		t.Errorf("Expected the brand claim, got %q", claim)
+	}
+	for _, name := range []string{"Apple Support", "'bob@other.example' via Team", "Jane Doe"} {
+		if claim := displayNameClaim(name, "apple.com"); claim != "" {
+			t.Errorf("Expected no claim for %q, got %q", name, claim)
+		}
+	}
+}
@@ -0,0 +1,518 @@
+package mailos
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/mail"
+)
+
+// Encoded words and RFC 2231 segments are kept short enough that headers can
+// always be folded under 78 characters
+const (
+	maxEncodedWordLen  = 60
+	maxEncodedParamLen = 50
+)
+
+// OutgoingMessage is a fully composed message ready to be serialized for SMTP,
+// IMAP APPEND or preview
+type OutgoingMessage struct {
+	From         string
+	To           []string
+	CC           []string
+	BCC          []string // Only written when set; leave empty for SMTP
+	Subject      string
+	Date         time.Time
+	MessageID    string // Without angle brackets
+	InReplyTo    string
+	References   []string
+	Headers      map[string]string // Extra headers such as X-Draft
+	TextBody     string
+	HTMLBody     string // Sent as multipart/alternative with TextBody when set
+	InlineImages []InlineImage
+	Attachments  []OutgoingAttachment
+}
+
+// OutgoingAttachment is a file attached to an outgoing message
+type OutgoingAttachment struct {
+	Filename string
+	MIMEType string
+	Data     []byte
+}
+
+// headerField is a header written in order, unlike go-message's header which
+// inserts new fields at the top
+type headerField struct {
+	Key   string
+	Value string
+}
+
+// newMIMEBoundary returns the boundary for each multipart entity; tests replace
+// it to get reproducible output
+var newMIMEBoundary = func() string {
+	buf := make([]byte, 12)
+	rand.Read(buf)
+	return "emailos-" + hex.EncodeToString(buf)
+}
+
+// BuildMessage serializes msg as an RFC 5322 message with CRLF line endings
+func BuildMessage(msg *OutgoingMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := WriteMessage(&buf, msg); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteMessage serializes msg to w. Non-ASCII headers are RFC 2047 encoded,
+// attachment filenames RFC 2231 encoded, long header lines folded, and each
+// part gets 7bit, quoted-printable or base64 depending on its content.
+func WriteMessage(w io.Writer, msg *OutgoingMessage) error {
+	top := msg.headerFields()
+	create := func(content []headerField) (*message.Writer, error) {
+		return message.CreateWriter(w, newMessageHeader(append(top, content...)))
+	}
+
+	if len(msg.Attachments) == 0 {
+		return writeBodyEntity(create, msg)
+	}
+
+	mw, err := create(multipartFields("multipart/mixed", nil))
+	if err != nil {
+		return fmt.Errorf("failed to create message: %v", err)
+	}
+	if err := writeBodyEntity(childEntity(mw), msg); err != nil {
+		return err
+	}
+	for _, attachment := range msg.Attachments {
+		if err := writeAttachmentPart(mw, attachment); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+// headerFields returns the top-level headers in the order they are written
+func (msg *OutgoingMessage) headerFields() []headerField {
+	date := msg.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	fields := []headerField{{"From", formatAddressHeader([]string{msg.From})}}
+	if len(msg.To) > 0 {
+		fields = append(fields, headerField{"To", formatAddressHeader(msg.To)})
+	}
+	if len(msg.CC) > 0 {
+		fields = append(fields, headerField{"Cc", formatAddressHeader(msg.CC)})
+	}
+	if len(msg.BCC) > 0 {
+		fields = append(fields, headerField{"Bcc", formatAddressHeader(msg.BCC)})
+	}
+	fields = append(fields,
+		headerField{"Subject", encodeHeaderText(msg.Subject)},
+		headerField{"Date", date.Format(time.RFC1123Z)},
+	)
+	if msg.MessageID != "" {
+		fields = append(fields, headerField{"Message-ID", formatMsgIDList([]string{msg.MessageID})})
+	}
+	if msg.InReplyTo != "" {
+		fields = append(fields, headerField{"In-Reply-To", formatMsgIDList([]string{msg.InReplyTo})})
+	}
+	if len(msg.References) > 0 {
+		fields = append(fields, headerField{"References", formatMsgIDList(msg.References)})
+	}
+
+	keys := make([]string, 0, len(msg.Headers))
+	for key := range msg.Headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fields = append(fields, headerField{key, encodeHeaderText(msg.Headers[key])})
+	}
+
+	return append(fields, headerField{"MIME-Version", "1.0"})
+}
+
+// entityCreator creates either the top-level message or a part of a multipart
+// parent from its content headers
+type entityCreator func(content []headerField) (*message.Writer, error)
+
+// childEntity creates parts inside a multipart writer
+func childEntity(parent *message.Writer) entityCreator {
+	return func(content []headerField) (*message.Writer, error) {
+		return parent.CreatePart(newMessageHeader(content))
+	}
+}
+
+// writeBodyEntity writes the text body, or text and HTML as alternatives
+func writeBodyEntity(create entityCreator, msg *OutgoingMessage) error {
+	if msg.HTMLBody == "" {
+		return writeTextPart(create, "text/plain", msg.TextBody)
+	}
+
+	mw, err := create(multipartFields("multipart/alternative", nil))
+	if err != nil {
+		return fmt.Errorf("failed to create alternative part: %v", err)
+	}
+	if err := writeTextPart(childEntity(mw), "text/plain", msg.TextBody); err != nil {
+		return err
+	}
+	if err := writeHTMLEntity(childEntity(mw), msg.HTMLBody, msg.InlineImages); err != nil {
+		return err
+	}
+	return mw.Close()
+}
+
+// writeHTMLEntity writes the HTML part, wrapped in multipart/related together
+// with its inline images when there are any
+func writeHTMLEntity(create entityCreator, bodyHTML string, images []InlineImage) error {
+	if len(images) == 0 {
+		return writeTextPart(create, "text/html", bodyHTML)
+	}
+
+	mw, err := create(multipartFields("multipart/related", map[string]string{"type": "text/html"}))
+	if err != nil {
+		return fmt.Errorf("failed to create related part: %v", err)
+	}
+	if err := writeTextPart(childEntity(mw), "text/html", bodyHTML); err != nil {
+		return err
+	}
+	for _, image := range images {
+		content := []headerField{
+			{"Content-Type", formatContentType(image.MIMEType, image.Filename)},
+			{"Content-Transfer-Encoding", "base64"},
+			{"Content-ID", "<" + image.ContentID + ">"},
+			{"Content-Disposition", formatDisposition("inline", image.Filename)},
+		}
+		if err := writePart(childEntity(mw), content, image.Data); err != nil {
+			return fmt.Errorf("failed to write inline image %s: %v", image.Filename, err)
+		}
+	}
+	return mw.Close()
+}
+
+// writeAttachmentPart writes one attachment to a multipart/mixed writer
+func writeAttachmentPart(parent *message.Writer, attachment OutgoingAttachment) error {
+	mimeType := attachment.MIMEType
+	if mimeType == "" {
+		mimeType = attachmentMIMEType(attachment.Filename, AttachmentMeta{}, attachment.Data)
+	}
+
+	encoding := "base64"
+	if strings.HasPrefix(mimeType, "message/") {
+		// RFC 2046 doesn't allow base64 or quoted-printable for message/rfc822
+		encoding = "7bit"
+		if bytes.IndexFunc(attachment.Data, func(r rune) bool { return r >= utf8.RuneSelf }) >= 0 {
+			encoding = "8bit"
+		}
+	}
+
+	content := []headerField{
+		{"Content-Type", formatContentType(mimeType, attachment.Filename)},
+		{"Content-Transfer-Encoding", encoding},
+		{"Content-Disposition", formatDisposition("attachment", attachment.Filename)},
+	}
+	if err := writePart(childEntity(parent), content, attachment.Data); err != nil {
+		return fmt.Errorf("failed to write attachment %s: %v", attachment.Filename, err)
+	}
+	return nil
+}
+
+// writeTextPart writes a UTF-8 text part with CRLF line endings, picking the
+// transfer encoding from its content
+func writeTextPart(create entityCreator, mediaType, body string) error {
+	data := []byte(normalizeCRLF(body))
+	content := []headerField{
+		{"Content-Type", mime.FormatMediaType(mediaType, map[string]string{"charset": "utf-8"})},
+		{"Content-Transfer-Encoding", textTransferEncoding(data)},
+	}
+	if err := writePart(create, content, data); err != nil {
+		return fmt.Errorf("failed to write %s part: %v", mediaType, err)
+	}
+	return nil
+}
+
+// writePart creates a single part and writes its (unencoded) body
+func writePart(create entityCreator, content []headerField, data []byte) error {
+	w, err := create(content)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// textTransferEncoding returns 7bit for short-lined ASCII, base64 for mostly
+// non-ASCII text such as CJK, and quoted-printable otherwise
+func textTransferEncoding(data []byte) string {
+	nonASCII := 0
+	longLines := false
+	lineLen := 0
+	for _, b := range data {
+		if b >= 0x80 || (b < 0x20 && b != '\r' && b != '\n' && b != '\t') {
+			nonASCII++
+		}
+		if b == '\n' {
+			lineLen = 0
+			continue
+		}
+		lineLen++
+		if lineLen > 76 {
+			longLines = true
+		}
+	}
+
+	switch {
+	case nonASCII == 0 && !longLines:
+		return "7bit"
+	case nonASCII*3 > len(data):
+		return "base64"
+	default:
+		return "quoted-printable"
+	}
+}
+
+// normalizeCRLF converts bare LF and CR line endings to CRLF
+func normalizeCRLF(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	return strings.ReplaceAll(s, "\n", "\r\n")
+}
+
+// encodeHeaderText RFC 2047 encodes an unstructured header value when needed,
+// using B encoding when most of the text isn't ASCII. Line breaks are dropped
+// so values can't inject extra headers.
+func encodeHeaderText(s string) string {
+	s = strings.Join(strings.Fields(strings.NewReplacer("\r", " ", "\n", " ").Replace(s)), " ")
+	nonASCII := 0
+	for _, r := range s {
+		if r >= utf8.RuneSelf {
+			nonASCII++
+		}
+	}
+	if nonASCII == 0 {
+		return s
+	}
+	return encodeWords(s, nonASCII*2 > utf8.RuneCountInString(s))
+}
+
+// encodeWords splits s into RFC 2047 encoded words of at most maxEncodedWordLen
+// characters, separated by spaces so the header can be folded between them.
+// mime.WordEncoder always writes 75-character words, which can't be folded
+// under 78 characters once the field name is added.
+func encodeWords(s string, useB bool) string {
+	var words []string
+	chunk := ""
+	for _, r := range s {
+		next := chunk + string(r)
+		if chunk != "" && len(encodeWord(next, useB)) > maxEncodedWordLen {
+			words = append(words, encodeWord(chunk, useB))
+			next = string(r)
+		}
+		chunk = next
+	}
+	if chunk != "" {
+		words = append(words, encodeWord(chunk, useB))
+	}
+	return strings.Join(words, " ")
+}
+
+// encodeWord encodes s as a single UTF-8 encoded word
+func encodeWord(s string, useB bool) string {
+	if useB {
+		return "=?utf-8?b?" + base64.StdEncoding.EncodeToString([]byte(s)) + "?="
+	}
+
+	var b strings.Builder
+	b.WriteString("=?utf-8?q?")
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ':
+			b.WriteByte('_')
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', strings.IndexByte("!*+-/", c) >= 0:
+			// Characters allowed in encoded words within phrases (RFC 2047 section 5)
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "=%02X", c)
+		}
+	}
+	b.WriteString("?=")
+	return b.String()
+}
+
+// formatAddressHeader formats recipients, encoding non-ASCII display names
+func formatAddressHeader(addresses []string) string {
+	var formatted []string
+	for _, address := range addresses {
+		if strings.TrimSpace(address) == "" {
+			continue
+		}
+		addr := parseOutgoingAddress(address)
+		if addr.Name == "" {
+			formatted = append(formatted, addr.Address)
+		} else if !isASCII(addr.Name) {
+			formatted = append(formatted, encodeHeaderText(addr.Name)+" <"+addr.Address+">")
+		} else {
+			formatted = append(formatted, addr.String())
+		}
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// parseOutgoingAddress parses "Name <addr>" or a bare address, tolerating
+// unquoted display names with commas or dots that RFC 5322 would reject
+func parseOutgoingAddress(s string) *mail.Address {
+	s = strings.TrimSpace(s)
+	if addr, err := mail.ParseAddress(s); err == nil {
+		return addr
+	}
+	if open := strings.LastIndex(s, "<"); open >= 0 && strings.HasSuffix(s, ">") {
+		name := strings.Trim(strings.TrimSpace(s[:open]), `"`)
+		return &mail.Address{Name: name, Address: strings.TrimSpace(s[open+1 : len(s)-1])}
+	}
+	return &mail.Address{Address: s}
+}
+
+// formatMsgIDList wraps message IDs in angle brackets and joins them
+func formatMsgIDList(ids []string) string {
+	var formatted []string
+	for _, id := range ids {
+		id = strings.Trim(strings.TrimSpace(id), "<>")
+		if id != "" {
+			formatted = append(formatted, "<"+id+">")
+		}
+	}
+	return strings.Join(formatted, " ")
+}
+
+// multipartFields returns the Content-Type for a multipart entity
+func multipartFields(mediaType string, params map[string]string) []headerField {
+	all := map[string]string{"boundary": newMIMEBoundary()}
+	for k, v := range params {
+		all[k] = v
+	}
+	return []headerField{{"Content-Type", mime.FormatMediaType(mediaType, all)}}
+}
+
+// formatContentType adds the name parameter many clients still read. It is
+// RFC 2047 encoded since that's what Outlook understands for this parameter.
+func formatContentType(mimeType, filename string) string {
+	name := filename
+	if !isASCII(name) {
+		name = encodeWords(name, true)
+	}
+	formatted := mime.FormatMediaType(mimeType, map[string]string{"name": name})
+	if formatted == "" {
+		return mimeType
+	}
+	return formatted
+}
+
+// formatDisposition formats Content-Disposition with an RFC 2231 filename,
+// splitting long encoded names into numbered continuations
+func formatDisposition(disposition, filename string) string {
+	if filename == "" {
+		return disposition
+	}
+	if isASCII(filename) && len(filename) <= maxEncodedParamLen {
+		if formatted := mime.FormatMediaType(disposition, map[string]string{"filename": filename}); formatted != "" {
+			return formatted
+		}
+	}
+
+	encoded := encodeRFC2231Value(filename)
+	if len(encoded) <= maxEncodedParamLen {
+		return fmt.Sprintf("%s; filename*=utf-8''%s", disposition, encoded)
+	}
+
+	parts := []string{disposition}
+	for i := 0; len(encoded) > 0; i++ {
+		n := maxEncodedParamLen
+		if n > len(encoded) {
+			n = len(encoded)
+		}
+		// Don't split a %XX escape across segments
+		if pct := strings.LastIndex(encoded[:n], "%"); pct >= 0 && pct > n-3 && n < len(encoded) {
+			n = pct
+		}
+		prefix := ""
+		if i == 0 {
+			prefix = "utf-8''"
+		}
+		parts = append(parts, fmt.Sprintf("filename*%d*=%s%s", i, prefix, encoded[:n]))
+		encoded = encoded[n:]
+	}
+	return strings.Join(parts, "; ")
+}
+
+// encodeRFC2231Value percent-encodes everything outside RFC 2231 attribute-char
+func encodeRFC2231Value(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c > ' ' && c < 0x7f && !strings.ContainsRune(`*'%()<>@,;:\"/[]?=`, rune(c)) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// isASCII reports whether s contains only printable ASCII
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < ' ' || s[i] >= 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// newMessageHeader builds a go-message header that writes fields in order
+func newMessageHeader(fields []headerField) message.Header {
+	var h message.Header
+	// Add inserts at the top, so add in reverse to keep the given order
+	for i := len(fields) - 1; i >= 0; i-- {
+		h.Add(fields[i].Key, fields[i].Value)
+	}
+	return h
+}
+
+// loadAttachmentFiles reads attachment paths into outgoing attachments
+func loadAttachmentFiles(paths []string) ([]OutgoingAttachment, error) {
+	var attachments []OutgoingAttachment
+	for _, path := range paths {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil, fmt.Errorf("attachment file not found: %s", path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read attachment %s: %v", path, err)
+		}
+		filename := filepath.Base(path)
+		attachments = append(attachments, OutgoingAttachment{
+			Filename: filename,
+			MIMEType: attachmentMIMEType(filename, AttachmentMeta{}, data),
+			Data:     data,
+		})
+	}
+	return attachments, nil
+}
@@ -0,0 +1,224 @@
+package mailos
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-message/mail"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// goldenMessages are messages with content that string concatenation got wrong
+var goldenMessages = map[string]*OutgoingMessage{
+	"international": {
+		From:       "Zoë Ångström <zoe@example.com>",
+		To:         []string{"José Müller <jose@example.com>", "Doe, John <john@example.com>"},
+		CC:         []string{"山田太郎 <taro@example.jp>"},
+		Subject:    "Réunion trimestrielle — ordre du jour, budget prévisionnel et calendrier 📅",
+		InReplyTo:  "abc123@example.com",
+		References: []string{"<root@example.com>", "abc123@example.com"},
+		TextBody:   "Bonjour José,\n\nVoici l'ordre du jour pour la réunion. Merci de vérifier les chiffres avant jeudi.\n\nÀ bientôt,\nZoë\n",
+		HTMLBody:   "<p>Bonjour José,</p><p>Voici l'ordre du jour pour la réunion.</p>",
+		Attachments: []OutgoingAttachment{
+			{Filename: "Prüfbericht 2024 – Übersicht der Ergebnisse für das Qualitätsmanagement.pdf", MIMEType: "application/pdf", Data: []byte("%PDF-1.4 résumé")},
+			{Filename: "plain-name.txt", MIMEType: "text/plain", Data: []byte("hello")},
+		},
+	},
+	"cjk": {
+		From:     "taro@example.jp",
+		To:       []string{"花子 <hanako@example.jp>"},
+		Subject:  "来週の会議について",
+		TextBody: "花子さん\n\n来週の会議の資料を添付します。ご確認ください。\n\n太郎\n",
+	},
+	"ascii": {
+		From:     "Alice <alice@example.com>",
+		To:       []string{"bob@example.com"},
+		Subject:  "Lunch",
+		Headers:  map[string]string{"X-Draft": "true", "X-Priority": "high"},
+		TextBody: "Shall we get lunch on Friday?\n",
+	},
+	"long_lines": {
+		From:     "alice@example.com",
+		To:       []string{"bob@example.com"},
+		Subject:  "Notes",
+		TextBody: strings.Repeat("This paragraph was written without any line breaks at all. ", 4) + "\nTrailing space here \n",
+	},
+	"inline_image": {
+		From:         "alice@example.com",
+		To:           []string{"bob@example.com"},
+		Subject:      "Logo",
+		TextBody:     "See the logo",
+		HTMLBody:     `<p>See the logo</p><img src="cid:logo.0123@emailos">`,
+		InlineImages: []InlineImage{{ContentID: "logo.0123@emailos", Filename: "logo.png", MIMEType: "image/png", Data: []byte("\x89PNG\r\n\x1a\nlogo")}},
+	},
+}
+
+// buildGolden builds a message with fixed boundaries and date
+func buildGolden(t *testing.T, msg *OutgoingMessage) []byte {
+	t.Helper()
+	original := newMIMEBoundary
+	defer func() { newMIMEBoundary = original }()
+	n := 0
+	newMIMEBoundary = func() string {
+		n++
+		return fmt.Sprintf("emailos-boundary-%d", n)
+	}
+
+	copied := *msg
+	copied.Date = time.Date(2024, 3, 14, 9, 26, 53, 0, time.FixedZone("CET", 3600))
+	raw, err := BuildMessage(&copied)
+	if err != nil {
+		t.Fatalf("Failed to build message: %v", err)
+	}
+	return raw
+}
+
+func TestBuildMessageGolden(t *testing.T) {
+	for name, msg := range goldenMessages {
+		t.Run(name, func(t *testing.T) {
+			raw := buildGolden(t, msg)
+			path := filepath.Join("testdata", "mime", name+".eml")
+			if *updateGolden {
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, raw, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Missing golden file (run with -update): %v", err)
+			}
+			if !bytes.Equal(raw, want) {
+				t.Errorf("Message differs from %s:\n%s", path, raw)
+			}
+		})
+	}
+}
+
+func TestBuildMessageWellFormed(t *testing.T) {
+	for name, msg := range goldenMessages {
+		t.Run(name, func(t *testing.T) {
+			raw := buildGolden(t, msg)
+
+			for i, line := range strings.Split(string(raw), "\r\n") {
+				if len(line) > 78 {
+					t.Errorf("Line %d is %d characters: %q", i+1, len(line), line)
+				}
+				if strings.Contains(line, "\n") {
+					t.Errorf("Line %d has a bare LF", i+1)
+				}
+			}
+
+			headerEnd := bytes.Index(raw, []byte("\r\n\r\n"))
+			for _, b := range raw[:headerEnd] {
+				if b >= 0x80 {
+					t.Fatalf("Header contains raw 8-bit data")
+				}
+			}
+		})
+	}
+}
+
+func TestBuildMessageRoundTrip(t *testing.T) {
+	msg := goldenMessages["international"]
+	mr, err := mail.CreateReader(bytes.NewReader(buildGolden(t, msg)))
+	if err != nil {
+		t.Fatalf("Failed to parse message: %v", err)
+	}
+
+	t.Run("Headers", func(t *testing.T) {
+		subject, _ := mr.Header.Subject()
+		if subject != msg.Subject {
+			t.Errorf("Expected subject %q, got %q", msg.Subject, subject)
+		}
+		from, _ := mr.Header.AddressList("From")
+		if len(from) != 1 || from[0].Name != "Zoë Ångström" {
+			t.Errorf("Expected decoded display name, got %v", from)
+		}
+		to, _ := mr.Header.AddressList("To")
+		if len(to) != 2 || to[0].Name != "José Müller" || to[1].Name != "Doe, John" {
+			t.Errorf("Expected both recipients with names, got %v", to)
+		}
+		cc, _ := mr.Header.AddressList("Cc")
+		if len(cc) != 1 || cc[0].Name != "山田太郎" {
+			t.Errorf("Expected CJK display name, got %v", cc)
+		}
+		refs, _ := mr.Header.MsgIDList("References")
+		if len(refs) != 2 || refs[0] != "root@example.com" || refs[1] != "abc123@example.com" {
+			t.Errorf("Expected normalized references, got %v", refs)
+		}
+	})
+
+	t.Run("Parts", func(t *testing.T) {
+		var text string
+		var filenames []string
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Failed to read part: %v", err)
+			}
+			body, _ := io.ReadAll(p.Body)
+			switch h := p.Header.(type) {
+			case *mail.InlineHeader:
+				if ct, _, _ := h.ContentType(); ct == "text/plain" {
+					text = string(body)
+				}
+			case *mail.AttachmentHeader:
+				name, _ := h.Filename()
+				filenames = append(filenames, name)
+			}
+		}
+		if text != normalizeCRLF(msg.TextBody) {
+			t.Errorf("Text body didn't survive encoding: %q", text)
+		}
+		if len(filenames) != 2 || filenames[0] != msg.Attachments[0].Filename || filenames[1] != "plain-name.txt" {
+			t.Errorf("Expected attachment filenames decoded, got %q", filenames)
+		}
+	})
+}
+
+func TestTextTransferEncoding(t *testing.T) {
+	cases := []struct {
+		body string
+		want string
+	}{
+		{"Hello\r\nWorld\r\n", "7bit"},
+		{strings.Repeat("a", 100), "quoted-printable"},
+		{"Café au lait", "quoted-printable"},
+		{"来週の会議について", "base64"},
+		{"tab\there and a \x1b escape", "quoted-printable"},
+	}
+	for _, c := range cases {
+		if got := textTransferEncoding([]byte(c.body)); got != c.want {
+			t.Errorf("textTransferEncoding(%q) = %s, want %s", c.body, got, c.want)
+		}
+	}
+}
+
+func TestEncodeHeaderText(t *testing.T) {
+	if got := encodeHeaderText("Plain subject"); got != "Plain subject" {
+		t.Errorf("Expected ASCII left alone, got %q", got)
+	}
+	if got := encodeHeaderText("Injected\r\nBcc: victim@example.com"); strings.ContainsAny(got, "\r\n") {
+		t.Errorf("Expected line breaks removed, got %q", got)
+	}
+	if got := encodeHeaderText("Café"); !strings.HasPrefix(got, "=?utf-8?q?") {
+		t.Errorf("Expected Q encoding for mostly ASCII text, got %q", got)
+	}
+	if got := encodeHeaderText("会議"); !strings.HasPrefix(got, "=?utf-8?b?") {
+		t.Errorf("Expected B encoding for CJK text, got %q", got)
+	}
+}
@@ -0,0 +1,657 @@
+package mailos
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// Kinds of queued IMAP operations
+const (
+	OpMarkRead    = "mark-read"
+	OpDelete      = "delete"
+	OpMove        = "move"
+	OpLabel       = "label"
+	OpAppendDraft = "append-draft"
+)
+
+// States of queued operations
+const (
+	OpPending  = "pending"  // Waiting to be replayed
+	OpConflict = "conflict" // The server changed; kept for review until discarded
+)
+
+// QueuedOp is an IMAP operation made while offline. Messages are identified by
+// Message-ID, since sequence numbers change before the operation is replayed.
+type QueuedOp struct {
+	ID         int64     `json:"id"`
+	Kind       string    `json:"kind"`
+	Folder     string    `json:"folder,omitempty"` // Empty for drafts: the server's Drafts folder
+	Target     string    `json:"target,omitempty"` // Destination of a move, or the label to add
+	MessageIDs []string  `json:"message_ids,omitempty"`
+	Subjects   []string  `json:"subjects,omitempty"`
+	Raw        []byte    `json:"-"` // The draft message to append
+	QueuedAt   time.Time `json:"queued_at"`
+	State      string    `json:"state"`
+	Attempts   int       `json:"attempts"`
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+// Describe summarises the operation for status output
+func (op *QueuedOp) Describe() string {
+	what := fmt.Sprintf("%d message(s)", len(op.MessageIDs))
+	if len(op.Subjects) == 1 {
+		what = fmt.Sprintf("%q", op.Subjects[0])
+	}
+	switch op.Kind {
+	case OpMarkRead:
+		return fmt.Sprintf("Mark %s read in %s", what, op.Folder)
+	case OpDelete:
+		return fmt.Sprintf("Delete %s from %s", what, op.Folder)
+	case OpMove:
+		return fmt.Sprintf("Move %s from %s to %s", what, op.Folder, op.Target)
+	case OpLabel:
+		return fmt.Sprintf("Label %s %q in %s", what, op.Target, op.Folder)
+	case OpAppendDraft:
+		return fmt.Sprintf("Save draft %s", what)
+	}
+	return op.Kind
+}
+
+// QueueOp adds an operation to the end of the offline journal
+func (dm *DatabaseManager) QueueOp(op *QueuedOp) error {
+	messageIDs, _ := json.Marshal(op.MessageIDs)
+	subjects, _ := json.Marshal(op.Subjects)
+	if op.QueuedAt.IsZero() {
+		op.QueuedAt = time.Now()
+	}
+	op.State = OpPending
+
+	result, err := dm.db.Exec(`
+		INSERT INTO ops_journal (kind, folder, target, message_ids, subjects, raw, queued_at, state)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, op.Kind, op.Folder, op.Target, string(messageIDs), string(subjects), op.Raw, op.QueuedAt, op.State)
+	if err != nil {
+		return fmt.Errorf("failed to queue operation: %v", err)
+	}
+	op.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// ListQueuedOps returns the journal in the order the operations were made
+func (dm *DatabaseManager) ListQueuedOps() ([]*QueuedOp, error) {
+	rows, err := dm.db.Query(`
+		SELECT id, kind, folder, target, message_ids, subjects, raw, queued_at, state, attempts, COALESCE(last_error, '')
+		FROM ops_journal
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query queued operations: %v", err)
+	}
+	defer rows.Close()
+
+	var ops []*QueuedOp
+	for rows.Next() {
+		op := &QueuedOp{}
+		var messageIDs, subjects string
+		if err := rows.Scan(&op.ID, &op.Kind, &op.Folder, &op.Target, &messageIDs, &subjects,
+			&op.Raw, &op.QueuedAt, &op.State, &op.Attempts, &op.LastError); err != nil {
+			return nil, fmt.Errorf("failed to scan queued operation: %v", err)
+		}
+		json.Unmarshal([]byte(messageIDs), &op.MessageIDs)
+		json.Unmarshal([]byte(subjects), &op.Subjects)
+		ops = append(ops, op)
+	}
+	return ops, rows.Err()
+}
+
+// updateQueuedOp records the outcome of a replay attempt
+func (dm *DatabaseManager) updateQueuedOp(op *QueuedOp) error {
+	_, err := dm.db.Exec(`UPDATE ops_journal SET state = ?, attempts = ?, last_error = ? WHERE id = ?`,
+		op.State, op.Attempts, op.LastError, op.ID)
+	return err
+}
+
+// RemoveQueuedOp drops an operation from the journal
+func (dm *DatabaseManager) RemoveQueuedOp(id int64) error {
+	result, err := dm.db.Exec(`DELETE FROM ops_journal WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to remove queued operation: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("no queued operation %d", id)
+	}
+	return nil
+}
+
+// IsOffline reports whether MAILOS_OFFLINE asks for IMAP operations to be
+// queued instead of sent
+func IsOffline() bool {
+	value := os.Getenv("MAILOS_OFFLINE")
+	if value == "" {
+		return false
+	}
+	offline, err := strconv.ParseBool(value)
+	return err != nil || offline
+}
+
+// errOffline is returned instead of connecting when MAILOS_OFFLINE is set
+var errOffline = errors.New("offline: MAILOS_OFFLINE is set")
+
+// connectOnline connects to the IMAP server unless MAILOS_OFFLINE is set
+func connectOnline(config *Config) (*client.Client, error) {
+	if IsOffline() {
+		return nil, errOffline
+	}
+	return connectToIMAPServer(config)
+}
+
+// isOfflineError reports whether err from connecting means the server
+// couldn't be reached, as opposed to it refusing the login or a command
+func isOfflineError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, errOffline) || errors.As(err, &netErr)
+}
+
+// ServerReachable connects to the IMAP server to report whether it can be
+// reached, for 'mailos status'
+func ServerReachable(config *Config) bool {
+	c, err := connectOnline(config)
+	if err == nil {
+		c.Logout()
+	}
+	return !isOfflineError(err)
+}
+
+// queueIfOffline applies an operation on INBOX messages to the local archive
+// and queues it for the server when MAILOS_OFFLINE is set or connErr, the
+// result of connecting, shows the server can't be reached. It reports whether
+// the operation was handled, in which case the caller must not contact the
+// server.
+func queueIfOffline(config *Config, connErr error, op *QueuedOp, ids []uint32) (bool, error) {
+	return queueOffline(config, connErr, op, ids, false)
+}
+
+// queueUIDsIfOffline is queueIfOffline for messages named by UID
+func queueUIDsIfOffline(config *Config, connErr error, op *QueuedOp, uids []uint32) (bool, error) {
+	return queueOffline(config, connErr, op, uids, true)
+}
+
+func queueOffline(config *Config, connErr error, op *QueuedOp, ids []uint32, byUID bool) (bool, error) {
+	if !IsOffline() && !isOfflineError(connErr) {
+		return false, nil
+	}
+	if op.Folder != "INBOX" {
+		return true, fmt.Errorf("offline: only INBOX messages are in the local archive, so this %s in %s can't be queued", op.Kind, op.Folder)
+	}
+
+	dm, err := NewDatabaseManager(config.Email)
+	if err != nil {
+		return true, fmt.Errorf("offline: %v", err)
+	}
+	defer dm.Close()
+
+	var selected []*Email
+	for _, id := range ids {
+		email, err := dm.findArchivedEmail(id, byUID)
+		if err != nil {
+			return true, fmt.Errorf("offline: %v", err)
+		}
+		if email == nil || email.MessageID == "" {
+			return true, fmt.Errorf("offline: message %d is not in the local archive, so it can't be queued; run 'mailos sync' when back online", id)
+		}
+		selected = append(selected, email)
+		op.MessageIDs = append(op.MessageIDs, email.MessageID)
+		op.Subjects = append(op.Subjects, email.Subject)
+	}
+
+	// Apply the change locally right away
+	if op.Kind == OpDelete || op.Kind == OpMove {
+		err = dm.deleteArchived(op.Folder, op.MessageIDs)
+	} else {
+		for _, email := range selected {
+			flag := imap.SeenFlag
+			if op.Kind == OpLabel {
+				flag = op.Target
+			}
+			if err = dm.setArchivedFlags(op.Folder, email.MessageID, addFlag(email.Flags, flag)); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return true, fmt.Errorf("offline: failed to update the local archive: %v", err)
+	}
+
+	return true, queueOp(config.Email, op)
+}
+
+// queueDraftIfOffline queues a draft for the server's Drafts folder when
+// offline, in the same sense as queueIfOffline
+func queueDraftIfOffline(config *Config, connErr error, raw []byte, messageID, subject string) (bool, error) {
+	if !IsOffline() && !isOfflineError(connErr) {
+		return false, nil
+	}
+	op := &QueuedOp{Kind: OpAppendDraft, MessageIDs: []string{messageID}, Subjects: []string{subject}, Raw: raw}
+	return true, queueOp(config.Email, op)
+}
+
+func queueOp(accountEmail string, op *QueuedOp) error {
+	dm, err := NewDatabaseManager(accountEmail)
+	if err != nil {
+		return err
+	}
+	defer dm.Close()
+
+	if err := dm.QueueOp(op); err != nil {
+		return err
+	}
+	fmt.Printf("📴 Offline: %s is queued and runs on the server when you're back online (see 'mailos status')\n", op.Describe())
+	return nil
+}
+
+func addFlag(flags []string, flag string) []string {
+	for _, f := range flags {
+		if f == flag {
+			return flags
+		}
+	}
+	return append(flags, flag)
+}
+
+func hasFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if strings.EqualFold(f, flag) {
+			return true
+		}
+	}
+	return false
+}
+
+// serverMessage is a message found on the server during replay
+type serverMessage struct {
+	UID   uint32
+	Flags []string
+}
+
+// opsServer is the IMAP side of replaying queued operations, so replay and its
+// conflict handling can be tested without a server
+type opsServer interface {
+	Find(folder string, messageIDs []string) (map[string]serverMessage, error)
+	AddFlag(folder string, uids []uint32, flag string) error
+	Delete(folder string, uids []uint32) error
+	Move(folder string, uids []uint32, target string) error
+	Append(folder string, raw []byte) error
+	DraftsFolder() (string, error)
+}
+
+// ReplayResult summarises a replay of the offline journal
+type ReplayResult struct {
+	Applied   int
+	Conflicts []*QueuedOp
+	Remaining int  // Still pending after a failure, such as losing the connection again
+	Offline   bool // The server couldn't be reached, so nothing was replayed
+}
+
+// replayOps replays pending operations in order. A server error stops the
+// replay so later operations never run before earlier ones.
+func replayOps(dm *DatabaseManager, server opsServer) (*ReplayResult, error) {
+	ops, err := dm.ListQueuedOps()
+	if err != nil {
+		return nil, err
+	}
+	result := &ReplayResult{}
+	for i, op := range ops {
+		if op.State != OpPending {
+			continue
+		}
+		conflict, err := replayOp(op, server)
+		if err != nil {
+			op.Attempts++
+			op.LastError = err.Error()
+			dm.updateQueuedOp(op)
+			for _, rest := range ops[i:] {
+				if rest.State == OpPending {
+					result.Remaining++
+				}
+			}
+			return result, fmt.Errorf("failed to replay %q: %v", op.Describe(), err)
+		}
+		if conflict != "" {
+			op.State, op.LastError = OpConflict, conflict
+			if err := dm.updateQueuedOp(op); err != nil {
+				return result, err
+			}
+			result.Conflicts = append(result.Conflicts, op)
+			continue
+		}
+		if err := dm.RemoveQueuedOp(op.ID); err != nil {
+			return result, err
+		}
+		result.Applied++
+	}
+	return result, nil
+}
+
+// replayOp runs one operation, returning a conflict when the server state no
+// longer allows all of it
+func replayOp(op *QueuedOp, server opsServer) (string, error) {
+	if op.Kind == OpAppendDraft {
+		folder, err := server.DraftsFolder()
+		if err != nil {
+			return "", err
+		}
+		existing, err := server.Find(folder, op.MessageIDs)
+		if err != nil {
+			return "", err
+		}
+		if len(existing) > 0 {
+			// Appended before the journal was updated
+			return "", nil
+		}
+		return "", server.Append(folder, op.Raw)
+	}
+
+	found, err := server.Find(op.Folder, op.MessageIDs)
+	if err != nil {
+		return "", err
+	}
+	var uids []uint32
+	var missing, kept []string
+	for _, messageID := range op.MessageIDs {
+		message, ok := found[messageID]
+		switch {
+		case !ok:
+			missing = append(missing, messageID)
+		case op.Kind == OpDelete && hasFlag(message.Flags, imap.FlaggedFlag):
+			// Starred on another device after it was deleted here
+			kept = append(kept, messageID)
+		default:
+			uids = append(uids, message.UID)
+		}
+	}
+
+	if op.Kind == OpMove && len(missing) > 0 {
+		moved, err := server.Find(op.Target, missing)
+		if err != nil {
+			return "", err
+		}
+		stillMissing := missing[:0]
+		for _, messageID := range missing {
+			if _, ok := moved[messageID]; !ok {
+				stillMissing = append(stillMissing, messageID)
+			}
+		}
+		missing = stillMissing
+	}
+
+	if len(uids) > 0 {
+		switch op.Kind {
+		case OpMarkRead:
+			err = server.AddFlag(op.Folder, uids, imap.SeenFlag)
+		case OpDelete:
+			err = server.Delete(op.Folder, uids)
+		case OpMove:
+			err = server.Move(op.Folder, uids, op.Target)
+		case OpLabel:
+			err = server.AddFlag(op.Folder, uids, op.Target)
+		default:
+			err = fmt.Errorf("unknown operation %q", op.Kind)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var conflicts []string
+	if len(kept) > 0 {
+		conflicts = append(conflicts, fmt.Sprintf("%d message(s) were flagged on the server since, so they were kept", len(kept)))
+	}
+	if len(missing) > 0 && op.Kind != OpDelete {
+		conflicts = append(conflicts, fmt.Sprintf("%d message(s) are no longer in %s; they were moved or deleted elsewhere", len(missing), op.Folder))
+	}
+	return strings.Join(conflicts, "; "), nil
+}
+
+// imapOpsServer replays operations over an IMAP connection
+type imapOpsServer struct {
+	c        *client.Client
+	selected string
+}
+
+func (s *imapOpsServer) selectFolder(folder string) error {
+	if s.selected == folder {
+		return nil
+	}
+	if _, err := s.c.Select(folder, false); err != nil {
+		return fmt.Errorf("failed to select %s: %v", folder, err)
+	}
+	s.selected = folder
+	return nil
+}
+
+func (s *imapOpsServer) Find(folder string, messageIDs []string) (map[string]serverMessage, error) {
+	found := make(map[string]serverMessage)
+	if err := s.selectFolder(folder); err != nil {
+		if s.c.State() == imap.LogoutState {
+			return nil, err
+		}
+		// A folder that no longer exists holds none of the messages
+		return found, nil
+	}
+
+	byUID := make(map[uint32]string)
+	seqSet := new(imap.SeqSet)
+	for _, messageID := range messageIDs {
+		criteria := imap.NewSearchCriteria()
+		criteria.Header.Add("Message-ID", messageID)
+		uids, err := s.c.UidSearch(criteria)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search %s: %v", folder, err)
+		}
+		if len(uids) > 0 {
+			byUID[uids[0]] = messageID
+			seqSet.AddNum(uids[0])
+		}
+	}
+	if len(byUID) == 0 {
+		return found, nil
+	}
+
+	messages := make(chan *imap.Message, len(byUID))
+	if err := s.c.UidFetch(seqSet, []imap.FetchItem{imap.FetchUid, imap.FetchFlags}, messages); err != nil {
+		return nil, fmt.Errorf("failed to fetch flags: %v", err)
+	}
+	for msg := range messages {
+		if messageID, ok := byUID[msg.Uid]; ok {
+			found[messageID] = serverMessage{UID: msg.Uid, Flags: msg.Flags}
+		}
+	}
+	return found, nil
+}
+
+// uidExpungeCommand is UIDPLUS's UID EXPUNGE, which removes only the
+// flagged messages with these UIDs
+type uidExpungeCommand struct {
+	uids *imap.SeqSet
+}
+
+func (cmd *uidExpungeCommand) Command() *imap.Command {
+	return &imap.Command{Name: "UID", Arguments: []interface{}{imap.RawString("EXPUNGE"), cmd.uids}}
+}
+
+// expungeUIDs expunges the messages with these UIDs from the selected
+// folder, reporting false without touching the folder when the server
+// lacks UIDPLUS
+func expungeUIDs(c *client.Client, uids []uint32) (bool, error) {
+	if supported, _ := c.Support("UIDPLUS"); !supported {
+		return false, nil
+	}
+	status, err := c.Execute(&uidExpungeCommand{uids: uidSet(uids)}, nil)
+	if err == nil {
+		err = status.Err()
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to expunge deleted messages: %v", err)
+	}
+	return true, nil
+}
+
+func uidSet(uids []uint32) *imap.SeqSet {
+	seqSet := new(imap.SeqSet)
+	for _, uid := range uids {
+		seqSet.AddNum(uid)
+	}
+	return seqSet
+}
+
+func (s *imapOpsServer) AddFlag(folder string, uids []uint32, flag string) error {
+	if err := s.selectFolder(folder); err != nil {
+		return err
+	}
+	item := imap.FormatFlagsOp(imap.AddFlags, true)
+	return s.c.UidStore(uidSet(uids), item, []interface{}{flag}, nil)
+}
+
+// Delete flags the messages and expunges only those. A server without
+// UIDPLUS keeps them flagged until the user expunges, since a plain EXPUNGE
+// would also remove whatever other clients flagged.
+func (s *imapOpsServer) Delete(folder string, uids []uint32) error {
+	if err := s.AddFlag(folder, uids, imap.DeletedFlag); err != nil {
+		return err
+	}
+	_, err := expungeUIDs(s.c, uids)
+	return err
+}
+
+func (s *imapOpsServer) Move(folder string, uids []uint32, target string) error {
+	if err := createFolderIfNotExists(s.c, target); err != nil {
+		return fmt.Errorf("failed to create folder %s: %v", target, err)
+	}
+	if err := s.selectFolder(folder); err != nil {
+		return err
+	}
+	return s.c.UidMove(uidSet(uids), target)
+}
+
+func (s *imapOpsServer) Append(folder string, raw []byte) error {
+	return s.c.Append(folder, []string{imap.DraftFlag}, time.Now(), bytes.NewReader(raw))
+}
+
+func (s *imapOpsServer) DraftsFolder() (string, error) {
+	return findDraftsFolder(s.c)
+}
+
+// ReplayQueuedOps sends the offline journal to the server. It does nothing
+// when there's nothing pending, and reports Offline when the server still
+// can't be reached.
+func ReplayQueuedOps(config *Config) (*ReplayResult, error) {
+	dm, err := NewDatabaseManager(config.Email)
+	if err != nil {
+		return nil, err
+	}
+	defer dm.Close()
+
+	pending, err := dm.countPendingOps()
+	if err != nil || pending == 0 {
+		return &ReplayResult{Remaining: pending}, err
+	}
+
+	c, err := connectOnline(config)
+	if isOfflineError(err) {
+		return &ReplayResult{Remaining: pending, Offline: true}, nil
+	}
+	if err != nil {
+		return &ReplayResult{Remaining: pending}, err
+	}
+	defer c.Logout()
+
+	return replayOps(dm, &imapOpsServer{c: c})
+}
+
+func (dm *DatabaseManager) countPendingOps() (int, error) {
+	var count int
+	err := dm.db.QueryRow(`SELECT COUNT(*) FROM ops_journal WHERE state = ?`, OpPending).Scan(&count)
+	return count, err
+}
+
+// ListQueuedOps returns the account's offline journal
+func ListQueuedOps(accountEmail string) ([]*QueuedOp, error) {
+	dm, err := NewDatabaseManager(accountEmail)
+	if err != nil {
+		return nil, err
+	}
+	defer dm.Close()
+
+	return dm.ListQueuedOps()
+}
+
+// DiscardQueuedOp removes an operation from the account's journal without running it
+func DiscardQueuedOp(accountEmail string, id int64) error {
+	dm, err := NewDatabaseManager(accountEmail)
+	if err != nil {
+		return err
+	}
+	defer dm.Close()
+
+	return dm.RemoveQueuedOp(id)
+}
+
+// replayBeforeFetch replays the journal before messages are listed, so the
+// listing and its IDs already reflect what was done offline
+func replayBeforeFetch(config *Config) {
+	result, err := ReplayQueuedOps(config)
+	if err != nil {
+		fmt.Printf("⚠️  Could not replay queued operations: %v\n", err)
+		return
+	}
+	if result.Applied > 0 {
+		fmt.Printf("✓ Replayed %d operation(s) queued while offline\n", result.Applied)
+	}
+	if len(result.Conflicts) > 0 {
+		fmt.Printf("⚠️  %d queued operation(s) conflicted with changes on the server; see 'mailos status'\n", len(result.Conflicts))
+	}
+}
+
+// FormatQueuedOps formats the offline journal for 'mailos status'
+func FormatQueuedOps(ops []*QueuedOp) string {
+	var pending, conflicts []*QueuedOp
+	for _, op := range ops {
+		if op.State == OpConflict {
+			conflicts = append(conflicts, op)
+		} else {
+			pending = append(pending, op)
+		}
+	}
+
+	var out strings.Builder
+	if len(pending) == 0 {
+		out.WriteString("✓ No pending operations\n")
+	} else {
+		out.WriteString(fmt.Sprintf("⏳ %d pending operation(s):\n", len(pending)))
+		for _, op := range pending {
+			line := fmt.Sprintf("   #%d  %s  %s", op.ID, op.QueuedAt.Format("Jan 2 3:04 PM"), op.Describe())
+			if op.LastError != "" {
+				line += fmt.Sprintf(" (%d failed attempt(s): %s)", op.Attempts, op.LastError)
+			}
+			out.WriteString(line + "\n")
+		}
+	}
+	if len(conflicts) > 0 {
+		out.WriteString(fmt.Sprintf("⚠️  %d conflict(s):\n", len(conflicts)))
+		for _, op := range conflicts {
+			out.WriteString(fmt.Sprintf("   #%d  %s: %s\n", op.ID, op.Describe(), op.LastError))
+		}
+		out.WriteString("   Discard a reviewed conflict with 'mailos status --discard <#>'\n")
+	}
+	return out.String()
+}
@@ -0,0 +1,331 @@
+package mailos
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/server"
+)
+
+func TestQueueIfOffline(t *testing.T) {
+	tmpDir := setupTestGroups(t)
+	defer cleanupTestGroups(tmpDir)
+	t.Setenv("MAILOS_OFFLINE", "1")
+
+	config := &Config{Email: "me@example.com"}
+	inbox := &InboxData{AccountEmail: config.Email, Emails: []*Email{
+		{ID: 1, MessageID: "<one@example.org>", Subject: "Lunch"},
+		{ID: 2, MessageID: "<two@example.org>", Subject: "Invoice"},
+		{ID: 3, Subject: "No Message-ID"},
+	}}
+	if err := SaveGlobalInbox(config.Email, inbox); err != nil {
+		t.Fatal(err)
+	}
+
+	if queued, err := queueIfOffline(config, nil, &QueuedOp{Kind: OpMarkRead, Folder: "INBOX"}, []uint32{1}); !queued || err != nil {
+		t.Fatalf("Expected mark-read queued, got %v, %v", queued, err)
+	}
+	if queued, err := queueIfOffline(config, nil, &QueuedOp{Kind: OpDelete, Folder: "INBOX"}, []uint32{2}); !queued || err != nil {
+		t.Fatalf("Expected delete queued, got %v, %v", queued, err)
+	}
+	for _, ids := range [][]uint32{{3}, {9}} {
+		if _, err := queueIfOffline(config, nil, &QueuedOp{Kind: OpDelete, Folder: "INBOX"}, ids); err == nil {
+			t.Errorf("Expected messages without a Message-ID or outside the archive refused: %v", ids)
+		}
+	}
+	if _, err := queueIfOffline(config, nil, &QueuedOp{Kind: OpDelete, Folder: "Sent"}, []uint32{1}); err == nil {
+		t.Errorf("Expected folders outside the archive refused")
+	}
+
+	// The local archive reflects the changes right away
+	stored, err := LoadGlobalInbox(config.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.Emails) != 2 || !hasFlag(stored.Emails[0].Flags, imap.SeenFlag) {
+		t.Errorf("Expected the first message read and the second gone, got %+v", stored.Emails)
+	}
+	unread, _ := GetEmailsFromInbox(config.Email, ReadOptions{UnreadOnly: true})
+	if len(unread) != 1 || unread[0].ID != 3 {
+		t.Errorf("Expected only the unread message listed, got %+v", unread)
+	}
+
+	ops, err := ListQueuedOps(config.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 2 || ops[0].Kind != OpMarkRead || ops[1].MessageIDs[0] != "<two@example.org>" || ops[1].State != OpPending {
+		t.Fatalf("Unexpected journal: %+v", ops)
+	}
+	if out := FormatQueuedOps(ops); !strings.Contains(out, `2 pending operation(s)`) || !strings.Contains(out, `Delete "Invoice" from INBOX`) {
+		t.Errorf("Unexpected status output:\n%s", out)
+	}
+}
+
+func TestOfflineFallback(t *testing.T) {
+	// A port nothing listens on, so connecting is refused
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	Providers["imaptest"] = Provider{Name: "Test IMAP", IMAPHost: "127.0.0.1", IMAPPort: port}
+	t.Cleanup(func() { delete(Providers, "imaptest") })
+	setupConfigLayers(t, `{"provider": "imaptest", "email": "me@example.com", "password": "password"}`, "")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	inbox := &InboxData{AccountEmail: config.Email, Emails: []*Email{{ID: 1, MessageID: "<one@example.org>", Subject: "Lunch"}}}
+	if err := SaveGlobalInbox(config.Email, inbox); err != nil {
+		t.Fatal(err)
+	}
+
+	_, connErr := connectOnline(config)
+	if !isOfflineError(connErr) {
+		t.Fatalf("Expected a refused connection treated as offline, got %v", connErr)
+	}
+	if err := MarkAsRead([]uint32{1}); err != nil {
+		t.Fatalf("Expected mark-read queued, got %v", err)
+	}
+	if ops, _ := ListQueuedOps(config.Email); len(ops) != 1 || ops[0].Kind != OpMarkRead {
+		t.Errorf("Expected the mark-read queued, got %+v", ops)
+	}
+	emails, err := Read(ReadOptions{})
+	if err != nil || len(emails) != 1 || emails[0].Subject != "Lunch" {
+		t.Errorf("Expected the local archive read, got %+v (%v)", emails, err)
+	}
+	if result, err := ReplayQueuedOps(config); err != nil || !result.Offline || result.Remaining != 1 {
+		t.Errorf("Expected the replay to report offline, got %+v (%v)", result, err)
+	}
+	if ServerReachable(config) {
+		t.Errorf("Expected the server unreachable")
+	}
+}
+
+func TestLoginFailureIsNotOffline(t *testing.T) {
+	startTestIMAP(t)
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Password = "wrong"
+	if _, err := connectOnline(config); err == nil || isOfflineError(err) {
+		t.Errorf("Expected a refused login reported as an error, not offline: %v", err)
+	}
+	if queued, _ := queueIfOffline(config, fmt.Errorf("failed to login"), &QueuedOp{Kind: OpDelete, Folder: "INBOX"}, []uint32{1}); queued {
+		t.Errorf("Expected nothing queued when the server answered")
+	}
+}
+
+// fakeOpsServer holds folders of messages keyed by Message-ID
+type fakeOpsServer struct {
+	folders map[string]map[string]serverMessage
+	calls   []string
+	failOn  string
+}
+
+func (s *fakeOpsServer) Find(folder string, messageIDs []string) (map[string]serverMessage, error) {
+	found := make(map[string]serverMessage)
+	for _, id := range messageIDs {
+		if message, ok := s.folders[folder][id]; ok {
+			found[id] = message
+		}
+	}
+	return found, nil
+}
+
+func (s *fakeOpsServer) record(call string) error {
+	if s.failOn != "" && strings.HasPrefix(call, s.failOn) {
+		return fmt.Errorf("connection reset")
+	}
+	s.calls = append(s.calls, call)
+	return nil
+}
+
+func (s *fakeOpsServer) AddFlag(folder string, uids []uint32, flag string) error {
+	return s.record(fmt.Sprintf("flag %s %v %s", folder, uids, flag))
+}
+
+func (s *fakeOpsServer) Delete(folder string, uids []uint32) error {
+	return s.record(fmt.Sprintf("delete %s %v", folder, uids))
+}
+
+func (s *fakeOpsServer) Move(folder string, uids []uint32, target string) error {
+	return s.record(fmt.Sprintf("move %s %v %s", folder, uids, target))
+}
+
+func (s *fakeOpsServer) Append(folder string, raw []byte) error {
+	return s.record(fmt.Sprintf("append %s %s", folder, raw))
+}
+
+func (s *fakeOpsServer) DraftsFolder() (string, error) {
+	return "Drafts", nil
+}
+
+func TestReplayOps(t *testing.T) {
+	tmpDir := setupTestGroups(t)
+	defer cleanupTestGroups(tmpDir)
+
+	dm, err := NewDatabaseManager("me@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dm.Close()
+
+	for _, op := range []*QueuedOp{
+		{Kind: OpMarkRead, Folder: "INBOX", MessageIDs: []string{"<a>", "<gone>"}},
+		{Kind: OpDelete, Folder: "INBOX", MessageIDs: []string{"<b>", "<starred>", "<already-deleted>"}},
+		{Kind: OpMove, Folder: "INBOX", Target: "Archive", MessageIDs: []string{"<c>", "<moved>"}},
+		{Kind: OpAppendDraft, MessageIDs: []string{"<draft>"}, Raw: []byte("Subject: new")},
+		{Kind: OpAppendDraft, MessageIDs: []string{"<saved>"}, Raw: []byte("Subject: saved")},
+	} {
+		if err := dm.QueueOp(op); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server := &fakeOpsServer{folders: map[string]map[string]serverMessage{
+		"INBOX": {
+			"<a>":       {UID: 10},
+			"<b>":       {UID: 11},
+			"<starred>": {UID: 12, Flags: []string{imap.FlaggedFlag}},
+			"<c>":       {UID: 13},
+		},
+		"Archive": {"<moved>": {UID: 3}},
+		"Drafts":  {"<saved>": {UID: 7}},
+	}}
+
+	t.Run("ConnectionLost", func(t *testing.T) {
+		server.failOn = "delete"
+		result, err := replayOps(dm, server)
+		if err == nil || len(result.Conflicts) != 1 || result.Remaining != 4 {
+			t.Fatalf("Expected the replay to stop at the delete, got %+v, %v", result, err)
+		}
+		ops, _ := dm.ListQueuedOps()
+		if len(ops) != 5 || ops[1].Kind != OpDelete || ops[1].Attempts != 1 || ops[1].LastError != "connection reset" {
+			t.Errorf("Expected the failed delete kept in place, got %+v", ops)
+		}
+	})
+
+	t.Run("Conflicts", func(t *testing.T) {
+		server.failOn = ""
+		result, err := replayOps(dm, server)
+		if err != nil {
+			t.Fatalf("Replay failed: %v", err)
+		}
+		// The first run already conflicted on the message that was gone
+		if result.Applied != 3 || len(result.Conflicts) != 1 || result.Remaining != 0 {
+			t.Fatalf("Unexpected result: %+v", result)
+		}
+		want := []string{
+			"flag INBOX [10] \\Seen",
+			"delete INBOX [11]",
+			"move INBOX [13] Archive",
+			"append Drafts Subject: new",
+		}
+		if strings.Join(server.calls, "\n") != strings.Join(want, "\n") {
+			t.Errorf("Unexpected server calls:\n%s", strings.Join(server.calls, "\n"))
+		}
+
+		ops, _ := dm.ListQueuedOps()
+		if len(ops) != 2 || ops[0].State != OpConflict || ops[1].State != OpConflict {
+			t.Fatalf("Expected two conflicts kept, got %+v", ops)
+		}
+		if !strings.Contains(ops[0].LastError, "no longer in INBOX") || !strings.Contains(ops[1].LastError, "flagged on the server") {
+			t.Errorf("Unexpected conflict reasons: %q, %q", ops[0].LastError, ops[1].LastError)
+		}
+
+		// Conflicts stay until discarded
+		if again, _ := replayOps(dm, server); again.Applied != 0 || len(again.Conflicts) != 0 {
+			t.Errorf("Expected conflicts skipped on later replays, got %+v", again)
+		}
+		if err := dm.RemoveQueuedOp(ops[0].ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := dm.RemoveQueuedOp(ops[0].ID); err == nil {
+			t.Errorf("Expected removing a missing operation to fail")
+		}
+	})
+}
+
+// uidPlus advertises UIDPLUS and records the UID sets of UID EXPUNGE
+type uidPlus struct {
+	expunged []string
+}
+
+func (u *uidPlus) Capabilities(server.Conn) []string { return []string{"UIDPLUS"} }
+
+func (u *uidPlus) Command(name string) server.HandlerFactory {
+	if name != "EXPUNGE" {
+		return nil
+	}
+	return func() server.Handler { return &uidExpungeHandler{plus: u} }
+}
+
+type uidExpungeHandler struct {
+	plus   *uidPlus
+	fields []interface{}
+}
+
+func (h *uidExpungeHandler) Parse(fields []interface{}) error {
+	h.fields = fields
+	return nil
+}
+
+func (h *uidExpungeHandler) Handle(conn server.Conn) error {
+	return fmt.Errorf("plain EXPUNGE sent")
+}
+
+func (h *uidExpungeHandler) UidHandle(conn server.Conn) error {
+	h.plus.expunged = append(h.plus.expunged, fmt.Sprint(h.fields...))
+	return nil
+}
+
+func TestReplayDeleteExpungesOnlyItsMessages(t *testing.T) {
+	for name, plus := range map[string]*uidPlus{"WithoutUIDPLUS": nil, "WithUIDPLUS": {}} {
+		t.Run(name, func(t *testing.T) {
+			if plus != nil {
+				startTestIMAP(t, plus)
+			} else {
+				startTestIMAP(t)
+			}
+			config, err := LoadConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			inbox, _ := ReadFromFolder(ReadOptions{}, "INBOX")
+			uids := make(map[string]uint32)
+			for _, email := range inbox {
+				uids[email.Subject] = email.UID
+			}
+
+			c, err := connectOnline(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Logout()
+			s := &imapOpsServer{c: c}
+			// Another client flagged Lunch and hasn't expunged it yet
+			if err := s.AddFlag("INBOX", []uint32{uids["Lunch"]}, imap.DeletedFlag); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Delete("INBOX", []uint32{uids["Receipt"]}); err != nil {
+				t.Fatal(err)
+			}
+
+			left, _ := ReadFromFolder(ReadOptions{}, "INBOX")
+			if len(left) != len(inbox) {
+				t.Errorf("Expected no plain EXPUNGE, got %s", subjects(left))
+			}
+			if plus != nil && strings.Join(plus.expunged, " ") != fmt.Sprint(uids["Receipt"]) {
+				t.Errorf("Expected UID EXPUNGE of Receipt only, got %q", plus.expunged)
+			}
+		})
+	}
+}
@@ -0,0 +1,540 @@
+package mailos
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Remote content modes for stored HTML
+const (
+	RemoteContentBlock = "block" // Remove remote resources, keeping their URLs for reference
+	RemoteContentProxy = "proxy" // Load remote resources through the image proxy
+	RemoteContentAllow = "allow" // Keep remote resources; trackers are still removed
+)
+
+// PrivacySettings control how remote content in received HTML is stored
+type PrivacySettings struct {
+	RemoteContent  string   `json:"remote_content,omitempty"`  // "block", "proxy" or "allow"
+	ImageProxy     string   `json:"image_proxy,omitempty"`     // Proxy URL with {url} for the escaped original
+	TrackerDomains []string `json:"tracker_domains,omitempty"` // Added to the built-in tracker list
+}
+
+// GetPrivacySettings returns the privacy settings with defaults applied. The
+// proxy mode falls back to blocking when no proxy is configured.
+func (c *Config) GetPrivacySettings() PrivacySettings {
+	settings := PrivacySettings{RemoteContent: RemoteContentBlock}
+	if c.Privacy != nil {
+		settings.ImageProxy = c.Privacy.ImageProxy
+		settings.TrackerDomains = c.Privacy.TrackerDomains
+		switch c.Privacy.RemoteContent {
+		case RemoteContentAllow:
+			settings.RemoteContent = RemoteContentAllow
+		case RemoteContentProxy:
+			if strings.Contains(c.Privacy.ImageProxy, "{url}") {
+				settings.RemoteContent = RemoteContentProxy
+			}
+		}
+	}
+	return settings
+}
+
+// LoadPrivacySettings returns the current account's privacy settings, or
+// the defaults when no config can be loaded
+func LoadPrivacySettings() PrivacySettings {
+	config, err := LoadConfig()
+	if err != nil {
+		return (&Config{}).GetPrivacySettings()
+	}
+	return config.GetPrivacySettings()
+}
+
+// knownTrackerDomains serve open-tracking pixels and click redirects for
+// email marketing and sales tools
+var knownTrackerDomains = []string{
+	"list-manage.com", "mcsv.net", "sendgrid.net", "mandrillapp.com", "sparkpostmail.com",
+	"hubspotemail.net", "track.hubspot.com", "exct.net", "pardot.com", "mailtrack.io",
+	"getnotify.com", "bananatag.com", "yesware.com", "mixmax.com", "mailfoogae.appspot.com",
+	"r.superhuman.com", "track.customer.io", "klclick.com", "awstrack.me", "pstmrk.it",
+	"emltrk.com",
+}
+
+const (
+	// privacyMarker records that stored HTML has already been filtered
+	privacyMarker = "<!-- mailos: remote content filtered -->"
+
+	blockedAttr   = "data-mailos-blocked" // Why a resource was removed: "tracker" or "remote"
+	blockedSrcKey = "data-mailos-src"     // The removed resource's original URL
+)
+
+var (
+	cssURLPattern    = regexp.MustCompile(`(?i)url\(\s*(['"]?)(https?:)?//[^)]*\)`)
+	cssImportPattern = regexp.MustCompile(`(?i)@import\s+[^;]*;?`)
+	redirectParams   = []string{"url", "u", "redirect", "redirect_url", "redirect_uri", "target", "dest", "destination", "link", "r", "goto"}
+)
+
+// redirectHostLabels start the host names of click-tracking redirectors
+var redirectHostLabels = map[string]bool{
+	"click": true, "clicks": true, "trk": true, "track": true, "tracking": true,
+	"ct": true, "cl": true, "links": true, "link": true, "email": true,
+}
+
+// PrivacyFindings lists the tracking found in a message's HTML
+type PrivacyFindings struct {
+	Pixels          int      // 1x1 and hidden images
+	TrackerDomains  []string // Known tracker domains serving resources or links
+	RemoteResources int      // Other remote images, backgrounds and stylesheets
+	RedirectDomains []string // Domains links pass through before reaching their target
+}
+
+// TracksOpens reports whether opening the message would tell the sender
+func (f *PrivacyFindings) TracksOpens() bool {
+	return f.Pixels > 0 || len(f.TrackerDomains) > 0
+}
+
+// privacyFilter walks an HTML document for remote content
+type privacyFilter struct {
+	settings PrivacySettings
+	modify   bool
+	findings PrivacyFindings
+	trackers map[string]bool
+	redirect map[string]bool
+}
+
+// SanitizeRemoteContent removes tracking pixels and known trackers from an
+// HTML message and blocks or proxies its other remote resources, as the
+// settings ask. Removed resources keep their URL in a data-mailos-src
+// attribute, which no client loads.
+func SanitizeRemoteContent(doc string, settings PrivacySettings) string {
+	if doc == "" || strings.HasPrefix(doc, privacyMarker) {
+		return doc
+	}
+	root, err := xhtml.Parse(strings.NewReader(doc))
+	if err != nil {
+		return doc
+	}
+	f := newPrivacyFilter(settings, true)
+	f.walk(root)
+
+	var b strings.Builder
+	b.WriteString(privacyMarker)
+	if err := xhtml.Render(&b, root); err != nil {
+		return doc
+	}
+	return b.String()
+}
+
+// AnalyzePrivacy reports the tracking in an HTML message, whether or not it
+// has been sanitized
+func AnalyzePrivacy(doc string, settings PrivacySettings) PrivacyFindings {
+	root, err := xhtml.Parse(strings.NewReader(doc))
+	if err != nil {
+		return PrivacyFindings{}
+	}
+	f := newPrivacyFilter(settings, false)
+	f.walk(root)
+	f.findings.TrackerDomains = sortedKeys(f.trackers)
+	f.findings.RedirectDomains = sortedKeys(f.redirect)
+	return f.findings
+}
+
+func newPrivacyFilter(settings PrivacySettings, modify bool) *privacyFilter {
+	return &privacyFilter{settings: settings, modify: modify, trackers: map[string]bool{}, redirect: map[string]bool{}}
+}
+
+func (f *privacyFilter) walk(n *xhtml.Node) {
+	if n.Type == xhtml.ElementNode {
+		f.element(n)
+	}
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		f.walk(c)
+		c = next
+	}
+}
+
+func (f *privacyFilter) element(n *xhtml.Node) {
+	switch n.DataAtom {
+	case atom.Img:
+		f.image(n)
+		f.srcset(n)
+	case atom.A:
+		f.link(attr(n, "href"))
+	case atom.Link:
+		if strings.Contains(strings.ToLower(attr(n, "rel")), "stylesheet") {
+			f.resource(n, "href")
+		}
+	case atom.Style:
+		if n.FirstChild != nil && n.FirstChild.Type == xhtml.TextNode {
+			f.styleText(n.FirstChild)
+		}
+	case atom.Video:
+		f.resource(n, "poster")
+	case atom.Source:
+		// <picture> sources only have a srcset
+		f.resource(n, "src")
+		f.srcset(n)
+	case atom.Audio, atom.Input, atom.Iframe, atom.Embed:
+		f.resource(n, "src")
+	}
+
+	if attr(n, "background") != "" {
+		f.resource(n, "background")
+	}
+	if style := attr(n, "style"); cssURLPattern.MatchString(style) {
+		f.findings.RemoteResources++
+		if f.modify && f.settings.RemoteContent != RemoteContentAllow {
+			setAttr(n, "style", f.rewriteCSS(style))
+		}
+	}
+}
+
+// image classifies an image as a tracker, a pixel or other remote content
+func (f *privacyFilter) image(n *xhtml.Node) {
+	src := attr(n, "src")
+	blocked := attr(n, blockedAttr)
+	if blocked != "" {
+		src = attr(n, blockedSrcKey)
+	}
+	if !isRemoteURL(src) {
+		return
+	}
+
+	host := urlHost(src)
+	switch {
+	case f.isTracker(host):
+		f.trackers[host] = true
+		f.findings.Pixels += boolInt(isTrackingPixel(n) || isHiddenElement(n))
+		f.block(n, "src", "tracker")
+	case isTrackingPixel(n) || isHiddenElement(n) || blocked == "tracker":
+		f.findings.Pixels++
+		f.block(n, "src", "tracker")
+	default:
+		f.findings.RemoteResources++
+		f.remote(n, "src")
+	}
+}
+
+// srcset removes a srcset with remote candidates, which the browser would
+// load in place of the src. It's counted unless the src already was.
+func (f *privacyFilter) srcset(n *xhtml.Node) {
+	remote := false
+	for _, candidate := range strings.Split(attr(n, "srcset"), ",") {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 || !isRemoteURL(fields[0]) {
+			continue
+		}
+		remote = true
+		if host := urlHost(fields[0]); f.isTracker(host) {
+			f.trackers[host] = true
+		}
+	}
+	if !remote {
+		return
+	}
+
+	src := attr(n, "src")
+	if attr(n, blockedAttr) != "" {
+		src = attr(n, blockedSrcKey)
+	}
+	if !isRemoteURL(src) {
+		f.findings.RemoteResources++
+	}
+	if f.modify && f.settings.RemoteContent != RemoteContentAllow {
+		removeAttr(n, "srcset")
+	}
+}
+
+// resource handles a remote URL in an attribute other than an image's src
+func (f *privacyFilter) resource(n *xhtml.Node, key string) {
+	value := attr(n, key)
+	if attr(n, blockedAttr) != "" {
+		value = attr(n, blockedSrcKey)
+	}
+	if !isRemoteURL(value) {
+		return
+	}
+	if host := urlHost(value); f.isTracker(host) {
+		f.trackers[host] = true
+		f.block(n, key, "tracker")
+		return
+	}
+	f.findings.RemoteResources++
+	f.remote(n, key)
+}
+
+// remote blocks or proxies a remote resource as the settings ask
+func (f *privacyFilter) remote(n *xhtml.Node, key string) {
+	if !f.modify {
+		return
+	}
+	switch f.settings.RemoteContent {
+	case RemoteContentAllow:
+	case RemoteContentProxy:
+		original := attr(n, key)
+		setAttr(n, blockedSrcKey, original)
+		setAttr(n, key, proxyURL(f.settings.ImageProxy, original))
+	default:
+		f.block(n, key, "remote")
+	}
+}
+
+// block removes a resource's URL, keeping it in data-mailos-src
+func (f *privacyFilter) block(n *xhtml.Node, key, reason string) {
+	if !f.modify || attr(n, key) == "" {
+		return
+	}
+	setAttr(n, blockedSrcKey, attr(n, key))
+	setAttr(n, blockedAttr, reason)
+	removeAttr(n, key)
+}
+
+func (f *privacyFilter) link(href string) {
+	if !isRemoteURL(href) {
+		return
+	}
+	host := urlHost(href)
+	if f.isTracker(host) || isRedirectLink(href) {
+		f.redirect[host] = true
+	}
+}
+
+// styleText removes imports and remote urls from a <style> element
+func (f *privacyFilter) styleText(text *xhtml.Node) {
+	if !cssURLPattern.MatchString(text.Data) && !cssImportPattern.MatchString(text.Data) {
+		return
+	}
+	f.findings.RemoteResources++
+	if f.modify && f.settings.RemoteContent != RemoteContentAllow {
+		text.Data = f.rewriteCSS(cssImportPattern.ReplaceAllString(text.Data, ""))
+	}
+}
+
+func (f *privacyFilter) rewriteCSS(css string) string {
+	return cssURLPattern.ReplaceAllStringFunc(css, func(match string) string {
+		if f.settings.RemoteContent != RemoteContentProxy {
+			return "none"
+		}
+		inner := strings.TrimSpace(match[strings.Index(match, "(")+1 : len(match)-1])
+		original := strings.Trim(inner, `'"`)
+		if strings.HasPrefix(original, "//") {
+			original = "https:" + original
+		}
+		if f.isTracker(urlHost(original)) {
+			return "none"
+		}
+		return fmt.Sprintf("url('%s')", proxyURL(f.settings.ImageProxy, original))
+	})
+}
+
+func (f *privacyFilter) isTracker(host string) bool {
+	return matchesDomain(host, knownTrackerDomains) || matchesDomain(host, f.settings.TrackerDomains)
+}
+
+// isRedirectLink reports whether a link goes through a click-tracking
+// redirector: the target URL is carried in a parameter, or the host or path
+// names a click tracker
+func isRedirectLink(href string) bool {
+	u, err := url.Parse(href)
+	if err != nil {
+		return false
+	}
+	query := u.Query()
+	for _, key := range redirectParams {
+		if isRemoteURL(query.Get(key)) {
+			return true
+		}
+	}
+	path := strings.ToLower(u.Path)
+	if strings.Contains(path, "/click") || strings.Contains(path, "/redirect") || strings.Contains(path, "/track") {
+		return true
+	}
+	label, _, _ := strings.Cut(strings.ToLower(u.Hostname()), ".")
+	return redirectHostLabels[label] && strings.Count(u.Hostname(), ".") >= 2
+}
+
+func matchesDomain(host string, domains []string) bool {
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func proxyURL(template, original string) string {
+	return strings.ReplaceAll(template, "{url}", url.QueryEscape(original))
+}
+
+func isRemoteURL(value string) bool {
+	lower := strings.ToLower(strings.TrimSpace(value))
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "//")
+}
+
+func urlHost(value string) string {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "//") {
+		value = "https:" + value
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+func setAttr(n *xhtml.Node, key, value string) {
+	for i := range n.Attr {
+		if strings.EqualFold(n.Attr[i].Key, key) {
+			n.Attr[i].Val = value
+			return
+		}
+	}
+	n.Attr = append(n.Attr, xhtml.Attribute{Key: key, Val: value})
+}
+
+func removeAttr(n *xhtml.Node, key string) {
+	kept := n.Attr[:0]
+	for _, a := range n.Attr {
+		if !strings.EqualFold(a.Key, key) {
+			kept = append(kept, a)
+		}
+	}
+	n.Attr = kept
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sanitizeStoredEmail filters the remote content of an email's HTML before
+// it is written to disk
+func sanitizeStoredEmail(email *Email, settings PrivacySettings) {
+	if email.BodyHTML != "" {
+		email.BodyHTML = SanitizeRemoteContent(email.BodyHTML, settings)
+	}
+}
+
+// SenderPrivacy summarizes the tracking in one sender's messages
+type SenderPrivacy struct {
+	Sender         string   `json:"sender"`
+	Messages       int      `json:"messages"`
+	Tracked        int      `json:"tracked"` // Messages that report when they're opened
+	TrackerDomains []string `json:"tracker_domains,omitempty"`
+}
+
+// PrivacyReport summarizes tracking across stored messages
+type PrivacyReport struct {
+	Messages        int             `json:"messages"`
+	Tracked         int             `json:"tracked"`
+	Senders         []SenderPrivacy `json:"senders"`          // Senders that track opens, most tracked first
+	RedirectDomains map[string]int  `json:"redirect_domains"` // Link redirect domain to the number of messages using it
+}
+
+// BuildPrivacyReport analyzes the HTML of emails for open tracking and link
+// redirects
+func BuildPrivacyReport(emails []*Email, settings PrivacySettings) *PrivacyReport {
+	report := &PrivacyReport{RedirectDomains: map[string]int{}}
+	senders := map[string]*SenderPrivacy{}
+	senderTrackers := map[string]map[string]bool{}
+
+	for _, email := range emails {
+		if email.BodyHTML == "" {
+			continue
+		}
+		report.Messages++
+		findings := AnalyzePrivacy(email.BodyHTML, settings)
+		for _, domain := range findings.RedirectDomains {
+			report.RedirectDomains[domain]++
+		}
+		if !findings.TracksOpens() {
+			continue
+		}
+		report.Tracked++
+
+		address := strings.ToLower(extractEmailAddress(email.From))
+		sender, ok := senders[address]
+		if !ok {
+			sender = &SenderPrivacy{Sender: address}
+			senders[address] = sender
+			senderTrackers[address] = map[string]bool{}
+		}
+		sender.Tracked++
+		for _, domain := range findings.TrackerDomains {
+			senderTrackers[address][domain] = true
+		}
+	}
+
+	// Count every message from tracking senders, tracked or not
+	for _, email := range emails {
+		if sender, ok := senders[strings.ToLower(extractEmailAddress(email.From))]; ok && email.BodyHTML != "" {
+			sender.Messages++
+		}
+	}
+	for address, sender := range senders {
+		sender.TrackerDomains = sortedKeys(senderTrackers[address])
+		report.Senders = append(report.Senders, *sender)
+	}
+	sort.Slice(report.Senders, func(i, j int) bool {
+		if report.Senders[i].Tracked != report.Senders[j].Tracked {
+			return report.Senders[i].Tracked > report.Senders[j].Tracked
+		}
+		return report.Senders[i].Sender < report.Senders[j].Sender
+	})
+	return report
+}
+
+// FormatPrivacyReport renders a privacy report for the terminal
+func FormatPrivacyReport(report *PrivacyReport) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("🔒 Privacy report: %d of %d HTML messages track opens\n", report.Tracked, report.Messages))
+
+	if len(report.Senders) == 0 {
+		b.WriteString("\n✓ No open tracking found\n")
+	} else {
+		b.WriteString("\n👁  Senders tracking opens:\n")
+		for _, sender := range report.Senders {
+			line := fmt.Sprintf("   %-40s %d/%d messages", sender.Sender, sender.Tracked, sender.Messages)
+			if len(sender.TrackerDomains) > 0 {
+				line += "  via " + strings.Join(sender.TrackerDomains, ", ")
+			}
+			b.WriteString(line + "\n")
+		}
+	}
+
+	if len(report.RedirectDomains) > 0 {
+		domains := make([]string, 0, len(report.RedirectDomains))
+		for domain := range report.RedirectDomains {
+			domains = append(domains, domain)
+		}
+		sort.Slice(domains, func(i, j int) bool {
+			if report.RedirectDomains[domains[i]] != report.RedirectDomains[domains[j]] {
+				return report.RedirectDomains[domains[i]] > report.RedirectDomains[domains[j]]
+			}
+			return domains[i] < domains[j]
+		})
+		b.WriteString("\n🔗 Link redirect domains:\n")
+		for _, domain := range domains {
+			b.WriteString(fmt.Sprintf("   %-40s %d messages\n", domain, report.RedirectDomains[domain]))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,135 @@
+package mailos
+
+import (
+	"strings"
+	"testing"
+)
+
+const trackedHTML = `<html><head><style>@import url("https://fonts.example.com/f.css"); body { background: url(https://cdn.example.com/bg.png) }</style></head><body>
+<p>Hello <a href="https://click.news.example.com/ls/click?upn=abc">read more</a> or <a href="https://example.com/about">about us</a>.</p>
+<img src="https://cdn.example.com/logo.png" alt="Logo" srcset="https://cdn.example.com/logo@2x.png 2x">
+<picture><source srcset="https://cdn.example.com/hero.webp 1x, https://cdn.example.com/hero@2x.webp 2x" type="image/webp"><img src="cid:hero" alt="Hero"></picture>
+<table><tr><td background="https://cdn.example.com/hero.jpg" style="background-image:url('https://cdn.example.com/hero.jpg')">Hero</td></tr></table>
+<img src="https://acme.list-manage.com/track/open.php?u=1" width="1" height="1">
+<img src="https://pixel.example.net/o.gif" style="width:1px;height:1px" alt="">
+</body></html>`
+
+func TestSanitizeRemoteContent(t *testing.T) {
+	t.Run("Block", func(t *testing.T) {
+		got := SanitizeRemoteContent(trackedHTML, PrivacySettings{RemoteContent: RemoteContentBlock})
+		for _, unwanted := range []string{` src="https://`, `srcset=`, `background="https://`, "url(", "@import"} {
+			if strings.Contains(got, unwanted) {
+				t.Errorf("Expected %q removed, got:\n%s", unwanted, got)
+			}
+		}
+		for _, want := range []string{
+			`data-mailos-src="https://acme.list-manage.com/track/open.php?u=1" data-mailos-blocked="tracker"`,
+			`data-mailos-src="https://cdn.example.com/logo.png" data-mailos-blocked="remote"`,
+			`href="https://example.com/about"`,
+		} {
+			if !strings.Contains(got, want) {
+				t.Errorf("Expected %q in:\n%s", want, got)
+			}
+		}
+		if again := SanitizeRemoteContent(got, PrivacySettings{RemoteContent: RemoteContentBlock}); again != got {
+			t.Errorf("Expected sanitizing twice to change nothing")
+		}
+		if text := HTMLToText(got, HTMLTextOptions{Markdown: true}); strings.Contains(text, "![Logo]") {
+			t.Errorf("Expected no remote image in the markdown, got:\n%s", text)
+		}
+	})
+
+	t.Run("Proxy", func(t *testing.T) {
+		settings := (&Config{Privacy: &PrivacySettings{RemoteContent: RemoteContentProxy, ImageProxy: "https://proxy.example/?url={url}"}}).GetPrivacySettings()
+		got := SanitizeRemoteContent(trackedHTML, settings)
+		if !strings.Contains(got, `src="https://proxy.example/?url=https%3A%2F%2Fcdn.example.com%2Flogo.png"`) {
+			t.Errorf("Expected the image proxied, got:\n%s", got)
+		}
+		if strings.Contains(got, "proxy.example/?url=https%3A%2F%2Facme.list-manage.com") {
+			t.Errorf("Expected trackers never proxied, got:\n%s", got)
+		}
+	})
+
+	t.Run("Allow", func(t *testing.T) {
+		got := SanitizeRemoteContent(trackedHTML, PrivacySettings{RemoteContent: RemoteContentAllow})
+		if !strings.Contains(got, `src="https://cdn.example.com/logo.png"`) || strings.Contains(got, ` src="https://pixel.example.net`) {
+			t.Errorf("Expected remote images kept and pixels removed, got:\n%s", got)
+		}
+	})
+
+	t.Run("ProxyWithoutURL", func(t *testing.T) {
+		settings := (&Config{Privacy: &PrivacySettings{RemoteContent: RemoteContentProxy}}).GetPrivacySettings()
+		if settings.RemoteContent != RemoteContentBlock {
+			t.Errorf("Expected blocking without a proxy URL, got %q", settings.RemoteContent)
+		}
+	})
+}
+
+func TestAnalyzePrivacy(t *testing.T) {
+	settings := PrivacySettings{RemoteContent: RemoteContentBlock}
+	raw := AnalyzePrivacy(trackedHTML, settings)
+	stored := AnalyzePrivacy(SanitizeRemoteContent(trackedHTML, settings), settings)
+
+	for name, findings := range map[string]PrivacyFindings{"Raw": raw, "Sanitized": stored} {
+		if findings.Pixels != 2 || !findings.TracksOpens() {
+			t.Errorf("%s: expected 2 pixels, got %+v", name, findings)
+		}
+		if strings.Join(findings.TrackerDomains, ",") != "acme.list-manage.com" {
+			t.Errorf("%s: expected the tracker domain, got %v", name, findings.TrackerDomains)
+		}
+		if strings.Join(findings.RedirectDomains, ",") != "click.news.example.com" {
+			t.Errorf("%s: expected the redirect domain, got %v", name, findings.RedirectDomains)
+		}
+	}
+	if raw.RemoteResources == 0 {
+		t.Errorf("Expected remote resources counted, got %+v", raw)
+	}
+}
+
+func TestPrivacyReport(t *testing.T) {
+	emails := []*Email{
+		{From: "News <news@shop.example>", BodyHTML: trackedHTML},
+		{From: "news@shop.example", BodyHTML: "<p>No tracking</p>"},
+		{From: "Friend <friend@example.org>", BodyHTML: `<p><a href="https://example.com/?url=https://other.example/">x</a></p>`},
+		{From: "plain@example.org", Body: "Text only"},
+	}
+	report := BuildPrivacyReport(emails, PrivacySettings{})
+	if report.Messages != 3 || report.Tracked != 1 || len(report.Senders) != 1 {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+	if sender := report.Senders[0]; sender.Sender != "news@shop.example" || sender.Messages != 2 || sender.Tracked != 1 {
+		t.Errorf("Unexpected sender summary: %+v", sender)
+	}
+	if report.RedirectDomains["click.news.example.com"] != 1 || report.RedirectDomains["example.com"] != 1 {
+		t.Errorf("Unexpected redirect domains: %v", report.RedirectDomains)
+	}
+
+	out := FormatPrivacyReport(report)
+	if !strings.Contains(out, "1 of 3 HTML messages track opens") || !strings.Contains(out, "via acme.list-manage.com") {
+		t.Errorf("Unexpected report output:\n%s", out)
+	}
+}
+
+func TestSaveGlobalInboxSanitizes(t *testing.T) {
+	tmpDir := setupTestGroups(t)
+	defer cleanupTestGroups(tmpDir)
+
+	account := "me@example.com"
+	inbox := &InboxData{AccountEmail: account, Emails: []*Email{{From: "news@shop.example", BodyHTML: trackedHTML}}}
+	if err := SaveGlobalInbox(account, inbox); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	dm, err := NewDatabaseManager(account)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dm.Close()
+	var html string
+	if err := dm.db.QueryRow("SELECT body_html FROM emails").Scan(&html); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(html, privacyMarker) || strings.Contains(html, ` src="https://`) {
+		t.Errorf("Expected the stored HTML filtered, got:\n%s", html)
+	}
+}
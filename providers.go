@@ -18,6 +18,7 @@ type Provider struct {
 	IMAPPort        int
 	AppPasswordURL  string
 	AppPasswordHelp string
+	SendLimits      SendLimits // Conservative defaults that stay under the provider's quotas
 }
 
 var Providers = map[string]Provider{
@@ -30,6 +31,7 @@ var Providers = map[string]Provider{
 		IMAPPort:        IMAPPortSSL,
 		AppPasswordURL:  GmailAppPasswordURL,
 		AppPasswordHelp: "You need to enable 2-factor authentication and create an app password",
+		SendLimits:      SendLimits{MessagesPerMinute: 20, MessagesPerDay: 500, RecipientsPerMessage: 100},
 	},
 	ProviderFastmail: {
 		Name:            "Fastmail",
@@ -40,6 +42,7 @@ var Providers = map[string]Provider{
 		IMAPPort:        IMAPPortSSL,
 		AppPasswordURL:  FastmailAppPasswordURL,
 		AppPasswordHelp: "Create an app-specific password in Settings > Security > Device Passwords",
+		SendLimits:      SendLimits{MessagesPerMinute: 30, MessagesPerDay: 4000, RecipientsPerMessage: 100},
 	},
 	ProviderZoho: {
 		Name:            "Zoho Mail",
@@ -50,6 +53,7 @@ var Providers = map[string]Provider{
 		IMAPPort:        IMAPPortSSL,
 		AppPasswordURL:  ZohoAppPasswordURL,
 		AppPasswordHelp: "Generate an application-specific password in Security settings",
+		SendLimits:      SendLimits{MessagesPerMinute: 10, MessagesPerDay: 250, RecipientsPerMessage: 50},
 	},
 	ProviderOutlook: {
 		Name:            "Outlook/Hotmail",
@@ -60,6 +64,7 @@ var Providers = map[string]Provider{
 		IMAPPort:        IMAPPortSSL,
 		AppPasswordURL:  OutlookAppPasswordURL,
 		AppPasswordHelp: "Enable two-step verification and create an app password",
+		SendLimits:      SendLimits{MessagesPerMinute: 30, MessagesPerDay: 300, RecipientsPerMessage: 100},
 	},
 	ProviderYahoo: {
 		Name:            "Yahoo Mail",
@@ -70,6 +75,7 @@ var Providers = map[string]Provider{
 		IMAPPort:        IMAPPortSSL,
 		AppPasswordURL:  YahooAppPasswordURL,
 		AppPasswordHelp: "Generate an app password in Account Security settings",
+		SendLimits:      SendLimits{MessagesPerMinute: 20, MessagesPerDay: 500, RecipientsPerMessage: 100},
 	},
 }
 
@@ -30,6 +30,7 @@ type QueryOptions struct {
 	SortBy         string
 	Format         string
 	TopN           int
+	Query          string // Search query from the arguments without a key=value form
 }
 
 func NewQueryOptions() QueryOptions {
@@ -40,9 +41,11 @@ func NewQueryOptions() QueryOptions {
 }
 
 func (q *QueryOptions) ParseArgs(args []string) error {
+	var terms []string
 	for _, arg := range args {
 		parts := strings.SplitN(arg, "=", 2)
 		if len(parts) != 2 {
+			terms = append(terms, arg)
 			continue
 		}
 		
@@ -107,7 +110,13 @@ func (q *QueryOptions) ParseArgs(args []string) error {
 			}
 		}
 	}
-	
+
+	if len(terms) > 0 {
+		q.Query = strings.Join(terms, " ")
+		if _, err := ParseQuery(q.Query); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,172 @@
+package mailos
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+)
+
+// SendLimits caps how fast an account sends mail. Zero fields fall back to
+// the provider's defaults; a negative value removes that limit.
+type SendLimits struct {
+	MessagesPerMinute    int `json:"messages_per_minute,omitempty"`
+	MessagesPerDay       int `json:"messages_per_day,omitempty"`
+	RecipientsPerMessage int `json:"recipients_per_message,omitempty"`
+}
+
+// defaultSendLimits apply to providers without their own defaults
+var defaultSendLimits = SendLimits{MessagesPerMinute: 20, MessagesPerDay: 500, RecipientsPerMessage: 50}
+
+// GetSendLimits returns the provider defaults with the account's overrides applied
+func (c *Config) GetSendLimits() SendLimits {
+	limits := defaultSendLimits
+	if provider, exists := Providers[c.Provider]; exists && provider.SendLimits != (SendLimits{}) {
+		limits = provider.SendLimits
+	}
+	if c.SendLimits != nil {
+		if c.SendLimits.MessagesPerMinute != 0 {
+			limits.MessagesPerMinute = c.SendLimits.MessagesPerMinute
+		}
+		if c.SendLimits.MessagesPerDay != 0 {
+			limits.MessagesPerDay = c.SendLimits.MessagesPerDay
+		}
+		if c.SendLimits.RecipientsPerMessage != 0 {
+			limits.RecipientsPerMessage = c.SendLimits.RecipientsPerMessage
+		}
+	}
+	return limits
+}
+
+// SendLimitError reports that the account's daily quota is used up
+type SendLimitError struct {
+	Limit   int
+	RetryAt time.Time
+}
+
+func (e *SendLimitError) Error() string {
+	return fmt.Sprintf("daily limit of %d messages reached; sending can resume after %s",
+		e.Limit, e.RetryAt.Local().Format("Jan 2, 3:04 PM"))
+}
+
+// sendBucket is one token bucket refilled at capacity tokens per period
+type sendBucket struct {
+	name     string
+	capacity int
+	period   time.Duration
+}
+
+// reserveSendSlot takes a token from the account's per-minute and per-day
+// buckets. The buckets live in the account database and are updated inside an
+// immediate transaction, so concurrent mailos processes share them. It returns
+// how long to wait when the per-minute bucket is empty, or a *SendLimitError
+// when the daily bucket is.
+func (dm *DatabaseManager) reserveSendSlot(limits SendLimits, now time.Time) (time.Duration, error) {
+	buckets := []sendBucket{
+		{"minute", limits.MessagesPerMinute, time.Minute},
+		{"day", limits.MessagesPerDay, 24 * time.Hour},
+	}
+
+	ctx := context.Background()
+	conn, err := dm.db.Conn(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open rate limit connection: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "PRAGMA busy_timeout = 10000"); err != nil {
+		return 0, fmt.Errorf("failed to set busy timeout: %v", err)
+	}
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return 0, fmt.Errorf("failed to lock rate limit state: %v", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			conn.ExecContext(ctx, "ROLLBACK")
+		}
+	}()
+
+	tokens := make([]float64, len(buckets))
+	var wait time.Duration
+	var limitErr error
+	for i, bucket := range buckets {
+		if bucket.capacity <= 0 {
+			continue
+		}
+
+		var stored float64
+		var updatedAt int64
+		err := conn.QueryRowContext(ctx, `SELECT tokens, updated_at FROM send_rate WHERE bucket = ?`, bucket.name).Scan(&stored, &updatedAt)
+		if err == sql.ErrNoRows {
+			stored, updatedAt = float64(bucket.capacity), now.UnixNano()
+		} else if err != nil {
+			return 0, fmt.Errorf("failed to read rate limit state: %v", err)
+		}
+
+		// Refill for the time since the last send, up to the bucket's capacity
+		elapsed := now.Sub(time.Unix(0, updatedAt))
+		if elapsed < 0 {
+			elapsed = 0
+		}
+		rate := float64(bucket.capacity) / float64(bucket.period)
+		tokens[i] = math.Min(float64(bucket.capacity), stored+float64(elapsed)*rate)
+
+		if tokens[i] < 1 {
+			needed := time.Duration(math.Ceil((1 - tokens[i]) / rate))
+			if bucket.name == "day" {
+				limitErr = &SendLimitError{Limit: bucket.capacity, RetryAt: now.Add(needed)}
+			} else if needed > wait {
+				wait = needed
+			}
+		}
+	}
+
+	// Only spend tokens when every bucket has one; otherwise just save the refill
+	spend := 0.0
+	if wait == 0 && limitErr == nil {
+		spend = 1
+	}
+	for i, bucket := range buckets {
+		if bucket.capacity <= 0 {
+			continue
+		}
+		_, err := conn.ExecContext(ctx, `INSERT OR REPLACE INTO send_rate (bucket, tokens, updated_at) VALUES (?, ?, ?)`,
+			bucket.name, tokens[i]-spend, now.UnixNano())
+		if err != nil {
+			return 0, fmt.Errorf("failed to save rate limit state: %v", err)
+		}
+	}
+
+	if _, err := conn.ExecContext(ctx, "COMMIT"); err != nil {
+		return 0, fmt.Errorf("failed to save rate limit state: %v", err)
+	}
+	committed = true
+
+	if limitErr != nil {
+		return 0, limitErr
+	}
+	return wait, nil
+}
+
+// waitForSendSlot blocks until the account may send another message
+func waitForSendSlot(accountEmail string, limits SendLimits) error {
+	dm, err := NewDatabaseManager(accountEmail)
+	if err != nil {
+		return err
+	}
+	defer dm.Close()
+
+	for {
+		wait, err := dm.reserveSendSlot(limits, time.Now())
+		if err != nil {
+			return err
+		}
+		if wait == 0 {
+			return nil
+		}
+		fmt.Printf("⏳ Send rate limit (%d/minute) reached, waiting %s...\n", limits.MessagesPerMinute, wait.Round(time.Second))
+		time.Sleep(wait)
+	}
+}
@@ -0,0 +1,152 @@
+package mailos
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestGetSendLimits(t *testing.T) {
+	config := &Config{Provider: ProviderZoho}
+	if got := config.GetSendLimits(); got != Providers[ProviderZoho].SendLimits {
+		t.Errorf("Expected Zoho defaults, got %+v", got)
+	}
+
+	config.SendLimits = &SendLimits{MessagesPerDay: 1000, RecipientsPerMessage: -1}
+	got := config.GetSendLimits()
+	if got.MessagesPerMinute != Providers[ProviderZoho].SendLimits.MessagesPerMinute || got.MessagesPerDay != 1000 || got.RecipientsPerMessage != -1 {
+		t.Errorf("Expected account overrides on top of provider defaults, got %+v", got)
+	}
+
+	if got := (&Config{Provider: "custom"}).GetSendLimits(); got != defaultSendLimits {
+		t.Errorf("Expected fallback limits for unknown providers, got %+v", got)
+	}
+}
+
+func TestReserveSendSlot(t *testing.T) {
+	tmpDir := setupTestGroups(t)
+	defer cleanupTestGroups(tmpDir)
+
+	// Two managers on the same account stand in for two mailos processes
+	first, err := NewDatabaseManager("me@example.com")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer first.Close()
+	second, err := NewDatabaseManager("me@example.com")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer second.Close()
+
+	limits := SendLimits{MessagesPerMinute: 2, MessagesPerDay: 3}
+	now := time.Date(2024, 9, 2, 10, 0, 0, 0, time.UTC)
+
+	t.Run("MinuteBucketShared", func(t *testing.T) {
+		for i, dm := range []*DatabaseManager{first, second} {
+			if wait, err := dm.reserveSendSlot(limits, now); err != nil || wait != 0 {
+				t.Fatalf("Send %d: expected a free slot, got wait=%s err=%v", i+1, wait, err)
+			}
+		}
+		wait, err := first.reserveSendSlot(limits, now)
+		if err != nil || wait != 30*time.Second {
+			t.Errorf("Expected to wait 30s for the next token, got wait=%s err=%v", wait, err)
+		}
+		if wait, err := second.reserveSendSlot(limits, now.Add(30*time.Second)); err != nil || wait != 0 {
+			t.Errorf("Expected a slot after the refill, got wait=%s err=%v", wait, err)
+		}
+	})
+
+	t.Run("DailyLimit", func(t *testing.T) {
+		_, err := first.reserveSendSlot(limits, now.Add(2*time.Minute))
+		var limitErr *SendLimitError
+		if !errors.As(err, &limitErr) {
+			t.Fatalf("Expected the daily limit, got %v", err)
+		}
+		if limitErr.Limit != 3 || !limitErr.RetryAt.After(now) {
+			t.Errorf("Unexpected limit error %+v", limitErr)
+		}
+		// Wrapped errors from batch sends still match
+		if !errors.As(fmt.Errorf("batch 1/2 stopped: %w", err), &limitErr) {
+			t.Errorf("Expected wrapped limit errors to match")
+		}
+	})
+
+	t.Run("Unlimited", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			if wait, err := first.reserveSendSlot(SendLimits{MessagesPerMinute: -1, MessagesPerDay: -1}, now); err != nil || wait != 0 {
+				t.Fatalf("Expected no limit, got wait=%s err=%v", wait, err)
+			}
+		}
+	})
+}
+
+func TestBatchSendPlanning(t *testing.T) {
+	tmpDir := setupTestGroups(t)
+	defer cleanupTestGroups(tmpDir)
+
+	var recipients []string
+	for i := 0; i < 7; i++ {
+		recipients = append(recipients, fmt.Sprintf("Member %d <m%d@example.com>", i, i))
+	}
+	msg := &EmailMessage{To: recipients[:2], BCC: append(recipients[2:], "M0@Example.com"), Subject: "News", Body: "Hello"}
+
+	unique := uniqueRecipients(msg)
+	if len(unique) != 7 || unique[0] != "m0@example.com" {
+		t.Fatalf("Expected bare, de-duplicated addresses, got %v", unique)
+	}
+
+	batches := recipientBatches(unique, 3)
+	if len(batches) != 3 || len(batches[0]) != 3 || len(batches[2]) != 1 {
+		t.Errorf("Expected batches of 3, 3 and 1, got %v", batches)
+	}
+
+	t.Run("Resume", func(t *testing.T) {
+		dm, err := NewDatabaseManager("me@example.com")
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		defer dm.Close()
+
+		jobID := batchJobID(msg, unique)
+		reordered := append([]string{}, unique[3:]...)
+		if batchJobID(msg, append(reordered, unique[:3]...)) != jobID {
+			t.Errorf("Expected the job ID not to depend on recipient order")
+		}
+		if batchJobID(&EmailMessage{Subject: "News", Body: "Changed"}, unique) == jobID {
+			t.Errorf("Expected a different message to be a different job")
+		}
+
+		if err := dm.recordBatchRecipients(jobID, batches[0]); err != nil {
+			t.Fatal(err)
+		}
+		done, err := dm.completedBatchRecipients(jobID)
+		if err != nil || len(done) != 3 || !done["m2@example.com"] {
+			t.Errorf("Expected the first batch recorded, got %v (%v)", done, err)
+		}
+
+		if err := dm.clearBatchJob(jobID); err != nil {
+			t.Fatal(err)
+		}
+		if done, _ := dm.completedBatchRecipients(jobID); len(done) != 0 {
+			t.Errorf("Expected a finished job to be forgotten")
+		}
+	})
+
+	t.Run("OneMessageID", func(t *testing.T) {
+		config := &Config{Email: "me@example.com"}
+		batch := *msg
+		batch.MessageID = "batch-1@example.com"
+		processed, err := ProcessEmailWithFrontmatter(&batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out := composeOutgoingMessage(processed, config, nil); out.MessageID != "batch-1@example.com" {
+			t.Errorf("Expected every batch sent under the same Message-ID, got %q", out.MessageID)
+		}
+		if out := composeOutgoingMessage(msg, config, nil); out.MessageID == "" || out.MessageID == "batch-1@example.com" {
+			t.Errorf("Expected a new Message-ID for a single send, got %q", out.MessageID)
+		}
+	})
+}
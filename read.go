@@ -1,6 +1,7 @@
 package mailos
 
 import (
+	"bytes"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -20,6 +21,7 @@ import (
 
 type Email struct {
 	ID              uint32
+	UID             uint32              `json:",omitempty"` // IMAP UID, which unlike ID doesn't change as messages are removed
 	From            string
 	To              []string
 	Subject         string
@@ -28,9 +30,22 @@ type Email struct {
 	BodyHTML        string
 	Attachments     []string
 	AttachmentData  map[string][]byte // Map of filename to attachment data
+	AttachmentMeta  map[string]AttachmentMeta // Map of filename to MIME type and size
 	MessageID       string             // Message-ID header for threading
 	InReplyTo       string             // In-Reply-To header for threading
 	Headers         map[string][]string // All email headers
+	DeliveryReport  *DeliveryReport     `json:",omitempty"` // Set when the email is a delivery status notification
+	BodyFromHTML    bool                `json:",omitempty"` // Body was rendered from BodyHTML, as there is no text/plain part
+	Auth            *AuthVerdict        `json:",omitempty"` // Sender authentication and phishing signals
+	Flags           []string            `json:",omitempty"` // IMAP flags such as \Seen when fetched
+	Folder          string              `json:",omitempty"` // Folder the email was read from, when known
+	Size            int64               `json:",omitempty"` // RFC822 size reported by the server, when fetched
+}
+
+// AttachmentMeta describes an attachment even when its content wasn't downloaded
+type AttachmentMeta struct {
+	MIMEType string `json:"mime_type"`
+	Size     int64  `json:"size"`
 }
 
 type ReadOptions struct {
@@ -40,43 +55,44 @@ type ReadOptions struct {
 	ToAddress        string
 	Subject          string
 	Since            time.Time
+	Until            time.Time // Local archive only
+	Offset           int   // Skip this many of the newest matches, for paging
 	LocalOnly        bool  // Only read from local storage
 	SyncLocal        bool  // Sync received emails to local storage
 	DownloadAttach   bool  // Download attachment content
 	AttachmentDir    string // Directory to save attachments (if empty, returns in memory)
+	Query            *Query // Search query the emails have to match, run on the server where it can be
 }
 
 func Read(opts ReadOptions) ([]*Email, error) {
-	// If LocalOnly is set, try to read from global inbox first
-	if opts.LocalOnly {
-		config, err := LoadConfig()
-		if err == nil && config.Email != "" {
-			emails, err := GetEmailsFromInbox(config.Email, opts)
-			if err == nil {
-				fmt.Printf("Read %d emails from global inbox\n", len(emails))
-				return emails, nil
-			}
+	if !opts.LocalOnly {
+		if IsOffline() {
+			fmt.Printf("📴 Offline: showing the local archive\n")
+			opts.LocalOnly = true
+		} else if config, err := LoadConfig(); err == nil && config.Email != "" {
+			replayBeforeFetch(config)
 		}
-		// Fallback to old local storage method
-		return readFromLocalStorage(opts)
 	}
-	
-	// For live IMAP reading, also sync to global inbox if SyncLocal is set
+
+	// If LocalOnly is set, query the local archive first
+	if opts.LocalOnly {
+		return readLocalInbox(opts)
+	}
+
 	emails, err := ReadFromFolder(opts, "INBOX")
+	if isOfflineError(err) {
+		fmt.Printf("📴 Offline: showing the local archive\n")
+		return readLocalInbox(opts)
+	}
+
+	// For live IMAP reading, also save to the local archive if SyncLocal is set
 	if err == nil && opts.SyncLocal {
-		// Auto-sync emails to global inbox
 		config, configErr := LoadConfig()
 		if configErr == nil && config.Email != "" {
-			// Load existing inbox
-			inboxData, inboxErr := LoadGlobalInbox(config.Email)
-			if inboxErr == nil {
-				// Add new emails
-				inboxData.Emails = append(inboxData.Emails, emails...)
-				// Remove duplicates and sort
-				inboxData.Emails = removeDuplicateEmails(inboxData.Emails)
-				// Save
-				SaveGlobalInbox(config.Email, inboxData)
-				fmt.Printf("Synced %d emails to global inbox\n", len(emails))
+			if err := archiveEmails(config.Email, "INBOX", emails); err != nil {
+				fmt.Printf("Note: Could not save emails to the local archive: %v\n", err)
+			} else {
+				fmt.Printf("Synced %d emails to the local archive\n", len(emails))
 			}
 		}
 	}
@@ -84,6 +100,21 @@ func Read(opts ReadOptions) ([]*Email, error) {
 	return emails, err
 }
 
+// readLocalInbox reads INBOX from the local archive, or from the older
+// per-email files when there's no archive
+func readLocalInbox(opts ReadOptions) ([]*Email, error) {
+	config, err := LoadConfig()
+	if err == nil && config.Email != "" {
+		emails, err := GetEmailsFromInbox(config.Email, opts)
+		if err == nil {
+			fmt.Printf("Read %d emails from the local archive\n", len(emails))
+			return emails, nil
+		}
+	}
+	// Fallback to old local storage method
+	return readFromLocalStorage(opts)
+}
+
 // ReadFromFolder reads emails from a specific IMAP folder
 func ReadFromFolder(opts ReadOptions, folder string) ([]*Email, error) {
 	// If local only, read from local storage
@@ -113,7 +144,7 @@ func ReadFromFolder(opts ReadOptions, folder string) ([]*Email, error) {
 		c, err = client.Dial(fmt.Sprintf("%s:%d", imapHost, imapPort))
 	}
 	if err != nil {
-		return nil, fmt.Errorf("READ_IMAP_CONNECTION_ERROR: Failed to connect to IMAP server %s:%d. This could be due to: (1) Network connectivity issues, (2) Incorrect server settings, (3) Firewall blocking connection, (4) Server temporarily unavailable. Original error: %v", imapHost, imapPort, err)
+		return nil, fmt.Errorf("READ_IMAP_CONNECTION_ERROR: Failed to connect to IMAP server %s:%d. This could be due to: (1) Network connectivity issues, (2) Incorrect server settings, (3) Firewall blocking connection, (4) Server temporarily unavailable. Original error: %w", imapHost, imapPort, err)
 	}
 	defer c.Logout()
 
@@ -202,61 +233,48 @@ func ReadFromFolder(opts ReadOptions, folder string) ([]*Email, error) {
 		criteria.Since = opts.Since
 	}
 
-	// Search for messages
-	ids, err := c.Search(criteria)
+	// Search for messages, with as much of the query as the server can run
+	ids, exact, err := searchMessages(c, criteria, opts.Query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search messages: %v", err)
 	}
 
-	// Limit results
-	if opts.Limit > 0 && len(ids) > opts.Limit {
-		// Get the most recent messages
-		ids = ids[len(ids)-opts.Limit:]
-	}
-
-	if len(ids) == 0 {
-		return []*Email{}, nil
+	var emails []*Email
+	if !exact {
+		emails, err = fetchMatchingEmails(c, ids, opts.Query, opts, folder)
+	} else {
+		// Skip the newest matches for later pages, then limit results
+		if opts.Offset > 0 {
+			if opts.Offset >= len(ids) {
+				ids = nil
+			} else {
+				ids = ids[:len(ids)-opts.Offset]
+			}
+		}
+		if opts.Limit > 0 && len(ids) > opts.Limit {
+			// Get the most recent messages
+			ids = ids[len(ids)-opts.Limit:]
+		}
+		emails, err = fetchEmails(c, ids, opts, folder)
 	}
-
-	// Create sequence set
-	seqSet := new(imap.SeqSet)
-	for i := len(ids) - 1; i >= 0; i-- {
-		seqSet.AddNum(ids[i])
+	if err != nil {
+		return nil, err
 	}
 
-	// Fetch messages
-	messages := make(chan *imap.Message, len(ids))
-	section := &imap.BodySectionName{}
-	done := make(chan error, 1)
-	go func() {
-		done <- c.Fetch(seqSet, []imap.FetchItem{imap.FetchEnvelope, imap.FetchFlags, section.FetchItem()}, messages)
-	}()
-
-	emails := make([]*Email, 0, len(ids))
-	for msg := range messages {
-		email, err := parseMessageWithOptions(msg, section, opts.DownloadAttach)
-		if err != nil {
-			continue
-		}
-		// Save attachments to disk if directory specified
-		if opts.DownloadAttach && opts.AttachmentDir != "" && len(email.AttachmentData) > 0 {
+	// Save attachments to disk if directory specified, once the query and
+	// paging have settled which emails were asked for
+	if opts.DownloadAttach && opts.AttachmentDir != "" {
+		for _, email := range emails {
+			if len(email.AttachmentData) == 0 {
+				continue
+			}
 			if err := saveAttachmentsToDisk(email, opts.AttachmentDir); err != nil {
 				// Log error but don't fail the read
 				fmt.Printf("Note: Could not save attachments: %v\n", err)
 			}
 		}
-		emails = append(emails, email)
-	}
-
-	if err := <-done; err != nil {
-		return nil, fmt.Errorf("failed to fetch messages: %v", err)
 	}
 
-	// Reverse to get newest first
-	for i, j := 0, len(emails)-1; i < j; i, j = i+1, j-1 {
-		emails[i], emails[j] = emails[j], emails[i]
-	}
-	
 	// Save to local storage if requested
 	if opts.SyncLocal {
 		for _, email := range emails {
@@ -281,35 +299,16 @@ func parseMessageWithOptions(msg *imap.Message, section *imap.BodySectionName, d
 
 	email := &Email{
 		ID:             msg.SeqNum,
+		UID:            msg.Uid,
+		Flags:          msg.Flags,
+		Size:           int64(msg.Size),
 		AttachmentData: make(map[string][]byte),
+		AttachmentMeta: make(map[string]AttachmentMeta),
 	}
 
 	// Parse envelope
 	if msg.Envelope != nil {
-		email.Subject = msg.Envelope.Subject
-		email.Date = msg.Envelope.Date
-		email.MessageID = msg.Envelope.MessageId
-		email.InReplyTo = msg.Envelope.InReplyTo
-
-		// Parse From
-		if len(msg.Envelope.From) > 0 {
-			addr := msg.Envelope.From[0]
-			if addr.PersonalName != "" {
-				email.From = fmt.Sprintf("%s <%s@%s>", addr.PersonalName, addr.MailboxName, addr.HostName)
-			} else {
-				email.From = fmt.Sprintf("%s@%s", addr.MailboxName, addr.HostName)
-			}
-		}
-
-		// Parse To
-		email.To = make([]string, 0, len(msg.Envelope.To))
-		for _, addr := range msg.Envelope.To {
-			if addr.PersonalName != "" {
-				email.To = append(email.To, fmt.Sprintf("%s <%s@%s>", addr.PersonalName, addr.MailboxName, addr.HostName))
-			} else {
-				email.To = append(email.To, fmt.Sprintf("%s@%s", addr.MailboxName, addr.HostName))
-			}
-		}
+		applyEnvelope(email, msg.Envelope)
 	}
 
 	// Parse body
@@ -318,10 +317,22 @@ func parseMessageWithOptions(msg *imap.Message, section *imap.BodySectionName, d
 		return email, nil
 	}
 
-	mr, err := mail.CreateReader(r)
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return email, nil
+	}
+	mr, err := mail.CreateReader(bytes.NewReader(raw))
 	if err != nil {
 		return email, nil
 	}
+	email.Headers = headerValues(mr.Header)
+	email.Auth = AnalyzeMessageAuth(raw, defaultDKIMKeys())
+
+	// Delivery status notifications are multipart/report (RFC 3464)
+	var report *DeliveryReport
+	if mediaType, params, _ := mr.Header.ContentType(); mediaType == "multipart/report" && strings.EqualFold(params["report-type"], "delivery-status") {
+		report = &DeliveryReport{}
+	}
 
 	// Process message parts
 	for {
@@ -336,33 +347,62 @@ func parseMessageWithOptions(msg *imap.Message, section *imap.BodySectionName, d
 		case *mail.InlineHeader:
 			// Read body
 			b, _ := io.ReadAll(p.Body)
-			contentType, _, _ := h.ContentType()
+			contentType, params, _ := h.ContentType()
 			
-			switch contentType {
-			case "text/plain":
+			switch {
+			case contentType == "text/plain" && strings.EqualFold(params["format"], "flowed"):
+				email.Body = decodeFlowed(string(b), strings.EqualFold(params["delsp"], "yes"))
+			case contentType == "text/plain":
 				email.Body = string(b)
-			case "text/html":
+			case contentType == "text/html":
 				email.BodyHTML = string(b)
+			case report != nil && isDeliveryStatusPart(contentType):
+				parseDeliveryStatus(b, report)
+			case report != nil && isReturnedMessagePart(contentType):
+				noteReturnedHeaders(bytes.NewReader(b), report)
 			}
 		case *mail.AttachmentHeader:
+			contentType, _, _ := h.ContentType()
+			var body io.Reader = p.Body
+			if report != nil && (isDeliveryStatusPart(contentType) || isReturnedMessagePart(contentType)) {
+				b, _ := io.ReadAll(p.Body)
+				if isDeliveryStatusPart(contentType) {
+					parseDeliveryStatus(b, report)
+				} else {
+					noteReturnedHeaders(bytes.NewReader(b), report)
+				}
+				body = bytes.NewReader(b)
+			}
+
+
 			// Get attachment filename
 			filename, _ := h.Filename()
 			if filename != "" {
 				email.Attachments = append(email.Attachments, filename)
-				// Read attachment data if requested
+				// Read attachment data if requested, otherwise just measure it
+				var size int64
 				if downloadAttachments {
-					data, err := io.ReadAll(p.Body)
+					data, err := io.ReadAll(body)
 					if err == nil {
 						email.AttachmentData[filename] = data
 					}
+					size = int64(len(data))
+				} else {
+					size, _ = io.Copy(io.Discard, body)
 				}
+				email.AttachmentMeta[filename] = AttachmentMeta{MIMEType: contentType, Size: size}
 			}
 		}
 	}
 
-	// If no plain text body, strip HTML tags from HTML body
+	if report != nil && len(report.Recipients) > 0 {
+		email.DeliveryReport = report
+	}
+
+	// If no plain text body, render the HTML body as text
 	if email.Body == "" && email.BodyHTML != "" {
-		email.Body = StripHTMLTags(email.BodyHTML)
+		email.Body = HTMLToText(email.BodyHTML, HTMLTextOptions{})
+		email.BodyFromHTML = true
 	} else if email.Body != "" && strings.Contains(email.Body, "<") {
 		// If the body contains HTML tags, strip them
 		email.Body = StripHTMLTags(email.Body)
@@ -371,117 +411,67 @@ func parseMessageWithOptions(msg *imap.Message, section *imap.BodySectionName, d
 	return email, nil
 }
 
-func StripHTMLTags(html string) string {
-	result := html
-	
-	// Handle common HTML elements with proper spacing
-	result = strings.ReplaceAll(result, "<br><br>", "\n\n")
-	result = strings.ReplaceAll(result, "<br/><br/>", "\n\n")
-	result = strings.ReplaceAll(result, "<br /><br />", "\n\n")
-	result = strings.ReplaceAll(result, "<br>", "\n")
-	result = strings.ReplaceAll(result, "<br/>", "\n")
-	result = strings.ReplaceAll(result, "<br />", "\n")
-	
-	// Handle paragraphs and divs
-	result = strings.ReplaceAll(result, "</p>", "\n\n")
-	result = strings.ReplaceAll(result, "<p>", "")
-	result = strings.ReplaceAll(result, "</div>", "\n")
-	result = strings.ReplaceAll(result, "<div>", "")
-	
-	// Handle list items
-	result = strings.ReplaceAll(result, "</li>", "\n")
-	result = strings.ReplaceAll(result, "<li>", "• ")
-	result = strings.ReplaceAll(result, "</ul>", "\n")
-	result = strings.ReplaceAll(result, "<ul>", "")
-	result = strings.ReplaceAll(result, "</ol>", "\n")
-	result = strings.ReplaceAll(result, "<ol>", "")
-	
-	// Handle headers
-	result = strings.ReplaceAll(result, "</h1>", "\n\n")
-	result = strings.ReplaceAll(result, "</h2>", "\n\n")
-	result = strings.ReplaceAll(result, "</h3>", "\n\n")
-	result = strings.ReplaceAll(result, "</h4>", "\n\n")
-	result = strings.ReplaceAll(result, "</h5>", "\n\n")
-	result = strings.ReplaceAll(result, "</h6>", "\n\n")
-	result = strings.ReplaceAll(result, "<h1>", "")
-	result = strings.ReplaceAll(result, "<h2>", "")
-	result = strings.ReplaceAll(result, "<h3>", "")
-	result = strings.ReplaceAll(result, "<h4>", "")
-	result = strings.ReplaceAll(result, "<h5>", "")
-	result = strings.ReplaceAll(result, "<h6>", "")
-	
-	// Remove all remaining tags
-	for strings.Contains(result, "<") && strings.Contains(result, ">") {
-		start := strings.Index(result, "<")
-		end := strings.Index(result[start:], ">")
-		if end == -1 {
-			break
-		}
-		result = result[:start] + result[start+end+1:]
+// applyEnvelope fills in the fields an IMAP envelope carries
+func applyEnvelope(email *Email, env *imap.Envelope) {
+	email.Subject = env.Subject
+	email.Date = env.Date
+	email.MessageID = env.MessageId
+	email.InReplyTo = env.InReplyTo
+
+	if len(env.From) > 0 {
+		email.From = formatEnvelopeAddress(env.From[0])
 	}
-	
-	// Clean up excessive whitespace while preserving paragraph breaks
-	lines := strings.Split(result, "\n")
-	cleanLines := make([]string, 0, len(lines))
-	previousLineEmpty := false
-	
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		
-		// Skip empty lines that follow other empty lines (no more than one empty line in a row)
-		if line == "" {
-			if !previousLineEmpty {
-				cleanLines = append(cleanLines, "")
-				previousLineEmpty = true
-			}
-		} else {
-			cleanLines = append(cleanLines, line)
-			previousLineEmpty = false
-		}
+	email.To = make([]string, 0, len(env.To))
+	for _, addr := range env.To {
+		email.To = append(email.To, formatEnvelopeAddress(addr))
 	}
-	
-	// Remove trailing empty lines
-	for len(cleanLines) > 0 && cleanLines[len(cleanLines)-1] == "" {
-		cleanLines = cleanLines[:len(cleanLines)-1]
+}
+
+func formatEnvelopeAddress(addr *imap.Address) string {
+	if addr.PersonalName != "" {
+		return fmt.Sprintf("%s <%s@%s>", addr.PersonalName, addr.MailboxName, addr.HostName)
 	}
-	
-	return strings.Join(cleanLines, "\n")
+	return fmt.Sprintf("%s@%s", addr.MailboxName, addr.HostName)
+}
+
+// StripHTMLTags converts HTML to plain text without wrapping
+func StripHTMLTags(html string) string {
+	return HTMLToText(html, HTMLTextOptions{})
 }
 
 func MarkAsRead(ids []uint32) error {
+	return MarkAsReadInFolder(ids, "INBOX")
+}
+
+// MarkAsReadInFolder sets the \Seen flag on the given IDs in a specific folder
+func MarkAsReadInFolder(ids []uint32, folder string) error {
+	return markAsRead(ids, false, folder)
+}
+
+// markAsRead is MarkAsReadInFolder for IDs that are UIDs when byUID is set
+func markAsRead(ids []uint32, byUID bool, folder string) error {
 	config, err := LoadConfig()
 	if err != nil {
 		return fmt.Errorf("failed to load config: %v", err)
 	}
 
-	// Get IMAP settings from provider
-	imapHost, imapPort, err := config.GetIMAPSettings()
-	if err != nil {
-		return fmt.Errorf("failed to get IMAP settings: %v", err)
+	queue := queueIfOffline
+	if byUID {
+		queue = queueUIDsIfOffline
 	}
-
-	// Connect to IMAP server
-	var c *client.Client
-	if imapPort == 993 {
-		tlsConfig := &tls.Config{ServerName: imapHost}
-		c, err = client.DialTLS(fmt.Sprintf("%s:%d", imapHost, imapPort), tlsConfig)
-	} else {
-		c, err = client.Dial(fmt.Sprintf("%s:%d", imapHost, imapPort))
+	c, err := connectOnline(config)
+	if queued, err := queue(config, err, &QueuedOp{Kind: OpMarkRead, Folder: folder}, ids); queued {
+		return err
 	}
 	if err != nil {
-		return fmt.Errorf("failed to connect to IMAP server: %v", err)
+		return err
 	}
 	defer c.Logout()
 
-	// Login
-	if err := c.Login(config.Email, config.Password); err != nil {
-		return fmt.Errorf("failed to login: %v", err)
-	}
-
-	// Select inbox
-	_, err = c.Select("INBOX", false)
+	// Select folder
+	_, err = c.Select(folder, false)
 	if err != nil {
-		return fmt.Errorf("failed to select inbox: %v", err)
+		return fmt.Errorf("failed to select %s: %v", folder, err)
 	}
 
 	// Create sequence set
@@ -491,15 +481,241 @@ func MarkAsRead(ids []uint32) error {
 	}
 
 	// Mark as read
+	store := c.Store
+	if byUID {
+		store = c.UidStore
+	}
 	item := imap.FormatFlagsOp(imap.AddFlags, true)
 	flags := []interface{}{imap.SeenFlag}
-	if err := c.Store(seqSet, item, flags, nil); err != nil {
+	if err := store(seqSet, item, flags, nil); err != nil {
 		return fmt.Errorf("failed to mark messages as read: %v", err)
 	}
 
 	return nil
 }
 
+// MoveEmails moves the given IDs from one folder to another, creating the target if needed
+func MoveEmails(ids []uint32, fromFolder, toFolder string) error {
+	return moveEmails(ids, false, fromFolder, toFolder)
+}
+
+// moveEmails is MoveEmails for IDs that are UIDs when byUID is set
+func moveEmails(ids []uint32, byUID bool, fromFolder, toFolder string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	config, err := LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %v", err)
+	}
+
+	queue := queueIfOffline
+	if byUID {
+		queue = queueUIDsIfOffline
+	}
+	c, err := connectOnline(config)
+	if queued, err := queue(config, err, &QueuedOp{Kind: OpMove, Folder: fromFolder, Target: toFolder}, ids); queued {
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	defer c.Logout()
+
+	if err := createFolderIfNotExists(c, toFolder); err != nil {
+		return fmt.Errorf("failed to create folder %s: %v", toFolder, err)
+	}
+
+	if _, err := c.Select(fromFolder, false); err != nil {
+		return fmt.Errorf("failed to select %s: %v", fromFolder, err)
+	}
+
+	seqSet := new(imap.SeqSet)
+	for _, id := range ids {
+		seqSet.AddNum(id)
+	}
+
+	move := c.Move
+	if byUID {
+		move = c.UidMove
+	}
+	if err := move(seqSet, toFolder); err != nil {
+		return fmt.Errorf("failed to move messages to %s: %v", toFolder, err)
+	}
+
+	return nil
+}
+
+// LabelEmails tags the given IDs in a folder with a label, stored as an IMAP keyword
+func LabelEmails(ids []uint32, folder, label string) error {
+	return labelEmails(ids, false, folder, label)
+}
+
+// labelEmails is LabelEmails for IDs that are UIDs when byUID is set
+func labelEmails(ids []uint32, byUID bool, folder, label string) error {
+	keyword, err := imapKeyword(label)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	config, err := LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %v", err)
+	}
+
+	queue := queueIfOffline
+	if byUID {
+		queue = queueUIDsIfOffline
+	}
+	c, err := connectOnline(config)
+	if queued, err := queue(config, err, &QueuedOp{Kind: OpLabel, Folder: folder, Target: keyword}, ids); queued {
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	defer c.Logout()
+
+	if _, err := c.Select(folder, false); err != nil {
+		return fmt.Errorf("failed to select %s: %v", folder, err)
+	}
+
+	seqSet := new(imap.SeqSet)
+	for _, id := range ids {
+		seqSet.AddNum(id)
+	}
+
+	store := c.Store
+	if byUID {
+		store = c.UidStore
+	}
+	item := imap.FormatFlagsOp(imap.AddFlags, true)
+	if err := store(seqSet, item, []interface{}{keyword}, nil); err != nil {
+		return fmt.Errorf("failed to label messages %q: %v", keyword, err)
+	}
+	return nil
+}
+
+// imapKeyword turns a label into an IMAP keyword, which can't contain
+// spaces or the characters IMAP reserves
+func imapKeyword(label string) (string, error) {
+	label = strings.TrimSpace(label)
+	if label == "" || strings.HasPrefix(label, "\\") {
+		return "", fmt.Errorf("invalid label %q", label)
+	}
+	keyword := strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || strings.ContainsRune(`(){%*"\]`, r) {
+			return '_'
+		}
+		return r
+	}, label)
+	return keyword, nil
+}
+
+// ArchiveEmails moves the given IDs out of a folder into the account's archive folder
+func ArchiveEmails(ids []uint32, fromFolder string) error {
+	return moveToArchive(ids, false, fromFolder)
+}
+
+// moveToArchive is ArchiveEmails for IDs that are UIDs when byUID is set
+func moveToArchive(ids []uint32, byUID bool, fromFolder string) error {
+	config, err := LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %v", err)
+	}
+
+	c, err := connectToIMAPServer(config)
+	if err != nil {
+		return err
+	}
+	archiveFolder, err := findArchiveFolder(c)
+	c.Logout()
+	if err != nil {
+		return err
+	}
+
+	return moveEmails(ids, byUID, fromFolder, archiveFolder)
+}
+
+// findArchiveFolder picks the server's \Archive mailbox, falling back to common names
+func findArchiveFolder(c *client.Client) (string, error) {
+	mailboxes := make(chan *imap.MailboxInfo, 20)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.List("", "*", mailboxes)
+	}()
+
+	var names []string
+	archive := ""
+	for m := range mailboxes {
+		names = append(names, m.Name)
+		for _, attr := range m.Attributes {
+			if attr == imap.ArchiveAttr && archive == "" {
+				archive = m.Name
+			}
+		}
+	}
+	if err := <-done; err != nil {
+		return "", fmt.Errorf("failed to list folders: %v", err)
+	}
+	if archive != "" {
+		return archive, nil
+	}
+
+	for _, candidate := range []string{"Archive", "[Gmail]/All Mail", "INBOX.Archive"} {
+		for _, name := range names {
+			if name == candidate {
+				return name, nil
+			}
+		}
+	}
+
+	// Nothing suitable exists yet; MoveEmails creates it
+	return "Archive", nil
+}
+
+// ListFolders returns the names of all folders on the IMAP server
+func ListFolders() ([]string, error) {
+	config, err := LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %v", err)
+	}
+
+	c, err := connectToIMAPServer(config)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Logout()
+
+	mailboxes := make(chan *imap.MailboxInfo, 20)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.List("", "*", mailboxes)
+	}()
+
+	var folders []string
+	for m := range mailboxes {
+		selectable := true
+		for _, attr := range m.Attributes {
+			if attr == imap.NoSelectAttr {
+				selectable = false
+			}
+		}
+		if selectable {
+			folders = append(folders, m.Name)
+		}
+	}
+	if err := <-done; err != nil {
+		return nil, fmt.Errorf("failed to list folders: %v", err)
+	}
+
+	return folders, nil
+}
+
 func DeleteEmails(ids []uint32) error {
 	return DeleteEmailsFromFolder(ids, "INBOX")
 }
@@ -516,6 +732,7 @@ func DeleteEmailsFromFolder(ids []uint32, folder string) error {
 		return fmt.Errorf("failed to load config: %v", err)
 	}
 
+
 	// Create wrapper for the config to implement the interface
 	wrapper := &core.ConfigWrapper{
 		Email:    config.Email,
@@ -524,8 +741,53 @@ func DeleteEmailsFromFolder(ids []uint32, folder string) error {
 		GetIMAPSettingsFunc: config.GetIMAPSettings,
 	}
 
-	// Use the new internal core delete functionality
-	return core.DeleteEmailsFromFolder(ids, folder, wrapper)
+	// Use the new internal core delete functionality, which connects itself
+	if !IsOffline() {
+		err = core.DeleteEmailsFromFolder(ids, folder, wrapper)
+	}
+	if queued, err := queueIfOffline(config, err, &QueuedOp{Kind: OpDelete, Folder: folder}, ids); queued {
+		return err
+	}
+	return err
+}
+
+// deleteEmailsByUID deletes the messages with these UIDs from a folder
+func deleteEmailsByUID(uids []uint32, folder string) error {
+	if len(uids) == 0 {
+		return nil
+	}
+
+	config, err := LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %v", err)
+	}
+
+	c, err := connectOnline(config)
+	if queued, err := queueUIDsIfOffline(config, err, &QueuedOp{Kind: OpDelete, Folder: folder}, uids); queued {
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	defer c.Logout()
+
+	if _, err := c.Select(folder, false); err != nil {
+		return fmt.Errorf("failed to select %s: %v", folder, err)
+	}
+
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(uids...)
+	item := imap.FormatFlagsOp(imap.AddFlags, true)
+	if err := c.UidStore(seqSet, item, []interface{}{imap.DeletedFlag}, nil); err != nil {
+		return fmt.Errorf("failed to mark messages for deletion: %v", err)
+	}
+	if expunged, err := expungeUIDs(c, uids); expunged || err != nil {
+		return err
+	}
+	if err := c.Expunge(nil); err != nil {
+		return fmt.Errorf("failed to expunge deleted messages: %v", err)
+	}
+	return nil
 }
 
 // readFromLocalStorage reads emails from the local .email/received directory
@@ -589,6 +851,9 @@ func readFromLocalStorage(opts ReadOptions) ([]*Email, error) {
 		if !opts.Since.IsZero() && email.Date.Before(opts.Since) {
 			continue
 		}
+		if opts.Query != nil && !opts.Query.Match(email) {
+			continue
+		}
 		
 		emails = append(emails, email)
 	}
@@ -619,6 +884,8 @@ func saveReceivedEmail(email *Email) error {
 		return fmt.Errorf("failed to get received directory: %v", err)
 	}
 	
+	sanitizeStoredEmail(email, LoadPrivacySettings())
+
 	// Create a SavedEmail struct
 	savedEmail := SavedEmail{
 		ID:          fmt.Sprintf("%d_%d", email.ID, email.Date.Unix()),
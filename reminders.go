@@ -0,0 +1,625 @@
+package mailos
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// SnoozeFolder holds snoozed messages until they are due back in INBOX
+const SnoozeFolder = "Snoozed"
+
+// defaultReminderHour is used when a reminder names a day but no time
+const defaultReminderHour = 9
+
+// SnoozedMessage is a message waiting in the Snoozed folder
+type SnoozedMessage struct {
+	MessageID string    `json:"message_id"`
+	Subject   string    `json:"subject"`
+	From      string    `json:"from,omitempty"`
+	Until     time.Time `json:"until"`
+	SnoozedAt time.Time `json:"snoozed_at"`
+}
+
+// Followup is a sent message to be reminded about if nobody replies
+type Followup struct {
+	ID         int64     `json:"id"`
+	MessageID  string    `json:"message_id"`
+	Subject    string    `json:"subject"`
+	Recipients []string  `json:"recipients"`
+	SentAt     time.Time `json:"sent_at"`
+	RemindAt   time.Time `json:"remind_at"`
+	RepliedAt  time.Time `json:"replied_at,omitempty"`
+	ReplyFrom  string    `json:"reply_from,omitempty"`
+}
+
+// Due reports whether the reminder is up and nobody has replied
+func (f *Followup) Due(now time.Time) bool {
+	return f.RepliedAt.IsZero() && !now.Before(f.RemindAt)
+}
+
+var reminderDurationPattern = regexp.MustCompile(`(\d+)\s*(w|d|h|m)`)
+
+// ParseReminderDuration parses durations such as "3d", "1w", "12h" or "1d12h".
+// Days and weeks aren't supported by time.ParseDuration.
+func ParseReminderDuration(value string) (time.Duration, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	matches := reminderDurationPattern.FindAllStringSubmatch(value, -1)
+	if len(matches) == 0 || strings.TrimSpace(reminderDurationPattern.ReplaceAllString(value, "")) != "" {
+		return 0, fmt.Errorf("invalid duration %q (use e.g. 3d, 1w, 12h or 30m)", value)
+	}
+
+	var total time.Duration
+	for _, m := range matches {
+		n, _ := strconv.Atoi(m[1])
+		unit := map[string]time.Duration{"w": 7 * 24 * time.Hour, "d": 24 * time.Hour, "h": time.Hour, "m": time.Minute}[m[2]]
+		total += time.Duration(n) * unit
+	}
+	if total <= 0 {
+		return 0, fmt.Errorf("duration %q must be positive", value)
+	}
+	return total, nil
+}
+
+var clockPattern = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?\s*(am|pm)?$`)
+
+// parseClock parses "9am", "9:30 pm" or "14:00" into an hour and minute
+func parseClock(value string) (int, int, bool) {
+	m := clockPattern.FindStringSubmatch(value)
+	if m == nil || (m[2] == "" && m[3] == "") {
+		return 0, 0, false
+	}
+	hour, _ := strconv.Atoi(m[1])
+	minute, _ := strconv.Atoi(m[2])
+	switch {
+	case m[3] != "" && (hour < 1 || hour > 12):
+		return 0, 0, false
+	case m[3] == "pm" && hour != 12:
+		hour += 12
+	case m[3] == "am" && hour == 12:
+		hour = 0
+	}
+	if hour > 23 || minute > 59 {
+		return 0, 0, false
+	}
+	return hour, minute, true
+}
+
+// ParseReminderTime parses when a snooze ends: a duration ("3d"), a day
+// ("tomorrow", "monday", "next week") with an optional time ("monday 9am"),
+// a time alone ("5pm", today or tomorrow) or a date ("2024-03-01 14:00").
+func ParseReminderTime(value string, now time.Time) (time.Time, error) {
+	value = strings.ToLower(strings.Join(strings.Fields(value), " "))
+	if value == "" {
+		return time.Time{}, fmt.Errorf("no time given")
+	}
+	if d, err := ParseReminderDuration(value); err == nil {
+		return now.Add(d), nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, now.Location()); err == nil {
+			if layout == "2006-01-02" {
+				t = t.Add(defaultReminderHour * time.Hour)
+			}
+			return t, nil
+		}
+	}
+
+	// A time alone means the next time the clock shows it
+	if hour, minute, ok := parseClock(value); ok {
+		t := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+		if !t.After(now) {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+
+	day, clock := value, ""
+	if i := strings.LastIndex(value, " "); i > 0 {
+		if _, _, ok := parseClock(value[i+1:]); ok {
+			day, clock = value[:i], value[i+1:]
+		}
+	}
+	if clock == "" {
+		// "monday 9 am"
+		if fields := strings.Fields(value); len(fields) > 2 {
+			last := strings.Join(fields[len(fields)-2:], "")
+			if _, _, ok := parseClock(last); ok {
+				day, clock = strings.Join(fields[:len(fields)-2], " "), last
+			}
+		}
+	}
+
+	date, err := parseReminderDay(day, now)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to parse time %q: use e.g. \"monday 9am\", \"tomorrow\", \"3d\" or \"2024-03-01 14:00\"", value)
+	}
+	hour, minute := defaultReminderHour, 0
+	if clock != "" {
+		hour, minute, _ = parseClock(clock)
+	}
+	return time.Date(date.Year(), date.Month(), date.Day(), hour, minute, 0, 0, now.Location()), nil
+}
+
+// parseReminderDay resolves a day name relative to now
+func parseReminderDay(day string, now time.Time) (time.Time, error) {
+	switch day {
+	case "today":
+		return now, nil
+	case "tomorrow":
+		return now.AddDate(0, 0, 1), nil
+	case "next week":
+		day = "monday"
+	}
+	day = strings.TrimPrefix(day, "next ")
+	for i := time.Sunday; i <= time.Saturday; i++ {
+		name := strings.ToLower(i.String())
+		if day == name || day == name[:3] {
+			// Always the next one, a week out when it's today
+			ahead := (int(i) - int(now.Weekday()) + 7) % 7
+			if ahead == 0 {
+				ahead = 7
+			}
+			return now.AddDate(0, 0, ahead), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown day %q", day)
+}
+
+// SnoozeMessage records a message moved to the Snoozed folder
+func (dm *DatabaseManager) SnoozeMessage(m *SnoozedMessage) error {
+	_, err := dm.db.Exec(`
+		INSERT OR REPLACE INTO snoozed (message_id, subject, from_address, until, snoozed_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, m.MessageID, m.Subject, m.From, m.Until, m.SnoozedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record snooze: %v", err)
+	}
+	return nil
+}
+
+// ListSnoozed returns snoozed messages, the soonest due first
+func (dm *DatabaseManager) ListSnoozed() ([]*SnoozedMessage, error) {
+	rows, err := dm.db.Query(`
+		SELECT message_id, COALESCE(subject, ''), COALESCE(from_address, ''), until, snoozed_at
+		FROM snoozed
+		ORDER BY until
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query snoozed messages: %v", err)
+	}
+	defer rows.Close()
+
+	var snoozed []*SnoozedMessage
+	for rows.Next() {
+		m := &SnoozedMessage{}
+		if err := rows.Scan(&m.MessageID, &m.Subject, &m.From, &m.Until, &m.SnoozedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan snoozed message: %v", err)
+		}
+		snoozed = append(snoozed, m)
+	}
+	return snoozed, rows.Err()
+}
+
+func (dm *DatabaseManager) removeSnoozed(messageID string) error {
+	_, err := dm.db.Exec(`DELETE FROM snoozed WHERE message_id = ?`, messageID)
+	return err
+}
+
+// TrackFollowup starts waiting for a reply to a sent message
+func (dm *DatabaseManager) TrackFollowup(f *Followup) error {
+	f.MessageID = strings.Trim(f.MessageID, "<>")
+	recipients, _ := json.Marshal(f.Recipients)
+	result, err := dm.db.Exec(`
+		INSERT OR REPLACE INTO followups (message_id, subject, recipients, sent_at, remind_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, f.MessageID, f.Subject, string(recipients), f.SentAt, f.RemindAt)
+	if err != nil {
+		return fmt.Errorf("failed to record follow-up: %v", err)
+	}
+	f.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// ListFollowups returns tracked follow-ups, the soonest due first
+func (dm *DatabaseManager) ListFollowups() ([]*Followup, error) {
+	rows, err := dm.db.Query(`
+		SELECT id, message_id, COALESCE(subject, ''), COALESCE(recipients, '[]'), sent_at, remind_at,
+			replied_at, COALESCE(reply_from, '')
+		FROM followups
+		ORDER BY remind_at
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query follow-ups: %v", err)
+	}
+	defer rows.Close()
+
+	var followups []*Followup
+	for rows.Next() {
+		f := &Followup{}
+		var recipients string
+		var repliedAt sql.NullTime
+		if err := rows.Scan(&f.ID, &f.MessageID, &f.Subject, &recipients, &f.SentAt, &f.RemindAt,
+			&repliedAt, &f.ReplyFrom); err != nil {
+			return nil, fmt.Errorf("failed to scan follow-up: %v", err)
+		}
+		json.Unmarshal([]byte(recipients), &f.Recipients)
+		if repliedAt.Valid {
+			f.RepliedAt = repliedAt.Time
+		}
+		followups = append(followups, f)
+	}
+	return followups, rows.Err()
+}
+
+// DismissFollowup stops tracking a follow-up
+func (dm *DatabaseManager) DismissFollowup(id int64) error {
+	result, err := dm.db.Exec(`DELETE FROM followups WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to dismiss follow-up: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("no follow-up %d", id)
+	}
+	return nil
+}
+
+// MatchFollowupReplies marks follow-ups answered by the given emails, matching
+// their In-Reply-To and References headers against the sent Message-IDs.
+// Messages from the account itself, such as a nudge in the same thread, don't
+// count as replies.
+func (dm *DatabaseManager) MatchFollowupReplies(emails []*Email) (int, error) {
+	matched := 0
+	for _, email := range emails {
+		if strings.EqualFold(extractEmailAddress(email.From), dm.accountEmail) {
+			continue
+		}
+		repliedAt := email.Date
+		if repliedAt.IsZero() {
+			repliedAt = time.Now()
+		}
+		for _, messageID := range referencedMessageIDs(email) {
+			result, err := dm.db.Exec(`
+				UPDATE followups SET replied_at = ?, reply_from = ?
+				WHERE message_id = ? AND replied_at IS NULL
+			`, repliedAt, email.From, messageID)
+			if err != nil {
+				return matched, fmt.Errorf("failed to record reply: %v", err)
+			}
+			n, _ := result.RowsAffected()
+			matched += int(n)
+		}
+	}
+	return matched, nil
+}
+
+// referencedMessageIDs returns the Message-IDs an email replies to, without brackets
+func referencedMessageIDs(email *Email) []string {
+	refs := []string{email.InReplyTo}
+	for _, header := range []string{"In-Reply-To", "References"} {
+		refs = append(refs, email.Headers[header]...)
+	}
+
+	seen := make(map[string]bool)
+	var ids []string
+	for _, ref := range refs {
+		for _, id := range strings.Fields(ref) {
+			id = strings.Trim(id, "<>,")
+			if id != "" && !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// returnDueSnoozes moves snoozed messages that are due back to INBOX.
+// Messages no longer in the Snoozed folder were moved or deleted elsewhere,
+// so they are forgotten.
+func returnDueSnoozes(dm *DatabaseManager, server opsServer, now time.Time) (int, error) {
+	snoozed, err := dm.ListSnoozed()
+	if err != nil {
+		return 0, err
+	}
+	var due []string
+	for _, m := range snoozed {
+		if !now.Before(m.Until) {
+			due = append(due, m.MessageID)
+		}
+	}
+	if len(due) == 0 {
+		return 0, nil
+	}
+
+	found, err := server.Find(SnoozeFolder, due)
+	if err != nil {
+		return 0, err
+	}
+	var uids []uint32
+	for _, messageID := range due {
+		if message, ok := found[messageID]; ok {
+			uids = append(uids, message.UID)
+		}
+	}
+	if len(uids) > 0 {
+		if err := server.Move(SnoozeFolder, uids, "INBOX"); err != nil {
+			return 0, fmt.Errorf("failed to return snoozed messages: %v", err)
+		}
+	}
+	for _, messageID := range due {
+		if err := dm.removeSnoozed(messageID); err != nil {
+			return len(uids), err
+		}
+	}
+	return len(uids), nil
+}
+
+// SnoozeEmails moves INBOX messages to the Snoozed folder until the given
+// time. The next sync after that moves them back. Offline, the move is
+// queued and the messages are looked up in the local archive.
+func SnoozeEmails(config *Config, ids []uint32, until time.Time) ([]*SnoozedMessage, error) {
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no messages to snooze")
+	}
+	if !until.After(time.Now()) {
+		return nil, fmt.Errorf("snooze time %s is in the past", until.Format("Mon Jan 2 3:04 PM"))
+	}
+
+	op := &QueuedOp{Kind: OpMove, Folder: "INBOX", Target: SnoozeFolder}
+	snoozed, err := moveToSnoozed(config, ids)
+	if queued, err := queueIfOffline(config, err, op, ids); queued {
+		if err != nil {
+			return nil, err
+		}
+		snoozed = nil
+		for i, messageID := range op.MessageIDs {
+			snoozed = append(snoozed, &SnoozedMessage{MessageID: messageID, Subject: op.Subjects[i]})
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	dm, err := NewDatabaseManager(config.Email)
+	if err != nil {
+		return nil, err
+	}
+	defer dm.Close()
+
+	for _, m := range snoozed {
+		m.Until, m.SnoozedAt = until, time.Now()
+		if err := dm.SnoozeMessage(m); err != nil {
+			return nil, err
+		}
+	}
+	return snoozed, nil
+}
+
+// moveToSnoozed looks up the messages' Message-IDs, which identify them once
+// moved, and moves them out of INBOX
+func moveToSnoozed(config *Config, ids []uint32) ([]*SnoozedMessage, error) {
+	c, err := connectOnline(config)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Logout()
+
+	if err := createFolderIfNotExists(c, SnoozeFolder); err != nil {
+		return nil, fmt.Errorf("failed to create folder %s: %v", SnoozeFolder, err)
+	}
+	if _, err := c.Select("INBOX", false); err != nil {
+		return nil, fmt.Errorf("failed to select INBOX: %v", err)
+	}
+
+	seqSet := new(imap.SeqSet)
+	for _, id := range ids {
+		seqSet.AddNum(id)
+	}
+	messages := make(chan *imap.Message, len(ids))
+	if err := c.Fetch(seqSet, []imap.FetchItem{imap.FetchEnvelope}, messages); err != nil {
+		return nil, fmt.Errorf("failed to fetch messages: %v", err)
+	}
+
+	bySeq := make(map[uint32]*SnoozedMessage)
+	for msg := range messages {
+		if msg.Envelope == nil {
+			continue
+		}
+		m := &SnoozedMessage{MessageID: msg.Envelope.MessageId, Subject: msg.Envelope.Subject}
+		if len(msg.Envelope.From) > 0 {
+			m.From = msg.Envelope.From[0].Address()
+		}
+		bySeq[msg.SeqNum] = m
+	}
+
+	var snoozed []*SnoozedMessage
+	for _, id := range ids {
+		m, ok := bySeq[id]
+		if !ok {
+			return nil, fmt.Errorf("message %d not found in INBOX", id)
+		}
+		if m.MessageID == "" {
+			return nil, fmt.Errorf("message %d has no Message-ID, so it couldn't be found again to return it", id)
+		}
+		snoozed = append(snoozed, m)
+	}
+
+	if err := c.Move(seqSet, SnoozeFolder); err != nil {
+		return nil, fmt.Errorf("failed to move messages to %s: %v", SnoozeFolder, err)
+	}
+	return snoozed, nil
+}
+
+// processDueSnoozes returns due snoozed messages over an open connection.
+// It runs during sync, before INBOX is listed.
+func processDueSnoozes(config *Config, c *client.Client) {
+	dm, err := NewDatabaseManager(config.Email)
+	if err != nil {
+		fmt.Printf("Warning: failed to return snoozed messages: %v\n", err)
+		return
+	}
+	defer dm.Close()
+
+	returned, err := returnDueSnoozes(dm, &imapOpsServer{c: c}, time.Now())
+	if err != nil {
+		fmt.Printf("Warning: failed to return snoozed messages: %v\n", err)
+	} else if returned > 0 {
+		fmt.Printf("⏰ %d snoozed message(s) returned to INBOX\n", returned)
+	}
+}
+
+// recordFollowupReplies matches newly fetched emails against follow-ups and
+// mentions the ones that are due
+func recordFollowupReplies(accountEmail string, emails []*Email) {
+	dm, err := NewDatabaseManager(accountEmail)
+	if err != nil {
+		fmt.Printf("Warning: failed to check follow-ups: %v\n", err)
+		return
+	}
+	defer dm.Close()
+
+	if replied, err := dm.MatchFollowupReplies(emails); err != nil {
+		fmt.Printf("Warning: failed to check follow-ups: %v\n", err)
+	} else if replied > 0 {
+		fmt.Printf("✓ %d message(s) awaiting a reply got one\n", replied)
+	}
+
+	followups, err := dm.ListFollowups()
+	if err != nil {
+		return
+	}
+	due := 0
+	for _, f := range followups {
+		if f.Due(time.Now()) {
+			due++
+		}
+	}
+	if due > 0 {
+		fmt.Printf("🔔 %d sent message(s) still have no reply; see 'mailos followups'\n", due)
+	}
+}
+
+// TrackFollowup records a reminder for a sent message in the account's database
+func TrackFollowup(accountEmail string, f *Followup) error {
+	dm, err := NewDatabaseManager(accountEmail)
+	if err != nil {
+		return err
+	}
+	defer dm.Close()
+
+	return dm.TrackFollowup(f)
+}
+
+// ListFollowups returns the account's tracked follow-ups
+func ListFollowups(accountEmail string) ([]*Followup, error) {
+	dm, err := NewDatabaseManager(accountEmail)
+	if err != nil {
+		return nil, err
+	}
+	defer dm.Close()
+
+	return dm.ListFollowups()
+}
+
+// DismissFollowup stops tracking one of the account's follow-ups
+func DismissFollowup(accountEmail string, id int64) error {
+	dm, err := NewDatabaseManager(accountEmail)
+	if err != nil {
+		return err
+	}
+	defer dm.Close()
+
+	return dm.DismissFollowup(id)
+}
+
+// ListSnoozed returns the account's snoozed messages
+func ListSnoozed(accountEmail string) ([]*SnoozedMessage, error) {
+	dm, err := NewDatabaseManager(accountEmail)
+	if err != nil {
+		return nil, err
+	}
+	defer dm.Close()
+
+	return dm.ListSnoozed()
+}
+
+// FormatFollowups lists follow-ups that are due, then the ones still waiting.
+// Answered follow-ups are only listed when all is set.
+func FormatFollowups(followups []*Followup, now time.Time, all bool) string {
+	var due, waiting, replied []*Followup
+	for _, f := range followups {
+		switch {
+		case !f.RepliedAt.IsZero():
+			replied = append(replied, f)
+		case f.Due(now):
+			due = append(due, f)
+		default:
+			waiting = append(waiting, f)
+		}
+	}
+
+	var out strings.Builder
+	if len(due) == 0 {
+		out.WriteString("✓ No follow-ups due\n")
+	} else {
+		out.WriteString(fmt.Sprintf("🔔 %d sent message(s) with no reply:\n", len(due)))
+		for _, f := range due {
+			out.WriteString(fmt.Sprintf("   #%d  %q to %s, sent %s (%d day(s) ago)\n", f.ID, f.Subject,
+				strings.Join(f.Recipients, ", "), f.SentAt.Format("Jan 2"), int(now.Sub(f.SentAt).Hours()/24)))
+		}
+		out.WriteString("   Dismiss one with 'mailos followups --dismiss <#>'\n")
+	}
+	if len(waiting) > 0 {
+		out.WriteString(fmt.Sprintf("⏳ %d waiting:\n", len(waiting)))
+		for _, f := range waiting {
+			out.WriteString(fmt.Sprintf("   #%d  %q to %s, reminder %s\n", f.ID, f.Subject,
+				strings.Join(f.Recipients, ", "), f.RemindAt.Format("Mon Jan 2 3:04 PM")))
+		}
+	}
+	if all && len(replied) > 0 {
+		out.WriteString(fmt.Sprintf("✓ %d replied:\n", len(replied)))
+		for _, f := range replied {
+			out.WriteString(fmt.Sprintf("   #%d  %q, reply from %s on %s\n", f.ID, f.Subject, f.ReplyFrom, f.RepliedAt.Format("Jan 2")))
+		}
+	}
+	return out.String()
+}
+
+// FormatSnoozed lists snoozed messages and when they return
+func FormatSnoozed(snoozed []*SnoozedMessage) string {
+	if len(snoozed) == 0 {
+		return "✓ No snoozed messages\n"
+	}
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("💤 %d snoozed message(s):\n", len(snoozed)))
+	for _, m := range snoozed {
+		line := fmt.Sprintf("   %s  %q", m.Until.Format("Mon Jan 2 3:04 PM"), m.Subject)
+		if m.From != "" {
+			line += " from " + m.From
+		}
+		out.WriteString(line + "\n")
+	}
+	return out.String()
+}
+
+// WatchSync syncs every interval until interrupted, so snoozed messages and
+// follow-up reminders come due without running sync by hand
+func WatchSync(opts SyncOptions, interval time.Duration) error {
+	if interval < time.Minute {
+		return fmt.Errorf("watch interval must be at least a minute")
+	}
+	for {
+		if err := SyncEmails(opts); err != nil {
+			fmt.Printf("⚠️  Sync failed: %v\n", err)
+		}
+		fmt.Printf("⏳ Next sync at %s (Ctrl+C to stop)\n", time.Now().Add(interval).Format("3:04 PM"))
+		time.Sleep(interval)
+	}
+}
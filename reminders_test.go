@@ -0,0 +1,180 @@
+package mailos
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseReminderTime(t *testing.T) {
+	// A Wednesday afternoon
+	now := time.Date(2024, 3, 6, 15, 0, 0, 0, time.UTC)
+	tests := map[string]time.Time{
+		"monday 9am":       time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC),
+		"Monday 9 AM":      time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC),
+		"next fri 5:30pm":  time.Date(2024, 3, 8, 17, 30, 0, 0, time.UTC),
+		"wednesday":        time.Date(2024, 3, 13, 9, 0, 0, 0, time.UTC),
+		"tomorrow":         time.Date(2024, 3, 7, 9, 0, 0, 0, time.UTC),
+		"tomorrow 14:00":   time.Date(2024, 3, 7, 14, 0, 0, 0, time.UTC),
+		"today 6pm":        time.Date(2024, 3, 6, 18, 0, 0, 0, time.UTC),
+		"next week":        time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC),
+		"5pm":              time.Date(2024, 3, 6, 17, 0, 0, 0, time.UTC),
+		"9am":              time.Date(2024, 3, 7, 9, 0, 0, 0, time.UTC),
+		"12am":             time.Date(2024, 3, 7, 0, 0, 0, 0, time.UTC),
+		"3d":               now.Add(72 * time.Hour),
+		"1d12h":            now.Add(36 * time.Hour),
+		"2024-04-01":       time.Date(2024, 4, 1, 9, 0, 0, 0, time.UTC),
+		"2024-04-01 14:30": time.Date(2024, 4, 1, 14, 30, 0, 0, time.UTC),
+	}
+	for value, want := range tests {
+		got, err := ParseReminderTime(value, now)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("ParseReminderTime(%q) = %v, %v; want %v", value, got, err, want)
+		}
+	}
+
+	for _, value := range []string{"", "someday", "monday 25pm", "13pm", "3x"} {
+		if got, err := ParseReminderTime(value, now); err == nil {
+			t.Errorf("Expected %q rejected, got %v", value, got)
+		}
+	}
+}
+
+func TestParseReminderDuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"3d":  72 * time.Hour,
+		"1w":  7 * 24 * time.Hour,
+		"12h": 12 * time.Hour,
+		"30m": 30 * time.Minute,
+	}
+	for value, want := range tests {
+		if got, err := ParseReminderDuration(value); err != nil || got != want {
+			t.Errorf("ParseReminderDuration(%q) = %v, %v; want %v", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"", "3", "0d", "3 days", "d3"} {
+		if _, err := ParseReminderDuration(value); err == nil {
+			t.Errorf("Expected %q rejected", value)
+		}
+	}
+}
+
+func TestFollowups(t *testing.T) {
+	tmpDir := setupTestGroups(t)
+	defer cleanupTestGroups(tmpDir)
+
+	dm, err := NewDatabaseManager("me@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dm.Close()
+
+	sent := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	for _, f := range []*Followup{
+		{MessageID: "<proposal@example.com>", Subject: "Proposal", Recipients: []string{"client@example.org"}, SentAt: sent, RemindAt: sent.AddDate(0, 0, 3)},
+		{MessageID: "<invoice@example.com>", Subject: "Invoice", Recipients: []string{"billing@example.org"}, SentAt: sent, RemindAt: sent.AddDate(0, 0, 3)},
+		{MessageID: "<later@example.com>", Subject: "Later", Recipients: []string{"a@example.org"}, SentAt: sent, RemindAt: sent.AddDate(0, 0, 30)},
+	} {
+		if err := dm.TrackFollowup(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	replies := []*Email{
+		// Our own nudge in the thread isn't a reply
+		{From: "Me <me@example.com>", InReplyTo: "<invoice@example.com>"},
+		// A reply further down the thread only names the message in References
+		{From: "Client <client@example.org>", Date: sent.AddDate(0, 0, 1), InReplyTo: "<other@example.org>",
+			Headers: map[string][]string{"References": {"<proposal@example.com> <other@example.org>"}}},
+		{From: "Unrelated <x@example.net>", InReplyTo: "<unknown@example.com>"},
+	}
+	matched, err := dm.MatchFollowupReplies(replies)
+	if err != nil || matched != 1 {
+		t.Fatalf("Expected one reply matched, got %d, %v", matched, err)
+	}
+	// Already answered follow-ups aren't matched twice
+	if again, _ := dm.MatchFollowupReplies(replies); again != 0 {
+		t.Errorf("Expected no new matches, got %d", again)
+	}
+
+	followups, err := dm.ListFollowups()
+	if err != nil || len(followups) != 3 {
+		t.Fatalf("Unexpected follow-ups: %+v, %v", followups, err)
+	}
+	if followups[0].MessageID != "proposal@example.com" || followups[0].ReplyFrom != "Client <client@example.org>" || !followups[0].RepliedAt.Equal(sent.AddDate(0, 0, 1)) {
+		t.Errorf("Expected the proposal answered, got %+v", followups[0])
+	}
+
+	now := sent.AddDate(0, 0, 5)
+	out := FormatFollowups(followups, now, false)
+	if !strings.Contains(out, "1 sent message(s) with no reply") || !strings.Contains(out, `"Invoice" to billing@example.org, sent Mar 1 (5 day(s) ago)`) {
+		t.Errorf("Unexpected output:\n%s", out)
+	}
+	if !strings.Contains(out, "1 waiting") || strings.Contains(out, "Proposal") {
+		t.Errorf("Expected the answered follow-up hidden, got:\n%s", out)
+	}
+	if out := FormatFollowups(followups, now, true); !strings.Contains(out, `"Proposal", reply from Client <client@example.org>`) {
+		t.Errorf("Expected answered follow-ups with --all, got:\n%s", out)
+	}
+
+	if err := dm.DismissFollowup(followups[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := dm.DismissFollowup(followups[1].ID); err == nil {
+		t.Errorf("Expected dismissing a missing follow-up to fail")
+	}
+}
+
+func TestReturnDueSnoozes(t *testing.T) {
+	tmpDir := setupTestGroups(t)
+	defer cleanupTestGroups(tmpDir)
+
+	dm, err := NewDatabaseManager("me@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dm.Close()
+
+	now := time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC)
+	for _, m := range []*SnoozedMessage{
+		{MessageID: "<due@example.org>", Subject: "Due", Until: now},
+		{MessageID: "<deleted@example.org>", Subject: "Deleted meanwhile", Until: now.Add(-time.Hour)},
+		{MessageID: "<later@example.org>", Subject: "Later", Until: now.Add(time.Hour)},
+	} {
+		m.SnoozedAt = now.AddDate(0, 0, -3)
+		if err := dm.SnoozeMessage(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server := &fakeOpsServer{folders: map[string]map[string]serverMessage{
+		SnoozeFolder: {
+			"<due@example.org>":   {UID: 4},
+			"<later@example.org>": {UID: 5},
+		},
+	}}
+	returned, err := returnDueSnoozes(dm, server, now)
+	if err != nil || returned != 1 {
+		t.Fatalf("Expected one message returned, got %d, %v", returned, err)
+	}
+	if got := strings.Join(server.calls, "\n"); got != "move Snoozed [4] INBOX" {
+		t.Errorf("Unexpected server calls:\n%s", got)
+	}
+
+	snoozed, err := dm.ListSnoozed()
+	if err != nil || len(snoozed) != 1 || snoozed[0].MessageID != "<later@example.org>" {
+		t.Errorf("Expected only the later message still snoozed, got %+v, %v", snoozed, err)
+	}
+	if out := FormatSnoozed(snoozed); !strings.Contains(out, `Mon Mar 11 10:00 AM  "Later"`) {
+		t.Errorf("Unexpected output:\n%s", out)
+	}
+
+	// A failed move keeps the messages snoozed for the next sync
+	server.failOn = "move"
+	if _, err := returnDueSnoozes(dm, server, now.Add(2*time.Hour)); err == nil {
+		t.Fatal("Expected the failed move reported")
+	}
+	if snoozed, _ := dm.ListSnoozed(); len(snoozed) != 1 {
+		t.Errorf("Expected the message kept snoozed, got %+v", snoozed)
+	}
+}
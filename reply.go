@@ -11,6 +11,7 @@ type ReplyOptions struct {
 	EmailNumber int      // User-friendly email number from list
 	EmailUID    uint32   // IMAP UID if known
 	MessageID   string   // Message-ID to reply to
+	Email       *Email   // The email itself, when the caller already has it
 	To          []string
 	CC          []string
 	BCC         []string
@@ -20,6 +21,9 @@ type ReplyOptions struct {
 	ReplyAll    bool     // Reply to all recipients
 	Interactive bool     // Interactive mode
 	Draft       bool     // Save as draft instead of sending
+	NoSignature bool     // Don't add the account's signature
+	Posting     string   // "top" or "bottom"; empty uses the account setting
+	AIInstruction string // Draft the body with the AI backend; always saved as a draft
 }
 
 func ReplyCommand(opts ReplyOptions) error {
@@ -27,7 +31,9 @@ func ReplyCommand(opts ReplyOptions) error {
 	var err error
 
 	// Find the original email to reply to
-	if opts.EmailNumber > 0 {
+	if opts.Email != nil {
+		originalEmail = opts.Email
+	} else if opts.EmailNumber > 0 {
 		originalEmail, err = findEmailByNumber(opts.EmailNumber)
 		if err != nil {
 			return fmt.Errorf("failed to find email #%d: %v", opts.EmailNumber, err)
@@ -49,6 +55,9 @@ func ReplyCommand(opts ReplyOptions) error {
 	if originalEmail == nil {
 		return fmt.Errorf("original email not found")
 	}
+	if opts.AIInstruction != "" && (opts.Body != "" || opts.FileBody != "" || opts.Interactive) {
+		return fmt.Errorf("--ai writes the body itself and can't be combined with --body, --file or --interactive")
+	}
 
 	fmt.Printf("📧 Replying to: %s\n", originalEmail.Subject)
 	fmt.Printf("   From: %s\n", originalEmail.From)
@@ -115,25 +124,57 @@ func ReplyCommand(opts ReplyOptions) error {
 	}
 	reply.Subject = subject
 
+	// Quote the original as the account prefers
+	settings := defaultReplySettings
+	setup, setupErr := InitializeMailSetup("")
+	if setupErr == nil {
+		settings = setup.Config.GetReplySettings()
+	}
+	if opts.Posting != "" {
+		settings.Posting = opts.Posting
+	}
+	if err := validatePosting(settings.Posting); err != nil {
+		return err
+	}
+
 	// Set body
+	var note string
 	if opts.FileBody != "" {
 		fileContent, err := os.ReadFile(opts.FileBody)
 		if err != nil {
 			return fmt.Errorf("failed to read body from file %s: %v", opts.FileBody, err)
 		}
-		reply.Body = string(fileContent)
+		note = string(fileContent)
 	} else if opts.Body != "" {
-		reply.Body = opts.Body
+		note = opts.Body
+	} else if opts.AIInstruction != "" {
+		if setupErr != nil {
+			return setupErr
+		}
+		note, err = generateAIReply(setup.Config, originalEmail, opts.AIInstruction)
+		if err != nil {
+			return err
+		}
+		// AI replies are only ever saved for review, never sent
+		opts.Draft = true
 	} else if opts.Interactive {
 		// Interactive composition
-		body, err := composeReplyInteractively(originalEmail)
+		note, err = composeReplyInteractively(originalEmail)
 		if err != nil {
 			return fmt.Errorf("failed to compose reply: %v", err)
 		}
-		reply.Body = body
-	} else {
-		// Default: create a basic reply template
-		reply.Body = createReplyTemplate(originalEmail)
+	}
+	// Front matter stays at the top of the body so Send still applies it.
+	// Only the user's own text can carry it, never an AI draft.
+	var frontmatter string
+	if fm, content, err := ParseFrontmatter(note); err == nil && fm != nil && opts.AIInstruction == "" {
+		trimmed := strings.TrimSpace(note)
+		frontmatter, note = strings.TrimSuffix(trimmed, content), content
+	}
+	reply.Body = frontmatter + buildReplyText(note, originalEmail, settings)
+	reply.BodyHTML = buildReplyHTML(note, originalEmail, settings)
+	if opts.NoSignature {
+		reply.Signature = NoSignatureName
 	}
 
 	// Save or send the reply
@@ -143,7 +184,12 @@ func ReplyCommand(opts ReplyOptions) error {
 		if err != nil {
 			return fmt.Errorf("failed to save reply as draft: %v", err)
 		}
-		fmt.Printf("✓ Reply saved as draft (UID: %d)\n", uid)
+		if uid != 0 {
+			fmt.Printf("✓ Reply saved as draft (UID: %d)\n", uid)
+		}
+		if opts.AIInstruction != "" {
+			fmt.Println("📝 Review it with 'mailos draft list' and send it with 'mailos send --drafts'")
+		}
 		
 		// Also save to local drafts
 		if err := saveLocalDraft(reply); err != nil {
@@ -159,8 +205,11 @@ func ReplyCommand(opts ReplyOptions) error {
 			BCC:        reply.BCC,
 			Subject:    reply.Subject,
 			Body:       reply.Body,
+			BodyHTML:   reply.BodyHTML,
 			InReplyTo:  reply.InReplyTo,
 			References: reply.References,
+			// The signature goes next to the note, outside the quoted original
+			IncludeSignature: !opts.NoSignature,
 		}
 		
 		fmt.Printf("📤 Sending reply...\n")
@@ -271,40 +320,7 @@ func composeReplyInteractively(originalEmail *Email) (string, error) {
 		bodyLines = append(bodyLines, line)
 	}
 	
-	body := strings.Join(bodyLines, "")
-	
-	// Add original message quote
-	quote := createOriginalMessageQuote(originalEmail)
-	if body != "" {
-		body = body + "\n\n" + quote
-	} else {
-		body = quote
-	}
-	
-	return body, nil
-}
-
-func createReplyTemplate(originalEmail *Email) string {
-	// Create a basic reply with quoted original message
-	template := fmt.Sprintf("\n\n%s", createOriginalMessageQuote(originalEmail))
-	return template
-}
-
-func createOriginalMessageQuote(originalEmail *Email) string {
-	// Create a quoted version of the original message
-	var quote strings.Builder
-	
-	quote.WriteString(fmt.Sprintf("On %s, %s wrote:\n", 
-		originalEmail.Date.Format("Jan 2, 2006 at 3:04 PM"),
-		originalEmail.From))
-	
-	// Quote the original body
-	lines := strings.Split(originalEmail.Body, "\n")
-	for _, line := range lines {
-		quote.WriteString("> " + line + "\n")
-	}
-	
-	return quote.String()
+	return strings.Join(bodyLines, ""), nil
 }
 
 // ReplyToEmail is a helper function that can be called with just an email number
@@ -0,0 +1,366 @@
+package mailos
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Reply posting styles
+const (
+	PostingTop    = "top"    // Reply above the quoted message
+	PostingBottom = "bottom" // Reply below the quoted message
+)
+
+// ReplySettings control how replies quote the original message
+type ReplySettings struct {
+	Posting     string `json:"posting,omitempty"`      // "top" or "bottom"
+	QuoteLevels int    `json:"quote_levels,omitempty"` // Quote depth to keep, counting the original as 1; -1 keeps all
+}
+
+// defaultReplySettings top-post and keep the original plus two older levels
+var defaultReplySettings = ReplySettings{Posting: PostingTop, QuoteLevels: 3}
+
+// GetReplySettings returns the defaults with the account's overrides applied
+func (c *Config) GetReplySettings() ReplySettings {
+	settings := defaultReplySettings
+	if c.Reply != nil {
+		if c.Reply.Posting != "" {
+			settings.Posting = c.Reply.Posting
+		}
+		if c.Reply.QuoteLevels != 0 {
+			settings.QuoteLevels = c.Reply.QuoteLevels
+		}
+	}
+	return settings
+}
+
+// validatePosting checks a posting style from the command line or config
+func validatePosting(posting string) error {
+	if posting != PostingTop && posting != PostingBottom {
+		return fmt.Errorf("invalid posting style '%s' (use '%s' or '%s')", posting, PostingTop, PostingBottom)
+	}
+	return nil
+}
+
+const (
+	quoteWidth        = 72 // Line length quoted text is wrapped to
+	softWrapMinLength = 60 // Shorter lines are taken as deliberate line breaks
+	trimmedQuoteNote  = "[older quoted text trimmed]"
+	quoteStyle        = "margin:0 0 0 .8ex;border-left:1px solid #ccc;padding-left:1ex"
+)
+
+// listItemPattern matches list items, which are never joined to the line above
+var listItemPattern = regexp.MustCompile(`^\s*([-*+•]|\d+[.)])\s`)
+
+// quotedLine is a line of a message body with its quote markers removed
+type quotedLine struct {
+	depth int
+	text  string
+}
+
+// parseQuotedLines splits a body into lines and their quote depth. Both
+// ">> text" and "> > text" count as depth 2.
+func parseQuotedLines(body string) []quotedLine {
+	body = strings.TrimRight(strings.ReplaceAll(body, "\r\n", "\n"), "\n")
+	if body == "" {
+		return nil
+	}
+
+	var lines []quotedLine
+	for _, line := range strings.Split(body, "\n") {
+		depth := 0
+		for strings.HasPrefix(line, ">") {
+			depth++
+			line = line[1:]
+			if next := strings.TrimLeft(line, " "); strings.HasPrefix(next, ">") {
+				line = next
+			}
+		}
+		if depth > 0 {
+			line = strings.TrimPrefix(line, " ")
+		}
+		lines = append(lines, quotedLine{depth: depth, text: strings.TrimRight(line, " \t")})
+	}
+	return lines
+}
+
+// stripQuotedSignature drops the original sender's own signature, which
+// starts at a "-- " line near the end of the unquoted text
+func stripQuotedSignature(lines []quotedLine) []quotedLine {
+	for i := len(lines) - 1; i >= 0 && i >= len(lines)-12; i-- {
+		if lines[i].depth == 0 && (lines[i].text == "--" || lines[i].text == "-- ") {
+			return lines[:i]
+		}
+	}
+	return lines
+}
+
+// softWrapped reports whether next continues the paragraph of a hard-wrapped
+// line, so the two can be joined before rewrapping
+func softWrapped(line string, next quotedLine, depth int) bool {
+	return next.depth == depth &&
+		len(line) >= softWrapMinLength &&
+		strings.TrimSpace(next.text) != "" &&
+		!strings.HasPrefix(next.text, " ") && !strings.HasPrefix(next.text, "\t") &&
+		!listItemPattern.MatchString(next.text)
+}
+
+// wrapWords breaks text into lines of at most width characters. Words longer
+// than width, such as URLs, get a line of their own.
+func wrapWords(text string, width int) []string {
+	var lines []string
+	var line string
+	for _, word := range strings.Fields(text) {
+		if line != "" && len(line)+1+len(word) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// quoteText quotes a plain text body one level deeper, rewrapping paragraphs
+// to fit and replacing levels beyond levels with a note
+func quoteText(body string, levels int) string {
+	lines := stripQuotedSignature(parseQuotedLines(body))
+
+	var b strings.Builder
+	trimmed := false
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		depth := line.depth + 1
+		if levels > 0 && depth > levels {
+			if !trimmed {
+				b.WriteString(quotePrefix(levels) + trimmedQuoteNote + "\n")
+				trimmed = true
+			}
+			continue
+		}
+		trimmed = false
+
+		marker := strings.Repeat(">", depth)
+		if line.text == "" {
+			b.WriteString(marker + "\n")
+			continue
+		}
+		// Indented lines (code, tables) keep their layout
+		if strings.HasPrefix(line.text, " ") || strings.HasPrefix(line.text, "\t") {
+			b.WriteString(marker + " " + line.text + "\n")
+			continue
+		}
+
+		paragraph := line.text
+		for last := line.text; i+1 < len(lines) && softWrapped(last, lines[i+1], line.depth); {
+			i++
+			last = lines[i].text
+			paragraph += " " + strings.TrimSpace(last)
+		}
+
+		width := quoteWidth - len(marker) - 1
+		if width < 20 {
+			width = 20
+		}
+		for _, wrapped := range wrapWords(paragraph, width) {
+			b.WriteString(marker + " " + wrapped + "\n")
+		}
+	}
+	return b.String()
+}
+
+// replyAttribution introduces the quoted original
+func replyAttribution(originalEmail *Email) string {
+	return fmt.Sprintf("On %s, %s wrote:", originalEmail.Date.Format("Jan 2, 2006 at 3:04 PM"), originalEmail.From)
+}
+
+// buildReplyText writes the text/plain reply: the note above or below the
+// attributed quote of the original
+func buildReplyText(note string, originalEmail *Email, settings ReplySettings) string {
+	note = strings.Trim(note, "\n")
+	quoted := quoteText(originalEmail.Body, settings.QuoteLevels)
+	if quoted == "" {
+		return note
+	}
+	quote := replyAttribution(originalEmail) + "\n" + quoted
+
+	switch {
+	case note == "":
+		return quote
+	case settings.Posting == PostingBottom:
+		return quote + "\n" + note + "\n"
+	default:
+		return note + "\n\n" + quote
+	}
+}
+
+// buildReplyHTML writes the text/html reply: the note rendered from markdown
+// and a blockquote of the original's sanitized HTML, or of its text
+func buildReplyHTML(note string, originalEmail *Email, settings ReplySettings) string {
+	var quoted string
+	if originalEmail.BodyHTML != "" {
+		quoted = sanitizeQuotedHTML(originalEmail.BodyHTML, settings.QuoteLevels-1)
+	} else {
+		quoted = textToQuotedHTML(originalEmail.Body, settings.QuoteLevels-1)
+	}
+
+	var noteHTML string
+	if note = strings.Trim(note, "\n"); note != "" {
+		noteHTML = MarkdownToHTMLContent(note)
+	}
+	if strings.TrimSpace(quoted) == "" {
+		return noteHTML
+	}
+
+	quote := fmt.Sprintf("<div class=\"reply-attribution\">%s</div>\n<blockquote type=\"cite\" style=\"%s\">\n%s\n</blockquote>\n",
+		html.EscapeString(replyAttribution(originalEmail)), quoteStyle, strings.TrimSpace(quoted))
+
+	if settings.Posting == PostingBottom {
+		return quote + noteHTML
+	}
+	return noteHTML + quote
+}
+
+// textToQuotedHTML renders a plain text body for a blockquote, turning its
+// own quote levels into nested blockquotes
+func textToQuotedHTML(body string, levels int) string {
+	lines := stripQuotedSignature(parseQuotedLines(body))
+
+	var b strings.Builder
+	depth := 0
+	trimmed := false
+	for _, line := range lines {
+		if levels >= 0 && line.depth > levels {
+			if trimmed {
+				continue
+			}
+			line = quotedLine{depth: levels, text: trimmedQuoteNote}
+			trimmed = true
+		} else {
+			trimmed = false
+		}
+		for depth < line.depth {
+			b.WriteString(fmt.Sprintf("<blockquote type=\"cite\" style=\"%s\">\n", quoteStyle))
+			depth++
+		}
+		for depth > line.depth {
+			b.WriteString("</blockquote>\n")
+			depth--
+		}
+		b.WriteString(html.EscapeString(line.text) + "<br>\n")
+	}
+	for ; depth > 0; depth-- {
+		b.WriteString("</blockquote>\n")
+	}
+	return b.String()
+}
+
+// unsafeQuotedElements are dropped with their content when quoting HTML
+var unsafeQuotedElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Iframe: true, atom.Frame: true, atom.Frameset: true,
+	atom.Object: true, atom.Embed: true, atom.Applet: true, atom.Form: true, atom.Input: true,
+	atom.Button: true, atom.Select: true, atom.Textarea: true, atom.Meta: true, atom.Link: true,
+	atom.Base: true, atom.Title: true, atom.Head: true,
+}
+
+// sanitizeQuotedHTML returns the body of an HTML message safe to embed in a
+// reply: scripts, styles, forms and event handlers are removed, images are
+// marked as quoted, and blockquotes nested deeper than levels are replaced
+// with a note. A
+// negative levels keeps every level.
+func sanitizeQuotedHTML(doc string, levels int) string {
+	context := &xhtml.Node{Type: xhtml.ElementNode, Data: "div", DataAtom: atom.Div}
+	nodes, err := xhtml.ParseFragment(strings.NewReader(doc), context)
+	if err != nil {
+		return html.EscapeString(doc)
+	}
+
+	var b strings.Builder
+	for _, n := range nodes {
+		if keep := sanitizeQuotedNode(n, 0, levels); keep != nil {
+			xhtml.Render(&b, keep)
+		}
+	}
+	return b.String()
+}
+
+// sanitizeQuotedNode cleans n in place and returns the node to keep in its
+// place, or nil to drop it
+func sanitizeQuotedNode(n *xhtml.Node, depth, levels int) *xhtml.Node {
+	switch n.Type {
+	case xhtml.CommentNode, xhtml.DoctypeNode:
+		return nil
+	case xhtml.ElementNode:
+		if unsafeQuotedElements[n.DataAtom] {
+			return nil
+		}
+		if n.DataAtom == atom.Blockquote {
+			depth++
+			if levels >= 0 && depth > levels {
+				note := &xhtml.Node{Type: xhtml.ElementNode, Data: "p", DataAtom: atom.P}
+				note.AppendChild(&xhtml.Node{Type: xhtml.TextNode, Data: trimmedQuoteNote})
+				return note
+			}
+		}
+		n.Attr = safeQuotedAttributes(n.Attr)
+		if n.DataAtom == atom.Img {
+			n.Attr = append([]xhtml.Attribute{{Key: quotedImageAttr}}, n.Attr...)
+		}
+	}
+
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		keep := sanitizeQuotedNode(c, depth, levels)
+		if keep == nil {
+			n.RemoveChild(c)
+		} else if keep != c {
+			n.InsertBefore(keep, c)
+			n.RemoveChild(c)
+		}
+		c = next
+	}
+	return n
+}
+
+// safeQuotedAttributes drops event handlers, script URLs and resources
+// that aren't on the web or in the message itself
+func safeQuotedAttributes(attrs []xhtml.Attribute) []xhtml.Attribute {
+	var kept []xhtml.Attribute
+	for _, a := range attrs {
+		key := strings.ToLower(a.Key)
+		value := strings.ToLower(strings.TrimSpace(a.Val))
+		if strings.HasPrefix(key, "on") {
+			continue
+		}
+		if (key == "href" || key == "action") &&
+			(strings.HasPrefix(value, "javascript:") || strings.HasPrefix(value, "vbscript:") || strings.HasPrefix(value, "data:text/html")) {
+			continue
+		}
+		// A local path would be read from the replier's disk when sending
+		if (key == "src" || key == "background") && !safeQuotedSource(value) {
+			continue
+		}
+		kept = append(kept, a)
+	}
+	return kept
+}
+
+// safeQuotedSource reports whether a quoted image may keep its source
+func safeQuotedSource(src string) bool {
+	for _, prefix := range []string{"http://", "https://", "cid:", "data:image/"} {
+		if strings.HasPrefix(src, prefix) {
+			return true
+		}
+	}
+	return false
+}
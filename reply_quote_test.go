@@ -0,0 +1,169 @@
+package mailos
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuoteText(t *testing.T) {
+	t.Run("Reflow", func(t *testing.T) {
+		body := "This paragraph was hard wrapped by the sender's client at sixty\n" +
+			"something columns and should be joined.\n\nShort line\nAnother short line"
+		got := quoteText(body, 3)
+		want := "> This paragraph was hard wrapped by the sender's client at sixty\n" +
+			"> something columns and should be joined.\n>\n> Short line\n> Another short line\n"
+		if got != want {
+			t.Errorf("quoteText() =\n%s\nwant\n%s", got, want)
+		}
+	})
+
+	t.Run("Levels", func(t *testing.T) {
+		body := "Reply\n\n> First\n> > Second\n>>> Third\n\nAfter"
+		got := quoteText(body, 2)
+		for _, want := range []string{"> Reply\n", ">> First\n", ">> [older quoted text trimmed]\n", "> After\n"} {
+			if !strings.Contains(got, want) {
+				t.Errorf("Expected %q in:\n%s", want, got)
+			}
+		}
+		if strings.Contains(got, "Second") || strings.Contains(got, "Third") {
+			t.Errorf("Expected older levels trimmed, got:\n%s", got)
+		}
+		if all := quoteText(body, -1); !strings.Contains(all, ">>>> Third") {
+			t.Errorf("Expected every level kept with -1, got:\n%s", all)
+		}
+	})
+
+	t.Run("Signature", func(t *testing.T) {
+		got := quoteText("See you then.\n-- \nBob\nAcme", 3)
+		if got != "> See you then.\n" {
+			t.Errorf("Expected the sender's signature left out, got %q", got)
+		}
+	})
+}
+
+func TestDecodeFlowed(t *testing.T) {
+	body := "This is a long \r\nflowed line.\r\n>Quoted and \r\n>flowed\r\n \r\n-- \r\nSig"
+	want := "This is a long flowed line.\n> Quoted and flowed\n\n-- \nSig"
+	if got := decodeFlowed(body, false); got != want {
+		t.Errorf("decodeFlowed() = %q, want %q", got, want)
+	}
+	if got := decodeFlowed("Gr \r\nüße", true); got != "Grüße" {
+		t.Errorf("Expected delsp=yes to remove the soft break space, got %q", got)
+	}
+}
+
+func TestReadFlowedMessage(t *testing.T) {
+	raw := "From: bob@example.org\r\nTo: me@example.com\r\nSubject: Flowed\r\n" +
+		"Content-Type: text/plain; charset=utf-8; format=flowed\r\n\r\n" +
+		"One soft \r\nbroken line.\r\n"
+	email, err := parseRawMessage([]byte(raw))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if strings.TrimSpace(email.Body) != "One soft broken line." {
+		t.Errorf("Expected the flowed body joined, got %q", email.Body)
+	}
+}
+
+func TestSanitizeQuotedHTML(t *testing.T) {
+	doc := `<html><head><title>x</title><style>p{}</style></head><body>` +
+		`<p onclick="steal()">Hi <a href="javascript:alert(1)">there</a> <a href="https://example.com">link</a></p>` +
+		`<script>alert(1)</script><!-- note -->` +
+		`<img src="/tmp/secret.png"><img src="file:///tmp/secret.png"><img src=" ~/secret.png"><img src="secret.png">` +
+		`<img src="//host/secret.png"><table background="/tmp/bg.png"></table>` +
+		`<img src="https://example.com/logo.png"><img src="cid:logo@x"><img src="data:image/png;base64,AAAA">` +
+		`<blockquote><p>Older</p><blockquote><p>Oldest</p></blockquote></blockquote></body></html>`
+
+	got := sanitizeQuotedHTML(doc, 1)
+	for _, unwanted := range []string{"<script", "alert", "onclick", "<style", "<title", "note", "Oldest", "secret", "bg.png"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("Expected %q removed, got:\n%s", unwanted, got)
+		}
+	}
+	for _, want := range []string{`href="https://example.com"`, "Older", trimmedQuoteNote,
+		`src="https://example.com/logo.png"`, `src="cid:logo@x"`, `src="data:image/png;base64,AAAA"`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %q kept, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestReplyDoesNotEmbedQuotedFiles(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "secret.png")
+	if err := os.WriteFile(secret, []byte("\x89PNG\r\n\x1a\nsecret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	original := &Email{
+		From:     "Mallory <mallory@example.org>",
+		BodyHTML: `<p>Hi</p><img src="` + secret + `"><img src="file://` + secret + `">`,
+	}
+	reply := buildReplyHTML("Thanks", original, ReplySettings{Posting: PostingTop, QuoteLevels: 3})
+	if _, images := EmbedInlineImages(reply, filepath.Dir(secret), true); len(images) != 0 {
+		t.Errorf("Expected no file from the quoted message embedded, got %d", len(images))
+	}
+}
+
+func TestBuildReply(t *testing.T) {
+	original := &Email{
+		From:     "Bob <bob@example.org>",
+		Date:     time.Date(2024, 9, 2, 10, 0, 0, 0, time.UTC),
+		Body:     "Lunch?",
+		BodyHTML: "<p>Lunch?</p>",
+	}
+	attribution := "On Sep 2, 2024 at 10:00 AM, Bob <bob@example.org> wrote:"
+
+	t.Run("Top", func(t *testing.T) {
+		settings := ReplySettings{Posting: PostingTop, QuoteLevels: 3}
+		if got, want := buildReplyText("Sure.", original, settings), "Sure.\n\n"+attribution+"\n> Lunch?\n"; got != want {
+			t.Errorf("buildReplyText() = %q, want %q", got, want)
+		}
+		got := buildReplyHTML("Sure.", original, settings)
+		if strings.Index(got, "Sure.") > strings.Index(got, "<blockquote") || !strings.Contains(got, "<p>Lunch?</p>") {
+			t.Errorf("Expected the note above the quoted HTML, got:\n%s", got)
+		}
+	})
+
+	t.Run("Bottom", func(t *testing.T) {
+		settings := ReplySettings{Posting: PostingBottom, QuoteLevels: 3}
+		text := buildReplyText("Sure.", original, settings)
+		if want := attribution + "\n> Lunch?\n\nSure.\n"; text != want {
+			t.Errorf("buildReplyText() = %q, want %q", text, want)
+		}
+		html := buildReplyHTML("Sure.", original, settings)
+		if strings.Index(html, "Sure.") < strings.Index(html, "</blockquote>") {
+			t.Errorf("Expected the note below the quoted HTML, got:\n%s", html)
+		}
+
+		// The signature follows the reply, not the quote
+		signature := &Signature{Markdown: "Jane"}
+		if got := insertSignature(text, signature.Text()); !strings.HasSuffix(got, "Sure.\n\n-- \nJane") {
+			t.Errorf("Expected the signature after the reply, got:\n%s", got)
+		}
+		if got := insertSignatureHTML(html, signature.HTML()); !strings.HasSuffix(got, signature.HTML()) {
+			t.Errorf("Expected the HTML signature after the reply, got:\n%s", got)
+		}
+	})
+
+	t.Run("TextOnlyOriginal", func(t *testing.T) {
+		textOnly := *original
+		textOnly.BodyHTML = ""
+		textOnly.Body = "Lunch?\n> Earlier <b>plans</b>"
+		got := buildReplyHTML("", &textOnly, ReplySettings{Posting: PostingTop, QuoteLevels: 3})
+		if !strings.Contains(got, "Lunch?<br>") || !strings.Contains(got, "&lt;b&gt;plans") || strings.Count(got, "<blockquote") != 2 {
+			t.Errorf("Expected the text quoted as escaped, nested HTML, got:\n%s", got)
+		}
+	})
+
+	t.Run("Settings", func(t *testing.T) {
+		config := &Config{Reply: &ReplySettings{Posting: PostingBottom}}
+		if got := config.GetReplySettings(); got.Posting != PostingBottom || got.QuoteLevels != 3 {
+			t.Errorf("Expected the posting override with the default levels, got %+v", got)
+		}
+		if err := validatePosting("middle"); err == nil {
+			t.Errorf("Expected an unknown posting style rejected")
+		}
+	})
+}
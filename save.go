@@ -88,10 +88,10 @@ func formatEmailAsMarkdown(email *Email) string {
 	
 	// Body
 	body := email.Body
-	if body == "" && email.BodyHTML != "" {
-		// If only HTML is available, note it
+	if email.BodyHTML != "" && (body == "" || email.BodyFromHTML) {
+		// If only HTML is available, note it and convert it to markdown
 		content.WriteString("*[HTML email - plain text version not available]*\n\n")
-		body = StripHTMLTags(email.BodyHTML)
+		body = HTMLToText(SanitizeRemoteContent(email.BodyHTML, LoadPrivacySettings()), HTMLTextOptions{Markdown: true})
 	}
 	
 	content.WriteString(body)
@@ -0,0 +1,618 @@
+package mailos
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Schema versions this version of mailos reads and writes. Bump one and add
+// a Migration when a file's format changes. The archive database is
+// versioned with PRAGMA user_version and migrated in archive.go.
+const (
+	ConfigSchemaVersion   = 1
+	GroupsSchemaVersion   = 1
+	InboxSchemaVersion    = 1
+	SearchesSchemaVersion = 1
+	ArchiveSchemaVersion  = 4
+)
+
+// Migration upgrades a file's JSON to Version from the version before it
+type Migration struct {
+	Version     int
+	Description string
+	Apply       func(doc map[string]interface{}) error
+}
+
+// schemaFile describes a versioned JSON file and how to upgrade it
+type schemaFile struct {
+	Name       string
+	Version    int
+	Migrations []Migration // In version order
+}
+
+var configSchemaFile = &schemaFile{Name: "config", Version: ConfigSchemaVersion, Migrations: []Migration{
+	{Version: 1, Description: "Add schema_version and convert the emailProvider/appPassword format", Apply: migrateLegacyConfig},
+}}
+
+var groupsSchemaFile = &schemaFile{Name: "groups", Version: GroupsSchemaVersion, Migrations: []Migration{
+	{Version: 1, Description: "Add schema_version", Apply: func(map[string]interface{}) error { return nil }},
+}}
+
+var inboxSchemaFile = &schemaFile{Name: "inbox", Version: InboxSchemaVersion, Migrations: []Migration{
+	{Version: 1, Description: "Add schema_version", Apply: func(map[string]interface{}) error { return nil }},
+}}
+
+var searchesSchemaFile = &schemaFile{Name: "searches", Version: SearchesSchemaVersion}
+
+// migrateLegacyConfig converts the original config format, which only had
+// emailProvider, appPassword and fromEmail
+func migrateLegacyConfig(doc map[string]interface{}) error {
+	legacyProvider, ok := doc["emailProvider"].(string)
+	if !ok {
+		return nil
+	}
+	// fastgmail and anything unknown were Gmail
+	if _, known := Providers[legacyProvider]; !known {
+		legacyProvider = ProviderGmail
+	}
+	for key, value := range map[string]interface{}{"provider": legacyProvider, "email": doc["fromEmail"], "password": doc["appPassword"]} {
+		if doc[key] == nil || doc[key] == "" {
+			doc[key] = value
+		}
+	}
+	delete(doc, "emailProvider")
+	delete(doc, "appPassword")
+	delete(doc, "fromEmail")
+	return nil
+}
+
+// schemaVersion returns a document's schema_version; files written before
+// versioning are version 0
+func schemaVersion(doc map[string]interface{}) int {
+	version, _ := doc["schema_version"].(float64)
+	return int(version)
+}
+
+// pending returns the migrations a document at version still needs
+func (f *schemaFile) pending(version int) ([]Migration, error) {
+	if version > f.Version {
+		return nil, fmt.Errorf("%s file has schema version %d, but this version of mailos only reads up to %d. Update mailos", f.Name, version, f.Version)
+	}
+	var pending []Migration
+	for _, m := range f.Migrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// migrate upgrades a document in place, calling before ahead of each step
+// with the version it's about to leave
+func (f *schemaFile) migrate(doc map[string]interface{}, before func(version int) error) error {
+	pending, err := f.pending(schemaVersion(doc))
+	if err != nil {
+		return err
+	}
+	for _, m := range pending {
+		if before != nil {
+			if err := before(schemaVersion(doc)); err != nil {
+				return err
+			}
+		}
+		if err := m.Apply(doc); err != nil {
+			return fmt.Errorf("failed to migrate %s to schema version %d: %v", f.Name, m.Version, err)
+		}
+		doc["schema_version"] = float64(m.Version)
+	}
+	return nil
+}
+
+// loadVersionedFile reads a JSON file and upgrades it to the current schema.
+// Before each migration the file as it stands is backed up next to it, as
+// config.json.v0.bak, and the upgraded file is saved once all have run.
+func loadVersionedFile(path string, f *schemaFile) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid %s file %s: %v", f.Name, path, err)
+	}
+	from := schemaVersion(doc)
+	if pending, err := f.pending(from); err != nil || len(pending) == 0 {
+		return data, err
+	}
+
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	current := data
+	err = f.migrate(doc, func(version int) error {
+		if version != from {
+			if current, err = json.MarshalIndent(doc, "", "  "); err != nil {
+				return err
+			}
+		}
+		backup := fmt.Sprintf("%s.v%d.bak", path, version)
+		if err := os.WriteFile(backup, current, mode); err != nil {
+			return fmt.Errorf("failed to back up %s before migrating: %v", path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	migrated, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode migrated %s: %v", f.Name, err)
+	}
+	if err := os.WriteFile(path, migrated, mode); err != nil {
+		return nil, fmt.Errorf("failed to save migrated %s: %v", path, err)
+	}
+	fmt.Fprintf(os.Stderr, "✓ Upgraded %s from schema version %d to %d (backup: %s.v%d.bak)\n", displayPath(path), from, f.Version, displayPath(path), from)
+	return migrated, nil
+}
+
+// JSON Schemas for the files, in the draft-07 subset validateSchema supports
+
+func schemaObject(properties map[string]interface{}, required ...string) map[string]interface{} {
+	schema := map[string]interface{}{"type": "object", "properties": properties, "additionalProperties": false}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func schemaType(t string) map[string]interface{} {
+	return map[string]interface{}{"type": t}
+}
+
+func schemaEnum(values ...string) map[string]interface{} {
+	return map[string]interface{}{"type": "string", "enum": values}
+}
+
+func schemaEmail() map[string]interface{} {
+	return map[string]interface{}{"type": "string", "format": "email"}
+}
+
+func schemaMinimum(minimum int) map[string]interface{} {
+	return map[string]interface{}{"type": "integer", "minimum": minimum}
+}
+
+func schemaArray(items map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"type": "array", "items": items}
+}
+
+func providerKeys() []string {
+	var keys []string
+	for key := range Providers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ConfigJSONSchema returns the JSON Schema for config.json. Every field is
+// optional, since a local config may set only a few.
+func ConfigJSONSchema() map[string]interface{} {
+	sendLimits := schemaObject(map[string]interface{}{
+		"messages_per_minute":    schemaMinimum(0),
+		"messages_per_day":       schemaMinimum(0),
+		"recipients_per_message": schemaMinimum(0),
+	})
+	reply := schemaObject(map[string]interface{}{
+		"posting":      schemaEnum(PostingTop, PostingBottom),
+		"quote_levels": schemaMinimum(-1),
+	})
+	account := schemaObject(map[string]interface{}{
+		"email":             schemaEmail(),
+		"provider":          schemaEnum(providerKeys()...),
+		"password":          schemaType("string"),
+		"from_name":         schemaType("string"),
+		"from_email":        schemaEmail(),
+		"profile_image":     schemaType("string"),
+		"label":             schemaType("string"),
+		"signature":         schemaType("string"),
+		"send_limits":       sendLimits,
+		"default_signature": schemaType("string"),
+		"reply":             reply,
+	}, "email")
+
+	schema := schemaObject(map[string]interface{}{
+		"schema_version":     schemaMinimum(0),
+		"provider":           schemaEnum(providerKeys()...),
+		"email":              schemaEmail(),
+		"password":           schemaType("string"),
+		"from_name":          schemaType("string"),
+		"from_email":         schemaEmail(),
+		"profile_image":      schemaType("string"),
+		"license_key":        schemaType("string"),
+		"default_ai_cli":     schemaType("string"),
+		"last_sync_time":     schemaType("string"),
+		"auto_sync":          schemaType("boolean"),
+		"sync_dir":           schemaType("string"),
+		"local_storage_dir":  schemaType("string"),
+		"signature_override": schemaType("string"),
+		"accounts":           schemaArray(account),
+		"active_account":     schemaEmail(),
+		"debug":              schemaType("boolean"),
+		"send_limits":        sendLimits,
+		"default_signature":  schemaType("string"),
+		"reply":              reply,
+		"privacy": schemaObject(map[string]interface{}{
+			"remote_content":  schemaEnum(RemoteContentBlock, RemoteContentProxy, RemoteContentAllow),
+			"image_proxy":     schemaType("string"),
+			"tracker_domains": schemaArray(schemaType("string")),
+		}),
+		"ai": schemaObject(map[string]interface{}{
+			"backend":            schemaEnum(AIBackendCLI, AIBackendHTTP),
+			"endpoint":           schemaType("string"),
+			"model":              schemaType("string"),
+			"api_key":            schemaType("string"),
+			"max_context_tokens": schemaMinimum(0),
+			"max_tokens":         schemaMinimum(0),
+			"timeout_seconds":    schemaMinimum(0),
+		}),
+	})
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "mailos config.json"
+	return schema
+}
+
+// GroupsJSONSchema returns the JSON Schema for groups.json
+func GroupsJSONSchema() map[string]interface{} {
+	schema := schemaObject(map[string]interface{}{
+		"schema_version": schemaMinimum(0),
+		"groups": schemaArray(schemaObject(map[string]interface{}{
+			"name":        schemaType("string"),
+			"description": schemaType("string"),
+			"emails":      schemaArray(schemaEmail()),
+		}, "name")),
+	})
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "mailos groups.json"
+	return schema
+}
+
+// SavedSearchesJSONSchema returns the JSON Schema for searches.json
+func SavedSearchesJSONSchema() map[string]interface{} {
+	schema := schemaObject(map[string]interface{}{
+		"schema_version": schemaMinimum(0),
+		"searches": schemaArray(schemaObject(map[string]interface{}{
+			"name":    schemaType("string"),
+			"query":   schemaType("string"),
+			"created": schemaType("string"),
+		}, "name", "query")),
+	})
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "mailos searches.json"
+	return schema
+}
+
+// SchemaProblem is a place where a document doesn't match its schema
+type SchemaProblem struct {
+	Path    string `json:"path"` // Like accounts[1].email; empty for the whole document
+	Message string `json:"message"`
+}
+
+func (p SchemaProblem) String() string {
+	if p.Path == "" {
+		return p.Message
+	}
+	return p.Path + ": " + p.Message
+}
+
+// validateSchema checks a decoded JSON value against a schema. It supports
+// type, properties, required, additionalProperties, items, enum, minimum and
+// the email format.
+func validateSchema(value interface{}, schema map[string]interface{}, path string) []SchemaProblem {
+	var problems []SchemaProblem
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, SchemaProblem{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if t, ok := schema["type"].(string); ok && !hasJSONType(value, t) {
+		problem("expected %s, got %s", t, jsonTypeName(value))
+		return problems
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]string); ok {
+			for _, name := range required {
+				if _, ok := v[name]; !ok {
+					problem("missing required field %q", name)
+				}
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			child := name
+			if path != "" {
+				child = path + "." + name
+			}
+			if property, ok := properties[name].(map[string]interface{}); ok {
+				problems = append(problems, validateSchema(v[name], property, child)...)
+			} else if schema["additionalProperties"] == false {
+				problems = append(problems, SchemaProblem{Path: child, Message: "unknown field"})
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				problems = append(problems, validateSchema(item, items, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case string:
+		// Empty strings are unset, as in a partial local config
+		if enum, ok := schema["enum"].([]string); ok && v != "" && !containsString(enum, v) {
+			problem("%q is not one of %s", v, strings.Join(enum, ", "))
+		}
+		if schema["format"] == "email" && v != "" && !isValidEmail(v) {
+			problem("%q is not a valid email address", v)
+		}
+	case float64:
+		if minimum, ok := schema["minimum"].(int); ok && v < float64(minimum) {
+			problem("%v is less than %d", v, minimum)
+		}
+	}
+	return problems
+}
+
+func hasJSONType(value interface{}, t string) bool {
+	switch t {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	}
+	return true
+}
+
+func jsonTypeName(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// duplicateProblems reports list entries that share a key, ignoring case
+func duplicateProblems(doc map[string]interface{}, list, key string) []SchemaProblem {
+	var problems []SchemaProblem
+	items, _ := doc[list].([]interface{})
+	seen := map[string]int{}
+	for i, item := range items {
+		object, _ := item.(map[string]interface{})
+		value, _ := object[key].(string)
+		if value == "" {
+			continue
+		}
+		normalized := strings.ToLower(strings.TrimSpace(value))
+		if first, ok := seen[normalized]; ok {
+			problems = append(problems, SchemaProblem{Path: fmt.Sprintf("%s[%d].%s", list, i, key),
+				Message: fmt.Sprintf("%q is already used by %s[%d]", value, list, first)})
+			continue
+		}
+		seen[normalized] = i
+	}
+	return problems
+}
+
+// FileValidation is the result of validating one file
+type FileValidation struct {
+	Name     string          `json:"name"`
+	Path     string          `json:"path,omitempty"`
+	Version  int             `json:"schema_version"`
+	Migrates bool            `json:"migrates,omitempty"` // Upgraded the next time it's loaded
+	Problems []SchemaProblem `json:"problems,omitempty"`
+}
+
+// validateFile migrates a file in memory, without saving, and checks the result
+func validateFile(name, path string, f *schemaFile, schema map[string]interface{}, check func(map[string]interface{}) []SchemaProblem) (*FileValidation, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	result := &FileValidation{Name: name, Path: path}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		result.Problems = []SchemaProblem{{Message: fmt.Sprintf("invalid JSON: %v", err)}}
+		return result, nil
+	}
+	result.Version = schemaVersion(doc)
+	if err := f.migrate(doc, func(int) error { result.Migrates = true; return nil }); err != nil {
+		result.Problems = []SchemaProblem{{Message: err.Error()}}
+		return result, nil
+	}
+	result.Problems = validateSchema(doc, schema, "")
+	if check != nil {
+		result.Problems = append(result.Problems, check(doc)...)
+	}
+	return result, nil
+}
+
+// readMigratedConfig reads a config file and upgrades it in memory only
+func readMigratedConfig(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %v", path, err)
+	}
+	return doc, configSchemaFile.migrate(doc, nil)
+}
+
+// ValidateConfigFiles checks the global and local config, the config they
+// make together and groups.json
+func ValidateConfigFiles() ([]*FileValidation, error) {
+	globalPath, err := globalConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	localPath, _ := filepath.Abs(filepath.Join(".email", "config.json"))
+	checkAccounts := func(doc map[string]interface{}) []SchemaProblem {
+		return duplicateProblems(doc, "accounts", "email")
+	}
+
+	var results []*FileValidation
+	for _, file := range []struct{ name, path string }{{LayerGlobal, globalPath}, {LayerLocal, localPath}} {
+		if file.name == LayerLocal && file.path == globalPath {
+			continue
+		}
+		result, err := validateFile(file.name+" config", file.path, configSchemaFile, ConfigJSONSchema(), checkAccounts)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("no configuration found. Run 'mailos setup' first")
+	}
+
+	// The files may each be partial, but together they need an account
+	effective := &FileValidation{Name: "effective config", Version: ConfigSchemaVersion}
+	if resolved, err := resolveConfig(readMigratedConfig); err != nil {
+		effective.Problems = []SchemaProblem{{Message: err.Error()}}
+	} else {
+		if resolved.Config.Provider == "" {
+			effective.Problems = append(effective.Problems, SchemaProblem{Path: "provider", Message: "not set in any layer"})
+		}
+		if resolved.Config.Email == "" {
+			effective.Problems = append(effective.Problems, SchemaProblem{Path: "email", Message: "not set in any layer"})
+		}
+	}
+	results = append(results, effective)
+
+	if groupsPath, err := GetGroupsConfigPath(); err == nil {
+		result, err := validateFile("groups", groupsPath, groupsSchemaFile, GroupsJSONSchema(), func(doc map[string]interface{}) []SchemaProblem {
+			return duplicateProblems(doc, "groups", "name")
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if result != nil {
+			results = append(results, result)
+		}
+	}
+
+	if searchesPath, err := GetSavedSearchesPath(); err == nil {
+		result, err := validateFile("saved searches", searchesPath, searchesSchemaFile, SavedSearchesJSONSchema(), func(doc map[string]interface{}) []SchemaProblem {
+			problems := duplicateProblems(doc, "searches", "name")
+			searches, _ := doc["searches"].([]interface{})
+			for i, item := range searches {
+				search, _ := item.(map[string]interface{})
+				if query, ok := search["query"].(string); ok {
+					if _, err := ParseQuery(query); err != nil {
+						problems = append(problems, SchemaProblem{Path: fmt.Sprintf("searches[%d].query", i), Message: err.Error()})
+					}
+				}
+			}
+			return problems
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if result != nil {
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// ValidateConfig prints the result of ValidateConfigFiles and returns an
+// error if any file has problems
+func ValidateConfig(asJSON bool) error {
+	results, err := ValidateConfigFiles()
+	if err != nil {
+		return err
+	}
+	count := 0
+	for _, result := range results {
+		count += len(result.Problems)
+	}
+	if asJSON {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode results: %v", err)
+		}
+		fmt.Println(string(data))
+	} else {
+		for _, result := range results {
+			label := result.Name
+			if result.Path != "" {
+				label += " (" + displayPath(result.Path) + ")"
+			}
+			if len(result.Problems) == 0 {
+				fmt.Printf("✓ %s\n", label)
+			} else {
+				fmt.Printf("✗ %s\n", label)
+			}
+			if result.Migrates {
+				fmt.Printf("   schema version %d, upgraded when next loaded (a backup is kept)\n", result.Version)
+			}
+			for _, p := range result.Problems {
+				fmt.Printf("   %s\n", p)
+			}
+		}
+	}
+	if count > 0 {
+		return fmt.Errorf("configuration has %d problem(s)", count)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package mailos
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigMigrations(t *testing.T) {
+	home := setupConfigLayers(t, `{"emailProvider": "fastgmail", "appPassword": "pw", "fromEmail": "me@example.com"}`, "")
+	t.Chdir(home)
+	path := filepath.Join(home, ".email", "config.json")
+	original, _ := os.ReadFile(path)
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Provider != ProviderGmail || config.Email != "me@example.com" || config.Password != "pw" || config.SchemaVersion != ConfigSchemaVersion {
+		t.Errorf("Unexpected migrated config: %+v", config)
+	}
+
+	// The file was upgraded, and kept as it was before
+	if backup, err := os.ReadFile(path + ".v0.bak"); err != nil || string(backup) != string(original) {
+		t.Errorf("Expected the original backed up, got %q, %v", backup, err)
+	}
+	var saved map[string]interface{}
+	data, _ := os.ReadFile(path)
+	json.Unmarshal(data, &saved)
+	if saved["schema_version"] != float64(ConfigSchemaVersion) || saved["emailProvider"] != nil || saved["provider"] != ProviderGmail {
+		t.Errorf("Expected the file upgraded, got %s", data)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the file to stay private, got %v", info.Mode())
+	}
+
+	// Upgraded files load as they are
+	os.Remove(path + ".v0.bak")
+	if _, err := LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".v0.bak"); !os.IsNotExist(err) {
+		t.Errorf("Expected no second migration")
+	}
+
+	// Files from a newer mailos aren't misread
+	os.WriteFile(path, []byte(`{"schema_version": 99, "provider": "gmail", "email": "me@example.com"}`), 0600)
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "schema version 99") {
+		t.Errorf("Expected a newer schema refused, got %v", err)
+	}
+}
+
+func TestMigrationSteps(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.json")
+	os.WriteFile(path, []byte(`{"name": "x"}`), 0644)
+	var applied []int
+	file := &schemaFile{Name: "test", Version: 2, Migrations: []Migration{
+		{Version: 1, Apply: func(doc map[string]interface{}) error { applied = append(applied, 1); doc["a"] = true; return nil }},
+		{Version: 2, Apply: func(doc map[string]interface{}) error { applied = append(applied, 2); doc["b"] = doc["a"]; return nil }},
+	}}
+
+	data, err := loadVersionedFile(path, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 2 || !strings.Contains(string(data), `"b": true`) {
+		t.Errorf("Expected both migrations in order, got %v: %s", applied, data)
+	}
+	// A backup before each step
+	if v1, err := os.ReadFile(path + ".v1.bak"); err != nil || !strings.Contains(string(v1), `"schema_version": 1`) || strings.Contains(string(v1), `"b"`) {
+		t.Errorf("Unexpected backup before the second step: %s, %v", v1, err)
+	}
+	if v0, _ := os.ReadFile(path + ".v0.bak"); string(v0) != `{"name": "x"}` {
+		t.Errorf("Unexpected first backup: %s", v0)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0644 {
+		t.Errorf("Expected the mode kept, got %v", info.Mode())
+	}
+}
+
+func TestGroupsAndInboxVersions(t *testing.T) {
+	home := setupTestGroups(t)
+	groupsPath := filepath.Join(home, ".email", "groups.json")
+	os.WriteFile(groupsPath, []byte(`{"groups": [{"name": "team", "emails": ["a@example.com"]}]}`), 0644)
+
+	config, err := LoadGroupsConfig()
+	if err != nil || len(config.Groups) != 1 || config.SchemaVersion != GroupsSchemaVersion {
+		t.Fatalf("Unexpected groups: %+v, %v", config, err)
+	}
+	if _, err := os.Stat(groupsPath + ".v0.bak"); err != nil {
+		t.Errorf("Expected a backup: %v", err)
+	}
+
+	if err := SaveGlobalInbox("me@example.com", &InboxData{AccountEmail: "me@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	inbox, err := LoadGlobalInbox("me@example.com")
+	if err != nil || inbox.SchemaVersion != InboxSchemaVersion {
+		t.Errorf("Expected the inbox saved with its version, got %+v, %v", inbox, err)
+	}
+}
+
+func TestValidateConfigFiles(t *testing.T) {
+	home := setupConfigLayers(t,
+		`{"emailProvider": "gmail", "appPassword": "pw", "fromEmail": "me@example.com", "form_name": "Me",
+		  "accounts": [{"email": "work@example.com", "provider": "gmial"}, {"email": "Work@Example.com", "provider": "gmail"}, {"provider": "zoho"}]}`,
+		`{"provider": "", "from_email": "bob", "reply": {"posting": "side", "quote_levels": -3}, "ai": {"max_tokens": "lots"}}`)
+	globalPath := filepath.Join(home, ".email", "config.json")
+	original, _ := os.ReadFile(globalPath)
+
+	results, err := ValidateConfigFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	problems := map[string][]string{}
+	for _, result := range results {
+		names = append(names, result.Name)
+		for _, p := range result.Problems {
+			problems[result.Name] = append(problems[result.Name], p.String())
+		}
+	}
+	if strings.Join(names, ", ") != "global config, local config, effective config" {
+		t.Errorf("Unexpected files: %v", names)
+	}
+	if !results[0].Migrates || results[0].Version != 0 {
+		t.Errorf("Expected the legacy file checked as upgraded, got %+v", results[0])
+	}
+
+	want := map[string][]string{
+		"global config": {
+			`accounts[0].provider: "gmial" is not one of fastmail, gmail, outlook, yahoo, zoho`,
+			`accounts[2]: missing required field "email"`,
+			`form_name: unknown field`,
+			`accounts[1].email: "Work@Example.com" is already used by accounts[0]`,
+		},
+		"local config": {
+			`ai.max_tokens: expected integer, got string`,
+			`from_email: "bob" is not a valid email address`,
+			`reply.posting: "side" is not one of top, bottom`,
+			`reply.quote_levels: -3 is less than -1`,
+		},
+	}
+	for name, lines := range want {
+		if strings.Join(problems[name], "\n") != strings.Join(lines, "\n") {
+			t.Errorf("Unexpected problems in %s:\n%s", name, strings.Join(problems[name], "\n"))
+		}
+	}
+	// The legacy fields count once upgraded, so only the bad type stops it loading
+	if effective := problems["effective config"]; len(effective) != 1 || !strings.Contains(effective[0], "max_tokens") {
+		t.Errorf("Unexpected problems in the effective config: %v", effective)
+	}
+
+	// Validating doesn't upgrade anything
+	if data, _ := os.ReadFile(globalPath); string(data) != string(original) {
+		t.Errorf("Expected the file untouched, got %s", data)
+	}
+	if _, err := os.Stat(globalPath + ".v0.bak"); !os.IsNotExist(err) {
+		t.Errorf("Expected no backup from validating")
+	}
+	if err := ValidateConfig(false); err == nil || !strings.Contains(err.Error(), "9 problem(s)") {
+		t.Errorf("Expected the problems counted, got %v", err)
+	}
+}
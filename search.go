@@ -117,8 +117,15 @@ func SearchCommand(args []string) error {
 
 	fmt.Println("Searching emails...")
 	
-	// First get emails using basic read options
-	emails, err := Read(advOpts.ReadOptions)
+	// Let the server narrow the emails down as far as it can, then apply
+	// the advanced filters to what comes back
+	readOpts := advOpts.ReadOptions
+	serverQuery, err := advOpts.ServerQuery()
+	if err != nil {
+		return fmt.Errorf("invalid search query: %v", err)
+	}
+	readOpts.Query = serverQuery
+	emails, err := Read(readOpts)
 	if err != nil {
 		return fmt.Errorf("SEARCH_READ_ERROR: Failed to retrieve emails from IMAP server or local storage. This could be due to: (1) IMAP connection issues, (2) Authentication problems, (3) Missing email configuration, (4) Local storage access errors. Original error: %v", err)
 	}
@@ -2,7 +2,6 @@ package mailos
 
 import (
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -14,7 +13,7 @@ type AdvancedSearchOptions struct {
 	ReadOptions
 	
 	// Advanced filters
-	Query           string    // Complex query with boolean operators
+	Query           string    // Search query; see ParseQuery
 	FuzzyThreshold  float64   // Fuzzy matching threshold (0.0-1.0)
 	MinSize         int64     // Minimum email size in bytes
 	MaxSize         int64     // Maximum email size in bytes
@@ -28,20 +27,6 @@ type AdvancedSearchOptions struct {
 	WholeWords      bool      // Match whole words only
 }
 
-// SearchQuery represents a parsed search query with boolean operators
-type SearchQuery struct {
-	Terms     []SearchTerm
-	Operator  string // "AND", "OR"
-}
-
-// SearchTerm represents individual search terms
-type SearchTerm struct {
-	Text     string
-	Field    string // "from", "to", "subject", "body", "any"
-	Negate   bool   // NOT operator
-	Fuzzy    bool   // Enable fuzzy for this term
-}
-
 // FuzzyMatch calculates similarity between two strings using Levenshtein distance
 func FuzzyMatch(s1, s2 string, threshold float64) bool {
 	if threshold <= 0 {
@@ -94,97 +79,6 @@ func levenshteinDistance(s1, s2 string) int {
 	return matrix[len(s1)][len(s2)]
 }
 
-// ParseSearchQuery parses a complex search query with boolean operators
-func ParseSearchQuery(query string) (*SearchQuery, error) {
-	if query == "" {
-		return &SearchQuery{}, nil
-	}
-	
-	// Simple parser for boolean queries
-	// Supports: term1 AND term2, term1 OR term2, NOT term, field:value
-	
-	query = strings.TrimSpace(query)
-	
-	// Split by AND/OR operators (case insensitive)
-	var terms []SearchTerm
-	var operator string = "AND" // default
-	
-	// Check for OR operator
-	if strings.Contains(strings.ToUpper(query), " OR ") {
-		operator = "OR"
-		parts := regexp.MustCompile(`(?i)\s+or\s+`).Split(query, -1)
-		for _, part := range parts {
-			term, err := parseSearchTerm(strings.TrimSpace(part))
-			if err != nil {
-				return nil, err
-			}
-			terms = append(terms, term)
-		}
-	} else {
-		// Split by AND (default) or spaces
-		parts := regexp.MustCompile(`(?i)\s+and\s+|\s+`).Split(query, -1)
-		for _, part := range parts {
-			if strings.TrimSpace(part) == "" {
-				continue
-			}
-			term, err := parseSearchTerm(strings.TrimSpace(part))
-			if err != nil {
-				return nil, err
-			}
-			terms = append(terms, term)
-		}
-	}
-	
-	return &SearchQuery{
-		Terms:    terms,
-		Operator: operator,
-	}, nil
-}
-
-// parseSearchTerm parses individual search terms with field specifiers and NOT operator
-func parseSearchTerm(term string) (SearchTerm, error) {
-	searchTerm := SearchTerm{
-		Field: "any",
-		Fuzzy: true, // Enable fuzzy by default
-	}
-	
-	// Handle NOT operator
-	if strings.HasPrefix(strings.ToUpper(term), "NOT ") {
-		searchTerm.Negate = true
-		term = strings.TrimSpace(term[4:])
-	}
-	
-	// Handle field specifiers (field:value)
-	if strings.Contains(term, ":") {
-		parts := strings.SplitN(term, ":", 2)
-		if len(parts) == 2 {
-			field := strings.ToLower(strings.TrimSpace(parts[0]))
-			value := strings.TrimSpace(parts[1])
-			
-			// Remove quotes if present
-			if (strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"")) ||
-			   (strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'")) {
-				value = value[1 : len(value)-1]
-			}
-			
-			searchTerm.Field = field
-			searchTerm.Text = value
-		} else {
-			searchTerm.Text = term
-		}
-	} else {
-		// Remove quotes if present
-		if (strings.HasPrefix(term, "\"") && strings.HasSuffix(term, "\"")) ||
-		   (strings.HasPrefix(term, "'") && strings.HasSuffix(term, "'")) {
-			term = term[1 : len(term)-1]
-			searchTerm.Fuzzy = false // Exact match for quoted terms
-		}
-		searchTerm.Text = term
-	}
-	
-	return searchTerm, nil
-}
-
 // ParseDateRange parses flexible date range expressions
 func ParseDateRange(dateRange string) (since, until time.Time, err error) {
 	dateRange = strings.ToLower(strings.TrimSpace(dateRange))
@@ -343,19 +237,44 @@ func ParseSize(sizeStr string) (int64, error) {
 	return int64(num * float64(multiplier)), nil
 }
 
+// ServerQuery is the part of the search the server, or the local archive,
+// can run before emails are fetched: sizes, attachments and, without fuzzy
+// matching, the query itself. It returns nil when there's nothing to send.
+func (opts AdvancedSearchOptions) ServerQuery() (*Query, error) {
+	q, err := ParseQuery(opts.Query)
+	if err != nil {
+		return nil, err
+	}
+	var nodes []*QueryNode
+	if !opts.EnableFuzzy {
+		// Fuzzy matches can only be found by looking at every email
+		nodes = append(nodes, q.Root)
+	}
+	if opts.MinSize > 0 {
+		nodes = append(nodes, &QueryNode{Kind: queryTerm, Field: "larger", size: opts.MinSize - 1})
+	}
+	if opts.MaxSize > 0 {
+		nodes = append(nodes, &QueryNode{Kind: queryTerm, Field: "smaller", size: opts.MaxSize + 1})
+	}
+	if opts.HasAttachments || opts.AttachmentSize > 0 {
+		nodes = append(nodes, &QueryNode{Kind: queryTerm, Field: "has", Value: "attachment"})
+	}
+	root := andQueryNodes(nodes...)
+	if root == nil {
+		return nil, nil
+	}
+	return &Query{Text: opts.Query, Root: root}, nil
+}
+
 // AdvancedSearchEmails performs advanced email search with all capabilities
 func AdvancedSearchEmails(emails []*Email, opts AdvancedSearchOptions) ([]*Email, error) {
 	var results []*Email
 	
-	// Parse search query if provided
-	var searchQuery *SearchQuery
-	var err error
-	if opts.Query != "" {
-		searchQuery, err = ParseSearchQuery(opts.Query)
-		if err != nil {
-			return nil, fmt.Errorf("invalid search query: %v", err)
-		}
+	searchQuery, err := ParseQuery(opts.Query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid search query: %v", err)
 	}
+	contains := queryMatcher(opts)
 	
 	// Parse date range if provided
 	var sinceDateRange, untilDateRange time.Time
@@ -369,11 +288,11 @@ func AdvancedSearchEmails(emails []*Email, opts AdvancedSearchOptions) ([]*Email
 	for _, email := range emails {
 		// Apply size filters
 		if opts.MinSize > 0 || opts.MaxSize > 0 {
-			emailSize := calculateEmailSize(email)
-			if opts.MinSize > 0 && emailSize < opts.MinSize {
+			size := emailSize(email)
+			if opts.MinSize > 0 && size < opts.MinSize {
 				continue
 			}
-			if opts.MaxSize > 0 && emailSize > opts.MaxSize {
+			if opts.MaxSize > 0 && size > opts.MaxSize {
 				continue
 			}
 		}
@@ -439,10 +358,8 @@ func AdvancedSearchEmails(emails []*Email, opts AdvancedSearchOptions) ([]*Email
 		}
 		
 		// Apply complex query search
-		if searchQuery != nil && len(searchQuery.Terms) > 0 {
-			if !matchesQuery(email, searchQuery, opts) {
-				continue
-			}
+		if !searchQuery.Root.match(email, contains) {
+			continue
 		}
 		
 		results = append(results, email)
@@ -496,67 +413,13 @@ func matchesField(field, term string, enableFuzzy bool, fuzzyThreshold float64,
 	return strings.Contains(field, term)
 }
 
-// matchesQuery checks if an email matches a complex search query
-func matchesQuery(email *Email, query *SearchQuery, opts AdvancedSearchOptions) bool {
-	matches := make([]bool, len(query.Terms))
-	
-	for i, term := range query.Terms {
-		matches[i] = matchesTerm(email, term, opts)
-		
-		// Apply NOT operator
-		if term.Negate {
-			matches[i] = !matches[i]
-		}
-	}
-	
-	// Apply boolean operator
-	if query.Operator == "OR" {
-		for _, match := range matches {
-			if match {
-				return true
-			}
-		}
-		return false
-	} else { // AND (default)
-		for _, match := range matches {
-			if !match {
-				return false
-			}
-		}
-		return true
-	}
-}
-
-// matchesTerm checks if an email matches a single search term
-func matchesTerm(email *Email, term SearchTerm, opts AdvancedSearchOptions) bool {
-	fuzzyThreshold := opts.FuzzyThreshold
-	if !term.Fuzzy {
-		fuzzyThreshold = 0 // Exact match for non-fuzzy terms
-	}
-	
-	switch term.Field {
-	case "from":
-		return matchesField(email.From, term.Text, opts.EnableFuzzy && term.Fuzzy, fuzzyThreshold, opts.CaseSensitive)
-	case "to":
-		for _, to := range email.To {
-			if matchesField(to, term.Text, opts.EnableFuzzy && term.Fuzzy, fuzzyThreshold, opts.CaseSensitive) {
-				return true
-			}
-		}
-		return false
-	case "subject":
-		return matchesField(email.Subject, term.Text, opts.EnableFuzzy && term.Fuzzy, fuzzyThreshold, opts.CaseSensitive)
-	case "body":
-		return matchesField(email.Body, term.Text, opts.EnableFuzzy && term.Fuzzy, fuzzyThreshold, opts.CaseSensitive)
-	case "any", "":
-		// Search in all fields
-		return matchesField(email.From, term.Text, opts.EnableFuzzy && term.Fuzzy, fuzzyThreshold, opts.CaseSensitive) ||
-			   matchesField(email.Subject, term.Text, opts.EnableFuzzy && term.Fuzzy, fuzzyThreshold, opts.CaseSensitive) ||
-			   matchesField(email.Body, term.Text, opts.EnableFuzzy && term.Fuzzy, fuzzyThreshold, opts.CaseSensitive) ||
-			   matchesFieldSlice(email.To, term.Text, opts.EnableFuzzy && term.Fuzzy, fuzzyThreshold, opts.CaseSensitive)
+// queryMatcher compares query terms with the search's fuzzy and case
+// settings. Quoted phrases are always matched exactly.
+func queryMatcher(opts AdvancedSearchOptions) func(text string, term *QueryNode) bool {
+	return func(text string, term *QueryNode) bool {
+		fuzzy := opts.EnableFuzzy && !term.Phrase
+		return matchesField(text, term.Value, fuzzy, opts.FuzzyThreshold, opts.CaseSensitive)
 	}
-	
-	return false
 }
 
 // matchesFieldSlice checks if any string in a slice matches the search term
@@ -0,0 +1,792 @@
+package mailos
+
+import (
+	"fmt"
+	"net/textproto"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/emersion/go-imap"
+)
+
+// Search queries use one Gmail-style grammar wherever a query is accepted:
+// search, stats, saved searches and the tui filter.
+//
+//	query   = and
+//	and     = or { ["AND"] or }
+//	or      = unary { "OR" unary }
+//	unary   = ("-" | "NOT") unary | primary
+//	primary = "(" and ")" | field ":(" and ")" | term
+//	term    = [field ":"] (word | "quoted phrase")
+//
+// As in Gmail, OR binds tighter than the implicit AND: a OR b c is
+// (a OR b) AND c.
+//
+// A query compiles to an in-memory predicate (Match), to a WHERE clause over
+// the archive (SQL) and to IMAP SEARCH criteria (IMAPCriteria). Terms the
+// archive or server can't express become "match everything" there, and the
+// caller runs Match over what comes back.
+
+// QueryError is a mistake in a query, at a byte offset into it
+type QueryError struct {
+	Query   string
+	Pos     int
+	Message string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Message, e.Pos+1)
+}
+
+// Caret shows the query with a ^ under the mistake
+func (e *QueryError) Caret() string {
+	width := len([]rune(e.Query[:min(e.Pos, len(e.Query))]))
+	return fmt.Sprintf("  %s\n  %s^", e.Query, strings.Repeat(" ", width))
+}
+
+type queryKind int
+
+const (
+	queryTerm queryKind = iota
+	queryAnd
+	queryOr
+	queryNot
+)
+
+// QueryNode is a term, or an AND, OR or NOT of other nodes
+type QueryNode struct {
+	Kind     queryKind
+	Children []*QueryNode
+	Field    string // text, from, to, cc, subject, body, has, filename, larger, smaller, before, after, is or in
+	Value    string
+	Pos      int
+	Phrase   bool // Value was quoted, so fuzzy matching doesn't apply
+
+	time     time.Time // before and after
+	relative bool      // time came from an age such as newer_than:2d
+	size     int64     // larger and smaller
+}
+
+// Query is a parsed search query. An empty query matches every email.
+type Query struct {
+	Text string
+	Root *QueryNode
+}
+
+// queryFields maps each field, and its aliases, to the field it's matched as
+var queryFields = map[string]string{
+	"from": "from", "to": "to", "cc": "cc", "subject": "subject", "body": "body",
+	"has": "has", "filename": "filename", "larger": "larger", "smaller": "smaller",
+	"before": "before", "after": "after", "until": "before", "since": "after",
+	"older_than": "before", "newer_than": "after", "is": "is", "in": "in",
+}
+
+// queryStates are the is: values and the flag each one checks
+var queryStates = map[string]string{"unread": imap.SeenFlag, "read": imap.SeenFlag, "flagged": imap.FlaggedFlag, "starred": imap.FlaggedFlag}
+
+type queryTokenKind int
+
+const (
+	tokenWord queryTokenKind = iota
+	tokenPhrase
+	tokenOpen
+	tokenClose
+	tokenMinus
+	tokenEnd
+)
+
+type queryToken struct {
+	kind queryTokenKind
+	text string
+	pos  int
+}
+
+// lexQuery splits a query into words, quoted phrases, parentheses and the
+// leading - of a negated term
+func lexQuery(query string) ([]queryToken, error) {
+	var tokens []queryToken
+	i := 0
+	for i < len(query) {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(':
+			tokens = append(tokens, queryToken{tokenOpen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, queryToken{tokenClose, ")", i})
+			i++
+		case c == '"':
+			end := strings.IndexByte(query[i+1:], '"')
+			if end < 0 {
+				return nil, &QueryError{query, i, "unclosed quote"}
+			}
+			tokens = append(tokens, queryToken{tokenPhrase, query[i+1 : i+1+end], i})
+			i += end + 2
+		case c == '-' && i+1 < len(query) && !strings.ContainsRune(" \t\n)", rune(query[i+1])):
+			tokens = append(tokens, queryToken{tokenMinus, "-", i})
+			i++
+		default:
+			start := i
+			for i < len(query) && !strings.ContainsRune(" \t\n()\"", rune(query[i])) {
+				i++
+			}
+			tokens = append(tokens, queryToken{tokenWord, query[start:i], start})
+		}
+	}
+	return append(tokens, queryToken{tokenEnd, "", len(query)}), nil
+}
+
+type queryParser struct {
+	query  string
+	tokens []queryToken
+	next   int
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.next]
+}
+
+func (p *queryParser) take() queryToken {
+	t := p.tokens[p.next]
+	if t.kind != tokenEnd {
+		p.next++
+	}
+	return t
+}
+
+func (p *queryParser) fail(pos int, format string, args ...interface{}) error {
+	return &QueryError{p.query, pos, fmt.Sprintf(format, args...)}
+}
+
+// ParseQuery parses a search query. Mistakes are reported as a *QueryError
+// with their position.
+func ParseQuery(text string) (*Query, error) {
+	tokens, err := lexQuery(text)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{query: text, tokens: tokens}
+	q := &Query{Text: text}
+	if p.peek().kind == tokenEnd {
+		return q, nil
+	}
+	if q.Root, err = p.parseAnd("text"); err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEnd {
+		return nil, p.fail(t.pos, "unexpected %q", t.text)
+	}
+	return q, nil
+}
+
+// parseAnd parses terms that all have to match. field is the field bare
+// words search, which from:( ... ) changes for the words inside.
+func (p *queryParser) parseAnd(field string) (*QueryNode, error) {
+	node := &QueryNode{Kind: queryAnd, Pos: p.peek().pos}
+	for {
+		t := p.peek()
+		if t.kind == tokenEnd || t.kind == tokenClose {
+			break
+		}
+		if t.kind == tokenWord && t.text == "AND" && len(node.Children) > 0 {
+			p.take()
+			if next := p.peek(); next.kind == tokenEnd || next.kind == tokenClose {
+				return nil, p.fail(t.pos, "expected a search term after AND")
+			}
+			continue
+		}
+		child, err := p.parseOr(field)
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, child)
+	}
+	if len(node.Children) == 1 {
+		return node.Children[0], nil
+	}
+	return node, nil
+}
+
+// parseOr parses terms joined by OR
+func (p *queryParser) parseOr(field string) (*QueryNode, error) {
+	first, err := p.parseOperand(field)
+	if err != nil {
+		return nil, err
+	}
+	node := &QueryNode{Kind: queryOr, Children: []*QueryNode{first}, Pos: first.Pos}
+	for p.peek().kind == tokenWord && p.peek().text == "OR" {
+		or := p.take()
+		if next := p.peek(); next.kind == tokenEnd || next.kind == tokenClose {
+			return nil, p.fail(or.pos, "expected a search term after OR")
+		}
+		next, err := p.parseOperand(field)
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, next)
+	}
+	if len(node.Children) == 1 {
+		return first, nil
+	}
+	return node, nil
+}
+
+// parseOperand parses a term where one is required, so a stray OR or AND
+// is an error rather than a word
+func (p *queryParser) parseOperand(field string) (*QueryNode, error) {
+	if t := p.peek(); t.kind == tokenWord && (t.text == "OR" || t.text == "AND") {
+		return nil, p.fail(t.pos, "expected a search term before %s", t.text)
+	}
+	return p.parseUnary(field)
+}
+
+func (p *queryParser) parseUnary(field string) (*QueryNode, error) {
+	t := p.peek()
+	if t.kind == tokenMinus || (t.kind == tokenWord && t.text == "NOT") {
+		p.take()
+		if next := p.peek(); next.kind == tokenEnd || next.kind == tokenClose {
+			return nil, p.fail(t.pos, "expected a search term after %s", t.text)
+		}
+		child, err := p.parseOperand(field)
+		if err != nil {
+			return nil, err
+		}
+		return &QueryNode{Kind: queryNot, Children: []*QueryNode{child}, Pos: t.pos}, nil
+	}
+	return p.parsePrimary(field)
+}
+
+func (p *queryParser) parsePrimary(field string) (*QueryNode, error) {
+	t := p.take()
+	switch t.kind {
+	case tokenOpen:
+		return p.parseGroup(t, field)
+	case tokenPhrase:
+		return p.phrase(field, t)
+	case tokenWord:
+		key, value, found := strings.Cut(t.text, ":")
+		// A URL's scheme isn't a field
+		if !found || !isFieldName(key) || strings.HasPrefix(value, "//") {
+			return p.term(field, t.text, t.pos)
+		}
+		name, known := queryFields[strings.ToLower(key)]
+		if !known {
+			return nil, p.fail(t.pos, "unknown search field %q", key)
+		}
+		if value != "" {
+			return p.term(name, value, t.pos+len(key)+1)
+		}
+		// A value right after the colon: from:"Ana Smith" or from:(ana OR bob)
+		next := p.peek()
+		if next.pos == t.pos+len(t.text) {
+			if next.kind == tokenPhrase {
+				return p.phrase(name, p.take())
+			}
+			if next.kind == tokenOpen && isTextField(name) {
+				return p.parseGroup(p.take(), name)
+			}
+		}
+		return nil, p.fail(t.pos+len(t.text), "expected a value after %s:", key)
+	case tokenEnd:
+		return nil, p.fail(t.pos, "expected a search term at the end of the query")
+	}
+	return nil, p.fail(t.pos, "unexpected %q", t.text)
+}
+
+func (p *queryParser) parseGroup(open queryToken, field string) (*QueryNode, error) {
+	if p.peek().kind == tokenClose {
+		return nil, p.fail(open.pos, "empty parentheses")
+	}
+	node, err := p.parseAnd(field)
+	if err != nil {
+		return nil, err
+	}
+	if p.take().kind != tokenClose {
+		return nil, p.fail(open.pos, "unclosed parenthesis")
+	}
+	return node, nil
+}
+
+// isFieldName reports whether s looks like a field, so a typo in one is an
+// error rather than text that never matches
+func isFieldName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsLetter(r) && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// isTextField reports whether a field's values are text to look for
+func isTextField(field string) bool {
+	switch field {
+	case "text", "from", "to", "cc", "subject", "body", "filename":
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) phrase(field string, t queryToken) (*QueryNode, error) {
+	node, err := p.term(field, t.text, t.pos)
+	if node != nil {
+		node.Phrase = true
+	}
+	return node, err
+}
+
+// term checks a field's value and builds its node
+func (p *queryParser) term(field, value string, pos int) (*QueryNode, error) {
+	node := &QueryNode{Kind: queryTerm, Field: field, Value: value, Pos: pos}
+	lower := strings.ToLower(value)
+	switch field {
+	case "has":
+		if lower != "attachment" && lower != "attachments" {
+			return nil, p.fail(pos, "has: expects attachment, not %q", value)
+		}
+		node.Value = "attachment"
+	case "is":
+		if _, ok := queryStates[lower]; !ok {
+			return nil, p.fail(pos, "is: expects unread, read, flagged or starred, not %q", value)
+		}
+		node.Value = lower
+	case "larger", "smaller":
+		size, err := ParseSize(value)
+		if err != nil || size <= 0 {
+			return nil, p.fail(pos, "%s: expects a size like 500K or 2M, not %q", field, value)
+		}
+		node.size = size
+	case "before", "after":
+		if relativeAgePattern.MatchString(lower) {
+			node.time, _ = parseSearchDate(lower)
+			node.relative = true
+		} else {
+			t, err := parseSearchDate(value)
+			if err != nil {
+				return nil, p.fail(pos, "expected a date like 2024-05-01 or an age like 30d, not %q", value)
+			}
+			node.time = t
+		}
+	case "in":
+		// Folders and saved searches are resolved when the query is run
+	}
+	return node, nil
+}
+
+// ResolveQuery parses a query and replaces in: terms that name a saved
+// search with that search's query
+func ResolveQuery(text string) (*Query, error) {
+	q, err := ParseQuery(text)
+	if err != nil {
+		return nil, err
+	}
+	config, err := LoadSavedSearches()
+	if err != nil {
+		return nil, err
+	}
+	if q.Root, err = expandSavedSearches(q.Root, config, nil); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func expandSavedSearches(node *QueryNode, config *SavedSearchConfig, seen []string) (*QueryNode, error) {
+	if node == nil {
+		return nil, nil
+	}
+	if node.Kind != queryTerm {
+		for i, child := range node.Children {
+			expanded, err := expandSavedSearches(child, config, seen)
+			if err != nil {
+				return nil, err
+			}
+			node.Children[i] = expanded
+		}
+		return node, nil
+	}
+	if node.Field != "in" {
+		return node, nil
+	}
+	for _, search := range config.Searches {
+		if !strings.EqualFold(search.Name, node.Value) {
+			continue
+		}
+		for _, name := range seen {
+			if strings.EqualFold(name, search.Name) {
+				return nil, fmt.Errorf("saved search '%s' refers to itself", search.Name)
+			}
+		}
+		inner, err := ParseQuery(search.Query)
+		if err != nil {
+			return nil, fmt.Errorf("saved search '%s': %v", search.Name, err)
+		}
+		if inner.Root == nil {
+			// An empty query is every email
+			return &QueryNode{Kind: queryAnd, Pos: node.Pos}, nil
+		}
+		return expandSavedSearches(inner.Root, config, append(seen, search.Name))
+	}
+	return node, nil
+}
+
+// andQueryNodes joins nodes that all have to match, skipping empty queries
+func andQueryNodes(nodes ...*QueryNode) *QueryNode {
+	node := &QueryNode{Kind: queryAnd}
+	for _, n := range nodes {
+		if n != nil {
+			node.Children = append(node.Children, n)
+		}
+	}
+	switch len(node.Children) {
+	case 0:
+		return nil
+	case 1:
+		return node.Children[0]
+	}
+	return node
+}
+
+// Match reports whether an email matches the query
+func (q *Query) Match(email *Email) bool {
+	return q.Root.match(email, containsQueryTerm)
+}
+
+// containsQueryTerm is Match's text comparison: a substring, ignoring case
+func containsQueryTerm(text string, term *QueryNode) bool {
+	return strings.Contains(strings.ToLower(text), strings.ToLower(term.Value))
+}
+
+// Filter keeps the emails that match the query
+func (q *Query) Filter(emails []*Email) []*Email {
+	if q.Root == nil {
+		return emails
+	}
+	var kept []*Email
+	for _, email := range emails {
+		if q.Match(email) {
+			kept = append(kept, email)
+		}
+	}
+	return kept
+}
+
+// match evaluates the node, comparing text with contains
+func (n *QueryNode) match(email *Email, contains func(text string, term *QueryNode) bool) bool {
+	if n == nil {
+		return true
+	}
+	switch n.Kind {
+	case queryAnd:
+		for _, child := range n.Children {
+			if !child.match(email, contains) {
+				return false
+			}
+		}
+		return true
+	case queryOr:
+		for _, child := range n.Children {
+			if child.match(email, contains) {
+				return true
+			}
+		}
+		return false
+	case queryNot:
+		return !n.Children[0].match(email, contains)
+	}
+
+	anyContains := func(values []string) bool {
+		for _, v := range values {
+			if contains(v, n) {
+				return true
+			}
+		}
+		return false
+	}
+	switch n.Field {
+	case "text":
+		return contains(email.From, n) || anyContains(email.To) || anyContains(emailCc(email)) ||
+			contains(email.Subject, n) || contains(emailBody(email), n)
+	case "from":
+		return contains(email.From, n)
+	case "to":
+		return anyContains(email.To)
+	case "cc":
+		return anyContains(emailCc(email))
+	case "subject":
+		return contains(email.Subject, n)
+	case "body":
+		return contains(emailBody(email), n)
+	case "has":
+		return len(email.Attachments) > 0
+	case "filename":
+		return anyContains(email.Attachments)
+	case "larger":
+		return emailSize(email) > n.size
+	case "smaller":
+		return emailSize(email) < n.size
+	case "before":
+		return email.Date.Before(n.time)
+	case "after":
+		return !email.Date.Before(n.time)
+	case "is":
+		set := hasFlag(email.Flags, queryStates[n.Value])
+		if n.Value == "unread" {
+			return !set
+		}
+		return set
+	case "in":
+		folder := email.Folder
+		if folder == "" {
+			folder = "INBOX"
+		}
+		return strings.EqualFold(folder, n.Value)
+	}
+	return false
+}
+
+func emailCc(email *Email) []string {
+	return email.Headers[textproto.CanonicalMIMEHeaderKey("Cc")]
+}
+
+// emailBody is the text body, or the HTML of messages without one
+func emailBody(email *Email) string {
+	if email.Body == "" {
+		return email.BodyHTML
+	}
+	return email.Body
+}
+
+// emailSize is the size the server reported, or an estimate without one
+func emailSize(email *Email) int64 {
+	if email.Size > 0 {
+		return email.Size
+	}
+	return calculateEmailSize(email)
+}
+
+// isPlainASCII reports whether SQLite's LIKE compares s the way Match does:
+// case-insensitively, and with the same text in JSON-encoded columns
+func isPlainASCII(s string) bool {
+	for _, r := range s {
+		if r > unicode.MaxASCII || strings.ContainsRune(`"\<>&`, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// SQL compiles the query to a WHERE clause over the archive's emails table.
+// exact is false when some terms couldn't be expressed, so the rows are a
+// superset of the matches and need Match run over them.
+func (q *Query) SQL() (where string, args []interface{}, exact bool) {
+	if q.Root == nil {
+		return "1=1", nil, true
+	}
+	return q.Root.sql()
+}
+
+func (n *QueryNode) sql() (string, []interface{}, bool) {
+	switch n.Kind {
+	case queryAnd, queryOr:
+		if len(n.Children) == 0 {
+			return "1=1", nil, true
+		}
+		join := " AND "
+		if n.Kind == queryOr {
+			join = " OR "
+		}
+		var parts []string
+		var args []interface{}
+		exact := true
+		for _, child := range n.Children {
+			part, childArgs, childExact := child.sql()
+			parts = append(parts, part)
+			args = append(args, childArgs...)
+			exact = exact && childExact
+		}
+		return "(" + strings.Join(parts, join) + ")", args, exact
+	case queryNot:
+		part, args, exact := n.Children[0].sql()
+		if !exact {
+			// Negating a superset would drop matches
+			return "1=1", nil, false
+		}
+		return "NOT " + part, args, true
+	}
+
+	// NULL would make NOT drop the row instead of keeping it
+	like := func(column string) string { return "COALESCE(" + column + `, '') LIKE ? ESCAPE '\'` }
+	pattern := likePattern(n.Value)
+	if isTextField(n.Field) && !isPlainASCII(n.Value) {
+		return "1=1", nil, false
+	}
+	switch n.Field {
+	case "text":
+		columns := []string{"from_address", "to_addresses", "json_extract(details, '$.headers.Cc')", "subject", "COALESCE(NULLIF(body_text, ''), body_html)"}
+		var parts []string
+		var args []interface{}
+		for _, column := range columns {
+			parts = append(parts, like(column))
+			args = append(args, pattern)
+		}
+		return "(" + strings.Join(parts, " OR ") + ")", args, true
+	case "from":
+		return like("from_address"), []interface{}{pattern}, true
+	case "to":
+		return like("to_addresses"), []interface{}{pattern}, true
+	case "cc":
+		return like("json_extract(details, '$.headers.Cc')"), []interface{}{pattern}, true
+	case "subject":
+		return like("subject"), []interface{}{pattern}, true
+	case "body":
+		return like("COALESCE(NULLIF(body_text, ''), body_html)"), []interface{}{pattern}, true
+	case "has":
+		return "json_array_length(COALESCE(NULLIF(attachments, ''), '[]')) > 0", nil, true
+	case "filename":
+		return `EXISTS (SELECT 1 FROM json_each(COALESCE(NULLIF(emails.attachments, ''), '[]')) WHERE value LIKE ? ESCAPE '\')`, []interface{}{pattern}, true
+	case "before":
+		return "date_sent < ?", []interface{}{archiveTime(n.time)}, true
+	case "after":
+		return "date_sent >= ?", []interface{}{archiveTime(n.time)}, true
+	case "is":
+		switch n.Value {
+		case "unread":
+			return "is_read = 0", nil, true
+		case "read":
+			return "is_read = 1", nil, true
+		}
+		return "EXISTS (SELECT 1 FROM json_each(emails.flags) WHERE value = ?)", []interface{}{imap.FlaggedFlag}, true
+	case "in":
+		if !isPlainASCII(n.Value) {
+			return "1=1", nil, false
+		}
+		return "folder = ? COLLATE NOCASE", []interface{}{n.Value}, true
+	}
+	// Sizes aren't archived
+	return "1=1", nil, false
+}
+
+// IMAPCriteria compiles the query to IMAP SEARCH criteria. Like SQL, exact
+// is false when the server's matches are a superset that needs Match run
+// over them: TEXT and BODY also search other headers and parts, and dates
+// only have day precision.
+func (q *Query) IMAPCriteria() (criteria *imap.SearchCriteria, exact bool) {
+	if q.Root == nil {
+		return imap.NewSearchCriteria(), true
+	}
+	criteria, exact = q.Root.imapCriteria()
+	if criteria == nil {
+		return imap.NewSearchCriteria(), false
+	}
+	return criteria, exact
+}
+
+// imapCriteria returns nil when nothing narrower than everything can be sent
+func (n *QueryNode) imapCriteria() (*imap.SearchCriteria, bool) {
+	switch n.Kind {
+	case queryAnd:
+		criteria := imap.NewSearchCriteria()
+		exact := true
+		for _, child := range n.Children {
+			c, childExact := child.imapCriteria()
+			exact = exact && childExact
+			if c != nil {
+				mergeSearchCriteria(criteria, c)
+			}
+		}
+		return criteria, exact
+	case queryOr:
+		var criteria *imap.SearchCriteria
+		exact := true
+		for i := len(n.Children) - 1; i >= 0; i-- {
+			c, childExact := n.Children[i].imapCriteria()
+			if c == nil {
+				return nil, false
+			}
+			exact = exact && childExact
+			if criteria == nil {
+				criteria = c
+			} else {
+				criteria = &imap.SearchCriteria{Or: [][2]*imap.SearchCriteria{{c, criteria}}}
+			}
+		}
+		return criteria, exact
+	case queryNot:
+		c, exact := n.Children[0].imapCriteria()
+		if c == nil || !exact {
+			return nil, false
+		}
+		return &imap.SearchCriteria{Not: []*imap.SearchCriteria{c}}, true
+	}
+
+	criteria := imap.NewSearchCriteria()
+	switch n.Field {
+	case "text":
+		criteria.Text = []string{n.Value}
+		return criteria, false
+	case "from", "to", "cc", "subject":
+		criteria.Header.Add(n.Field, n.Value)
+		return criteria, true
+	case "body":
+		criteria.Body = []string{n.Value}
+		return criteria, false
+	case "larger":
+		criteria.Larger = uint32(n.size)
+		return criteria, true
+	case "smaller":
+		criteria.Smaller = uint32(n.size)
+		return criteria, true
+	case "before":
+		// SENTBEFORE compares dates only, so include the whole last day
+		criteria.SentBefore = n.time.AddDate(0, 0, 1)
+		return criteria, false
+	case "after":
+		criteria.SentSince = n.time
+		return criteria, false
+	case "is":
+		switch n.Value {
+		case "unread":
+			criteria.WithoutFlags = []string{imap.SeenFlag}
+		case "read":
+			criteria.WithFlags = []string{imap.SeenFlag}
+		default:
+			criteria.WithFlags = []string{imap.FlaggedFlag}
+		}
+		return criteria, true
+	}
+	// has:, filename: and in: have no SEARCH key
+	return nil, false
+}
+
+// mergeSearchCriteria adds src's conditions to dst, so dst matches both
+func mergeSearchCriteria(dst, src *imap.SearchCriteria) {
+	for key, values := range src.Header {
+		for _, v := range values {
+			dst.Header.Add(key, v)
+		}
+	}
+	dst.Body = append(dst.Body, src.Body...)
+	dst.Text = append(dst.Text, src.Text...)
+	dst.WithFlags = append(dst.WithFlags, src.WithFlags...)
+	dst.WithoutFlags = append(dst.WithoutFlags, src.WithoutFlags...)
+	dst.Not = append(dst.Not, src.Not...)
+	dst.Or = append(dst.Or, src.Or...)
+	if src.SentSince.After(dst.SentSince) {
+		dst.SentSince = src.SentSince
+	}
+	if !src.SentBefore.IsZero() && (dst.SentBefore.IsZero() || src.SentBefore.Before(dst.SentBefore)) {
+		dst.SentBefore = src.SentBefore
+	}
+	if src.Larger > dst.Larger {
+		dst.Larger = src.Larger
+	}
+	if src.Smaller > 0 && (dst.Smaller == 0 || src.Smaller < dst.Smaller) {
+		dst.Smaller = src.Smaller
+	}
+}
@@ -0,0 +1,291 @@
+package mailos
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+// queryString prints a parsed query with its grouping made explicit
+func queryString(n *QueryNode) string {
+	if n == nil {
+		return ""
+	}
+	var parts []string
+	for _, child := range n.Children {
+		parts = append(parts, queryString(child))
+	}
+	switch n.Kind {
+	case queryAnd:
+		return "(" + strings.Join(parts, " AND ") + ")"
+	case queryOr:
+		return "(" + strings.Join(parts, " OR ") + ")"
+	case queryNot:
+		return "-" + parts[0]
+	}
+	if n.Phrase {
+		return n.Field + `:"` + n.Value + `"`
+	}
+	return n.Field + ":" + n.Value
+}
+
+func TestParseQuery(t *testing.T) {
+	for query, want := range map[string]string{
+		"":                                 "",
+		"invoice":                          "text:invoice",
+		"from:billing has:attachment":      "(from:billing AND has:attachment)",
+		"a OR b c":                         "((text:a OR text:b) AND text:c)",
+		"a b OR -c AND d":                  "(text:a AND (text:b OR -text:c) AND text:d)",
+		"a AND (b OR c)":                   "(text:a AND (text:b OR text:c))",
+		"-is:read NOT subject:spam":        "(-is:read AND -subject:spam)",
+		`subject:"weekly report" "a:b"`:    `(subject:"weekly report" AND text:"a:b")`,
+		"from:(ana OR bob)":                "(from:ana OR from:bob)",
+		`to:"Ana Smith" Is:Unread`:         `(to:"Ana Smith" AND is:unread)`,
+		"since:30d until:2024-05-03":       "(after:30d AND before:2024-05-03)",
+		"older_than:1y newer_than:2w":      "(before:1y AND after:2w)",
+		"http://example.com a-b -":         "(text:http://example.com AND text:a-b AND text:-)",
+		"in:Archive larger:2M smaller:10K": "(in:Archive AND larger:2M AND smaller:10K)",
+	} {
+		q, err := ParseQuery(query)
+		if err != nil {
+			t.Errorf("%q: %v", query, err)
+			continue
+		}
+		if got := queryString(q.Root); got != want {
+			t.Errorf("%q: expected %s, got %s", query, want, got)
+		}
+	}
+
+	q, _ := ParseQuery("after:2024-05-01 newer_than:3d")
+	if !q.Root.Children[0].time.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("Expected a date at local midnight, got %v", q.Root.Children[0].time)
+	}
+	if age := time.Since(q.Root.Children[1].time); age < 71*time.Hour || age > 73*time.Hour {
+		t.Errorf("Expected newer_than:3d to be 3 days ago, got %v", age)
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		query   string
+		message string
+		pos     int
+	}{
+		{`subject:"weekly`, "unclosed quote", 8},
+		{"(a OR b", "unclosed parenthesis", 0},
+		{"a ()", "empty parentheses", 2},
+		{"a OR", "expected a search term after OR", 2},
+		{"OR a", "expected a search term before OR", 0},
+		{"a OR AND b", "expected a search term before AND", 5},
+		{"a )", `unexpected ")"`, 2},
+		{"label:work", `unknown search field "label"`, 0},
+		{"from: ana", "expected a value after from:", 5},
+		{"has:pdf", `has: expects attachment, not "pdf"`, 4},
+		{"a is:pinned", `is: expects unread, read, flagged or starred, not "pinned"`, 5},
+		{"larger:big", `larger: expects a size like 500K or 2M, not "big"`, 7},
+		{"since:yesterday", `expected a date like 2024-05-01 or an age like 30d, not "yesterday"`, 6},
+		{"a AND", "expected a search term after AND", 2},
+		{"a -(b)  NOT", "expected a search term after NOT", 8},
+		{"size:(a)", `unknown search field "size"`, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := ParseQuery(tt.query)
+			var qerr *QueryError
+			if !errors.As(err, &qerr) {
+				t.Fatalf("Expected a *QueryError, got %v", err)
+			}
+			if qerr.Message != tt.message || qerr.Pos != tt.pos {
+				t.Errorf("Expected %q at %d, got %q at %d", tt.message, tt.pos, qerr.Message, qerr.Pos)
+			}
+		})
+	}
+
+	_, err := ParseQuery("from:ana is:pinned")
+	if err.Error() != `is: expects unread, read, flagged or starred, not "pinned" at position 13` {
+		t.Errorf("Unexpected error text: %v", err)
+	}
+	if caret := err.(*QueryError).Caret(); caret != "  from:ana is:pinned\n              ^" {
+		t.Errorf("Unexpected caret:\n%s", caret)
+	}
+}
+
+func TestQueryMatch(t *testing.T) {
+	day := time.Date(2024, 5, 10, 15, 0, 0, 0, time.Local)
+	email := &Email{
+		From:        "Ana Smith <ana@example.org>",
+		To:          []string{"me@example.com"},
+		Headers:     map[string][]string{"Cc": {"bob@example.org"}},
+		Subject:     "Weekly report",
+		BodyHTML:    "<p>Numbers are up</p>",
+		Date:        day,
+		Attachments: []string{"report.pdf"},
+		Flags:       []string{imap.FlaggedFlag},
+		Size:        3 << 20,
+		Folder:      "Work",
+	}
+	for query, want := range map[string]bool{
+		"":                                      true,
+		"ana":                                   true,
+		"bob":                                   true,
+		"from:ana to:me cc:bob":                 true,
+		"from:bob":                              false,
+		`subject:"weekly report"`:               true,
+		`subject:"report weekly"`:               false,
+		"body:numbers":                          true,
+		"has:attachment filename:pdf":           true,
+		"filename:xlsx":                         false,
+		"larger:2M smaller:4M":                  true,
+		"larger:4M":                             false,
+		"after:2024-05-10 before:2024-05-11":    true,
+		"before:2024-05-10":                     false,
+		"is:unread is:flagged":                  true,
+		"is:read":                               false,
+		"in:work":                               true,
+		"in:INBOX":                              false,
+		"from:carol OR subject:weekly":          true,
+		"-from:ana":                             false,
+		"from:(carol OR ana) -(is:read OR zzz)": true,
+	} {
+		q, err := ParseQuery(query)
+		if err != nil {
+			t.Fatalf("%q: %v", query, err)
+		}
+		if got := q.Match(email); got != want {
+			t.Errorf("%q: expected %v, got %v", query, want, got)
+		}
+	}
+
+	q, _ := ParseQuery("from:ana")
+	if kept := q.Filter([]*Email{email, {From: "bob@example.org"}}); len(kept) != 1 || kept[0] != email {
+		t.Errorf("Expected Filter to keep only Ana's email, got %+v", kept)
+	}
+}
+
+func TestQuerySQL(t *testing.T) {
+	tmpDir := setupTestGroups(t)
+	defer cleanupTestGroups(tmpDir)
+
+	account := "me@example.com"
+	now := time.Now()
+	err := archiveEmails(account, "INBOX", []*Email{
+		{ID: 1, MessageID: "<1@example.com>", From: "Ana <ana@example.org>", To: []string{"me@example.com"}, Subject: "50% off", Date: now.AddDate(0, 0, -1), Attachments: []string{"coupon.pdf"}},
+		{ID: 2, MessageID: "<2@example.com>", From: "bob@example.org", Subject: "Café plans", Date: now.AddDate(0, 0, -5), Flags: []string{imap.SeenFlag, imap.FlaggedFlag}, Headers: map[string][]string{"Cc": {"carol@example.org"}}},
+		{ID: 3, MessageID: "<3@example.com>", From: "carol@example.org", Subject: "Minutes", Body: "see the notes", Date: now.AddDate(0, 0, -40)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := archiveEmails(account, "Archive", []*Email{
+		{ID: 1, MessageID: "<4@example.com>", From: "dan@example.org", Subject: "Old plans", Date: now.AddDate(-1, 0, 0), Flags: []string{imap.SeenFlag}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+		exact bool
+	}{
+		{"", []string{"50% off", "Café plans", "Minutes", "Old plans"}, true},
+		{"<ana@example.org>", []string{"50% off"}, false},
+		{"me@example.com", []string{"50% off"}, true},
+		{"50%", []string{"50% off"}, true},
+		{"cc:carol", []string{"Café plans"}, true},
+		{"body:notes OR filename:coupon", []string{"50% off", "Minutes"}, true},
+		{"has:attachment", []string{"50% off"}, true},
+		{"is:flagged", []string{"Café plans"}, true},
+		{"is:unread newer_than:30d", []string{"50% off"}, true},
+		{"older_than:30d", []string{"Minutes", "Old plans"}, true},
+		{"plans in:archive", []string{"Old plans"}, true},
+		{"CAFÉ", []string{"Café plans"}, false},
+		{"-café", []string{"50% off", "Minutes", "Old plans"}, false},
+		{"-subject:plans", []string{"50% off", "Minutes"}, true},
+		{"-plans -cc:carol", []string{"50% off", "Minutes"}, true},
+		{"smaller:1M is:read", []string{"Café plans", "Old plans"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, _, exact := q.SQL(); exact != tt.exact {
+				t.Errorf("Expected exact %v, got %v", tt.exact, exact)
+			}
+			emails, err := SearchArchive(account, tt.query, ReadOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, email := range emails {
+				got = append(got, email.Subject)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	// Inexact queries are paged after matching
+	emails, _ := SearchArchive(account, "-café", ReadOptions{Limit: 1, Offset: 1})
+	if len(emails) != 1 || emails[0].Subject != "Minutes" {
+		t.Errorf("Expected the second match, got %+v", emails)
+	}
+}
+
+func TestQueryIMAPCriteria(t *testing.T) {
+	q, _ := ParseQuery("from:ana subject:report larger:1M is:unread -is:flagged")
+	criteria, exact := q.IMAPCriteria()
+	if !exact {
+		t.Errorf("Expected header, size and flag terms to be exact")
+	}
+	if criteria.Header.Get("From") != "ana" || criteria.Header.Get("Subject") != "report" || criteria.Larger != 1<<20 {
+		t.Errorf("Unexpected criteria: %+v", criteria)
+	}
+	if len(criteria.WithoutFlags) != 1 || criteria.WithoutFlags[0] != imap.SeenFlag || len(criteria.Not) != 1 || criteria.Not[0].WithFlags[0] != imap.FlaggedFlag {
+		t.Errorf("Unexpected flags: %+v", criteria)
+	}
+
+	q, _ = ParseQuery("after:2024-05-01 before:2024-05-03 (to:bob OR invoice)")
+	criteria, exact = q.IMAPCriteria()
+	if exact {
+		t.Errorf("Expected dates and TEXT to be inexact")
+	}
+	if !criteria.SentSince.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local)) || !criteria.SentBefore.Equal(time.Date(2024, 5, 4, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("Unexpected dates: %v to %v", criteria.SentSince, criteria.SentBefore)
+	}
+	if len(criteria.Or) != 1 || criteria.Or[0][0].Header.Get("To") != "bob" || criteria.Or[0][1].Text[0] != "invoice" {
+		t.Errorf("Unexpected OR: %+v", criteria.Or)
+	}
+
+	// Terms the server can't check are left out, not negated
+	q, _ = ParseQuery("from:ana -has:attachment (filename:pdf OR subject:x)")
+	criteria, exact = q.IMAPCriteria()
+	if exact || len(criteria.Not) != 0 || len(criteria.Or) != 0 || criteria.Header.Get("From") != "ana" {
+		t.Errorf("Expected only FROM sent, got %+v, exact %v", criteria, exact)
+	}
+}
+
+func TestResolveQuery(t *testing.T) {
+	tmpDir := setupTestGroups(t)
+	defer cleanupTestGroups(tmpDir)
+
+	SaveSearch("billing", "from:billing OR subject:invoice")
+	SaveSearch("loop", "in:loop2")
+	SaveSearch("loop2", "in:LOOP")
+
+	q, err := ResolveQuery("in:billing -in:Archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := queryString(q.Root); got != "((from:billing OR subject:invoice) AND -in:Archive)" {
+		t.Errorf("Unexpected expansion: %s", got)
+	}
+	if _, err := ResolveQuery("in:loop"); err == nil || !strings.Contains(err.Error(), "refers to itself") {
+		t.Errorf("Expected a loop refused, got %v", err)
+	}
+}
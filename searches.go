@@ -0,0 +1,324 @@
+package mailos
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SavedSearch is a named query that can be used wherever a folder is
+// accepted. It's evaluated against the local archive each time it's read.
+type SavedSearch struct {
+	Name    string    `json:"name"`
+	Query   string    `json:"query"`
+	Created time.Time `json:"created"`
+}
+
+type SavedSearchConfig struct {
+	SchemaVersion int           `json:"schema_version,omitempty"`
+	Searches      []SavedSearch `json:"searches"`
+}
+
+var relativeAgePattern = regexp.MustCompile(`^(\d+)([dwmy])$`)
+
+func GetSavedSearchesPath() (string, error) {
+	emailDir, err := GetEmailStorageDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(emailDir, "searches.json"), nil
+}
+
+func LoadSavedSearches() (*SavedSearchConfig, error) {
+	path, err := GetSavedSearchesPath()
+	if err != nil {
+		return nil, err
+	}
+
+	config := &SavedSearchConfig{Searches: []SavedSearch{}}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return config, nil
+	}
+
+	data, err := loadVersionedFile(path, searchesSchemaFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read saved searches: %v", err)
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse saved searches: %v", err)
+	}
+	return config, nil
+}
+
+func SaveSavedSearches(config *SavedSearchConfig) error {
+	path, err := GetSavedSearchesPath()
+	if err != nil {
+		return err
+	}
+	if err := EnsureEmailDirectories(); err != nil {
+		return err
+	}
+
+	config.SchemaVersion = SearchesSchemaVersion
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal saved searches: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to save saved searches: %v", err)
+	}
+	return nil
+}
+
+// GetSavedSearch looks a saved search up by name, ignoring case. It returns
+// nil if there's no search with that name.
+func GetSavedSearch(name string) (*SavedSearch, error) {
+	config, err := LoadSavedSearches()
+	if err != nil {
+		return nil, err
+	}
+	for i := range config.Searches {
+		if strings.EqualFold(config.Searches[i].Name, name) {
+			return &config.Searches[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// SaveSearch creates or replaces the saved search called name
+func SaveSearch(name, query string) error {
+	name = strings.TrimSpace(name)
+	query = strings.TrimSpace(query)
+	if name == "" {
+		return fmt.Errorf("search name is required")
+	}
+	if strings.EqualFold(name, "INBOX") {
+		return fmt.Errorf("'%s' is a folder name and can't be used for a saved search", name)
+	}
+	if query == "" {
+		return fmt.Errorf("a query is required to save a search")
+	}
+	if _, err := ParseQuery(query); err != nil {
+		return err
+	}
+
+	config, err := LoadSavedSearches()
+	if err != nil {
+		return err
+	}
+	for i, search := range config.Searches {
+		if strings.EqualFold(search.Name, name) {
+			config.Searches[i].Query = query
+			if err := SaveSavedSearches(config); err != nil {
+				return err
+			}
+			fmt.Printf("✓ Updated saved search '%s'\n", search.Name)
+			return nil
+		}
+	}
+
+	config.Searches = append(config.Searches, SavedSearch{Name: name, Query: query, Created: time.Now()})
+	if err := SaveSavedSearches(config); err != nil {
+		return err
+	}
+	fmt.Printf("✓ Saved search '%s'\n", name)
+	return nil
+}
+
+func DeleteSavedSearch(name string) error {
+	config, err := LoadSavedSearches()
+	if err != nil {
+		return err
+	}
+	for i, search := range config.Searches {
+		if strings.EqualFold(search.Name, name) {
+			config.Searches = append(config.Searches[:i], config.Searches[i+1:]...)
+			if err := SaveSavedSearches(config); err != nil {
+				return err
+			}
+			fmt.Printf("Deleted saved search '%s'\n", search.Name)
+			return nil
+		}
+	}
+	return fmt.Errorf("saved search '%s' not found", name)
+}
+
+// SavedSearchCount is a saved search with the number of archived emails it
+// matches
+type SavedSearchCount struct {
+	SavedSearch
+	Count int `json:"count"`
+}
+
+// CountSavedSearches evaluates each saved search against an account's
+// archive, sorted by name
+func CountSavedSearches(accountEmail string) ([]SavedSearchCount, error) {
+	config, err := LoadSavedSearches()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(config.Searches, func(i, j int) bool {
+		return strings.ToLower(config.Searches[i].Name) < strings.ToLower(config.Searches[j].Name)
+	})
+
+	if len(config.Searches) == 0 {
+		return nil, nil
+	}
+	dm, err := NewDatabaseManager(accountEmail)
+	if err != nil {
+		return nil, err
+	}
+	defer dm.Close()
+
+	var counts []SavedSearchCount
+	for _, search := range config.Searches {
+		count := 0
+		q, err := ResolveQuery(search.Query)
+		if err == nil {
+			count, err = dm.countEmails("", q)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("saved search '%s': %v", search.Name, err)
+		}
+		counts = append(counts, SavedSearchCount{SavedSearch: search, Count: count})
+	}
+	return counts, nil
+}
+
+// ListSavedSearches prints the saved searches with their counts
+func ListSavedSearches(accountEmail string) error {
+	if accountEmail == "" {
+		config, err := LoadConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %v", err)
+		}
+		accountEmail = config.Email
+	}
+
+	counts, err := CountSavedSearches(accountEmail)
+	if err != nil {
+		return err
+	}
+	if len(counts) == 0 {
+		fmt.Println("No saved searches.")
+		fmt.Println("Use 'mailos search --save <name> \"<query>\"' to save one.")
+		return nil
+	}
+
+	fmt.Println("Saved Searches:")
+	fmt.Println("===============")
+	for _, search := range counts {
+		fmt.Printf("\n%s (%d emails)\n", search.Name, search.Count)
+		fmt.Printf("  Query: %s\n", search.Query)
+	}
+	fmt.Println("\nUse a name with --folder in search, stats and report.")
+	return nil
+}
+
+// parseSearchDate reads a date, or an age counted back from now
+func parseSearchDate(value string) (time.Time, error) {
+	if m := relativeAgePattern.FindStringSubmatch(strings.ToLower(value)); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		now := time.Now()
+		switch m[2] {
+		case "d":
+			return now.AddDate(0, 0, -n), nil
+		case "w":
+			return now.AddDate(0, 0, -7*n), nil
+		case "m":
+			return now.AddDate(0, -n, 0), nil
+		default:
+			return now.AddDate(-n, 0, 0), nil
+		}
+	}
+	t, err := parseFlexibleDate(value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// Dates are days in local time
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local), nil
+}
+
+// SearchArchive runs a query against an account's local archive. opts
+// narrows it further; its Limit and Offset page through the matches.
+func SearchArchive(accountEmail, query string, opts ReadOptions) ([]*Email, error) {
+	return SearchFolder(accountEmail, "", query, opts)
+}
+
+// SearchFolder runs a query against one archived folder or saved search
+func SearchFolder(accountEmail, folder, query string, opts ReadOptions) ([]*Email, error) {
+	q, err := ResolveQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if folder != "" {
+		search, err := GetSavedSearch(folder)
+		if err != nil {
+			return nil, err
+		}
+		if search != nil {
+			// Both queries have to match
+			saved, err := ResolveQuery(search.Query)
+			if err != nil {
+				return nil, fmt.Errorf("saved search '%s': %v", search.Name, err)
+			}
+			q.Root = andQueryNodes(saved.Root, q.Root)
+			folder = ""
+		}
+	}
+
+	dm, err := NewDatabaseManager(accountEmail)
+	if err != nil {
+		return nil, err
+	}
+	defer dm.Close()
+	return dm.searchEmails(folder, q, opts)
+}
+
+// GetFolderEmails reads a folder from an account's local archive. A saved
+// search's name reads it as a virtual folder; an empty folder is INBOX.
+func GetFolderEmails(accountEmail, folder string, opts ReadOptions) ([]*Email, error) {
+	if folder == "" {
+		folder = "INBOX"
+	}
+	return SearchFolder(accountEmail, folder, "", opts)
+}
+
+// ReadFolder reads a folder the way Read reads INBOX: from the server, or
+// the local archive when opts.LocalOnly is set or mailos is offline. Saved
+// searches are always read from the archive.
+func ReadFolder(opts ReadOptions, folder string) ([]*Email, error) {
+	if folder == "" || strings.EqualFold(folder, "INBOX") {
+		return Read(opts)
+	}
+	search, err := GetSavedSearch(folder)
+	if err != nil {
+		return nil, err
+	}
+	config, err := LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %v", err)
+	}
+	if search != nil {
+		emails, err := SearchArchive(config.Email, search.Query, opts)
+		if err == nil {
+			fmt.Printf("Read %d emails from saved search '%s'\n", len(emails), search.Name)
+		}
+		return emails, err
+	}
+	if opts.LocalOnly || IsOffline() {
+		return GetFolderEmails(config.Email, folder, opts)
+	}
+	emails, err := ReadFromFolder(opts, folder)
+	if isOfflineError(err) {
+		fmt.Printf("📴 Offline: showing the local archive\n")
+		return GetFolderEmails(config.Email, folder, opts)
+	}
+	return emails, err
+}
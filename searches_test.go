@@ -0,0 +1,113 @@
+package mailos
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+func TestSavedSearches(t *testing.T) {
+	tmpDir := setupTestGroups(t)
+	defer cleanupTestGroups(tmpDir)
+
+	account := "me@example.com"
+	now := time.Now()
+	err := archiveEmails(account, "INBOX", []*Email{
+		{ID: 1, MessageID: "<1@example.com>", From: "billing@shop.example", Subject: "Invoice 12", Date: now.AddDate(0, 0, -2), Attachments: []string{"invoice.pdf"}},
+		{ID: 2, MessageID: "<2@example.com>", From: "billing@shop.example", Subject: "Invoice 11", Date: now.AddDate(0, 0, -40), Attachments: []string{"invoice.pdf"}},
+		{ID: 3, MessageID: "<3@example.com>", From: "billing@shop.example", Subject: "Your plan", Date: now.AddDate(0, 0, -3), Flags: []string{imap.SeenFlag}},
+		{ID: 4, MessageID: "<4@example.com>", From: "ana@example.org", Subject: "Lunch", Date: now.AddDate(0, 0, -1), Attachments: []string{"menu.pdf"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SaveSearch("invoices", "from:billing has:attachment since:30d"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveSearch("billing", "from:billing"); err != nil {
+		t.Fatal(err)
+	}
+	for name, query := range map[string]string{"inbox": "from:x", "empty": "", "bad": "is:pinned"} {
+		if err := SaveSearch(name, query); err == nil {
+			t.Errorf("Expected %q saved as %q refused", query, name)
+		}
+	}
+
+	// A saved search reads like a folder, narrowed and paged like one
+	emails, err := GetFolderEmails(account, "Invoices", ReadOptions{})
+	if err != nil || len(emails) != 1 || emails[0].Subject != "Invoice 12" {
+		t.Fatalf("Expected the recent invoice, got %+v, %v", emails, err)
+	}
+	if emails, _ := GetFolderEmails(account, "billing", ReadOptions{UnreadOnly: true, Limit: 1, Offset: 1}); len(emails) != 1 || emails[0].Subject != "Invoice 11" {
+		t.Errorf("Expected the second unread billing email, got %+v", emails)
+	}
+	if emails, _ := SearchFolder(account, "billing", "plan", ReadOptions{}); len(emails) != 1 || emails[0].Subject != "Your plan" {
+		t.Errorf("Expected a query within a saved search, got %+v", emails)
+	}
+	if emails, _ := GetFolderEmails(account, "", ReadOptions{}); len(emails) != 4 {
+		t.Errorf("Expected INBOX for an empty folder, got %d emails", len(emails))
+	}
+
+	stats, err := GenerateEmailStats(StatsOptions{AccountEmail: account, Folder: "billing"})
+	if err != nil || stats.TotalEmails != 3 {
+		t.Errorf("Expected stats over the saved search, got %+v, %v", stats, err)
+	}
+
+	// Sizes aren't archived, so this one is counted by checking the rows
+	if err := SaveSearch("small", "from:billing -larger:1M"); err != nil {
+		t.Fatal(err)
+	}
+	counts, err := CountSavedSearches(account)
+	if err != nil || len(counts) != 3 || counts[0].Name != "billing" || counts[0].Count != 3 || counts[1].Count != 1 || counts[2].Count != 3 {
+		t.Errorf("Unexpected counts: %+v, %v", counts, err)
+	}
+	DeleteSavedSearch("small")
+
+	// Saving again under the same name replaces the query
+	if err := SaveSearch("Invoices", "from:billing has:attachment"); err != nil {
+		t.Fatal(err)
+	}
+	if emails, _ := GetFolderEmails(account, "invoices", ReadOptions{}); len(emails) != 2 {
+		t.Errorf("Expected the updated query, got %d emails", len(emails))
+	}
+	if err := DeleteSavedSearch("BILLING"); err != nil {
+		t.Fatal(err)
+	}
+	if search, _ := GetSavedSearch("billing"); search != nil {
+		t.Errorf("Expected the search deleted")
+	}
+	if err := DeleteSavedSearch("billing"); err == nil {
+		t.Errorf("Expected deleting a missing search to fail")
+	}
+}
+
+func TestValidateSavedSearches(t *testing.T) {
+	home := setupConfigLayers(t, `{"provider": "gmail", "email": "me@example.com"}`, "")
+	path := filepath.Join(home, ".email", "searches.json")
+	os.WriteFile(path, []byte(`{"schema_version": 1, "searches": [
+		{"name": "a", "query": "is:pinned"}, {"name": "A", "query": "from:x"}, {"name": "b"}]}`), 0644)
+
+	results, err := ValidateConfigFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var problems []string
+	for _, result := range results {
+		if result.Name == "saved searches" {
+			for _, p := range result.Problems {
+				problems = append(problems, p.String())
+			}
+		}
+	}
+	got := strings.Join(problems, "\n")
+	for _, want := range []string{`searches[2]: missing required field "query"`, `searches[1].name: "A" is already used by searches[0]`, `searches[0].query: is: expects unread, read, flagged or starred, not "pinned" at position 4`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %q in:\n%s", want, got)
+		}
+	}
+}
@@ -3,9 +3,8 @@ package mailos
 import (
 	"bufio"
 	"crypto/tls"
-	"encoding/base64"
+	"errors"
 	"fmt"
-	"mime"
 	"net/smtp"
 	"os"
 	"path/filepath"
@@ -27,9 +26,19 @@ type EmailMessage struct {
 	Attachments     []string
 	IncludeSignature bool
 	SignatureText   string
+	SignatureHTML   string   // HTML form of SignatureText; derived from the text when empty
+	SignatureName   string   // Named signature to use instead, or "none"
 	UseTemplate     bool     // Whether to apply HTML template
 	InReplyTo       string   // Message-ID being replied to
 	References      []string // Chain of Message-IDs in conversation
+	ImageDir        string   // Directory relative <img> paths resolve against (default: current directory)
+	EmbedRemoteImages bool   // Download http(s) images and send them inline too
+	AttachmentParts []OutgoingAttachment // In-memory attachments, e.g. carried over from a forwarded message
+	InlineImages    []InlineImage        // Images already referenced by cid: in BodyHTML
+	EnvelopeTo      []string             // SMTP recipients of this batch; defaults to To, CC and BCC
+	SkipSentCopy    bool                 // Don't save this batch to the Sent folder
+	RemindIfNoReply time.Duration        // List in 'mailos followups' if nobody replies within this long
+	MessageID       string               // Message-ID every batch is sent under; generated when empty
 }
 
 // SavedEmail represents an email saved to local storage
@@ -83,6 +92,8 @@ func SendFromMarkdownFile(filePath string, accountEmail string) error {
 			msg.BodyHTML = MarkdownToHTMLContent(bodyContent)
 		}
 	}
+	// Images in the markdown are relative to the file, not where we were run from
+	msg.ImageDir = filepath.Dir(filePath)
 	
 	return SendWithAccount(msg, accountEmail)
 }
@@ -118,6 +129,21 @@ func ProcessEmailWithFrontmatter(msg *EmailMessage) (*EmailMessage, error) {
 	if len(msg.Attachments) > 0 && len(processedMsg.Attachments) == 0 {
 		processedMsg.Attachments = msg.Attachments
 	}
+	processedMsg.BodyHTML = msg.BodyHTML
+	processedMsg.ImageDir = msg.ImageDir
+	processedMsg.EmbedRemoteImages = processedMsg.EmbedRemoteImages || msg.EmbedRemoteImages
+	processedMsg.AttachmentParts = msg.AttachmentParts
+	processedMsg.InlineImages = msg.InlineImages
+	processedMsg.RemindIfNoReply = msg.RemindIfNoReply
+	processedMsg.IncludeSignature = processedMsg.IncludeSignature && msg.IncludeSignature
+	processedMsg.SignatureText = msg.SignatureText
+	processedMsg.SignatureHTML = msg.SignatureHTML
+	if processedMsg.SignatureName == "" {
+		processedMsg.SignatureName = msg.SignatureName
+	}
+	processedMsg.EnvelopeTo = msg.EnvelopeTo
+	processedMsg.SkipSentCopy = msg.SkipSentCopy
+	processedMsg.MessageID = msg.MessageID
 	
 	return processedMsg, nil
 }
@@ -130,8 +156,46 @@ func PreviewEmail(msg *EmailMessage, accountEmail string) error {
 	}
 	
 	config := setup.Config
+	if msg.ImageDir == "" {
+		msg.ImageDir, _ = os.Getwd()
+	}
+	if err := applySignature(msg, config); err != nil {
+		return err
+	}
+
+	// Attachments are listed instead of dumping their base64 content
+	var attachments []OutgoingAttachment
+	for _, attachmentPath := range msg.Attachments {
+		filename := filepath.Base(attachmentPath)
+		attachments = append(attachments, OutgoingAttachment{
+			Filename: filename,
+			MIMEType: attachmentMIMEType(filename, AttachmentMeta{}, nil),
+		})
+	}
+
+	outgoing := composeOutgoingMessage(msg, config, attachments)
+	// Show Bcc so the preview lists every recipient
+	outgoing.BCC = msg.BCC
+
+	raw, err := BuildMessage(outgoing)
+	if err != nil {
+		return fmt.Errorf("failed to build message: %v", err)
+	}
+
+	// Display the preview
+	fmt.Println("=== EMAIL PREVIEW ===")
+	fmt.Println(string(raw))
+	for _, attachmentPath := range msg.Attachments {
+		fmt.Printf("[ATTACHMENT: %s - file will be included when sent]\n", filepath.Base(attachmentPath))
+	}
+	fmt.Println("=== END PREVIEW ===")
+	
+	return nil
+}
 
-	// Prepare from email
+// senderAddress returns the envelope sender and the From header for an account
+func senderAddress(config *Config) (string, string) {
+	// Use FromEmail if specified, otherwise use the account email
 	fromEmail := config.Email
 	if config.FromEmail != "" {
 		fromEmail = config.FromEmail
@@ -141,19 +205,25 @@ func PreviewEmail(msg *EmailMessage, accountEmail string) error {
 	if config.FromName != "" {
 		from = fmt.Sprintf("%s <%s>", config.FromName, fromEmail)
 	}
+	return fromEmail, from
+}
 
-	// Build recipients list
-	allRecipients := append([]string{}, msg.To...)
-	allRecipients = append(allRecipients, msg.CC...)
-	allRecipients = append(allRecipients, msg.BCC...)
+// composeOutgoingMessage adds the signature, footer, template and inline images
+// to msg and returns the message to serialize. Bcc is left out of the headers.
+func composeOutgoingMessage(msg *EmailMessage, config *Config, attachments []OutgoingAttachment) *OutgoingMessage {
+	fromEmail, from := senderAddress(config)
 
-	// Add signature if requested
+	// Add signature if requested, above any quoted text
 	body := msg.Body
 	bodyHTML := msg.BodyHTML
 	if msg.IncludeSignature && msg.SignatureText != "" {
-		body += msg.SignatureText
+		body = insertSignature(body, msg.SignatureText)
 		if bodyHTML != "" {
-			bodyHTML += strings.ReplaceAll(msg.SignatureText, "\n", "<br>")
+			signatureHTML := msg.SignatureHTML
+			if signatureHTML == "" {
+				signatureHTML = strings.ReplaceAll(msg.SignatureText, "\n", "<br>")
+			}
+			bodyHTML = insertSignatureHTML(bodyHTML, signatureHTML)
 		}
 	}
 	
@@ -173,133 +243,60 @@ func PreviewEmail(msg *EmailMessage, accountEmail string) error {
 	}
 	
 	// Apply template with profile image if it exists and UseTemplate is true
-	if msg.UseTemplate && TemplateExists() {
-		if config.ProfileImage != "" {
-			bodyHTML = ApplyTemplateWithProfile(body, bodyHTML, config.ProfileImage)
-		} else if bodyHTML != "" {
-			bodyHTML = ApplyTemplate(body, bodyHTML)
-		}
+	if msg.UseTemplate && (config.ProfileImage != "" || TemplateExists()) {
+		bodyHTML = ApplyTemplateWithProfile(body, bodyHTML, config.ProfileImage)
+	} else if msg.UseTemplate && TemplateExists() && bodyHTML != "" {
+		bodyHTML = ApplyTemplate(body, bodyHTML)
 	}
 
-	// Build email message for preview
-	var message strings.Builder
-	message.WriteString(fmt.Sprintf("From: %s\r\n", from))
-	message.WriteString(fmt.Sprintf("To: %s\r\n", strings.Join(msg.To, ", ")))
-	if len(msg.CC) > 0 {
-		message.WriteString(fmt.Sprintf("Cc: %s\r\n", strings.Join(msg.CC, ", ")))
-	}
-	if len(msg.BCC) > 0 {
-		message.WriteString(fmt.Sprintf("Bcc: %s\r\n", strings.Join(msg.BCC, ", ")))
+	// Send images from the body, template and signature as cid: parts, since
+	// Gmail and Outlook strip data: URIs
+	inlineImages := append([]InlineImage{}, msg.InlineImages...)
+	if bodyHTML != "" {
+		var embedded []InlineImage
+		bodyHTML, embedded = EmbedInlineImages(bodyHTML, msg.ImageDir, msg.EmbedRemoteImages)
+		inlineImages = append(inlineImages, embedded...)
 	}
-	message.WriteString(fmt.Sprintf("Subject: %s\r\n", msg.Subject))
-	message.WriteString(fmt.Sprintf("Date: %s\r\n", time.Now().Format(time.RFC1123Z)))
-	
-	// Add threading headers if this is a reply
-	if msg.InReplyTo != "" {
-		inReplyTo := msg.InReplyTo
-		if !strings.HasPrefix(inReplyTo, "<") {
-			inReplyTo = "<" + inReplyTo + ">"
-		}
-		message.WriteString(fmt.Sprintf("In-Reply-To: %s\r\n", inReplyTo))
-	}
-	
-	if len(msg.References) > 0 {
-		var refs []string
-		for _, ref := range msg.References {
-			if !strings.HasPrefix(ref, "<") {
-				refs = append(refs, "<"+ref+">")
-			} else {
-				refs = append(refs, ref)
-			}
-		}
-		message.WriteString(fmt.Sprintf("References: %s\r\n", strings.Join(refs, " ")))
-	}
-	
-	message.WriteString("MIME-Version: 1.0\r\n")
-
-	// Add body and show attachment info
-	if len(msg.Attachments) > 0 {
-		// Show attachments in preview
-		message.WriteString("Content-Type: multipart/mixed; boundary=\"preview_boundary\"\r\n")
-		message.WriteString("\r\n")
-		message.WriteString("--preview_boundary\r\n")
-		
-		if bodyHTML != "" {
-			message.WriteString("Content-Type: multipart/alternative; boundary=\"alt_boundary\"\r\n")
-			message.WriteString("\r\n")
-			message.WriteString("--alt_boundary\r\n")
-			message.WriteString("Content-Type: text/plain; charset=\"UTF-8\"\r\n")
-			message.WriteString("\r\n")
-			message.WriteString(body)
-			message.WriteString("\r\n")
-			message.WriteString("--alt_boundary\r\n")
-			message.WriteString("Content-Type: text/html; charset=\"UTF-8\"\r\n")
-			message.WriteString("\r\n")
-			message.WriteString(bodyHTML)
-			message.WriteString("\r\n")
-			message.WriteString("--alt_boundary--\r\n")
-		} else {
-			message.WriteString("Content-Type: text/plain; charset=\"UTF-8\"\r\n")
-			message.WriteString("\r\n")
-			message.WriteString(body)
-			message.WriteString("\r\n")
-		}
 
-		// Add attachment info (not actual data in preview)
-		for _, attachmentPath := range msg.Attachments {
-			filename := filepath.Base(attachmentPath)
-			message.WriteString("--preview_boundary\r\n")
-			message.WriteString(fmt.Sprintf("Content-Type: application/octet-stream\r\n"))
-			message.WriteString("Content-Transfer-Encoding: base64\r\n")
-			message.WriteString(fmt.Sprintf("Content-Disposition: attachment; filename=\"%s\"\r\n", filename))
-			message.WriteString("\r\n")
-			message.WriteString(fmt.Sprintf("[ATTACHMENT: %s - file will be included when sent]\r\n", filename))
-		}
-		message.WriteString("--preview_boundary--\r\n")
-	} else if bodyHTML != "" {
-		// No attachments, but has HTML
-		boundary := fmt.Sprintf("==boundary_%d==", time.Now().Unix())
-		message.WriteString(fmt.Sprintf("Content-Type: multipart/alternative; boundary=\"%s\"\r\n", boundary))
-		message.WriteString("\r\n")
-
-		// Plain text part
-		message.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-		message.WriteString("Content-Type: text/plain; charset=\"UTF-8\"\r\n")
-		message.WriteString("\r\n")
-		message.WriteString(body)
-		message.WriteString("\r\n")
-
-		// HTML part
-		message.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-		message.WriteString("Content-Type: text/html; charset=\"UTF-8\"\r\n")
-		message.WriteString("\r\n")
-		message.WriteString(bodyHTML)
-		message.WriteString("\r\n")
-
-		message.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
-	} else {
-		// Plain text only, no attachments
-		message.WriteString("Content-Type: text/plain; charset=\"UTF-8\"\r\n")
-		message.WriteString("\r\n")
-		message.WriteString(body)
+	messageID := msg.MessageID
+	if messageID == "" {
+		messageID = generateMessageID(fromEmail)
 	}
 
-	// Display the preview
-	fmt.Println("=== EMAIL PREVIEW ===")
-	fmt.Println(message.String())
-	fmt.Println("=== END PREVIEW ===")
-	
-	return nil
+	return &OutgoingMessage{
+		From:         from,
+		To:           msg.To,
+		CC:           msg.CC,
+		Subject:      msg.Subject,
+		Date:         time.Now(),
+		MessageID:    messageID,
+		InReplyTo:    msg.InReplyTo,
+		References:   msg.References,
+		TextBody:     body,
+		HTMLBody:     bodyHTML,
+		InlineImages: inlineImages,
+		Attachments:  attachments,
+	}
 }
 
 // SendWithAccountVerbose sends an email using a specific account with optional verbose logging
 func SendWithAccountVerbose(msg *EmailMessage, accountEmail string, verbose bool) error {
-	return sendWithAccount(msg, accountEmail, verbose)
+	return sendInBatches(msg, accountEmail, verbose)
 }
 
 // SendWithAccount sends an email using a specific account
 func SendWithAccount(msg *EmailMessage, accountEmail string) error {
-	return sendWithAccount(msg, accountEmail, false)
+	return sendInBatches(msg, accountEmail, false)
+}
+
+// trackSentFollowup sets the reminder for a sent message, noting rather than
+// failing when it can't
+func trackSentFollowup(accountEmail string, followup *Followup) {
+	if err := TrackFollowup(accountEmail, followup); err != nil {
+		fmt.Printf("Note: Could not set follow-up reminder: %v\n", err)
+	} else {
+		fmt.Printf("🔔 You'll be reminded on %s if nobody replies\n", followup.RemindAt.Format("Mon Jan 2 3:04 PM"))
+	}
 }
 
 // sendWithAccount is the internal implementation
@@ -309,30 +306,19 @@ func sendWithAccount(msg *EmailMessage, accountEmail string, verbose bool) error
 		return fmt.Errorf("failed to process frontmatter: %v", err)
 	}
 	msg = processedMsg
+	if msg.ImageDir == "" {
+		msg.ImageDir, _ = os.Getwd()
+	}
 
 	// Process attachments if provided
-	var attachmentData map[string][]byte
-	if len(msg.Attachments) > 0 {
-		attachmentData = make(map[string][]byte)
-		for _, attachmentPath := range msg.Attachments {
-			// Check if file exists
-			if _, err := os.Stat(attachmentPath); os.IsNotExist(err) {
-				return fmt.Errorf("attachment file not found: %s", attachmentPath)
-			}
-			
-			// Read file data
-			data, err := os.ReadFile(attachmentPath)
-			if err != nil {
-				return fmt.Errorf("failed to read attachment %s: %v", attachmentPath, err)
-			}
-			
-			// Store using filename as key
-			filename := filepath.Base(attachmentPath)
-			attachmentData[filename] = data
-			
-			if verbose {
-				fmt.Printf("Debug: Added attachment: %s (%d bytes)\n", filename, len(data))
-			}
+	attachments, err := loadAttachmentFiles(msg.Attachments)
+	if err != nil {
+		return err
+	}
+	attachments = append(attachments, msg.AttachmentParts...)
+	if verbose {
+		for _, attachment := range attachments {
+			fmt.Printf("Debug: Added attachment: %s (%d bytes)\n", attachment.Filename, len(attachment.Data))
 		}
 	}
 
@@ -351,16 +337,9 @@ func sendWithAccount(msg *EmailMessage, accountEmail string, verbose bool) error
 		fmt.Printf("Debug: Sending from: %s\n", config.FromEmail)
 	}
 
-	// Prepare email headers and body
-	// Use FromEmail if specified, otherwise use the account email
-	fromEmail := config.Email
-	if config.FromEmail != "" {
-		fromEmail = config.FromEmail
-	}
-	
-	from := fromEmail
-	if config.FromName != "" {
-		from = fmt.Sprintf("%s <%s>", config.FromName, fromEmail)
+	fromEmail, from := senderAddress(config)
+	if err := applySignature(msg, config); err != nil {
+		return err
 	}
 
 	// Build recipients list
@@ -368,167 +347,16 @@ func sendWithAccount(msg *EmailMessage, accountEmail string, verbose bool) error
 	allRecipients = append(allRecipients, msg.CC...)
 	allRecipients = append(allRecipients, msg.BCC...)
 
-	// Add signature if requested
-	body := msg.Body
-	bodyHTML := msg.BodyHTML
-	if msg.IncludeSignature && msg.SignatureText != "" {
-		body += msg.SignatureText
-		if bodyHTML != "" {
-			bodyHTML += strings.ReplaceAll(msg.SignatureText, "\n", "<br>")
-		}
-	}
-	
-	// Add EmailOS footer only for non-subscribed users
-	if !IsSubscribed() {
-		emailOSFooter := "\n\nSent with EmailOS https://email-os.com/"
-		emailOSFooterHTML := "<br><br>Sent with <a href=\"https://email-os.com/\">EmailOS</a>"
-		
-		body += emailOSFooter
-		if bodyHTML != "" {
-			bodyHTML += emailOSFooterHTML
-		} else {
-			bodyHTML = strings.ReplaceAll(body, "\n", "<br>")
-		}
-	} else if bodyHTML == "" {
-		bodyHTML = strings.ReplaceAll(body, "\n", "<br>")
-	}
-	
-	// Apply template with profile image if it exists and UseTemplate is true
-	if msg.UseTemplate && (config.ProfileImage != "" || TemplateExists()) {
-		bodyHTML = ApplyTemplateWithProfile(body, bodyHTML, config.ProfileImage)
-	} else if msg.UseTemplate && TemplateExists() && bodyHTML != "" {
-		bodyHTML = ApplyTemplate(body, bodyHTML)
+	outgoing := composeOutgoingMessage(msg, config, attachments)
+	if verbose && len(outgoing.InlineImages) > 0 {
+		fmt.Printf("Debug: Embedded %d inline image(s)\n", len(outgoing.InlineImages))
 	}
 
-	// Build email message
-	var message strings.Builder
-	message.WriteString(fmt.Sprintf("From: %s\r\n", from))
-	message.WriteString(fmt.Sprintf("To: %s\r\n", strings.Join(msg.To, ", ")))
-	if len(msg.CC) > 0 {
-		message.WriteString(fmt.Sprintf("Cc: %s\r\n", strings.Join(msg.CC, ", ")))
-	}
-	message.WriteString(fmt.Sprintf("Subject: %s\r\n", msg.Subject))
-	message.WriteString(fmt.Sprintf("Date: %s\r\n", time.Now().Format(time.RFC1123Z)))
-	
-	// Add threading headers if this is a reply
-	if msg.InReplyTo != "" {
-		// Ensure Message-ID is wrapped in angle brackets
-		inReplyTo := msg.InReplyTo
-		if !strings.HasPrefix(inReplyTo, "<") {
-			inReplyTo = "<" + inReplyTo + ">"
-		}
-		message.WriteString(fmt.Sprintf("In-Reply-To: %s\r\n", inReplyTo))
-	}
-	
-	if len(msg.References) > 0 {
-		// Ensure all Message-IDs in References are wrapped in angle brackets
-		var refs []string
-		for _, ref := range msg.References {
-			if !strings.HasPrefix(ref, "<") {
-				refs = append(refs, "<"+ref+">")
-			} else {
-				refs = append(refs, ref)
-			}
-		}
-		message.WriteString(fmt.Sprintf("References: %s\r\n", strings.Join(refs, " ")))
-	}
-	
-	message.WriteString("MIME-Version: 1.0\r\n")
-
-	// Add body and attachments
-	if len(attachmentData) > 0 {
-		// Mixed multipart for attachments
-		mixedBoundary := fmt.Sprintf("==mixed_%d==", time.Now().Unix())
-		message.WriteString(fmt.Sprintf("Content-Type: multipart/mixed; boundary=\"%s\"\r\n", mixedBoundary))
-		message.WriteString("\r\n")
-
-		// Add the email body part
-		message.WriteString(fmt.Sprintf("--%s\r\n", mixedBoundary))
-		
-		if bodyHTML != "" {
-			// Alternative part for text/html
-			altBoundary := fmt.Sprintf("==alt_%d==", time.Now().Unix())
-			message.WriteString(fmt.Sprintf("Content-Type: multipart/alternative; boundary=\"%s\"\r\n", altBoundary))
-			message.WriteString("\r\n")
-
-			// Plain text part
-			message.WriteString(fmt.Sprintf("--%s\r\n", altBoundary))
-			message.WriteString("Content-Type: text/plain; charset=\"UTF-8\"\r\n")
-			message.WriteString("\r\n")
-			message.WriteString(body)
-			message.WriteString("\r\n")
-
-			// HTML part
-			message.WriteString(fmt.Sprintf("--%s\r\n", altBoundary))
-			message.WriteString("Content-Type: text/html; charset=\"UTF-8\"\r\n")
-			message.WriteString("\r\n")
-			message.WriteString(bodyHTML)
-			message.WriteString("\r\n")
-
-			message.WriteString(fmt.Sprintf("--%s--\r\n", altBoundary))
-		} else {
-			// Plain text only
-			message.WriteString("Content-Type: text/plain; charset=\"UTF-8\"\r\n")
-			message.WriteString("\r\n")
-			message.WriteString(body)
-			message.WriteString("\r\n")
-		}
-
-		// Add attachments
-		for filename, data := range attachmentData {
-			message.WriteString(fmt.Sprintf("--%s\r\n", mixedBoundary))
-			
-			// Detect MIME type
-			mimeType := mime.TypeByExtension(filepath.Ext(filename))
-			if mimeType == "" {
-				mimeType = "application/octet-stream"
-			}
-			
-			message.WriteString(fmt.Sprintf("Content-Type: %s\r\n", mimeType))
-			message.WriteString("Content-Transfer-Encoding: base64\r\n")
-			message.WriteString(fmt.Sprintf("Content-Disposition: attachment; filename=\"%s\"\r\n", filename))
-			message.WriteString("\r\n")
-			
-			// Encode in base64
-			encoded := base64.StdEncoding.EncodeToString(data)
-			// Split into 76-character lines as per RFC 2045
-			for i := 0; i < len(encoded); i += 76 {
-				end := i + 76
-				if end > len(encoded) {
-					end = len(encoded)
-				}
-				message.WriteString(encoded[i:end] + "\r\n")
-			}
-		}
-
-		message.WriteString(fmt.Sprintf("--%s--\r\n", mixedBoundary))
-	} else if bodyHTML != "" {
-		// No attachments, but has HTML - multipart/alternative
-		boundary := fmt.Sprintf("==boundary_%d==", time.Now().Unix())
-		message.WriteString(fmt.Sprintf("Content-Type: multipart/alternative; boundary=\"%s\"\r\n", boundary))
-		message.WriteString("\r\n")
-
-		// Plain text part
-		message.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-		message.WriteString("Content-Type: text/plain; charset=\"UTF-8\"\r\n")
-		message.WriteString("\r\n")
-		message.WriteString(body)
-		message.WriteString("\r\n")
-
-		// HTML part
-		message.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-		message.WriteString("Content-Type: text/html; charset=\"UTF-8\"\r\n")
-		message.WriteString("\r\n")
-		message.WriteString(bodyHTML)
-		message.WriteString("\r\n")
-
-		message.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
-	} else {
-		// Plain text only, no attachments
-		message.WriteString("Content-Type: text/plain; charset=\"UTF-8\"\r\n")
-		message.WriteString("\r\n")
-		message.WriteString(body)
+	raw, err := BuildMessage(outgoing)
+	if err != nil {
+		return fmt.Errorf("failed to build message: %v", err)
 	}
+	messageContent := string(raw)
 
 	// Get SMTP settings from provider
 	smtpHost, smtpPort, useTLS, useSSL, err := config.GetSMTPSettings()
@@ -546,54 +374,109 @@ func sendWithAccount(msg *EmailMessage, accountEmail string, verbose bool) error
 
 	// Send email
 	auth := smtp.PlainAuth("", config.Email, config.Password, smtpHost)
+	envelopeTo := envelopeRecipients(allRecipients)
+	if len(msg.EnvelopeTo) > 0 {
+		envelopeTo = msg.EnvelopeTo
+	}
 
+	// Stay under the provider's sending quotas, shared by every mailos process
+	if err := waitForSendSlot(config.Email, config.GetSendLimits()); err != nil {
+		return err
+	}
+	submittedAt := time.Now()
+
+	var response string
 	if useTLS {
 		// Use STARTTLS
-		err = sendWithSTARTTLS(
+		response, err = sendWithSTARTTLS(
 			smtpHost,
 			smtpPort,
 			auth,
 			fromEmail,
-			allRecipients,
-			message.String(),
+			envelopeTo,
+			messageContent,
+			outgoing.MessageID,
 		)
-		if err != nil {
-			return handleSendError(err, fromEmail, config.Email)
-		}
-		// After successfully sending, save to Sent folder
-		return saveToSentFolder(message.String(), config, msg, from)
 	} else if useSSL {
 		// Use SMTPS (SMTP over SSL)
-		err = sendWithSMTPS(
+		response, err = sendWithSMTPS(
 			smtpHost,
 			smtpPort,
 			auth,
 			fromEmail,
-			allRecipients,
-			message.String(),
+			envelopeTo,
+			messageContent,
+			outgoing.MessageID,
+		)
+	} else {
+		// Plain SMTP (not recommended)
+		response, err = sendWithPlainSMTP(
+			smtpHost,
+			smtpPort,
+			auth,
+			fromEmail,
+			envelopeTo,
+			messageContent,
+			outgoing.MessageID,
 		)
-		if err != nil {
-			return handleSendError(err, fromEmail, config.Email)
-		}
-		// After successfully sending, save to Sent folder
-		return saveToSentFolder(message.String(), config, msg, from)
 	}
-
-	// Plain SMTP (not recommended)
-	addr := fmt.Sprintf("%s:%d", smtpHost, smtpPort)
-	err = smtp.SendMail(addr, auth, fromEmail, allRecipients, []byte(message.String()))
 	if err != nil {
 		return handleSendError(err, fromEmail, config.Email)
 	}
-	
+
+	// Journal the accepted transaction; `mailos sent --verify` and
+	// `mailos sent --status` look messages up by their Message-ID later
+	entry := &SendJournalEntry{
+		MessageID:    outgoing.MessageID,
+		Subject:      msg.Subject,
+		From:         fromEmail,
+		Recipients:   envelopeTo,
+		SMTPHost:     smtpHost,
+		QueueID:      parseQueueID(response),
+		SMTPResponse: response,
+		SubmittedAt:  submittedAt,
+		AcceptedAt:   time.Now(),
+	}
+	if verbose {
+		fmt.Printf("Debug: Message-ID: <%s>\n", entry.MessageID)
+		fmt.Printf("Debug: Server response: %s\n", response)
+	}
+	if err := RecordSend(config.Email, entry); err != nil {
+		fmt.Printf("Note: Could not record send in journal: %v\n", err)
+	}
+	if msg.RemindIfNoReply > 0 {
+		trackSentFollowup(config.Email, &Followup{
+			MessageID:  outgoing.MessageID,
+			Subject:    msg.Subject,
+			Recipients: envelopeTo,
+			SentAt:     entry.AcceptedAt,
+			RemindAt:   entry.AcceptedAt.Add(msg.RemindIfNoReply),
+		})
+	}
+
+	if msg.SkipSentCopy {
+		return nil
+	}
+
 	// After successfully sending, save to Sent folder
-	return saveToSentFolder(message.String(), config, msg, from)
+	return saveToSentFolder(messageContent, config, msg, from, outgoing.MessageID)
+}
+
+// envelopeRecipients reduces "Name <addr>" recipients to bare SMTP addresses
+func envelopeRecipients(recipients []string) []string {
+	var addresses []string
+	for _, r := range recipients {
+		if address := parseOutgoingAddress(r).Address; address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
 }
 
 // saveToSentFolder saves the sent email to both local storage and IMAP Sent folder
-func saveToSentFolder(messageContent string, config *Config, msg *EmailMessage, from string) error {
+func saveToSentFolder(messageContent string, config *Config, msg *EmailMessage, from string, messageID string) error {
 	// First, save to local .email/sent folder
-	if err := saveToLocalSentFolder(messageContent, config, msg, from); err != nil {
+	if err := saveToLocalSentFolder(messageContent, config, msg, from, messageID); err != nil {
 		// Log error but don't fail the send
 		fmt.Printf("Note: Could not save to local sent folder: %v\n", err)
 	}
@@ -660,186 +543,16 @@ func saveToSentFolder(messageContent string, config *Config, msg *EmailMessage,
 		return nil
 	}
 
-	// Verify the email was saved to sent folder
-	if err := verifySentEmail(msg, config); err != nil {
-		fmt.Printf("Warning: Could not verify email was saved to sent folder: %v\n", err)
-	} else {
-		fmt.Println("✓ Email confirmed in sent folder")
+	if err := RecordSentFolder(config.Email, messageID, selectedFolder); err != nil {
+		fmt.Printf("Note: Could not record Sent folder in journal: %v\n", err)
 	}
+	fmt.Printf("✓ Saved to %s (check later with 'mailos sent --verify')\n", selectedFolder)
 
 	return nil
 }
 
-// verifySentEmail checks that the sent email appears in the sent folder and validates delivery
-func verifySentEmail(msg *EmailMessage, config *Config) error {
-	// Wait a moment for the email to appear in the sent folder
-	time.Sleep(2 * time.Second)
-	
-	// Search for the email in sent folder using subject and recent timestamp
-	opts := SentOptions{
-		Limit:   5,
-		Subject: msg.Subject,
-		Since:   time.Now().Add(-5 * time.Minute), // Look for emails sent in last 5 minutes
-	}
-	
-	sentEmails, err := ReadSentEmails(opts)
-	if err != nil {
-		return fmt.Errorf("failed to read sent emails for verification: %v", err)
-	}
-	
-	// Check if any of the found emails match our sent email
-	emailFound := false
-	for _, email := range sentEmails {
-		if email.Subject == msg.Subject {
-			// Additional checks to ensure it's the right email
-			if len(msg.To) > 0 && len(email.To) > 0 {
-				// Check if at least one recipient matches
-				for _, sentTo := range msg.To {
-					for _, emailTo := range email.To {
-						if strings.Contains(emailTo, sentTo) || strings.Contains(sentTo, emailTo) {
-							emailFound = true
-							break
-						}
-					}
-					if emailFound {
-						break
-					}
-				}
-			} else {
-				// If no To addresses to compare, just match on subject and recent time
-				emailFound = true
-			}
-		}
-		if emailFound {
-			break
-		}
-	}
-	
-	if !emailFound {
-		return fmt.Errorf("sent email not found in sent folder")
-	}
-	
-	// Check for bounce notifications
-	if err := checkForBounces(msg, config); err != nil {
-		return fmt.Errorf("delivery verification failed: %v", err)
-	}
-	
-	return nil
-}
-
-// checkForBounces checks the inbox for bounce notifications related to the sent email
-func checkForBounces(msg *EmailMessage, config *Config) error {
-	// Wait additional time for potential bounces to arrive
-	time.Sleep(3 * time.Second)
-	
-	// Read recent emails from inbox to check for bounces
-	readOpts := ReadOptions{
-		Limit:       10,
-		FromAddress: "Mail Delivery System", // Common bounce sender
-		Since:       time.Now().Add(-10 * time.Minute),
-	}
-	
-	inboxEmails, err := Read(readOpts)
-	if err != nil {
-		// If we can't read inbox, don't fail verification - just warn
-		fmt.Printf("Note: Could not check for bounces: %v\n", err)
-		return nil
-	}
-	
-	// Check for bounce notifications that match our recipients
-	for _, email := range inboxEmails {
-		if isBounceNotification(email, msg) {
-			// Extract failed recipients from bounce message
-			failedRecipients := extractFailedRecipients(email, msg.To)
-			if len(failedRecipients) > 0 {
-				return fmt.Errorf("email delivery failed for: %s", strings.Join(failedRecipients, ", "))
-			}
-		}
-	}
-	
-	// Also check for bounces from common bounce senders
-	bounceFromAddresses := []string{
-		"mailer-daemon",
-		"postmaster",
-		"noreply",
-		"Mail Delivery System",
-		"Mail Delivery Subsystem",
-	}
-	
-	for _, bounceFrom := range bounceFromAddresses {
-		readOpts.FromAddress = bounceFrom
-		bounceEmails, err := Read(readOpts)
-		if err != nil {
-			continue // Skip if can't read with this sender
-		}
-		
-		for _, email := range bounceEmails {
-			if isBounceNotification(email, msg) {
-				failedRecipients := extractFailedRecipients(email, msg.To)
-				if len(failedRecipients) > 0 {
-					return fmt.Errorf("email delivery failed for: %s", strings.Join(failedRecipients, ", "))
-				}
-			}
-		}
-	}
-	
-	return nil
-}
-
-// isBounceNotification checks if an email is a bounce notification for our sent message
-func isBounceNotification(email *Email, sentMsg *EmailMessage) bool {
-	// Check common bounce indicators in subject
-	bounceIndicators := []string{
-		"Undelivered Mail Returned to Sender",
-		"Delivery Status Notification",
-		"Mail delivery failed",
-		"Returned mail",
-		"Message not delivered",
-		"Delivery failure",
-		"Undeliverable:",
-		"Failed:",
-	}
-	
-	subjectLower := strings.ToLower(email.Subject)
-	for _, indicator := range bounceIndicators {
-		if strings.Contains(subjectLower, strings.ToLower(indicator)) {
-			// Check if bounce refers to our original message
-			bodyLower := strings.ToLower(email.Body)
-			
-			// Look for our original subject in the bounce message
-			if strings.Contains(bodyLower, strings.ToLower(sentMsg.Subject)) {
-				return true
-			}
-			
-			// Look for our recipients in the bounce message
-			for _, recipient := range sentMsg.To {
-				if strings.Contains(bodyLower, strings.ToLower(recipient)) {
-					return true
-				}
-			}
-		}
-	}
-	
-	return false
-}
-
-// extractFailedRecipients extracts the failed recipient addresses from a bounce message
-func extractFailedRecipients(bounceEmail *Email, originalRecipients []string) []string {
-	var failedRecipients []string
-	bodyLower := strings.ToLower(bounceEmail.Body)
-	
-	// Check each original recipient to see if it's mentioned in the bounce
-	for _, recipient := range originalRecipients {
-		if strings.Contains(bodyLower, strings.ToLower(recipient)) {
-			failedRecipients = append(failedRecipients, recipient)
-		}
-	}
-	
-	return failedRecipients
-}
-
 // saveToLocalSentFolder saves the email to the local .email/sent directory
-func saveToLocalSentFolder(messageContent string, config *Config, msg *EmailMessage, from string) error {
+func saveToLocalSentFolder(messageContent string, config *Config, msg *EmailMessage, from string, messageID string) error {
 	// Ensure directories exist
 	if err := EnsureEmailDirectories(); err != nil {
 		return fmt.Errorf("failed to create email directories: %v", err)
@@ -861,6 +574,10 @@ func saveToLocalSentFolder(messageContent string, config *Config, msg *EmailMess
 		Body:        msg.Body,
 		Attachments: msg.Attachments,
 		Date:        time.Now(),
+		// Threading headers let 'reply --ai' find our replies in a thread
+		MessageID:   messageID,
+		InReplyTo:   msg.InReplyTo,
+		References:  strings.Join(msg.References, " "),
 	}
 	
 	// Generate filename
@@ -875,100 +592,151 @@ func saveToLocalSentFolder(messageContent string, config *Config, msg *EmailMess
 	return nil
 }
 
-func sendWithSTARTTLS(host string, port int, auth smtp.Auth, from string, to []string, msg string) error {
+func sendWithSTARTTLS(host string, port int, auth smtp.Auth, from string, to []string, msg string, envelopeID string) (string, error) {
 	addr := fmt.Sprintf("%s:%d", host, port)
 	
 	c, err := smtp.Dial(addr)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer c.Close()
 
 	// Start TLS
 	tlsConfig := &tls.Config{ServerName: host}
 	if err = c.StartTLS(tlsConfig); err != nil {
-		return err
+		return "", err
 	}
 
 	// Authenticate
 	if err = c.Auth(auth); err != nil {
-		return err
-	}
-
-	// Set sender and recipients
-	if err = c.Mail(from); err != nil {
-		return err
-	}
-	for _, addr := range to {
-		if err = c.Rcpt(addr); err != nil {
-			return err
-		}
+		return "", err
 	}
 
-	// Send the email body
-	w, err := c.Data()
+	response, err := deliverMessage(c, from, to, msg, envelopeID)
 	if err != nil {
-		return err
-	}
-	_, err = w.Write([]byte(msg))
-	if err != nil {
-		return err
-	}
-	err = w.Close()
-	if err != nil {
-		return err
+		return "", err
 	}
 
-	return c.Quit()
+	return response, c.Quit()
 }
 
-func sendWithSMTPS(host string, port int, auth smtp.Auth, from string, to []string, msg string) error {
+func sendWithSMTPS(host string, port int, auth smtp.Auth, from string, to []string, msg string, envelopeID string) (string, error) {
 	addr := fmt.Sprintf("%s:%d", host, port)
 	
 	// Connect with TLS
 	tlsConfig := &tls.Config{ServerName: host}
 	conn, err := tls.Dial("tcp", addr, tlsConfig)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	c, err := smtp.NewClient(conn, host)
 	if err != nil {
 		conn.Close()
-		return err
+		return "", err
 	}
 	defer c.Close()
 
 	// Authenticate
 	if err = c.Auth(auth); err != nil {
-		return err
+		return "", err
 	}
 
-	// Set sender and recipients
-	if err = c.Mail(from); err != nil {
-		return err
+	response, err := deliverMessage(c, from, to, msg, envelopeID)
+	if err != nil {
+		return "", err
+	}
+
+	return response, c.Quit()
+}
+
+// sendWithPlainSMTP behaves like smtp.SendMail: TLS and AUTH are used only when offered
+func sendWithPlainSMTP(host string, port int, auth smtp.Auth, from string, to []string, msg string, envelopeID string) (string, error) {
+	c, err := smtp.Dial(fmt.Sprintf("%s:%d", host, port))
+	if err != nil {
+		return "", err
 	}
-	for _, addr := range to {
-		if err = c.Rcpt(addr); err != nil {
-			return err
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return "", err
+		}
+	}
+	if ok, _ := c.Extension("AUTH"); ok && auth != nil {
+		if err = c.Auth(auth); err != nil {
+			return "", err
 		}
 	}
 
-	// Send the email body
-	w, err := c.Data()
+	response, err := deliverMessage(c, from, to, msg, envelopeID)
 	if err != nil {
-		return err
+		return "", err
 	}
-	_, err = w.Write([]byte(msg))
-	if err != nil {
-		return err
+
+	return response, c.Quit()
+}
+
+// deliverMessage sets the envelope and sends the message body, returning the
+// server's final reply. When the server supports DSN (RFC 3461) it asks for
+// failure and delay reports that carry envelopeID, so they can be linked back
+// to the sent message.
+func deliverMessage(c *smtp.Client, from string, to []string, msg string, envelopeID string) (string, error) {
+	if dsn, _ := c.Extension("DSN"); dsn && envelopeID != "" {
+		mailCmd := fmt.Sprintf("MAIL FROM:<%s> RET=HDRS ENVID=%s", from, encodeXText(envelopeID))
+		if ok, _ := c.Extension("8BITMIME"); ok {
+			mailCmd += " BODY=8BITMIME"
+		}
+		if _, err := smtpCommand(c, 250, mailCmd); err != nil {
+			return "", err
+		}
+		for _, addr := range to {
+			rcptCmd := fmt.Sprintf("RCPT TO:<%s> NOTIFY=FAILURE,DELAY ORCPT=rfc822;%s", addr, encodeXText(addr))
+			if _, err := smtpCommand(c, 25, rcptCmd); err != nil {
+				return "", err
+			}
+		}
+	} else {
+		if err := c.Mail(from); err != nil {
+			return "", err
+		}
+		for _, addr := range to {
+			if err := c.Rcpt(addr); err != nil {
+				return "", err
+			}
+		}
 	}
-	err = w.Close()
-	if err != nil {
-		return err
+
+	// Send the email body. c.Data() would discard the final reply, which
+	// carries the queue ID, so DATA is sent directly.
+	if _, err := smtpCommand(c, 354, "DATA"); err != nil {
+		return "", err
+	}
+	w := c.Text.DotWriter()
+	if _, err := w.Write([]byte(msg)); err != nil {
+		w.Close()
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
 	}
+	_, response, err := c.Text.ReadResponse(250)
+	return response, err
+}
 
-	return c.Quit()
+// smtpCommand sends a raw command, for parameters net/smtp doesn't support
+func smtpCommand(c *smtp.Client, expectCode int, command string) (string, error) {
+	if strings.ContainsAny(command, "\r\n") {
+		return "", fmt.Errorf("smtp: command contains CR or LF")
+	}
+	id, err := c.Text.Cmd("%s", command)
+	if err != nil {
+		return "", err
+	}
+	c.Text.StartResponse(id)
+	defer c.Text.EndResponse(id)
+	_, response, err := c.Text.ReadResponse(expectCode)
+	return response, err
 }
 
 // handleSendError provides specific error handling for email sending failures
@@ -1092,44 +860,18 @@ func SendDrafts(opts SendDraftsOptions) error {
 			continue
 		}
 
-		// Load config to get signature settings
-		config, err := LoadConfig()
-		if err != nil {
-			fmt.Printf("  ⚠️  Warning: Could not load config for signature: %v\n", err)
-		}
-
-		// Create email message
+		// Create email message; the account's signature is added when sending
 		msg := &EmailMessage{
-			To:          draft.To,
-			CC:          draft.CC,
-			BCC:         draft.BCC,
-			Subject:     draft.Subject,
-			Body:        draft.Body,
-			Attachments: draft.Attachments,
-			InReplyTo:   draft.InReplyTo,
-			References:  draft.References,
-		}
-
-		// Add signature if config loaded successfully
-		if config != nil {
-			var sig string
-			// Check for signature override first
-			if config.SignatureOverride != "" {
-				sig = config.SignatureOverride
-			} else {
-				// Use FromEmail if specified, otherwise use Email
-				emailToShow := config.Email
-				if config.FromEmail != "" {
-					emailToShow = config.FromEmail
-				}
-				name := config.FromName
-				if name == "" {
-					name = strings.Split(emailToShow, "@")[0]
-				}
-				sig = fmt.Sprintf("\n--\n%s\n%s", name, emailToShow)
-			}
-			msg.IncludeSignature = true
-			msg.SignatureText = sig
+			To:               draft.To,
+			CC:               draft.CC,
+			BCC:              draft.BCC,
+			Subject:          draft.Subject,
+			Body:             draft.Body,
+			Attachments:      draft.Attachments,
+			InReplyTo:        draft.InReplyTo,
+			References:       draft.References,
+			IncludeSignature: true,
+			SignatureName:    draft.Signature,
 		}
 
 		// Convert markdown to HTML
@@ -1139,6 +881,13 @@ func SendDrafts(opts SendDraftsOptions) error {
 
 		// Send the email
 		err = Send(msg)
+		var limitErr *SendLimitError
+		if errors.As(err, &limitErr) {
+			// Leave this and the remaining drafts in place for the next run
+			fmt.Printf("  ⏸️  %v\n", err)
+			fmt.Println("  Run 'mailos send --drafts' again later to send the rest")
+			break
+		}
 		if err != nil {
 			fmt.Printf("  ❌ Failed to send: %v\n", err)
 			// Move to failed directory
@@ -0,0 +1,248 @@
+package mailos
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+// SendJournalEntry records one accepted SMTP transaction
+type SendJournalEntry struct {
+	MessageID    string     `json:"message_id"`
+	Subject      string     `json:"subject"`
+	From         string     `json:"from"`
+	Recipients   []string   `json:"recipients"`
+	SMTPHost     string     `json:"smtp_host"`
+	QueueID      string     `json:"queue_id,omitempty"`
+	SMTPResponse string     `json:"smtp_response,omitempty"`
+	SubmittedAt  time.Time  `json:"submitted_at"`
+	AcceptedAt   time.Time  `json:"accepted_at"`
+	SentFolder   string     `json:"sent_folder,omitempty"`
+	VerifiedAt   *time.Time `json:"verified_at,omitempty"`
+}
+
+// queueIDPatterns extract the server's queue ID from the final 250 reply
+var queueIDPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)queued as ([A-Za-z0-9._-]+)`), // Postfix, Sendmail and most relays
+	regexp.MustCompile(`(?i)\bid=([A-Za-z0-9._-]+)`),      // Exim
+	regexp.MustCompile(`(\S+) - gsmtp`),                   // Gmail
+}
+
+// parseQueueID returns the queue ID from a 250 reply, or "" if there is none
+func parseQueueID(response string) string {
+	for _, pattern := range queueIDPatterns {
+		if m := pattern.FindStringSubmatch(response); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// RecordSend adds an accepted message to the send journal and starts tracking
+// delivery reports for its recipients. The batches of a bulk send share a
+// Message-ID, so their recipients are added to the same entry.
+func (dm *DatabaseManager) RecordSend(entry *SendJournalEntry) error {
+	entry.MessageID = strings.Trim(entry.MessageID, "<>")
+	all := entry.Recipients
+	var earlier string
+	if err := dm.db.QueryRow(`SELECT recipients FROM send_journal WHERE message_id = ?`, entry.MessageID).Scan(&earlier); err == nil {
+		var previous []string
+		json.Unmarshal([]byte(earlier), &previous)
+		all = append(previous, entry.Recipients...)
+	}
+	recipients, _ := json.Marshal(all)
+
+	_, err := dm.db.Exec(`
+		INSERT INTO send_journal (
+			message_id, subject, from_address, recipients, smtp_host,
+			queue_id, smtp_response, submitted_at, accepted_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(message_id) DO UPDATE SET
+			recipients = excluded.recipients,
+			queue_id = excluded.queue_id,
+			smtp_response = excluded.smtp_response,
+			accepted_at = excluded.accepted_at
+	`, entry.MessageID, entry.Subject, entry.From, string(recipients), entry.SMTPHost,
+		entry.QueueID, entry.SMTPResponse, entry.SubmittedAt, entry.AcceptedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record send: %v", err)
+	}
+
+	return dm.TrackSentMessage(entry.MessageID, entry.Subject, entry.Recipients, entry.AcceptedAt)
+}
+
+// SetSentFolder records which IMAP folder the copy of a sent message went to
+func (dm *DatabaseManager) SetSentFolder(messageID, folder string) error {
+	_, err := dm.db.Exec(`UPDATE send_journal SET sent_folder = ? WHERE message_id = ?`, folder, strings.Trim(messageID, "<>"))
+	return err
+}
+
+// MarkVerified records that a sent message was found in the Sent folder
+func (dm *DatabaseManager) MarkVerified(messageID, folder string, at time.Time) error {
+	_, err := dm.db.Exec(`UPDATE send_journal SET sent_folder = ?, verified_at = ? WHERE message_id = ?`,
+		folder, at, strings.Trim(messageID, "<>"))
+	return err
+}
+
+// ListSendJournal returns the most recent journal entries, newest first
+func (dm *DatabaseManager) ListSendJournal(limit int) ([]*SendJournalEntry, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+	rows, err := dm.db.Query(`
+		SELECT message_id, COALESCE(subject, ''), COALESCE(from_address, ''), COALESCE(recipients, '[]'),
+			COALESCE(smtp_host, ''), COALESCE(queue_id, ''), COALESCE(smtp_response, ''),
+			submitted_at, accepted_at, COALESCE(sent_folder, ''), verified_at
+		FROM send_journal
+		ORDER BY accepted_at DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query send journal: %v", err)
+	}
+	defer rows.Close()
+
+	var entries []*SendJournalEntry
+	for rows.Next() {
+		entry := &SendJournalEntry{}
+		var recipients string
+		var verifiedAt sql.NullTime
+		if err := rows.Scan(&entry.MessageID, &entry.Subject, &entry.From, &recipients,
+			&entry.SMTPHost, &entry.QueueID, &entry.SMTPResponse,
+			&entry.SubmittedAt, &entry.AcceptedAt, &entry.SentFolder, &verifiedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan send journal: %v", err)
+		}
+		json.Unmarshal([]byte(recipients), &entry.Recipients)
+		if verifiedAt.Valid {
+			entry.VerifiedAt = &verifiedAt.Time
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// RecordSend adds an accepted message to the account's send journal
+func RecordSend(accountEmail string, entry *SendJournalEntry) error {
+	dm, err := NewDatabaseManager(accountEmail)
+	if err != nil {
+		return err
+	}
+	defer dm.Close()
+
+	return dm.RecordSend(entry)
+}
+
+// RecordSentFolder notes the IMAP folder a sent message was appended to
+func RecordSentFolder(accountEmail, messageID, folder string) error {
+	dm, err := NewDatabaseManager(accountEmail)
+	if err != nil {
+		return err
+	}
+	defer dm.Close()
+
+	return dm.SetSentFolder(messageID, folder)
+}
+
+// VerifySentMessages looks up the most recent journal entries in the IMAP Sent
+// folder by Message-ID and records the ones it finds
+func VerifySentMessages(accountEmail string, limit int) ([]*SendJournalEntry, error) {
+	setup, err := InitializeMailSetup(accountEmail)
+	if err != nil {
+		return nil, err
+	}
+	config := setup.Config
+
+	dm, err := NewDatabaseManager(config.Email)
+	if err != nil {
+		return nil, err
+	}
+	defer dm.Close()
+
+	entries, err := dm.ListSendJournal(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []*SendJournalEntry
+	for _, entry := range entries {
+		if entry.VerifiedAt == nil {
+			pending = append(pending, entry)
+		}
+	}
+	if len(pending) == 0 {
+		return entries, nil
+	}
+
+	c, err := connectToIMAPServer(config)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Logout()
+
+	sentFolderNames := []string{"Sent", "Sent Items", "Sent Messages", "[Gmail]/Sent Mail", "INBOX.Sent"}
+	for _, entry := range pending {
+		folders := sentFolderNames
+		if entry.SentFolder != "" {
+			folders = append([]string{entry.SentFolder}, sentFolderNames...)
+		}
+
+		for _, folder := range folders {
+			if _, err := c.Select(folder, true); err != nil {
+				continue
+			}
+			criteria := imap.NewSearchCriteria()
+			criteria.Header.Add("Message-Id", "<"+entry.MessageID+">")
+			uids, err := c.UidSearch(criteria)
+			if err != nil || len(uids) == 0 {
+				continue
+			}
+
+			entry.SentFolder = folder
+			verifiedAt := time.Now()
+			entry.VerifiedAt = &verifiedAt
+			if err := dm.MarkVerified(entry.MessageID, folder, verifiedAt); err != nil {
+				return nil, fmt.Errorf("failed to record verification: %v", err)
+			}
+			break
+		}
+	}
+
+	return entries, nil
+}
+
+// FormatSendJournal renders journal entries and their verification state
+func FormatSendJournal(entries []*SendJournalEntry) string {
+	if len(entries) == 0 {
+		return "No sent emails in the send journal yet.\n"
+	}
+
+	var b strings.Builder
+	for _, entry := range entries {
+		subject := entry.Subject
+		if subject == "" {
+			subject = "(no subject)"
+		}
+		icon := "✗"
+		if entry.VerifiedAt != nil {
+			icon = "✓"
+		}
+		b.WriteString(fmt.Sprintf("\n%s %s\n", icon, subject))
+		b.WriteString(fmt.Sprintf("    Message-ID: <%s>\n", entry.MessageID))
+		accepted := fmt.Sprintf("    Accepted: %s by %s", entry.AcceptedAt.Local().Format("Jan 2, 2006 3:04 PM"), entry.SMTPHost)
+		if entry.QueueID != "" {
+			accepted += fmt.Sprintf(" (queue ID %s)", entry.QueueID)
+		}
+		b.WriteString(accepted + "\n")
+		if entry.VerifiedAt == nil {
+			b.WriteString("    Not found in the Sent folder\n")
+		} else {
+			b.WriteString(fmt.Sprintf("    In %s\n", entry.SentFolder))
+		}
+	}
+	return b.String()
+}
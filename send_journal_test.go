@@ -0,0 +1,86 @@
+package mailos
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseQueueID(t *testing.T) {
+	cases := map[string]string{
+		"2.0.0 Ok: queued as 4XyZ1k2Lmnz9":                                  "4XyZ1k2Lmnz9",
+		"OK id=1sXk2P-0003aB-Qz":                                            "1sXk2P-0003aB-Qz",
+		"2.0.0 OK  1726000000 d9443c01a7336-20b0f1b2c3dsi12345.321 - gsmtp": "d9443c01a7336-20b0f1b2c3dsi12345.321",
+		"2.6.0 Queued mail for delivery":                                    "",
+	}
+	for response, want := range cases {
+		if got := parseQueueID(response); got != want {
+			t.Errorf("parseQueueID(%q) = %q, want %q", response, got, want)
+		}
+	}
+}
+
+func TestSendJournal(t *testing.T) {
+	tmpDir := setupTestGroups(t)
+	defer cleanupTestGroups(tmpDir)
+
+	dm, err := NewDatabaseManager("me@example.com")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer dm.Close()
+
+	accepted := time.Date(2024, 9, 2, 10, 0, 0, 0, time.UTC)
+	for i, subject := range []string{"Weekly update", "Weekly update"} {
+		entry := &SendJournalEntry{
+			MessageID:   []string{"<one@example.com>", "two@example.com"}[i],
+			Subject:     subject,
+			From:        "me@example.com",
+			Recipients:  []string{"bob@example.org"},
+			SMTPHost:    "smtp.example.com",
+			QueueID:     "Q" + subject[:1],
+			SubmittedAt: accepted.Add(time.Duration(i) * time.Hour),
+			AcceptedAt:  accepted.Add(time.Duration(i)*time.Hour + time.Second),
+		}
+		if err := dm.RecordSend(entry); err != nil {
+			t.Fatalf("Failed to record send: %v", err)
+		}
+	}
+	if err := dm.SetSentFolder("one@example.com", "Sent"); err != nil {
+		t.Fatal(err)
+	}
+	// A later batch of the same send, which keeps no Sent copy of its own
+	batch := &SendJournalEntry{MessageID: "<one@example.com>", Subject: "Weekly update", From: "me@example.com", Recipients: []string{"carol@example.org"},
+		SMTPHost: "smtp.example.com", SubmittedAt: accepted.Add(time.Minute), AcceptedAt: accepted.Add(time.Minute)}
+	if err := dm.RecordSend(batch); err != nil {
+		t.Fatal(err)
+	}
+	if err := dm.MarkVerified("two@example.com", "Sent Items", accepted.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := dm.ListSendJournal(10)
+	if err != nil {
+		t.Fatalf("Failed to list journal: %v", err)
+	}
+	// Repeated subjects stay separate because entries are keyed by Message-ID
+	if len(entries) != 2 || entries[0].MessageID != "two@example.com" || entries[1].MessageID != "one@example.com" {
+		t.Fatalf("Expected both entries newest first, got %+v", entries)
+	}
+	if entries[0].VerifiedAt == nil || entries[0].SentFolder != "Sent Items" {
+		t.Errorf("Expected the second message verified, got %+v", entries[0])
+	}
+	if entries[1].VerifiedAt != nil || entries[1].SentFolder != "Sent" || strings.Join(entries[1].Recipients, ",") != "bob@example.org,carol@example.org" {
+		t.Errorf("Expected the first message pending in Sent, got %+v", entries[1])
+	}
+	if data, _ := json.Marshal(entries[1]); strings.Contains(string(data), "verified_at") {
+		t.Errorf("Expected no verified_at for a pending message, got %s", data)
+	}
+
+	// Recording a send also starts delivery tracking
+	statuses, err := dm.ListDeliveryStatus(10)
+	if err != nil || len(statuses) != 2 || statuses[0].Recipients[0].State != DeliverySent || len(statuses[1].Recipients) != 2 {
+		t.Errorf("Expected both messages tracked as sent, got %+v (%v)", statuses, err)
+	}
+}
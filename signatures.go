@@ -0,0 +1,410 @@
+package mailos
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+// NoSignatureName turns the signature off when used as a signature name
+const NoSignatureName = "none"
+
+// signatureNamePattern keeps signature names usable as file names
+var signatureNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Signature is a named markdown signature stored for one account
+type Signature struct {
+	Name     string
+	Path     string
+	Markdown string
+}
+
+// Text renders the signature as plain text below a "-- " delimiter
+func (s *Signature) Text() string {
+	return "\n-- \n" + markdownToPlainText(s.Markdown)
+}
+
+// HTML renders the signature's markdown, keeping its line breaks
+func (s *Signature) HTML() string {
+	rendered := blackfriday.Run([]byte(strings.TrimSpace(s.Markdown)),
+		blackfriday.WithExtensions(blackfriday.CommonExtensions|blackfriday.HardLineBreak))
+	return "<div class=\"signature\">\n" + string(rendered) + "</div>\n"
+}
+
+var (
+	mdImagePattern    = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	mdLinkPattern     = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)[^)]*\)`)
+	mdStrongPattern   = regexp.MustCompile(`(\*\*|__)(.+?)(\*\*|__)`)
+	mdEmphasisPattern = regexp.MustCompile(`\*([^*\s][^*]*)\*`)
+	mdCodePattern     = regexp.MustCompile("`([^`]*)`")
+	mdHeadingPattern  = regexp.MustCompile(`(?m)^#{1,6}\s+`)
+)
+
+// markdownToPlainText strips markdown syntax from a signature, writing links
+// as "text <url>" unless the text already is the address
+func markdownToPlainText(markdown string) string {
+	text := mdImagePattern.ReplaceAllString(markdown, "$1")
+	text = mdLinkPattern.ReplaceAllStringFunc(text, func(link string) string {
+		m := mdLinkPattern.FindStringSubmatch(link)
+		label, target := m[1], m[2]
+		if label == target || "mailto:"+label == target || "tel:"+label == target {
+			return label
+		}
+		return fmt.Sprintf("%s <%s>", label, target)
+	})
+	text = mdStrongPattern.ReplaceAllString(text, "$2")
+	text = mdEmphasisPattern.ReplaceAllString(text, "$1")
+	text = mdCodePattern.ReplaceAllString(text, "$1")
+	text = mdHeadingPattern.ReplaceAllString(text, "")
+
+	// Markdown hard breaks are trailing spaces or a trailing backslash
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(strings.TrimRight(line, " \t"), "\\")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// validateSignatureName rejects names that can't be stored as a file
+func validateSignatureName(name string) error {
+	if name == NoSignatureName {
+		return fmt.Errorf("'%s' is reserved for turning the signature off", NoSignatureName)
+	}
+	if !signatureNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid signature name '%s' (use letters, numbers, '.', '-' and '_')", name)
+	}
+	return nil
+}
+
+// SignatureAccount returns the account whose signatures a config uses
+func SignatureAccount(config *Config) string {
+	if config.ActiveAccount != "" {
+		return config.ActiveAccount
+	}
+	return config.Email
+}
+
+// GetSignaturesDir returns the directory holding an account's signatures
+func GetSignaturesDir(accountEmail string) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %v", err)
+	}
+	return filepath.Join(homeDir, ".email", accountEmail, "signatures"), nil
+}
+
+// signaturePath returns where a named signature is stored
+func signaturePath(accountEmail, name string) (string, error) {
+	if err := validateSignatureName(name); err != nil {
+		return "", err
+	}
+	dir, err := GetSignaturesDir(accountEmail)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".md"), nil
+}
+
+// LoadSignature reads a named signature of an account
+func LoadSignature(accountEmail, name string) (*Signature, error) {
+	path, err := signaturePath(accountEmail, name)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("signature '%s' not found for %s (see 'mailos signature list')", name, accountEmail)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read signature '%s': %v", name, err)
+	}
+	return &Signature{Name: name, Path: path, Markdown: string(content)}, nil
+}
+
+// SaveSignature writes a named signature of an account, replacing any existing one
+func SaveSignature(accountEmail, name, markdown string) (*Signature, error) {
+	path, err := signaturePath(accountEmail, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create signatures directory: %v", err)
+	}
+	markdown = strings.TrimSpace(markdown) + "\n"
+	if err := os.WriteFile(path, []byte(markdown), 0600); err != nil {
+		return nil, fmt.Errorf("failed to save signature '%s': %v", name, err)
+	}
+	return &Signature{Name: name, Path: path, Markdown: markdown}, nil
+}
+
+// ListSignatures returns an account's signatures sorted by name
+func ListSignatures(accountEmail string) ([]*Signature, error) {
+	dir, err := GetSignaturesDir(accountEmail)
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.md"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list signatures: %v", err)
+	}
+	var names []string
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".md")
+		if validateSignatureName(name) == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var signatures []*Signature
+	for _, name := range names {
+		signature, err := LoadSignature(accountEmail, name)
+		if err != nil {
+			return nil, err
+		}
+		signatures = append(signatures, signature)
+	}
+	return signatures, nil
+}
+
+// EditSignature opens a named signature in $VISUAL or $EDITOR, creating it
+// from the account's name and address when it doesn't exist yet
+func EditSignature(config *Config, name string) (*Signature, error) {
+	accountEmail := SignatureAccount(config)
+	path, err := signaturePath(accountEmail, name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		fromEmail, _ := senderAddress(config)
+		starter := fromEmail
+		if config.FromName != "" {
+			starter = config.FromName + "\n" + fromEmail
+		}
+		if _, err := SaveSignature(accountEmail, name, starter); err != nil {
+			return nil, err
+		}
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+
+	// The editor setting may carry arguments, e.g. "code --wait"
+	parts := strings.Fields(editor)
+	cmd := exec.Command(parts[0], append(parts[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to run editor %s: %v", editor, err)
+	}
+	return LoadSignature(accountEmail, name)
+}
+
+// FormatSignatureList renders an account's signatures, marking the default
+func FormatSignatureList(accountEmail string, signatures []*Signature, defaultName string) string {
+	if len(signatures) == 0 {
+		return fmt.Sprintf("No signatures for %s yet. Create one with 'mailos signature add <name>'.\n", accountEmail)
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("Signatures for %s:\n", accountEmail))
+	for _, signature := range signatures {
+		marker := " "
+		if signature.Name == defaultName {
+			marker = "*"
+		}
+		preview := strings.SplitN(markdownToPlainText(signature.Markdown), "\n", 2)[0]
+		b.WriteString(fmt.Sprintf("  %s %-16s %s\n", marker, signature.Name, preview))
+	}
+	if defaultName == NoSignatureName {
+		b.WriteString("\nSignatures are off by default for this account.\n")
+	} else if defaultName == "" {
+		b.WriteString("\nNo default signature set; use 'mailos signature use <name>' to pick one.\n")
+	}
+	return b.String()
+}
+
+// AccountSignature returns the signature an account uses by default: its
+// default named signature, then its signature text, then its name and address.
+// Aliases get no automatic signature.
+func AccountSignature(config *Config) (string, string) {
+	if config.DefaultSignature == NoSignatureName {
+		return "", ""
+	}
+	if config.DefaultSignature != "" {
+		signature, err := LoadSignature(SignatureAccount(config), config.DefaultSignature)
+		if err == nil {
+			return signature.Text(), signature.HTML()
+		}
+		fmt.Printf("⚠️  Default signature unavailable: %v\n", err)
+	}
+
+	if config.SignatureOverride != "" {
+		return config.SignatureOverride, ""
+	}
+
+	if config.FromEmail != "" && config.FromEmail != config.Email {
+		return "", ""
+	}
+	fromEmail, _ := senderAddress(config)
+	name := config.FromName
+	if name == "" {
+		name = strings.Split(fromEmail, "@")[0]
+	}
+	return fmt.Sprintf("\n--\n%s\n%s", name, fromEmail), ""
+}
+
+// applySignature resolves the signature of msg: a name chosen in front
+// matter, or the account's default when the caller didn't supply the text
+func applySignature(msg *EmailMessage, config *Config) error {
+	switch msg.SignatureName {
+	case "":
+		if msg.IncludeSignature && msg.SignatureText == "" {
+			msg.SignatureText, msg.SignatureHTML = AccountSignature(config)
+		}
+	case NoSignatureName:
+		msg.IncludeSignature = false
+	default:
+		signature, err := LoadSignature(SignatureAccount(config), msg.SignatureName)
+		if err != nil {
+			return err
+		}
+		msg.IncludeSignature = true
+		msg.SignatureText = signature.Text()
+		msg.SignatureHTML = signature.HTML()
+	}
+	return nil
+}
+
+// quotedTextPattern finds the start of a reply's attribution line and quote,
+// or of a forwarded message
+var quotedTextPattern = regexp.MustCompile(`(?m)^(?:On .*wrote:[ \t]*\r?\n>|-{5,} ?Forwarded message ?-{5,})`)
+
+var (
+	forwardedHTMLPattern   = regexp.MustCompile(`-{5,} ?forwarded message`)
+	htmlAttributionPattern = regexp.MustCompile(`wrote:\s*(?:<[^>]*>\s*)*(?:&gt;|<blockquote)`)
+	htmlTagPattern         = regexp.MustCompile(`<[^>]*>`)
+)
+
+// quoteStart returns where quoted text begins in a plain text body, or -1.
+// A quote followed by the reply (bottom posting) counts as no quote, so the
+// signature goes at the end.
+func quoteStart(body string) int {
+	loc := quotedTextPattern.FindStringIndex(body)
+	if loc == nil {
+		return -1
+	}
+	if strings.HasPrefix(body[loc[0]:], "On ") {
+		rest := body[loc[1]-1:]
+		for _, line := range strings.Split(rest, "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, ">") {
+				return -1
+			}
+		}
+	}
+	return loc[0]
+}
+
+// quoteStartHTML returns where quoted text begins in an HTML body, or -1.
+// The attribution line above a quote belongs to the quote.
+func quoteStartHTML(body string) int {
+	lower := strings.ToLower(body)
+	start := -1
+	if loc := htmlAttributionPattern.FindStringIndex(lower); loc != nil {
+		start = loc[0]
+		if strings.HasSuffix(lower[:loc[1]], "<blockquote") && textAfterBlockquote(lower, loc[1]-len("<blockquote")) {
+			return -1
+		}
+	} else {
+		start = strings.Index(lower, "<blockquote")
+	}
+	if loc := forwardedHTMLPattern.FindStringIndex(lower); loc != nil && (start < 0 || loc[0] < start) {
+		start = loc[0]
+	}
+	if start < 0 {
+		return -1
+	}
+
+	// Back up to the start of the block holding the marker
+	boundary := lastBlockBoundary(lower[:start])
+	for boundary < start && strings.ContainsRune(" \t\r\n", rune(body[boundary])) {
+		boundary++
+	}
+	return boundary
+}
+
+// textAfterBlockquote reports whether text follows the blockquote opened at
+// start, as when the reply is written below the quote
+func textAfterBlockquote(lower string, start int) bool {
+	depth := 0
+	for i := start; i < len(lower); {
+		open := strings.Index(lower[i:], "<blockquote")
+		closing := strings.Index(lower[i:], "</blockquote")
+		if closing < 0 {
+			return false
+		}
+		if open >= 0 && open < closing {
+			depth++
+			i += open + len("<blockquote")
+			continue
+		}
+		depth--
+		i += closing + len("</blockquote")
+		if depth == 0 {
+			rest := lower[i:]
+			if end := strings.Index(rest, ">"); end >= 0 {
+				rest = rest[end+1:]
+			}
+			return strings.TrimSpace(htmlTagPattern.ReplaceAllString(rest, "")) != ""
+		}
+	}
+	return false
+}
+
+// lastBlockBoundary returns the offset just past the last closing block tag
+// or line break in s, or 0 when there is none
+func lastBlockBoundary(s string) int {
+	boundary := 0
+	for _, tag := range []string{"</p>", "</div>", "<br>", "<br/>", "<br />", "</ul>", "</ol>", "</table>"} {
+		if i := strings.LastIndex(s, tag); i >= 0 && i+len(tag) > boundary {
+			boundary = i + len(tag)
+		}
+	}
+	return boundary
+}
+
+// insertSignature places a plain text signature above any quoted text, or at
+// the end of the body
+func insertSignature(body, signature string) string {
+	i := quoteStart(body)
+	if i < 0 {
+		return body + signature
+	}
+	return strings.TrimRight(body[:i], "\r\n") + signature + "\n\n" + body[i:]
+}
+
+// insertSignatureHTML places an HTML signature above any quoted text, or at
+// the end of the body
+func insertSignatureHTML(body, signature string) string {
+	i := quoteStartHTML(body)
+	if i < 0 {
+		return body + signature
+	}
+	return body[:i] + signature + body[i:]
+}
@@ -0,0 +1,260 @@
+package mailos
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const workSignature = `**Jane Doe**
+Head of Operations, [Acme](https://acme.example)
+[jane@acme.example](mailto:jane@acme.example)`
+
+func TestSignatureRendering(t *testing.T) {
+	signature := &Signature{Name: "work", Markdown: workSignature}
+
+	t.Run("Text", func(t *testing.T) {
+		want := "\n-- \nJane Doe\nHead of Operations, Acme <https://acme.example>\njane@acme.example"
+		if got := signature.Text(); got != want {
+			t.Errorf("Text() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("HTML", func(t *testing.T) {
+		got := signature.HTML()
+		for _, want := range []string{
+			`<div class="signature">`,
+			"<strong>Jane Doe</strong><br",
+			`<a href="https://acme.example">Acme</a>`,
+			`<a href="mailto:jane@acme.example">`,
+		} {
+			if !strings.Contains(got, want) {
+				t.Errorf("Expected %q in HTML, got:\n%s", want, got)
+			}
+		}
+	})
+
+	t.Run("SingleLines", func(t *testing.T) {
+		// Lines without markdown hard breaks still stay on their own lines
+		got := (&Signature{Markdown: "Jane\nAcme"}).HTML()
+		if !strings.Contains(got, "Jane<br") {
+			t.Errorf("Expected a line break kept, got:\n%s", got)
+		}
+	})
+}
+
+func TestSignatureStorage(t *testing.T) {
+	tmpDir := setupTestGroups(t)
+	defer cleanupTestGroups(tmpDir)
+
+	account := "me@example.com"
+	if _, err := SaveSignature(account, "work", workSignature); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	if _, err := SaveSignature(account, "work-short", "Jane"); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	if _, err := SaveSignature("other@example.com", "personal", "J."); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	path := filepath.Join(tmpDir, ".email", account, "signatures", "work.md")
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected the signature stored as %s: %v", path, err)
+	}
+
+	signatures, err := ListSignatures(account)
+	if err != nil {
+		t.Fatalf("Failed to list: %v", err)
+	}
+	if len(signatures) != 2 || signatures[0].Name != "work" || signatures[1].Name != "work-short" {
+		t.Fatalf("Expected the account's two signatures sorted, got %+v", signatures)
+	}
+
+	out := FormatSignatureList(account, signatures, "work")
+	if !strings.Contains(out, "* work ") || !strings.Contains(out, "Jane Doe") {
+		t.Errorf("Expected the default marked with a preview, got:\n%s", out)
+	}
+
+	for _, name := range []string{"none", "../escape", "", "with space"} {
+		if _, err := SaveSignature(account, name, "x"); err == nil {
+			t.Errorf("Expected name %q rejected", name)
+		}
+	}
+	if _, err := LoadSignature(account, "missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+}
+
+func TestSetDefaultSignature(t *testing.T) {
+	tmpDir := setupTestGroups(t)
+	defer cleanupTestGroups(tmpDir)
+
+	config := `{"provider": "gmail", "email": "me@example.com", "password": "x",
+		"accounts": [{"email": "jane@other.example", "provider": "fastmail", "password": "y"}]}`
+	if err := os.WriteFile(filepath.Join(tmpDir, ".email", "config.json"), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetDefaultSignature("me@example.com", "work"); err != nil {
+		t.Fatalf("Failed to set primary default: %v", err)
+	}
+	if err := SetDefaultSignature("jane@other.example", "personal"); err != nil {
+		t.Fatalf("Failed to set account default: %v", err)
+	}
+	if err := SetDefaultSignature("nobody@example.com", "work"); err == nil {
+		t.Errorf("Expected unknown accounts rejected")
+	}
+
+	for account, want := range map[string]string{"me@example.com": "work", "jane@other.example": "personal"} {
+		cfg, err := LoadAccountConfig(account)
+		if err != nil {
+			t.Fatalf("Failed to load %s: %v", account, err)
+		}
+		if cfg.DefaultSignature != want || SignatureAccount(cfg) != account {
+			t.Errorf("Expected %s to use %q, got %q (account %s)", account, want, cfg.DefaultSignature, SignatureAccount(cfg))
+		}
+	}
+}
+
+func TestApplySignature(t *testing.T) {
+	tmpDir := setupTestGroups(t)
+	defer cleanupTestGroups(tmpDir)
+
+	config := &Config{Email: "me@example.com", FromEmail: "me@example.com", FromName: "Jane Doe", ActiveAccount: "me@example.com"}
+	SaveSignature("me@example.com", "work", workSignature)
+	SaveSignature("me@example.com", "work-short", "Jane")
+
+	t.Run("FrontMatter", func(t *testing.T) {
+		msg, err := ProcessEmailWithFrontmatter(&EmailMessage{
+			Body:             "---\nto: bob@example.org\nsubject: Hi\nsignature: work-short\n---\nHello",
+			IncludeSignature: true,
+			SignatureText:    "\n--\nDefault",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := applySignature(msg, config); err != nil {
+			t.Fatalf("Failed to apply: %v", err)
+		}
+		if msg.SignatureText != "\n-- \nJane" || !strings.Contains(msg.SignatureHTML, "Jane") {
+			t.Errorf("Expected the named signature, got %q %q", msg.SignatureText, msg.SignatureHTML)
+		}
+	})
+
+	t.Run("None", func(t *testing.T) {
+		msg := &EmailMessage{IncludeSignature: true, SignatureName: NoSignatureName}
+		applySignature(msg, config)
+		if msg.IncludeSignature {
+			t.Errorf("Expected 'none' to turn the signature off")
+		}
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		if err := applySignature(&EmailMessage{SignatureName: "nope"}, config); err == nil {
+			t.Errorf("Expected an unknown signature name to fail the send")
+		}
+	})
+
+	t.Run("AccountDefault", func(t *testing.T) {
+		msg := &EmailMessage{IncludeSignature: true}
+		applySignature(msg, config)
+		if msg.SignatureText != "\n--\nJane Doe\nme@example.com" {
+			t.Errorf("Expected the name and address without a default, got %q", msg.SignatureText)
+		}
+
+		withDefault := *config
+		withDefault.DefaultSignature = "work"
+		msg = &EmailMessage{IncludeSignature: true}
+		applySignature(msg, &withDefault)
+		if !strings.HasPrefix(msg.SignatureText, "\n-- \nJane Doe\nHead of Operations") {
+			t.Errorf("Expected the default named signature, got %q", msg.SignatureText)
+		}
+
+		withDefault.DefaultSignature = NoSignatureName
+		if text, _ := AccountSignature(&withDefault); text != "" {
+			t.Errorf("Expected no signature when turned off, got %q", text)
+		}
+	})
+}
+
+func TestSignaturePlacement(t *testing.T) {
+	tmpDir := setupTestGroups(t)
+	defer cleanupTestGroups(tmpDir)
+
+	config := &Config{Email: "me@example.com", FromEmail: "me@example.com"}
+	original := &Email{
+		From:    "Bob <bob@example.org>",
+		To:      []string{"me@example.com"},
+		Subject: "Plans",
+		Date:    time.Date(2024, 9, 2, 10, 0, 0, 0, time.UTC),
+		Body:    "Are we still on?",
+	}
+	signature := &Signature{Markdown: "Jane"}
+
+	compose := func(body, bodyHTML string) *OutgoingMessage {
+		return composeOutgoingMessage(&EmailMessage{
+			Body:             body,
+			BodyHTML:         bodyHTML,
+			IncludeSignature: true,
+			SignatureText:    signature.Text(),
+			SignatureHTML:    signature.HTML(),
+		}, config, nil)
+	}
+
+	t.Run("Reply", func(t *testing.T) {
+		note := "Yes, see you there."
+		out := compose(buildReplyText(note, original, defaultReplySettings), buildReplyHTML(note, original, defaultReplySettings))
+
+		sig := strings.Index(out.TextBody, "\n-- \nJane")
+		quote := strings.Index(out.TextBody, "wrote:")
+		if sig < 0 || quote < 0 || sig > quote || sig < strings.Index(out.TextBody, "see you there") {
+			t.Errorf("Expected the signature between the reply and the quote, got:\n%s", out.TextBody)
+		}
+
+		sig = strings.Index(out.HTMLBody, `<div class="signature">`)
+		attribution := strings.Index(out.HTMLBody, `<div class="reply-attribution">On `)
+		if sig < 0 || attribution < 0 || sig > attribution || sig < strings.Index(out.HTMLBody, "see you there") {
+			t.Errorf("Expected the HTML signature above the attribution, got:\n%s", out.HTMLBody)
+		}
+	})
+
+	t.Run("Blockquote", func(t *testing.T) {
+		bodyHTML := "<p>Sure.</p>\n<p>On Monday, Bob wrote:</p>\n<blockquote><p>Lunch?</p></blockquote>\n"
+		got := insertSignatureHTML(bodyHTML, signature.HTML())
+		if !strings.HasPrefix(got, "<p>Sure.</p>\n<div class=\"signature\">") {
+			t.Errorf("Expected the signature above the attribution, got:\n%s", got)
+		}
+	})
+
+	t.Run("ReplyTemplate", func(t *testing.T) {
+		out := compose(buildReplyText("", original, defaultReplySettings), "")
+		if !strings.HasPrefix(strings.TrimLeft(out.TextBody, "\n"), "-- \nJane\n\nOn ") {
+			t.Errorf("Expected the signature first in an empty reply, got:\n%s", out.TextBody)
+		}
+	})
+
+	t.Run("Forward", func(t *testing.T) {
+		out := compose(createForwardBody("FYI", original), createForwardedHTML("FYI", original, "<p>Are we still on?</p>"))
+		if !strings.Contains(out.TextBody, "FYI\n-- \nJane\n\n---------- Forwarded message") {
+			t.Errorf("Expected the signature above the forwarded message, got:\n%s", out.TextBody)
+		}
+		sig := strings.Index(out.HTMLBody, `<div class="signature">`)
+		forwarded := strings.Index(out.HTMLBody, "<div>---------- Forwarded message")
+		if sig < 0 || forwarded < 0 || sig > forwarded || sig < strings.Index(out.HTMLBody, "FYI") {
+			t.Errorf("Expected the HTML signature between the note and the forwarded message, got:\n%s", out.HTMLBody)
+		}
+	})
+
+	t.Run("NewMessage", func(t *testing.T) {
+		out := compose("Hello", "<p>Hello</p>\n")
+		if !strings.HasPrefix(out.TextBody, "Hello\n-- \nJane") {
+			t.Errorf("Expected the signature appended, got:\n%s", out.TextBody)
+		}
+		if !strings.HasPrefix(out.HTMLBody, "<p>Hello</p>\n<div class=\"signature\">") {
+			t.Errorf("Expected the HTML signature appended, got:\n%s", out.HTMLBody)
+		}
+	})
+}
@@ -0,0 +1,275 @@
+package mailos
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// sqlCellWidth caps how much of a value the table output shows
+const sqlCellWidth = 60
+
+// SQLResult holds the rows a read-only archive query returned
+type SQLResult struct {
+	Columns []string
+	Rows    [][]interface{}
+}
+
+// MarshalJSON writes the rows as objects with keys in column order
+func (r *SQLResult) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('[')
+	for i, row := range r.Rows {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteByte('{')
+		for j, column := range r.Columns {
+			if j > 0 {
+				b.WriteByte(',')
+			}
+			key, err := marshalUnescaped(column)
+			if err != nil {
+				return nil, err
+			}
+			value, err := marshalUnescaped(row[j])
+			if err != nil {
+				return nil, err
+			}
+			b.Write(key)
+			b.WriteByte(':')
+			b.Write(value)
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(']')
+	return b.Bytes(), nil
+}
+
+// marshalUnescaped encodes v as JSON, leaving the <> in addresses as they are
+func marshalUnescaped(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
+
+// splitSQL splits text into statements on semicolons outside quotes and
+// comments, dropping the comments and any empty statements
+func splitSQL(text string) []string {
+	var statements []string
+	var current strings.Builder
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`' || c == '[':
+			end := c
+			if c == '[' {
+				end = ']'
+			}
+			j := i + 1
+			for j < len(text) && text[j] != end {
+				j++
+			}
+			current.WriteString(text[i:min(j+1, len(text))])
+			i = j
+		case c == '-' && strings.HasPrefix(text[i:], "--"):
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+			current.WriteByte(' ')
+		case c == '/' && strings.HasPrefix(text[i:], "/*"):
+			end := strings.Index(text[i+2:], "*/")
+			if end < 0 {
+				i = len(text)
+			} else {
+				i += end + 3
+			}
+			current.WriteByte(' ')
+		case c == ';':
+			statements = append(statements, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(c)
+		}
+	}
+	statements = append(statements, current.String())
+
+	var nonEmpty []string
+	for _, statement := range statements {
+		if strings.TrimSpace(statement) != "" {
+			nonEmpty = append(nonEmpty, strings.TrimSpace(statement))
+		}
+	}
+	return nonEmpty
+}
+
+// checkReadOnlySQL accepts a single SELECT, or WITH ... SELECT, statement
+func checkReadOnlySQL(query string) (string, error) {
+	statements := splitSQL(query)
+	if len(statements) == 0 {
+		return "", fmt.Errorf("no query given")
+	}
+	if len(statements) > 1 {
+		return "", fmt.Errorf("only one statement can be run at a time, got %d", len(statements))
+	}
+	fields := strings.Fields(statements[0])
+	keyword := strings.ToUpper(strings.TrimLeft(fields[0], "("))
+	if keyword != "SELECT" && keyword != "WITH" {
+		return "", fmt.Errorf("only SELECT queries can be run, not %s", fields[0])
+	}
+	return statements[0], nil
+}
+
+// sqlValue converts a scanned value into something readable in both outputs
+func sqlValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		if utf8.Valid(v) {
+			return string(v)
+		}
+		return fmt.Sprintf("<%d bytes>", len(v))
+	case time.Time:
+		return v.Local().Format(time.RFC3339)
+	}
+	return value
+}
+
+// QueryArchive runs a read-only query against an account's archive. The
+// database is opened read-only, so nothing a query does can change it.
+func QueryArchive(accountEmail, query string) (*SQLResult, error) {
+	statement, err := checkReadOnlySQL(query)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bring the archive up to date first, so the messages view exists
+	dm, err := NewDatabaseManager(accountEmail)
+	if err != nil {
+		return nil, err
+	}
+	dbPath := dm.dbPath
+	dm.Close()
+
+	db, err := sql.Open("sqlite3", "file:"+(&url.URL{Path: dbPath}).EscapedPath()+"?mode=ro&_query_only=1")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(statement)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %v", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %v", err)
+	}
+	result := &SQLResult{Columns: columns, Rows: [][]interface{}{}}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, fmt.Errorf("failed to read row: %v", err)
+		}
+		for i := range values {
+			values[i] = sqlValue(values[i])
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query failed: %v", err)
+	}
+	return result, nil
+}
+
+// FormatSQLResult lays the rows out as a table, with long values cut short
+func FormatSQLResult(result *SQLResult) string {
+	cells := make([][]string, len(result.Rows)+1)
+	cells[0] = result.Columns
+	for i, row := range result.Rows {
+		cells[i+1] = make([]string, len(row))
+		for j, value := range row {
+			text := "NULL"
+			if value != nil {
+				text = strings.Join(strings.Fields(fmt.Sprint(value)), " ")
+			}
+			cells[i+1][j] = truncateString(text, sqlCellWidth)
+		}
+	}
+
+	widths := make([]int, len(result.Columns))
+	for _, row := range cells {
+		for j, cell := range row {
+			widths[j] = max(widths[j], utf8.RuneCountInString(cell))
+		}
+	}
+
+	var b strings.Builder
+	writeRow := func(row []string) {
+		for j, cell := range row {
+			if j > 0 {
+				b.WriteString("  ")
+			}
+			if j == len(row)-1 {
+				b.WriteString(cell)
+			} else {
+				b.WriteString(cell + strings.Repeat(" ", widths[j]-utf8.RuneCountInString(cell)))
+			}
+		}
+		b.WriteString("\n")
+	}
+	writeRow(cells[0])
+	rule := make([]string, len(widths))
+	for j, width := range widths {
+		rule[j] = strings.Repeat("─", width)
+	}
+	writeRow(rule)
+	for _, row := range cells[1:] {
+		writeRow(row)
+	}
+	fmt.Fprintf(&b, "(%d row(s))\n", len(result.Rows))
+	return b.String()
+}
+
+// RunSQL runs a read-only query against an account's archive and prints the
+// result as a table or JSON
+func RunSQL(accountEmail, query string, asJSON bool) error {
+	if accountEmail == "" {
+		config, err := LoadConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %v", err)
+		}
+		accountEmail = config.Email
+	}
+
+	result, err := QueryArchive(accountEmail, query)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			return fmt.Errorf("failed to encode result: %v", err)
+		}
+		return nil
+	}
+	fmt.Print(FormatSQLResult(result))
+	return nil
+}
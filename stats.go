@@ -42,6 +42,9 @@ type StatsOptions struct {
 	Until        time.Time
 	TopN         int
 	IncludeBody  bool
+	Filter       ReadOptions // Narrows the emails counted, by sender, subject or unread
+	Folder       string      // Archived folder or saved search; empty for INBOX
+	Query        string      // Search query the emails have to match
 }
 
 func GenerateEmailStats(opts StatsOptions) (*EmailStats, error) {
@@ -49,24 +52,17 @@ func GenerateEmailStats(opts StatsOptions) (*EmailStats, error) {
 		opts.TopN = 10
 	}
 
-	emails, err := GetEmailsFromInbox(opts.AccountEmail, ReadOptions{
-		Since: opts.Since,
-		Limit: 0,
-	})
+	filter := opts.Filter
+	filter.Since, filter.Until, filter.Limit, filter.Offset = opts.Since, opts.Until, 0, 0
+	folder := opts.Folder
+	if folder == "" {
+		folder = "INBOX"
+	}
+	emails, err := SearchFolder(opts.AccountEmail, folder, opts.Query, filter)
 	if err != nil {
 		return nil, fmt.Errorf("STATS_INBOX_READ_ERROR: Failed to retrieve emails from inbox for account '%s' for statistics generation. This could be due to: (1) Account not found or not configured, (2) Local inbox database access issues, (3) Corrupted email data, (4) Permission problems. Original error: %v", opts.AccountEmail, err)
 	}
 
-	if !opts.Until.IsZero() {
-		var filteredEmails []*Email
-		for _, email := range emails {
-			if email.Date.Before(opts.Until) || email.Date.Equal(opts.Until) {
-				filteredEmails = append(filteredEmails, email)
-			}
-		}
-		emails = filteredEmails
-	}
-
 	stats := &EmailStats{
 		AccountEmail: opts.AccountEmail,
 		TotalEmails:  len(emails),
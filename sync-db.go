@@ -2,7 +2,6 @@ package mailos
 
 import (
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -30,7 +29,9 @@ func NewDatabaseManager(accountEmail string) (*DatabaseManager, error) {
 
 	dbPath := filepath.Join(accountDir, "archive.db")
 
-	db, err := sql.Open("sqlite3", dbPath)
+	// Transactions take the write lock up front, so concurrent writers wait
+	// their turn instead of failing part way through
+	db, err := sql.Open("sqlite3", dbPath+"?_txlock=immediate")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %v", err)
 	}
@@ -41,15 +42,18 @@ func NewDatabaseManager(accountEmail string) (*DatabaseManager, error) {
 		dbPath:      dbPath,
 	}
 
-	if err := dm.createTables(); err != nil {
+	if err := dm.migrate(); err != nil {
 		db.Close()
-		return nil, fmt.Errorf("failed to create tables: %v", err)
+		return nil, err
+	}
+	if _, err := dm.importLegacyInbox(); err != nil {
+		fmt.Printf("Warning: failed to import inbox.json into the archive: %v\n", err)
 	}
 
 	return dm, nil
 }
 
-func (dm *DatabaseManager) createTables() error {
+func createArchiveTables(db sqlExecer) error {
 	schema := `
 	CREATE TABLE IF NOT EXISTS emails (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -84,9 +88,108 @@ func (dm *DatabaseManager) createTables() error {
 	);
 
 	CREATE INDEX IF NOT EXISTS idx_sync_metadata_account ON sync_metadata(account_email);
+
+	CREATE TABLE IF NOT EXISTS attachments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		message_id TEXT NOT NULL,
+		filename TEXT NOT NULL,
+		mime_type TEXT NOT NULL DEFAULT '',
+		size INTEGER NOT NULL DEFAULT 0,
+		sha256 TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(message_id, filename)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_attachments_message_id ON attachments(message_id);
+	CREATE INDEX IF NOT EXISTS idx_attachments_sha256 ON attachments(sha256);
+	CREATE INDEX IF NOT EXISTS idx_attachments_filename ON attachments(filename);
+	CREATE INDEX IF NOT EXISTS idx_attachments_mime_type ON attachments(mime_type);
+
+	CREATE TABLE IF NOT EXISTS attachment_blobs (
+		sha256 TEXT PRIMARY KEY,
+		size INTEGER NOT NULL,
+		data BLOB NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS delivery_status (
+		message_id TEXT NOT NULL,
+		recipient TEXT NOT NULL,
+		state TEXT NOT NULL,
+		status_code TEXT,
+		diagnostic TEXT,
+		remote_mta TEXT,
+		subject TEXT,
+		sent_at DATETIME,
+		updated_at DATETIME NOT NULL,
+		report_message_id TEXT,
+		PRIMARY KEY (message_id, recipient)
+	);
+	CREATE INDEX IF NOT EXISTS idx_delivery_status_state ON delivery_status(state);
+
+	CREATE TABLE IF NOT EXISTS send_journal (
+		message_id TEXT PRIMARY KEY,
+		subject TEXT,
+		from_address TEXT,
+		recipients TEXT,
+		smtp_host TEXT,
+		queue_id TEXT,
+		smtp_response TEXT,
+		submitted_at DATETIME NOT NULL,
+		accepted_at DATETIME NOT NULL,
+		sent_folder TEXT,
+		verified_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_send_journal_accepted ON send_journal(accepted_at);
+
+	CREATE TABLE IF NOT EXISTS send_rate (
+		bucket TEXT PRIMARY KEY,
+		tokens REAL NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS ops_journal (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL,
+		folder TEXT NOT NULL,
+		target TEXT NOT NULL,
+		message_ids TEXT NOT NULL,
+		subjects TEXT NOT NULL,
+		raw BLOB,
+		queued_at DATETIME NOT NULL,
+		state TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS snoozed (
+		message_id TEXT PRIMARY KEY,
+		subject TEXT,
+		from_address TEXT,
+		until DATETIME NOT NULL,
+		snoozed_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS followups (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		message_id TEXT NOT NULL UNIQUE,
+		subject TEXT,
+		recipients TEXT,
+		sent_at DATETIME NOT NULL,
+		remind_at DATETIME NOT NULL,
+		replied_at DATETIME,
+		reply_from TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS batch_sends (
+		job_id TEXT NOT NULL,
+		recipient TEXT NOT NULL,
+		sent_at DATETIME NOT NULL,
+		PRIMARY KEY (job_id, recipient)
+	);
 	`
 
-	_, err := dm.db.Exec(schema)
+	_, err := db.Exec(schema)
 	return err
 }
 
@@ -94,144 +197,41 @@ func (dm *DatabaseManager) Close() error {
 	return dm.db.Close()
 }
 
+// SyncEmailsFromInbox imports an inbox.json left by an older version of
+// mailos, and reports what the archive holds. Sync writes to the archive
+// directly, so there's usually nothing to import.
 func (dm *DatabaseManager) SyncEmailsFromInbox() error {
-	inboxData, err := LoadGlobalInbox(dm.accountEmail)
+	imported, err := dm.importLegacyInbox()
 	if err != nil {
-		return fmt.Errorf("failed to load inbox data: %v", err)
-	}
-
-	tx, err := dm.db.Begin()
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %v", err)
-	}
-	defer tx.Rollback()
-
-	stmt, err := tx.Prepare(`
-		INSERT OR REPLACE INTO emails (
-			message_id, from_address, to_addresses, subject, date_sent,
-			body_text, body_html, attachments, attachment_data, in_reply_to
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to prepare statement: %v", err)
-	}
-	defer stmt.Close()
-
-	syncedCount := 0
-	for _, email := range inboxData.Emails {
-		toAddresses, _ := json.Marshal(email.To)
-		attachments, _ := json.Marshal(email.Attachments)
-		attachmentData, _ := json.Marshal(email.AttachmentData)
-
-		_, err := stmt.Exec(
-			email.MessageID,
-			email.From,
-			string(toAddresses),
-			email.Subject,
-			email.Date,
-			email.Body,
-			email.BodyHTML,
-			string(attachments),
-			attachmentData,
-			email.InReplyTo,
-		)
-		if err != nil {
-			fmt.Printf("Warning: failed to insert email %s: %v\n", email.MessageID, err)
-			continue
-		}
-		syncedCount++
+		return err
 	}
 
-	if err := dm.updateSyncMetadata(tx, inboxData); err != nil {
-		return fmt.Errorf("failed to update sync metadata: %v", err)
+	var total int
+	if err := dm.db.QueryRow("SELECT COUNT(*) FROM emails").Scan(&total); err != nil {
+		return fmt.Errorf("failed to count emails: %v", err)
 	}
-
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %v", err)
+	if imported == 0 {
+		fmt.Printf("✓ Nothing to import; 'mailos sync' writes to the database directly\n")
 	}
-
-	fmt.Printf("✓ Synced %d emails to database for %s\n", syncedCount, dm.accountEmail)
+	fmt.Printf("✓ %d emails in the database for %s\n", total, dm.accountEmail)
 	fmt.Printf("✓ Database location: %s\n", dm.dbPath)
 
 	return nil
 }
 
-func (dm *DatabaseManager) updateSyncMetadata(tx *sql.Tx, inboxData *InboxData) error {
+func (dm *DatabaseManager) updateSyncMetadata(tx *sql.Tx) error {
 	_, err := tx.Exec(`
-		INSERT OR REPLACE INTO sync_metadata (
+		INSERT INTO sync_metadata (
 			account_email, last_sync_time, total_emails, last_email_date, sync_version
-		) VALUES (?, ?, ?, ?, ?)
-	`, dm.accountEmail, time.Now(), len(inboxData.Emails), inboxData.LastEmailDate, inboxData.LastSyncVersion)
-	
+		) SELECT ?, ?, COUNT(*), MAX(date_sent), ? FROM emails
+	`, dm.accountEmail, archiveTime(time.Now()), ArchiveSchemaVersion)
+
 	return err
 }
 
+// GetEmailsFromDB lists archived emails in every folder, newest first
 func (dm *DatabaseManager) GetEmailsFromDB(opts ReadOptions) ([]*Email, error) {
-	query := `
-		SELECT message_id, from_address, to_addresses, subject, date_sent,
-			   body_text, body_html, attachments, attachment_data, in_reply_to
-		FROM emails
-		WHERE 1=1
-	`
-	args := []interface{}{}
-
-	if opts.FromAddress != "" {
-		query += " AND from_address LIKE ?"
-		args = append(args, "%"+opts.FromAddress+"%")
-	}
-
-	if opts.Subject != "" {
-		query += " AND subject LIKE ?"
-		args = append(args, "%"+opts.Subject+"%")
-	}
-
-	if !opts.Since.IsZero() {
-		query += " AND date_sent >= ?"
-		args = append(args, opts.Since)
-	}
-
-	query += " ORDER BY date_sent DESC"
-
-	if opts.Limit > 0 {
-		query += " LIMIT ?"
-		args = append(args, opts.Limit)
-	}
-
-	rows, err := dm.db.Query(query, args...)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query emails: %v", err)
-	}
-	defer rows.Close()
-
-	var emails []*Email
-	for rows.Next() {
-		var email Email
-		var toAddressesJSON, attachmentsJSON, attachmentDataJSON string
-
-		err := rows.Scan(
-			&email.MessageID,
-			&email.From,
-			&toAddressesJSON,
-			&email.Subject,
-			&email.Date,
-			&email.Body,
-			&email.BodyHTML,
-			&attachmentsJSON,
-			&attachmentDataJSON,
-			&email.InReplyTo,
-		)
-		if err != nil {
-			continue
-		}
-
-		json.Unmarshal([]byte(toAddressesJSON), &email.To)
-		json.Unmarshal([]byte(attachmentsJSON), &email.Attachments)
-		json.Unmarshal([]byte(attachmentDataJSON), &email.AttachmentData)
-
-		emails = append(emails, &email)
-	}
-
-	return emails, nil
+	return dm.queryEmails("", opts)
 }
 
 func (dm *DatabaseManager) GetDatabaseStats() (map[string]interface{}, error) {
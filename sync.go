@@ -1,6 +1,7 @@
 package mailos
 
 import (
+	"bytes"
 	"crypto/tls"
 	"fmt"
 	"io"
@@ -273,7 +274,8 @@ func parseMessageForSync(msg *imap.Message, section *imap.BodySectionName) (*Ema
 	}
 
 	email := &Email{
-		ID: msg.SeqNum,
+		ID:    msg.SeqNum,
+		Flags: msg.Flags,
 	}
 
 	// Parse envelope
@@ -306,12 +308,15 @@ func parseMessageForSync(msg *imap.Message, section *imap.BodySectionName) (*Ema
 	// Parse body
 	r := msg.GetBody(section)
 	if r != nil {
-		m, err := mail.CreateReader(r)
+		raw, _ := io.ReadAll(r)
+		m, err := mail.CreateReader(bytes.NewReader(raw))
 		if err != nil {
 			// Try to read as plain text
-			body, _ := io.ReadAll(r)
-			email.Body = string(body)
+			email.Body = string(raw)
 		} else {
+			email.Headers = headerValues(m.Header)
+			email.Auth = AnalyzeMessageAuth(raw, defaultDKIMKeys())
+
 			// Process parts
 			for {
 				p, err := m.NextPart()
@@ -343,9 +348,10 @@ func parseMessageForSync(msg *imap.Message, section *imap.BodySectionName) (*Ema
 		}
 	}
 
-	// If we only have HTML body, use that as the main body
+	// If we only have HTML body, render it as the main body
 	if email.Body == "" && email.BodyHTML != "" {
-		email.Body = email.BodyHTML
+		email.Body = HTMLToText(email.BodyHTML, HTMLTextOptions{})
+		email.BodyFromHTML = true
 	}
 
 	return email, nil
@@ -372,6 +378,9 @@ func saveEmailToFile(email *Email, outputDir string) error {
 	if len(email.Attachments) > 0 {
 		content.WriteString("**Attachments:** " + strings.Join(email.Attachments, ", ") + "\n")
 	}
+	if email.Auth != nil && email.Auth.Suspicious {
+		content.WriteString("**Warning:** " + strings.Join(email.Auth.Warnings, "; ") + "\n")
+	}
 	
 	content.WriteString("\n---\n\n")
 	content.WriteString(email.Body)
@@ -2,8 +2,8 @@ package mailos
 
 import (
 	"bufio"
-	"encoding/base64"
 	"fmt"
+	"html"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -486,37 +486,19 @@ func ApplyTemplateWithProfileAndName(body string, bodyHTML string, profileImageP
 	return result
 }
 
-// getProfileImageTag creates an HTML img tag with base64 encoded image
+// getProfileImageTag creates an HTML img tag pointing at the local profile image.
+// sendWithAccount turns it into an inline cid: part when the email is sent.
 func getProfileImageTag(imagePath string) string {
-	// Read the image file
-	imageData, err := os.ReadFile(imagePath)
+	absPath, err := filepath.Abs(imagePath)
 	if err != nil {
 		return ""
 	}
-	
-	// Detect image type from file extension
-	ext := strings.ToLower(filepath.Ext(imagePath))
-	var mimeType string
-	switch ext {
-	case ".jpg", ".jpeg":
-		mimeType = "image/jpeg"
-	case ".png":
-		mimeType = "image/png"
-	case ".gif":
-		mimeType = "image/gif"
-	case ".webp":
-		mimeType = "image/webp"
-	default:
-		// Default to jpeg if unknown
-		mimeType = "image/jpeg"
+	if _, err := os.Stat(absPath); err != nil {
+		return ""
 	}
 	
-	// Encode to base64
-	encoded := base64.StdEncoding.EncodeToString(imageData)
-	
-	// Create img tag with embedded base64 data
 	// Using a reasonable max width for email display
-	return fmt.Sprintf(`<img src="data:%s;base64,%s" alt="Profile" style="max-width: 150px; height: auto; border-radius: 50%%;">`, mimeType, encoded)
+	return fmt.Sprintf(`<img src="%s" alt="Profile" style="max-width: 150px; height: auto; border-radius: 50%%;">`, html.EscapeString(absPath))
 }
 
 // TemplateExists checks if the default template file exists
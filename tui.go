@@ -0,0 +1,713 @@
+package mailos
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// tuiPane identifies which of the three panes has keyboard focus
+type tuiPane int
+
+const (
+	foldersPane tuiPane = iota
+	messagesPane
+	previewPane
+)
+
+// tuiInputMode is what the footer input line is currently collecting
+type tuiInputMode int
+
+const (
+	tuiNoInput tuiInputMode = iota
+	tuiSearchInput
+	tuiForwardInput
+)
+
+// defaultTUIFolders is shown when the server folder list can't be fetched
+var defaultTUIFolders = []string{"INBOX", "Sent", "Drafts", "Archive", "Trash"}
+
+// tuiBackend is everything the TUI needs from the mail layer, so the model can be
+// driven in tests without a terminal or an IMAP server
+type tuiBackend interface {
+	Accounts() []string
+	SwitchAccount(accountEmail string) error
+	Folders() ([]string, error)
+	Load(folder string, limit int) ([]*Email, error)
+	MarkRead(folder string, uids []uint32) error
+	Delete(folder string, uids []uint32) error
+	Archive(folder string, uids []uint32) error
+}
+
+// mailTUIBackend implements tuiBackend on top of the regular IMAP helpers
+type mailTUIBackend struct {
+	config *Config
+}
+
+func (b *mailTUIBackend) Accounts() []string {
+	var emails []string
+	for _, acc := range GetAllAccounts(b.config) {
+		emails = append(emails, acc.Email)
+	}
+	return emails
+}
+
+func (b *mailTUIBackend) SwitchAccount(accountEmail string) error {
+	if err := SwitchAccount(b.config, accountEmail); err != nil {
+		return err
+	}
+	SetSessionAccount(accountEmail)
+	return nil
+}
+
+// Folders lists the server's folders followed by the saved searches
+func (b *mailTUIBackend) Folders() ([]string, error) {
+	folders, err := ListFolders()
+	if err != nil {
+		return nil, err
+	}
+	if config, err := LoadSavedSearches(); err == nil {
+		for _, search := range config.Searches {
+			folders = append(folders, search.Name)
+		}
+	}
+	return folders, nil
+}
+
+func (b *mailTUIBackend) Load(folder string, limit int) ([]*Email, error) {
+	return ReadFolder(ReadOptions{Limit: limit}, folder)
+}
+
+func (b *mailTUIBackend) MarkRead(folder string, uids []uint32) error {
+	return markAsRead(uids, true, folder)
+}
+
+func (b *mailTUIBackend) Delete(folder string, uids []uint32) error {
+	return deleteEmailsByUID(uids, folder)
+}
+
+func (b *mailTUIBackend) Archive(folder string, uids []uint32) error {
+	return moveToArchive(uids, true, folder)
+}
+
+// tuiFoldersMsg carries the result of listing folders
+type tuiFoldersMsg struct {
+	folders []string
+	err     error
+}
+
+// tuiEmailsMsg carries the result of loading a folder
+type tuiEmailsMsg struct {
+	account string
+	folder  string
+	emails  []*Email
+	err     error
+}
+
+// tuiActionMsg reports the outcome of a mark-read, delete or archive. Actions
+// name messages by UID, which unlike the message number doesn't shift when
+// an earlier message is removed.
+type tuiActionMsg struct {
+	action string
+	uid    uint32
+	err    error
+}
+
+// tuiPendingAction is work that needs the real terminal (composing a reply or
+// forward), run by RunTUI between program runs
+type tuiPendingAction struct {
+	kind  string // "reply" or "forward"
+	email *Email
+	to    []string
+}
+
+// tuiModel is the Bubble Tea model for the three-pane mail client
+type tuiModel struct {
+	backend tuiBackend
+	limit   int
+
+	accounts   []string
+	accountIdx int
+
+	folders   []string
+	folderIdx int
+	folder    string
+
+	emails   []*Email
+	filtered []*Email
+	cursor   int
+	scroll   int
+
+	focus     tuiPane
+	inputMode tuiInputMode
+	input     string
+	search    string
+
+	loading bool
+	status  string
+	err     error
+
+	pending *tuiPendingAction
+	quit    bool
+
+	width  int
+	height int
+}
+
+// newTUIModel creates the TUI model for the given backend and account
+func newTUIModel(backend tuiBackend, account string, limit int) tuiModel {
+	m := tuiModel{
+		backend: backend,
+		limit:   limit,
+		folders: defaultTUIFolders,
+		folder:  "INBOX",
+		focus:   messagesPane,
+		width:   120,
+		height:  30,
+	}
+
+	m.accounts = backend.Accounts()
+	for i, acc := range m.accounts {
+		if acc == account {
+			m.accountIdx = i
+		}
+	}
+
+	return m
+}
+
+func (m tuiModel) Init() tea.Cmd {
+	return tea.Batch(m.loadFolders(), m.loadEmails())
+}
+
+// currentAccount returns the account the TUI is showing
+func (m tuiModel) currentAccount() string {
+	if m.accountIdx < len(m.accounts) {
+		return m.accounts[m.accountIdx]
+	}
+	return ""
+}
+
+// selected returns the highlighted message, or nil if the list is empty
+func (m tuiModel) selected() *Email {
+	if m.cursor >= 0 && m.cursor < len(m.filtered) {
+		return m.filtered[m.cursor]
+	}
+	return nil
+}
+
+func (m tuiModel) loadFolders() tea.Cmd {
+	backend := m.backend
+	return func() tea.Msg {
+		folders, err := backend.Folders()
+		return tuiFoldersMsg{folders: folders, err: err}
+	}
+}
+
+func (m tuiModel) loadEmails() tea.Cmd {
+	backend, folder, limit, account := m.backend, m.folder, m.limit, m.currentAccount()
+	return func() tea.Msg {
+		emails, err := backend.Load(folder, limit)
+		return tuiEmailsMsg{account: account, folder: folder, emails: emails, err: err}
+	}
+}
+
+// runAction acts on the server folder a message is in, which for a saved
+// search can be any folder the archive holds
+func (m tuiModel) runAction(action string, email *Email) tea.Cmd {
+	backend, folder, uid := m.backend, email.Folder, email.UID
+	if folder == "" {
+		folder = m.folder
+	}
+	return func() tea.Msg {
+		if uid == 0 {
+			return tuiActionMsg{action: action, err: fmt.Errorf("message has no UID; refresh with g")}
+		}
+		var err error
+		switch action {
+		case "delete":
+			err = backend.Delete(folder, []uint32{uid})
+		case "archive":
+			err = backend.Archive(folder, []uint32{uid})
+		case "mark-read":
+			err = backend.MarkRead(folder, []uint32{uid})
+		}
+		return tuiActionMsg{action: action, uid: uid, err: err}
+	}
+}
+
+// applyFilter rebuilds the visible list from the loaded emails and the search text
+func (m *tuiModel) applyFilter() {
+	m.filtered = nil
+	// A half-typed query doesn't parse yet; match its words until it does
+	q, err := ParseQuery(m.search)
+	if err != nil {
+		q = nil
+	}
+	for _, email := range m.emails {
+		if m.search == "" || tuiMatches(email, q, m.search) {
+			m.filtered = append(m.filtered, email)
+		}
+	}
+	if m.cursor >= len(m.filtered) {
+		m.cursor = len(m.filtered) - 1
+	}
+	if m.cursor < 0 {
+		m.cursor = 0
+	}
+	m.scroll = 0
+}
+
+// tuiMatches reports whether an email matches the parsed search query, or
+// without one, whether every search word appears in the sender, subject or body
+func tuiMatches(email *Email, q *Query, search string) bool {
+	if q != nil {
+		return q.Match(email)
+	}
+	haystack := email.From + " " + email.Subject + " " + email.Body
+	for _, word := range strings.Fields(search) {
+		if !containsIgnoreCase(haystack, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// removeEmail drops a message from the loaded list after it was moved or deleted
+func (m *tuiModel) removeEmail(uid uint32) {
+	var kept []*Email
+	for _, email := range m.emails {
+		if email.UID != uid {
+			kept = append(kept, email)
+		}
+	}
+	m.emails = kept
+	m.applyFilter()
+}
+
+func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+
+	case tuiFoldersMsg:
+		if msg.err == nil && len(msg.folders) > 0 {
+			m.folders = msg.folders
+			for i, f := range m.folders {
+				if f == m.folder {
+					m.folderIdx = i
+				}
+			}
+		}
+
+	case tuiEmailsMsg:
+		// Ignore results for a folder or account we've already left
+		if msg.folder != m.folder || msg.account != m.currentAccount() {
+			return m, nil
+		}
+		m.loading = false
+		m.err = msg.err
+		if msg.err == nil {
+			m.emails = msg.emails
+			m.status = fmt.Sprintf("%d messages in %s", len(msg.emails), msg.folder)
+		}
+		m.applyFilter()
+
+	case tuiActionMsg:
+		if msg.err != nil {
+			m.err = fmt.Errorf("%s failed: %v", msg.action, msg.err)
+			return m, nil
+		}
+		m.err = nil
+		switch msg.action {
+		case "delete":
+			m.removeEmail(msg.uid)
+			m.status = "✓ Deleted"
+		case "archive":
+			m.removeEmail(msg.uid)
+			m.status = "✓ Archived"
+		case "mark-read":
+			m.status = "✓ Marked as read"
+		}
+
+	case tea.KeyMsg:
+		if m.inputMode != tuiNoInput {
+			return m.updateInput(msg)
+		}
+		return m.updateKeys(msg)
+	}
+
+	return m, nil
+}
+
+// updateInput handles keys while the search or forward-to line is active
+func (m tuiModel) updateInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		m.quit = true
+		return m, tea.Quit
+
+	case tea.KeyEscape:
+		if m.inputMode == tuiSearchInput {
+			m.search = ""
+			m.applyFilter()
+		}
+		m.inputMode = tuiNoInput
+		m.input = ""
+
+	case tea.KeyEnter:
+		mode := m.inputMode
+		m.inputMode = tuiNoInput
+		if mode == tuiForwardInput {
+			to := parseEmailList(m.input)
+			m.input = ""
+			if len(to) == 0 {
+				m.status = "Forward cancelled: no recipients"
+				return m, nil
+			}
+			m.pending = &tuiPendingAction{kind: "forward", email: m.selected(), to: to}
+			return m, tea.Quit
+		}
+		m.input = ""
+
+	case tea.KeyBackspace:
+		if len(m.input) > 0 {
+			runes := []rune(m.input)
+			m.input = string(runes[:len(runes)-1])
+		}
+		if m.inputMode == tuiSearchInput {
+			m.search = m.input
+			m.applyFilter()
+		}
+
+	case tea.KeyRunes, tea.KeySpace:
+		// Bubble Tea gives a space its rune too
+		m.input += string(msg.Runes)
+		// Search filters live as you type
+		if m.inputMode == tuiSearchInput {
+			m.search = m.input
+			m.applyFilter()
+		}
+	}
+
+	return m, nil
+}
+
+// updateKeys handles navigation and action keys
+func (m tuiModel) updateKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c", "q":
+		m.quit = true
+		return m, tea.Quit
+
+	case "tab", "right", "l":
+		if m.focus < previewPane {
+			m.focus++
+		}
+
+	case "shift+tab", "left", "h":
+		if m.focus > foldersPane {
+			m.focus--
+		}
+
+	case "up", "k":
+		m.moveCursor(-1)
+
+	case "down", "j":
+		m.moveCursor(1)
+
+	case "enter":
+		switch m.focus {
+		case foldersPane:
+			if m.folderIdx < len(m.folders) {
+				m.folder = m.folders[m.folderIdx]
+				m.emails = nil
+				m.applyFilter()
+				m.cursor = 0
+				m.loading = true
+				m.focus = messagesPane
+				return m, m.loadEmails()
+			}
+		case messagesPane:
+			if m.selected() != nil {
+				m.focus = previewPane
+				m.scroll = 0
+			}
+		}
+
+	case "/":
+		m.inputMode = tuiSearchInput
+		m.input = m.search
+
+	case "esc":
+		if m.search != "" {
+			m.search = ""
+			m.applyFilter()
+		}
+
+	case "g":
+		m.loading = true
+		return m, m.loadEmails()
+
+	case "A":
+		if len(m.accounts) < 2 {
+			m.status = "No other accounts configured"
+			return m, nil
+		}
+		next := (m.accountIdx + 1) % len(m.accounts)
+		if err := m.backend.SwitchAccount(m.accounts[next]); err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.accountIdx = next
+		m.folder = "INBOX"
+		m.folderIdx = 0
+		m.emails = nil
+		m.search = ""
+		m.applyFilter()
+		m.loading = true
+		m.status = "Switched to " + m.currentAccount()
+		return m, tea.Batch(m.loadFolders(), m.loadEmails())
+
+	case "r":
+		if email := m.selected(); email != nil {
+			m.pending = &tuiPendingAction{kind: "reply", email: email}
+			return m, tea.Quit
+		}
+
+	case "f":
+		if m.selected() != nil {
+			m.inputMode = tuiForwardInput
+			m.input = ""
+		}
+
+	case "d":
+		if email := m.selected(); email != nil {
+			return m, m.runAction("delete", email)
+		}
+
+	case "a":
+		if email := m.selected(); email != nil {
+			return m, m.runAction("archive", email)
+		}
+
+	case "m":
+		if email := m.selected(); email != nil {
+			return m, m.runAction("mark-read", email)
+		}
+	}
+
+	return m, nil
+}
+
+// moveCursor moves the selection in whichever pane has focus
+func (m *tuiModel) moveCursor(delta int) {
+	switch m.focus {
+	case foldersPane:
+		m.folderIdx = clampIndex(m.folderIdx+delta, len(m.folders))
+	case messagesPane:
+		m.cursor = clampIndex(m.cursor+delta, len(m.filtered))
+		m.scroll = 0
+	case previewPane:
+		if m.scroll+delta >= 0 {
+			m.scroll += delta
+		}
+	}
+}
+
+// clampIndex keeps i within [0, n)
+func clampIndex(i, n int) int {
+	if i >= n {
+		i = n - 1
+	}
+	if i < 0 {
+		i = 0
+	}
+	return i
+}
+
+func (m tuiModel) View() string {
+	if m.quit || m.pending != nil {
+		return ""
+	}
+
+	accent := lipgloss.Color("170")
+	dim := lipgloss.Color("241")
+
+	bodyHeight := m.height - 4
+	if bodyHeight < 5 {
+		bodyHeight = 5
+	}
+	folderWidth := m.width / 6
+	listWidth := m.width * 2 / 5
+	previewWidth := m.width - folderWidth - listWidth - 6
+
+	pane := func(p tuiPane, width int, content string) string {
+		border := lipgloss.Color("62")
+		if m.focus == p {
+			border = accent
+		}
+		return lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(border).
+			Width(width).
+			Height(bodyHeight).
+			MaxHeight(bodyHeight + 2).
+			Render(content)
+	}
+
+	// Folders
+	var folders strings.Builder
+	for i, f := range m.folders {
+		line := truncateString(f, folderWidth-2)
+		if f == m.folder {
+			line = lipgloss.NewStyle().Bold(true).Render(line)
+		}
+		if i == m.folderIdx && m.focus == foldersPane {
+			line = lipgloss.NewStyle().Foreground(accent).Render("▸ " + line)
+		} else {
+			line = "  " + line
+		}
+		folders.WriteString(line + "\n")
+	}
+
+	// Message list, scrolled so the cursor stays visible
+	var list strings.Builder
+	if m.loading {
+		list.WriteString("Loading...")
+	} else if len(m.filtered) == 0 {
+		list.WriteString(lipgloss.NewStyle().Foreground(dim).Render("No messages"))
+	}
+	start := 0
+	if m.cursor >= bodyHeight/2 {
+		start = m.cursor - bodyHeight/2 + 1
+	}
+	for i := start; i < len(m.filtered) && i < start+bodyHeight/2; i++ {
+		email := m.filtered[i]
+		from := truncateString(email.From, listWidth-4)
+		subject := truncateString(email.Subject, listWidth-4)
+		if i == m.cursor {
+			style := lipgloss.NewStyle().Foreground(accent).Bold(true)
+			list.WriteString(style.Render("▸ "+from) + "\n")
+			list.WriteString(style.Render("  "+subject) + "\n")
+		} else {
+			list.WriteString("  " + from + "\n")
+			list.WriteString(lipgloss.NewStyle().Foreground(dim).Render("  "+subject) + "\n")
+		}
+	}
+
+	// Preview
+	var preview strings.Builder
+	if email := m.selected(); email != nil {
+		preview.WriteString(lipgloss.NewStyle().Bold(true).Render(email.Subject) + "\n")
+		preview.WriteString(fmt.Sprintf("From: %s\n", email.From))
+		preview.WriteString(fmt.Sprintf("To: %s\n", strings.Join(email.To, ", ")))
+		preview.WriteString(fmt.Sprintf("Date: %s\n", email.Date.Format("Jan 2, 2006 at 3:04 PM")))
+		if len(email.Attachments) > 0 {
+			preview.WriteString(fmt.Sprintf("Attachments: %s\n", strings.Join(email.Attachments, ", ")))
+		}
+		preview.WriteString("\n")
+		lines := strings.Split(email.Body, "\n")
+		if m.scroll < len(lines) {
+			lines = lines[m.scroll:]
+		} else {
+			lines = nil
+		}
+		preview.WriteString(strings.Join(lines, "\n"))
+	}
+
+	panes := lipgloss.JoinHorizontal(lipgloss.Top,
+		pane(foldersPane, folderWidth, folders.String()),
+		pane(messagesPane, listWidth, list.String()),
+		pane(previewPane, previewWidth, preview.String()),
+	)
+
+	// Header and footer
+	header := lipgloss.NewStyle().Bold(true).Foreground(accent).
+		Render(fmt.Sprintf("📬 %s — %s", m.currentAccount(), m.folder))
+
+	var footer string
+	switch m.inputMode {
+	case tuiSearchInput:
+		footer = "Search: " + m.input + "█"
+	case tuiForwardInput:
+		footer = "Forward to: " + m.input + "█"
+	default:
+		if m.err != nil {
+			footer = lipgloss.NewStyle().Foreground(lipgloss.Color("196")).Render("Error: " + m.err.Error())
+		} else {
+			footer = m.status
+			if m.search != "" {
+				footer = fmt.Sprintf("Filter: %q (%d matches) • %s", m.search, len(m.filtered), footer)
+			}
+		}
+		footer += "\n" + lipgloss.NewStyle().Foreground(dim).Render(
+			"↑↓ Move • Tab Pane • Enter Open • / Search • r Reply • f Forward • d Delete • a Archive • m Read • A Account • g Refresh • q Quit")
+	}
+
+	return header + "\n" + panes + "\n" + footer
+}
+
+// truncateString shortens s to at most width runes, marking the cut with …
+func truncateString(s string, width int) string {
+	runes := []rune(s)
+	if width <= 1 || len(runes) <= width {
+		return s
+	}
+	return string(runes[:width-1]) + "…"
+}
+
+// RunTUI starts the full-screen mail client. Replies and forwards leave the
+// alternate screen so they can use the normal interactive composer, then the
+// client resumes where it left off.
+func RunTUI(accountEmail string, limit int) error {
+	config, err := EnsureAuthenticated(accountEmail)
+	if err != nil {
+		return err
+	}
+	if accountEmail != "" {
+		SetSessionAccount(accountEmail)
+	}
+
+	account := config.ActiveAccount
+	if account == "" {
+		account = config.Email
+	}
+
+	model := newTUIModel(&mailTUIBackend{config: config}, account, limit)
+	model.loading = true
+	for {
+		p := tea.NewProgram(model, tea.WithAltScreen())
+		finalModel, err := p.Run()
+		if err != nil {
+			return err
+		}
+
+		m := finalModel.(tuiModel)
+		if m.pending == nil {
+			return nil
+		}
+
+		action := m.pending
+		switch action.kind {
+		case "reply":
+			err = ReplyCommand(ReplyOptions{Email: action.email, Interactive: true})
+		case "forward":
+			err = ForwardCommand(ForwardOptions{Email: action.email, To: action.to, Interactive: true})
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+		fmt.Print("\nPress Enter to return to the mail client...")
+		bufio.NewReader(os.Stdin).ReadString('\n')
+
+		m.pending = nil
+		m.status = ""
+		model = m
+	}
+}
@@ -0,0 +1,309 @@
+package mailos
+
+import (
+	"fmt"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// fakeTUIBackend records calls and serves canned emails per account and folder
+type fakeTUIBackend struct {
+	accounts []string
+	active   string
+	mail     map[string][]*Email // keyed by "account/folder"
+	calls    []string
+	failNext error
+}
+
+func (f *fakeTUIBackend) Accounts() []string { return f.accounts }
+
+func (f *fakeTUIBackend) SwitchAccount(accountEmail string) error {
+	f.calls = append(f.calls, "switch "+accountEmail)
+	f.active = accountEmail
+	return nil
+}
+
+func (f *fakeTUIBackend) Folders() ([]string, error) {
+	return []string{"INBOX", "Sent", "Work", "Starred"}, nil
+}
+
+func (f *fakeTUIBackend) Load(folder string, limit int) ([]*Email, error) {
+	f.calls = append(f.calls, "load "+folder)
+	return f.mail[f.active+"/"+folder], nil
+}
+
+func (f *fakeTUIBackend) record(action, folder string, uids []uint32) error {
+	f.calls = append(f.calls, fmt.Sprintf("%s %s %v", action, folder, uids))
+	err := f.failNext
+	f.failNext = nil
+	return err
+}
+
+func (f *fakeTUIBackend) MarkRead(folder string, uids []uint32) error {
+	return f.record("read", folder, uids)
+}
+
+func (f *fakeTUIBackend) Delete(folder string, uids []uint32) error {
+	return f.record("delete", folder, uids)
+}
+
+func (f *fakeTUIBackend) Archive(folder string, uids []uint32) error {
+	return f.record("archive", folder, uids)
+}
+
+func newFakeTUIBackend() *fakeTUIBackend {
+	return &fakeTUIBackend{
+		accounts: []string{"me@example.com", "work@example.com"},
+		active:   "me@example.com",
+		mail: map[string][]*Email{
+			"me@example.com/INBOX": {
+				{ID: 1, UID: 101, From: "alice@example.com", Subject: "Lunch on Friday", Body: "Shall we?"},
+				{ID: 2, UID: 102, From: "billing@vendor.com", Subject: "Your invoice", Body: "Invoice #42 attached"},
+				{ID: 3, UID: 103, From: "bob@example.com", Subject: "Re: project", Body: "Looks good"},
+			},
+			"me@example.com/Work": {
+				{ID: 7, UID: 207, From: "boss@example.com", Subject: "Q3 plan"},
+			},
+			// A saved search, listing archived messages from any folder
+			"me@example.com/Starred": {
+				{ID: 1, UID: 405, Folder: "Sent", From: "me@example.com", Subject: "Offer"},
+				{ID: 1, UID: 101, Folder: "INBOX", From: "alice@example.com", Subject: "Lunch on Friday"},
+			},
+			"work@example.com/INBOX": {
+				{ID: 9, UID: 309, From: "hr@corp.com", Subject: "Welcome"},
+			},
+		},
+	}
+}
+
+// runCmd executes a command synchronously, feeding batched messages back into the model
+func runCmd(t *testing.T, m tuiModel, cmd tea.Cmd) tuiModel {
+	t.Helper()
+	if cmd == nil {
+		return m
+	}
+	msg := cmd()
+	if batch, ok := msg.(tea.BatchMsg); ok {
+		for _, c := range batch {
+			m = runCmd(t, m, c)
+		}
+		return m
+	}
+	if _, ok := msg.(tea.QuitMsg); ok {
+		return m
+	}
+	next, nextCmd := m.Update(msg)
+	return runCmd(t, next.(tuiModel), nextCmd)
+}
+
+// press sends a key to the model and runs whatever command it returns
+func press(t *testing.T, m tuiModel, keys ...string) tuiModel {
+	t.Helper()
+	for _, key := range keys {
+		var msg tea.KeyMsg
+		switch key {
+		case "enter":
+			msg = tea.KeyMsg{Type: tea.KeyEnter}
+		case "esc":
+			msg = tea.KeyMsg{Type: tea.KeyEscape}
+		case "tab":
+			msg = tea.KeyMsg{Type: tea.KeyTab}
+		case "down":
+			msg = tea.KeyMsg{Type: tea.KeyDown}
+		case "up":
+			msg = tea.KeyMsg{Type: tea.KeyUp}
+		case "backspace":
+			msg = tea.KeyMsg{Type: tea.KeyBackspace}
+		case " ":
+			msg = tea.KeyMsg{Type: tea.KeySpace, Runes: []rune{' '}}
+		default:
+			msg = tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)}
+		}
+		next, cmd := m.Update(msg)
+		m = runCmd(t, next.(tuiModel), cmd)
+	}
+	return m
+}
+
+func startTUI(t *testing.T, backend *fakeTUIBackend) tuiModel {
+	t.Helper()
+	m := newTUIModel(backend, backend.active, 50)
+	return runCmd(t, m, m.Init())
+}
+
+func TestTUIModel(t *testing.T) {
+	t.Run("InitialLoad", func(t *testing.T) {
+		m := startTUI(t, newFakeTUIBackend())
+		if len(m.filtered) != 3 {
+			t.Fatalf("Expected 3 messages, got %d", len(m.filtered))
+		}
+		if len(m.folders) != 4 || m.folders[2] != "Work" {
+			t.Errorf("Expected server folders to replace defaults, got %v", m.folders)
+		}
+		if m.focus != messagesPane {
+			t.Errorf("Expected message list to have focus")
+		}
+	})
+
+	t.Run("Navigation", func(t *testing.T) {
+		m := startTUI(t, newFakeTUIBackend())
+		m = press(t, m, "j", "j", "j")
+		if m.cursor != 2 {
+			t.Errorf("Expected cursor clamped at 2, got %d", m.cursor)
+		}
+		m = press(t, m, "k")
+		if m.selected().ID != 2 {
+			t.Errorf("Expected message 2 selected, got %d", m.selected().ID)
+		}
+		m = press(t, m, "enter")
+		if m.focus != previewPane {
+			t.Errorf("Expected enter to focus the preview")
+		}
+	})
+
+	t.Run("LiveSearch", func(t *testing.T) {
+		m := startTUI(t, newFakeTUIBackend())
+		m = press(t, m, "/", "i", "n", "v")
+		if len(m.filtered) != 1 || m.filtered[0].ID != 2 {
+			t.Fatalf("Expected only the invoice while typing, got %d results", len(m.filtered))
+		}
+		m = press(t, m, "backspace", "backspace", "backspace", "b", "o", "b")
+		if len(m.filtered) != 1 || m.filtered[0].ID != 3 {
+			t.Fatalf("Expected only bob's message, got %d results", len(m.filtered))
+		}
+		m = press(t, m, " ", "l")
+		if m.input != "bob l" {
+			t.Errorf("Expected one space typed, got %q", m.input)
+		}
+		m = press(t, m, "backspace", "backspace")
+		m = press(t, m, "enter")
+		if m.inputMode != tuiNoInput || m.search != "bob" {
+			t.Errorf("Expected search to stay applied after enter, got %q", m.search)
+		}
+		m = press(t, m, "esc")
+		if len(m.filtered) != 3 {
+			t.Errorf("Expected esc to clear the filter, got %d results", len(m.filtered))
+		}
+	})
+
+	t.Run("SwitchFolder", func(t *testing.T) {
+		backend := newFakeTUIBackend()
+		m := startTUI(t, backend)
+		m = press(t, m, "h")
+		if m.focus != foldersPane {
+			t.Fatalf("Expected folders pane to have focus")
+		}
+		m = press(t, m, "down", "down", "enter")
+		if m.folder != "Work" {
+			t.Fatalf("Expected Work folder, got %s", m.folder)
+		}
+		if len(m.filtered) != 1 || m.filtered[0].Subject != "Q3 plan" {
+			t.Errorf("Expected Work folder contents, got %d messages", len(m.filtered))
+		}
+	})
+
+	t.Run("DeleteArchiveMarkRead", func(t *testing.T) {
+		backend := newFakeTUIBackend()
+		m := startTUI(t, backend)
+		m = press(t, m, "m")
+		m = press(t, m, "d")
+		if len(m.filtered) != 2 || m.filtered[0].ID != 2 {
+			t.Fatalf("Expected message 1 removed after delete")
+		}
+		m = press(t, m, "a")
+		if len(m.filtered) != 1 || m.filtered[0].ID != 3 {
+			t.Fatalf("Expected message 2 removed after archive")
+		}
+
+		// Messages are named by UID, so the archive after the delete
+		// still hits message 2 rather than whatever is now number 1
+		want := []string{"read INBOX [101]", "delete INBOX [101]", "archive INBOX [102]"}
+		got := backend.calls[len(backend.calls)-3:]
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("Expected call %q, got %q", want[i], got[i])
+			}
+		}
+	})
+
+	t.Run("SavedSearchActsOnEachMessagesFolder", func(t *testing.T) {
+		backend := newFakeTUIBackend()
+		m := startTUI(t, backend)
+		m = press(t, m, "h", "down", "down", "down", "enter", "d", "a")
+		if len(m.filtered) != 0 {
+			t.Fatalf("Expected both messages removed, got %d", len(m.filtered))
+		}
+		want := []string{"delete Sent [405]", "archive INBOX [101]"}
+		got := backend.calls[len(backend.calls)-2:]
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("Expected call %q, got %q", want[i], got[i])
+			}
+		}
+	})
+
+	t.Run("FailedDeleteKeepsMessage", func(t *testing.T) {
+		backend := newFakeTUIBackend()
+		m := startTUI(t, backend)
+		backend.failNext = fmt.Errorf("connection reset")
+		m = press(t, m, "d")
+		if len(m.filtered) != 3 {
+			t.Errorf("Expected message kept after failed delete")
+		}
+		if m.err == nil {
+			t.Errorf("Expected error to be shown")
+		}
+	})
+
+	t.Run("SwitchAccount", func(t *testing.T) {
+		backend := newFakeTUIBackend()
+		m := startTUI(t, backend)
+		m = press(t, m, "A")
+		if m.currentAccount() != "work@example.com" {
+			t.Fatalf("Expected work account, got %s", m.currentAccount())
+		}
+		if len(m.filtered) != 1 || m.filtered[0].Subject != "Welcome" {
+			t.Errorf("Expected work inbox after switching, got %d messages", len(m.filtered))
+		}
+	})
+
+	t.Run("StaleLoadIgnored", func(t *testing.T) {
+		m := startTUI(t, newFakeTUIBackend())
+		next, _ := m.Update(tuiEmailsMsg{account: "me@example.com", folder: "Sent", emails: []*Email{{ID: 99}}})
+		m = next.(tuiModel)
+		if len(m.filtered) != 3 {
+			t.Errorf("Expected results for another folder to be ignored")
+		}
+	})
+
+	t.Run("ReplyAndForwardArePending", func(t *testing.T) {
+		m := startTUI(t, newFakeTUIBackend())
+		m = press(t, m, "r")
+		if m.pending == nil || m.pending.kind != "reply" || m.pending.email.ID != 1 {
+			t.Fatalf("Expected pending reply to message 1")
+		}
+
+		m = startTUI(t, newFakeTUIBackend())
+		m = press(t, m, "j", "f", "x", "@", "y", ".", "z", "enter")
+		if m.pending == nil || m.pending.kind != "forward" {
+			t.Fatalf("Expected pending forward")
+		}
+		if m.pending.email.ID != 2 || len(m.pending.to) != 1 || m.pending.to[0] != "x@y.z" {
+			t.Errorf("Unexpected forward %+v", m.pending)
+		}
+	})
+
+	t.Run("ViewRenders", func(t *testing.T) {
+		m := startTUI(t, newFakeTUIBackend())
+		view := m.View()
+		if view == "" {
+			t.Fatal("Expected a rendered view")
+		}
+		for _, want := range []string{"INBOX", "Lunch on Friday", "Shall we?"} {
+			if !containsIgnoreCase(view, want) {
+				t.Errorf("Expected view to contain %q", want)
+			}
+		}
+	})
+}